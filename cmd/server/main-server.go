@@ -9,6 +9,7 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 
 	"runtime"
 	"sync"
@@ -18,7 +19,9 @@ import (
 	"github.com/wavetermdev/waveterm/pkg/authkey"
 	"github.com/wavetermdev/waveterm/pkg/blockcontroller"
 	"github.com/wavetermdev/waveterm/pkg/filestore"
+	"github.com/wavetermdev/waveterm/pkg/hooks"
 	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/plugin"
 	"github.com/wavetermdev/waveterm/pkg/remote/conncontroller"
 	"github.com/wavetermdev/waveterm/pkg/service"
 	"github.com/wavetermdev/waveterm/pkg/telemetry"
@@ -29,6 +32,7 @@ import (
 	"github.com/wavetermdev/waveterm/pkg/wconfig"
 	"github.com/wavetermdev/waveterm/pkg/wcore"
 	"github.com/wavetermdev/waveterm/pkg/web"
+	"github.com/wavetermdev/waveterm/pkg/wlog"
 	"github.com/wavetermdev/waveterm/pkg/wps"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshremote"
@@ -36,6 +40,7 @@ import (
 	"github.com/wavetermdev/waveterm/pkg/wshutil"
 	"github.com/wavetermdev/waveterm/pkg/wsl"
 	"github.com/wavetermdev/waveterm/pkg/wstore"
+	"github.com/wavetermdev/waveterm/pkg/wtrace"
 )
 
 // these are set at build time
@@ -54,11 +59,13 @@ func doShutdown(reason string) {
 		ctx, cancelFn := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancelFn()
 		go blockcontroller.StopAllBlockControllers()
+		plugin.StopAll()
 		shutdownActivityUpdate()
 		sendTelemetryWrapper()
 		// TODO deal with flush in progress
 		clearTempFiles()
 		filestore.WFS.FlushCache(ctx)
+		wtrace.Shutdown()
 		watcher := wconfig.GetWatcher()
 		if watcher != nil {
 			watcher.Close()
@@ -95,10 +102,49 @@ func stdinReadWatch() {
 func configWatcher() {
 	watcher := wconfig.GetWatcher()
 	if watcher != nil {
+		watcher.RegisterUpdateHandler(applyLogConfig)
+		watcher.RegisterUpdateHandler(applyTracingConfig)
+		watcher.RegisterUpdateHandler(hooks.ApplyConfig)
 		watcher.Start()
 	}
 }
 
+func applyLogConfig(fullConfig wconfig.FullConfigType) {
+	settings := fullConfig.Settings
+	wlog.SetFormat(settings.LogFormat)
+	err := wlog.ConfigureLevels(settings.LogLevel, settings.LogPackageLevels)
+	if err != nil {
+		log.Printf("error configuring log levels: %v\n", err)
+	}
+	if logFile := wlog.GetLogFile(); logFile != nil {
+		logFile.SetOpts(getLogRotateOpts(settings))
+	}
+}
+
+func applyTracingConfig(fullConfig wconfig.FullConfigType) {
+	settings := fullConfig.Settings
+	wtrace.Configure(settings.TracingEnabled, settings.TracingEndpoint)
+}
+
+func getLogRotateOpts(settings wconfig.SettingsType) wlog.RotateOpts {
+	opts := wlog.DefaultRotateOpts()
+	if settings.LogMaxSizeMB != nil && *settings.LogMaxSizeMB > 0 {
+		opts.MaxSizeBytes = *settings.LogMaxSizeMB * 1024 * 1024
+	}
+	if settings.LogMaxAgeDays != nil {
+		// 0 keeps rotated logs regardless of age
+		opts.MaxAge = time.Duration(max(*settings.LogMaxAgeDays, 0)) * 24 * time.Hour
+	}
+	if settings.LogMaxTotalMB != nil {
+		// 0 means no cap on total size
+		opts.MaxTotalBytes = max(*settings.LogMaxTotalMB, 0) * 1024 * 1024
+	}
+	if settings.LogCompress != nil {
+		opts.Compress = *settings.LogCompress
+	}
+	return opts
+}
+
 func telemetryLoop() {
 	var nextSend int64
 	time.Sleep(InitialTelemetryWait)
@@ -207,8 +253,7 @@ func clearTempFiles() error {
 }
 
 func main() {
-	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
-	log.SetPrefix("[wavesrv] ")
+	wlog.Init(os.Stderr, wlog.Format_Text)
 	wavebase.WaveVersion = WaveVersion
 	wavebase.BuildTime = BuildTime
 
@@ -255,6 +300,10 @@ func main() {
 			log.Printf("error releasing wave lock: %v\n", err)
 		}
 	}()
+	_, err = wlog.EnableFileOutput(filepath.Join(wavebase.GetWaveDataDir(), wavebase.WaveSrvLogFileName), wlog.DefaultRotateOpts())
+	if err != nil {
+		log.Printf("error opening wavesrv log file: %v\n", err)
+	}
 	log.Printf("wave version: %s (%s)\n", WaveVersion, BuildTime)
 	log.Printf("wave data dir: %s\n", wavebase.GetWaveDataDir())
 	log.Printf("wave config dir: %s\n", wavebase.GetWaveConfigDir())
@@ -288,6 +337,10 @@ func main() {
 	}
 
 	createMainWshClient()
+	go func() {
+		defer panichandler.PanicHandler("LoadPlugins")
+		plugin.LoadPlugins()
+	}()
 	installShutdownSignalHandlers()
 	startupActivityUpdate()
 	go stdinReadWatch()
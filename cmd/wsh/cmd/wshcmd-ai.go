@@ -26,11 +26,14 @@ var aiCmd = &cobra.Command{
 
 var aiFileFlags []string
 var aiNewBlockFlag bool
+var aiContextFlags []string
 
 func init() {
 	rootCmd.AddCommand(aiCmd)
 	aiCmd.Flags().BoolVarP(&aiNewBlockFlag, "new", "n", false, "create a new AI block")
 	aiCmd.Flags().StringArrayVarP(&aiFileFlags, "file", "f", nil, "attach file content (use '-' for stdin)")
+	aiCmd.Flags().StringSliceVarP(&aiContextFlags, "context", "c", nil, "attach terminal context: lastcmd, cwd, system (default all)")
+	aiCmd.Flags().Lookup("context").NoOptDefVal = "all"
 }
 
 func encodeFile(builder *strings.Builder, file io.Reader, fileName string) error {
@@ -82,6 +85,32 @@ func aiRun(cmd *cobra.Command, args []string) (rtnErr error) {
 		}
 	}
 
+	// Attach context from this terminal (last command + output, cwd, os/shell)
+	if len(aiContextFlags) > 0 {
+		termORef, err := resolveSimpleId("this")
+		if err != nil {
+			return fmt.Errorf("resolving terminal block: %w", err)
+		}
+		var parts []string
+		for _, part := range aiContextFlags {
+			if part == "all" {
+				parts = nil
+				break
+			}
+			parts = append(parts, part)
+		}
+		termContext, err := wshclient.AiTermContextCommand(RpcClient, wshrpc.CommandAiTermContextData{
+			BlockId: termORef.OID,
+			Parts:   parts,
+		}, &wshrpc.RpcOpts{Timeout: 2000})
+		if err != nil {
+			return fmt.Errorf("getting terminal context: %w", err)
+		}
+		message.WriteString("\n")
+		message.WriteString(termContext)
+		message.WriteString("\n")
+	}
+
 	// Default to "waveai" block
 	isDefaultBlock := blockArg == ""
 	if isDefaultBlock {
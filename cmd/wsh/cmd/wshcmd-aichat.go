@@ -0,0 +1,184 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+)
+
+var aiChatCmd = &cobra.Command{
+	Use:   "aichat",
+	Short: "list, search, export, and resume saved ai chats",
+	Long: `AI chats are saved in their ai block.  Clearing a chat keeps it as a saved chat,
+and the current chat is restored when Wave restarts.  Use -b to only look at one ai block
+(by default every ai block is searched).  Chat ids can be abbreviated to a unique prefix.`,
+}
+
+var aiChatListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "list saved ai chats (newest first)",
+	Args:    cobra.NoArgs,
+	RunE:    aiChatListRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var aiChatSearchCmd = &cobra.Command{
+	Use:     "search TEXT...",
+	Short:   "search the titles and messages of saved ai chats",
+	Args:    cobra.MinimumNArgs(1),
+	RunE:    aiChatListRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var aiChatExportCmd = &cobra.Command{
+	Use:     "export CHATID",
+	Short:   "export an ai chat as markdown",
+	Example: "  wsh aichat export 3f2a -o chat.md\n  wsh aichat export -b 2 current",
+	Args:    cobra.ExactArgs(1),
+	RunE:    aiChatExportRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var aiChatResumeCmd = &cobra.Command{
+	Use:     "resume CHATID",
+	Short:   "make a saved chat the active chat of its ai block again",
+	Args:    cobra.ExactArgs(1),
+	RunE:    aiChatResumeRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var aiChatRenameCmd = &cobra.Command{
+	Use:     "rename CHATID [TITLE]",
+	Short:   "set the title of an ai chat (no title resets it to the first message)",
+	Args:    cobra.RangeArgs(1, 2),
+	RunE:    aiChatRenameRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var aiChatExportOutput string
+
+func init() {
+	aiChatExportCmd.Flags().StringVarP(&aiChatExportOutput, "output", "o", "", "write the markdown to a file instead of stdout")
+	rootCmd.AddCommand(aiChatCmd)
+	aiChatCmd.AddCommand(aiChatListCmd)
+	aiChatCmd.AddCommand(aiChatSearchCmd)
+	aiChatCmd.AddCommand(aiChatExportCmd)
+	aiChatCmd.AddCommand(aiChatResumeCmd)
+	aiChatCmd.AddCommand(aiChatRenameCmd)
+}
+
+// -b is optional for aichat (the default "this" block is a terminal, not an ai block)
+func aiChatBlockId() (string, error) {
+	if blockArg == "" {
+		return "", nil
+	}
+	oref, err := resolveBlockArg()
+	if err != nil {
+		return "", err
+	}
+	return oref.OID, nil
+}
+
+func shortId(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+func aiChatListRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("aichat", rtnErr == nil)
+	}()
+	blockId, err := aiChatBlockId()
+	if err != nil {
+		return err
+	}
+	chats, err := wshclient.AiChatListCommand(RpcClient, wshrpc.CommandAiChatListData{
+		BlockId: blockId,
+		Search:  strings.Join(args, " "),
+	}, &wshrpc.RpcOpts{Timeout: 10000})
+	if err != nil {
+		return fmt.Errorf("listing ai chats: %w", err)
+	}
+	if len(chats) == 0 {
+		WriteStdout("no ai chats found\n")
+		return nil
+	}
+	WriteStdout("%-8s %-8s %-16s %5s  %s\n", "block", "chat", "updated", "msgs", "title")
+	for _, chat := range chats {
+		updated := time.UnixMilli(chat.UpdatedTs).Format("2006-01-02 15:04")
+		WriteStdout("%-8s %-8s %-16s %5d  %s\n", shortId(chat.BlockId), shortId(chat.ChatId), updated, chat.NumMessages, chat.Title)
+		if chat.Match != "" && chat.Match != chat.Title {
+			WriteStdout("%42s%s\n", "", chat.Match)
+		}
+	}
+	return nil
+}
+
+func aiChatExportRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("aichat", rtnErr == nil)
+	}()
+	blockId, err := aiChatBlockId()
+	if err != nil {
+		return err
+	}
+	markdown, err := wshclient.AiChatExportCommand(RpcClient, wshrpc.CommandAiChatData{BlockId: blockId, ChatId: args[0]}, &wshrpc.RpcOpts{Timeout: 10000})
+	if err != nil {
+		return fmt.Errorf("exporting ai chat: %w", err)
+	}
+	if aiChatExportOutput == "" || aiChatExportOutput == "-" {
+		WriteStdout("%s", markdown)
+		return nil
+	}
+	err = os.WriteFile(aiChatExportOutput, []byte(markdown), 0644)
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", aiChatExportOutput, err)
+	}
+	WriteStdout("exported ai chat to %s\n", aiChatExportOutput)
+	return nil
+}
+
+func aiChatResumeRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("aichat", rtnErr == nil)
+	}()
+	blockId, err := aiChatBlockId()
+	if err != nil {
+		return err
+	}
+	err = wshclient.AiChatResumeCommand(RpcClient, wshrpc.CommandAiChatData{BlockId: blockId, ChatId: args[0]}, &wshrpc.RpcOpts{Timeout: 10000})
+	if err != nil {
+		return fmt.Errorf("resuming ai chat: %w", err)
+	}
+	WriteStdout("resumed ai chat %s\n", args[0])
+	return nil
+}
+
+func aiChatRenameRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("aichat", rtnErr == nil)
+	}()
+	blockId, err := aiChatBlockId()
+	if err != nil {
+		return err
+	}
+	data := wshrpc.CommandAiChatData{BlockId: blockId, ChatId: args[0]}
+	if len(args) > 1 {
+		data.Title = args[1]
+	}
+	err = wshclient.AiChatRenameCommand(RpcClient, data, &wshrpc.RpcOpts{Timeout: 5000})
+	if err != nil {
+		return fmt.Errorf("renaming ai chat: %w", err)
+	}
+	return nil
+}
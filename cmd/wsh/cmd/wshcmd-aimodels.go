@@ -0,0 +1,57 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+)
+
+var aiModelsCmd = &cobra.Command{
+	Use:     "aimodels [preset]",
+	Short:   "list the models available from an ai preset's server (ollama, llama.cpp, lm studio, openai-compatible)",
+	Example: "  wsh aimodels\n  wsh aimodels ai@ollama\n  wsh aimodels --apitype ollama\n  wsh aimodels --baseurl http://localhost:8080/v1",
+	Args:    cobra.MaximumNArgs(1),
+	RunE:    aiModelsRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var aiModelsApiType string
+var aiModelsBaseURL string
+
+func init() {
+	aiModelsCmd.Flags().StringVar(&aiModelsApiType, "apitype", "", "api type to query (e.g. ollama, llamacpp, lmstudio) instead of a preset")
+	aiModelsCmd.Flags().StringVar(&aiModelsBaseURL, "baseurl", "", "base url to query instead of a preset")
+	rootCmd.AddCommand(aiModelsCmd)
+}
+
+func aiModelsRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("aimodels", rtnErr == nil)
+	}()
+	var data wshrpc.CommandAiListModelsData
+	if aiModelsApiType != "" || aiModelsBaseURL != "" {
+		if len(args) > 0 {
+			return fmt.Errorf("cannot use a preset with --apitype or --baseurl")
+		}
+		data.Opts = &wshrpc.OpenAIOptsType{APIType: aiModelsApiType, BaseURL: aiModelsBaseURL}
+	} else if len(args) > 0 {
+		data.Preset = args[0]
+	}
+	models, err := wshclient.AiListModelsCommand(RpcClient, data, &wshrpc.RpcOpts{Timeout: 10000})
+	if err != nil {
+		return fmt.Errorf("listing models: %w", err)
+	}
+	if len(models) == 0 {
+		WriteStderr("no models found\n")
+		return nil
+	}
+	for _, model := range models {
+		WriteStdout("%s\n", model)
+	}
+	return nil
+}
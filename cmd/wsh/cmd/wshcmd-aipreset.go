@@ -0,0 +1,91 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+)
+
+var aiPresetCmd = &cobra.Command{
+	Use:   "aipreset [preset]",
+	Short: "list ai presets (profiles), or switch an ai block to a preset",
+	Long: `List the ai presets (no args), or switch the ai block given with -b to a preset.
+Presets are defined in presets/ai.json and can set the provider, model,
+temperature, and system prompt.`,
+	Example: "  wsh aipreset\n  wsh aipreset -b 2 ai@ollama-llama",
+	Args:    cobra.MaximumNArgs(1),
+	RunE:    aiPresetRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+func init() {
+	rootCmd.AddCommand(aiPresetCmd)
+}
+
+func aiPresetRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("aipreset", rtnErr == nil)
+	}()
+	if len(args) == 0 {
+		return aiPresetList()
+	}
+	if blockArg == "" {
+		return fmt.Errorf("use -b to choose the ai block to switch (e.g. -b 2)")
+	}
+	oref, err := resolveBlockArg()
+	if err != nil {
+		return err
+	}
+	err = wshclient.AiSetPresetCommand(RpcClient, wshrpc.CommandAiSetPresetData{BlockId: oref.OID, Preset: args[0]}, nil)
+	if err != nil {
+		return fmt.Errorf("switching preset: %w", err)
+	}
+	WriteStdout("switched ai block to %s\n", args[0])
+	return nil
+}
+
+func aiPresetList() error {
+	presets, err := wshclient.AiListPresetsCommand(RpcClient, &wshrpc.RpcOpts{Timeout: 2000})
+	if err != nil {
+		return fmt.Errorf("listing presets: %w", err)
+	}
+	var blockPreset string
+	if blockArg != "" {
+		oref, err := resolveBlockArg()
+		if err != nil {
+			return err
+		}
+		meta, err := wshclient.GetMetaCommand(RpcClient, wshrpc.CommandGetMetaData{ORef: *oref}, nil)
+		if err != nil {
+			return fmt.Errorf("getting block meta: %w", err)
+		}
+		blockPreset = waveobj.MetaMapType(meta).GetString("ai:preset", "")
+	}
+	for _, preset := range presets {
+		marker := " "
+		if preset.Key == blockPreset {
+			marker = ">"
+		}
+		details := preset.APIType
+		if preset.Model != "" {
+			details = fmt.Sprintf("%s %s", details, preset.Model)
+		}
+		if preset.Temperature != nil {
+			details = fmt.Sprintf("%s temp=%.2g", details, *preset.Temperature)
+		}
+		if preset.SystemPrompt {
+			details += " +systemprompt"
+		}
+		if preset.IsDefault {
+			details += " (default)"
+		}
+		WriteStdout("%s %-24s %-28s %s\n", marker, preset.Key, preset.Name, details)
+	}
+	return nil
+}
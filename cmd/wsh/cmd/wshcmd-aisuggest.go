@@ -0,0 +1,75 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+)
+
+var aiSuggestCmd = &cobra.Command{
+	Use:   "aisuggest [request...]",
+	Short: "ask the ai for a shell command and insert it at your prompt",
+	Long: `Ask the ai for a shell command using this terminal's context (the last command and its
+output, the cwd, and the os/shell).  With no request it suggests a fix for the last command.
+If you accept the suggestion it is inserted at your next prompt, it is never run for you.`,
+	Example: "  wsh aisuggest\n  wsh aisuggest find files over 100M in this directory\n  wsh aisuggest --preset ai@ollama-llama -y",
+	RunE:    aiSuggestRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var aiSuggestPreset string
+var aiSuggestYes bool
+
+func init() {
+	aiSuggestCmd.Flags().StringVar(&aiSuggestPreset, "preset", "", "ai preset to use (defaults to the ai:preset setting)")
+	aiSuggestCmd.Flags().BoolVarP(&aiSuggestYes, "yes", "y", false, "insert the suggested command without asking")
+	rootCmd.AddCommand(aiSuggestCmd)
+}
+
+func aiSuggestRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("aisuggest", rtnErr == nil)
+	}()
+	blockORef, err := resolveBlockArg()
+	if err != nil {
+		return err
+	}
+	WriteStderr("asking ai...\n")
+	suggestion, err := wshclient.AiSuggestCmdCommand(RpcClient, wshrpc.CommandAiSuggestCmdData{
+		BlockId: blockORef.OID,
+		Prompt:  strings.Join(args, " "),
+		Preset:  aiSuggestPreset,
+	}, &wshrpc.RpcOpts{Timeout: 90000})
+	if err != nil {
+		return err
+	}
+	WriteStdout("\n  %s\n", suggestion.Command)
+	if suggestion.Explanation != "" {
+		WriteStdout("  # %s\n", suggestion.Explanation)
+	}
+	WriteStdout("\n")
+	if !aiSuggestYes {
+		WriteStderr("insert this command at your prompt? [y/N] ")
+		answer, _ := bufio.NewReader(WrappedStdin).ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "y" && answer != "yes" {
+			return nil
+		}
+	}
+	err = wshclient.AiAcceptCmdCommand(RpcClient, wshrpc.CommandAiAcceptCmdData{
+		BlockId:      suggestion.BlockId,
+		Command:      suggestion.Command,
+		AtNextPrompt: blockArg == "" || blockArg == "this",
+	}, &wshrpc.RpcOpts{Timeout: 2000})
+	if err != nil {
+		return fmt.Errorf("inserting command: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+)
+
+var aiUsageCmd = &cobra.Command{
+	Use:   "aiusage",
+	Short: "show ai token usage (today and this month) and the token limits",
+	Long: `Show the ai tokens used today and this month per provider and profile (preset).
+Usage is kept locally with the other usage stats.  Limits are set with ai:dailytokenlimit
+and ai:monthlytokenlimit (in settings, or in a preset to limit just that preset), and
+ai:tokenlimitaction ("warn" or "block") controls what happens once a limit is reached.`,
+	Args:    cobra.NoArgs,
+	RunE:    aiUsageRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var aiUsageJson bool
+
+func init() {
+	aiUsageCmd.Flags().BoolVar(&aiUsageJson, "json", false, "output the usage as json")
+	rootCmd.AddCommand(aiUsageCmd)
+}
+
+func formatTokenLimit(used int64, limit int64) string {
+	if limit <= 0 {
+		return fmt.Sprintf("%d tokens", used)
+	}
+	return fmt.Sprintf("%d of %d tokens (%d%%)", used, limit, used*100/limit)
+}
+
+func writeAiUsageEntries(entries []wshrpc.AiUsageEntry, isMonth bool) {
+	if len(entries) == 0 {
+		WriteStdout("  (no ai requests)\n")
+		return
+	}
+	WriteStdout("  %-12s %-28s %8s %10s %10s\n", "provider", "profile", "requests", "prompt", "completion")
+	for _, entry := range entries {
+		WriteStdout("  %-12s %-28s %8d %10d %10d", entry.Provider, entry.Profile, entry.Requests, entry.PromptTokens, entry.CompletionTokens)
+		limit := entry.DailyLimit
+		if isMonth {
+			limit = entry.MonthlyLimit
+		}
+		if limit > 0 {
+			WriteStdout("  (limit %d)", limit)
+		}
+		WriteStdout("\n")
+	}
+}
+
+func aiUsageRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("aiusage", rtnErr == nil)
+	}()
+	usage, err := wshclient.AiUsageCommand(RpcClient, &wshrpc.RpcOpts{Timeout: 10000})
+	if err != nil {
+		return fmt.Errorf("getting ai usage: %w", err)
+	}
+	if aiUsageJson {
+		barr, err := json.MarshalIndent(usage, "", "  ")
+		if err != nil {
+			return fmt.Errorf("formatting usage: %w", err)
+		}
+		WriteStdout("%s\n", string(barr))
+		return nil
+	}
+	WriteStdout("today (%s): %s\n", usage.Day, formatTokenLimit(usage.DayTokens, usage.DailyLimit))
+	writeAiUsageEntries(usage.Today, false)
+	WriteStdout("\nthis month (since %s): %s\n", usage.MonthStart, formatTokenLimit(usage.MonthTokens, usage.MonthlyLimit))
+	writeAiUsageEntries(usage.Month, true)
+	if usage.LimitAction == "block" {
+		WriteStdout("\nrequests are blocked once a limit is reached\n")
+	} else {
+		WriteStdout("\nrequests are allowed with a warning once a limit is reached\n")
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "show the audit trail (connections, host keys, commands sent to remote hosts by automation)",
+	Long: `Show the audit trail.  Wave keeps a rolling history of significant events:
+connections opened/closed/failed, host keys accepted (or refused because they
+changed), and input and commands sent to remote hosts by automation (wsh, scripts).`,
+	Args:    cobra.NoArgs,
+	RunE:    auditRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var auditExportCmd = &cobra.Command{
+	Use:     "export",
+	Short:   "export the audit trail as csv or json",
+	Example: "  wsh audit export --format csv -o audit.csv\n  wsh audit export --since 168h --conn user@host",
+	Args:    cobra.NoArgs,
+	RunE:    auditExportRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var auditSince time.Duration
+var auditConn string
+var auditType string
+var auditLimit int
+var auditExportLimit int
+var auditFormat string
+var auditOutput string
+
+func init() {
+	for _, cmd := range []*cobra.Command{auditCmd, auditExportCmd} {
+		cmd.Flags().DurationVar(&auditSince, "since", 0, "only show events newer than this (e.g. 24h)")
+		cmd.Flags().StringVar(&auditConn, "conn", "", "only show events for this connection")
+		cmd.Flags().StringVar(&auditType, "type", "", "only show events of this type (e.g. conn, hostkey, remote:input)")
+	}
+	auditCmd.Flags().IntVarP(&auditLimit, "limit", "n", 50, "maximum number of events to show")
+	auditExportCmd.Flags().IntVarP(&auditExportLimit, "limit", "n", 100000, "maximum number of events to export")
+	auditExportCmd.Flags().StringVar(&auditFormat, "format", "json", "export format (json or csv)")
+	auditExportCmd.Flags().StringVarP(&auditOutput, "output", "o", "", "file to write (defaults to stdout)")
+	auditCmd.AddCommand(auditExportCmd)
+	rootCmd.AddCommand(auditCmd)
+}
+
+func getAuditEvents(limit int) ([]wshrpc.AuditEvent, error) {
+	data := wshrpc.CommandAuditEventsData{
+		Connection: auditConn,
+		EventType:  auditType,
+		Limit:      limit,
+	}
+	if auditSince > 0 {
+		data.SinceTs = time.Now().Add(-auditSince).UnixMilli()
+	}
+	events, err := wshclient.AuditEventsCommand(RpcClient, data, &wshrpc.RpcOpts{Timeout: 10000})
+	if err != nil {
+		return nil, fmt.Errorf("getting audit events: %w", err)
+	}
+	return events, nil
+}
+
+func formatAuditTs(ts int64) string {
+	return time.UnixMilli(ts).Format(time.RFC3339)
+}
+
+func auditRun(cmd *cobra.Command, args []string) error {
+	events, err := getAuditEvents(auditLimit)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		WriteStderr("no audit events\n")
+		return nil
+	}
+	for _, event := range events {
+		WriteStdout("%s  %-16s %-24s %s\n", formatAuditTs(event.Ts), event.EventType, event.Connection, strconv.Quote(event.Details))
+	}
+	return nil
+}
+
+func auditExportRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("audit", rtnErr == nil)
+	}()
+	if auditFormat != "json" && auditFormat != "csv" {
+		return fmt.Errorf("invalid format %q (expected json or csv)", auditFormat)
+	}
+	events, err := getAuditEvents(auditExportLimit)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if auditFormat == "json" {
+		if events == nil {
+			events = []wshrpc.AuditEvent{}
+		}
+		barr, err := json.MarshalIndent(events, "", "  ")
+		if err != nil {
+			return fmt.Errorf("formatting events: %w", err)
+		}
+		buf.Write(barr)
+		buf.WriteByte('\n')
+	} else {
+		csvWriter := csv.NewWriter(&buf)
+		csvWriter.Write([]string{"id", "time", "eventtype", "connection", "source", "details"})
+		for _, event := range events {
+			csvWriter.Write([]string{strconv.FormatInt(event.Id, 10), formatAuditTs(event.Ts), event.EventType, event.Connection, event.Source, event.Details})
+		}
+		csvWriter.Flush()
+		if err := csvWriter.Error(); err != nil {
+			return fmt.Errorf("formatting events: %w", err)
+		}
+	}
+	if auditOutput == "" {
+		WriteStdout("%s", buf.String())
+		return nil
+	}
+	err = os.WriteFile(auditOutput, buf.Bytes(), 0600)
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", auditOutput, err)
+	}
+	WriteStderr("exported %d audit events to %s\n", len(events), auditOutput)
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+)
+
+// long enough for the user to answer the permission prompt on remote connections
+const clipboardTimeout = 70000
+
+var clipboardCmd = &cobra.Command{
+	Use:   "clipboard",
+	Short: "read and write the local clipboard",
+	Long:  "Read and write the clipboard of the machine running Wave, including from remote connections",
+}
+
+var clipboardCopyCmd = &cobra.Command{
+	Use:     "copy [TEXT...]",
+	Short:   "copy text (or stdin) to the clipboard",
+	RunE:    clipboardCopyRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var clipboardPasteCmd = &cobra.Command{
+	Use:     "paste",
+	Short:   "write the clipboard contents to stdout",
+	Args:    cobra.NoArgs,
+	RunE:    clipboardPasteRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+func init() {
+	rootCmd.AddCommand(clipboardCmd)
+	clipboardCmd.AddCommand(clipboardCopyCmd)
+	clipboardCmd.AddCommand(clipboardPasteCmd)
+}
+
+func clipboardCopyRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("clipboard", rtnErr == nil)
+	}()
+	var text string
+	if len(args) > 0 {
+		text = strings.Join(args, " ")
+	} else {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("reading stdin: %w", err)
+		}
+		text = string(data)
+	}
+	err := wshclient.ClipboardWriteCommand(RpcClient, wshrpc.CommandClipboardData{Text: text}, &wshrpc.RpcOpts{Timeout: clipboardTimeout})
+	if err != nil {
+		return fmt.Errorf("copying to clipboard: %w", err)
+	}
+	return nil
+}
+
+func clipboardPasteRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("clipboard", rtnErr == nil)
+	}()
+	text, err := wshclient.ClipboardReadCommand(RpcClient, &wshrpc.RpcOpts{Timeout: clipboardTimeout})
+	if err != nil {
+		return fmt.Errorf("reading clipboard: %w", err)
+	}
+	WriteStdout("%s", text)
+	return nil
+}
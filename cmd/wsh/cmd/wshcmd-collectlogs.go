@@ -0,0 +1,36 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+)
+
+var collectLogsCmd = &cobra.Command{
+	Use:     "collectlogs",
+	Short:   "collect the current Wave logs into a zip file",
+	Args:    cobra.NoArgs,
+	RunE:    collectLogsRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+func init() {
+	rootCmd.AddCommand(collectLogsCmd)
+}
+
+func collectLogsRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("collectlogs", rtnErr == nil)
+	}()
+	path, err := wshclient.CollectLogsCommand(RpcClient, &wshrpc.RpcOpts{Timeout: 30000})
+	if err != nil {
+		return fmt.Errorf("collecting logs: %w", err)
+	}
+	WriteStdout("%s\n", path)
+	return nil
+}
@@ -4,8 +4,11 @@
 package cmd
 
 import (
+	"bufio"
 	"fmt"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/wavetermdev/waveterm/pkg/remote"
@@ -27,6 +30,24 @@ var connStatusCmd = &cobra.Command{
 	PreRunE: preRunSetupRpcClient,
 }
 
+var connListCmd = &cobra.Command{
+	Use:     "list [QUERY]",
+	Short:   "list connections, filtered by name, group, tag, or favorite",
+	Args:    cobra.MaximumNArgs(1),
+	RunE:    connListRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var connListFilter wshrpc.ConnListFilter
+
+var connWshVersionCmd = &cobra.Command{
+	Use:     "wshversion",
+	Short:   "show the wsh version on each connection",
+	Args:    cobra.NoArgs,
+	RunE:    connWshVersionRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
 var connReinstallCmd = &cobra.Command{
 	Use:     "reinstall CONNECTION",
 	Short:   "reinstall wsh on a connection",
@@ -59,6 +80,16 @@ var connConnectCmd = &cobra.Command{
 	PreRunE: preRunSetupRpcClient,
 }
 
+// the secrets for wsh conn connect --headless come from the environment, so they aren't in the
+// command line
+const (
+	HeadlessPasswordEnv   = "WSH_SSH_PASSWORD"
+	HeadlessPassphraseEnv = "WSH_SSH_PASSPHRASE"
+)
+
+var connConnectHeadless bool
+var connConnectHostKey string
+
 var connEnsureCmd = &cobra.Command{
 	Use:     "ensure CONNECTION",
 	Short:   "ensure wsh is installed on a connection",
@@ -67,18 +98,94 @@ var connEnsureCmd = &cobra.Command{
 	PreRunE: preRunSetupRpcClient,
 }
 
+var connRememberedCmd = &cobra.Command{
+	Use:     "remembered [CONNECTION]",
+	Short:   "list remembered prompt answers",
+	Args:    cobra.MaximumNArgs(1),
+	RunE:    connRememberedRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var connForgetCmd = &cobra.Command{
+	Use:     "forget CONNECTION [KEY]",
+	Short:   "forget remembered prompt answers for a connection (all of them if no key is given)",
+	Args:    cobra.RangeArgs(1, 2),
+	RunE:    connForgetRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var connSecretsCmd = &cobra.Command{
+	Use:     "secrets",
+	Short:   "list the ssh passwords and key passphrases saved in the system keychain",
+	Args:    cobra.NoArgs,
+	RunE:    connSecretsRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var connForgetSecretCmd = &cobra.Command{
+	Use:     "forgetsecret [KEY]",
+	Short:   "delete a saved password or passphrase from the system keychain",
+	Args:    cobra.MaximumNArgs(1),
+	RunE:    connForgetSecretRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var connFlushPassphrasesCmd = &cobra.Command{
+	Use:     "flushpassphrases",
+	Short:   "forget the key passphrases and unlocked keys kept in memory for this session",
+	Args:    cobra.NoArgs,
+	RunE:    connFlushPassphrasesRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var connSetTotpCmd = &cobra.Command{
+	Use:     "settotp CONNECTION [SECRET]",
+	Short:   "save the totp secret for a connection in the system keychain (read from stdin if not given)",
+	Args:    cobra.RangeArgs(1, 2),
+	RunE:    connSetTotpRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var connDebugLogCmd = &cobra.Command{
+	Use:   "debuglog CONNECTION [on|off|clear]",
+	Short: "show, toggle, or clear the verbose debug log for a connection",
+	Long: `Show the verbose debug log for a connection (auth attempts, host key checks,
+channel opens, keepalives, errors), turn it on or off, or clear it.  The log is
+also available as wavefile://client/conndebug/CONNECTION.log.`,
+	Example: "  wsh conn debuglog user@host on\n  wsh conn debuglog user@host > debug.log\n  wsh conn debuglog user@host clear",
+	Args:    cobra.RangeArgs(1, 2),
+	RunE:    connDebugLogRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
 func init() {
 	rootCmd.AddCommand(connCmd)
 	connCmd.AddCommand(connStatusCmd)
+	connListCmd.Flags().StringVar(&connListFilter.Group, "group", "", "only list connections in this display:group")
+	connListCmd.Flags().StringSliceVar(&connListFilter.Tags, "tag", nil, "only list connections with this display:tags tag (can be repeated)")
+	connListCmd.Flags().BoolVar(&connListFilter.Favorites, "favorites", false, "only list favorite connections")
+	connListCmd.Flags().BoolVar(&connListFilter.ShowHidden, "all", false, "include connections with display:hidden")
+	connCmd.AddCommand(connListCmd)
+	connCmd.AddCommand(connWshVersionCmd)
 	connCmd.AddCommand(connReinstallCmd)
 	connCmd.AddCommand(connDisconnectCmd)
 	connCmd.AddCommand(connDisconnectAllCmd)
+	connConnectCmd.Flags().BoolVar(&connConnectHeadless, "headless", false, "fail instead of prompting (for scripts), the password and passphrase are read from "+HeadlessPasswordEnv+" and "+HeadlessPassphraseEnv)
+	connConnectCmd.Flags().StringVar(&connConnectHostKey, "hostkey", "", "host key policy for --headless: yes, accept-new, or no (overrides StrictHostKeyChecking)")
 	connCmd.AddCommand(connConnectCmd)
 	connCmd.AddCommand(connEnsureCmd)
+	connCmd.AddCommand(connRememberedCmd)
+	connCmd.AddCommand(connForgetCmd)
+	connCmd.AddCommand(connSecretsCmd)
+	connForgetSecretCmd.Flags().Bool("all", false, "delete all saved secrets")
+	connCmd.AddCommand(connForgetSecretCmd)
+	connCmd.AddCommand(connSetTotpCmd)
+	connCmd.AddCommand(connFlushPassphrasesCmd)
+	connCmd.AddCommand(connDebugLogCmd)
 }
 
 func validateConnectionName(name string) error {
-	if !strings.HasPrefix(name, "wsl://") {
+	if !strings.HasPrefix(name, "wsl://") && !strings.HasPrefix(name, "k8s://") && !strings.HasPrefix(name, "docker://") && !strings.HasPrefix(name, "podman://") && !strings.HasPrefix(name, "containerd://") && !strings.HasPrefix(name, "incus://") && !strings.HasPrefix(name, "lxd://") && !strings.HasPrefix(name, "telnet://") {
 		_, err := remote.ParseOpts(name)
 		if err != nil {
 			return fmt.Errorf("cannot parse connection name: %w", err)
@@ -115,6 +222,68 @@ func connStatusRun(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func connListRun(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		connListFilter.Query = args[0]
+	}
+	resp, err := wshclient.ConnListInfoCommand(RpcClient, connListFilter, nil)
+	if err != nil {
+		return fmt.Errorf("listing connections: %w", err)
+	}
+	if len(resp) == 0 {
+		WriteStdout("no connections\n")
+		return nil
+	}
+	WriteStdout("%-30s %-15s %-12s %s\n", "connection", "group", "status", "tags")
+	WriteStdout("----------------------------------------------------------------------\n")
+	for _, entry := range resp {
+		name := entry.Connection
+		if entry.Favorite {
+			name = "* " + name
+		}
+		WriteStdout("%-30s %-15s %-12s %s\n", name, entry.Group, entry.Status, strings.Join(entry.Tags, ","))
+	}
+	return nil
+}
+
+func connWshVersionRun(cmd *cobra.Command, args []string) error {
+	resp, err := wshclient.WshHelperStatusCommand(RpcClient, nil)
+	if err != nil {
+		return fmt.Errorf("getting wsh versions: %w", err)
+	}
+	if len(resp) == 0 {
+		WriteStdout("no connections\n")
+		return nil
+	}
+	WriteStdout("%-30s %-12s %s\n", "connection", "version", "status")
+	WriteStdout("----------------------------------------------\n")
+	for _, helper := range resp {
+		version := helper.Version
+		var status string
+		switch {
+		case !helper.WshEnabled:
+			status = "wsh disabled"
+		case version == "":
+			status = "not running"
+		case helper.UpToDate:
+			status = "up to date"
+		default:
+			status = fmt.Sprintf("expected %s", helper.ExpectedVersion)
+		}
+		if version == "" {
+			version = "-"
+		}
+		if helper.UpdateTime > 0 {
+			status += fmt.Sprintf(" (updated %s)", time.UnixMilli(helper.UpdateTime).Format(time.DateTime))
+		}
+		if helper.WshError != "" {
+			status += fmt.Sprintf(" (%s)", helper.WshError)
+		}
+		WriteStdout("%-30s %-12s %s\n", helper.Connection, version, status)
+	}
+	return nil
+}
+
 func connReinstallRun(cmd *cobra.Command, args []string) error {
 	connName := args[0]
 	if err := validateConnectionName(connName); err != nil {
@@ -167,7 +336,17 @@ func connConnectRun(cmd *cobra.Command, args []string) error {
 	if err := validateConnectionName(connName); err != nil {
 		return err
 	}
-	err := wshclient.ConnConnectCommand(RpcClient, wshrpc.ConnRequest{Host: connName}, &wshrpc.RpcOpts{Timeout: 60000})
+	connRequest := wshrpc.ConnRequest{Host: connName}
+	if connConnectHeadless {
+		connRequest.Headless = &wshrpc.ConnHeadlessOpts{
+			Password:              os.Getenv(HeadlessPasswordEnv),
+			Passphrase:            os.Getenv(HeadlessPassphraseEnv),
+			StrictHostKeyChecking: connConnectHostKey,
+		}
+	} else if connConnectHostKey != "" {
+		return fmt.Errorf("--hostkey can only be used with --headless")
+	}
+	err := wshclient.ConnConnectCommand(RpcClient, connRequest, &wshrpc.RpcOpts{Timeout: 60000})
 	if err != nil {
 		return fmt.Errorf("connecting connection: %w", err)
 	}
@@ -187,3 +366,159 @@ func connEnsureRun(cmd *cobra.Command, args []string) error {
 	WriteStdout("wsh ensured on connection %q\n", connName)
 	return nil
 }
+
+func connRememberedRun(cmd *cobra.Command, args []string) error {
+	var connName string
+	if len(args) > 0 {
+		connName = args[0]
+	}
+	resp, err := wshclient.ListRememberedAnswersCommand(RpcClient, connName, nil)
+	if err != nil {
+		return fmt.Errorf("listing remembered answers: %w", err)
+	}
+	if len(resp) == 0 {
+		WriteStdout("no remembered answers\n")
+		return nil
+	}
+	WriteStdout("%-30s %-30s %s\n", "connection", "key", "answer")
+	WriteStdout("----------------------------------------------------------------------\n")
+	for _, answer := range resp {
+		WriteStdout("%-30s %-30s %s\n", answer.Connection, answer.Key, answer.Answer)
+	}
+	return nil
+}
+
+func connForgetRun(cmd *cobra.Command, args []string) error {
+	data := wshrpc.CommandClearRememberedAnswersData{Connection: args[0]}
+	if len(args) > 1 {
+		data.Key = args[1]
+	}
+	err := wshclient.ClearRememberedAnswersCommand(RpcClient, data, nil)
+	if err != nil {
+		return fmt.Errorf("clearing remembered answers: %w", err)
+	}
+	if data.Key != "" {
+		WriteStdout("forgot %q for connection %q\n", data.Key, data.Connection)
+	} else {
+		WriteStdout("forgot all remembered answers for connection %q\n", data.Connection)
+	}
+	return nil
+}
+
+func connSecretsRun(cmd *cobra.Command, args []string) error {
+	resp, err := wshclient.KeychainListCommand(RpcClient, nil)
+	if err != nil {
+		return fmt.Errorf("listing saved secrets: %w", err)
+	}
+	if len(resp) == 0 {
+		WriteStdout("no saved secrets\n")
+		return nil
+	}
+	WriteStdout("%-50s %-20s %s\n", "key", "saved", "connection")
+	WriteStdout("----------------------------------------------------------------------\n")
+	for _, secret := range resp {
+		savedTime := time.UnixMilli(secret.CreatedTs).Format(time.DateTime)
+		WriteStdout("%-50s %-20s %s\n", secret.Key, savedTime, secret.Connection)
+	}
+	return nil
+}
+
+func connForgetSecretRun(cmd *cobra.Command, args []string) error {
+	all, _ := cmd.Flags().GetBool("all")
+	if all == (len(args) > 0) {
+		return fmt.Errorf("give either a key (see wsh conn secrets) or --all")
+	}
+	data := wshrpc.CommandKeychainDeleteData{All: all}
+	if len(args) > 0 {
+		data.Key = args[0]
+	}
+	err := wshclient.KeychainDeleteCommand(RpcClient, data, nil)
+	if err != nil {
+		return fmt.Errorf("deleting saved secrets: %w", err)
+	}
+	if all {
+		WriteStdout("deleted all saved secrets\n")
+	} else {
+		WriteStdout("deleted %q\n", data.Key)
+	}
+	return nil
+}
+
+func connFlushPassphrasesRun(cmd *cobra.Command, args []string) error {
+	count, err := wshclient.PassphraseCacheFlushCommand(RpcClient, nil)
+	if err != nil {
+		return fmt.Errorf("flushing cached passphrases: %w", err)
+	}
+	WriteStdout("forgot %d cached passphrase(s) and key(s)\n", count)
+	return nil
+}
+
+func connSetTotpRun(cmd *cobra.Command, args []string) error {
+	connName := args[0]
+	if _, err := remote.ParseOpts(connName); err != nil {
+		return fmt.Errorf("totp secrets are for ssh connections: %w", err)
+	}
+	var secret string
+	if len(args) > 1 {
+		secret = args[1]
+	} else {
+		WriteStderr("totp secret (base32 or otpauth:// uri): ")
+		secret, _ = bufio.NewReader(WrappedStdin).ReadString('\n')
+	}
+	secret = strings.TrimSpace(secret)
+	if secret == "" {
+		return fmt.Errorf("no totp secret given")
+	}
+	err := wshclient.KeychainSetTotpCommand(RpcClient, wshrpc.CommandKeychainSetTotpData{Connection: connName, Secret: secret}, nil)
+	if err != nil {
+		return fmt.Errorf("saving the totp secret: %w", err)
+	}
+	WriteStdout("saved the totp secret for %s\n", connName)
+	return nil
+}
+
+func connDebugLogRun(cmd *cobra.Command, args []string) error {
+	connName := args[0]
+	if err := validateConnectionName(connName); err != nil {
+		return err
+	}
+	action := ""
+	if len(args) > 1 {
+		action = args[1]
+	}
+	switch action {
+	case "":
+		logStr, err := wshclient.ConnDebugLogCommand(RpcClient, wshrpc.CommandConnDebugLogData{Connection: connName}, &wshrpc.RpcOpts{Timeout: 5000})
+		if err != nil {
+			return fmt.Errorf("reading debug log: %w", err)
+		}
+		if logStr == "" {
+			WriteStderr("debug log for %q is empty (turn it on with: wsh conn debuglog %s on)\n", connName, connName)
+			return nil
+		}
+		WriteStdout("%s", logStr)
+	case "on", "off":
+		var val any = true
+		if action == "off" {
+			val = nil
+		}
+		data := wshrpc.ConnConfigRequest{
+			Host:        connName,
+			MetaMapType: map[string]any{"conn:debuglog": val},
+		}
+		err := wshclient.SetConnectionsConfigCommand(RpcClient, data, nil)
+		if err != nil {
+			return fmt.Errorf("updating connection config: %w", err)
+		}
+		WriteStdout("debug log for %q turned %s\n", connName, action)
+	case "clear":
+		_, err := wshclient.ConnDebugLogCommand(RpcClient, wshrpc.CommandConnDebugLogData{Connection: connName, Clear: true}, nil)
+		if err != nil {
+			return fmt.Errorf("clearing debug log: %w", err)
+		}
+		WriteStdout("debug log for %q cleared\n", connName)
+	default:
+		return fmt.Errorf("unknown action %q (expected on, off, or clear)", action)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+)
+
+var connBroadcastConns []string
+var connBroadcastTimeout int
+var connBroadcastParallel int
+
+var connBroadcastCmd = &cobra.Command{
+	Use:   "broadcast -c CONNECTION [-c CONNECTION...] -- COMMAND",
+	Short: "run a command on several ssh connections at once",
+	Long: `Run a command on several ssh connections at once (connecting them if needed).  Each line of output
+is prefixed with its connection, and the exit code of each connection is printed when it finishes.
+The command fails if it fails (or can't be run) on any connection.`,
+	Args:    cobra.MinimumNArgs(1),
+	RunE:    connBroadcastRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+func init() {
+	connBroadcastCmd.Flags().StringSliceVarP(&connBroadcastConns, "conn", "c", nil, "connection to run the command on (can be repeated, or comma separated)")
+	connBroadcastCmd.Flags().IntVarP(&connBroadcastTimeout, "timeout", "t", 0, "timeout in seconds for the whole broadcast (0 for none)")
+	connBroadcastCmd.Flags().IntVarP(&connBroadcastParallel, "parallel", "p", 0, "max connections to run at once (default 32)")
+	connBroadcastCmd.MarkFlagRequired("conn")
+	connCmd.AddCommand(connBroadcastCmd)
+}
+
+// prints whole lines with a connection prefix (output arrives in arbitrary chunks)
+type broadcastLineBuf struct {
+	prefix  string
+	writeFn func(format string, args ...interface{})
+	buf     []byte
+}
+
+func (lb *broadcastLineBuf) write(data []byte) {
+	lb.buf = append(lb.buf, data...)
+	for {
+		idx := bytes.IndexByte(lb.buf, '\n')
+		if idx == -1 {
+			return
+		}
+		lb.writeFn("%s%s\n", lb.prefix, lb.buf[:idx])
+		lb.buf = lb.buf[idx+1:]
+	}
+}
+
+func (lb *broadcastLineBuf) flush() {
+	if len(lb.buf) > 0 {
+		lb.writeFn("%s%s\n", lb.prefix, lb.buf)
+		lb.buf = nil
+	}
+}
+
+func connBroadcastRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("conn", rtnErr == nil)
+	}()
+	connNames := make(map[string]bool)
+	for _, connName := range connBroadcastConns {
+		if err := validateConnectionName(connName); err != nil {
+			return err
+		}
+		connNames[connName] = true
+	}
+	data := wshrpc.CommandConnBroadcastData{
+		Connections: connBroadcastConns,
+		Command:     strings.Join(args, " "),
+		TimeoutMs:   connBroadcastTimeout * 1000,
+		MaxParallel: connBroadcastParallel,
+	}
+	// the rpc timeout is only a backstop, the broadcast has its own timeout
+	rpcTimeout := connCopyTimeoutMs
+	if data.TimeoutMs > 0 {
+		rpcTimeout = data.TimeoutMs + 10000
+	}
+	lineBufs := make(map[string]*broadcastLineBuf)
+	getLineBuf := func(event wshrpc.ConnBroadcastEvent) *broadcastLineBuf {
+		key := event.Connection + " " + event.Type
+		if lineBufs[key] == nil {
+			writeFn := WriteStdout
+			if event.Type == wshrpc.BroadcastEvent_Stderr {
+				writeFn = WriteStderr
+			}
+			lineBufs[key] = &broadcastLineBuf{prefix: fmt.Sprintf("[%s] ", event.Connection), writeFn: writeFn}
+		}
+		return lineBufs[key]
+	}
+	var numFailed int
+	respCh := wshclient.ConnBroadcastCommand(RpcClient, data, &wshrpc.RpcOpts{Timeout: rpcTimeout})
+	for resp := range respCh {
+		if resp.Error != nil {
+			return fmt.Errorf("broadcast failed: %w", resp.Error)
+		}
+		event := resp.Response
+		switch event.Type {
+		case wshrpc.BroadcastEvent_Stdout, wshrpc.BroadcastEvent_Stderr:
+			output, err := base64.StdEncoding.DecodeString(event.Data64)
+			if err != nil {
+				continue
+			}
+			getLineBuf(event).write(output)
+		case wshrpc.BroadcastEvent_Exit, wshrpc.BroadcastEvent_Error:
+			for _, stream := range []string{wshrpc.BroadcastEvent_Stdout, wshrpc.BroadcastEvent_Stderr} {
+				getLineBuf(wshrpc.ConnBroadcastEvent{Connection: event.Connection, Type: stream}).flush()
+			}
+			if event.Type == wshrpc.BroadcastEvent_Error {
+				numFailed++
+				WriteStderr("[%s] error: %s\n", event.Connection, event.Error)
+			} else if event.ExitCode != 0 {
+				numFailed++
+				WriteStderr("[%s] exited with code %d\n", event.Connection, event.ExitCode)
+			} else {
+				WriteStderr("[%s] done\n", event.Connection)
+			}
+		}
+	}
+	if numFailed > 0 {
+		return fmt.Errorf("failed on %d of %d connections", numFailed, len(connNames))
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+)
+
+// long enough for large files, the copy is cancelled if wsh exits
+const connCopyTimeoutMs = 24 * 60 * 60 * 1000
+
+var connCopyResume bool
+var connCopyForce bool
+
+var connUploadCmd = &cobra.Command{
+	Use:   "upload CONNECTION LOCALFILE REMOTEPATH",
+	Short: "upload a file to an ssh connection",
+	Long: `Upload a file from this machine to an ssh connection (wsh does not need to be installed on the remote).
+If REMOTEPATH ends in "/" the file keeps its name.  The copy is verified with a sha256 checksum, and an
+interrupted copy can be continued with --resume.`,
+	Args:    cobra.ExactArgs(3),
+	RunE:    connUploadRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var connDownloadCmd = &cobra.Command{
+	Use:   "download CONNECTION REMOTEFILE [LOCALPATH]",
+	Short: "download a file from an ssh connection",
+	Long: `Download a file from an ssh connection to this machine (the current directory by default).
+The copy is verified with a sha256 checksum, and an interrupted copy can be continued with --resume.`,
+	Args:    cobra.RangeArgs(2, 3),
+	RunE:    connDownloadRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{connUploadCmd, connDownloadCmd} {
+		cmd.Flags().BoolVarP(&connCopyResume, "resume", "r", false, "continue an interrupted copy")
+		cmd.Flags().BoolVarP(&connCopyForce, "force", "f", false, "overwrite the destination if it exists")
+		connCmd.AddCommand(cmd)
+	}
+}
+
+func connUploadRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("conn", rtnErr == nil)
+	}()
+	connName := args[0]
+	if err := validateConnectionName(connName); err != nil {
+		return err
+	}
+	localPath, err := filepath.Abs(args[1])
+	if err != nil {
+		return fmt.Errorf("resolving local path: %w", err)
+	}
+	remotePath := args[2]
+	if strings.HasSuffix(remotePath, "/") {
+		remotePath += filepath.Base(localPath)
+	}
+	return runConnCopy(wshrpc.CommandConnCopyFileData{
+		Connection: connName,
+		Direction:  wshrpc.CopyDirection_Upload,
+		LocalPath:  localPath,
+		RemotePath: remotePath,
+		Resume:     connCopyResume,
+		Overwrite:  connCopyForce,
+	})
+}
+
+func connDownloadRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("conn", rtnErr == nil)
+	}()
+	connName := args[0]
+	if err := validateConnectionName(connName); err != nil {
+		return err
+	}
+	remotePath := args[1]
+	localArg := "."
+	if len(args) > 2 {
+		localArg = args[2]
+	}
+	localPath, err := filepath.Abs(localArg)
+	if err != nil {
+		return fmt.Errorf("resolving local path: %w", err)
+	}
+	if localArg == "." || strings.HasSuffix(localArg, "/") || strings.HasSuffix(localArg, string(filepath.Separator)) {
+		localPath = filepath.Join(localPath, path.Base(remotePath))
+	}
+	return runConnCopy(wshrpc.CommandConnCopyFileData{
+		Connection: connName,
+		Direction:  wshrpc.CopyDirection_Download,
+		LocalPath:  localPath,
+		RemotePath: remotePath,
+		Resume:     connCopyResume,
+		Overwrite:  connCopyForce,
+	})
+}
+
+func runConnCopy(data wshrpc.CommandConnCopyFileData) error {
+	if RpcContext.Conn != "" {
+		return fmt.Errorf("wsh conn %s copies to and from the machine running Wave, run it in a local terminal", data.Direction)
+	}
+	respCh := wshclient.ConnCopyFileCommand(RpcClient, data, &wshrpc.RpcOpts{Timeout: connCopyTimeoutMs})
+	var lastProgress wshrpc.ConnCopyFileProgress
+	var showedProgress bool
+	var copyErr error
+	for resp := range respCh {
+		if resp.Error != nil {
+			copyErr = resp.Error
+			break
+		}
+		lastProgress = resp.Response
+		if lastProgress.Done || lastProgress.TotalBytes <= 0 {
+			continue
+		}
+		showedProgress = true
+		WriteStderr("\r%sing... %d%% (%d of %d bytes)", data.Direction, lastProgress.Bytes*100/lastProgress.TotalBytes, lastProgress.Bytes, lastProgress.TotalBytes)
+	}
+	if showedProgress {
+		WriteStderr("\n")
+	}
+	if copyErr != nil {
+		return fmt.Errorf("%s failed: %w", data.Direction, copyErr)
+	}
+	if !lastProgress.Done {
+		return fmt.Errorf("%s did not finish", data.Direction)
+	}
+	dest := data.RemotePath
+	if data.Direction == wshrpc.CopyDirection_Download {
+		dest = data.LocalPath
+	}
+	if lastProgress.Verified {
+		WriteStderr("%sed %d bytes to %s (sha256 %s)\n", data.Direction, lastProgress.TotalBytes, dest, lastProgress.Checksum)
+	} else {
+		WriteStderr("%sed %d bytes to %s (not verified, sha256sum is not installed on the remote)\n", data.Direction, lastProgress.TotalBytes, dest)
+	}
+	return nil
+}
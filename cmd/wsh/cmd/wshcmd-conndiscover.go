@@ -0,0 +1,102 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+)
+
+var connDiscoverData wshrpc.CommandDiscoverHostsData
+var connDiscoverAccept []string
+
+var connDiscoverCmd = &cobra.Command{
+	Use:   "discover",
+	Short: "find ssh servers on the local network",
+	Long: `Find ssh servers on the local network, from the machine running Wave.  Hosts advertising
+_ssh._tcp over mDNS (Bonjour, avahi) are always looked for, and subnets are scanned for ssh
+servers with --scan (a CIDR, an address, or "local" for the /24 of each network interface).
+The hosts are only listed, --accept saves the chosen ones (by the connection names in the list)
+as connections tagged "discovered".`,
+	Example: "  wsh conn discover\n  wsh conn discover --scan local\n  wsh conn discover --scan 10.0.4.0/24 --port 2222 --no-mdns --accept nas.lan:2222,10.0.4.7:2222",
+	Args:    cobra.NoArgs,
+	RunE:    connDiscoverRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+func init() {
+	connDiscoverCmd.Flags().StringSliceVar(&connDiscoverData.Subnets, "scan", nil, "scan a subnet (CIDR, address, or \"local\") for ssh servers (can be repeated)")
+	connDiscoverCmd.Flags().IntVar(&connDiscoverData.Port, "port", 22, "port to scan")
+	connDiscoverCmd.Flags().IntVar(&connDiscoverData.TimeoutMs, "timeout", 3000, "how long to wait for mDNS answers, in milliseconds")
+	connDiscoverCmd.Flags().BoolVar(&connDiscoverData.NoMdns, "no-mdns", false, "don't look for hosts with mDNS")
+	connDiscoverCmd.Flags().StringSliceVar(&connDiscoverAccept, "accept", nil, "save these discovered hosts as connections (comma separated, or repeated)")
+	connCmd.AddCommand(connDiscoverCmd)
+}
+
+func connDiscoverRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("conn", rtnErr == nil)
+	}()
+	if connDiscoverData.NoMdns && len(connDiscoverData.Subnets) == 0 {
+		return fmt.Errorf("nothing to discover, use --scan with --no-mdns")
+	}
+	timeout := connDiscoverData.TimeoutMs + 5000
+	if len(connDiscoverData.Subnets) > 0 {
+		// a large scan can take a while
+		timeout = max(timeout, 120000)
+	}
+	hosts, err := wshclient.DiscoverHostsCommand(RpcClient, connDiscoverData, &wshrpc.RpcOpts{Timeout: timeout})
+	if err != nil {
+		return fmt.Errorf("discovering hosts: %w", err)
+	}
+	if len(hosts) == 0 {
+		WriteStdout("no ssh servers found\n")
+		return nil
+	}
+	WriteStdout("%-30s %-6s %-30s %s\n", "connection", "source", "name", "addresses")
+	WriteStdout("----------------------------------------------------------------------\n")
+	numNew := 0
+	for _, host := range hosts {
+		name := host.Connection
+		if host.Known {
+			name = "= " + name
+		} else {
+			numNew++
+		}
+		WriteStdout("%-30s %-6s %-30s %s\n", name, host.Source, host.Name, strings.Join(host.Addrs, ","))
+	}
+	if len(connDiscoverAccept) == 0 {
+		if numNew > 0 {
+			WriteStdout("(%d new hosts, use --accept CONNECTION,... to save them as connections)\n", numNew)
+		}
+		return nil
+	}
+	// every name is checked before anything is saved
+	var accepted []wshrpc.DiscoveredHost
+	for _, connName := range connDiscoverAccept {
+		idx := slices.IndexFunc(hosts, func(host wshrpc.DiscoveredHost) bool { return host.Connection == connName })
+		if idx == -1 {
+			return fmt.Errorf("%q was not discovered", connName)
+		}
+		if hosts[idx].Known {
+			WriteStderr("%s is already a connection, skipping\n", connName)
+			continue
+		}
+		accepted = append(accepted, hosts[idx])
+	}
+	for _, host := range accepted {
+		data := wshrpc.ConnConfigRequest{Host: host.Connection, MetaMapType: host.Keywords}
+		err := wshclient.SetConnectionsConfigCommand(RpcClient, data, nil)
+		if err != nil {
+			return fmt.Errorf("saving connection %q: %w", host.Connection, err)
+		}
+		WriteStdout("saved %s\n", host.Connection)
+	}
+	return nil
+}
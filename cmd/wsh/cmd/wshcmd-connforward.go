@@ -0,0 +1,178 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+)
+
+var connForwardRemote bool
+var connForwardDynamic bool
+var connForwardSave bool
+
+var connForwardCmd = &cobra.Command{
+	Use:   "forward",
+	Short: "manage port forwards on ssh connections",
+}
+
+var connForwardListCmd = &cobra.Command{
+	Use:     "list [CONNECTION]",
+	Short:   "list port forwards (for all connections if none is given)",
+	Args:    cobra.MaximumNArgs(1),
+	RunE:    connForwardListRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var connForwardAddCmd = &cobra.Command{
+	Use:     "add CONNECTION SPEC [-R|-D] [--save]",
+	Short:   "start a port forward, SPEC is \"[bind:]port host:hostport\" (or \"[bind:]port\" for -D)",
+	Args:    cobra.RangeArgs(2, 3),
+	RunE:    connForwardAddRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var connForwardSocksCmd = &cobra.Command{
+	Use:     "socks CONNECTION",
+	Short:   "print the url of a socks5 proxy through the connection (starting one if needed)",
+	Args:    cobra.ExactArgs(1),
+	RunE:    connForwardSocksRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var connForwardRemoveCmd = &cobra.Command{
+	Use:     "remove CONNECTION SPEC [-R|-D] [--save]",
+	Short:   "stop a port forward",
+	Args:    cobra.RangeArgs(2, 3),
+	RunE:    connForwardRemoveRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{connForwardAddCmd, connForwardRemoveCmd} {
+		cmd.Flags().BoolVarP(&connForwardRemote, "remote", "R", false, "remote (reverse) forward, listens on the remote host")
+		cmd.Flags().BoolVarP(&connForwardDynamic, "dynamic", "D", false, "dynamic forward, a local socks5 proxy")
+		cmd.MarkFlagsMutuallyExclusive("remote", "dynamic")
+		cmd.Flags().BoolVar(&connForwardSave, "save", false, "also update the forward in connections.json")
+	}
+	connForwardCmd.AddCommand(connForwardListCmd)
+	connForwardCmd.AddCommand(connForwardAddCmd)
+	connForwardCmd.AddCommand(connForwardRemoveCmd)
+	connForwardCmd.AddCommand(connForwardSocksCmd)
+	connCmd.AddCommand(connForwardCmd)
+}
+
+// the spec can be given as one argument or as two ("8080" "localhost:80")
+func getConnForwardData(args []string) (wshrpc.CommandConnForwardData, error) {
+	connName := args[0]
+	if err := validateConnectionName(connName); err != nil {
+		return wshrpc.CommandConnForwardData{}, err
+	}
+	spec := args[1]
+	if len(args) == 3 {
+		spec = args[1] + " " + args[2]
+	}
+	forwardType := wshrpc.ForwardType_Local
+	if connForwardRemote {
+		forwardType = wshrpc.ForwardType_Remote
+	} else if connForwardDynamic {
+		forwardType = wshrpc.ForwardType_Dynamic
+	}
+	return wshrpc.CommandConnForwardData{
+		Connection: connName,
+		Type:       forwardType,
+		Spec:       spec,
+		Save:       connForwardSave,
+	}, nil
+}
+
+func connForwardListRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("conn", rtnErr == nil)
+	}()
+	var connName string
+	if len(args) > 0 {
+		connName = args[0]
+		if err := validateConnectionName(connName); err != nil {
+			return err
+		}
+	}
+	forwards, err := wshclient.ConnListForwardsCommand(RpcClient, connName, nil)
+	if err != nil {
+		return fmt.Errorf("listing forwards: %w", err)
+	}
+	if len(forwards) == 0 {
+		WriteStdout("no port forwards\n")
+		return nil
+	}
+	WriteStdout("%-24s %-7s %-24s %-24s %s\n", "connection", "type", "listen", "target", "conns")
+	WriteStdout("----------------------------------------------------------------------------------------------\n")
+	for _, fwd := range forwards {
+		if fwd.Error != "" {
+			WriteStdout("%-24s %-7s %q failed: %s\n", fwd.Connection, fwd.Type, fwd.Spec, fwd.Error)
+			continue
+		}
+		targetAddr := fwd.TargetAddr
+		if fwd.Type == wshrpc.ForwardType_Dynamic {
+			targetAddr = "(socks5)"
+		}
+		WriteStdout("%-24s %-7s %-24s %-24s %d/%d\n", fwd.Connection, fwd.Type, fwd.ListenAddr, targetAddr, fwd.ActiveConns, fwd.TotalConns)
+	}
+	return nil
+}
+
+func connForwardAddRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("conn", rtnErr == nil)
+	}()
+	data, err := getConnForwardData(args)
+	if err != nil {
+		return err
+	}
+	info, err := wshclient.ConnAddForwardCommand(RpcClient, data, &wshrpc.RpcOpts{Timeout: 10000})
+	if err != nil {
+		return fmt.Errorf("adding forward: %w", err)
+	}
+	if info.Type == wshrpc.ForwardType_Dynamic {
+		WriteStdout("socks5 proxy on %s started on %q\n", info.ListenAddr, data.Connection)
+		return nil
+	}
+	WriteStdout("%s forward %s -> %s started on %q\n", info.Type, info.ListenAddr, info.TargetAddr, data.Connection)
+	return nil
+}
+
+func connForwardRemoveRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("conn", rtnErr == nil)
+	}()
+	data, err := getConnForwardData(args)
+	if err != nil {
+		return err
+	}
+	err = wshclient.ConnRemoveForwardCommand(RpcClient, data, &wshrpc.RpcOpts{Timeout: 5000})
+	if err != nil {
+		return fmt.Errorf("removing forward: %w", err)
+	}
+	WriteStdout("%s forward %q removed from %q\n", data.Type, data.Spec, data.Connection)
+	return nil
+}
+
+func connForwardSocksRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("conn", rtnErr == nil)
+	}()
+	connName := args[0]
+	if err := validateConnectionName(connName); err != nil {
+		return err
+	}
+	proxyUrl, err := wshclient.ConnSocksProxyCommand(RpcClient, connName, &wshrpc.RpcOpts{Timeout: 10000})
+	if err != nil {
+		return fmt.Errorf("getting socks proxy: %w", err)
+	}
+	WriteStdout("%s\n", proxyUrl)
+	return nil
+}
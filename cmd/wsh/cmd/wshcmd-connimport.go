@@ -0,0 +1,103 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+)
+
+var connImportDryRun bool
+var connImportOverwrite bool
+
+var connImportSources = []string{
+	wshrpc.ConnImportSource_Putty,
+	wshrpc.ConnImportSource_Kitty,
+	wshrpc.ConnImportSource_Termius,
+	wshrpc.ConnImportSource_SecureCrt,
+	wshrpc.ConnImportSource_SshConfig,
+}
+
+var connImportCmd = &cobra.Command{
+	Use:   "import putty|kitty|termius|securecrt|sshconfig [PATH]",
+	Short: "import saved sessions of other ssh clients as connections",
+	Long: `Import saved ssh sessions into connections.json, from PuTTY or KiTTY (on Windows from the registry,
+otherwise or with PATH from a session file or a folder of them), a Termius json export, a
+SecureCRT xml export, or an ssh config file (~/.ssh/config by default).  Connections are named
+[user@]host[:port], with their key files and jump hosts.  Settings that are already saved
+differently for a connection are conflicts, which are kept unless --overwrite is given.`,
+	Example:   "  wsh conn import putty -n\n  wsh conn import kitty 'C:\\Tools\\kitty\\Sessions'\n  wsh conn import securecrt ~/Downloads/SecureCRTSettings.xml\n  wsh conn import sshconfig ~/old-laptop/ssh_config",
+	Args:      cobra.RangeArgs(1, 2),
+	ValidArgs: connImportSources,
+	RunE:      connImportRun,
+	PreRunE:   preRunSetupRpcClient,
+}
+
+func init() {
+	connImportCmd.Flags().BoolVarP(&connImportDryRun, "dry-run", "n", false, "only show what would be imported")
+	connImportCmd.Flags().BoolVar(&connImportOverwrite, "overwrite", false, "replace conflicting settings of saved connections")
+	connCmd.AddCommand(connImportCmd)
+}
+
+func connImportRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("conn", rtnErr == nil)
+	}()
+	source := strings.ToLower(args[0])
+	if !slices.Contains(connImportSources, source) {
+		return fmt.Errorf("unknown source %q (use %s)", args[0], strings.Join(connImportSources, ", "))
+	}
+	data := wshrpc.CommandConnImportData{Source: source, DryRun: connImportDryRun, Overwrite: connImportOverwrite}
+	if len(args) > 1 {
+		if RpcContext.Conn != "" {
+			return fmt.Errorf("the sessions are read on the machine running Wave, run this in a local terminal")
+		}
+		path, err := filepath.Abs(args[1])
+		if err != nil {
+			return fmt.Errorf("resolving path: %w", err)
+		}
+		data.Path = path
+	}
+	result, err := wshclient.ConnImportCommand(RpcClient, data, &wshrpc.RpcOpts{Timeout: 30000})
+	if err != nil {
+		return fmt.Errorf("importing sessions: %w", err)
+	}
+	if len(result.Entries) == 0 {
+		WriteStdout("no saved sessions found\n")
+		return nil
+	}
+	counts := make(map[string]int)
+	for _, entry := range result.Entries {
+		counts[entry.Status]++
+		conn := entry.Connection
+		if conn == "" {
+			conn = "-"
+		}
+		WriteStdout("%-10s %-28s %s\n", entry.Status, entry.Session, conn)
+		if entry.Message != "" {
+			WriteStdout("  %s\n", entry.Message)
+		}
+		for _, warning := range entry.Warnings {
+			WriteStdout("  warning: %s\n", warning)
+		}
+	}
+	verb := "imported"
+	if connImportDryRun {
+		verb = "would import"
+	}
+	WriteStdout("%s %d sessions (%d added, %d updated), %d conflicts, %d skipped\n", verb,
+		counts[wshrpc.ConnImportStatus_Added]+counts[wshrpc.ConnImportStatus_Updated],
+		counts[wshrpc.ConnImportStatus_Added], counts[wshrpc.ConnImportStatus_Updated],
+		counts[wshrpc.ConnImportStatus_Conflict], counts[wshrpc.ConnImportStatus_Skipped])
+	if counts[wshrpc.ConnImportStatus_Conflict] > 0 && !connImportOverwrite {
+		WriteStdout("(use --overwrite to replace the conflicting settings)\n")
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+)
+
+var connMountName string
+
+var connMountCmd = &cobra.Command{
+	Use:   "mount CONNECTION [PATH] [-n NAME]",
+	Short: "mount a remote directory (the home directory if no path is given)",
+	Long: `Mount a directory on an ssh connection (connecting it if needed).  Files in the directory can then
+be opened in Wave as mount://NAME/PATH.  Mounts are kept while the connection is down, and are
+re-mounted when it reconnects.`,
+	Args:    cobra.RangeArgs(1, 2),
+	RunE:    connMountRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var connUnmountCmd = &cobra.Command{
+	Use:     "unmount NAME",
+	Short:   "remove a mount",
+	Args:    cobra.ExactArgs(1),
+	RunE:    connUnmountRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var connMountsCmd = &cobra.Command{
+	Use:     "mounts",
+	Short:   "list mounts",
+	Args:    cobra.NoArgs,
+	RunE:    connMountsRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+func init() {
+	connMountCmd.Flags().StringVarP(&connMountName, "name", "n", "", "name of the mount (defaults to the directory's name)")
+	connCmd.AddCommand(connMountCmd)
+	connCmd.AddCommand(connUnmountCmd)
+	connCmd.AddCommand(connMountsCmd)
+}
+
+func connMountRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("conn", rtnErr == nil)
+	}()
+	connName := args[0]
+	if err := validateConnectionName(connName); err != nil {
+		return err
+	}
+	data := wshrpc.CommandConnMountData{Connection: connName, Name: connMountName}
+	if len(args) > 1 {
+		data.RemotePath = args[1]
+	}
+	info, err := wshclient.ConnMountCommand(RpcClient, data, &wshrpc.RpcOpts{Timeout: 60000})
+	if err != nil {
+		return fmt.Errorf("mounting: %w", err)
+	}
+	WriteStdout("mounted %s:%s as %s%s/\n", info.Connection, info.MountPath, wshrpc.MountPathPrefix, info.Name)
+	return nil
+}
+
+func connUnmountRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("conn", rtnErr == nil)
+	}()
+	err := wshclient.ConnUnmountCommand(RpcClient, args[0], &wshrpc.RpcOpts{Timeout: 5000})
+	if err != nil {
+		return fmt.Errorf("unmounting: %w", err)
+	}
+	WriteStdout("unmounted %q\n", args[0])
+	return nil
+}
+
+func connMountsRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("conn", rtnErr == nil)
+	}()
+	mounts, err := wshclient.ConnListMountsCommand(RpcClient, &wshrpc.RpcOpts{Timeout: 5000})
+	if err != nil {
+		return fmt.Errorf("listing mounts: %w", err)
+	}
+	if len(mounts) == 0 {
+		WriteStdout("no mounts\n")
+		return nil
+	}
+	WriteStdout("%-16s %-24s %-13s %s\n", "name", "connection", "status", "path")
+	WriteStdout("----------------------------------------------------------------------------------\n")
+	for _, mount := range mounts {
+		WriteStdout("%-16s %-24s %-13s %s\n", mount.Name, mount.Connection, mount.Status, mount.MountPath)
+		if mount.Error != "" {
+			WriteStdout("  error: %s\n", mount.Error)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+)
+
+var connSyncChecksum bool
+var connSyncDelete bool
+var connSyncExclude []string
+var connSyncDryRun bool
+var connSyncWatch bool
+var connSyncVerbose bool
+
+var connSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "sync directories with an ssh connection",
+	Long: `Sync a directory on this machine with a directory on an ssh connection (wsh does not need to be
+installed on the remote).  Only files that changed (by size and modtime, or by checksum with -c) are
+copied, and each copy is verified.  With --watch, the directories are synced again whenever the
+source changes, until wsh is stopped.`,
+}
+
+var connSyncPushCmd = &cobra.Command{
+	Use:     "push CONNECTION LOCALDIR REMOTEDIR",
+	Short:   "sync a local directory to the remote",
+	Args:    cobra.ExactArgs(3),
+	RunE:    connSyncPushRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var connSyncPullCmd = &cobra.Command{
+	Use:     "pull CONNECTION REMOTEDIR LOCALDIR",
+	Short:   "sync a remote directory to this machine",
+	Args:    cobra.ExactArgs(3),
+	RunE:    connSyncPullRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{connSyncPushCmd, connSyncPullCmd} {
+		cmd.Flags().BoolVarP(&connSyncChecksum, "checksum", "c", false, "compare files by sha256 instead of size and modtime")
+		cmd.Flags().BoolVar(&connSyncDelete, "delete", false, "delete files that aren't in the source")
+		cmd.Flags().StringArrayVarP(&connSyncExclude, "exclude", "x", nil, "skip files matching a glob pattern (can be repeated)")
+		cmd.Flags().BoolVarP(&connSyncDryRun, "dry-run", "n", false, "only show what would change")
+		cmd.Flags().BoolVarP(&connSyncWatch, "watch", "w", false, "keep syncing when the source changes")
+		cmd.Flags().BoolVarP(&connSyncVerbose, "verbose", "v", false, "print each change")
+		connSyncCmd.AddCommand(cmd)
+	}
+	connCmd.AddCommand(connSyncCmd)
+}
+
+func connSyncPushRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("conn", rtnErr == nil)
+	}()
+	return runConnSync(wshrpc.SyncDirection_Push, args[0], args[1], args[2])
+}
+
+func connSyncPullRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("conn", rtnErr == nil)
+	}()
+	return runConnSync(wshrpc.SyncDirection_Pull, args[0], args[2], args[1])
+}
+
+func printSyncChanges(changes []wshrpc.ConnSyncChange) {
+	for _, change := range changes {
+		if change.Action == wshrpc.SyncAction_Copy {
+			WriteStdout("%-6s %s (%d bytes)\n", change.Action, change.Path, change.Size)
+		} else {
+			WriteStdout("%-6s %s\n", change.Action, change.Path)
+		}
+	}
+}
+
+func printSyncSummary(progress wshrpc.ConnSyncProgress, changes []wshrpc.ConnSyncChange) {
+	var numMkdirs, numDeletes int
+	for _, change := range changes {
+		switch change.Action {
+		case wshrpc.SyncAction_Mkdir:
+			numMkdirs++
+		case wshrpc.SyncAction_Delete:
+			numDeletes++
+		}
+	}
+	verb := "copied"
+	if connSyncDryRun {
+		verb = "would copy"
+	}
+	WriteStderr("[%s] %s %d files (%d bytes), %d new directories, %d deleted\n", time.Now().Format("15:04:05"), verb, progress.FilesTotal, progress.BytesTotal, numMkdirs, numDeletes)
+}
+
+func runConnSync(direction string, connName string, localArg string, remotePath string) error {
+	if err := validateConnectionName(connName); err != nil {
+		return err
+	}
+	if RpcContext.Conn != "" {
+		return fmt.Errorf("wsh conn sync syncs with the machine running Wave, run it in a local terminal")
+	}
+	localPath, err := filepath.Abs(localArg)
+	if err != nil {
+		return fmt.Errorf("resolving local path: %w", err)
+	}
+	data := wshrpc.CommandConnSyncData{
+		Connection: connName,
+		Direction:  direction,
+		LocalPath:  localPath,
+		RemotePath: remotePath,
+		Checksum:   connSyncChecksum,
+		Delete:     connSyncDelete,
+		Exclude:    connSyncExclude,
+		DryRun:     connSyncDryRun,
+		Watch:      connSyncWatch,
+	}
+	respCh := wshclient.ConnSyncCommand(RpcClient, data, &wshrpc.RpcOpts{Timeout: connCopyTimeoutMs})
+	var changes []wshrpc.ConnSyncChange
+	var showedProgress bool
+	var gotDone bool
+	for resp := range respCh {
+		if resp.Error != nil {
+			if showedProgress {
+				WriteStderr("\n")
+			}
+			return fmt.Errorf("sync failed: %w", resp.Error)
+		}
+		progress := resp.Response
+		if progress.Changes != nil {
+			changes = progress.Changes
+			if connSyncVerbose || connSyncDryRun {
+				printSyncChanges(changes)
+			}
+			continue
+		}
+		if progress.Done {
+			if showedProgress {
+				WriteStderr("\n")
+				showedProgress = false
+			}
+			if progress.Error != "" {
+				WriteStderr("[%s] sync failed (retrying on the next change): %s\n", time.Now().Format("15:04:05"), progress.Error)
+				continue
+			}
+			gotDone = true
+			printSyncSummary(progress, changes)
+			changes = nil
+			continue
+		}
+		if progress.BytesTotal > 0 {
+			showedProgress = true
+			WriteStderr("\rsyncing... %d of %d files, %d%%", progress.FilesDone, progress.FilesTotal, progress.BytesDone*100/progress.BytesTotal)
+		}
+	}
+	if !gotDone {
+		return fmt.Errorf("sync did not finish")
+	}
+	return nil
+}
@@ -5,8 +5,11 @@ package cmd
 
 import (
 	"encoding/json"
+	"fmt"
+	"sort"
 
 	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
 )
 
@@ -24,8 +27,36 @@ var debugBlockIdsCmd = &cobra.Command{
 	Hidden: true,
 }
 
+var debugLogLevelCmd = &cobra.Command{
+	Use:   "loglevel [package] [level]",
+	Short: "show or set backend log levels",
+	Long: `Show the backend log levels (no args), or set the level for a package.
+Use "default" as the package to set the default level, and "clear" as the
+level to go back to the configured level.`,
+	Example: "  wsh debug loglevel\n  wsh debug loglevel conncontroller debug\n  wsh debug loglevel conncontroller clear",
+	Args:    cobra.MaximumNArgs(2),
+	RunE:    debugLogLevelRun,
+}
+
+var debugStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "show backend stats (rpc rates, connections, filestore, controllers, memory)",
+	Args:  cobra.NoArgs,
+	RunE:  debugStatsRun,
+}
+
+var debugPprofCmd = &cobra.Command{
+	Use:   "pprof",
+	Short: "show the urls of the pprof and runtime diagnostics endpoints (requires debug:pprof)",
+	Args:  cobra.NoArgs,
+	RunE:  debugPprofRun,
+}
+
 func init() {
 	debugCmd.AddCommand(debugBlockIdsCmd)
+	debugCmd.AddCommand(debugLogLevelCmd)
+	debugCmd.AddCommand(debugStatsCmd)
+	debugCmd.AddCommand(debugPprofCmd)
 	rootCmd.AddCommand(debugCmd)
 }
 
@@ -45,3 +76,77 @@ func debugBlockIdsRun(cmd *cobra.Command, args []string) error {
 	WriteStdout("%s\n", string(barr))
 	return nil
 }
+
+func debugLogLevelRun(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		levels, err := wshclient.GetLogLevelsCommand(RpcClient, nil)
+		if err != nil {
+			return fmt.Errorf("getting log levels: %w", err)
+		}
+		var pkgs []string
+		for pkg := range levels {
+			if pkg != "" {
+				pkgs = append(pkgs, pkg)
+			}
+		}
+		sort.Strings(pkgs)
+		WriteStdout("%-20s %s\n", "(default)", levels[""])
+		for _, pkg := range pkgs {
+			WriteStdout("%-20s %s\n", pkg, levels[pkg])
+		}
+		return nil
+	}
+	if len(args) != 2 {
+		OutputHelpMessage(cmd)
+		return fmt.Errorf("requires a package and a level")
+	}
+	data := wshrpc.CommandSetLogLevelData{Package: args[0], Level: args[1]}
+	if data.Package == "default" {
+		data.Package = ""
+	}
+	if data.Level == "clear" {
+		data.Level = ""
+		data.Clear = true
+	}
+	err := wshclient.SetLogLevelCommand(RpcClient, data, nil)
+	if err != nil {
+		return fmt.Errorf("setting log level: %w", err)
+	}
+	return nil
+}
+
+func debugStatsRun(cmd *cobra.Command, args []string) error {
+	stats, err := wshclient.GetWaveStatsCommand(RpcClient, &wshrpc.RpcOpts{Timeout: 5000})
+	if err != nil {
+		return fmt.Errorf("getting stats: %w", err)
+	}
+	var keys []string
+	for key := range stats.Values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		WriteStdout("%-32s %.2f\n", key, stats.Values[key])
+	}
+	return nil
+}
+
+func debugPprofRun(cmd *cobra.Command, args []string) error {
+	info, err := wshclient.DebugPprofInfoCommand(RpcClient, &wshrpc.RpcOpts{Timeout: 2000})
+	if err != nil {
+		return fmt.Errorf("getting pprof info: %w", err)
+	}
+	if !info.Enabled {
+		WriteStderr("pprof endpoints are disabled, enable them with: wsh setconfig debug:pprof=true\n")
+		return nil
+	}
+	if info.Url == "" {
+		return fmt.Errorf("web server address is not available")
+	}
+	WriteStdout("index:     %spprof/?token=%s\n", info.Url, info.Token)
+	WriteStdout("runtime:   %sruntime?token=%s\n", info.Url, info.Token)
+	WriteStdout("heap:      go tool pprof '%spprof/heap?token=%s'\n", info.Url, info.Token)
+	WriteStdout("goroutine: go tool pprof '%spprof/goroutine?token=%s'\n", info.Url, info.Token)
+	WriteStdout("cpu:       go tool pprof '%spprof/profile?seconds=15&token=%s'\n", info.Url, info.Token)
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+)
+
+var diagBundleCmd = &cobra.Command{
+	Use:   "diagbundle",
+	Short: "create a diagnostic bundle (sanitized logs, config, connection timelines) for bug reports",
+	Long: `Create a diagnostic bundle for bug reports.  The bundle contains sanitized logs,
+config (with secrets redacted), connection status timelines, database stats, and
+version info.  The contents are listed for review before anything is written.`,
+	Args:    cobra.NoArgs,
+	RunE:    diagBundleRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var diagBundleOutput string
+var diagBundleYes bool
+var diagBundleShow string
+
+func init() {
+	diagBundleCmd.Flags().StringVarP(&diagBundleOutput, "output", "o", "", "path of the zip file to write (defaults to a file in the temp dir)")
+	diagBundleCmd.Flags().BoolVarP(&diagBundleYes, "yes", "y", false, "write the bundle without asking for confirmation")
+	diagBundleCmd.Flags().StringVar(&diagBundleShow, "show", "", "print the contents of one bundle item (nothing is written)")
+	rootCmd.AddCommand(diagBundleCmd)
+}
+
+func diagBundleRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("diagbundle", rtnErr == nil)
+	}()
+	info, err := wshclient.PrepareDiagBundleCommand(RpcClient, &wshrpc.RpcOpts{Timeout: 30000})
+	if err != nil {
+		return fmt.Errorf("preparing diagnostic bundle: %w", err)
+	}
+	if diagBundleShow != "" {
+		content, err := wshclient.GetDiagBundleItemCommand(RpcClient, wshrpc.CommandDiagBundleItemData{BundleId: info.BundleId, Name: diagBundleShow}, &wshrpc.RpcOpts{Timeout: 5000})
+		if err != nil {
+			return err
+		}
+		WriteStdout("%s", content)
+		if !strings.HasSuffix(content, "\n") {
+			WriteStdout("\n")
+		}
+		return nil
+	}
+	WriteStdout("the diagnostic bundle will contain:\n")
+	for _, item := range info.Items {
+		redactStr := ""
+		if item.Redactions > 0 {
+			redactStr = fmt.Sprintf(", %d redacted", item.Redactions)
+		}
+		WriteStdout("  %-28s %8s  %s%s\n", item.Name, formatBundleSize(item.Size), item.Description, redactStr)
+	}
+	WriteStdout("(use --show <name> to review an item)\n")
+	outputPath := diagBundleOutput
+	if outputPath != "" && !strings.HasPrefix(outputPath, "~") {
+		outputPath, err = filepath.Abs(outputPath)
+		if err != nil {
+			return fmt.Errorf("resolving output path: %w", err)
+		}
+	}
+	if !diagBundleYes {
+		destStr := outputPath
+		if destStr == "" {
+			destStr = "the temp dir"
+		}
+		WriteStderr("write diagnostic bundle to %s? [y/N] ", destStr)
+		answer, _ := bufio.NewReader(WrappedStdin).ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "y" && answer != "yes" {
+			WriteStderr("diagnostic bundle not written\n")
+			return nil
+		}
+	}
+	path, err := wshclient.WriteDiagBundleCommand(RpcClient, wshrpc.CommandWriteDiagBundleData{BundleId: info.BundleId, Path: outputPath}, &wshrpc.RpcOpts{Timeout: 30000})
+	if err != nil {
+		return err
+	}
+	WriteStdout("%s\n", path)
+	return nil
+}
+
+func formatBundleSize(size int64) string {
+	if size < 1024 {
+		return fmt.Sprintf("%dB", size)
+	}
+	if size < 1024*1024 {
+		return fmt.Sprintf("%.1fK", float64(size)/1024)
+	}
+	return fmt.Sprintf("%.1fM", float64(size)/(1024*1024))
+}
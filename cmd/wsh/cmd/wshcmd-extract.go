@@ -0,0 +1,68 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshremote"
+)
+
+var extractCmd = &cobra.Command{
+	Use:   "extract ARCHIVE [DESTDIR]",
+	Short: "extract a zip, tar, or tar.gz archive",
+	Long: `Extract a zip, tar, or tar.gz archive.  By default the archive is extracted to a
+directory next to it, named after the archive (without the extension).  Entries that would
+be written outside of the destination directory are skipped.  Archives can also be browsed
+without extracting them by opening them in a preview block (wsh view ARCHIVE).`,
+	Args:    cobra.RangeArgs(1, 2),
+	RunE:    extractRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var extractOverwrite bool
+
+func init() {
+	extractCmd.Flags().BoolVar(&extractOverwrite, "overwrite", false, "replace existing files")
+	rootCmd.AddCommand(extractCmd)
+}
+
+func extractRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("extract", rtnErr == nil)
+	}()
+	archivePath, err := filepath.Abs(args[0])
+	if err != nil {
+		return fmt.Errorf("resolving archive path: %w", err)
+	}
+	var destDir string
+	if len(args) > 1 {
+		destDir, err = filepath.Abs(args[1])
+		if err != nil {
+			return fmt.Errorf("resolving destination path: %w", err)
+		}
+	}
+	var lastProgress wshrpc.ArchiveExtractProgress
+	var showedProgress bool
+	err = wshremote.ExtractArchive(context.Background(), archivePath, destDir, extractOverwrite, func(progress wshrpc.ArchiveExtractProgress) {
+		lastProgress = progress
+		if progress.Done || progress.TotalBytes <= 0 {
+			return
+		}
+		showedProgress = true
+		WriteStderr("\rextracting... %d%% (%d files)", progress.ReadBytes*100/progress.TotalBytes, progress.Files)
+	})
+	if showedProgress {
+		WriteStderr("\n")
+	}
+	if err != nil {
+		return err
+	}
+	WriteStderr("extracted %d files (%d bytes) to %s\n", lastProgress.Files, lastProgress.Bytes, lastProgress.DestPath)
+	return nil
+}
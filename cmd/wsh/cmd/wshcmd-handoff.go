@@ -0,0 +1,114 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+)
+
+var handoffWorkspaceId string
+var handoffOutput string
+var handoffOpen bool
+
+var handoffCmd = &cobra.Command{
+	Use:   "handoff",
+	Short: "move a workspace to another Wave instance",
+	Long:  "Export a workspace (tabs, layout, connections, and directories) on one machine and import it into Wave on another",
+}
+
+var handoffExportCmd = &cobra.Command{
+	Use:     "export [-w workspaceid] [-o file]",
+	Short:   "export a workspace (default is the current one)",
+	Args:    cobra.NoArgs,
+	RunE:    handoffExportRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var handoffImportCmd = &cobra.Command{
+	Use:     "import [file]",
+	Short:   "import an exported workspace (reads stdin when no file is given)",
+	Args:    cobra.MaximumNArgs(1),
+	RunE:    handoffImportRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+func init() {
+	handoffExportCmd.Flags().StringVarP(&handoffWorkspaceId, "workspace", "w", "", "workspace id to export")
+	handoffExportCmd.Flags().StringVarP(&handoffOutput, "output", "o", "", "file to write (default is stdout)")
+	handoffImportCmd.Flags().BoolVar(&handoffOpen, "open", true, "open the workspace in a new window")
+	handoffCmd.AddCommand(handoffExportCmd)
+	handoffCmd.AddCommand(handoffImportCmd)
+	rootCmd.AddCommand(handoffCmd)
+}
+
+func handoffExportRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("handoff", rtnErr == nil)
+	}()
+	workspaceId := handoffWorkspaceId
+	if workspaceId == "" {
+		if RpcContext.BlockId == "" {
+			return fmt.Errorf("not running in a Wave block, use -w to pick a workspace")
+		}
+		blockInfo, err := wshclient.BlockInfoCommand(RpcClient, RpcContext.BlockId, nil)
+		if err != nil {
+			return fmt.Errorf("getting block info: %w", err)
+		}
+		workspaceId = blockInfo.WorkspaceId
+	}
+	handoff, err := wshclient.WorkspaceHandoffExportCommand(RpcClient, workspaceId, &wshrpc.RpcOpts{Timeout: 5000})
+	if err != nil {
+		return fmt.Errorf("exporting workspace: %w", err)
+	}
+	barr, err := json.MarshalIndent(handoff, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding workspace: %w", err)
+	}
+	barr = append(barr, '\n')
+	if handoffOutput == "" || handoffOutput == "-" {
+		WriteStdout("%s", barr)
+		return nil
+	}
+	err = os.WriteFile(handoffOutput, barr, 0600)
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", handoffOutput, err)
+	}
+	WriteStdout("exported workspace %q (%d tabs) to %s\n", handoff.Name, len(handoff.Tabs), handoffOutput)
+	return nil
+}
+
+func handoffImportRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("handoff", rtnErr == nil)
+	}()
+	var barr []byte
+	var err error
+	if len(args) == 0 || args[0] == "-" {
+		barr, err = io.ReadAll(os.Stdin)
+	} else {
+		barr, err = os.ReadFile(args[0])
+	}
+	if err != nil {
+		return fmt.Errorf("reading workspace: %w", err)
+	}
+	var handoff wshrpc.WorkspaceHandoffData
+	err = json.Unmarshal(barr, &handoff)
+	if err != nil {
+		return fmt.Errorf("invalid workspace file: %w", err)
+	}
+	data := wshrpc.CommandWorkspaceHandoffImportData{Handoff: &handoff, Open: handoffOpen}
+	workspaceId, err := wshclient.WorkspaceHandoffImportCommand(RpcClient, data, &wshrpc.RpcOpts{Timeout: 10000})
+	if err != nil {
+		return fmt.Errorf("importing workspace: %w", err)
+	}
+	WriteStdout("imported workspace %q as %s\n", handoff.Name, workspaceId)
+	return nil
+}
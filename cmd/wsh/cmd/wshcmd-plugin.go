@@ -0,0 +1,172 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+var pluginCallTimeout int
+
+var pluginCmd = &cobra.Command{
+	Use:   "plugin",
+	Short: "manage Wave Terminal plugins",
+	Long:  "Commands to manage plugins (sidecar processes in the plugins directory of the Wave config dir)",
+}
+
+var pluginListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "list plugins and their status",
+	Args:    cobra.NoArgs,
+	RunE:    pluginListRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var pluginStartCmd = &cobra.Command{
+	Use:     "start PLUGIN",
+	Short:   "start a plugin",
+	Args:    cobra.ExactArgs(1),
+	RunE:    makePluginControlRun(wshrpc.PluginAction_Start),
+	PreRunE: preRunSetupRpcClient,
+}
+
+var pluginStopCmd = &cobra.Command{
+	Use:     "stop PLUGIN",
+	Short:   "stop a plugin",
+	Args:    cobra.ExactArgs(1),
+	RunE:    makePluginControlRun(wshrpc.PluginAction_Stop),
+	PreRunE: preRunSetupRpcClient,
+}
+
+var pluginRestartCmd = &cobra.Command{
+	Use:     "restart PLUGIN",
+	Short:   "restart a plugin",
+	Args:    cobra.ExactArgs(1),
+	RunE:    makePluginControlRun(wshrpc.PluginAction_Restart),
+	PreRunE: preRunSetupRpcClient,
+}
+
+var pluginReloadCmd = &cobra.Command{
+	Use:     "reload",
+	Short:   "re-read the plugin manifests",
+	Args:    cobra.NoArgs,
+	RunE:    makePluginControlRun(wshrpc.PluginAction_Reload),
+	PreRunE: preRunSetupRpcClient,
+}
+
+var pluginCallCmd = &cobra.Command{
+	Use:     "call PLUGIN COMMAND [JSON]",
+	Short:   "call an rpc command a plugin handles",
+	Args:    cobra.RangeArgs(2, 3),
+	RunE:    pluginCallRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var pluginViewCmd = &cobra.Command{
+	Use:     "view PLUGIN VIEW",
+	Short:   "open a plugin view in a new block",
+	Args:    cobra.ExactArgs(2),
+	RunE:    pluginViewRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+func init() {
+	pluginCallCmd.Flags().IntVarP(&pluginCallTimeout, "timeout", "t", 10000, "timeout in milliseconds")
+	pluginCmd.AddCommand(pluginListCmd)
+	pluginCmd.AddCommand(pluginStartCmd)
+	pluginCmd.AddCommand(pluginStopCmd)
+	pluginCmd.AddCommand(pluginRestartCmd)
+	pluginCmd.AddCommand(pluginReloadCmd)
+	pluginCmd.AddCommand(pluginCallCmd)
+	pluginCmd.AddCommand(pluginViewCmd)
+	rootCmd.AddCommand(pluginCmd)
+}
+
+func pluginListRun(cmd *cobra.Command, args []string) error {
+	plugins, err := wshclient.PluginListCommand(RpcClient, nil)
+	if err != nil {
+		return fmt.Errorf("listing plugins: %w", err)
+	}
+	if len(plugins) == 0 {
+		WriteStdout("no plugins\n")
+		return nil
+	}
+	WriteStdout("%-20s %-10s %-10s %s\n", "plugin", "version", "status", "views")
+	WriteStdout("----------------------------------------------------------\n")
+	for _, info := range plugins {
+		var views []string
+		for _, view := range info.Manifest.Views {
+			views = append(views, view.Name)
+		}
+		str := fmt.Sprintf("%-20s %-10s %-10s %s", info.Manifest.Name, info.Manifest.Version, info.Status, strings.Join(views, ","))
+		if info.LastError != "" {
+			str += fmt.Sprintf(" (%s)", info.LastError)
+		}
+		WriteStdout("%s\n", str)
+	}
+	return nil
+}
+
+func makePluginControlRun(action string) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		data := wshrpc.CommandPluginControlData{Action: action}
+		if len(args) > 0 {
+			data.Name = args[0]
+		}
+		err := wshclient.PluginControlCommand(RpcClient, data, &wshrpc.RpcOpts{Timeout: 10000})
+		if err != nil {
+			return fmt.Errorf("plugin %s: %w", action, err)
+		}
+		return nil
+	}
+}
+
+func pluginCallRun(cmd *cobra.Command, args []string) error {
+	var data any
+	if len(args) > 2 {
+		if err := json.Unmarshal([]byte(args[2]), &data); err != nil {
+			return fmt.Errorf("invalid json data: %w", err)
+		}
+	}
+	opts := &wshrpc.RpcOpts{Route: wshutil.MakePluginRouteId(args[0]), Timeout: pluginCallTimeout}
+	rtn, err := RpcClient.SendRpcRequest(args[1], data, opts)
+	if err != nil {
+		return err
+	}
+	if rtn == nil {
+		return nil
+	}
+	barr, err := json.MarshalIndent(rtn, "", "  ")
+	if err != nil {
+		return err
+	}
+	WriteStdout("%s\n", barr)
+	return nil
+}
+
+func pluginViewRun(cmd *cobra.Command, args []string) error {
+	data := wshrpc.CommandCreateBlockData{
+		BlockDef: &waveobj.BlockDef{
+			Meta: waveobj.MetaMapType{
+				waveobj.MetaKey_View:       "vdom",
+				waveobj.MetaKey_VDomRoute:  wshutil.MakePluginRouteId(args[0]),
+				waveobj.MetaKey_PluginView: args[1],
+			},
+		},
+	}
+	oref, err := wshclient.CreateBlockCommand(RpcClient, data, nil)
+	if err != nil {
+		return fmt.Errorf("create block failed: %v", err)
+	}
+	WriteStdout("created block %s\n", oref.OID)
+	return nil
+}
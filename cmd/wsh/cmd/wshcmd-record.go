@@ -0,0 +1,229 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+)
+
+const recordingReadChunkSize = 1024 * 1024
+const recordingFilePrefix = "recording:" // the block file prefix (blockcontroller.BlockFile_RecordingPrefix)
+
+var recordStartTitle string
+var recordStartInput bool
+var recordExportOutput string
+
+var recordCmd = &cobra.Command{
+	Use:   "record",
+	Short: "record terminal sessions as asciicast files",
+	Long: `Record the output of a terminal block (use -b to pick the block, by default the current one) as an
+asciicast v2 file, which can be played back with asciinema.  Recordings are kept with the block
+until it is closed.  Input is only recorded with --input, since it can contain passwords.`,
+}
+
+var recordStartCmd = &cobra.Command{
+	Use:     "start",
+	Short:   "start recording a terminal block",
+	Args:    cobra.NoArgs,
+	RunE:    recordStartRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var recordStopCmd = &cobra.Command{
+	Use:     "stop",
+	Short:   "stop recording a terminal block",
+	Args:    cobra.NoArgs,
+	RunE:    recordStopRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var recordListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "list the recordings of a terminal block",
+	Args:    cobra.NoArgs,
+	RunE:    recordListRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var recordExportCmd = &cobra.Command{
+	Use:     "export [RECORDING]",
+	Short:   "export a recording (the latest one by default)",
+	Example: "  wsh record export -o session.cast\n  wsh record export 20240101-120000.cast -o - | asciinema play -",
+	Args:    cobra.MaximumNArgs(1),
+	RunE:    recordExportRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+func init() {
+	recordStartCmd.Flags().StringVarP(&recordStartTitle, "title", "t", "", "title of the recording")
+	recordStartCmd.Flags().BoolVar(&recordStartInput, "input", false, "also record input typed into the terminal")
+	recordExportCmd.Flags().StringVarP(&recordExportOutput, "output", "o", "", "file to write (\"-\" for stdout, defaults to the recording's name)")
+	recordCmd.AddCommand(recordStartCmd)
+	recordCmd.AddCommand(recordStopCmd)
+	recordCmd.AddCommand(recordListCmd)
+	recordCmd.AddCommand(recordExportCmd)
+	rootCmd.AddCommand(recordCmd)
+}
+
+func formatRecordingDuration(info wshrpc.RecordingInfo) string {
+	endTs := info.EndTs
+	if info.Active || endTs == 0 {
+		endTs = time.Now().UnixMilli()
+	}
+	return (time.Duration(endTs-info.StartTs) * time.Millisecond).Round(time.Second).String()
+}
+
+func recordStartRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("record", rtnErr == nil)
+	}()
+	fullORef, err := resolveBlockArg()
+	if err != nil {
+		return err
+	}
+	data := wshrpc.CommandRecordingStartData{BlockId: fullORef.OID, Title: recordStartTitle, RecordInput: recordStartInput}
+	info, err := wshclient.RecordingStartCommand(RpcClient, data, &wshrpc.RpcOpts{Timeout: 5000})
+	if err != nil {
+		return fmt.Errorf("starting recording: %w", err)
+	}
+	WriteStdout("recording to %s (stop with \"wsh record stop\")\n", strings.TrimPrefix(info.FileName, recordingFilePrefix))
+	return nil
+}
+
+func recordStopRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("record", rtnErr == nil)
+	}()
+	fullORef, err := resolveBlockArg()
+	if err != nil {
+		return err
+	}
+	info, err := wshclient.RecordingStopCommand(RpcClient, fullORef.OID, &wshrpc.RpcOpts{Timeout: 5000})
+	if err != nil {
+		return fmt.Errorf("stopping recording: %w", err)
+	}
+	WriteStdout("stopped recording %s (%s, %s)\n", strings.TrimPrefix(info.FileName, recordingFilePrefix), formatRecordingDuration(*info), formatBundleSize(info.Size))
+	return nil
+}
+
+func recordListRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("record", rtnErr == nil)
+	}()
+	fullORef, err := resolveBlockArg()
+	if err != nil {
+		return err
+	}
+	recordings, err := wshclient.RecordingListCommand(RpcClient, fullORef.OID, &wshrpc.RpcOpts{Timeout: 5000})
+	if err != nil {
+		return fmt.Errorf("listing recordings: %w", err)
+	}
+	if len(recordings) == 0 {
+		WriteStdout("no recordings\n")
+		return nil
+	}
+	WriteStdout("%-22s %-9s %8s  %s\n", "recording", "duration", "size", "title")
+	for _, info := range recordings {
+		title := info.Title
+		if info.Active {
+			title += " [recording]"
+		}
+		WriteStdout("%-22s %-9s %8s  %s\n", strings.TrimPrefix(info.FileName, recordingFilePrefix), formatRecordingDuration(info), formatBundleSize(info.Size), title)
+	}
+	return nil
+}
+
+// reads the recording through the file rpc (in chunks), so it can be written where wsh runs
+func copyRecording(blockId string, fileName string, output io.Writer) error {
+	var offset int64
+	for {
+		data := wshrpc.CommandFileData{ZoneId: blockId, FileName: fileName, At: &wshrpc.CommandFileDataAt{Offset: offset, Size: recordingReadChunkSize}}
+		resp64, err := wshclient.FileReadCommand(RpcClient, data, &wshrpc.RpcOpts{Timeout: 10000})
+		if err != nil {
+			return fmt.Errorf("reading recording: %w", err)
+		}
+		chunk, err := base64.StdEncoding.DecodeString(resp64)
+		if err != nil {
+			return fmt.Errorf("decoding recording: %w", err)
+		}
+		if _, err := output.Write(chunk); err != nil {
+			return err
+		}
+		offset += int64(len(chunk))
+		if len(chunk) < recordingReadChunkSize {
+			return nil
+		}
+	}
+}
+
+func recordExportRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("record", rtnErr == nil)
+	}()
+	fullORef, err := resolveBlockArg()
+	if err != nil {
+		return err
+	}
+	blockId := fullORef.OID
+	var fileName string
+	if len(args) > 0 {
+		fileName = args[0]
+	} else {
+		recordings, err := wshclient.RecordingListCommand(RpcClient, blockId, &wshrpc.RpcOpts{Timeout: 5000})
+		if err != nil {
+			return fmt.Errorf("listing recordings: %w", err)
+		}
+		if len(recordings) == 0 {
+			return fmt.Errorf("this block has no recordings")
+		}
+		fileName = recordings[len(recordings)-1].FileName
+	}
+	if !strings.HasPrefix(fileName, recordingFilePrefix) {
+		fileName = recordingFilePrefix + fileName
+	}
+	if recordExportOutput == "-" {
+		return copyRecording(blockId, fileName, WrappedStdout)
+	}
+	outputPath := recordExportOutput
+	if outputPath == "" {
+		outputPath = strings.TrimPrefix(fileName, recordingFilePrefix)
+	}
+	outputPath, err = filepath.Abs(outputPath)
+	if err != nil {
+		return fmt.Errorf("resolving output path: %w", err)
+	}
+	if RpcContext.Conn == "" {
+		// wave writes the file itself when wsh runs on the same machine
+		path, err := wshclient.RecordingExportCommand(RpcClient, wshrpc.CommandRecordingExportData{BlockId: blockId, FileName: fileName, Path: outputPath}, &wshrpc.RpcOpts{Timeout: 30000})
+		if err != nil {
+			return fmt.Errorf("exporting recording: %w", err)
+		}
+		WriteStdout("exported recording to %s\n", path)
+		return nil
+	}
+	outFile, err := os.OpenFile(outputPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	err = copyRecording(blockId, fileName, outFile)
+	if closeErr := outFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(outputPath)
+		return err
+	}
+	WriteStdout("exported recording to %s\n", outputPath)
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/telemetry"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+)
+
+var telemetryCmd = &cobra.Command{
+	Use:               "telemetry",
+	Short:             "show telemetry categories and preview telemetry payloads",
+	PersistentPreRunE: preRunSetupRpcClient,
+}
+
+var telemetryStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "show which telemetry categories are enabled",
+	Args:  cobra.NoArgs,
+	RunE:  telemetryStatusRun,
+}
+
+var telemetryPreviewCmd = &cobra.Command{
+	Use:   "preview",
+	Short: "print the exact telemetry payload that would be sent next (nothing is sent)",
+	Args:  cobra.NoArgs,
+	RunE:  telemetryPreviewRun,
+}
+
+func init() {
+	telemetryCmd.AddCommand(telemetryStatusCmd)
+	telemetryCmd.AddCommand(telemetryPreviewCmd)
+	rootCmd.AddCommand(telemetryCmd)
+}
+
+func telemetryStatusRun(cmd *cobra.Command, args []string) error {
+	preview, err := wshclient.TelemetryPreviewCommand(RpcClient, &wshrpc.RpcOpts{Timeout: 5000})
+	if err != nil {
+		return fmt.Errorf("getting telemetry status: %w", err)
+	}
+	for _, category := range telemetry.AllCategories {
+		status := "off"
+		if preview.Categories[category] {
+			status = "on"
+		}
+		WriteStdout("%-12s %s  (telemetry:%s)\n", category, status, category)
+	}
+	return nil
+}
+
+func telemetryPreviewRun(cmd *cobra.Command, args []string) error {
+	preview, err := wshclient.TelemetryPreviewCommand(RpcClient, &wshrpc.RpcOpts{Timeout: 5000})
+	if err != nil {
+		return fmt.Errorf("getting telemetry preview: %w", err)
+	}
+	if preview.Payload == nil {
+		WriteStderr("nothing would be sent (telemetry is disabled or there is no unsent activity)\n")
+		return nil
+	}
+	barr, err := json.MarshalIndent(preview.Payload, "", "  ")
+	if err != nil {
+		return fmt.Errorf("formatting payload: %w", err)
+	}
+	WriteStderr("POST %s\n", preview.Url)
+	WriteStdout("%s\n", string(barr))
+	return nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+var updaterInstallNow bool
+
+var updaterCmd = &cobra.Command{
+	Use:   "updater",
+	Short: "check for and install Wave updates",
+}
+
+var updaterStatusCmd = &cobra.Command{
+	Use:     "status",
+	Short:   "show the update status",
+	Args:    cobra.NoArgs,
+	RunE:    updaterStatusRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var updaterCheckCmd = &cobra.Command{
+	Use:     "check",
+	Short:   "check for updates now",
+	Args:    cobra.NoArgs,
+	RunE:    updaterCheckRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var updaterInstallCmd = &cobra.Command{
+	Use:     "install [--now]",
+	Short:   "restart and install a downloaded update (waits for running commands to finish)",
+	Args:    cobra.NoArgs,
+	RunE:    updaterInstallRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+func init() {
+	updaterInstallCmd.Flags().BoolVar(&updaterInstallNow, "now", false, "install now, even if commands are still running")
+	updaterCmd.AddCommand(updaterStatusCmd)
+	updaterCmd.AddCommand(updaterCheckCmd)
+	updaterCmd.AddCommand(updaterInstallCmd)
+	rootCmd.AddCommand(updaterCmd)
+}
+
+func printUpdaterStatus(status *wshrpc.UpdaterStatusData) {
+	WriteStdout("status:   %s\n", status.Status)
+	WriteStdout("channel:  %s\n", status.Channel)
+	WriteStdout("version:  %s\n", status.CurrentVersion)
+	if status.Version != "" && status.Version != status.CurrentVersion {
+		WriteStdout("update:   %s\n", status.Version)
+	}
+	if status.Status == "downloading" {
+		WriteStdout("progress: %.0f%% (%d bytes)\n", status.Progress, status.DownloadBytes)
+	}
+	if status.InstallPending {
+		WriteStdout("install:  waiting for %d block(s) to finish running commands\n", status.BusyBlocks)
+	}
+	if status.Error != "" {
+		WriteStdout("error:    %s\n", status.Error)
+	}
+	if status.LastCheckTs > 0 {
+		WriteStdout("checked:  %s\n", time.UnixMilli(status.LastCheckTs).Format("2006-01-02 15:04"))
+	}
+}
+
+func updaterStatusRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("updater", rtnErr == nil)
+	}()
+	status, err := wshclient.UpdaterStatusCommand(RpcClient, &wshrpc.RpcOpts{Timeout: 2000, Route: wshutil.ElectronRoute})
+	if err != nil {
+		return fmt.Errorf("getting update status: %w", err)
+	}
+	printUpdaterStatus(status)
+	return nil
+}
+
+func updaterCheckRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("updater", rtnErr == nil)
+	}()
+	err := wshclient.UpdaterCheckCommand(RpcClient, &wshrpc.RpcOpts{Timeout: 30000, Route: wshutil.ElectronRoute})
+	if err != nil {
+		return fmt.Errorf("checking for updates: %w", err)
+	}
+	status, err := wshclient.UpdaterStatusCommand(RpcClient, &wshrpc.RpcOpts{Timeout: 2000, Route: wshutil.ElectronRoute})
+	if err != nil {
+		return fmt.Errorf("getting update status: %w", err)
+	}
+	printUpdaterStatus(status)
+	return nil
+}
+
+func updaterInstallRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("updater", rtnErr == nil)
+	}()
+	data := wshrpc.CommandUpdaterInstallData{Force: updaterInstallNow}
+	err := wshclient.UpdaterInstallCommand(RpcClient, data, &wshrpc.RpcOpts{Timeout: 5000, Route: wshutil.ElectronRoute})
+	if err != nil {
+		return fmt.Errorf("installing update: %w", err)
+	}
+	status, err := wshclient.UpdaterStatusCommand(RpcClient, &wshrpc.RpcOpts{Timeout: 2000, Route: wshutil.ElectronRoute})
+	if err == nil && status.InstallPending {
+		WriteStdout("update will be installed when %d block(s) finish running commands\n", status.BusyBlocks)
+	}
+	return nil
+}
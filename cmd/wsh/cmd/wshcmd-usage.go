@@ -0,0 +1,92 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+)
+
+var usageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "show your local usage stats (nothing is sent anywhere)",
+	Long: `Show usage stats that Wave keeps locally: active time, time per workspace,
+commands run per connection, and the most used blocks.  These stats never leave
+your machine and are separate from telemetry.`,
+	Args:    cobra.NoArgs,
+	RunE:    usageRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var usageDays int
+var usageJson bool
+var usageClear bool
+
+func init() {
+	usageCmd.Flags().IntVar(&usageDays, "days", 365, "number of days to include")
+	usageCmd.Flags().BoolVar(&usageJson, "json", false, "output the stats as json")
+	usageCmd.Flags().BoolVar(&usageClear, "clear", false, "delete all local usage stats")
+	rootCmd.AddCommand(usageCmd)
+}
+
+func formatUsageMinutes(minutes int64) string {
+	if minutes < 60 {
+		return fmt.Sprintf("%dm", minutes)
+	}
+	return fmt.Sprintf("%dh %dm", minutes/60, minutes%60)
+}
+
+func writeUsageEntries(title string, entries []wshrpc.UsageStatEntry, isMinutes bool) {
+	if len(entries) == 0 {
+		return
+	}
+	WriteStdout("\n%s\n", title)
+	for idx, entry := range entries {
+		valStr := fmt.Sprintf("%d", entry.Value)
+		if isMinutes {
+			valStr = formatUsageMinutes(entry.Value)
+		}
+		WriteStdout("  %2d. %-36s %s\n", idx+1, entry.Name, valStr)
+	}
+}
+
+func usageRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("usage", rtnErr == nil)
+	}()
+	if usageClear {
+		_, err := wshclient.UsageStatsCommand(RpcClient, wshrpc.CommandUsageStatsData{Clear: true}, nil)
+		if err != nil {
+			return fmt.Errorf("clearing usage stats: %w", err)
+		}
+		WriteStdout("local usage stats cleared\n")
+		return nil
+	}
+	stats, err := wshclient.UsageStatsCommand(RpcClient, wshrpc.CommandUsageStatsData{Days: usageDays}, &wshrpc.RpcOpts{Timeout: 10000})
+	if err != nil {
+		return fmt.Errorf("getting usage stats: %w", err)
+	}
+	if usageJson {
+		barr, err := json.MarshalIndent(stats, "", "  ")
+		if err != nil {
+			return fmt.Errorf("formatting stats: %w", err)
+		}
+		WriteStdout("%s\n", string(barr))
+		return nil
+	}
+	WriteStdout("your wave usage since %s\n\n", stats.SinceDay)
+	WriteStdout("  active time     %s over %d day(s)\n", formatUsageMinutes(stats.ActiveMinutes), stats.DaysActive)
+	if stats.BusiestDay != "" {
+		WriteStdout("  busiest day     %s (%s)\n", stats.BusiestDay, formatUsageMinutes(stats.BusiestDayMinutes))
+	}
+	writeUsageEntries("time per workspace", stats.Workspaces, true)
+	writeUsageEntries("commands per connection", stats.Connections, false)
+	writeUsageEntries("sessions per connection", stats.ConnSessions, false)
+	writeUsageEntries("most used blocks", stats.Blocks, false)
+	return nil
+}
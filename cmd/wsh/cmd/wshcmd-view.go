@@ -64,6 +64,20 @@ func viewRun(cmd *cobra.Command, args []string) (rtnErr error) {
 			},
 			Magnified: viewMagnified,
 		}
+	} else if strings.HasPrefix(fileArg, wshrpc.MountPathPrefix) {
+		// mounts are resolved by wave (they aren't on this connection)
+		wshCmd = &wshrpc.CommandCreateBlockData{
+			BlockDef: &waveobj.BlockDef{
+				Meta: map[string]interface{}{
+					waveobj.MetaKey_View: "preview",
+					waveobj.MetaKey_File: fileArg,
+				},
+			},
+			Magnified: viewMagnified,
+		}
+		if cmdName == "edit" {
+			wshCmd.BlockDef.Meta[waveobj.MetaKey_Edit] = true
+		}
 	} else {
 		absFile, err := filepath.Abs(fileArg)
 		if err != nil {
@@ -0,0 +1 @@
+DROP TABLE db_audit;
\ No newline at end of file
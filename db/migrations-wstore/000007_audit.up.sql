@@ -0,0 +1,9 @@
+CREATE TABLE db_audit (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    ts bigint NOT NULL,
+    eventtype varchar(50) NOT NULL,
+    connection varchar(300) NOT NULL DEFAULT '',
+    source varchar(100) NOT NULL DEFAULT '',
+    details text NOT NULL DEFAULT ''
+);
+CREATE INDEX db_audit_ts ON db_audit (ts);
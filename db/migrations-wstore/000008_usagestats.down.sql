@@ -0,0 +1 @@
+DROP TABLE db_usagestats;
\ No newline at end of file
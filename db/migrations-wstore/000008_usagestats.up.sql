@@ -0,0 +1,7 @@
+CREATE TABLE db_usagestats (
+    day varchar(20) NOT NULL,
+    stattype varchar(50) NOT NULL,
+    statkey varchar(300) NOT NULL,
+    value bigint NOT NULL,
+    PRIMARY KEY (day, stattype, statkey)
+);
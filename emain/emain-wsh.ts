@@ -2,8 +2,8 @@
 // SPDX-License-Identifier: Apache-2.0
 
 import { FileService, WindowService } from "@/app/store/services";
-import { Notification } from "electron";
-import { getResolvedUpdateChannel } from "emain/updater";
+import { app, clipboard, Notification } from "electron";
+import { getResolvedUpdateChannel, updater } from "emain/updater";
 import { RpcResponseHelper, WshClient } from "../frontend/app/store/wshclient";
 import { getWebContentsByBlockId, webGetSelector } from "./emain-web";
 import { createBrowserWindow, getWaveWindowById, getWaveWindowByWorkspaceId } from "./emain-window";
@@ -38,10 +38,40 @@ export class ElectronWshClientType extends WshClient {
         }).show();
     }
 
+    async handle_sysclipboardread(rh: RpcResponseHelper): Promise<string> {
+        return clipboard.readText();
+    }
+
+    async handle_sysclipboardwrite(rh: RpcResponseHelper, data: CommandClipboardData) {
+        clipboard.writeText(data.text);
+    }
+
     async handle_getupdatechannel(rh: RpcResponseHelper): Promise<string> {
         return getResolvedUpdateChannel();
     }
 
+    async handle_updaterstatus(rh: RpcResponseHelper): Promise<UpdaterStatusData> {
+        if (updater == null) {
+            // dev builds don't run the updater
+            return { status: "disabled", channel: getResolvedUpdateChannel(), currentversion: app.getVersion() };
+        }
+        return updater.getStatusData();
+    }
+
+    async handle_updatercheck(rh: RpcResponseHelper) {
+        if (updater == null) {
+            throw new Error("the updater is not running");
+        }
+        await updater.checkForUpdates(true, true);
+    }
+
+    async handle_updaterinstall(rh: RpcResponseHelper, data: CommandUpdaterInstallData) {
+        if (updater == null || updater.status != "ready") {
+            throw new Error("no update is ready to install");
+        }
+        await updater.installUpdate(data?.force ?? false);
+    }
+
     async handle_focuswindow(rh: RpcResponseHelper, windowId: string) {
         console.log(`focuswindow ${windowId}`);
         const fullConfig = await FileService.GetFullConfig();
@@ -456,6 +456,9 @@ function logActiveState() {
         const activity: ActivityUpdate = { openminutes: 1 };
         if (astate.wasInFg) {
             activity.fgminutes = 1;
+            if (focusedWaveWindow?.workspaceId) {
+                activity.workspaceid = focusedWaveWindow.workspaceId;
+            }
         }
         if (astate.wasActive) {
             activity.activeminutes = 1;
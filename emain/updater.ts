@@ -1,7 +1,7 @@
 // Copyright 2024, Command Line Inc.
 // SPDX-License-Identifier: Apache-2.0
 
-import { dialog, ipcMain, Notification } from "electron";
+import { app, dialog, ipcMain, Notification } from "electron";
 import { autoUpdater } from "electron-updater";
 import { readFileSync } from "fs";
 import path from "path";
@@ -16,17 +16,29 @@ import { ElectronWshClient } from "./emain-wsh";
 
 export let updater: Updater;
 
+// electron-updater calls the stable channel "latest"
+function normalizeUpdateChannel(channel: string): string {
+    if (!channel || channel == "latest") {
+        return "stable";
+    }
+    return channel;
+}
+
+function toUpdaterChannel(channel: string): string {
+    return channel == "stable" ? "latest" : channel;
+}
+
 function getUpdateChannel(settings: SettingsType): string {
     const updaterConfigPath = path.join(process.resourcesPath!, "app-update.yml");
     const updaterConfig = YAML.parse(readFileSync(updaterConfigPath, { encoding: "utf8" }).toString());
     console.log("Updater config from binary:", updaterConfig);
-    const updaterChannel: string = updaterConfig.channel ?? "latest";
+    const updaterChannel = normalizeUpdateChannel(updaterConfig.channel);
     const settingsChannel = settings["autoupdate:channel"];
-    let retVal = settingsChannel;
+    let retVal = normalizeUpdateChannel(settingsChannel);
 
     // If the user setting doesn't exist yet, set it to the value of the updater config.
-    // If the user was previously on the `latest` channel and has downloaded a `beta` version, update their configured channel to `beta` to prevent downgrading.
-    if (!settingsChannel || (settingsChannel == "latest" && updaterChannel == "beta")) {
+    // If the user was previously on the stable channel and has downloaded a `beta` version, update their configured channel to `beta` to prevent downgrading.
+    if (!settingsChannel || (retVal == "stable" && updaterChannel == "beta")) {
         console.log("Update channel setting does not exist, setting to value from updater config.");
         RpcApi.SetConfigCommand(ElectronWshClient, { "autoupdate:channel": updaterChannel });
         retVal = updaterChannel;
@@ -35,6 +47,17 @@ function getUpdateChannel(settings: SettingsType): string {
     return retVal;
 }
 
+async function getBusyBlockIds(): Promise<string[]> {
+    try {
+        return (await RpcApi.GetBusyBlocksCommand(ElectronWshClient)) ?? [];
+    } catch (e) {
+        console.log("error getting busy blocks", e);
+        return [];
+    }
+}
+
+const IdleCheckIntervalMs = 30000;
+
 export class Updater {
     autoCheckInterval: NodeJS.Timeout | null;
     intervalms: number;
@@ -43,6 +66,15 @@ export class Updater {
     availableUpdateReleaseNotes: string | null;
     private _status: UpdaterStatus;
     lastUpdateCheck: Date;
+    channel: string;
+    deferUntilIdle: boolean;
+    availableVersion: string | null;
+    downloadProgress: number;
+    downloadBytes: number;
+    lastError: string | null;
+    installPending: boolean;
+    busyBlocks: number;
+    idleCheckInterval: NodeJS.Timeout | null;
 
     constructor(settings: SettingsType) {
         this.intervalms = settings["autoupdate:intervalms"];
@@ -54,19 +86,28 @@ export class Updater {
         this.lastUpdateCheck = new Date(0);
         this.autoCheckInterval = null;
         this.availableUpdateReleaseName = null;
-
-        autoUpdater.autoInstallOnAppQuit = settings["autoupdate:installonquit"];
-        console.log("Install update on quit:", settings["autoupdate:installonquit"]);
+        this.availableVersion = null;
+        this.downloadProgress = 0;
+        this.downloadBytes = 0;
+        this.lastError = null;
+        this.installPending = false;
+        this.busyBlocks = 0;
+        this.idleCheckInterval = null;
 
         // Only update the release channel if it's specified, otherwise use the one configured in the updater.
-        autoUpdater.channel = getUpdateChannel(settings);
+        this.channel = getUpdateChannel(settings);
+        autoUpdater.channel = toUpdaterChannel(this.channel);
+        this.applySettings(settings);
 
         autoUpdater.removeAllListeners();
 
         autoUpdater.on("error", (err) => {
             console.log("updater error");
             console.log(err);
-            if (!err.toString()?.includes("net::ERR_INTERNET_DISCONNECTED")) this.status = "error";
+            if (!err.toString()?.includes("net::ERR_INTERNET_DISCONNECTED")) {
+                this.lastError = err.message ?? err.toString();
+                this.status = "error";
+            }
         });
 
         autoUpdater.on("checking-for-update", () => {
@@ -74,11 +115,24 @@ export class Updater {
             this.status = "checking";
         });
 
-        autoUpdater.on("update-available", () => {
+        autoUpdater.on("update-available", (info) => {
             console.log("update-available; downloading...");
+            this.availableVersion = info.version;
+            this.downloadProgress = 0;
+            this.downloadBytes = 0;
             this.status = "downloading";
         });
 
+        autoUpdater.on("download-progress", (progress) => {
+            // only send whole-percent changes
+            const changed = Math.floor(progress.percent) != Math.floor(this.downloadProgress);
+            this.downloadProgress = progress.percent;
+            this.downloadBytes = progress.transferred;
+            if (changed) {
+                this.publishStatus();
+            }
+        });
+
         autoUpdater.on("update-not-available", () => {
             console.log("update-not-available");
             this.status = "up-to-date";
@@ -88,6 +142,8 @@ export class Updater {
             console.log("update-downloaded", [event]);
             this.availableUpdateReleaseName = event.releaseName;
             this.availableUpdateReleaseNotes = event.releaseNotes as string | null;
+            this.availableVersion = event.version;
+            this.downloadProgress = 100;
 
             // Display the update banner and create a system notification
             this.status = "ready";
@@ -111,12 +167,61 @@ export class Updater {
 
     private set status(value: UpdaterStatus) {
         this._status = value;
+        if (value != "error") {
+            this.lastError = null;
+        }
         getAllWaveWindows().forEach((window) => {
             const allTabs = Array.from(window.allLoadedTabViews.values());
             allTabs.forEach((tab) => {
                 tab.webContents.send("app-update-status", value);
             });
         });
+        this.publishStatus();
+    }
+
+    getStatusData(): UpdaterStatusData {
+        return {
+            status: this.status,
+            channel: this.channel,
+            currentversion: app.getVersion(),
+            version: this.availableVersion ?? undefined,
+            releasenotes: this.availableUpdateReleaseNotes ?? undefined,
+            progress: this.downloadProgress,
+            downloadbytes: this.downloadBytes,
+            error: this.lastError ?? undefined,
+            lastcheckts: this.lastUpdateCheck.getTime() || undefined,
+            installpending: this.installPending,
+            busyblocks: this.busyBlocks,
+        };
+    }
+
+    /**
+     * Sends the "updater:status" event (for wsh and the UI)
+     */
+    publishStatus() {
+        fireAndForget(() =>
+            RpcApi.EventPublishCommand(
+                ElectronWshClient,
+                { event: "updater:status", data: this.getStatusData() },
+                { noresponse: true }
+            )
+        );
+    }
+
+    /**
+     * Applies the updater settings that can change without a restart (the channel, delta downloads, and deferring installs)
+     */
+    applySettings(settings: SettingsType) {
+        autoUpdater.autoInstallOnAppQuit = settings["autoupdate:installonquit"];
+        // delta updates download only the changed blocks of the new version (using its blockmap)
+        autoUpdater.disableDifferentialDownload = !settings["autoupdate:delta"];
+        this.deferUntilIdle = settings["autoupdate:deferuntilidle"] ?? true;
+        const channel = normalizeUpdateChannel(settings["autoupdate:channel"]);
+        if (channel != this.channel) {
+            console.log("Update channel changed:", channel);
+            this.channel = channel;
+            autoUpdater.channel = toUpdaterChannel(channel);
+        }
     }
 
     /**
@@ -141,13 +246,15 @@ export class Updater {
             clearInterval(this.autoCheckInterval);
             this.autoCheckInterval = null;
         }
+        this.clearInstallPending();
     }
 
     /**
      * Checks if the configured interval time has passed since the last update check, and if so, checks for updates using the `autoUpdater` object
      * @param userInput Whether the user is requesting this. If so, an alert will report the result of the check.
+     * @param quiet Skip the alert (for checks requested from wsh).
      */
-    async checkForUpdates(userInput: boolean) {
+    async checkForUpdates(userInput: boolean, quiet: boolean = false) {
         const now = new Date();
 
         // Run an update check always if the user requests it, otherwise only if there's an active update check interval and enough time has elapsed.
@@ -156,10 +263,15 @@ export class Updater {
             (this.autoCheckInterval &&
                 (!this.lastUpdateCheck || Math.abs(now.getTime() - this.lastUpdateCheck.getTime()) > this.intervalms))
         ) {
+            try {
+                this.applySettings((await FileService.GetFullConfig()).settings);
+            } catch (e) {
+                console.log("error reading updater settings", e);
+            }
             const result = await autoUpdater.checkForUpdates();
 
             // If the user requested this check and we do not have an available update, let them know with a popup dialog. No need to tell them if there is an update, because we show a banner once the update is ready to install.
-            if (userInput && !result.downloadPromise) {
+            if (userInput && !quiet && !result?.downloadPromise) {
                 const dialogOpts: Electron.MessageBoxOptions = {
                     type: "info",
                     message: "There are currently no updates available.",
@@ -171,6 +283,7 @@ export class Updater {
 
             // Only update the last check time if this is an automatic check. This ensures the interval remains consistent.
             if (!userInput) this.lastUpdateCheck = now;
+            this.publishStatus();
         }
     }
 
@@ -178,19 +291,28 @@ export class Updater {
      * Prompts the user to install the downloaded application update and restarts the application
      */
     async promptToInstallUpdate() {
+        const busyBlockIds = this.deferUntilIdle ? await getBusyBlockIds() : [];
+        let buttons = ["Restart", "Later"];
+        let detail = "A new version has been downloaded. Restart the application to apply the updates.";
+        if (busyBlockIds.length > 0) {
+            buttons = ["Restart When Idle", "Restart Now", "Later"];
+            detail = `A new version has been downloaded. ${busyBlockIds.length} block(s) are still running commands, Wave can restart once they finish.`;
+        }
         const dialogOpts: Electron.MessageBoxOptions = {
             type: "info",
-            buttons: ["Restart", "Later"],
+            buttons,
             title: "Application Update",
             message: process.platform === "win32" ? this.availableUpdateReleaseNotes : this.availableUpdateReleaseName,
-            detail: "A new version has been downloaded. Restart the application to apply the updates.",
+            detail,
         };
 
         const allWindows = getAllWaveWindows();
         if (allWindows.length > 0) {
             await dialog.showMessageBox(focusedWaveWindow ?? allWindows[0], dialogOpts).then(({ response }) => {
                 if (response === 0) {
-                    fireAndForget(this.installUpdate.bind(this));
+                    fireAndForget(() => this.installUpdate(false));
+                } else if (response === 1 && buttons.length == 3) {
+                    fireAndForget(() => this.installUpdate(true));
                 }
             });
         }
@@ -198,13 +320,47 @@ export class Updater {
 
     /**
      * Restarts the app and installs an update if it is available.
+     * @param force Install now, otherwise (with autoupdate:deferuntilidle) wait until no blocks are running commands.
      */
-    async installUpdate() {
-        if (this.status == "ready") {
-            this.status = "installing";
-            await delay(1000);
-            autoUpdater.quitAndInstall();
+    async installUpdate(force: boolean = false) {
+        if (this.status != "ready") {
+            return;
+        }
+        if (!force && this.deferUntilIdle) {
+            const busyBlockIds = await getBusyBlockIds();
+            if (busyBlockIds.length > 0) {
+                this.deferInstall(busyBlockIds.length);
+                return;
+            }
+        }
+        this.clearInstallPending();
+        this.status = "installing";
+        await delay(1000);
+        autoUpdater.quitAndInstall();
+    }
+
+    private deferInstall(numBusy: number) {
+        console.log(`deferring update install, ${numBusy} block(s) are busy`);
+        const changed = !this.installPending || this.busyBlocks != numBusy;
+        this.installPending = true;
+        this.busyBlocks = numBusy;
+        if (this.idleCheckInterval == null) {
+            this.idleCheckInterval = setInterval(() => {
+                fireAndForget(() => this.installUpdate(false));
+            }, IdleCheckIntervalMs);
+        }
+        if (changed) {
+            this.publishStatus();
+        }
+    }
+
+    private clearInstallPending() {
+        if (this.idleCheckInterval) {
+            clearInterval(this.idleCheckInterval);
+            this.idleCheckInterval = null;
         }
+        this.installPending = false;
+        this.busyBlocks = 0;
     }
 }
 
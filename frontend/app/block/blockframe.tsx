@@ -392,6 +392,15 @@ const ConnStatusOverlay = React.memo(
         if (connStatus.status == "connected") {
             showReconnect = false;
         }
+        if (connStatus.errorcode == "hostkey-revoked") {
+            // reconnecting fails the same way until the known_hosts entry changes
+            statusText = `Host key for "${connName}" is revoked`;
+            showReconnect = false;
+        }
+        if (connStatus.errorcode == "hostkey-krl-revoked") {
+            statusText = `Host key for "${connName}" was revoked by an administrator`;
+            showReconnect = false;
+        }
         let reconDisplay = null;
         let reconClassName = "outlined grey";
         if (width && width < 350) {
@@ -607,6 +616,18 @@ const BlockFrame_Default_Component = (props: BlockFrameProps) => {
     );
 };
 
+// matches part of the connection name, or part of its display:group or one of its display:tags (ignoring case)
+function connMatchesQuery(connName: string, connConfig: ConnKeywords, query: string): boolean {
+    if (connName.includes(query)) {
+        return true;
+    }
+    const lowerQuery = query.toLowerCase();
+    if (connConfig?.["display:group"]?.toLowerCase().includes(lowerQuery)) {
+        return true;
+    }
+    return connConfig?.["display:tags"]?.some((tag) => tag.toLowerCase().includes(lowerQuery)) ?? false;
+}
+
 const ChangeConnectionBlockModal = React.memo(
     ({
         blockId,
@@ -632,6 +653,9 @@ const ChangeConnectionBlockModal = React.memo(
         const connStatus = jotai.useAtomValue(connStatusAtom);
         const [connList, setConnList] = React.useState<Array<string>>([]);
         const [wslList, setWslList] = React.useState<Array<string>>([]);
+        const [tailscalePeers, setTailscalePeers] = React.useState<Array<TailscalePeer>>([]);
+        const [containers, setContainers] = React.useState<Array<ContainerInfo>>([]);
+        const [vagrantMachines, setVagrantMachines] = React.useState<Array<VagrantMachine>>([]);
         const allConnStatus = jotai.useAtomValue(atoms.allConnStatus);
         const [rowIndex, setRowIndex] = React.useState(0);
         const connStatusMap = new Map<string, ConnStatus>();
@@ -667,6 +691,31 @@ const ChangeConnectionBlockModal = React.memo(
                     // typeahead was opened. good candidate for verbose log level.
                     //console.log("unable to load wsl list from backend. using blank list: ", e)
                 });
+            const p3rtn = RpcApi.TailscalePeersCommand(TabRpcClient, { timeout: 2000 });
+            p3rtn
+                .then((newPeers) => {
+                    setTailscalePeers(newPeers ?? []);
+                })
+                .catch((e) => {
+                    // fails silently like the wsl list, most systems don't run tailscale
+                });
+            const p4rtn = RpcApi.ContainerListCommand(TabRpcClient, { timeout: 2000 });
+            p4rtn
+                .then((newContainers) => {
+                    setContainers(newContainers ?? []);
+                })
+                .catch((e) => {
+                    // fails silently too, when there is no container runtime
+                });
+            // vagrant is slow to answer, the machines show up when the discovery is done
+            const p5rtn = RpcApi.VagrantListCommand(TabRpcClient, { timeout: 60000 });
+            p5rtn
+                .then((newMachines) => {
+                    setVagrantMachines(newMachines ?? []);
+                })
+                .catch((e) => {
+                    // fails silently too, most systems don't have vagrant
+                });
         }, [changeConnModalOpen, setConnList]);
 
         const changeConnection = React.useCallback(
@@ -707,7 +756,7 @@ const ChangeConnectionBlockModal = React.memo(
         const filteredList: Array<string> = [];
         for (const conn of connList) {
             if (
-                conn.includes(connSelected) &&
+                connMatchesQuery(conn, connectionsConfig?.[conn], connSelected) &&
                 connectionsConfig?.[conn]?.["display:hidden"] != true &&
                 (connectionsConfig?.[conn]?.["conn:wshenabled"] != false || !filterOutNowsh)
                 // != false is necessary because of defaults
@@ -796,13 +845,15 @@ const ChangeConnectionBlockModal = React.memo(
         const remoteItems = filteredList.map((connName) => {
             const connStatus = connStatusMap.get(connName);
             const connColorNum = computeConnColorNum(connStatus);
+            const connConfig = connectionsConfig?.[connName];
             const item: SuggestionConnectionItem = {
                 status: "connected",
-                icon: "arrow-right-arrow-left",
+                icon: connConfig?.["display:favorite"] ? "star" : "arrow-right-arrow-left",
                 iconColor:
-                    connStatus?.status == "connected"
+                    connConfig?.["display:color"] ??
+                    (connStatus?.status == "connected"
                         ? `var(--conn-icon-color-${connColorNum})`
-                        : "var(--grey-text-color)",
+                        : "var(--grey-text-color)"),
                 value: connName,
                 label: connName,
                 current: connName == connection,
@@ -833,15 +884,107 @@ const ChangeConnectionBlockModal = React.memo(
             (itemA: SuggestionConnectionItem, itemB: SuggestionConnectionItem) => {
                 const connNameA = itemA.value;
                 const connNameB = itemB.value;
+                const favoriteA = connectionsConfig?.[connNameA]?.["display:favorite"] ? 0 : 1;
+                const favoriteB = connectionsConfig?.[connNameB]?.["display:favorite"] ? 0 : 1;
+                if (favoriteA != favoriteB) {
+                    return favoriteA - favoriteB;
+                }
                 const valueA = connectionsConfig?.[connNameA]?.["display:order"] ?? 0;
                 const valueB = connectionsConfig?.[connNameB]?.["display:order"] ?? 0;
                 return valueA - valueB;
             }
         );
+        // connections with a display:group get a section of their own
         const remoteSuggestions: SuggestionConnectionScope = {
             headerText: "Remote",
-            items: [...sortedRemoteItems],
+            items: [],
+        };
+        const groupSuggestions = new Map<string, SuggestionConnectionScope>();
+        for (const item of sortedRemoteItems) {
+            const group = connectionsConfig?.[item.value]?.["display:group"];
+            if (util.isBlank(group)) {
+                remoteSuggestions.items.push(item);
+                continue;
+            }
+            if (!groupSuggestions.has(group)) {
+                groupSuggestions.set(group, { headerText: group, items: [] });
+            }
+            groupSuggestions.get(group).items.push(item);
+        }
+        const sortedGroupSuggestions = [...groupSuggestions.values()].sort((a, b) =>
+            a.headerText.localeCompare(b.headerText)
+        );
+        // online tailscale peers that aren't connections yet (by their MagicDNS name)
+        const tailscaleSuggestions: SuggestionConnectionScope = {
+            headerText: "Tailscale",
+            items: [],
         };
+        for (const peer of tailscalePeers) {
+            if (!peer.online || !peer.dnsname.includes(connSelected) || connList.includes(peer.dnsname)) {
+                continue;
+            }
+            tailscaleSuggestions.items.push({
+                status: "connected",
+                icon: "arrow-right-arrow-left",
+                iconColor: "var(--grey-text-color)",
+                value: peer.dnsname,
+                label: peer.dnsname,
+                current: peer.dnsname == connection,
+            });
+            if (peer.dnsname === connSelected) {
+                createNew = false;
+            }
+        }
+        // running vagrant machines that aren't connections yet (by their alias in the generated ssh config)
+        const vagrantSuggestions: SuggestionConnectionScope = {
+            headerText: "Vagrant",
+            items: [],
+        };
+        for (const machine of vagrantMachines) {
+            const vagrantConn = machine.connection;
+            if (!vagrantConn || !vagrantConn.includes(connSelected) || connList.includes(vagrantConn)) {
+                continue;
+            }
+            vagrantSuggestions.items.push({
+                status: "connected",
+                icon: "arrow-right-arrow-left",
+                iconColor: "var(--grey-text-color)",
+                value: vagrantConn,
+                label: vagrantConn,
+                current: vagrantConn == connection,
+            });
+            if (vagrantConn === connSelected) {
+                createNew = false;
+            }
+        }
+        // running containers of docker, podman and containerd, and incus/lxd instances (these have
+        // no wsh, so only for views that don't need it)
+        const containerSuggestions: SuggestionConnectionScope = {
+            headerText: "Containers",
+            items: [],
+        };
+        for (const container of filterOutNowsh ? [] : containers) {
+            const containerConn = container.connection;
+            if (!containerConn.includes(connSelected)) {
+                continue;
+            }
+            const connStatus = connStatusMap.get(containerConn);
+            const connColorNum = computeConnColorNum(connStatus);
+            containerSuggestions.items.push({
+                status: "connected",
+                icon: "arrow-right-arrow-left",
+                iconColor:
+                    connStatus?.status == "connected"
+                        ? `var(--conn-icon-color-${connColorNum})`
+                        : "var(--grey-text-color)",
+                value: containerConn,
+                label: containerConn,
+                current: containerConn == connection,
+            });
+            if (containerConn === connSelected) {
+                createNew = false;
+            }
+        }
 
         const suggestions: Array<SuggestionsType> = [
             ...(showReconnect && (connStatus.status == "disconnected" || connStatus.status == "error")
@@ -849,6 +992,10 @@ const ChangeConnectionBlockModal = React.memo(
                 : []),
             ...(localSuggestion.items.length > 0 ? [localSuggestion] : []),
             ...(remoteSuggestions.items.length > 0 ? [remoteSuggestions] : []),
+            ...sortedGroupSuggestions,
+            ...(tailscaleSuggestions.items.length > 0 ? [tailscaleSuggestions] : []),
+            ...(vagrantSuggestions.items.length > 0 ? [vagrantSuggestions] : []),
+            ...(containerSuggestions.items.length > 0 ? [containerSuggestions] : []),
             ...(connSelected == "" ? [connectionsEditItem] : []),
             ...(createNew ? [newConnectionSuggestion] : []),
         ];
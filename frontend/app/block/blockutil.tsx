@@ -206,6 +206,10 @@ export const ConnectionButton = React.memo(
                     titleText = "Disconnected from " + connection;
                     showDisconnectedSlash = true;
                 }
+                if (connStatus?.insecure) {
+                    iconName = "lock-open";
+                    titleText += " (insecure: the connection is not encrypted)";
+                }
                 if (iconSvg != null) {
                     connIconElem = iconSvg;
                 } else {
@@ -154,22 +154,59 @@ export function transformBlocks(content: string): { content: string; blocks: Map
     };
 }
 
+// assets are streamed from the connection, larger ones aren't shown
+const MarkdownAssetMaxSize = 20 * 1024 * 1024;
+const MaxResolvedPathCacheSize = 500;
+// at least two characters, so windows drive letters aren't taken as a scheme
+const urlSchemeRe = /^[a-z][a-z0-9+.-]+:/i;
+
+// resolved paths are cached (each one is a round trip to the connection), keyed by conn, dir, and ref
+const resolvedPathCache = new Map<string, Promise<string>>();
+
+// true for references to other files (relative or absolute paths), false for urls and anchors
+export function isFileReference(ref: string): boolean {
+    return !isBlank(ref) && !urlSchemeRe.test(ref) && !ref.startsWith("#") && !ref.startsWith("//");
+}
+
+// resolves a relative path in markdown (relative to the markdown file's directory) to an absolute
+// path on the connection.  urls are percent-encoded, and can have a query string or fragment.
+export const resolveRemoteFilePath = (filepath: string, resolveOpts: MarkdownResolveOpts): Promise<string> => {
+    let path = filepath.replace(/[?#].*$/, "");
+    try {
+        path = decodeURI(path);
+    } catch {
+        // not encoded, use the path as is
+    }
+    const cacheKey = `${resolveOpts.connName ?? ""}|${resolveOpts.baseDir}|${path}`;
+    let rtnPromise = resolvedPathCache.get(cacheKey);
+    if (rtnPromise == null) {
+        rtnPromise = RpcApi.RemoteFileJoinCommand(TabRpcClient, [resolveOpts.baseDir, path], {
+            route: makeConnRoute(resolveOpts.connName),
+        }).then((fileInfo) => fileInfo.path);
+        // don't cache failures (the connection may be down)
+        rtnPromise.catch(() => resolvedPathCache.delete(cacheKey));
+        if (resolvedPathCache.size >= MaxResolvedPathCacheSize) {
+            resolvedPathCache.delete(resolvedPathCache.keys().next().value);
+        }
+        resolvedPathCache.set(cacheKey, rtnPromise);
+    }
+    return rtnPromise;
+};
+
 export const resolveRemoteFile = async (filepath: string, resolveOpts: MarkdownResolveOpts): Promise<string | null> => {
-    if (!filepath || filepath.startsWith("http://") || filepath.startsWith("https://")) {
+    if (!isFileReference(filepath)) {
         return filepath;
     }
 
     try {
-        const route = makeConnRoute(resolveOpts.connName);
-        const fileInfo = await RpcApi.RemoteFileJoinCommand(TabRpcClient, [resolveOpts.baseDir, filepath], {
-            route: route,
-        });
+        const path = await resolveRemoteFilePath(filepath, resolveOpts);
 
         const usp = new URLSearchParams();
-        usp.set("path", fileInfo.path);
+        usp.set("path", path);
         if (!isBlank(resolveOpts.connName)) {
             usp.set("connection", resolveOpts.connName);
         }
+        usp.set("maxsize", String(MarkdownAssetMaxSize));
 
         return getWebServerEndpoint() + "/wave/stream-file?" + usp.toString();
     } catch (err) {
@@ -4,8 +4,10 @@
 import { CopyButton } from "@/app/element/copybutton";
 import { createContentBlockPlugin } from "@/app/element/markdown-contentblock-plugin";
 import {
+    isFileReference,
     MarkdownContentBlockType,
     resolveRemoteFile,
+    resolveRemoteFilePath,
     resolveSrcSet,
     transformBlocks,
 } from "@/app/element/markdown-util";
@@ -28,14 +30,23 @@ import "./markdown.scss";
 const Link = ({
     setFocusedHeading,
     props,
+    resolveOpts,
+    onOpenFile,
 }: {
     props: React.AnchorHTMLAttributes<HTMLAnchorElement>;
     setFocusedHeading: (href: string) => void;
+    resolveOpts?: MarkdownResolveOpts;
+    onOpenFile?: (path: string) => void;
 }) => {
     const onClick = (e: React.MouseEvent) => {
         e.preventDefault();
         if (props.href.startsWith("#")) {
             setFocusedHeading(props.href);
+        } else if (resolveOpts != null && onOpenFile != null && isFileReference(props.href)) {
+            // links to other files (relative to the markdown file) are opened from the connection
+            resolveRemoteFilePath(props.href, resolveOpts)
+                .then((path) => onOpenFile(path))
+                .catch((err) => console.warn("Failed to resolve link:", props.href, err));
         } else {
             openLink(props.href);
         }
@@ -228,6 +239,7 @@ type MarkdownProps = {
     className?: string;
     onClickExecute?: (cmd: string) => void;
     resolveOpts?: MarkdownResolveOpts;
+    onOpenFile?: (path: string) => void; // opens links to other files (resolved with resolveOpts)
     scrollable?: boolean;
     rehype?: boolean;
     fontSizeOverride?: number;
@@ -246,6 +258,7 @@ const Markdown = ({
     scrollable = true,
     rehype = true,
     onClickExecute,
+    onOpenFile,
 }: MarkdownProps) => {
     const textAtomValue = useAtomValueSafe<string>(textAtom);
     const tocRef = useRef<TocItem[]>([]);
@@ -276,7 +289,12 @@ const Markdown = ({
 
     const markdownComponents: Partial<Components> = {
         a: (props: React.HTMLAttributes<HTMLAnchorElement>) => (
-            <Link props={props} setFocusedHeading={setFocusedHeading} />
+            <Link
+                props={props}
+                setFocusedHeading={setFocusedHeading}
+                resolveOpts={resolveOpts}
+                onOpenFile={onOpenFile}
+            />
         ),
         p: (props: React.HTMLAttributes<HTMLParagraphElement>) => <div className="paragraph" {...props} />,
         h1: (props: React.HTMLAttributes<HTMLHeadingElement>) => <Heading props={props} hnum={1} />,
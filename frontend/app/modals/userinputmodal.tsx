@@ -10,9 +10,104 @@ import { useCallback, useEffect, useMemo, useRef, useState } from "react";
 import { UserInputService } from "../store/services";
 import "./userinputmodal.scss";
 
+const OtpInput = ({
+    numDigits,
+    value,
+    onChange,
+    onKeyDown,
+}: {
+    numDigits: number;
+    value: string;
+    onChange: (value: string) => void;
+    onKeyDown: (e: React.KeyboardEvent) => void;
+}) => {
+    const inputRefs = useRef<HTMLInputElement[]>([]);
+
+    const setDigits = useCallback(
+        (startIdx: number, text: string) => {
+            const digits = text.replace(/\D/g, "");
+            if (digits.length == 0) {
+                return;
+            }
+            const chars = value.padEnd(numDigits, " ").split("");
+            let idx = startIdx;
+            for (const digit of digits) {
+                if (idx >= numDigits) {
+                    break;
+                }
+                chars[idx++] = digit;
+            }
+            onChange(chars.join("").trimEnd());
+            inputRefs.current[Math.min(idx, numDigits - 1)]?.focus();
+        },
+        [value, numDigits, onChange]
+    );
+
+    const handleDigitKeyDown = useCallback(
+        (e: React.KeyboardEvent, idx: number) => {
+            if (e.key == "Backspace") {
+                const chars = value.padEnd(numDigits, " ").split("");
+                const clearIdx = chars[idx] != " " || idx == 0 ? idx : idx - 1;
+                chars[clearIdx] = " ";
+                onChange(chars.join("").trimEnd());
+                inputRefs.current[clearIdx]?.focus();
+                e.preventDefault();
+                return;
+            }
+            onKeyDown(e);
+        },
+        [value, numDigits, onChange, onKeyDown]
+    );
+
+    return (
+        <div className="userinput-otp">
+            {Array.from({ length: numDigits }, (_, idx) => (
+                <input
+                    key={idx}
+                    ref={(elem) => {
+                        inputRefs.current[idx] = elem;
+                    }}
+                    type="text"
+                    inputMode="numeric"
+                    autoComplete="one-time-code"
+                    className="userinput-otp-digit"
+                    value={(value[idx] ?? "").trim()}
+                    autoFocus={idx == 0}
+                    onChange={(e) => setDigits(idx, e.target.value.slice(-1))}
+                    onPaste={(e) => {
+                        e.preventDefault();
+                        setDigits(idx, e.clipboardData.getData("text"));
+                    }}
+                    onKeyDown={(e) => handleDigitKeyDown(e, idx)}
+                />
+            ))}
+        </div>
+    );
+};
+
+const getOtpSecondsLeft = (period: number): number => {
+    return period - (Math.floor(Date.now() / 1000) % period);
+};
+
+// the same checks the backend makes for "secret" responses
+const getSecretError = (opts: SecretOpts, text: string, confirmText: string): string => {
+    if (opts?.minlength > 0 && text.length < opts.minlength) {
+        return `Must be at least ${opts.minlength} characters`;
+    }
+    if (opts?.confirmentry && text != confirmText) {
+        return "Entries do not match";
+    }
+    return null;
+};
+
 const UserInputModal = (userInputRequest: UserInputRequest) => {
     const [responseText, setResponseText] = useState("");
+    const [confirmText, setConfirmText] = useState("");
+    const [secretRevealed, setSecretRevealed] = useState(false);
+    const [secretError, setSecretError] = useState<string>(null);
     const [countdown, setCountdown] = useState(Math.floor(userInputRequest.timeoutms / 1000));
+    const otpPeriod = userInputRequest.otpopts?.period ?? 0;
+    const [otpSecondsLeft, setOtpSecondsLeft] = useState(otpPeriod > 0 ? getOtpSecondsLeft(otpPeriod) : 0);
     const checkboxRef = useRef<HTMLInputElement>();
 
     const handleSendErrResponse = useCallback(() => {
@@ -39,6 +134,24 @@ const UserInputModal = (userInputRequest: UserInputRequest) => {
     }, [responseText, userInputRequest]);
     console.log("bar");
 
+    const handleSendSecret = useCallback(() => {
+        const errMsg = getSecretError(userInputRequest.secretopts, responseText, confirmText);
+        if (errMsg != null) {
+            setSecretError(errMsg);
+            return;
+        }
+        fireAndForget(() =>
+            UserInputService.SendUserInputResponse({
+                type: "userinputresp",
+                requestid: userInputRequest.requestid,
+                text: responseText,
+                confirmtext: userInputRequest.secretopts?.confirmentry ? confirmText : undefined,
+                checkboxstat: checkboxRef?.current?.checked ?? false,
+            })
+        );
+        modalsModel.popModal();
+    }, [responseText, confirmText, userInputRequest]);
+
     const handleSendConfirm = useCallback(
         (response: boolean) => {
             fireAndForget(() =>
@@ -57,13 +170,17 @@ const UserInputModal = (userInputRequest: UserInputRequest) => {
     const handleSubmit = useCallback(() => {
         switch (userInputRequest.responsetype) {
             case "text":
+            case "otp":
                 handleSendText();
                 break;
+            case "secret":
+                handleSendSecret();
+                break;
             case "confirm":
                 handleSendConfirm(true);
                 break;
         }
-    }, [handleSendConfirm, handleSendText, userInputRequest.responsetype]);
+    }, [handleSendConfirm, handleSendText, handleSendSecret, userInputRequest.responsetype]);
     console.log("baz");
 
     const handleKeyDown = useCallback(
@@ -92,6 +209,66 @@ const UserInputModal = (userInputRequest: UserInputRequest) => {
         if (userInputRequest.responsetype === "confirm") {
             return <></>;
         }
+        const numDigits = userInputRequest.otpopts?.numdigits ?? 0;
+        if (userInputRequest.responsetype === "otp" && numDigits > 0) {
+            return (
+                <OtpInput
+                    numDigits={numDigits}
+                    value={responseText}
+                    onChange={setResponseText}
+                    onKeyDown={(e) => keyutil.keydownWrapper(handleKeyDown)(e)}
+                />
+            );
+        }
+        if (userInputRequest.responsetype === "secret") {
+            const secretOpts = userInputRequest.secretopts;
+            const inputType = secretRevealed ? "text" : "password";
+            return (
+                <div className="userinput-secret">
+                    <input
+                        type={inputType}
+                        onChange={(e) => {
+                            setResponseText(e.target.value);
+                            setSecretError(null);
+                        }}
+                        value={responseText}
+                        maxLength={400}
+                        className="userinput-inputbox"
+                        autoComplete="off"
+                        autoFocus={true}
+                        onKeyDown={(e) => keyutil.keydownWrapper(handleKeyDown)(e)}
+                    />
+                    {secretOpts?.confirmentry ? (
+                        <input
+                            type={inputType}
+                            onChange={(e) => {
+                                setConfirmText(e.target.value);
+                                setSecretError(null);
+                            }}
+                            value={confirmText}
+                            maxLength={400}
+                            className="userinput-inputbox"
+                            autoComplete="off"
+                            placeholder="Confirm"
+                            onKeyDown={(e) => keyutil.keydownWrapper(handleKeyDown)(e)}
+                        />
+                    ) : null}
+                    {secretOpts?.allowreveal ? (
+                        <div className="userinput-checkbox-row">
+                            <input
+                                type="checkbox"
+                                id={`uireveal-${userInputRequest.requestid}`}
+                                className="userinput-checkbox"
+                                checked={secretRevealed}
+                                onChange={(e) => setSecretRevealed(e.target.checked)}
+                            />
+                            <label htmlFor={`uireveal-${userInputRequest.requestid}`}>Show</label>
+                        </div>
+                    ) : null}
+                    {secretError != null ? <span className="userinput-secret-error">{secretError}</span> : null}
+                </div>
+            );
+        }
         return (
             <input
                 type={userInputRequest.publictext ? "text" : "password"}
@@ -103,7 +280,19 @@ const UserInputModal = (userInputRequest: UserInputRequest) => {
                 onKeyDown={(e) => keyutil.keydownWrapper(handleKeyDown)(e)}
             />
         );
-    }, [userInputRequest.responsetype, userInputRequest.publictext, responseText, handleKeyDown, setResponseText]);
+    }, [
+        userInputRequest.responsetype,
+        userInputRequest.publictext,
+        userInputRequest.otpopts,
+        userInputRequest.secretopts,
+        userInputRequest.requestid,
+        responseText,
+        confirmText,
+        secretRevealed,
+        secretError,
+        handleKeyDown,
+        setResponseText,
+    ]);
     console.log("mem1");
 
     const optionalCheckbox = useMemo(() => {
@@ -127,6 +316,10 @@ const UserInputModal = (userInputRequest: UserInputRequest) => {
     console.log("mem2");
 
     useEffect(() => {
+        if (userInputRequest.timeoutms <= 0) {
+            // no timeout was requested
+            return;
+        }
         let timeout: ReturnType<typeof setTimeout>;
         if (countdown <= 0) {
             timeout = setTimeout(() => {
@@ -141,9 +334,19 @@ const UserInputModal = (userInputRequest: UserInputRequest) => {
     }, [countdown]);
     console.log("count");
 
+    useEffect(() => {
+        if (otpPeriod <= 0) {
+            return;
+        }
+        const interval = setInterval(() => setOtpSecondsLeft(getOtpSecondsLeft(otpPeriod)), 1000);
+        return () => clearInterval(interval);
+    }, [otpPeriod]);
+
     const handleNegativeResponse = useCallback(() => {
         switch (userInputRequest.responsetype) {
             case "text":
+            case "otp":
+            case "secret":
                 handleSendErrResponse();
                 break;
             case "confirm":
@@ -161,10 +364,15 @@ const UserInputModal = (userInputRequest: UserInputRequest) => {
             okLabel={userInputRequest.oklabel}
             cancelLabel={userInputRequest.cancellabel}
         >
-            <div className="userinput-header">{userInputRequest.title + ` (${countdown}s)`}</div>
+            <div className="userinput-header">
+                {userInputRequest.timeoutms > 0 ? userInputRequest.title + ` (${countdown}s)` : userInputRequest.title}
+            </div>
             <div className="userinput-body">
                 {queryText}
                 {inputBox}
+                {otpPeriod > 0 ? (
+                    <span className="userinput-otp-expiry">Current code expires in {otpSecondsLeft}s</span>
+                ) : null}
                 {optionalCheckbox}
             </div>
         </Modal>
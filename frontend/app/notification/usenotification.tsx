@@ -2,9 +2,14 @@
 // SPDX-License-Identifier: Apache-2.0
 
 import { atoms, getApi } from "@/store/global";
+import { UserInputService } from "@/store/services";
+import { fireAndForget } from "@/util/util";
 import { useAtom, useAtomValue } from "jotai";
 import { useCallback, useEffect, useState } from "react";
 
+// actions for backend notifications (see userinput.SendNotification) are reported back by id
+const UserNotificationActionPrefix = "usernotification:";
+
 const notificationActions: { [key: string]: () => void } = {
     installUpdate: () => {
         getApi().installAppUpdate();
@@ -65,6 +70,12 @@ export function useNotification() {
     const handleActionClick = useCallback(
         (e: React.MouseEvent, action: NotificationActionType, id: string) => {
             e.stopPropagation();
+            if (action.actionKey.startsWith(UserNotificationActionPrefix)) {
+                const notificationId = action.actionKey.substring(UserNotificationActionPrefix.length);
+                fireAndForget(() => UserInputService.SendNotificationAction(notificationId));
+                removeNotification(id);
+                return;
+            }
             const actionFn = notificationActions[action.actionKey];
             if (actionFn) {
                 actionFn();
@@ -167,6 +167,16 @@ function initGlobalAtoms(initOpts: GlobalInitOptions) {
     };
 }
 
+// events scoped to a window (e.g. routed userinput prompts) are only handled by that window
+function isEventForThisWindow(event: WaveEvent): boolean {
+    const windowScopes = event.scopes?.filter((scope) => scope.startsWith("window:"));
+    if (windowScopes == null || windowScopes.length == 0) {
+        return true;
+    }
+    const windowId = globalStore.get(atoms.uiContext)?.windowid;
+    return windowScopes.includes("window:" + windowId);
+}
+
 function initGlobalWaveEventSubs() {
     waveEventSubscribe(
         {
@@ -189,10 +199,46 @@ function initGlobalWaveEventSubs() {
             eventType: "userinput",
             handler: (event) => {
                 // console.log("userinput event handler", event);
+                if (!isEventForThisWindow(event)) {
+                    return;
+                }
                 const data: UserInputRequest = event.data;
                 modalsModel.pushModal("UserInputModal", { ...data });
             },
         },
+        {
+            eventType: "userinput:dismiss",
+            handler: (event) => {
+                if (!isEventForThisWindow(event)) {
+                    return;
+                }
+                const data: UserInputRequest = event.data;
+                modalsModel.removeModals(
+                    (modal) => modal.displayName == "UserInputModal" && modal.props?.requestid == data.requestid
+                );
+            },
+        },
+        {
+            eventType: "usernotification",
+            handler: (event) => {
+                if (!isEventForThisWindow(event)) {
+                    return;
+                }
+                const data: UserNotification = event.data;
+                pushNotification({
+                    id: data.notificationid,
+                    icon: data.severity == "error" || data.severity == "warning" ? "circle-exclamation" : "circle-info",
+                    title: data.title,
+                    message: data.message ?? "",
+                    timestamp: new Date().toLocaleString(),
+                    expiration: data.timeoutms > 0 ? Date.now() + data.timeoutms : null,
+                    type: data.severity as NotificationType["type"],
+                    actions: data.actionlabel
+                        ? [{ label: data.actionlabel, actionKey: "usernotification:" + data.notificationid }]
+                        : null,
+                });
+            },
+        },
         {
             eventType: "blockfile",
             handler: (event) => {
@@ -571,6 +617,24 @@ function subscribeToConnEvents() {
             }
         },
     });
+    waveEventSubscribe({
+        eventType: "conn:lifecycle",
+        handler: (event: WaveEvent) => {
+            const connEvent = event.data as ConnLifecycleEvent;
+            if (connEvent?.type != "banner" || isBlank(connEvent.detail)) {
+                return;
+            }
+            // banners are often legal notices, so they stay until dismissed (a reconnect replaces it)
+            pushNotification({
+                id: `connbanner:${connEvent.connection}:${connEvent.host ?? ""}`,
+                icon: "circle-info",
+                title: `Message from ${connEvent.host ?? connEvent.connection}`,
+                message: connEvent.detail,
+                timestamp: new Date(connEvent.ts).toLocaleString(),
+                type: "info",
+            });
+        },
+    });
 }
 
 function getConnStatusAtom(conn: string): PrimitiveAtom<ConnStatus> {
@@ -27,6 +27,14 @@ class ModalsModel {
         }
     };
 
+    removeModals = (predicate: (modal: { displayName: string; props?: any }) => boolean) => {
+        const modals = globalStore.get(this.modalsAtom);
+        const updatedModals = modals.filter((modal) => !predicate(modal));
+        if (updatedModals.length != modals.length) {
+            globalStore.set(this.modalsAtom, updatedModals);
+        }
+    };
+
     hasOpenModals(): boolean {
         const modals = globalStore.get(this.modalsAtom);
         return modals.length > 0;
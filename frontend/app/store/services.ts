@@ -53,12 +53,22 @@ class FileServiceType {
     DeleteFile(connection: string, path: string): Promise<void> {
         return WOS.callBackendService("file", "DeleteFile", Array.from(arguments))
     }
+
+    // compare two files (paths on any connection, or block files), returning line based hunks
+    DiffFiles(oldsrc: DiffSource, newsrc: DiffSource, opts: DiffOpts): Promise<FileDiff> {
+        return WOS.callBackendService("file", "DiffFiles", Array.from(arguments))
+    }
     GetFullConfig(): Promise<FullConfigType> {
         return WOS.callBackendService("file", "GetFullConfig", Array.from(arguments))
     }
     GetWaveFile(arg1: string, arg2: string): Promise<any> {
         return WOS.callBackendService("file", "GetWaveFile", Array.from(arguments))
     }
+
+    // list a directory (paginated, cached for a few seconds unless refresh is set)
+    ListEntries(connection: string, path: string, opts: FileListOpts, refresh: boolean): Promise<RemoteListEntriesRtnData> {
+        return WOS.callBackendService("file", "ListEntries", Array.from(arguments))
+    }
     Mkdir(arg1: string, arg2: string): Promise<void> {
         return WOS.callBackendService("file", "Mkdir", Array.from(arguments))
     }
@@ -67,15 +77,30 @@ class FileServiceType {
     ReadFile(connection: string, path: string): Promise<FullFile> {
         return WOS.callBackendService("file", "ReadFile", Array.from(arguments))
     }
+
+    // read a byte range of a file (base64 encoded, max 1MB)
+    ReadFileRange(connection: string, path: string, offset: number, size: number): Promise<string> {
+        return WOS.callBackendService("file", "ReadFileRange", Array.from(arguments))
+    }
+
+    // read a page of lines from a (large) text file
+    ReadLines(connection: string, path: string, startline: number, numlines: number): Promise<RemoteReadLinesRtnData> {
+        return WOS.callBackendService("file", "ReadLines", Array.from(arguments))
+    }
     Rename(arg1: string, arg2: string, arg3: string): Promise<void> {
         return WOS.callBackendService("file", "Rename", Array.from(arguments))
     }
 
-    // save file
-    SaveFile(connection: string, path: string, data64: string): Promise<void> {
+    // save file (the file is replaced atomically).  if checksum is set the save fails if the file changed since it was read.  returns the new checksum
+    SaveFile(connection: string, path: string, data64: string, checksum: string): Promise<string> {
         return WOS.callBackendService("file", "SaveFile", Array.from(arguments))
     }
 
+    // search a file, returns the matching lines (continue from nextline if it isn't -1)
+    SearchFile(connection: string, opts: CommandRemoteSearchFileData): Promise<RemoteSearchFileRtnData> {
+        return WOS.callBackendService("file", "SearchFile", Array.from(arguments))
+    }
+
     // get file info
     StatFile(connection: string, path: string): Promise<FileInfo> {
         return WOS.callBackendService("file", "StatFile", Array.from(arguments))
@@ -129,6 +154,9 @@ export const ObjectService = new ObjectServiceType();
 
 // userinputservice.UserInputService (userinput)
 class UserInputServiceType {
+    SendNotificationAction(arg1: string): Promise<void> {
+        return WOS.callBackendService("userinput", "SendNotificationAction", Array.from(arguments))
+    }
     SendUserInputResponse(arg1: UserInputResponse): Promise<void> {
         return WOS.callBackendService("userinput", "SendUserInputResponse", Array.from(arguments))
     }
@@ -12,11 +12,76 @@ class RpcApiType {
         return client.wshRpcCall("activity", data, opts);
     }
 
+    // command "aiacceptcmd" [call]
+    AiAcceptCmdCommand(client: WshClient, data: CommandAiAcceptCmdData, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("aiacceptcmd", data, opts);
+    }
+
+    // command "aichatexport" [call]
+    AiChatExportCommand(client: WshClient, data: CommandAiChatData, opts?: RpcOpts): Promise<string> {
+        return client.wshRpcCall("aichatexport", data, opts);
+    }
+
+    // command "aichatlist" [call]
+    AiChatListCommand(client: WshClient, data: CommandAiChatListData, opts?: RpcOpts): Promise<AiChatInfo[]> {
+        return client.wshRpcCall("aichatlist", data, opts);
+    }
+
+    // command "aichatrename" [call]
+    AiChatRenameCommand(client: WshClient, data: CommandAiChatData, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("aichatrename", data, opts);
+    }
+
+    // command "aichatresume" [call]
+    AiChatResumeCommand(client: WshClient, data: CommandAiChatData, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("aichatresume", data, opts);
+    }
+
+    // command "ailistmodels" [call]
+    AiListModelsCommand(client: WshClient, data: CommandAiListModelsData, opts?: RpcOpts): Promise<string[]> {
+        return client.wshRpcCall("ailistmodels", data, opts);
+    }
+
+    // command "ailistpresets" [call]
+    AiListPresetsCommand(client: WshClient, opts?: RpcOpts): Promise<AiPresetInfo[]> {
+        return client.wshRpcCall("ailistpresets", null, opts);
+    }
+
+    // command "aireloadchat" [call]
+    AiReloadChatCommand(client: WshClient, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("aireloadchat", null, opts);
+    }
+
     // command "aisendmessage" [call]
     AiSendMessageCommand(client: WshClient, data: AiMessageData, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("aisendmessage", data, opts);
     }
 
+    // command "aisetpreset" [call]
+    AiSetPresetCommand(client: WshClient, data: CommandAiSetPresetData, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("aisetpreset", data, opts);
+    }
+
+    // command "aisuggestcmd" [call]
+    AiSuggestCmdCommand(client: WshClient, data: CommandAiSuggestCmdData, opts?: RpcOpts): Promise<AiCmdSuggestion> {
+        return client.wshRpcCall("aisuggestcmd", data, opts);
+    }
+
+    // command "aitermcontext" [call]
+    AiTermContextCommand(client: WshClient, data: CommandAiTermContextData, opts?: RpcOpts): Promise<string> {
+        return client.wshRpcCall("aitermcontext", data, opts);
+    }
+
+    // command "aiusage" [call]
+    AiUsageCommand(client: WshClient, opts?: RpcOpts): Promise<AiUsageSummary> {
+        return client.wshRpcCall("aiusage", null, opts);
+    }
+
+    // command "auditevents" [call]
+    AuditEventsCommand(client: WshClient, data: CommandAuditEventsData, opts?: RpcOpts): Promise<AuditEvent[]> {
+        return client.wshRpcCall("auditevents", data, opts);
+    }
+
     // command "authenticate" [call]
     AuthenticateCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<CommandAuthenticateRtnData> {
         return client.wshRpcCall("authenticate", data, opts);
@@ -27,11 +92,51 @@ class RpcApiType {
         return client.wshRpcCall("blockinfo", data, opts);
     }
 
+    // command "clearrememberedanswers" [call]
+    ClearRememberedAnswersCommand(client: WshClient, data: CommandClearRememberedAnswersData, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("clearrememberedanswers", data, opts);
+    }
+
+    // command "clipboardread" [call]
+    ClipboardReadCommand(client: WshClient, opts?: RpcOpts): Promise<string> {
+        return client.wshRpcCall("clipboardread", null, opts);
+    }
+
+    // command "clipboardwrite" [call]
+    ClipboardWriteCommand(client: WshClient, data: CommandClipboardData, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("clipboardwrite", data, opts);
+    }
+
+    // command "collectlogs" [call]
+    CollectLogsCommand(client: WshClient, opts?: RpcOpts): Promise<string> {
+        return client.wshRpcCall("collectlogs", null, opts);
+    }
+
+    // command "connaddforward" [call]
+    ConnAddForwardCommand(client: WshClient, data: CommandConnForwardData, opts?: RpcOpts): Promise<PortForwardInfo> {
+        return client.wshRpcCall("connaddforward", data, opts);
+    }
+
+    // command "connbroadcast" [responsestream]
+	ConnBroadcastCommand(client: WshClient, data: CommandConnBroadcastData, opts?: RpcOpts): AsyncGenerator<ConnBroadcastEvent, void, boolean> {
+        return client.wshRpcStream("connbroadcast", data, opts);
+    }
+
     // command "connconnect" [call]
     ConnConnectCommand(client: WshClient, data: ConnRequest, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("connconnect", data, opts);
     }
 
+    // command "conncopyfile" [responsestream]
+	ConnCopyFileCommand(client: WshClient, data: CommandConnCopyFileData, opts?: RpcOpts): AsyncGenerator<ConnCopyFileProgress, void, boolean> {
+        return client.wshRpcStream("conncopyfile", data, opts);
+    }
+
+    // command "conndebuglog" [call]
+    ConnDebugLogCommand(client: WshClient, data: CommandConnDebugLogData, opts?: RpcOpts): Promise<string> {
+        return client.wshRpcCall("conndebuglog", data, opts);
+    }
+
     // command "conndisconnect" [call]
     ConnDisconnectCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("conndisconnect", data, opts);
@@ -42,21 +147,81 @@ class RpcApiType {
         return client.wshRpcCall("connensure", data, opts);
     }
 
+    // command "connexec" [responsestream]
+	ConnExecCommand(client: WshClient, data: CommandConnExecData, opts?: RpcOpts): AsyncGenerator<ConnExecEvent, void, boolean> {
+        return client.wshRpcStream("connexec", data, opts);
+    }
+
+    // command "connimport" [call]
+    ConnImportCommand(client: WshClient, data: CommandConnImportData, opts?: RpcOpts): Promise<ConnImportResult> {
+        return client.wshRpcCall("connimport", data, opts);
+    }
+
     // command "connlist" [call]
     ConnListCommand(client: WshClient, opts?: RpcOpts): Promise<string[]> {
         return client.wshRpcCall("connlist", null, opts);
     }
 
+    // command "connlistforwards" [call]
+    ConnListForwardsCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<PortForwardInfo[]> {
+        return client.wshRpcCall("connlistforwards", data, opts);
+    }
+
+    // command "connlistinfo" [call]
+    ConnListInfoCommand(client: WshClient, data: ConnListFilter, opts?: RpcOpts): Promise<ConnListEntry[]> {
+        return client.wshRpcCall("connlistinfo", data, opts);
+    }
+
+    // command "connlistmounts" [call]
+    ConnListMountsCommand(client: WshClient, opts?: RpcOpts): Promise<MountInfo[]> {
+        return client.wshRpcCall("connlistmounts", null, opts);
+    }
+
+    // command "connmount" [call]
+    ConnMountCommand(client: WshClient, data: CommandConnMountData, opts?: RpcOpts): Promise<MountInfo> {
+        return client.wshRpcCall("connmount", data, opts);
+    }
+
     // command "connreinstallwsh" [call]
     ConnReinstallWshCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("connreinstallwsh", data, opts);
     }
 
+    // command "connremoveforward" [call]
+    ConnRemoveForwardCommand(client: WshClient, data: CommandConnForwardData, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("connremoveforward", data, opts);
+    }
+
+    // command "connsocksproxy" [call]
+    ConnSocksProxyCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<string> {
+        return client.wshRpcCall("connsocksproxy", data, opts);
+    }
+
+    // command "connstats" [call]
+    ConnStatsCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<ConnStatsInfo> {
+        return client.wshRpcCall("connstats", data, opts);
+    }
+
     // command "connstatus" [call]
     ConnStatusCommand(client: WshClient, opts?: RpcOpts): Promise<ConnStatus[]> {
         return client.wshRpcCall("connstatus", null, opts);
     }
 
+    // command "connsync" [responsestream]
+	ConnSyncCommand(client: WshClient, data: CommandConnSyncData, opts?: RpcOpts): AsyncGenerator<ConnSyncProgress, void, boolean> {
+        return client.wshRpcStream("connsync", data, opts);
+    }
+
+    // command "connunmount" [call]
+    ConnUnmountCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("connunmount", data, opts);
+    }
+
+    // command "containerlist" [call]
+    ContainerListCommand(client: WshClient, opts?: RpcOpts): Promise<ContainerInfo[]> {
+        return client.wshRpcCall("containerlist", null, opts);
+    }
+
     // command "controllerinput" [call]
     ControllerInputCommand(client: WshClient, data: CommandBlockInputData, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("controllerinput", data, opts);
@@ -82,6 +247,11 @@ class RpcApiType {
         return client.wshRpcCall("createsubblock", data, opts);
     }
 
+    // command "debugpprofinfo" [call]
+    DebugPprofInfoCommand(client: WshClient, opts?: RpcOpts): Promise<DebugPprofInfo> {
+        return client.wshRpcCall("debugpprofinfo", null, opts);
+    }
+
     // command "deleteblock" [call]
     DeleteBlockCommand(client: WshClient, data: CommandDeleteBlockData, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("deleteblock", data, opts);
@@ -92,6 +262,11 @@ class RpcApiType {
         return client.wshRpcCall("deletesubblock", data, opts);
     }
 
+    // command "discoverhosts" [call]
+    DiscoverHostsCommand(client: WshClient, data: CommandDiscoverHostsData, opts?: RpcOpts): Promise<DiscoveredHost[]> {
+        return client.wshRpcCall("discoverhosts", data, opts);
+    }
+
     // command "dismisswshfail" [call]
     DismissWshFailCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("dismisswshfail", data, opts);
@@ -177,6 +352,21 @@ class RpcApiType {
         return client.wshRpcCall("focuswindow", data, opts);
     }
 
+    // command "getbusyblocks" [call]
+    GetBusyBlocksCommand(client: WshClient, opts?: RpcOpts): Promise<string[]> {
+        return client.wshRpcCall("getbusyblocks", null, opts);
+    }
+
+    // command "getdiagbundleitem" [call]
+    GetDiagBundleItemCommand(client: WshClient, data: CommandDiagBundleItemData, opts?: RpcOpts): Promise<string> {
+        return client.wshRpcCall("getdiagbundleitem", data, opts);
+    }
+
+    // command "getloglevels" [call]
+    GetLogLevelsCommand(client: WshClient, opts?: RpcOpts): Promise<{[key: string]: string}> {
+        return client.wshRpcCall("getloglevels", null, opts);
+    }
+
     // command "getmeta" [call]
     GetMetaCommand(client: WshClient, data: CommandGetMetaData, opts?: RpcOpts): Promise<MetaType> {
         return client.wshRpcCall("getmeta", data, opts);
@@ -192,6 +382,46 @@ class RpcApiType {
         return client.wshRpcCall("getvar", data, opts);
     }
 
+    // command "getwavestats" [call]
+    GetWaveStatsCommand(client: WshClient, opts?: RpcOpts): Promise<TimeSeriesData> {
+        return client.wshRpcCall("getwavestats", null, opts);
+    }
+
+    // command "keychaindelete" [call]
+    KeychainDeleteCommand(client: WshClient, data: CommandKeychainDeleteData, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("keychaindelete", data, opts);
+    }
+
+    // command "keychainlist" [call]
+    KeychainListCommand(client: WshClient, opts?: RpcOpts): Promise<StoredSecret[]> {
+        return client.wshRpcCall("keychainlist", null, opts);
+    }
+
+    // command "keychainsettotp" [call]
+    KeychainSetTotpCommand(client: WshClient, data: CommandKeychainSetTotpData, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("keychainsettotp", data, opts);
+    }
+
+    // command "knownhostsdelete" [call]
+    KnownHostsDeleteCommand(client: WshClient, data: CommandKnownHostsData, opts?: RpcOpts): Promise<number> {
+        return client.wshRpcCall("knownhostsdelete", data, opts);
+    }
+
+    // command "knownhostslist" [call]
+    KnownHostsListCommand(client: WshClient, data: CommandKnownHostsData, opts?: RpcOpts): Promise<KnownHostEntry[]> {
+        return client.wshRpcCall("knownhostslist", data, opts);
+    }
+
+    // command "knownhostsverify" [call]
+    KnownHostsVerifyCommand(client: WshClient, data: CommandKnownHostsData, opts?: RpcOpts): Promise<KnownHostsVerifyResult> {
+        return client.wshRpcCall("knownhostsverify", data, opts);
+    }
+
+    // command "listrememberedanswers" [call]
+    ListRememberedAnswersCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<RememberedAnswer[]> {
+        return client.wshRpcCall("listrememberedanswers", data, opts);
+    }
+
     // command "message" [call]
     MessageCommand(client: WshClient, data: CommandMessageData, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("message", data, opts);
@@ -202,11 +432,56 @@ class RpcApiType {
         return client.wshRpcCall("notify", data, opts);
     }
 
+    // command "passphrasecacheflush" [call]
+    PassphraseCacheFlushCommand(client: WshClient, opts?: RpcOpts): Promise<number> {
+        return client.wshRpcCall("passphrasecacheflush", null, opts);
+    }
+
     // command "path" [call]
     PathCommand(client: WshClient, data: PathCommandData, opts?: RpcOpts): Promise<string> {
         return client.wshRpcCall("path", data, opts);
     }
 
+    // command "plugincontrol" [call]
+    PluginControlCommand(client: WshClient, data: CommandPluginControlData, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("plugincontrol", data, opts);
+    }
+
+    // command "pluginlist" [call]
+    PluginListCommand(client: WshClient, opts?: RpcOpts): Promise<PluginInfo[]> {
+        return client.wshRpcCall("pluginlist", null, opts);
+    }
+
+    // command "preparediagbundle" [call]
+    PrepareDiagBundleCommand(client: WshClient, opts?: RpcOpts): Promise<DiagBundleInfo> {
+        return client.wshRpcCall("preparediagbundle", null, opts);
+    }
+
+    // command "recordingexport" [call]
+    RecordingExportCommand(client: WshClient, data: CommandRecordingExportData, opts?: RpcOpts): Promise<string> {
+        return client.wshRpcCall("recordingexport", data, opts);
+    }
+
+    // command "recordinglist" [call]
+    RecordingListCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<RecordingInfo[]> {
+        return client.wshRpcCall("recordinglist", data, opts);
+    }
+
+    // command "recordingstart" [call]
+    RecordingStartCommand(client: WshClient, data: CommandRecordingStartData, opts?: RpcOpts): Promise<RecordingInfo> {
+        return client.wshRpcCall("recordingstart", data, opts);
+    }
+
+    // command "recordingstop" [call]
+    RecordingStopCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<RecordingInfo> {
+        return client.wshRpcCall("recordingstop", data, opts);
+    }
+
+    // command "remotearchiveextract" [responsestream]
+	RemoteArchiveExtractCommand(client: WshClient, data: CommandRemoteArchiveExtractData, opts?: RpcOpts): AsyncGenerator<ArchiveExtractProgress, void, boolean> {
+        return client.wshRpcStream("remotearchiveextract", data, opts);
+    }
+
     // command "remotefiledelete" [call]
     RemoteFileDeleteCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("remotefiledelete", data, opts);
@@ -232,11 +507,31 @@ class RpcApiType {
         return client.wshRpcCall("remotefiletouch", data, opts);
     }
 
+    // command "remotegetinfo" [call]
+    RemoteGetInfoCommand(client: WshClient, opts?: RpcOpts): Promise<RemoteInfo> {
+        return client.wshRpcCall("remotegetinfo", null, opts);
+    }
+
+    // command "remotelistentries" [call]
+    RemoteListEntriesCommand(client: WshClient, data: CommandRemoteListEntriesData, opts?: RpcOpts): Promise<RemoteListEntriesRtnData> {
+        return client.wshRpcCall("remotelistentries", data, opts);
+    }
+
     // command "remotemkdir" [call]
     RemoteMkdirCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("remotemkdir", data, opts);
     }
 
+    // command "remotereadlines" [call]
+    RemoteReadLinesCommand(client: WshClient, data: CommandRemoteReadLinesData, opts?: RpcOpts): Promise<RemoteReadLinesRtnData> {
+        return client.wshRpcCall("remotereadlines", data, opts);
+    }
+
+    // command "remotesearchfile" [call]
+    RemoteSearchFileCommand(client: WshClient, data: CommandRemoteSearchFileData, opts?: RpcOpts): Promise<RemoteSearchFileRtnData> {
+        return client.wshRpcCall("remotesearchfile", data, opts);
+    }
+
     // command "remotestreamcpudata" [responsestream]
 	RemoteStreamCpuDataCommand(client: WshClient, opts?: RpcOpts): AsyncGenerator<TimeSeriesData, void, boolean> {
         return client.wshRpcStream("remotestreamcpudata", null, opts);
@@ -247,6 +542,11 @@ class RpcApiType {
         return client.wshRpcStream("remotestreamfile", data, opts);
     }
 
+    // command "remotewatchfiles" [call]
+    RemoteWatchFilesCommand(client: WshClient, data: CommandRemoteWatchFilesData, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("remotewatchfiles", data, opts);
+    }
+
     // command "remotewritefile" [call]
     RemoteWriteFileCommand(client: WshClient, data: CommandRemoteWriteFileData, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("remotewritefile", data, opts);
@@ -277,6 +577,11 @@ class RpcApiType {
         return client.wshRpcCall("setconnectionsconfig", data, opts);
     }
 
+    // command "setloglevel" [call]
+    SetLogLevelCommand(client: WshClient, data: CommandSetLogLevelData, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("setloglevel", data, opts);
+    }
+
     // command "setmeta" [call]
     SetMetaCommand(client: WshClient, data: CommandSetMetaData, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("setmeta", data, opts);
@@ -307,11 +612,56 @@ class RpcApiType {
         return client.wshRpcStream("streamwaveai", data, opts);
     }
 
+    // command "sysclipboardread" [call]
+    SysClipboardReadCommand(client: WshClient, opts?: RpcOpts): Promise<string> {
+        return client.wshRpcCall("sysclipboardread", null, opts);
+    }
+
+    // command "sysclipboardwrite" [call]
+    SysClipboardWriteCommand(client: WshClient, data: CommandClipboardData, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("sysclipboardwrite", data, opts);
+    }
+
+    // command "tailscalepeers" [call]
+    TailscalePeersCommand(client: WshClient, opts?: RpcOpts): Promise<TailscalePeer[]> {
+        return client.wshRpcCall("tailscalepeers", null, opts);
+    }
+
+    // command "telemetrypreview" [call]
+    TelemetryPreviewCommand(client: WshClient, opts?: RpcOpts): Promise<TelemetryPreviewData> {
+        return client.wshRpcCall("telemetrypreview", null, opts);
+    }
+
     // command "test" [call]
     TestCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("test", data, opts);
     }
 
+    // command "updatercheck" [call]
+    UpdaterCheckCommand(client: WshClient, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("updatercheck", null, opts);
+    }
+
+    // command "updaterinstall" [call]
+    UpdaterInstallCommand(client: WshClient, data: CommandUpdaterInstallData, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("updaterinstall", data, opts);
+    }
+
+    // command "updaterstatus" [call]
+    UpdaterStatusCommand(client: WshClient, opts?: RpcOpts): Promise<UpdaterStatusData> {
+        return client.wshRpcCall("updaterstatus", null, opts);
+    }
+
+    // command "usagestats" [call]
+    UsageStatsCommand(client: WshClient, data: CommandUsageStatsData, opts?: RpcOpts): Promise<UsageStatsSummary> {
+        return client.wshRpcCall("usagestats", data, opts);
+    }
+
+    // command "vagrantlist" [call]
+    VagrantListCommand(client: WshClient, opts?: RpcOpts): Promise<VagrantMachine[]> {
+        return client.wshRpcCall("vagrantlist", null, opts);
+    }
+
     // command "vdomasyncinitiation" [call]
     VDomAsyncInitiationCommand(client: WshClient, data: VDomAsyncInitiationRequest, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("vdomasyncinitiation", data, opts);
@@ -342,21 +692,51 @@ class RpcApiType {
         return client.wshRpcCall("waveinfo", null, opts);
     }
 
+    // command "wavestatssubscribe" [call]
+    WaveStatsSubscribeCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("wavestatssubscribe", data, opts);
+    }
+
+    // command "wavestatsunsubscribe" [call]
+    WaveStatsUnsubscribeCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("wavestatsunsubscribe", data, opts);
+    }
+
     // command "webselector" [call]
     WebSelectorCommand(client: WshClient, data: CommandWebSelectorData, opts?: RpcOpts): Promise<string[]> {
         return client.wshRpcCall("webselector", data, opts);
     }
 
+    // command "workspacehandoffexport" [call]
+    WorkspaceHandoffExportCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<WorkspaceHandoffData> {
+        return client.wshRpcCall("workspacehandoffexport", data, opts);
+    }
+
+    // command "workspacehandoffimport" [call]
+    WorkspaceHandoffImportCommand(client: WshClient, data: CommandWorkspaceHandoffImportData, opts?: RpcOpts): Promise<string> {
+        return client.wshRpcCall("workspacehandoffimport", data, opts);
+    }
+
     // command "workspacelist" [call]
     WorkspaceListCommand(client: WshClient, opts?: RpcOpts): Promise<WorkspaceInfoData[]> {
         return client.wshRpcCall("workspacelist", null, opts);
     }
 
+    // command "writediagbundle" [call]
+    WriteDiagBundleCommand(client: WshClient, data: CommandWriteDiagBundleData, opts?: RpcOpts): Promise<string> {
+        return client.wshRpcCall("writediagbundle", data, opts);
+    }
+
     // command "wshactivity" [call]
     WshActivityCommand(client: WshClient, data: {[key: string]: number}, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("wshactivity", data, opts);
     }
 
+    // command "wshhelperstatus" [call]
+    WshHelperStatusCommand(client: WshClient, opts?: RpcOpts): Promise<WshHelperStatus[]> {
+        return client.wshRpcCall("wshhelperstatus", null, opts);
+    }
+
     // command "wsldefaultdistro" [call]
     WslDefaultDistroCommand(client: WshClient, opts?: RpcOpts): Promise<string> {
         return client.wshRpcCall("wsldefaultdistro", null, opts);
@@ -6,9 +6,11 @@ import { Input } from "@/app/element/input";
 import { ContextMenuModel } from "@/app/store/contextmenu";
 import { PLATFORM, atoms, createBlock, getApi, globalStore } from "@/app/store/global";
 import { FileService } from "@/app/store/services";
+import { RpcApi } from "@/app/store/wshclientapi";
+import { TabRpcClient } from "@/app/store/wshrpcutil";
 import type { PreviewModel } from "@/app/view/preview/preview";
 import { checkKeyPressed, isCharacterKeyEvent } from "@/util/keyutil";
-import { base64ToString, fireAndForget, isBlank } from "@/util/util";
+import { fireAndForget, isBlank, makeConnRoute } from "@/util/util";
 import { offset, useDismiss, useFloating, useInteractions } from "@floating-ui/react";
 import {
     Column,
@@ -54,6 +56,38 @@ interface DirectoryTableProps {
 
 const columnHelper = createColumnHelper<FileInfo>();
 
+// directories are loaded a page at a time (rendering as each page arrives)
+const dirListPageSize = 1000;
+const maxDirEntries = 10000;
+
+const extractTimeoutMs = 30 * 60 * 1000;
+
+// archives are browsed like directories (the backend lists and reads their entries)
+function isArchiveFile(fileName: string): boolean {
+    return /\.(zip|tar|tar\.gz|tgz)$/i.test(fileName ?? "");
+}
+
+async function extractArchive(model: PreviewModel, conn: string, finfo: FileInfo, onDone: () => void) {
+    const extractGen = RpcApi.RemoteArchiveExtractCommand(
+        TabRpcClient,
+        { path: finfo.path },
+        { route: makeConnRoute(conn), timeout: extractTimeoutMs }
+    );
+    try {
+        for await (const progress of extractGen) {
+            if (progress.done) {
+                break;
+            }
+            const percent = progress.totalbytes > 0 ? Math.floor((progress.readbytes * 100) / progress.totalbytes) : 0;
+            globalStore.set(model.extractStatus, `Extracting ${finfo.name}... ${percent}% (${progress.files} files)`);
+        }
+        globalStore.set(model.extractStatus, null);
+    } catch (e) {
+        globalStore.set(model.extractStatus, `Error extracting ${finfo.name}: ${e?.message ?? e}`);
+    }
+    onDone();
+}
+
 const displaySuffixes = {
     B: "b",
     kB: "k",
@@ -239,7 +273,18 @@ function DirectoryTable({
                 enableSorting: false,
             }),
             columnHelper.accessor("name", {
-                cell: (info) => <span className="dir-table-name">{info.getValue()}</span>,
+                cell: (info) => {
+                    const finfo = info.row.original;
+                    if (!finfo.issymlink) {
+                        return <span className="dir-table-name">{info.getValue()}</span>;
+                    }
+                    const linkTitle = `${finfo.name} -> ${finfo.linktarget}${finfo.brokenlink ? " (broken link)" : ""}`;
+                    return (
+                        <span className={clsx("dir-table-name", { "broken-link": finfo.brokenlink })} title={linkTitle}>
+                            {info.getValue()} <i className="fa-sharp fa-solid fa-arrow-turn-down-right" />
+                        </span>
+                    );
+                },
                 header: () => <span className="dir-table-head-name">Name</span>,
                 sortingFn: "alphanumeric",
                 size: 200,
@@ -594,6 +639,15 @@ function TableBody({
                         }),
                 },
             ];
+            if (!finfo.isdir && isArchiveFile(finfo.name) && !finfo.readonly) {
+                menu.push({
+                    label: "Extract Here",
+                    click: () =>
+                        fireAndForget(() =>
+                            extractArchive(model, conn, finfo, () => setRefreshVersion((current) => current + 1))
+                        ),
+                });
+            }
             if (finfo.mimetype == "directory") {
                 menu.push({
                     label: "Open Terminal in New Block",
@@ -696,6 +750,7 @@ function DirectoryPreview({ model }: DirectoryPreviewProps) {
     const showHiddenFiles = useAtomValue(model.showHiddenFiles);
     const [selectedPath, setSelectedPath] = useState("");
     const [refreshVersion, setRefreshVersion] = useAtom(model.refreshVersion);
+    const [extractStatus, setExtractStatus] = useAtom(model.extractStatus);
     const conn = useAtomValue(model.connection);
     const blockData = useAtomValue(model.blockAtom);
     const dirPath = useAtomValue(model.normFilePath);
@@ -709,14 +764,42 @@ function DirectoryPreview({ model }: DirectoryPreviewProps) {
         };
     }, [setRefreshVersion]);
 
+    const loadedRefreshVersion = useRef(refreshVersion);
+
     useEffect(() => {
+        let canceled = false;
+        // a refresh (or a change made in this view) skips the backend's listing cache
+        const refresh = loadedRefreshVersion.current != refreshVersion;
+        loadedRefreshVersion.current = refreshVersion;
         const getContent = async () => {
-            const file = await FileService.ReadFile(conn, dirPath);
-            const serializedContent = base64ToString(file?.data64);
-            const content: FileInfo[] = JSON.parse(serializedContent);
-            setUnfilteredData(content);
+            let entries: FileInfo[] = [];
+            let parent: FileInfo[] = [];
+            let pageOffset = 0;
+            while (!canceled && pageOffset < maxDirEntries) {
+                const page = await FileService.ListEntries(
+                    conn,
+                    dirPath,
+                    { all: true, offset: pageOffset, limit: dirListPageSize },
+                    refresh
+                );
+                if (canceled) {
+                    return;
+                }
+                if (page.parent != null) {
+                    parent = [page.parent];
+                }
+                entries = [...entries, ...(page.entries ?? [])];
+                setUnfilteredData([...parent, ...entries]);
+                if (!page.hasmore) {
+                    break;
+                }
+                pageOffset += dirListPageSize;
+            }
+        };
+        getContent().catch((e) => console.log("error listing directory", dirPath, e));
+        return () => {
+            canceled = true;
         };
-        getContent();
     }, [conn, dirPath, refreshVersion]);
 
     useEffect(() => {
@@ -910,6 +993,11 @@ function DirectoryPreview({ model }: DirectoryPreviewProps) {
                     newFile={newFile}
                     newDirectory={newDirectory}
                 />
+                {extractStatus && (
+                    <div className="dir-extract-status" onClick={() => setExtractStatus(null)}>
+                        {extractStatus}
+                    </div>
+                )}
             </div>
             {entryManagerProps && (
                 <EntryManagerOverlay
@@ -924,4 +1012,4 @@ function DirectoryPreview({ model }: DirectoryPreviewProps) {
     );
 }
 
-export { DirectoryPreview };
+export { DirectoryPreview, isArchiveFile };
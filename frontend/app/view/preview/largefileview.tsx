@@ -0,0 +1,398 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+import { Button } from "@/app/element/button";
+import { Input } from "@/app/element/input";
+import { FileService } from "@/app/store/services";
+import type { PreviewModel } from "@/app/view/preview/preview";
+import { base64ToArray, fireAndForget } from "@/util/util";
+import clsx from "clsx";
+import { useAtomValue } from "jotai";
+import { useCallback, useEffect, useMemo, useRef, useState } from "react";
+import "./largefileview.scss";
+
+// files too large to load into the editor are shown a page at a time.  text files are read as
+// pages of lines (the backend keeps a line index), other files as byte ranges (shown as hex).
+
+const LineHeight = 18;
+const TextPageLines = 500;
+const HexBytesPerLine = 16;
+const HexPageLines = 4096;
+const MaxCachedPages = 40;
+// browsers limit element heights, past this the scroll position is scaled to the line number
+const MaxScrollHeight = 8_000_000;
+
+type PageLoader = (pageIdx: number) => Promise<string[]>;
+
+// a bounded cache of loaded pages, version changes (re-rendering the view) as pages arrive
+function usePageCache(loader: PageLoader, pageLines: number, cacheKey: string) {
+    const pages = useRef(new Map<number, string[]>());
+    const loading = useRef(new Set<number>());
+    const [version, setVersion] = useState(0);
+    const [error, setError] = useState<string>(null);
+
+    useEffect(() => {
+        pages.current = new Map();
+        loading.current = new Set();
+        setError(null);
+        setVersion((v) => v + 1);
+    }, [cacheKey]);
+
+    const ensureLoaded = useCallback(
+        (firstLine: number, lastLine: number) => {
+            const firstPage = Math.floor(firstLine / pageLines);
+            const lastPage = Math.floor(lastLine / pageLines);
+            for (let pageIdx = firstPage; pageIdx <= lastPage; pageIdx++) {
+                if (pages.current.has(pageIdx) || loading.current.has(pageIdx)) {
+                    continue;
+                }
+                loading.current.add(pageIdx);
+                const pageMap = pages.current;
+                loader(pageIdx)
+                    .then((lines) => {
+                        if (pageMap != pages.current) {
+                            return;
+                        }
+                        pageMap.set(pageIdx, lines);
+                        if (pageMap.size > MaxCachedPages) {
+                            // maps iterate in insertion order, drop the oldest page
+                            pageMap.delete(pageMap.keys().next().value);
+                        }
+                        setVersion((v) => v + 1);
+                    })
+                    .catch((e) => setError(`${e?.message ?? e}`))
+                    .finally(() => loading.current.delete(pageIdx));
+            }
+        },
+        [loader, pageLines]
+    );
+
+    const getLine = useCallback(
+        (lineNum: number): string => {
+            const page = pages.current.get(Math.floor(lineNum / pageLines));
+            return page?.[lineNum % pageLines];
+        },
+        [pageLines]
+    );
+
+    return { ensureLoaded, getLine, version, error };
+}
+
+interface VirtualLinesProps {
+    numLines: number;
+    getLine: (lineNum: number) => string;
+    ensureLoaded: (firstLine: number, lastLine: number) => void;
+    version: number;
+    gutter: (lineNum: number) => string;
+    scrollToLine?: { line: number };
+    highlightLine?: number;
+}
+
+function VirtualLines({
+    numLines,
+    getLine,
+    ensureLoaded,
+    version,
+    gutter,
+    scrollToLine,
+    highlightLine,
+}: VirtualLinesProps) {
+    const scrollRef = useRef<HTMLDivElement>(null);
+    const [scrollTop, setScrollTop] = useState(0);
+    const [viewHeight, setViewHeight] = useState(0);
+
+    useEffect(() => {
+        const elem = scrollRef.current;
+        if (elem == null) {
+            return;
+        }
+        const observer = new ResizeObserver(() => setViewHeight(elem.clientHeight));
+        observer.observe(elem);
+        setViewHeight(elem.clientHeight);
+        return () => observer.disconnect();
+    }, []);
+
+    const fullHeight = numLines * LineHeight;
+    const totalHeight = Math.min(fullHeight, MaxScrollHeight);
+    const isScaled = fullHeight > MaxScrollHeight;
+    const visibleLines = Math.ceil(viewHeight / LineHeight) + 1;
+    let firstLine: number;
+    let windowTop: number;
+    if (isScaled) {
+        const scrollRange = Math.max(totalHeight - viewHeight, 1);
+        firstLine = Math.floor((scrollTop / scrollRange) * Math.max(numLines - visibleLines + 1, 0));
+        windowTop = scrollTop;
+    } else {
+        firstLine = Math.floor(scrollTop / LineHeight);
+        windowTop = firstLine * LineHeight;
+    }
+    firstLine = Math.max(0, Math.min(firstLine, numLines - 1));
+    const lastLine = Math.min(firstLine + visibleLines, numLines - 1);
+
+    useEffect(() => {
+        if (numLines > 0) {
+            ensureLoaded(firstLine, lastLine);
+        }
+    }, [firstLine, lastLine, numLines, ensureLoaded, version]);
+
+    useEffect(() => {
+        const elem = scrollRef.current;
+        if (scrollToLine == null || elem == null) {
+            return;
+        }
+        // leave a few lines of context above the target
+        const targetLine = Math.max(scrollToLine.line - 3, 0);
+        if (isScaled) {
+            const scrollRange = Math.max(totalHeight - elem.clientHeight, 1);
+            elem.scrollTop = (targetLine / Math.max(numLines - visibleLines + 1, 1)) * scrollRange;
+        } else {
+            elem.scrollTop = targetLine * LineHeight;
+        }
+    }, [scrollToLine]);
+
+    const lines: JSX.Element[] = [];
+    for (let lineNum = firstLine; lineNum <= lastLine && numLines > 0; lineNum++) {
+        const text = getLine(lineNum);
+        lines.push(
+            <div
+                key={lineNum}
+                className={clsx("largefile-line", { highlight: lineNum == highlightLine })}
+                style={{ height: LineHeight }}
+            >
+                <span className="largefile-gutter">{gutter(lineNum)}</span>
+                <span className={clsx("largefile-text", { loading: text == null })}>{text ?? ""}</span>
+            </div>
+        );
+    }
+    return (
+        <div
+            className="largefile-scroll"
+            ref={scrollRef}
+            onScroll={(e) => setScrollTop((e.target as HTMLDivElement).scrollTop)}
+            data-version={version}
+        >
+            <div className="largefile-spacer" style={{ height: totalHeight }}>
+                <div className="largefile-window" style={{ top: windowTop }}>
+                    {lines}
+                </div>
+            </div>
+        </div>
+    );
+}
+
+interface LargeFileViewProps {
+    model: PreviewModel;
+}
+
+function LargeTextView({ model }: LargeFileViewProps) {
+    const conn = useAtomValue(model.connection) ?? "";
+    const fileInfo = useAtomValue(model.statFile);
+    const filePath = fileInfo.path;
+    const [numLines, setNumLines] = useState(0);
+    const [searchText, setSearchText] = useState("");
+    const [search, setSearch] = useState<{ query: string; result: RemoteSearchFileRtnData }>(null);
+    const [searching, setSearching] = useState(false);
+    const [scrollToLine, setScrollToLine] = useState<{ line: number }>(null);
+    const [highlightLine, setHighlightLine] = useState<number>(null);
+
+    const loader = useCallback(
+        async (pageIdx: number) => {
+            const rtn = await FileService.ReadLines(conn, filePath, pageIdx * TextPageLines, TextPageLines);
+            const total = rtn.totallines >= 0 ? rtn.totallines : rtn.esttotallines;
+            setNumLines((prev) => (rtn.totallines >= 0 || pageIdx == 0 ? total : Math.max(prev, total)));
+            return rtn.lines ?? [];
+        },
+        [conn, filePath]
+    );
+    // refreshed (keeping the scroll position) when the file changes on disk
+    const refreshVersion = useAtomValue(model.refreshVersion);
+    const cacheKey = `${conn}:${filePath}:${fileInfo.modtime}:${fileInfo.size}:${refreshVersion}`;
+    const { ensureLoaded, getLine, version, error } = usePageCache(loader, TextPageLines, cacheKey);
+
+    useEffect(() => {
+        setNumLines(0);
+        setSearch(null);
+    }, [conn, filePath]);
+
+    useEffect(() => {
+        // the first page gives the (estimated) number of lines
+        ensureLoaded(0, 0);
+    }, [cacheKey]);
+
+    const runSearch = useCallback(
+        (query: string, startLine: number) => {
+            if (query == "") {
+                setSearch(null);
+                return;
+            }
+            setSearching(true);
+            fireAndForget(async () => {
+                try {
+                    const result = await FileService.SearchFile(conn, {
+                        path: filePath,
+                        query: query,
+                        startline: startLine,
+                        maxresults: 200,
+                    });
+                    setSearch((prev) => {
+                        if (startLine == 0 || prev?.query != query) {
+                            return { query, result };
+                        }
+                        return {
+                            query,
+                            result: { matches: [...prev.result.matches, ...result.matches], nextline: result.nextline },
+                        };
+                    });
+                } catch (e) {
+                    setSearch({ query, result: { matches: [], nextline: -1 } });
+                    console.log("error searching file", filePath, e);
+                } finally {
+                    setSearching(false);
+                }
+            });
+        },
+        [conn, filePath]
+    );
+
+    const gutter = useCallback((lineNum: number) => String(lineNum + 1), []);
+
+    return (
+        <div className="largefile-view">
+            <div className="largefile-toolbar">
+                <span className="largefile-info">
+                    Large file: {numLines.toLocaleString()} lines, showing a page at a time
+                </span>
+                <Input
+                    className="largefile-search"
+                    value={searchText}
+                    onChange={setSearchText}
+                    onKeyDown={(e) => {
+                        if (e.key == "Enter") {
+                            runSearch(searchText, 0);
+                        }
+                    }}
+                    placeholder="Search file (Enter)"
+                />
+            </div>
+            {search != null && (
+                <div className="largefile-results">
+                    {search.result.matches.length == 0 && !searching && (
+                        <div className="largefile-result-info">No matches</div>
+                    )}
+                    {search.result.matches.map((match, idx) => (
+                        <div
+                            key={idx}
+                            className={clsx("largefile-result", { active: match.line == highlightLine })}
+                            onClick={() => {
+                                setHighlightLine(match.line);
+                                setScrollToLine({ line: match.line });
+                            }}
+                        >
+                            <span className="largefile-gutter">{match.line + 1}</span>
+                            <span className="largefile-text">{match.text}</span>
+                        </div>
+                    ))}
+                    {search.result.nextline >= 0 && (
+                        <Button
+                            className="grey small"
+                            disabled={searching}
+                            onClick={() => runSearch(search.query, search.result.nextline)}
+                        >
+                            {searching ? "Searching..." : `Search from line ${search.result.nextline + 1}`}
+                        </Button>
+                    )}
+                </div>
+            )}
+            {error && <div className="largefile-error">{error}</div>}
+            <VirtualLines
+                numLines={numLines}
+                getLine={getLine}
+                ensureLoaded={ensureLoaded}
+                version={version}
+                gutter={gutter}
+                scrollToLine={scrollToLine}
+                highlightLine={highlightLine}
+            />
+        </div>
+    );
+}
+
+function formatHexLine(bytes: Uint8Array): string {
+    const hexParts: string[] = [];
+    let ascii = "";
+    for (let i = 0; i < HexBytesPerLine; i++) {
+        if (i >= bytes.length) {
+            hexParts.push("  ");
+            continue;
+        }
+        hexParts.push(bytes[i].toString(16).padStart(2, "0"));
+        ascii += bytes[i] >= 0x20 && bytes[i] < 0x7f ? String.fromCharCode(bytes[i]) : ".";
+    }
+    const hex = hexParts.slice(0, 8).join(" ") + "  " + hexParts.slice(8).join(" ");
+    return `${hex}  |${ascii}|`;
+}
+
+function HexView({ model }: LargeFileViewProps) {
+    const conn = useAtomValue(model.connection) ?? "";
+    const fileInfo = useAtomValue(model.statFile);
+    const filePath = fileInfo.path;
+    const refreshVersion = useAtomValue(model.refreshVersion);
+    const [fileSize, setFileSize] = useState(fileInfo.size);
+    const numLines = Math.ceil(fileSize / HexBytesPerLine);
+
+    useEffect(() => {
+        setFileSize(fileInfo.size);
+    }, [fileInfo]);
+
+    useEffect(() => {
+        if (refreshVersion == 0) {
+            return;
+        }
+        FileService.StatFile(conn, filePath)
+            .then((info) => setFileSize(info?.size ?? 0))
+            .catch((e) => console.log("error reading file info", filePath, e));
+    }, [refreshVersion]);
+
+    const loader = useCallback(
+        async (pageIdx: number) => {
+            const pageOffset = pageIdx * HexPageLines * HexBytesPerLine;
+            const data64 = await FileService.ReadFileRange(
+                conn,
+                filePath,
+                pageOffset,
+                HexPageLines * HexBytesPerLine
+            );
+            const bytes = base64ToArray(data64);
+            const lines: string[] = [];
+            for (let pos = 0; pos < bytes.length; pos += HexBytesPerLine) {
+                lines.push(formatHexLine(bytes.subarray(pos, pos + HexBytesPerLine)));
+            }
+            return lines;
+        },
+        [conn, filePath]
+    );
+    const cacheKey = `${conn}:${filePath}:${fileInfo.modtime}:${fileSize}:${refreshVersion}`;
+    const { ensureLoaded, getLine, version, error } = usePageCache(loader, HexPageLines, cacheKey);
+    const gutter = useCallback((lineNum: number) => (lineNum * HexBytesPerLine).toString(16).padStart(8, "0"), []);
+    const sizeStr = useMemo(() => fileSize.toLocaleString(), [fileSize]);
+
+    return (
+        <div className="largefile-view">
+            <div className="largefile-toolbar">
+                <span className="largefile-info">
+                    {fileInfo.mimetype || "binary file"}, {sizeStr} bytes
+                </span>
+            </div>
+            {error && <div className="largefile-error">{error}</div>}
+            <VirtualLines
+                numLines={numLines}
+                getLine={getLine}
+                ensureLoaded={ensureLoaded}
+                version={version}
+                gutter={gutter}
+            />
+        </div>
+    );
+}
+
+export { HexView, LargeTextView };
@@ -6,6 +6,7 @@ import { CenteredDiv } from "@/app/element/quickelems";
 import { TypeAheadModal } from "@/app/modals/typeaheadmodal";
 import { ContextMenuModel } from "@/app/store/contextmenu";
 import { tryReinjectKey } from "@/app/store/keymodel";
+import { waveEventSubscribe } from "@/app/store/wps";
 import { RpcApi } from "@/app/store/wshclientapi";
 import { TabRpcClient } from "@/app/store/wshrpcutil";
 import { CodeEditor } from "@/app/view/codeeditor/codeeditor";
@@ -32,11 +33,14 @@ import { loadable } from "jotai/utils";
 import type * as MonacoTypes from "monaco-editor/esm/vs/editor/editor.api";
 import { createRef, memo, useCallback, useEffect, useMemo, useState } from "react";
 import { CSVView } from "./csvview";
-import { DirectoryPreview } from "./directorypreview";
+import { DirectoryPreview, isArchiveFile } from "./directorypreview";
+import { HexView, LargeTextView } from "./largefileview";
 import "./preview.scss";
 
 const MaxFileSize = 1024 * 1024 * 10; // 10MB
 const MaxCSVSize = 1024 * 1024 * 1; // 1MB
+const FileModifiedErrorPrefix = "EC-MODIFIED:";
+const FileWatchRenewMs = 60000;
 
 type SpecializedViewProps = {
     model: PreviewModel;
@@ -49,6 +53,8 @@ const SpecializedViewMap: { [view: string]: ({ model }: SpecializedViewProps) =>
     codeedit: CodeEditPreview,
     csv: CSVViewPreview,
     directory: DirectoryPreview,
+    largetext: LargeTextView,
+    hex: HexView,
 };
 
 const textApplicationMimetypes = [
@@ -104,6 +110,7 @@ function isStreamingType(mimeType: string): boolean {
         mimeType.startsWith("image/")
     );
 }
+
 export class PreviewModel implements ViewModel {
     viewType: string;
     blockId: string;
@@ -134,6 +141,8 @@ export class PreviewModel implements ViewModel {
     fileMimeType: Atom<Promise<string>>;
     fileMimeTypeLoadable: Atom<Loadable<string>>;
     fileContentSaved: PrimitiveAtom<string | null>;
+    savedChecksum: PrimitiveAtom<string | null>;
+    saveConflict: PrimitiveAtom<string | null>;
     fileContent: WritableAtom<Promise<string>, [string], void>;
     newFileContent: PrimitiveAtom<string | null>;
     connectionError: PrimitiveAtom<string>;
@@ -148,6 +157,7 @@ export class PreviewModel implements ViewModel {
 
     showHiddenFiles: PrimitiveAtom<boolean>;
     refreshVersion: PrimitiveAtom<number>;
+    extractStatus: PrimitiveAtom<string>;
     refreshCallback: () => void;
     directoryKeyDownHandler: (waveEvent: WaveKeyboardEvent) => boolean;
     codeEditKeyDownHandler: (waveEvent: WaveKeyboardEvent) => boolean;
@@ -159,6 +169,7 @@ export class PreviewModel implements ViewModel {
         let showHiddenFiles = globalStore.get(getSettingsKeyAtom("preview:showhiddenfiles")) ?? true;
         this.showHiddenFiles = atom<boolean>(showHiddenFiles);
         this.refreshVersion = atom(0);
+        this.extractStatus = atom(null) as PrimitiveAtom<string>;
         this.previewTextRef = createRef();
         this.openFileModal = atom(false);
         this.openFileError = atom(null) as PrimitiveAtom<string>;
@@ -252,7 +263,30 @@ export class PreviewModel implements ViewModel {
             if (get(this.newFileContent) !== null) {
                 saveClassName = "green";
             }
-            if (isCeView) {
+            const saveConflict = get(this.saveConflict);
+            if (isCeView && saveConflict != null) {
+                viewTextChildren.push(
+                    {
+                        elemtype: "text",
+                        text: "Changed on disk",
+                        className: "preview-conflict",
+                    },
+                    {
+                        elemtype: "textbutton",
+                        text: "Overwrite",
+                        className:
+                            "red border-radius-4 vertical-padding-2 horizontal-padding-10 font-size-11 font-weight-500",
+                        onClick: () => fireAndForget(() => this.handleFileSave(true)),
+                    },
+                    {
+                        elemtype: "textbutton",
+                        text: "Reload",
+                        className:
+                            "grey border-radius-4 vertical-padding-2 horizontal-padding-10 font-size-11 font-weight-500",
+                        onClick: () => fireAndForget(this.handleFileReload.bind(this)),
+                    }
+                );
+            } else if (isCeView) {
                 viewTextChildren.push({
                     elemtype: "textbutton",
                     text: "Save",
@@ -310,7 +344,8 @@ export class PreviewModel implements ViewModel {
             const mimeType = jotaiLoadableValue(get(this.fileMimeTypeLoadable), "");
             const loadableSV = get(this.loadableSpecializedView);
             const isCeView = loadableSV.state == "hasData" && loadableSV.data.specializedView == "codeedit";
-            if (mimeType == "directory") {
+            const isDirView = loadableSV.state == "hasData" && loadableSV.data.specializedView == "directory";
+            if (mimeType == "directory" || isDirView) {
                 const showHiddenFiles = get(this.showHiddenFiles);
                 const settings = get(atoms.settingsAtom);
                 return [
@@ -393,12 +428,15 @@ export class PreviewModel implements ViewModel {
             if (fileName == null) {
                 return null;
             }
+            get(this.refreshVersion);
             const conn = (await get(this.connection)) ?? "";
             const file = await services.FileService.ReadFile(conn, fileName);
             return file;
         });
 
         this.fileContentSaved = atom(null) as PrimitiveAtom<string | null>;
+        this.savedChecksum = atom(null) as PrimitiveAtom<string | null>;
+        this.saveConflict = atom(null) as PrimitiveAtom<string | null>;
         const fileContentAtom = atom(
             async (get) => {
                 const _ = get(this.metaFilePath);
@@ -467,8 +505,12 @@ export class PreviewModel implements ViewModel {
             const fileNameStr = fileName ? " " + JSON.stringify(fileName) : "";
             return { errorStr: "File Not Found" + fileNameStr };
         }
-        if (fileInfo.size > MaxFileSize) {
-            return { errorStr: "File Too Large to Preiview (10 MB Max)" };
+        if (!fileInfo.isdir && isArchiveFile(fileInfo.name)) {
+            return { specializedView: "directory" };
+        }
+        if (fileInfo.size > MaxFileSize && !fileInfo.isdir) {
+            // too large to load into the editor, read a page at a time
+            return { specializedView: isTextFile(mimeType) ? "largetext" : "hex" };
         }
         if (mimeType == "text/csv" && fileInfo.size > MaxCSVSize) {
             return { errorStr: "CSV File Too Large to Preiview (1 MB Max)" };
@@ -491,7 +533,7 @@ export class PreviewModel implements ViewModel {
         if (isTextFile(mimeType) || fileInfo.size == 0) {
             return { specializedView: "codeedit" };
         }
-        return { errorStr: `Preview (${mimeType})` };
+        return { specializedView: "hex" };
     }
 
     updateOpenFileModalAndError(isOpen, errorMsg = null) {
@@ -515,6 +557,8 @@ export class PreviewModel implements ViewModel {
         // Clear the saved file buffers
         globalStore.set(this.fileContentSaved, null);
         globalStore.set(this.newFileContent, null);
+        globalStore.set(this.savedChecksum, null);
+        globalStore.set(this.saveConflict, null);
     }
 
     async getParentInfo(fileInfo: FileInfo): Promise<FileInfo | undefined> {
@@ -589,7 +633,8 @@ export class PreviewModel implements ViewModel {
         await services.ObjectService.UpdateObjectMeta(blockOref, { ...blockMeta, edit });
     }
 
-    async handleFileSave() {
+    // the save is rejected if the file changed since it was read (or last saved), unless force is set
+    async handleFileSave(force: boolean = false) {
         const filePath = await globalStore.get(this.statFilePath);
         if (filePath == null) {
             return;
@@ -600,16 +645,69 @@ export class PreviewModel implements ViewModel {
             return;
         }
         const conn = (await globalStore.get(this.connection)) ?? "";
+        let checksum = "";
+        if (!force) {
+            checksum = globalStore.get(this.savedChecksum) ?? (await globalStore.get(this.fullFile))?.checksum ?? "";
+        }
         try {
-            await services.FileService.SaveFile(conn, filePath, stringToBase64(newFileContent));
+            const newChecksum = await services.FileService.SaveFile(
+                conn,
+                filePath,
+                stringToBase64(newFileContent),
+                checksum
+            );
             globalStore.set(this.fileContent, newFileContent);
             globalStore.set(this.newFileContent, null);
+            globalStore.set(this.savedChecksum, newChecksum);
+            globalStore.set(this.saveConflict, null);
             console.log("saved file", filePath);
         } catch (error) {
+            if (error?.message?.includes(FileModifiedErrorPrefix)) {
+                globalStore.set(this.saveConflict, error.message);
+                return;
+            }
             console.error("Error saving file:", error);
         }
     }
 
+    // discards the unsaved changes and reads the file again
+    async handleFileReload() {
+        globalStore.set(this.newFileContent, null);
+        globalStore.set(this.fileContentSaved, null);
+        globalStore.set(this.savedChecksum, null);
+        globalStore.set(this.saveConflict, null);
+        globalStore.set(this.refreshVersion, (v) => v + 1);
+        const fileContent = await globalStore.get(this.fileContent);
+        this.monacoRef.current?.setValue(fileContent);
+        globalStore.set(this.newFileContent, null);
+    }
+
+    // called when the watched file changes on disk.  unsaved edits are kept (shown as a conflict),
+    // otherwise the new contents replace the old ones in place (keeping the editor's scroll position).
+    async handleFileChanged() {
+        const fileInfo = await globalStore.get(this.statFile);
+        if (fileInfo == null) {
+            return;
+        }
+        const loadableSV = globalStore.get(this.loadableSpecializedView);
+        const specializedView = loadableSV.state == "hasData" ? loadableSV.data.specializedView : null;
+        if (specializedView != "codeedit" && specializedView != "markdown" && specializedView != "csv") {
+            globalStore.set(this.refreshVersion, (v) => v + 1);
+            return;
+        }
+        if (globalStore.get(this.newFileContent) != null) {
+            globalStore.set(this.saveConflict, "file changed on disk");
+            return;
+        }
+        const conn = (await globalStore.get(this.connection)) ?? "";
+        const file = await services.FileService.ReadFile(conn, fileInfo.path);
+        if (file?.info == null || file.info.notfound || globalStore.get(this.newFileContent) != null) {
+            return;
+        }
+        globalStore.set(this.fileContent, base64ToString(file.data64));
+        globalStore.set(this.savedChecksum, file.checksum ?? null);
+    }
+
     async handleFileRevert() {
         const fileContent = await globalStore.get(this.fileContent);
         this.monacoRef.current?.setValue(fileContent);
@@ -797,6 +895,7 @@ function MarkdownPreview({ model }: SpecializedViewProps) {
                 textAtom={model.fileContent}
                 showTocAtom={model.markdownShowToc}
                 resolveOpts={resolveOpts}
+                onOpenFile={(path) => fireAndForget(() => model.goHistory(path))}
                 fontSizeOverride={fontSizeOverride}
                 fixedFontSizeOverride={fixedFontSizeOverride}
             />
@@ -976,7 +1075,33 @@ function PreviewView({
     model: PreviewModel;
 }) {
     const connStatus = useAtomValue(model.connStatus);
-    if (connStatus?.status != "connected") {
+    const filePath = jotaiLoadableValue(useAtomValue(model.loadableStatFilePath), null);
+    const connName = useAtomValue(model.blockAtom)?.meta?.connection;
+    const isConnected = connStatus?.status == "connected";
+    useEffect(() => {
+        if (!isConnected || isBlank(filePath)) {
+            return;
+        }
+        const route = makeConnRoute(connName);
+        const watchFile = (paths: string[]) =>
+            RpcApi.RemoteWatchFilesCommand(TabRpcClient, { watchid: blockId, paths: paths }, { route: route }).catch(
+                (e) => console.log("error watching file", filePath, e)
+            );
+        const unsubFn = waveEventSubscribe({
+            eventType: "filechange",
+            scope: blockId,
+            handler: () => fireAndForget(model.handleFileChanged.bind(model)),
+        });
+        watchFile([filePath]);
+        // watches expire unless they are renewed
+        const renewId = setInterval(() => watchFile([filePath]), FileWatchRenewMs);
+        return () => {
+            unsubFn();
+            clearInterval(renewId);
+            watchFile([]);
+        };
+    }, [isConnected, connName, filePath, blockId]);
+    if (!isConnected) {
         return null;
     }
     return (
@@ -23,6 +23,7 @@ const dlog = debug("wave:termwrap");
 const TermFileName = "term";
 const TermCacheFileName = "cache:term:full";
 const MinDataProcessedForCache = 100 * 1024;
+const DefaultClipboardMaxSize = 1024 * 1024;
 
 // detect webgl support
 function detectWebGLSupport(): boolean {
@@ -126,6 +127,14 @@ export class TermWrap {
             }, 0);
             return true;
         });
+        this.terminal.parser.registerOscHandler(52, (data: string) => {
+            // don't replay clipboard writes from the scrollback when the terminal is loading
+            if (!this.loaded) {
+                return true;
+            }
+            this.handleOsc52(data);
+            return true;
+        });
         this.terminal.attachCustomKeyEventHandler(waveOptions.keydownHandler);
         this.connectElem = connectElem;
         this.mainFileSubject = null;
@@ -135,6 +144,39 @@ export class TermWrap {
         this.handleResize();
     }
 
+    // OSC 52 is "selection;base64-data".  requests to read the clipboard ("?") are never answered.
+    handleOsc52(data: string) {
+        const policy = globalStore.get(getSettingsKeyAtom("term:osc52")) ?? "focus";
+        if (policy == "never") {
+            return;
+        }
+        if (policy != "always" && document.activeElement != this.terminal.textarea) {
+            return;
+        }
+        const semiIdx = data.indexOf(";");
+        if (semiIdx == -1) {
+            return;
+        }
+        const b64data = data.substring(semiIdx + 1);
+        if (b64data == "?") {
+            return;
+        }
+        const maxSize = globalStore.get(getSettingsKeyAtom("clipboard:maxsize")) || DefaultClipboardMaxSize;
+        // base64 is 4 chars for every 3 bytes
+        if ((b64data.length / 4) * 3 > maxSize) {
+            console.log("osc 52 data is too large, ignoring", b64data.length);
+            return;
+        }
+        let text: string;
+        try {
+            text = new TextDecoder().decode(base64ToArray(b64data));
+        } catch (e) {
+            console.log("invalid osc 52 data", e);
+            return;
+        }
+        fireAndForget(() => navigator.clipboard.writeText(text));
+    }
+
     async initTerminal() {
         const copyOnSelectAtom = getSettingsKeyAtom("term:copyonselect");
         this.terminal.onData(this.handleTermData.bind(this));
@@ -57,6 +57,10 @@ class AiWshClient extends WshClient {
         }
         this.model.sendMessage(data.message);
     }
+
+    handle_aireloadchat(rh: RpcResponseHelper) {
+        fireAndForget(this.model.populateMessages.bind(this.model));
+    }
 }
 
 export class WaveAiModel implements ViewModel {
@@ -170,6 +174,16 @@ export class WaveAiModel implements ViewModel {
                 maxtokens: settings["ai:maxtokens"] ?? null,
                 timeoutms: settings["ai:timeoutms"] ?? 60000,
                 baseurl: settings["ai:baseurl"] ?? null,
+                temperature: settings["ai:temperature"] ?? null,
+                systemprompt: settings["ai:systemprompt"] ?? null,
+                tools: settings["ai:tools"] ?? null,
+                preset: settings["ai:preset"] ?? null,
+                headers: settings["ai:headers"] ?? null,
+                azuredeployment: settings["ai:azuredeployment"] ?? null,
+                tlsskipverify: settings["ai:tlsskipverify"] ?? null,
+                tlscacert: settings["ai:tlscacert"] ?? null,
+                tlsclientcert: settings["ai:tlsclientcert"] ?? null,
+                tlsclientkey: settings["ai:tlsclientkey"] ?? null,
             };
             return opts;
         });
@@ -200,6 +214,17 @@ export class WaveAiModel implements ViewModel {
                         noAction: true,
                     });
                     break;
+                case "local":
+                case "ollama":
+                case "llamacpp":
+                case "lmstudio":
+                    viewTextChildren.push({
+                        elemtype: "iconbutton",
+                        icon: "location-dot",
+                        title: `Using Local Model @ ${aiOpts.baseurl ?? aiOpts.apitype} (${aiOpts.model ?? "default model"})`,
+                        noAction: true,
+                    });
+                    break;
                 default:
                     if (isCloud) {
                         viewTextChildren.push({
@@ -271,7 +296,7 @@ export class WaveAiModel implements ViewModel {
             let clearButton: IconButtonDecl = {
                 elemtype: "iconbutton",
                 icon: "delete-left",
-                title: "Clear Chat History",
+                title: "New Chat (the current chat is saved, see wsh aichat)",
                 click: this.clearMessages.bind(this),
             };
             return [clearButton];
@@ -292,8 +317,9 @@ export class WaveAiModel implements ViewModel {
         if (!data) {
             return [];
         }
+        // the full chat is kept (for search/export), only the sliding window is sent to the model
         const history: Array<OpenAIPromptMessageType> = JSON.parse(new TextDecoder().decode(data));
-        return history.slice(Math.max(history.length - slidingWindowSize, 0));
+        return history ?? [];
     }
 
     giveFocus(): boolean {
@@ -330,6 +356,7 @@ export class WaveAiModel implements ViewModel {
         const newPrompt: OpenAIPromptMessageType = {
             role: "user",
             content: text,
+            ts: Date.now(),
         };
         const handleAiStreamingResponse = async () => {
             const typingMessage: ChatMessageType = {
@@ -344,7 +371,7 @@ export class WaveAiModel implements ViewModel {
             const beMsg: OpenAiStreamRequest = {
                 clientid: clientId,
                 opts: opts,
-                prompt: [...history, newPrompt],
+                prompt: [...history.slice(Math.max(history.length - slidingWindowSize, 0)), newPrompt],
             };
             let fullMsg = "";
             try {
@@ -365,6 +392,7 @@ export class WaveAiModel implements ViewModel {
                     const responsePrompt: OpenAIPromptMessageType = {
                         role: "assistant",
                         content: fullMsg,
+                        ts: Date.now(),
                     };
                     //mark message as complete
                     globalStore.set(this.updateLastMessageAtom, "", false);
@@ -380,6 +408,7 @@ export class WaveAiModel implements ViewModel {
                     const responsePrompt: OpenAIPromptMessageType = {
                         role: "assistant",
                         content: fullMsg,
+                        ts: Date.now(),
                     };
                     updatedHist.push(responsePrompt);
                 }
@@ -394,6 +423,7 @@ export class WaveAiModel implements ViewModel {
                 const errorPrompt: OpenAIPromptMessageType = {
                     role: "error",
                     content: errMsg,
+                    ts: Date.now(),
                 };
                 updatedHist.push(errorPrompt);
                 await BlockService.SaveWaveAiData(this.blockId, updatedHist);
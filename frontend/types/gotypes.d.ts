@@ -32,6 +32,7 @@ declare global {
         startup?: number;
         shutdown?: number;
         settabtheme?: number;
+        workspaceid?: string;
         buildtime?: string;
         displays?: ActivityDisplayType[];
         renderers?: {[key: string]: number};
@@ -40,11 +41,101 @@ declare global {
         conn?: {[key: string]: number};
     };
 
+    // wshrpc.AiChatInfo
+    type AiChatInfo = {
+        blockid: string;
+        chatid: string;
+        title: string;
+        current?: boolean;
+        createdts: number;
+        updatedts: number;
+        nummessages: number;
+        match?: string;
+    };
+
+    // wshrpc.AiCmdSuggestion
+    type AiCmdSuggestion = {
+        blockid: string;
+        command: string;
+        explanation?: string;
+    };
+
     // wshrpc.AiMessageData
     type AiMessageData = {
         message?: string;
     };
 
+    // wshrpc.AiPresetInfo
+    type AiPresetInfo = {
+        key: string;
+        name?: string;
+        order?: number;
+        apitype?: string;
+        baseurl?: string;
+        model?: string;
+        temperature?: number;
+        systemprompt?: boolean;
+        isdefault?: boolean;
+    };
+
+    // wshrpc.AiToolCall
+    type AiToolCall = {
+        id: string;
+        name: string;
+        input: string;
+    };
+
+    // wshrpc.AiToolDef
+    type AiToolDef = {
+        name: string;
+        description: string;
+        parameters: {[key: string]: any};
+    };
+
+    // wshrpc.AiUsageEntry
+    type AiUsageEntry = {
+        provider: string;
+        profile: string;
+        requests: number;
+        prompttokens: number;
+        completiontokens: number;
+        dailylimit?: number;
+        monthlylimit?: number;
+    };
+
+    // wshrpc.AiUsageSummary
+    type AiUsageSummary = {
+        day: string;
+        monthstart: string;
+        daytokens: number;
+        monthtokens: number;
+        dailylimit?: number;
+        monthlylimit?: number;
+        limitaction: string;
+        today: AiUsageEntry[];
+        month: AiUsageEntry[];
+    };
+
+    // wshrpc.ArchiveExtractProgress
+    type ArchiveExtractProgress = {
+        destpath: string;
+        files: number;
+        bytes: number;
+        readbytes: number;
+        totalbytes: number;
+        done?: boolean;
+    };
+
+    // wshrpc.AuditEvent
+    type AuditEvent = {
+        id: number;
+        ts: number;
+        eventtype: string;
+        connection?: string;
+        source?: string;
+        details?: string;
+    };
+
     // waveobj.Block
     type Block = WaveObj & {
         parentoref?: string;
@@ -98,6 +189,51 @@ declare global {
         newactivetabid?: string;
     };
 
+    // wshrpc.CommandAiAcceptCmdData
+    type CommandAiAcceptCmdData = {
+        blockid: string;
+        command: string;
+        atnextprompt?: boolean;
+    };
+
+    // wshrpc.CommandAiChatData
+    type CommandAiChatData = {
+        blockid?: string;
+        chatid: string;
+        title?: string;
+    };
+
+    // wshrpc.CommandAiChatListData
+    type CommandAiChatListData = {
+        blockid?: string;
+        search?: string;
+    };
+
+    // wshrpc.CommandAiListModelsData
+    type CommandAiListModelsData = {
+        preset?: string;
+        opts?: OpenAIOptsType;
+    };
+
+    // wshrpc.CommandAiSetPresetData
+    type CommandAiSetPresetData = {
+        blockid: string;
+        preset: string;
+    };
+
+    // wshrpc.CommandAiSuggestCmdData
+    type CommandAiSuggestCmdData = {
+        blockid: string;
+        prompt?: string;
+        preset?: string;
+    };
+
+    // wshrpc.CommandAiTermContextData
+    type CommandAiTermContextData = {
+        blockid: string;
+        parts?: string[];
+    };
+
     // wshrpc.CommandAppendIJsonData
     type CommandAppendIJsonData = {
         zoneid: string;
@@ -105,6 +241,14 @@ declare global {
         data: {[key: string]: any};
     };
 
+    // wshrpc.CommandAuditEventsData
+    type CommandAuditEventsData = {
+        sincets?: number;
+        connection?: string;
+        eventtype?: string;
+        limit?: number;
+    };
+
     // wshrpc.CommandAuthenticateRtnData
     type CommandAuthenticateRtnData = {
         routeid: string;
@@ -125,6 +269,87 @@ declare global {
         view: string;
     };
 
+    // wshrpc.CommandClearRememberedAnswersData
+    type CommandClearRememberedAnswersData = {
+        connection: string;
+        key?: string;
+    };
+
+    // wshrpc.CommandClipboardData
+    type CommandClipboardData = {
+        text: string;
+    };
+
+    // wshrpc.CommandConnBroadcastData
+    type CommandConnBroadcastData = {
+        connections: string[];
+        command: string;
+        timeoutms?: number;
+        maxparallel?: number;
+    };
+
+    // wshrpc.CommandConnCopyFileData
+    type CommandConnCopyFileData = {
+        connection: string;
+        direction: string;
+        localpath: string;
+        remotepath: string;
+        resume?: boolean;
+        overwrite?: boolean;
+    };
+
+    // wshrpc.CommandConnDebugLogData
+    type CommandConnDebugLogData = {
+        connection: string;
+        clear?: boolean;
+    };
+
+    // wshrpc.CommandConnExecData
+    type CommandConnExecData = {
+        connection: string;
+        command: string;
+        stdin64?: string;
+        cwd?: string;
+        env?: {[key: string]: string};
+        timeoutms?: number;
+    };
+
+    // wshrpc.CommandConnForwardData
+    type CommandConnForwardData = {
+        connection: string;
+        type: string;
+        spec: string;
+        save?: boolean;
+    };
+
+    // wshrpc.CommandConnImportData
+    type CommandConnImportData = {
+        source: string;
+        path?: string;
+        dryrun?: boolean;
+        overwrite?: boolean;
+    };
+
+    // wshrpc.CommandConnMountData
+    type CommandConnMountData = {
+        connection: string;
+        remotepath?: string;
+        name?: string;
+    };
+
+    // wshrpc.CommandConnSyncData
+    type CommandConnSyncData = {
+        connection: string;
+        direction: string;
+        localpath: string;
+        remotepath: string;
+        checksum?: boolean;
+        delete?: boolean;
+        exclude?: string[];
+        dryrun?: boolean;
+        watch?: boolean;
+    };
+
     // wshrpc.CommandControllerResyncData
     type CommandControllerResyncData = {
         forcerestart?: boolean;
@@ -153,6 +378,20 @@ declare global {
         blockid: string;
     };
 
+    // wshrpc.CommandDiagBundleItemData
+    type CommandDiagBundleItemData = {
+        bundleid: string;
+        name: string;
+    };
+
+    // wshrpc.CommandDiscoverHostsData
+    type CommandDiscoverHostsData = {
+        nomdns?: boolean;
+        subnets?: string[];
+        port?: number;
+        timeoutms?: number;
+    };
+
     // wshrpc.CommandDisposeData
     type CommandDisposeData = {
         routeid: string;
@@ -201,12 +440,81 @@ declare global {
         oref: ORef;
     };
 
+    // wshrpc.CommandKeychainDeleteData
+    type CommandKeychainDeleteData = {
+        key?: string;
+        all?: boolean;
+    };
+
+    // wshrpc.CommandKeychainSetTotpData
+    type CommandKeychainSetTotpData = {
+        connection: string;
+        secret: string;
+    };
+
+    // wshrpc.CommandKnownHostsData
+    type CommandKnownHostsData = {
+        connection?: string;
+        host?: string;
+        fingerprint?: string;
+    };
+
     // wshrpc.CommandMessageData
     type CommandMessageData = {
         oref: ORef;
         message: string;
     };
 
+    // wshrpc.CommandPluginControlData
+    type CommandPluginControlData = {
+        name?: string;
+        action: string;
+    };
+
+    // wshrpc.CommandRecordingExportData
+    type CommandRecordingExportData = {
+        blockid: string;
+        filename?: string;
+        path?: string;
+    };
+
+    // wshrpc.CommandRecordingStartData
+    type CommandRecordingStartData = {
+        blockid: string;
+        title?: string;
+        recordinput?: boolean;
+    };
+
+    // wshrpc.CommandRemoteArchiveExtractData
+    type CommandRemoteArchiveExtractData = {
+        path: string;
+        destpath?: string;
+        overwrite?: boolean;
+    };
+
+    // wshrpc.CommandRemoteListEntriesData
+    type CommandRemoteListEntriesData = {
+        path: string;
+        opts?: FileListOpts;
+    };
+
+    // wshrpc.CommandRemoteReadLinesData
+    type CommandRemoteReadLinesData = {
+        path: string;
+        startline: number;
+        numlines: number;
+    };
+
+    // wshrpc.CommandRemoteSearchFileData
+    type CommandRemoteSearchFileData = {
+        path: string;
+        query: string;
+        regexp?: boolean;
+        casesensitive?: boolean;
+        startline?: number;
+        maxresults?: number;
+    };
+
     // wshrpc.CommandRemoteStreamFileData
     type CommandRemoteStreamFileData = {
         path: string;
@@ -219,11 +527,18 @@ declare global {
         data64?: string;
     };
 
+    // wshrpc.CommandRemoteWatchFilesData
+    type CommandRemoteWatchFilesData = {
+        watchid: string;
+        paths: string[];
+    };
+
     // wshrpc.CommandRemoteWriteFileData
     type CommandRemoteWriteFileData = {
         path: string;
         data64: string;
         createmode?: number;
+        checksum?: string;
     };
 
     // wshrpc.CommandResolveIdsData
@@ -237,12 +552,30 @@ declare global {
         resolvedids: {[key: string]: ORef};
     };
 
+    // wshrpc.CommandSetLogLevelData
+    type CommandSetLogLevelData = {
+        package?: string;
+        level?: string;
+        clear?: boolean;
+    };
+
     // wshrpc.CommandSetMetaData
     type CommandSetMetaData = {
         oref: ORef;
         meta: MetaType;
     };
 
+    // wshrpc.CommandUpdaterInstallData
+    type CommandUpdaterInstallData = {
+        force?: boolean;
+    };
+
+    // wshrpc.CommandUsageStatsData
+    type CommandUsageStatsData = {
+        days?: number;
+        clear?: boolean;
+    };
+
     // wshrpc.CommandVarData
     type CommandVarData = {
         key: string;
@@ -274,24 +607,115 @@ declare global {
         opts?: WebSelectorOpts;
     };
 
+    // wshrpc.CommandWorkspaceHandoffImportData
+    type CommandWorkspaceHandoffImportData = {
+        handoff: WorkspaceHandoffData;
+        open?: boolean;
+    };
+
+    // wshrpc.CommandWriteDiagBundleData
+    type CommandWriteDiagBundleData = {
+        bundleid: string;
+        path?: string;
+    };
+
     // wconfig.ConfigError
     type ConfigError = {
         file: string;
         err: string;
     };
 
+    // wshrpc.ConnBroadcastEvent
+    type ConnBroadcastEvent = {
+        connection: string;
+        type: string;
+        data64?: string;
+        exitcode: number;
+        error?: string;
+    };
+
     // wshrpc.ConnConfigRequest
     type ConnConfigRequest = {
         host: string;
         metamaptype: MetaType;
     };
 
+    // wshrpc.ConnCopyFileProgress
+    type ConnCopyFileProgress = {
+        connection: string;
+        direction: string;
+        localpath: string;
+        remotepath: string;
+        bytes: number;
+        totalbytes: number;
+        resumedfrom?: number;
+        checksum?: string;
+        verified?: boolean;
+        done?: boolean;
+    };
+
+    // wshrpc.ConnExecEvent
+    type ConnExecEvent = {
+        type: string;
+        data64?: string;
+        exitcode: number;
+        exitsignal?: string;
+    };
+
+    // wshrpc.ConnHeadlessOpts
+    type ConnHeadlessOpts = {
+        password?: string;
+        passphrase?: string;
+        stricthostkeychecking?: string;
+    };
+
+    // wshrpc.ConnImportEntry
+    type ConnImportEntry = {
+        session: string;
+        connection?: string;
+        status: string;
+        message?: string;
+        warnings?: string[];
+        keywords?: MetaType;
+    };
+
+    // wshrpc.ConnImportResult
+    type ConnImportResult = {
+        entries: ConnImportEntry[];
+    };
+
     // wshrpc.ConnKeywords
     type ConnKeywords = {
         "conn:wshenabled"?: boolean;
         "conn:askbeforewshinstall"?: boolean;
+        "conn:rememberedanswers"?: {[key: string]: string};
+        "conn:debuglog"?: boolean;
+        "conn:mosh"?: boolean;
+        "conn:moshserver"?: string;
+        "conn:moshclient"?: string;
+        "conn:tailscale"?: boolean;
+        "conn:totpprompt"?: string;
+        "ec2:instanceid"?: string;
+        "ec2:region"?: string;
+        "ec2:profile"?: string;
+        "gcp:iap"?: boolean;
+        "gcp:project"?: string;
+        "gcp:zone"?: string;
+        "gcp:instance"?: string;
+        "gcp:interface"?: string;
+        "azure:bastion"?: string;
+        "azure:resourcegroup"?: string;
+        "azure:subscription"?: string;
+        "azure:vmid"?: string;
+        "docker:host"?: string;
+        "wsl:user"?: string;
+        "wsl:cwd"?: string;
         "display:hidden"?: boolean;
         "display:order"?: number;
+        "display:group"?: string;
+        "display:tags"?: string[];
+        "display:color"?: string;
+        "display:favorite"?: boolean;
         "term:*"?: boolean;
         "term:fontsize"?: number;
         "term:fontfamily"?: string;
@@ -300,22 +724,95 @@ declare global {
         "ssh:hostname"?: string;
         "ssh:port"?: string;
         "ssh:identityfile"?: string[];
+        "ssh:certificatefile"?: string[];
         "ssh:batchmode"?: boolean;
+        "ssh:controlpersist"?: string;
+        "ssh:connecttimeout"?: number;
+        "ssh:connectionattempts"?: number;
+        "ssh:addressfamily"?: string;
         "ssh:pubkeyauthentication"?: boolean;
         "ssh:passwordauthentication"?: boolean;
         "ssh:kbdinteractiveauthentication"?: boolean;
         "ssh:preferredauthentications"?: string[];
         "ssh:addkeystoagent"?: boolean;
+        "ssh:identitiesonly"?: boolean;
         "ssh:identityagent"?: string;
+        "ssh:securitykeyprovider"?: string;
         "ssh:proxyjump"?: string[];
         "ssh:userknownhostsfile"?: string[];
         "ssh:globalknownhostsfile"?: string[];
+        "ssh:hashknownhosts"?: boolean;
+        "ssh:stricthostkeychecking"?: string;
+        "ssh:revokedhostkeys"?: string;
+        "ssh:updatehostkeys"?: string;
+        "ssh:ciphers"?: string;
+        "ssh:macs"?: string;
+        "ssh:kexalgorithms"?: string;
+        "ssh:hostkeyalgorithms"?: string;
+        "ssh:localforward"?: string[];
+        "ssh:remoteforward"?: string[];
+        "ssh:dynamicforward"?: string[];
+        "ssh:streamlocalbindunlink"?: boolean;
+        "ssh:exitonforwardfailure"?: boolean;
+        "ssh:forwardgpgagent"?: boolean;
+        "ssh:sendenv"?: string[];
+        "ssh:setenv"?: string[];
+        "ssh:forwardx11"?: boolean;
+        "ssh:forwardx11trusted"?: boolean;
+        "ssh:permitlocalcommand"?: boolean;
+        "ssh:localcommand"?: string;
+    };
+
+    // wshrpc.ConnListEntry
+    type ConnListEntry = {
+        connection: string;
+        group?: string;
+        tags?: string[];
+        color?: string;
+        favorite?: boolean;
+        hidden?: boolean;
+        order?: number;
+        status?: string;
+    };
+
+    // wshrpc.ConnListFilter
+    type ConnListFilter = {
+        query?: string;
+        group?: string;
+        tags?: string[];
+        favorites?: boolean;
+        showhidden?: boolean;
     };
 
     // wshrpc.ConnRequest
     type ConnRequest = {
         host: string;
         keywords?: ConnKeywords;
+        headless?: ConnHeadlessOpts;
+    };
+
+    // wshrpc.ConnStatsInfo
+    type ConnStatsInfo = {
+        connection: string;
+        connectedts: number;
+        bytessent: number;
+        bytesrecv: number;
+        sendrate: number;
+        recvrate: number;
+        rttms: number;
+        avgrttms: number;
+        lastkeepalivets?: number;
+        keepalivefailures: number;
+        activechannels: number;
+        totalchannels: number;
+        kexalgorithm?: string;
+        hostkeyalgorithm?: string;
+        ciphersend?: string;
+        cipherrecv?: string;
+        macsend?: string;
+        macrecv?: string;
+        postquantumkex?: boolean;
+        serverpostquantumkex?: string[];
     };
 
     // wshrpc.ConnStatus
@@ -327,7 +824,41 @@ declare global {
         hasconnected: boolean;
         activeconnnum: number;
         error?: string;
+        errorcode?: string;
         wsherror?: string;
+        insecure?: boolean;
+    };
+
+    // wshrpc.ConnSyncChange
+    type ConnSyncChange = {
+        action: string;
+        path: string;
+        size?: number;
+    };
+
+    // wshrpc.ConnSyncProgress
+    type ConnSyncProgress = {
+        connection: string;
+        direction: string;
+        round: number;
+        changes?: ConnSyncChange[];
+        path?: string;
+        filestotal: number;
+        filesdone: number;
+        bytestotal: number;
+        bytesdone: number;
+        error?: string;
+        done?: boolean;
+    };
+
+    // wshrpc.ContainerInfo
+    type ContainerInfo = {
+        connection: string;
+        runtime: string;
+        id: string;
+        name: string;
+        image: string;
+        status?: string;
     };
 
     // wshrpc.CpuDataRequest
@@ -336,6 +867,72 @@ declare global {
         count: number;
     };
 
+    // wshrpc.DebugPprofInfo
+    type DebugPprofInfo = {
+        enabled: boolean;
+        url?: string;
+        token?: string;
+    };
+
+    // wshrpc.DiagBundleInfo
+    type DiagBundleInfo = {
+        bundleid: string;
+        items: DiagBundleItem[];
+        expirests: number;
+    };
+
+    // wshrpc.DiagBundleItem
+    type DiagBundleItem = {
+        name: string;
+        description: string;
+        size: number;
+        redactions?: number;
+    };
+
+    // linediff.DiffHunk
+    type DiffHunk = {
+        oldstart: number;
+        oldlines: number;
+        newstart: number;
+        newlines: number;
+        lines: DiffLine[];
+    };
+
+    // linediff.DiffLine
+    type DiffLine = {
+        op: string;
+        text: string;
+        oldline?: number;
+        newline?: number;
+    };
+
+    // linediff.DiffOpts
+    type DiffOpts = {
+        context?: number;
+        ignorewhitespace?: boolean;
+    };
+
+    // fileservice.DiffSource
+    type DiffSource = {
+        connection?: string;
+        path?: string;
+        zoneid?: string;
+        filename?: string;
+    };
+
+    // wshrpc.DiscoveredHost
+    type DiscoveredHost = {
+        connection: string;
+        host: string;
+        port: number;
+        addrs?: string[];
+        name?: string;
+        source: string;
+        serverversion?: string;
+        known?: boolean;
+        keywords?: MetaType;
+    };
+
     // vdom.DomRect
     type DomRect = {
         top: number;
@@ -352,6 +949,21 @@ declare global {
         meta?: {[key: string]: any};
     };
 
+    // fileservice.FileDiff
+    type FileDiff = {
+        oldsize: number;
+        newsize: number;
+        oldchecksum: string;
+        newchecksum: string;
+        identical?: boolean;
+        binary?: boolean;
+        hunks: DiffHunk[];
+        added: number;
+        removed: number;
+        approximate?: boolean;
+        truncated?: boolean;
+    };
+
     // wshrpc.FileInfo
     type FileInfo = {
         path: string;
@@ -365,6 +977,18 @@ declare global {
         isdir?: boolean;
         mimetype?: string;
         readonly?: boolean;
+        issymlink?: boolean;
+        linktarget?: string;
+        brokenlink?: boolean;
+    };
+
+    // wshrpc.FileListOpts
+    type FileListOpts = {
+        all?: boolean;
+        sortby?: string;
+        sortdesc?: boolean;
+        offset?: number;
+        limit?: number;
     };
 
     // filestore.FileOptsType
@@ -375,6 +999,14 @@ declare global {
         ijsonbudget?: number;
     };
 
+    // wshrpc.FileSearchMatch
+    type FileSearchMatch = {
+        line: number;
+        col: number;
+        len: number;
+        text: string;
+    };
+
     // wconfig.FullConfigType
     type FullConfigType = {
         settings: SettingsType;
@@ -384,6 +1016,7 @@ declare global {
         presets: {[key: string]: MetaType};
         termthemes: {[key: string]: TermThemeType};
         connections: {[key: string]: ConnKeywords};
+        hooks: {[key: string]: HookConfigType};
         configerrors: ConfigError[];
     };
 
@@ -391,6 +1024,60 @@ declare global {
     type FullFile = {
         info: FileInfo;
         data64: string;
+        checksum?: string;
+    };
+
+    // wshrpc.HandoffBlockData
+    type HandoffBlockData = {
+        blockid: string;
+        meta: MetaType;
+    };
+
+    // wshrpc.HandoffTabData
+    type HandoffTabData = {
+        name: string;
+        pinned?: boolean;
+        meta?: MetaType;
+        blocks: HandoffBlockData[];
+        rootnode?: any;
+        focusednodeid?: string;
+        magnifiednodeid?: string;
+    };
+
+    // wconfig.HookConfigType
+    type HookConfigType = {
+        event: string;
+        command: string;
+        connection?: string;
+        match?: string;
+        paths?: string[];
+        interval?: string;
+        cwd?: string;
+        env?: {[key: string]: string};
+        stdin?: string;
+        timeout?: number;
+        disabled?: boolean;
+    };
+
+    // wshrpc.KnownHostEntry
+    type KnownHostEntry = {
+        file: string;
+        line: number;
+        marker?: string;
+        hosts: string;
+        hashed?: boolean;
+        keytype?: string;
+        fingerprint?: string;
+        error?: string;
+    };
+
+    // wshrpc.KnownHostsVerifyResult
+    type KnownHostsVerifyResult = {
+        host: string;
+        keytype: string;
+        fingerprint: string;
+        status: string;
+        entries?: KnownHostEntry[];
     };
 
     // waveobj.LayoutActionData
@@ -467,6 +1154,17 @@ declare global {
         "ai:apiversion"?: string;
         "ai:maxtokens"?: number;
         "ai:timeoutms"?: number;
+        "ai:temperature"?: number;
+        "ai:systemprompt"?: string;
+        "ai:tools"?: boolean;
+        "ai:dailytokenlimit"?: number;
+        "ai:monthlytokenlimit"?: number;
+        "ai:headers"?: {[key: string]: string};
+        "ai:azuredeployment"?: string;
+        "ai:tlsskipverify"?: boolean;
+        "ai:tlscacert"?: string;
+        "ai:tlsclientcert"?: string;
+        "ai:tlsclientkey"?: string;
         "editor:*"?: boolean;
         "editor:minimapenabled"?: boolean;
         "editor:stickyscrollenabled"?: boolean;
@@ -499,6 +1197,7 @@ declare global {
         "vdom:correlationid"?: string;
         "vdom:route"?: string;
         "vdom:persist"?: boolean;
+        "plugin:view"?: string;
         count?: number;
     };
 
@@ -515,6 +1214,17 @@ declare global {
         color: string;
     };
 
+    // wshrpc.MountInfo
+    type MountInfo = {
+        name: string;
+        connection: string;
+        remotepath: string;
+        mountpath: string;
+        status: string;
+        error?: string;
+        mountedts: number;
+    };
+
     // waveobj.ORef
     type ORef = string;
 
@@ -529,6 +1239,16 @@ declare global {
         maxtokens?: number;
         maxchoices?: number;
         timeoutms?: number;
+        temperature?: number;
+        systemprompt?: string;
+        tools?: boolean;
+        preset?: string;
+        headers?: {[key: string]: string};
+        azuredeployment?: string;
+        tlsskipverify?: boolean;
+        tlscacert?: string;
+        tlsclientcert?: string;
+        tlsclientkey?: string;
     };
 
     // wshrpc.OpenAIPacketType
@@ -541,6 +1261,7 @@ declare global {
         index?: number;
         text?: string;
         error?: string;
+        toolcalls?: AiToolCall[];
     };
 
     // wshrpc.OpenAIPromptMessageType
@@ -548,6 +1269,9 @@ declare global {
         role: string;
         content: string;
         name?: string;
+        toolcalls?: AiToolCall[];
+        toolcallid?: string;
+        ts?: number;
     };
 
     // wshrpc.OpenAIUsageType
@@ -562,6 +1286,13 @@ declare global {
         clientid?: string;
         opts: OpenAIOptsType;
         prompt: OpenAIPromptMessageType[];
+        tools?: AiToolDef[];
+    };
+
+    // userinput.OtpOpts
+    type OtpOpts = {
+        numdigits?: number;
+        period?: number;
     };
 
     // wshrpc.PathCommandData
@@ -572,12 +1303,110 @@ declare global {
         tabid: string;
     };
 
+    // wshrpc.PluginInfo
+    type PluginInfo = {
+        manifest: PluginManifest;
+        dir: string;
+        route: string;
+        status: string;
+        pid?: number;
+        restarts?: number;
+        lasterror?: string;
+    };
+
+    // wshrpc.PluginManifest
+    type PluginManifest = {
+        name: string;
+        version?: string;
+        description?: string;
+        command: string;
+        args?: string[];
+        env?: {[key: string]: string};
+        views?: PluginView[];
+        commands?: string[];
+        permissions?: string[];
+        autostart?: boolean;
+    };
+
+    // wshrpc.PluginView
+    type PluginView = {
+        name: string;
+        displayname?: string;
+        icon?: string;
+    };
+
     // waveobj.Point
     type Point = {
         x: number;
         y: number;
     };
 
+    // wshrpc.PortForwardInfo
+    type PortForwardInfo = {
+        connection: string;
+        type: string;
+        spec: string;
+        listenaddr?: string;
+        targetaddr?: string;
+        source?: string;
+        activeconns: number;
+        totalconns: number;
+        error?: string;
+    };
+
+    // wshrpc.RecordingInfo
+    type RecordingInfo = {
+        blockid: string;
+        filename: string;
+        title?: string;
+        connection?: string;
+        startts: number;
+        endts?: number;
+        size: number;
+        recordinput?: boolean;
+        active?: boolean;
+    };
+
+    // wshrpc.RememberedAnswer
+    type RememberedAnswer = {
+        connection: string;
+        key: string;
+        answer: string;
+    };
+
+    // wshrpc.RemoteInfo
+    type RemoteInfo = {
+        wshversion: string;
+        clientos: string;
+        clientarch: string;
+        pid: number;
+    };
+
+    // wshrpc.RemoteListEntriesRtnData
+    type RemoteListEntriesRtnData = {
+        dir: FileInfo;
+        parent?: FileInfo;
+        entries: FileInfo[];
+        total: number;
+        hasmore?: boolean;
+    };
+
+    // wshrpc.RemoteReadLinesRtnData
+    type RemoteReadLinesRtnData = {
+        startline: number;
+        lines: string[];
+        eof?: boolean;
+        filesize: number;
+        totallines: number;
+        esttotallines: number;
+    };
+
+    // wshrpc.RemoteSearchFileRtnData
+    type RemoteSearchFileRtnData = {
+        matches: FileSearchMatch[];
+        nextline: number;
+    };
+
     // wshutil.RpcMessage
     type RpcMessage = {
         command?: string;
@@ -607,6 +1436,13 @@ declare global {
         winsize?: WinSize;
     };
 
+    // userinput.SecretOpts
+    type SecretOpts = {
+        confirmentry?: boolean;
+        allowreveal?: boolean;
+        minlength?: number;
+    };
+
     // webcmd.SetBlockTermSizeWSCommand
     type SetBlockTermSizeWSCommand = {
         wscommand: "setblocktermsize";
@@ -629,6 +1465,19 @@ declare global {
         "ai:apiversion"?: string;
         "ai:maxtokens"?: number;
         "ai:timeoutms"?: number;
+        "ai:temperature"?: number;
+        "ai:systemprompt"?: string;
+        "ai:tools"?: boolean;
+        "ai:toolsautoapprove"?: string[];
+        "ai:dailytokenlimit"?: number;
+        "ai:monthlytokenlimit"?: number;
+        "ai:tokenlimitaction"?: string;
+        "ai:headers"?: {[key: string]: string};
+        "ai:azuredeployment"?: string;
+        "ai:tlsskipverify"?: boolean;
+        "ai:tlscacert"?: string;
+        "ai:tlsclientcert"?: string;
+        "ai:tlsclientkey"?: string;
         "ai:fontsize"?: number;
         "ai:fixedfontsize"?: number;
         "term:*"?: boolean;
@@ -640,6 +1489,7 @@ declare global {
         "term:localshellopts"?: string[];
         "term:scrollback"?: number;
         "term:copyonselect"?: boolean;
+        "term:osc52"?: string;
         "editor:minimapenabled"?: boolean;
         "editor:stickyscrollenabled"?: boolean;
         "editor:wordwrap"?: boolean;
@@ -655,9 +1505,14 @@ declare global {
         "autoupdate:intervalms"?: number;
         "autoupdate:installonquit"?: boolean;
         "autoupdate:channel"?: string;
+        "autoupdate:delta"?: boolean;
+        "autoupdate:deferuntilidle"?: boolean;
         "markdown:fontsize"?: number;
         "markdown:fixedfontsize"?: number;
         "preview:showhiddenfiles"?: boolean;
+        "clipboard:*"?: boolean;
+        "clipboard:remote"?: string;
+        "clipboard:maxsize"?: number;
         "tab:preset"?: string;
         "widget:*"?: boolean;
         "widget:showhelp"?: boolean;
@@ -676,11 +1531,45 @@ declare global {
         "window:magnifiedblocksize"?: number;
         "window:magnifiedblockblurprimarypx"?: number;
         "window:magnifiedblockblursecondarypx"?: number;
+        "debug:*"?: boolean;
+        "debug:pprof"?: boolean;
         "telemetry:*"?: boolean;
         "telemetry:enabled"?: boolean;
+        "telemetry:crashes"?: boolean;
+        "telemetry:usage"?: boolean;
+        "telemetry:performance"?: boolean;
+        "log:*"?: boolean;
+        "log:level"?: string;
+        "log:format"?: string;
+        "log:packagelevels"?: string;
+        "log:maxsizemb"?: number;
+        "log:maxagedays"?: number;
+        "log:maxtotalmb"?: number;
+        "log:compress"?: boolean;
+        "tracing:*"?: boolean;
+        "tracing:enabled"?: boolean;
+        "tracing:endpoint"?: string;
+        "userinput:*"?: boolean;
+        "userinput:timeoutms"?: number;
+        "userinput:passphrasetimeoutms"?: number;
+        "userinput:passwordtimeoutms"?: number;
+        "userinput:kbdinteractivetimeoutms"?: number;
+        "userinput:hostkeytimeoutms"?: number;
+        "userinput:securitykeytimeoutms"?: number;
+        "userinput:extendprompt"?: boolean;
         "conn:*"?: boolean;
         "conn:askbeforewshinstall"?: boolean;
         "conn:wshenabled"?: boolean;
+        "conn:tailscalesocket"?: string;
+        "conn:dockerhost"?: string;
+        "conn:podmanhost"?: string;
+        "conn:containerdhost"?: string;
+        "conn:incushost"?: string;
+        "conn:lxdhost"?: string;
+        "conn:passphrasecachesecs"?: number;
+        "conn:internalagent"?: boolean;
+        "conn:maxconcurrent"?: number;
+        "conn:maxconcurrentperhost"?: number;
     };
 
     // waveobj.StickerClickOptsType
@@ -704,6 +1593,15 @@ declare global {
         display: StickerDisplayOptsType;
     };
 
+    // wshrpc.StoredSecret
+    type StoredSecret = {
+        key: string;
+        kind: string;
+        target: string;
+        connection?: string;
+        createdts: number;
+    };
+
     // wps.SubscriptionRequest
     type SubscriptionRequest = {
         event: string;
@@ -718,6 +1616,23 @@ declare global {
         blockids: string[];
     };
 
+    // wshrpc.TailscalePeer
+    type TailscalePeer = {
+        hostname: string;
+        dnsname: string;
+        os?: string;
+        tailscaleips?: string[];
+        online?: boolean;
+        tailscalessh?: boolean;
+    };
+
+    // wshrpc.TelemetryPreviewData
+    type TelemetryPreviewData = {
+        categories: {[key: string]: boolean};
+        url: string;
+        payload?: any;
+    };
+
     // waveobj.TermSize
     type TermSize = {
         rows: number;
@@ -764,6 +1679,42 @@ declare global {
         activetabid: string;
     };
 
+    // wshrpc.UpdaterStatusData
+    type UpdaterStatusData = {
+        status: string;
+        channel: string;
+        currentversion: string;
+        version?: string;
+        releasenotes?: string;
+        progress?: number;
+        downloadbytes?: number;
+        error?: string;
+        lastcheckts?: number;
+        installpending?: boolean;
+        busyblocks?: number;
+    };
+
+    // wshrpc.UsageStatEntry
+    type UsageStatEntry = {
+        key: string;
+        name: string;
+        value: number;
+    };
+
+    // wshrpc.UsageStatsSummary
+    type UsageStatsSummary = {
+        sinceday: string;
+        days: number;
+        daysactive: number;
+        activeminutes: number;
+        busiestday?: string;
+        busiestdayminutes?: number;
+        connections?: UsageStatEntry[];
+        connsessions?: UsageStatEntry[];
+        workspaces?: UsageStatEntry[];
+        blocks?: UsageStatEntry[];
+    };
+
     // userinput.UserInputRequest
     type UserInputRequest = {
         requestid: string;
@@ -776,6 +1727,14 @@ declare global {
         publictext: boolean;
         oklabel?: string;
         cancellabel?: string;
+        secretopts?: SecretOpts;
+        otpopts?: OtpOpts;
+        windowid?: string;
+        rememberkey?: string;
+        rememberconn?: string;
+        tabid?: string;
+        blockid?: string;
+        connname?: string;
     };
 
     // userinput.UserInputResponse
@@ -783,11 +1742,25 @@ declare global {
         type: string;
         requestid: string;
         text?: string;
+        confirmtext?: string;
         confirm?: boolean;
         errormsg?: string;
         checkboxstat?: boolean;
     };
 
+    // userinput.UserNotification
+    type UserNotification = {
+        notificationid: string;
+        title: string;
+        message?: string;
+        severity?: string;
+        timeoutms?: number;
+        actionlabel?: string;
+        windowid?: string;
+        tabid?: string;
+        blockid?: string;
+    };
+
     // vdom.VDomAsyncInitiationRequest
     type VDomAsyncInitiationRequest = {
         type: "asyncinitiationrequest";
@@ -981,6 +1954,17 @@ declare global {
         body?: string;
     };
 
+    // wshrpc.VagrantMachine
+    type VagrantMachine = {
+        id: string;
+        name: string;
+        provider: string;
+        state: string;
+        directory: string;
+        connection?: string;
+        error?: string;
+    };
+
     type WSCommandType = {
         wscommand: string;
     } & ( SetBlockTermSizeWSCommand | BlockInputWSCommand | WSRpcCommand );
@@ -1167,6 +2151,18 @@ declare global {
         activetabid: string;
     };
 
+    // wshrpc.WorkspaceHandoffData
+    type WorkspaceHandoffData = {
+        version: number;
+        ts: number;
+        hostname?: string;
+        name?: string;
+        icon?: string;
+        color?: string;
+        activetab: number;
+        tabs: HandoffTabData[];
+    };
+
     // wshrpc.WorkspaceInfoData
     type WorkspaceInfoData = {
         windowid: string;
@@ -1179,6 +2175,17 @@ declare global {
         windowid: string;
     };
 
+    // wshrpc.WshHelperStatus
+    type WshHelperStatus = {
+        connection: string;
+        wshenabled: boolean;
+        version?: string;
+        expectedversion: string;
+        uptodate: boolean;
+        updatetime?: number;
+        wsherror?: string;
+    };
+
     // wshrpc.WshServerCommandMeta
     type WshServerCommandMeta = {
         commandtype: string;
@@ -0,0 +1,106 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// rolling audit trail of significant events (connections, host keys, commands sent
+// to remote hosts by automation).  events are kept in the db_audit table, capped at
+// MaxEvents and MaxEventAge.
+package audit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wstore"
+)
+
+const MaxEvents = 20000
+const MaxEventAge = 90 * 24 * time.Hour
+const MaxDetailsLen = 1024
+const DefaultLimit = 1000
+
+const (
+	Event_ConnConnect     = "conn:connect"
+	Event_ConnDisconnect  = "conn:disconnect"
+	Event_ConnError       = "conn:error"
+	Event_HostKeyAccepted = "hostkey:accepted"
+	Event_HostKeyChanged  = "hostkey:changed" // connection refused because the host key changed
+	Event_HostKeyRemoved  = "hostkey:removed" // known_hosts entries removed (e.g. to accept a changed key)
+	Event_HostKeyIgnored  = "hostkey:ignored" // changed host key accepted because StrictHostKeyChecking is off
+	Event_HostKeyRevoked  = "hostkey:revoked" // connection refused because the host key is @revoked
+	Event_RemoteInput     = "remote:input"    // input sent to a remote terminal by automation (not typed in the ui)
+	Event_RemoteCommand   = "remote:command"  // command block started on a remote host by automation
+	Event_RecordingStart  = "recording:start" // a terminal session recording was started
+	Event_RecordingStop   = "recording:stop"
+)
+
+// Record adds an event to the audit trail (in a goroutine, errors are logged)
+func Record(eventType string, connName string, source string, details string) {
+	ts := time.Now().UnixMilli()
+	if len(details) > MaxDetailsLen {
+		details = details[:MaxDetailsLen] + "..."
+	}
+	go func() {
+		defer panichandler.PanicHandler("audit.Record")
+		ctx, cancelFn := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelFn()
+		err := insertEvent(ctx, wshrpc.AuditEvent{
+			Ts:         ts,
+			EventType:  eventType,
+			Connection: connName,
+			Source:     source,
+			Details:    details,
+		})
+		if err != nil {
+			log.Printf("error recording audit event %s: %v\n", eventType, err)
+		}
+	}()
+}
+
+func insertEvent(ctx context.Context, event wshrpc.AuditEvent) error {
+	return wstore.WithTx(ctx, func(tx *wstore.TxWrap) error {
+		query := `INSERT INTO db_audit (ts, eventtype, connection, source, details) VALUES (?, ?, ?, ?, ?)`
+		tx.Exec(query, event.Ts, event.EventType, event.Connection, event.Source, event.Details)
+		query = `DELETE FROM db_audit WHERE id <= (SELECT max(id) FROM db_audit) - ? OR ts < ?`
+		tx.Exec(query, MaxEvents, time.Now().Add(-MaxEventAge).UnixMilli())
+		return nil
+	})
+}
+
+// GetEvents returns matching events, oldest first
+func GetEvents(ctx context.Context, data wshrpc.CommandAuditEventsData) ([]wshrpc.AuditEvent, error) {
+	var conds []string
+	var args []any
+	if data.SinceTs > 0 {
+		conds = append(conds, "ts >= ?")
+		args = append(args, data.SinceTs)
+	}
+	if data.Connection != "" {
+		conds = append(conds, "connection = ?")
+		args = append(args, data.Connection)
+	}
+	if data.EventType != "" {
+		// a prefix match so "conn" matches all of the conn:* events
+		conds = append(conds, "(eventtype = ? OR eventtype LIKE ?)")
+		args = append(args, data.EventType, strings.TrimSuffix(data.EventType, ":")+":%")
+	}
+	limit := data.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	query := `SELECT id, ts, eventtype, connection, source, details FROM db_audit`
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	// take the newest events, then return them in order
+	query = fmt.Sprintf(`SELECT * FROM (%s ORDER BY id DESC LIMIT %d) ORDER BY id`, query, limit)
+	return wstore.WithTxRtn(ctx, func(tx *wstore.TxWrap) ([]wshrpc.AuditEvent, error) {
+		var rtn []wshrpc.AuditEvent
+		tx.Select(&rtn, query, args...)
+		return rtn, nil
+	})
+}
@@ -16,11 +16,15 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/wavetermdev/waveterm/pkg/docker"
 	"github.com/wavetermdev/waveterm/pkg/filestore"
+	"github.com/wavetermdev/waveterm/pkg/k8s"
 	"github.com/wavetermdev/waveterm/pkg/panichandler"
 	"github.com/wavetermdev/waveterm/pkg/remote"
 	"github.com/wavetermdev/waveterm/pkg/remote/conncontroller"
 	"github.com/wavetermdev/waveterm/pkg/shellexec"
+	"github.com/wavetermdev/waveterm/pkg/telnet"
+	"github.com/wavetermdev/waveterm/pkg/usagestats"
 	"github.com/wavetermdev/waveterm/pkg/util/envutil"
 	"github.com/wavetermdev/waveterm/pkg/util/utilfn"
 	"github.com/wavetermdev/waveterm/pkg/wavebase"
@@ -80,6 +84,8 @@ type BlockController struct {
 	ShellProcExitCode int
 	RunLock           *atomic.Bool
 	StatusVersion     int
+	ShellIntegration  *ShellIntegration
+	Recorder          *sessionRecorder // the active session recording (nil if not recording)
 }
 
 type BlockControllerRuntimeStatus struct {
@@ -336,10 +342,65 @@ func (bc *BlockController) DoRunShellCommand(rc *RunShellOpts, blockMeta waveobj
 			}
 			cmdOpts.Env[wshutil.WaveJwtTokenVarName] = jwtStr
 		}
+		// the cwd is in the distro, so it is not expanded here (wsl.exe --cd expands ~)
+		cmdOpts.Cwd = blockMeta.GetString(waveobj.MetaKey_CmdCwd, "")
 		shellProc, err = shellexec.StartWslShellProc(ctx, rc.TermSize, cmdStr, cmdOpts, wslConn)
 		if err != nil {
 			return err
 		}
+	} else if k8s.IsK8sConnName(remoteName) {
+		credentialCtx, cancelFunc := context.WithTimeout(context.Background(), 60*time.Second)
+		defer cancelFunc()
+
+		k8sConn, err := k8s.GetK8sConn(credentialCtx, remoteName, false)
+		if err != nil {
+			return err
+		}
+		if k8sConn.GetStatus() != k8s.Status_Connected {
+			return fmt.Errorf("not connected, cannot start shellproc")
+		}
+		if bc.ControllerType == BlockController_Shell {
+			// the cwd is in the container, so it is not expanded here
+			cmdOpts.Cwd = blockMeta.GetString(waveobj.MetaKey_CmdCwd, "")
+		}
+		shellProc, err = shellexec.StartK8sShellProc(credentialCtx, rc.TermSize, cmdStr, cmdOpts, k8sConn)
+		if err != nil {
+			return err
+		}
+	} else if docker.IsContainerConnName(remoteName) {
+		credentialCtx, cancelFunc := context.WithTimeout(context.Background(), 60*time.Second)
+		defer cancelFunc()
+
+		containerConn, err := docker.GetContainerConn(credentialCtx, remoteName, false)
+		if err != nil {
+			return err
+		}
+		if containerConn.GetStatus() != docker.Status_Connected {
+			return fmt.Errorf("not connected, cannot start shellproc")
+		}
+		if bc.ControllerType == BlockController_Shell {
+			// the cwd is in the container, so it is not expanded here
+			cmdOpts.Cwd = blockMeta.GetString(waveobj.MetaKey_CmdCwd, "")
+		}
+		shellProc, err = shellexec.StartContainerShellProc(credentialCtx, rc.TermSize, cmdStr, cmdOpts, containerConn)
+		if err != nil {
+			return err
+		}
+	} else if telnet.IsTelnetConnName(remoteName) {
+		credentialCtx, cancelFunc := context.WithTimeout(context.Background(), 60*time.Second)
+		defer cancelFunc()
+
+		telnetConn, err := telnet.GetTelnetConn(credentialCtx, remoteName, false)
+		if err != nil {
+			return err
+		}
+		if telnetConn.GetStatus() != telnet.Status_Connected {
+			return fmt.Errorf("not connected, cannot start shellproc")
+		}
+		shellProc, err = shellexec.StartTelnetShellProc(credentialCtx, rc.TermSize, cmdStr, telnetConn)
+		if err != nil {
+			return err
+		}
 	} else if remoteName != "" {
 		credentialCtx, cancelFunc := context.WithTimeout(context.Background(), 60*time.Second)
 		defer cancelFunc()
@@ -360,7 +421,12 @@ func (bc *BlockController) DoRunShellCommand(rc *RunShellOpts, blockMeta waveobj
 			}
 			cmdOpts.Env[wshutil.WaveJwtTokenVarName] = jwtStr
 		}
-		if !conn.WshEnabled.Load() {
+		if remote.GetMoshSettings(conn.GetName()).Enabled {
+			shellProc, err = shellexec.StartMoshShellProc(rc.TermSize, cmdStr, cmdOpts, conn)
+			if err != nil {
+				return err
+			}
+		} else if !conn.WshEnabled.Load() {
 			shellProc, err = shellexec.StartRemoteShellProcNoWsh(rc.TermSize, cmdStr, cmdOpts, conn)
 			if err != nil {
 				return err
@@ -415,8 +481,28 @@ func (bc *BlockController) DoRunShellCommand(rc *RunShellOpts, blockMeta waveobj
 		bc.ShellProcStatus = Status_Running
 		return true
 	})
+	usagestats.GoAdd(usagestats.Stat_ConnSessions, usagestats.ConnKey(remoteName), 1)
 	shellInputCh := make(chan *BlockInputUnion, 32)
 	bc.ShellInputCh = shellInputCh
+	shellIntegration := MakeShellIntegration()
+	shellIntegration.OnCommandDone = func(cmd CommandHistoryEntry, cwd string) {
+		wps.Broker.Publish(wps.WaveEvent{
+			Event:  wps.Event_CmdDone,
+			Scopes: []string{waveobj.MakeORef(waveobj.OType_Block, bc.BlockId).String()},
+			Data: wps.CmdDoneEventData{
+				BlockId:     bc.BlockId,
+				Connection:  remoteName,
+				Command:     cmd.Command,
+				ExitCode:    cmd.ExitCode,
+				HasExitCode: cmd.HasExitCode,
+				Cwd:         cwd,
+				Ts:          cmd.Ts,
+			},
+		})
+	}
+	bc.WithLock(func() {
+		bc.ShellIntegration = shellIntegration
+	})
 
 	// make esc sequence wshclient wshProxy
 	// we don't need to authenticate this wshProxy since it is coming direct
@@ -429,6 +515,7 @@ func (bc *BlockController) DoRunShellCommand(rc *RunShellOpts, blockMeta waveobj
 		defer panichandler.PanicHandler("blockcontroller:shellproc-pty-read-loop")
 		defer func() {
 			log.Printf("[shellproc] pty-read loop done\n")
+			bc.finishRecording()
 			shellProc.Close()
 			bc.WithLock(func() {
 				// so no other events are sent
@@ -446,10 +533,12 @@ func (bc *BlockController) DoRunShellCommand(rc *RunShellOpts, blockMeta waveobj
 		for {
 			nr, err := ptyBuffer.Read(buf)
 			if nr > 0 {
+				shellIntegration.Process(buf[:nr])
 				err := HandleAppendBlockFile(bc.BlockId, BlockFile_Term, buf[:nr])
 				if err != nil {
 					log.Printf("error appending to blockfile: %v\n", err)
 				}
+				bc.recordOutput(buf[:nr])
 			}
 			if err == io.EOF {
 				break
@@ -655,6 +744,7 @@ func (bc *BlockController) SendInput(inputUnion *BlockInputUnion) error {
 	if shellInputCh == nil {
 		return fmt.Errorf("no shell input chan")
 	}
+	bc.recordInput(inputUnion)
 	shellInputCh <- inputUnion
 	return nil
 }
@@ -677,6 +767,39 @@ func CheckConnStatus(blockId string) error {
 		}
 		return nil
 	}
+	if k8s.IsK8sConnName(connName) {
+		conn, err := k8s.GetK8sConn(context.Background(), connName, false)
+		if err != nil {
+			return err
+		}
+		connStatus := conn.DeriveConnStatus()
+		if connStatus.Status != k8s.Status_Connected {
+			return fmt.Errorf("not connected: %s", connStatus.Status)
+		}
+		return nil
+	}
+	if docker.IsContainerConnName(connName) {
+		conn, err := docker.GetContainerConn(context.Background(), connName, false)
+		if err != nil {
+			return err
+		}
+		connStatus := conn.DeriveConnStatus()
+		if connStatus.Status != docker.Status_Connected {
+			return fmt.Errorf("not connected: %s", connStatus.Status)
+		}
+		return nil
+	}
+	if telnet.IsTelnetConnName(connName) {
+		conn, err := telnet.GetTelnetConn(context.Background(), connName, false)
+		if err != nil {
+			return err
+		}
+		connStatus := conn.DeriveConnStatus()
+		if connStatus.Status != telnet.Status_Connected {
+			return fmt.Errorf("not connected: %s", connStatus.Status)
+		}
+		return nil
+	}
 	opts, err := remote.ParseOpts(connName)
 	if err != nil {
 		return fmt.Errorf("error parsing connection name: %w", err)
@@ -834,6 +957,38 @@ func getControllerList() []*BlockController {
 	return rtn
 }
 
+// returns (total controllers, controllers with a running shell proc) for the stats view
+func GetControllerCounts() (int, int) {
+	clist := getControllerList()
+	numRunning := 0
+	for _, bc := range clist {
+		if bc.GetRuntimeStatus().ShellProcStatus == Status_Running {
+			numRunning++
+		}
+	}
+	return len(clist), numRunning
+}
+
+// blocks that are in the middle of something (a running "cmd" block, or a shell with a command
+// running).  shells without shell integration can't be checked, so they count as idle.
+func GetBusyBlockIds() []string {
+	var rtn []string
+	for _, bc := range getControllerList() {
+		status := bc.GetRuntimeStatus()
+		if status.ShellProcStatus != Status_Running {
+			continue
+		}
+		if bc.ControllerType == BlockController_Cmd {
+			rtn = append(rtn, bc.BlockId)
+			continue
+		}
+		if info := GetShellIntegrationInfo(bc.BlockId); info != nil && info.InCommand {
+			rtn = append(rtn, bc.BlockId)
+		}
+	}
+	return rtn
+}
+
 func StopAllBlockControllers() {
 	clist := getControllerList()
 	for _, bc := range clist {
@@ -0,0 +1,413 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package blockcontroller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/wavetermdev/waveterm/pkg/audit"
+	"github.com/wavetermdev/waveterm/pkg/filestore"
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wstore"
+)
+
+// session recordings are asciicast v2 files (https://docs.asciinema.org/manual/asciicast/v2/)
+// stored as block files named "recording:<time>.cast".  the pty output of the block's shell
+// is recorded until the recording is stopped or the shell exits.  input (which can contain
+// passwords) is only recorded when asked for.
+
+const BlockFile_RecordingPrefix = "recording:"
+const RecordingMaxFileSize = 64 * 1024 * 1024
+
+const (
+	asciicastEvent_Output = "o"
+	asciicastEvent_Input  = "i"
+	asciicastEvent_Resize = "r"
+)
+
+type asciicastHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+type sessionRecorder struct {
+	Lock        *sync.Mutex
+	BlockId     string
+	FileName    string
+	Title       string
+	Connection  string
+	RecordInput bool
+	StartTime   time.Time
+	EndTime     time.Time
+	Size        int64
+	Done        bool
+	// pty reads can end in the middle of a utf-8 character, which is kept for the next event
+	PendingOutput []byte
+	PendingInput  []byte
+}
+
+// returns the complete utf-8 prefix of data (and the bytes of a trailing partial character)
+func splitPartialUtf8(data []byte) ([]byte, []byte) {
+	for i := 1; i <= utf8.UTFMax-1 && i <= len(data); i++ {
+		start := len(data) - i
+		if !utf8.RuneStart(data[start]) {
+			continue
+		}
+		if !utf8.FullRune(data[start:]) {
+			return data[:start], data[start:]
+		}
+		break
+	}
+	return data, nil
+}
+
+func (rec *sessionRecorder) writeEvent_nolock(eventType string, data string) {
+	if rec.Done {
+		return
+	}
+	elapsed := time.Since(rec.StartTime).Seconds()
+	dataJson, _ := json.Marshal(data)
+	line := fmt.Sprintf("[%.6f, %q, %s]\n", elapsed, eventType, dataJson)
+	if rec.Size+int64(len(line)) > RecordingMaxFileSize {
+		log.Printf("recording %s for block %s reached the max size, stopping\n", rec.FileName, rec.BlockId)
+		rec.finish_nolock()
+		return
+	}
+	ctx, cancelFn := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancelFn()
+	err := filestore.WFS.AppendData(ctx, rec.BlockId, rec.FileName, []byte(line))
+	if err != nil {
+		log.Printf("error writing recording %s for block %s: %v\n", rec.FileName, rec.BlockId, err)
+		return
+	}
+	rec.Size += int64(len(line))
+}
+
+func (rec *sessionRecorder) writeData(eventType string, data []byte) {
+	rec.Lock.Lock()
+	defer rec.Lock.Unlock()
+	pending := &rec.PendingOutput
+	if eventType == asciicastEvent_Input {
+		pending = &rec.PendingInput
+	}
+	data = append(*pending, data...)
+	data, *pending = splitPartialUtf8(data)
+	*pending = append([]byte(nil), *pending...)
+	if len(data) > 0 {
+		// invalid utf-8 is replaced by json.Marshal
+		rec.writeEvent_nolock(eventType, string(data))
+	}
+}
+
+func (rec *sessionRecorder) writeResize(termSize waveobj.TermSize) {
+	rec.Lock.Lock()
+	defer rec.Lock.Unlock()
+	rec.writeEvent_nolock(asciicastEvent_Resize, fmt.Sprintf("%dx%d", termSize.Cols, termSize.Rows))
+}
+
+func (rec *sessionRecorder) finish_nolock() {
+	if rec.Done {
+		return
+	}
+	rec.Done = true
+	rec.EndTime = time.Now()
+	ctx, cancelFn := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancelFn()
+	err := filestore.WFS.WriteMeta(ctx, rec.BlockId, rec.FileName, filestore.FileMeta{"endts": rec.EndTime.UnixMilli()}, true)
+	if err != nil {
+		log.Printf("error finishing recording %s for block %s: %v\n", rec.FileName, rec.BlockId, err)
+	}
+	audit.Record(audit.Event_RecordingStop, rec.Connection, "", fmt.Sprintf("block %s, %s (%d bytes)", rec.BlockId, rec.FileName, rec.Size))
+}
+
+func (rec *sessionRecorder) getInfo() wshrpc.RecordingInfo {
+	rec.Lock.Lock()
+	defer rec.Lock.Unlock()
+	rtn := wshrpc.RecordingInfo{
+		BlockId:     rec.BlockId,
+		FileName:    rec.FileName,
+		Title:       rec.Title,
+		Connection:  rec.Connection,
+		RecordInput: rec.RecordInput,
+		StartTs:     rec.StartTime.UnixMilli(),
+		Size:        rec.Size,
+		Active:      !rec.Done,
+	}
+	if rec.Done {
+		rtn.EndTs = rec.EndTime.UnixMilli()
+	}
+	return rtn
+}
+
+func (bc *BlockController) getRecorder() *sessionRecorder {
+	bc.Lock.Lock()
+	defer bc.Lock.Unlock()
+	return bc.Recorder
+}
+
+func (bc *BlockController) recordOutput(data []byte) {
+	if rec := bc.getRecorder(); rec != nil {
+		rec.writeData(asciicastEvent_Output, data)
+	}
+}
+
+func (bc *BlockController) recordInput(inputUnion *BlockInputUnion) {
+	rec := bc.getRecorder()
+	if rec == nil {
+		return
+	}
+	if len(inputUnion.InputData) > 0 && rec.RecordInput {
+		rec.writeData(asciicastEvent_Input, inputUnion.InputData)
+	}
+	if inputUnion.TermSize != nil {
+		rec.writeResize(*inputUnion.TermSize)
+	}
+}
+
+// StartRecording starts recording the block's terminal session.  the shell must be running, and
+// only one recording per block can be active.
+func StartRecording(ctx context.Context, data wshrpc.CommandRecordingStartData) (*wshrpc.RecordingInfo, error) {
+	bc := GetBlockController(data.BlockId)
+	if bc == nil || bc.ControllerType != BlockController_Shell {
+		return nil, fmt.Errorf("block %s is not a running terminal", data.BlockId)
+	}
+	var shellRunning bool
+	var existing *sessionRecorder
+	bc.WithLock(func() {
+		shellRunning = bc.ShellProc != nil && bc.ShellProcStatus == Status_Running
+		existing = bc.Recorder
+	})
+	if !shellRunning {
+		return nil, fmt.Errorf("block %s is not a running terminal", data.BlockId)
+	}
+	if existing != nil && existing.getInfo().Active {
+		return nil, fmt.Errorf("block %s is already being recorded (%s)", data.BlockId, existing.FileName)
+	}
+	block, err := wstore.DBMustGet[*waveobj.Block](ctx, data.BlockId)
+	if err != nil {
+		return nil, fmt.Errorf("error getting block: %w", err)
+	}
+	connName := block.Meta.GetString(waveobj.MetaKey_Connection, "")
+	startTime := time.Now()
+	title := data.Title
+	if title == "" {
+		displayConn := connName
+		if displayConn == "" {
+			displayConn = "local"
+		}
+		title = fmt.Sprintf("%s (%s)", displayConn, startTime.Format("2006-01-02 15:04:05"))
+	}
+	fileName := BlockFile_RecordingPrefix + startTime.Format("20060102-150405") + ".cast"
+	termSize := getTermSize(block)
+	header := asciicastHeader{
+		Version:   2,
+		Width:     termSize.Cols,
+		Height:    termSize.Rows,
+		Timestamp: startTime.Unix(),
+		Title:     title,
+		Env:       map[string]string{"TERM": "xterm-256color"},
+	}
+	headerJson, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	headerJson = append(headerJson, '\n')
+	fileMeta := filestore.FileMeta{
+		"title":       title,
+		"connection":  connName,
+		"startts":     startTime.UnixMilli(),
+		"recordinput": data.RecordInput,
+	}
+	err = filestore.WFS.MakeFile(ctx, data.BlockId, fileName, fileMeta, filestore.FileOptsType{MaxSize: RecordingMaxFileSize})
+	if err != nil {
+		return nil, fmt.Errorf("error creating recording file: %w", err)
+	}
+	err = filestore.WFS.AppendData(ctx, data.BlockId, fileName, headerJson)
+	if err != nil {
+		return nil, fmt.Errorf("error writing recording file: %w", err)
+	}
+	rec := &sessionRecorder{
+		Lock:        &sync.Mutex{},
+		BlockId:     data.BlockId,
+		FileName:    fileName,
+		Title:       title,
+		Connection:  connName,
+		RecordInput: data.RecordInput,
+		StartTime:   startTime,
+		Size:        int64(len(headerJson)),
+	}
+	bc.WithLock(func() {
+		bc.Recorder = rec
+	})
+	audit.Record(audit.Event_RecordingStart, connName, "", fmt.Sprintf("block %s, %s (input recorded: %v)", data.BlockId, fileName, data.RecordInput))
+	rtn := rec.getInfo()
+	return &rtn, nil
+}
+
+// StopRecording stops the block's active recording (if any)
+func StopRecording(blockId string) (*wshrpc.RecordingInfo, error) {
+	bc := GetBlockController(blockId)
+	if bc == nil {
+		return nil, fmt.Errorf("block %s is not being recorded", blockId)
+	}
+	var rec *sessionRecorder
+	bc.WithLock(func() {
+		rec = bc.Recorder
+		bc.Recorder = nil
+	})
+	if rec == nil {
+		return nil, fmt.Errorf("block %s is not being recorded", blockId)
+	}
+	rec.Lock.Lock()
+	wasDone := rec.Done
+	rec.finish_nolock()
+	rec.Lock.Unlock()
+	if wasDone {
+		return nil, fmt.Errorf("block %s is not being recorded", blockId)
+	}
+	rtn := rec.getInfo()
+	return &rtn, nil
+}
+
+// called when the shell exits
+func (bc *BlockController) finishRecording() {
+	var rec *sessionRecorder
+	bc.WithLock(func() {
+		rec = bc.Recorder
+		bc.Recorder = nil
+	})
+	if rec == nil {
+		return
+	}
+	rec.Lock.Lock()
+	defer rec.Lock.Unlock()
+	rec.finish_nolock()
+}
+
+// file meta read back from the db is decoded json, so numbers are float64
+func metaInt64(meta filestore.FileMeta, key string) int64 {
+	switch val := meta[key].(type) {
+	case int64:
+		return val
+	case float64:
+		return int64(val)
+	}
+	return 0
+}
+
+func recordingInfoFromFile(file *filestore.WaveFile) wshrpc.RecordingInfo {
+	rtn := wshrpc.RecordingInfo{
+		BlockId:  file.ZoneId,
+		FileName: file.Name,
+		Size:     file.Size,
+	}
+	if title, ok := file.Meta["title"].(string); ok {
+		rtn.Title = title
+	}
+	if connName, ok := file.Meta["connection"].(string); ok {
+		rtn.Connection = connName
+	}
+	if recordInput, ok := file.Meta["recordinput"].(bool); ok {
+		rtn.RecordInput = recordInput
+	}
+	rtn.StartTs = metaInt64(file.Meta, "startts")
+	rtn.EndTs = metaInt64(file.Meta, "endts")
+	if rtn.StartTs == 0 {
+		rtn.StartTs = file.CreatedTs
+	}
+	return rtn
+}
+
+// ListRecordings returns the block's recordings, oldest first
+func ListRecordings(ctx context.Context, blockId string) ([]wshrpc.RecordingInfo, error) {
+	files, err := filestore.WFS.ListFiles(ctx, blockId)
+	if err != nil {
+		return nil, fmt.Errorf("error listing block files: %w", err)
+	}
+	var active *sessionRecorder
+	if bc := GetBlockController(blockId); bc != nil {
+		active = bc.getRecorder()
+	}
+	rtn := make([]wshrpc.RecordingInfo, 0)
+	for _, file := range files {
+		if !strings.HasPrefix(file.Name, BlockFile_RecordingPrefix) {
+			continue
+		}
+		if active != nil && active.FileName == file.Name {
+			rtn = append(rtn, active.getInfo())
+			continue
+		}
+		rtn = append(rtn, recordingInfoFromFile(file))
+	}
+	sort.Slice(rtn, func(i, j int) bool {
+		return rtn[i].StartTs < rtn[j].StartTs
+	})
+	return rtn, nil
+}
+
+// ExportRecording writes a recording (the latest one if fileName is empty) to destPath, which
+// defaults to a file in the temp dir.  returns the path it was written to.
+func ExportRecording(ctx context.Context, data wshrpc.CommandRecordingExportData) (string, error) {
+	fileName := data.FileName
+	if fileName == "" {
+		recordings, err := ListRecordings(ctx, data.BlockId)
+		if err != nil {
+			return "", err
+		}
+		if len(recordings) == 0 {
+			return "", fmt.Errorf("block %s has no recordings", data.BlockId)
+		}
+		fileName = recordings[len(recordings)-1].FileName
+	}
+	if !strings.HasPrefix(fileName, BlockFile_RecordingPrefix) {
+		fileName = BlockFile_RecordingPrefix + fileName
+	}
+	_, castData, err := filestore.WFS.ReadFile(ctx, data.BlockId, fileName)
+	if err == fs.ErrNotExist {
+		return "", fmt.Errorf("recording %q not found", fileName)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading recording: %w", err)
+	}
+	destPath := data.Path
+	if destPath == "" {
+		destPath = filepath.Join(os.TempDir(), fmt.Sprintf("wave-%s-%s", shortBlockId(data.BlockId), strings.TrimPrefix(fileName, BlockFile_RecordingPrefix)))
+	}
+	destPath, err = wavebase.ExpandHomeDir(destPath)
+	if err != nil {
+		return "", err
+	}
+	if fileInfo, err := os.Stat(destPath); err == nil && fileInfo.IsDir() {
+		destPath = filepath.Join(destPath, strings.TrimPrefix(fileName, BlockFile_RecordingPrefix))
+	}
+	err = os.WriteFile(destPath, castData, 0600)
+	if err != nil {
+		return "", fmt.Errorf("error writing %s: %w", destPath, err)
+	}
+	return destPath, nil
+}
+
+func shortBlockId(blockId string) string {
+	if len(blockId) > 8 {
+		return blockId[:8]
+	}
+	return blockId
+}
@@ -0,0 +1,30 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package blockcontroller
+
+import (
+	"testing"
+)
+
+func TestSplitPartialUtf8(t *testing.T) {
+	euro := []byte("€") // 3 bytes
+	tests := []struct {
+		data     []byte
+		complete string
+		partial  string
+	}{
+		{[]byte("hello"), "hello", ""},
+		{append([]byte("a"), euro...), "a€", ""},
+		{append([]byte("a"), euro[:1]...), "a", string(euro[:1])},
+		{append([]byte("a"), euro[:2]...), "a", string(euro[:2])},
+		{[]byte{'a', 0xff}, "a\xff", ""}, // invalid bytes are not held back
+		{nil, "", ""},
+	}
+	for _, test := range tests {
+		complete, partial := splitPartialUtf8(test.data)
+		if string(complete) != test.complete || string(partial) != test.partial {
+			t.Errorf("splitPartialUtf8(%q) = %q, %q", test.data, complete, partial)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package blockcontroller
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+// tracks the shell integration escape sequences emitted by our rc files (OSC 133 semantic
+// prompts, and OSC 7 for the cwd) so the backend knows the last command, its output, and
+// its exit code without having to parse the terminal screen.
+//
+//	OSC 133;A;shell=zsh;os=Linux  -- prompt start
+//	OSC 133;C;cmdline=...         -- command started (output follows)
+//	OSC 133;D;exitcode;cmdline=... -- command finished
+//	OSC 7;file://host/path        -- current directory
+
+const ShellIntegrationMaxOutput = 32 * 1024
+const ShellIntegrationMaxHistory = 50
+const shellIntegrationMaxOscLen = 4096
+
+const (
+	siMode_Normal = iota
+	siMode_Esc
+	siMode_Osc
+	siMode_OscEsc
+)
+
+type LastCommandInfo struct {
+	Command     string
+	Output      []byte // raw terminal output (includes escape sequences), only the tail is kept
+	Truncated   bool
+	ExitCode    int
+	HasExitCode bool
+	Ts          int64
+}
+
+type CommandHistoryEntry struct {
+	Command     string
+	ExitCode    int
+	HasExitCode bool
+	Ts          int64
+}
+
+type ShellIntegrationInfo struct {
+	Cwd         string
+	Shell       string
+	OS          string
+	InCommand   bool
+	NumPrompts  int
+	LastCommand *LastCommandInfo
+	History     []CommandHistoryEntry // oldest first
+}
+
+type ShellIntegration struct {
+	Lock          *sync.Mutex
+	mode          int
+	oscBuf        []byte
+	inCommand     bool
+	curCommand    string
+	curOutput     []byte
+	curTruncated  bool
+	info          ShellIntegrationInfo
+	doneCmds      []CommandHistoryEntry                     // finished while processing, passed to OnCommandDone
+	OnCommandDone func(cmd CommandHistoryEntry, cwd string) // called (without Lock held) when a command finishes
+}
+
+func MakeShellIntegration() *ShellIntegration {
+	return &ShellIntegration{Lock: &sync.Mutex{}}
+}
+
+func (si *ShellIntegration) GetInfo() ShellIntegrationInfo {
+	si.Lock.Lock()
+	defer si.Lock.Unlock()
+	rtn := si.info
+	rtn.InCommand = si.inCommand
+	if rtn.LastCommand != nil {
+		lastCmd := *rtn.LastCommand
+		rtn.LastCommand = &lastCmd
+	}
+	rtn.History = append([]CommandHistoryEntry(nil), rtn.History...)
+	return rtn
+}
+
+func (si *ShellIntegration) appendOutput(data []byte) {
+	if !si.inCommand || len(data) == 0 {
+		return
+	}
+	si.curOutput = append(si.curOutput, data...)
+	if len(si.curOutput) > ShellIntegrationMaxOutput {
+		si.curOutput = append([]byte(nil), si.curOutput[len(si.curOutput)-ShellIntegrationMaxOutput:]...)
+		si.curTruncated = true
+	}
+}
+
+// Process scans pty output.  sequences can be split across reads, the parser state is kept between calls.
+func (si *ShellIntegration) Process(data []byte) {
+	si.Lock.Lock()
+	si.processLocked(data)
+	doneCmds := si.doneCmds
+	si.doneCmds = nil
+	cwd := si.info.Cwd
+	si.Lock.Unlock()
+	if si.OnCommandDone != nil {
+		for _, cmd := range doneCmds {
+			si.OnCommandDone(cmd, cwd)
+		}
+	}
+}
+
+func (si *ShellIntegration) processLocked(data []byte) {
+	start := 0
+	for idx, ch := range data {
+		switch si.mode {
+		case siMode_Normal:
+			if ch == wshutil.ESC {
+				si.appendOutput(data[start:idx])
+				si.mode = siMode_Esc
+			}
+		case siMode_Esc:
+			if ch == ']' {
+				si.mode = siMode_Osc
+				si.oscBuf = si.oscBuf[:0]
+				start = idx + 1
+			} else {
+				// not an OSC, it stays in the output
+				si.mode = siMode_Normal
+				start = idx - 1
+				if start < 0 {
+					si.appendOutput([]byte{wshutil.ESC})
+					start = 0
+				}
+			}
+		case siMode_Osc, siMode_OscEsc:
+			if ch == wshutil.BEL || (si.mode == siMode_OscEsc && ch == '\\') {
+				si.handleOsc(string(si.oscBuf))
+				si.mode = siMode_Normal
+				start = idx + 1
+				continue
+			}
+			if ch == wshutil.ESC {
+				si.mode = siMode_OscEsc
+				continue
+			}
+			si.mode = siMode_Osc
+			if len(si.oscBuf) < shellIntegrationMaxOscLen {
+				si.oscBuf = append(si.oscBuf, ch)
+			}
+			start = idx + 1
+		}
+	}
+	if si.mode == siMode_Normal {
+		si.appendOutput(data[start:])
+	}
+}
+
+func parseOscParams(params []string) map[string]string {
+	rtn := make(map[string]string)
+	for _, param := range params {
+		key, val, found := strings.Cut(param, "=")
+		if found {
+			rtn[key] = val
+		}
+	}
+	return rtn
+}
+
+func (si *ShellIntegration) handleOsc(osc string) {
+	if cwd, found := strings.CutPrefix(osc, "7;"); found {
+		if strings.HasPrefix(cwd, "file://") {
+			cwd = cwd[len("file://"):]
+			slashIdx := strings.Index(cwd, "/")
+			if slashIdx == -1 {
+				return
+			}
+			cwd = cwd[slashIdx:]
+		}
+		si.info.Cwd = cwd
+		return
+	}
+	semantic, found := strings.CutPrefix(osc, "133;")
+	if !found || semantic == "" {
+		return
+	}
+	// cmdline is always the last param (and can contain ";")
+	semantic, cmdLine, _ := strings.Cut(semantic, ";cmdline=")
+	fields := strings.Split(semantic, ";")
+	switch fields[0] {
+	case "A":
+		si.info.NumPrompts++
+		params := parseOscParams(fields[1:])
+		if params["shell"] != "" {
+			si.info.Shell = params["shell"]
+		}
+		if params["os"] != "" {
+			si.info.OS = params["os"]
+		}
+	case "C":
+		si.inCommand = true
+		si.curCommand = strings.TrimSpace(cmdLine)
+		si.curOutput = nil
+		si.curTruncated = false
+	case "D":
+		if !si.inCommand {
+			// prompt redrawn without a command being run
+			return
+		}
+		lastCmd := &LastCommandInfo{
+			Command:   si.curCommand,
+			Output:    bytes.Clone(si.curOutput),
+			Truncated: si.curTruncated,
+			Ts:        time.Now().UnixMilli(),
+		}
+		if len(fields) > 1 {
+			exitCode, err := strconv.Atoi(fields[1])
+			if err == nil {
+				lastCmd.ExitCode = exitCode
+				lastCmd.HasExitCode = true
+			}
+		}
+		if lastCmd.Command == "" {
+			lastCmd.Command = strings.TrimSpace(cmdLine)
+		}
+		si.info.LastCommand = lastCmd
+		if lastCmd.Command != "" {
+			entry := CommandHistoryEntry{
+				Command:     lastCmd.Command,
+				ExitCode:    lastCmd.ExitCode,
+				HasExitCode: lastCmd.HasExitCode,
+				Ts:          lastCmd.Ts,
+			}
+			si.info.History = append(si.info.History, entry)
+			si.doneCmds = append(si.doneCmds, entry)
+			if len(si.info.History) > ShellIntegrationMaxHistory {
+				si.info.History = si.info.History[len(si.info.History)-ShellIntegrationMaxHistory:]
+			}
+		}
+		si.inCommand = false
+		si.curCommand = ""
+		si.curOutput = nil
+		si.curTruncated = false
+	}
+}
+
+func GetShellIntegrationInfo(blockId string) *ShellIntegrationInfo {
+	bc := GetBlockController(blockId)
+	if bc == nil {
+		return nil
+	}
+	var si *ShellIntegration
+	bc.WithLock(func() {
+		si = bc.ShellIntegration
+	})
+	if si == nil {
+		return nil
+	}
+	info := si.GetInfo()
+	return &info
+}
@@ -0,0 +1,40 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package blockcontroller
+
+import (
+	"testing"
+)
+
+func TestShellIntegration(t *testing.T) {
+	si := MakeShellIntegration()
+	chunks := []string{
+		"\x1b]7;file://host/home/me\x07\x1b]133;A;shell=zsh;os=Linux\x07$ ",
+		"ls\r\n\x1b]133;C;cmdline=ls; echo hi\x07\x1b[1mfile1\x1b[0m\r\n",
+		"file2\r\n\x1b]13",
+		"3;D;2\x07\x1b]133;A\x07$ ",
+	}
+	for _, chunk := range chunks {
+		si.Process([]byte(chunk))
+	}
+	info := si.GetInfo()
+	if info.Cwd != "/home/me" || info.Shell != "zsh" || info.OS != "Linux" {
+		t.Errorf("bad info: %+v", info)
+	}
+	lastCmd := info.LastCommand
+	if lastCmd == nil {
+		t.Fatalf("no last command")
+	}
+	if lastCmd.Command != "ls; echo hi" || !lastCmd.HasExitCode || lastCmd.ExitCode != 2 {
+		t.Errorf("bad last command: %+v", lastCmd)
+	}
+	if string(lastCmd.Output) != "\x1b[1mfile1\x1b[0m\r\nfile2\r\n" {
+		t.Errorf("bad output: %q", lastCmd.Output)
+	}
+	// a prompt without a command doesn't replace the last command
+	si.Process([]byte("\x1b]133;D;0;cmdline=ls\x07"))
+	if si.GetInfo().LastCommand.ExitCode != 2 {
+		t.Errorf("last command was replaced by an empty prompt")
+	}
+}
@@ -0,0 +1,336 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// builds diagnostic bundles for bug reports.  a bundle is prepared in memory
+// (everything already sanitized) so the user can review its contents, and is
+// only written to disk once they confirm.
+package diagbundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wavetermdev/waveterm/pkg/filestore"
+	"github.com/wavetermdev/waveterm/pkg/remote/conncontroller"
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+	"github.com/wavetermdev/waveterm/pkg/wlog"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wstore"
+)
+
+const BundleExpiration = 10 * time.Minute
+const MaxLogBytes = 5 * 1024 * 1024 // only the tail of larger log files is included
+const MaxPendingBundles = 5
+
+type bundleEntry struct {
+	Item wshrpc.DiagBundleItem
+	Data []byte
+}
+
+type pendingBundle struct {
+	BundleId  string
+	Entries   []*bundleEntry
+	ExpiresTs time.Time
+}
+
+var pendingLock = &sync.Mutex{}
+var pendingBundles = make(map[string]*pendingBundle)
+
+type versionInfo struct {
+	Version   string `json:"version"`
+	BuildTime string `json:"buildtime"`
+	GoVersion string `json:"goversion"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	Lang      string `json:"lang,omitempty"`
+	CreatedTs int64  `json:"createdts"`
+}
+
+type connectionsInfo struct {
+	Status    []wshrpc.ConnStatus                   `json:"status"`
+	Timelines map[string][]wshrpc.ConnTimelineEvent `json:"timelines"`
+}
+
+type dbStats struct {
+	WaveObjCounts  map[string]int            `json:"waveobjcounts,omitempty"`
+	FileStore      *filestore.FileStoreStats `json:"filestore,omitempty"`
+	DBFileSizes    map[string]int64          `json:"dbfilesizes"`
+	WaveObjErr     string                    `json:"waveobjerr,omitempty"`
+	FileStoreError string                    `json:"filestoreerr,omitempty"`
+}
+
+func (b *pendingBundle) addJson(name string, desc string, val any, sanitize bool) error {
+	barr, err := json.Marshal(val)
+	if err != nil {
+		return fmt.Errorf("marshaling %s: %w", name, err)
+	}
+	numRedactions := 0
+	if sanitize {
+		var decoded any
+		err = json.Unmarshal(barr, &decoded)
+		if err != nil {
+			return fmt.Errorf("decoding %s: %w", name, err)
+		}
+		decoded, numRedactions = SanitizeValue(decoded)
+		val = decoded
+	}
+	barr, err = json.MarshalIndent(val, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling %s: %w", name, err)
+	}
+	b.addData(name, desc, barr, numRedactions)
+	return nil
+}
+
+func (b *pendingBundle) addData(name string, desc string, data []byte, numRedactions int) {
+	b.Entries = append(b.Entries, &bundleEntry{
+		Item: wshrpc.DiagBundleItem{
+			Name:        name,
+			Description: desc,
+			Size:        int64(len(data)),
+			Redactions:  numRedactions,
+		},
+		Data: data,
+	})
+}
+
+func readLogFile(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gzReader, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, err
+		}
+		defer gzReader.Close()
+		reader = gzReader
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxLogBytes {
+		data = data[len(data)-MaxLogBytes:]
+		if idx := bytes.IndexByte(data, '\n'); idx >= 0 {
+			data = data[idx+1:]
+		}
+	}
+	return data, nil
+}
+
+func (b *pendingBundle) addLogFile(path string) {
+	data, err := readLogFile(path)
+	if err != nil {
+		return
+	}
+	sanitized, numRedactions := SanitizeText(string(data))
+	name := "logs/" + strings.TrimSuffix(filepath.Base(path), ".gz")
+	b.addData(name, "log file (sanitized)", []byte(sanitized), numRedactions)
+}
+
+func getDBStats(ctx context.Context) *dbStats {
+	stats := &dbStats{DBFileSizes: make(map[string]int64)}
+	counts, err := wstore.DBGetTableCounts(ctx)
+	if err != nil {
+		stats.WaveObjErr = err.Error()
+	} else {
+		stats.WaveObjCounts = counts
+	}
+	fsStats, err := filestore.WFS.GetStats(ctx)
+	if err != nil {
+		stats.FileStoreError = err.Error()
+	} else {
+		stats.FileStore = &fsStats
+	}
+	dbDir := filepath.Join(wavebase.GetWaveDataDir(), wavebase.WaveDBDir)
+	entries, _ := os.ReadDir(dbDir)
+	for _, entry := range entries {
+		finfo, err := entry.Info()
+		if err != nil || entry.IsDir() {
+			continue
+		}
+		stats.DBFileSizes[entry.Name()] = finfo.Size()
+	}
+	return stats
+}
+
+// Prepare gathers (and sanitizes) everything for a new bundle.  nothing is written to disk.
+func Prepare(ctx context.Context) (*wshrpc.DiagBundleInfo, error) {
+	bundle := &pendingBundle{
+		BundleId:  uuid.New().String(),
+		ExpiresTs: time.Now().Add(BundleExpiration),
+	}
+	version := versionInfo{
+		Version:   wavebase.WaveVersion,
+		BuildTime: wavebase.BuildTime,
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		Lang:      wavebase.DetermineLang(),
+		CreatedTs: time.Now().UnixMilli(),
+	}
+	err := bundle.addJson("version.json", "wave version and platform", version, false)
+	if err != nil {
+		return nil, err
+	}
+	err = bundle.addJson("config.json", "settings and connections config (secrets redacted)", wconfig.ReadFullConfig(), true)
+	if err != nil {
+		return nil, err
+	}
+	conns := connectionsInfo{
+		Status:    conncontroller.GetAllConnStatus(),
+		Timelines: conncontroller.GetAllConnTimelines(),
+	}
+	err = bundle.addJson("connections.json", "connection status and status-change timelines", conns, true)
+	if err != nil {
+		return nil, err
+	}
+	err = bundle.addJson("dbstats.json", "database object counts and file sizes", getDBStats(ctx), false)
+	if err != nil {
+		return nil, err
+	}
+	if logFile := wlog.GetLogFile(); logFile != nil {
+		for _, path := range logFile.Paths() {
+			bundle.addLogFile(path)
+		}
+	}
+	bundle.addLogFile(filepath.Join(wavebase.GetWaveDataDir(), wavebase.WaveAppLogFileName))
+
+	pendingLock.Lock()
+	defer pendingLock.Unlock()
+	removeExpired_nolock()
+	pendingBundles[bundle.BundleId] = bundle
+	rtn := &wshrpc.DiagBundleInfo{
+		BundleId:  bundle.BundleId,
+		ExpiresTs: bundle.ExpiresTs.UnixMilli(),
+	}
+	for _, entry := range bundle.Entries {
+		rtn.Items = append(rtn.Items, entry.Item)
+	}
+	return rtn, nil
+}
+
+func removeExpired_nolock() {
+	now := time.Now()
+	for id, bundle := range pendingBundles {
+		if now.After(bundle.ExpiresTs) {
+			delete(pendingBundles, id)
+		}
+	}
+	// cap the memory held by bundles that were never written
+	for len(pendingBundles) >= MaxPendingBundles {
+		var oldest *pendingBundle
+		for _, bundle := range pendingBundles {
+			if oldest == nil || bundle.ExpiresTs.Before(oldest.ExpiresTs) {
+				oldest = bundle
+			}
+		}
+		delete(pendingBundles, oldest.BundleId)
+	}
+}
+
+func getBundle(bundleId string) (*pendingBundle, error) {
+	pendingLock.Lock()
+	defer pendingLock.Unlock()
+	removeExpired_nolock()
+	bundle := pendingBundles[bundleId]
+	if bundle == nil {
+		return nil, fmt.Errorf("diagnostic bundle %q not found (it may have expired)", bundleId)
+	}
+	return bundle, nil
+}
+
+// GetItem returns the (sanitized) contents of a single item for review
+func GetItem(bundleId string, name string) (string, error) {
+	bundle, err := getBundle(bundleId)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range bundle.Entries {
+		if entry.Item.Name == name {
+			return string(entry.Data), nil
+		}
+	}
+	var names []string
+	for _, entry := range bundle.Entries {
+		names = append(names, entry.Item.Name)
+	}
+	sort.Strings(names)
+	return "", fmt.Errorf("item %q not in bundle (items: %s)", name, strings.Join(names, ", "))
+}
+
+// Write writes a prepared bundle as a zip file and discards it from memory.
+// if destPath is empty the bundle is written to the temp dir.  returns the path.
+func Write(bundleId string, destPath string) (string, error) {
+	bundle, err := getBundle(bundleId)
+	if err != nil {
+		return "", err
+	}
+	if destPath == "" {
+		fileName := fmt.Sprintf("wavediag-%s.zip", time.Now().Format("20060102-150405"))
+		destPath = filepath.Join(os.TempDir(), fileName)
+	}
+	destPath, err = wavebase.ExpandHomeDir(destPath)
+	if err != nil {
+		return "", err
+	}
+	err = writeZip(destPath, bundle)
+	if err != nil {
+		os.Remove(destPath)
+		return "", err
+	}
+	pendingLock.Lock()
+	delete(pendingBundles, bundleId)
+	pendingLock.Unlock()
+	return destPath, nil
+}
+
+func writeZip(destPath string, bundle *pendingBundle) error {
+	err := os.MkdirAll(filepath.Dir(destPath), 0755)
+	if err != nil {
+		return err
+	}
+	outFile, err := os.OpenFile(destPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+	zipWriter := zip.NewWriter(outFile)
+	for _, entry := range bundle.Entries {
+		writer, err := zipWriter.CreateHeader(&zip.FileHeader{
+			Name:     entry.Item.Name,
+			Method:   zip.Deflate,
+			Modified: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(entry.Data)
+		if err != nil {
+			return err
+		}
+	}
+	err = zipWriter.Close()
+	if err != nil {
+		return err
+	}
+	return outFile.Close()
+}
@@ -0,0 +1,106 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package diagbundle
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+)
+
+const RedactedText = "[REDACTED]"
+
+// config keys (or key fragments) whose values are redacted ("tokens" is excluded for ai:maxtokens)
+var secretKeyRe = regexp.MustCompile(`(?i)(token(?:$|[^s])|password|passwd|passphrase|secret|apikey|api_key|credential|cookie|rememberedanswers)`)
+
+// "password=xyz", "token: xyz", "\"apitoken\":\"xyz\"" in free-form text (logs)
+var secretAssignRe = regexp.MustCompile(`(?i)((?:token|password|passwd|passphrase|secret|apikey|api_key|authorization)["']?\s*[:=]\s*["']?(?:bearer\s+)?)([^\s"',;]+)`)
+var bearerRe = regexp.MustCompile(`(?i)(bearer\s+)([A-Za-z0-9\-._~+/]+=*)`)
+
+// well known token formats (aws, github, gitlab, openai/anthropic, slack) and passwords in urls
+var knownTokenRe = regexp.MustCompile(`\b(?:AKIA[0-9A-Z]{16}|gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,}|glpat-[A-Za-z0-9_\-]{20,}|sk-[A-Za-z0-9_\-]{20,}|xox[abposr]-[A-Za-z0-9\-]{10,})\b`)
+var urlPasswordRe = regexp.MustCompile(`(://[^\s:/@]+:)([^\s@/]+)(@)`)
+var privateKeyRe = regexp.MustCompile(`(?s)-----BEGIN [A-Z ]*PRIVATE KEY-----.*?-----END [A-Z ]*PRIVATE KEY-----`)
+
+func isSecretKey(key string) bool {
+	return secretKeyRe.MatchString(key)
+}
+
+func isRedactable(val any) bool {
+	switch v := val.(type) {
+	case string:
+		return v != ""
+	case map[string]any:
+		return len(v) > 0
+	case []any:
+		return len(v) > 0
+	default:
+		return false
+	}
+}
+
+// SanitizeText redacts secrets and replaces the home directory with "~".
+// returns the sanitized text and the number of redactions.
+func SanitizeText(text string) (string, int) {
+	numRedactions := 0
+	text = privateKeyRe.ReplaceAllStringFunc(text, func(string) string {
+		numRedactions++
+		return RedactedText
+	})
+	text = secretAssignRe.ReplaceAllStringFunc(text, func(match string) string {
+		numRedactions++
+		return secretAssignRe.ReplaceAllString(match, "${1}"+RedactedText)
+	})
+	text = bearerRe.ReplaceAllStringFunc(text, func(match string) string {
+		numRedactions++
+		return bearerRe.ReplaceAllString(match, "${1}"+RedactedText)
+	})
+	text = knownTokenRe.ReplaceAllStringFunc(text, func(string) string {
+		numRedactions++
+		return RedactedText
+	})
+	text = urlPasswordRe.ReplaceAllStringFunc(text, func(match string) string {
+		numRedactions++
+		return urlPasswordRe.ReplaceAllString(match, "${1}"+RedactedText+"${3}")
+	})
+	homeDir := wavebase.GetHomeDir()
+	if homeDir != "" && homeDir != "/" {
+		text = strings.ReplaceAll(text, homeDir, "~")
+	}
+	return text, numRedactions
+}
+
+// SanitizeValue walks decoded json (maps, slices, strings) redacting values under
+// secret-looking keys and sanitizing all strings.  numbers and bools are kept (they
+// are settings like ssh:passwordauthentication, not secrets).  returns the number of redactions.
+func SanitizeValue(val any) (any, int) {
+	switch v := val.(type) {
+	case map[string]any:
+		total := 0
+		for key, subVal := range v {
+			if isSecretKey(key) && isRedactable(subVal) {
+				v[key] = RedactedText
+				total++
+				continue
+			}
+			newVal, num := SanitizeValue(subVal)
+			v[key] = newVal
+			total += num
+		}
+		return v, total
+	case []any:
+		total := 0
+		for idx, subVal := range v {
+			newVal, num := SanitizeValue(subVal)
+			v[idx] = newVal
+			total += num
+		}
+		return v, total
+	case string:
+		return SanitizeText(v)
+	default:
+		return val, 0
+	}
+}
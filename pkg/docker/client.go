@@ -0,0 +1,414 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// a minimal Docker Engine API client, which is also used for podman (its REST service has the
+// docker compatible api).  the daemon is found like the docker (or podman) cli does it, after the
+// connection's docker:host and the conn:dockerhost (or conn:podmanhost) setting: DOCKER_HOST (or
+// CONTAINER_HOST) as unix:// or tcp:// (with DOCKER_TLS_VERIFY and DOCKER_CERT_PATH for tls), or
+// the default unix socket.  windows named pipes are not supported (Docker Desktop can expose the
+// daemon on tcp://localhost:2375).
+
+const DefaultDockerSocket = "/var/run/docker.sock"
+const DefaultWindowsDockerHost = "npipe:////./pipe/docker_engine"
+const DefaultPodmanSocket = "/run/podman/podman.sock"
+const DefaultContainerdSocket = "/run/containerd/containerd.sock"
+const DockerApiVersion = "v1.41"
+const DockerApiTimeout = 15 * time.Second
+const dockerApiHost = "docker" // the host in request urls for unix sockets
+
+type dockerClient struct {
+	Runtime    string // Runtime_Docker or Runtime_Podman
+	Host       string // the daemon's address (for messages)
+	BaseUrl    string
+	DialFn     func(ctx context.Context) (net.Conn, error)
+	TLSConfig  *tls.Config // for tcp with tls
+	HttpClient *http.Client
+}
+
+// the fields of the container list that are used here
+type dockerContainerSummary struct {
+	Id     string   `json:"Id"`
+	Names  []string `json:"Names"`
+	Image  string   `json:"Image"`
+	State  string   `json:"State"`
+	Status string   `json:"Status"`
+}
+
+// the fields of a container's inspect that are used here
+type dockerContainerInspect struct {
+	Id    string `json:"Id"`
+	Name  string `json:"Name"`
+	State struct {
+		Running bool   `json:"Running"`
+		Status  string `json:"Status"`
+	} `json:"State"`
+}
+
+type dockerExecInspect struct {
+	Running  bool `json:"Running"`
+	ExitCode int  `json:"ExitCode"`
+}
+
+// the daemon address from the connection, the runtime's setting and environment, or its default
+// socket
+func findRuntimeHost(runtimeName string, connName string) string {
+	config := wconfig.ReadFullConfig()
+	if host := config.Connections[connName].DockerHost; host != "" {
+		return host
+	}
+	switch runtimeName {
+	case Runtime_Podman:
+		if host := config.Settings.ConnPodmanHost; host != "" {
+			return host
+		}
+		if host := os.Getenv("CONTAINER_HOST"); host != "" {
+			return host
+		}
+		return "unix://" + findPodmanSocket()
+	case Runtime_Containerd:
+		if host := config.Settings.ConnContainerdHost; host != "" {
+			return host
+		}
+		if host := os.Getenv("CONTAINER_RUNTIME_ENDPOINT"); host != "" {
+			return host
+		}
+		return "unix://" + DefaultContainerdSocket
+	case Runtime_Incus:
+		if host := config.Settings.ConnIncusHost; host != "" {
+			return host
+		}
+		return "unix://" + findIncusSocket(runtimeName)
+	case Runtime_Lxd:
+		if host := config.Settings.ConnLxdHost; host != "" {
+			return host
+		}
+		return "unix://" + findIncusSocket(runtimeName)
+	}
+	if host := config.Settings.ConnDockerHost; host != "" {
+		return host
+	}
+	if host := os.Getenv("DOCKER_HOST"); host != "" {
+		return host
+	}
+	if runtime.GOOS == "windows" {
+		return DefaultWindowsDockerHost
+	}
+	return "unix://" + DefaultDockerSocket
+}
+
+// the rootless socket (the user's podman.socket), the podman machine's socket on macos, or the
+// rootful socket
+func findPodmanSocket() string {
+	var candidates []string
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		candidates = append(candidates, filepath.Join(runtimeDir, "podman", "podman.sock"))
+	}
+	if homeDir, err := os.UserHomeDir(); err == nil && runtime.GOOS == "darwin" {
+		candidates = append(candidates, filepath.Join(homeDir, ".local", "share", "containers", "podman", "machine", "podman.sock"))
+	}
+	for _, candidate := range candidates {
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return DefaultPodmanSocket
+}
+
+func loadDockerTLSConfig(serverName string) (*tls.Config, error) {
+	certPath := os.Getenv("DOCKER_CERT_PATH")
+	if certPath == "" {
+		homeDir, _ := os.UserHomeDir()
+		certPath = filepath.Join(homeDir, ".docker")
+	}
+	tlsConfig := &tls.Config{ServerName: serverName}
+	caPem, err := os.ReadFile(filepath.Join(certPath, "ca.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("docker tls: %w", err)
+	}
+	tlsConfig.RootCAs = x509.NewCertPool()
+	if !tlsConfig.RootCAs.AppendCertsFromPEM(caPem) {
+		return nil, fmt.Errorf("docker tls: no certificates in %s", filepath.Join(certPath, "ca.pem"))
+	}
+	cert, err := tls.LoadX509KeyPair(filepath.Join(certPath, "cert.pem"), filepath.Join(certPath, "key.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("docker tls: %w", err)
+	}
+	tlsConfig.Certificates = []tls.Certificate{cert}
+	return tlsConfig, nil
+}
+
+func makeDockerClient(runtimeName string, host string) (*dockerClient, error) {
+	hostUrl, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s host %q: %w", runtimeName, host, err)
+	}
+	rtn := &dockerClient{Runtime: runtimeName, Host: host}
+	switch hostUrl.Scheme {
+	case "unix":
+		socketPath := hostUrl.Path
+		rtn.BaseUrl = "http://" + dockerApiHost + "/" + DockerApiVersion
+		rtn.DialFn = func(ctx context.Context) (net.Conn, error) {
+			d := net.Dialer{}
+			return d.DialContext(ctx, "unix", socketPath)
+		}
+	case "tcp":
+		addr := hostUrl.Host
+		scheme := "http"
+		if os.Getenv("DOCKER_TLS_VERIFY") != "" {
+			scheme = "https"
+			rtn.TLSConfig, err = loadDockerTLSConfig(hostUrl.Hostname())
+			if err != nil {
+				return nil, err
+			}
+		}
+		rtn.BaseUrl = scheme + "://" + addr + "/" + DockerApiVersion
+		rtn.DialFn = func(ctx context.Context) (net.Conn, error) {
+			d := net.Dialer{}
+			conn, err := d.DialContext(ctx, "tcp", addr)
+			if err != nil || rtn.TLSConfig == nil {
+				return conn, err
+			}
+			tlsConn := tls.Client(conn, rtn.TLSConfig)
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return tlsConn, nil
+		}
+	default:
+		return nil, fmt.Errorf("%s host %q is not supported (use unix:// or tcp://)", runtimeName, host)
+	}
+	rtn.HttpClient = &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return rtn.DialFn(ctx)
+			},
+			// tls is done by DialFn
+			DialTLSContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return rtn.DialFn(ctx)
+			},
+		},
+	}
+	return rtn, nil
+}
+
+func makeDockerApiError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var apiErr struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &apiErr); err == nil && apiErr.Message != "" {
+		return fmt.Errorf("%s: %s", resp.Status, apiErr.Message)
+	}
+	return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
+
+func (c *dockerClient) makeRequest(ctx context.Context, method string, path string, body any) (*http.Request, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		bodyBytes, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		bodyReader = bytes.NewReader(bodyBytes)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseUrl+path, bodyReader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// does an api request, decoding the json response into rtn (if not nil)
+func (c *dockerClient) doRequest(ctx context.Context, method string, path string, body any, rtn any) error {
+	ctx, cancelFn := context.WithTimeout(ctx, DockerApiTimeout)
+	defer cancelFn()
+	req, err := c.makeRequest(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	resp, err := c.HttpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot reach the %s daemon at %s: %w", c.Runtime, c.Host, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return makeDockerApiError(resp)
+	}
+	if rtn == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(rtn)
+}
+
+func (c *dockerClient) ping(ctx context.Context) error {
+	return c.doRequest(ctx, http.MethodGet, "/_ping", nil, nil)
+}
+
+func (c *dockerClient) listContainers(ctx context.Context) ([]dockerContainerSummary, error) {
+	var rtn []dockerContainerSummary
+	err := c.doRequest(ctx, http.MethodGet, "/containers/json", nil, &rtn)
+	return rtn, err
+}
+
+func (c *dockerClient) inspectContainer(ctx context.Context, container string) (*dockerContainerInspect, error) {
+	var rtn dockerContainerInspect
+	if err := c.doRequest(ctx, http.MethodGet, "/containers/"+url.PathEscape(container)+"/json", nil, &rtn); err != nil {
+		return nil, err
+	}
+	return &rtn, nil
+}
+
+func (c *dockerClient) findRunningContainer(ctx context.Context, container string) (string, error) {
+	info, err := c.inspectContainer(ctx, container)
+	if err != nil {
+		return "", fmt.Errorf("container %s: %w", container, err)
+	}
+	if !info.State.Running {
+		return "", fmt.Errorf("container %s is %s", container, info.State.Status)
+	}
+	return info.Id, nil
+}
+
+func (c *dockerClient) listRunningContainers(ctx context.Context) ([]wshrpc.ContainerInfo, error) {
+	containers, err := c.listContainers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var rtn []wshrpc.ContainerInfo
+	for _, container := range containers {
+		if container.State != "running" || len(container.Names) == 0 {
+			continue
+		}
+		name := strings.TrimPrefix(container.Names[0], "/")
+		rtn = append(rtn, wshrpc.ContainerInfo{
+			Connection: c.Runtime + "://" + name,
+			Runtime:    c.Runtime,
+			Id:         container.Id,
+			Name:       name,
+			Image:      container.Image,
+			Status:     container.Status,
+		})
+	}
+	return rtn, nil
+}
+
+func (c *dockerClient) execInContainer(ctx context.Context, containerId string, command []string, rows int, cols int, streamLostFn func()) (ExecStream, error) {
+	return openExec(ctx, c, containerId, command, rows, cols, streamLostFn)
+}
+
+func (c *dockerClient) createExec(ctx context.Context, container string, command []string, rows int, cols int) (string, error) {
+	body := map[string]any{
+		"AttachStdin":  true,
+		"AttachStdout": true,
+		"AttachStderr": true,
+		"Tty":          true,
+		"Cmd":          command,
+	}
+	if rows > 0 && cols > 0 {
+		body["ConsoleSize"] = []int{rows, cols}
+	}
+	var rtn struct {
+		Id string `json:"Id"`
+	}
+	if err := c.doRequest(ctx, http.MethodPost, "/containers/"+url.PathEscape(container)+"/exec", body, &rtn); err != nil {
+		return "", err
+	}
+	return rtn.Id, nil
+}
+
+func (c *dockerClient) resizeExec(ctx context.Context, execId string, rows int, cols int) error {
+	return c.doRequest(ctx, http.MethodPost, fmt.Sprintf("/exec/%s/resize?h=%d&w=%d", url.PathEscape(execId), rows, cols), nil, nil)
+}
+
+func (c *dockerClient) inspectExec(ctx context.Context, execId string) (*dockerExecInspect, error) {
+	var rtn dockerExecInspect
+	if err := c.doRequest(ctx, http.MethodGet, "/exec/"+url.PathEscape(execId)+"/json", nil, &rtn); err != nil {
+		return nil, err
+	}
+	return &rtn, nil
+}
+
+// a connection hijacked from the http request (reads go through the reader that read the response)
+type hijackedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *hijackedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// starts the exec, and returns its raw stream (with a tty, stdout and stderr are not multiplexed)
+func (c *dockerClient) startExec(ctx context.Context, execId string) (net.Conn, error) {
+	conn, err := c.DialFn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot reach the %s daemon at %s: %w", c.Runtime, c.Host, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stopFn := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	rtnConn, err := c.upgradeExecStart(conn, execId)
+	if !stopFn() && err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return rtnConn, nil
+}
+
+func (c *dockerClient) upgradeExecStart(conn net.Conn, execId string) (net.Conn, error) {
+	req, err := c.makeRequest(context.Background(), http.MethodPost, "/exec/"+url.PathEscape(execId)+"/start", map[string]any{"Detach": false, "Tty": true})
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+	if err := req.Write(conn); err != nil {
+		return nil, fmt.Errorf("starting exec: %w", err)
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return nil, fmt.Errorf("starting exec: %w", err)
+	}
+	// older daemons answer 200 and then stream
+	if resp.StatusCode != http.StatusSwitchingProtocols && resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, fmt.Errorf("starting exec: %w", makeDockerApiError(resp))
+	}
+	return &hijackedConn{Conn: conn, reader: reader}, nil
+}
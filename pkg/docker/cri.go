@@ -0,0 +1,366 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package docker
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/k8s"
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"golang.org/x/net/http2"
+)
+
+// a minimal client of the CRI RuntimeService (runtime.v1), which containerd serves on its socket.
+// the calls are grpc (http/2 without tls) with the few messages used here encoded by hand.  an
+// exec returns the url of the runtime's streaming server, which speaks the same websocket
+// protocol as a kubernetes exec.  only containers that containerd's CRI plugin knows about (the
+// k8s.io namespace) can be used.
+
+const criServicePath = "/runtime.v1.RuntimeService/"
+const criContainerState_Running = 1
+const criPodNameLabel = "io.kubernetes.pod.name"
+
+type criClient struct {
+	Host       string
+	HttpClient *http.Client
+}
+
+// the fields of a CRI Container that are used here
+type criContainer struct {
+	Id      string
+	Name    string // from its metadata (not unique, containers of different pods can share it)
+	Image   string
+	State   int
+	PodName string
+}
+
+func makeCriClient(host string) (*criClient, error) {
+	hostUrl, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid containerd host %q: %w", host, err)
+	}
+	if hostUrl.Scheme != "unix" {
+		return nil, fmt.Errorf("containerd host %q is not supported (use unix://)", host)
+	}
+	socketPath := hostUrl.Path
+	transport := &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, _, _ string, _ *tls.Config) (net.Conn, error) {
+			d := net.Dialer{}
+			return d.DialContext(ctx, "unix", socketPath)
+		},
+	}
+	return &criClient{Host: host, HttpClient: &http.Client{Transport: transport}}, nil
+}
+
+// calls a RuntimeService method, returning the response message
+func (c *criClient) call(ctx context.Context, method string, request []byte) ([]byte, error) {
+	ctx, cancelFn := context.WithTimeout(ctx, DockerApiTimeout)
+	defer cancelFn()
+	frame := make([]byte, 5, 5+len(request))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(request)))
+	frame = append(frame, request...)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost"+criServicePath+method, bytes.NewReader(frame))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	resp, err := c.HttpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot reach containerd at %s: %w", c.Host, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("containerd %s: %s", method, resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("containerd %s: %w", method, err)
+	}
+	// the status is in the trailers (or in the headers when there is no response)
+	grpcStatus := resp.Trailer.Get("Grpc-Status")
+	grpcMessage := resp.Trailer.Get("Grpc-Message")
+	if grpcStatus == "" {
+		grpcStatus = resp.Header.Get("Grpc-Status")
+		grpcMessage = resp.Header.Get("Grpc-Message")
+	}
+	if grpcStatus != "0" {
+		if message, err := url.PathUnescape(grpcMessage); err == nil {
+			grpcMessage = message
+		}
+		return nil, fmt.Errorf("containerd %s: %s (grpc status %s)", method, grpcMessage, grpcStatus)
+	}
+	if len(body) < 5 {
+		return nil, fmt.Errorf("containerd %s: no response", method)
+	}
+	if body[0] != 0 {
+		return nil, fmt.Errorf("containerd %s: compressed response", method)
+	}
+	msgLen := binary.BigEndian.Uint32(body[1:5])
+	if int(msgLen) > len(body)-5 {
+		return nil, fmt.Errorf("containerd %s: truncated response", method)
+	}
+	return body[5 : 5+msgLen], nil
+}
+
+func (c *criClient) ping(ctx context.Context) error {
+	_, err := c.call(ctx, "Version", nil)
+	return err
+}
+
+func (c *criClient) listContainers(ctx context.Context) ([]criContainer, error) {
+	// ListContainersRequest{filter: {state: {state: CONTAINER_RUNNING}}}
+	stateValue := appendProtoVarint(nil, 1, criContainerState_Running)
+	filter := appendProtoBytes(nil, 2, stateValue)
+	resp, err := c.call(ctx, "ListContainers", appendProtoBytes(nil, 1, filter))
+	if err != nil {
+		return nil, err
+	}
+	var rtn []criContainer
+	err = parseProtoFields(resp, func(field int, _ uint64, data []byte) error {
+		if field != 1 {
+			return nil
+		}
+		container, err := parseCriContainer(data)
+		if err != nil {
+			return err
+		}
+		rtn = append(rtn, container)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("containerd ListContainers: %w", err)
+	}
+	return rtn, nil
+}
+
+func parseCriContainer(msg []byte) (criContainer, error) {
+	var rtn criContainer
+	err := parseProtoFields(msg, func(field int, varint uint64, data []byte) error {
+		switch field {
+		case 1:
+			rtn.Id = string(data)
+		case 3: // metadata
+			return parseProtoFields(data, func(field int, _ uint64, data []byte) error {
+				if field == 1 {
+					rtn.Name = string(data)
+				}
+				return nil
+			})
+		case 4: // image spec
+			return parseProtoFields(data, func(field int, _ uint64, data []byte) error {
+				if field == 1 {
+					rtn.Image = string(data)
+				}
+				return nil
+			})
+		case 6:
+			rtn.State = int(varint)
+		case 8: // labels (map entries)
+			var key, value string
+			err := parseProtoFields(data, func(field int, _ uint64, data []byte) error {
+				if field == 1 {
+					key = string(data)
+				} else if field == 2 {
+					value = string(data)
+				}
+				return nil
+			})
+			if key == criPodNameLabel {
+				rtn.PodName = value
+			}
+			return err
+		}
+		return nil
+	})
+	return rtn, err
+}
+
+// the container by its id, a prefix of its id, or its (unique) name
+func (c *criClient) findRunningContainer(ctx context.Context, container string) (string, error) {
+	containers, err := c.listContainers(ctx)
+	if err != nil {
+		return "", err
+	}
+	var matches []criContainer
+	for _, criContainer := range containers {
+		if criContainer.Id == container {
+			return criContainer.Id, nil
+		}
+		if strings.HasPrefix(criContainer.Id, container) || criContainer.Name == container {
+			matches = append(matches, criContainer)
+		}
+	}
+	if len(matches) == 0 {
+		return "", fmt.Errorf("no running container %s", container)
+	}
+	if len(matches) > 1 {
+		return "", fmt.Errorf("container %s is ambiguous (%d running containers match, use the container id)", container, len(matches))
+	}
+	return matches[0].Id, nil
+}
+
+func (c *criClient) listRunningContainers(ctx context.Context) ([]wshrpc.ContainerInfo, error) {
+	containers, err := c.listContainers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]int)
+	for _, container := range containers {
+		names[container.Name]++
+	}
+	var rtn []wshrpc.ContainerInfo
+	for _, container := range containers {
+		connName := container.Name
+		if names[container.Name] > 1 {
+			connName = container.Id[:min(len(container.Id), 12)]
+		}
+		var status string
+		if container.PodName != "" {
+			status = "pod " + container.PodName
+		}
+		rtn = append(rtn, wshrpc.ContainerInfo{
+			Connection: Runtime_Containerd + "://" + connName,
+			Runtime:    Runtime_Containerd,
+			Id:         container.Id,
+			Name:       container.Name,
+			Image:      container.Image,
+			Status:     status,
+		})
+	}
+	return rtn, nil
+}
+
+// the streaming url of an exec
+func (c *criClient) exec(ctx context.Context, containerId string, command []string) (string, error) {
+	// ExecRequest{container_id, cmd, tty, stdin, stdout} (with a tty, there is no stderr)
+	req := appendProtoString(nil, 1, containerId)
+	for _, arg := range command {
+		req = appendProtoString(req, 2, arg)
+	}
+	req = appendProtoVarint(req, 3, 1)
+	req = appendProtoVarint(req, 4, 1)
+	req = appendProtoVarint(req, 5, 1)
+	resp, err := c.call(ctx, "Exec", req)
+	if err != nil {
+		return "", err
+	}
+	var execUrl string
+	err = parseProtoFields(resp, func(field int, _ uint64, data []byte) error {
+		if field == 1 {
+			execUrl = string(data)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("containerd Exec: %w", err)
+	}
+	if execUrl == "" {
+		return "", errors.New("containerd Exec: no streaming url")
+	}
+	return execUrl, nil
+}
+
+func (c *criClient) execInContainer(ctx context.Context, containerId string, command []string, rows int, cols int, streamLostFn func()) (ExecStream, error) {
+	execUrl, err := c.exec(ctx, containerId, command)
+	if err != nil {
+		return nil, err
+	}
+	wsUrl := strings.Replace(execUrl, "http", "ws", 1)
+	session, err := k8s.DialExec(ctx, wsUrl, nil, nil, rows, cols)
+	if err != nil {
+		return nil, fmt.Errorf("containerd exec stream: %w", err)
+	}
+	// the streaming server ends the stream with the exit status, an error without one can be a
+	// lost runtime (the connection checks it)
+	go func() {
+		defer panichandler.PanicHandler("docker:criClient:waitExec")
+		if session.Wait() != nil && streamLostFn != nil {
+			streamLostFn()
+		}
+	}()
+	return session, nil
+}
+
+// protobuf encoding, just enough for the CRI messages above
+
+func appendProtoTag(b []byte, field int, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+func appendProtoVarint(b []byte, field int, value uint64) []byte {
+	b = appendProtoTag(b, field, 0)
+	return binary.AppendUvarint(b, value)
+}
+
+func appendProtoBytes(b []byte, field int, value []byte) []byte {
+	b = appendProtoTag(b, field, 2)
+	b = binary.AppendUvarint(b, uint64(len(value)))
+	return append(b, value...)
+}
+
+func appendProtoString(b []byte, field int, value string) []byte {
+	return appendProtoBytes(b, field, []byte(value))
+}
+
+// calls fn with each field of msg (varint is set for varint fields, data for length delimited
+// ones, fixed size fields are skipped)
+func parseProtoFields(msg []byte, fn func(field int, varint uint64, data []byte) error) error {
+	for len(msg) > 0 {
+		tag, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return errors.New("bad protobuf tag")
+		}
+		msg = msg[n:]
+		field := int(tag >> 3)
+		var varint uint64
+		var data []byte
+		switch tag & 7 {
+		case 0:
+			varint, n = binary.Uvarint(msg)
+			if n <= 0 {
+				return errors.New("bad protobuf varint")
+			}
+			msg = msg[n:]
+		case 1:
+			if len(msg) < 8 {
+				return errors.New("truncated protobuf field")
+			}
+			msg = msg[8:]
+			continue
+		case 2:
+			dataLen, n := binary.Uvarint(msg)
+			if n <= 0 || dataLen > uint64(len(msg)-n) {
+				return errors.New("bad protobuf length")
+			}
+			data = msg[n : n+int(dataLen)]
+			msg = msg[n+int(dataLen):]
+		case 5:
+			if len(msg) < 4 {
+				return errors.New("truncated protobuf field")
+			}
+			msg = msg[4:]
+			continue
+		default:
+			return errors.New("unsupported protobuf wire type " + strconv.Itoa(int(tag&7)))
+		}
+		if err := fn(field, varint, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package docker
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/http2"
+)
+
+func makeCriContainerMsg(id string, name string, podName string) []byte {
+	var msg []byte
+	msg = appendProtoString(msg, 1, id)
+	msg = appendProtoBytes(msg, 3, appendProtoString(nil, 1, name))
+	msg = appendProtoBytes(msg, 4, appendProtoString(nil, 1, "docker.io/library/nginx:latest"))
+	msg = appendProtoVarint(msg, 6, criContainerState_Running)
+	label := appendProtoString(appendProtoString(nil, 1, criPodNameLabel), 2, podName)
+	return appendProtoBytes(msg, 8, label)
+}
+
+// a fake RuntimeService, answering ListContainers and Exec (and recording the exec's command)
+func startFakeCri(t *testing.T, execCmd *[]string) *criClient {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		request := body[5:]
+		var resp []byte
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		switch strings.TrimPrefix(r.URL.Path, criServicePath) {
+		case "ListContainers":
+			resp = appendProtoBytes(resp, 1, makeCriContainerMsg("aaaa1111", "nginx", "web-0"))
+			resp = appendProtoBytes(resp, 1, makeCriContainerMsg("bbbb2222", "nginx", "web-1"))
+			resp = appendProtoBytes(resp, 1, makeCriContainerMsg("cccc3333", "sidecar", "web-0"))
+		case "Exec":
+			parseProtoFields(request, func(field int, _ uint64, data []byte) error {
+				if field == 2 {
+					*execCmd = append(*execCmd, string(data))
+				}
+				return nil
+			})
+			resp = appendProtoString(nil, 1, "http://127.0.0.1:1/exec/token")
+		default:
+			w.Header().Set("Grpc-Status", "12")
+			w.Header().Set("Grpc-Message", "unknown%20method")
+			return
+		}
+		frame := make([]byte, 5)
+		binary.BigEndian.PutUint32(frame[1:], uint32(len(resp)))
+		w.Write(append(frame, resp...))
+		w.Header().Set("Grpc-Status", "0")
+	})
+	socketPath := filepath.Join(t.TempDir(), "containerd.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go (&http2.Server{}).ServeConn(conn, &http2.ServeConnOpts{Handler: handler})
+		}
+	}()
+	client, err := makeCriClient("unix://" + socketPath)
+	if err != nil {
+		t.Fatalf("makeCriClient: %v", err)
+	}
+	return client
+}
+
+func TestCriContainers(t *testing.T) {
+	var execCmd []string
+	client := startFakeCri(t, &execCmd)
+	ctx := context.Background()
+	if err := client.ping(ctx); err == nil || !strings.Contains(err.Error(), "unknown method") {
+		t.Errorf("expected the grpc error, got %v", err)
+	}
+	containers, err := client.listRunningContainers(ctx)
+	if err != nil {
+		t.Fatalf("listRunningContainers: %v", err)
+	}
+	var connNames []string
+	for _, container := range containers {
+		connNames = append(connNames, container.Connection)
+	}
+	// the names that are not unique are listed by id
+	expected := "containerd://aaaa1111 containerd://bbbb2222 containerd://sidecar"
+	if strings.Join(connNames, " ") != expected {
+		t.Errorf("connections %v, expected %s", connNames, expected)
+	}
+	if containers[2].Status != "pod web-0" || containers[2].Image != "docker.io/library/nginx:latest" {
+		t.Errorf("unexpected container %+v", containers[2])
+	}
+	if id, err := client.findRunningContainer(ctx, "sidecar"); err != nil || id != "cccc3333" {
+		t.Errorf("sidecar: %q, %v", id, err)
+	}
+	if id, err := client.findRunningContainer(ctx, "bbbb"); err != nil || id != "bbbb2222" {
+		t.Errorf("id prefix: %q, %v", id, err)
+	}
+	if _, err := client.findRunningContainer(ctx, "nginx"); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Errorf("expected an ambiguous name error, got %v", err)
+	}
+	execUrl, err := client.exec(ctx, "cccc3333", []string{"/bin/sh", "-c", "echo hi"})
+	if err != nil || execUrl != "http://127.0.0.1:1/exec/token" {
+		t.Errorf("exec: %q, %v", execUrl, err)
+	}
+	if strings.Join(execCmd, " ") != "/bin/sh -c echo hi" {
+		t.Errorf("exec command %v", execCmd)
+	}
+}
@@ -0,0 +1,412 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// connections to containers of docker (docker://container), podman (podman://container),
+// containerd's CRI (containerd://container), and to incus and lxd instances (incus://instance,
+// lxd://instance), by name or id.  connecting checks the runtime and the
+// container, and each shell is a new exec in the container.  wsh is not installed in containers.
+// when an exec's stream is lost and the runtime can't be reached, the connection is marked
+// disconnected and reconnects once the runtime answers again (running shells have to be
+// restarted, none of the runtimes can attach to an exec again).
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/telemetry"
+	"github.com/wavetermdev/waveterm/pkg/wps"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const (
+	Runtime_Docker     = "docker"
+	Runtime_Podman     = "podman"
+	Runtime_Containerd = "containerd"
+	Runtime_Incus      = "incus"
+	Runtime_Lxd        = "lxd"
+)
+
+var AllRuntimes = []string{Runtime_Docker, Runtime_Podman, Runtime_Containerd, Runtime_Incus, Runtime_Lxd}
+
+const ReconnectPollInterval = 2 * time.Second
+const ReconnectTimeout = 5 * time.Minute
+
+const (
+	Status_Init         = "init"
+	Status_Connecting   = "connecting"
+	Status_Connected    = "connected"
+	Status_Disconnected = "disconnected"
+	Status_Error        = "error"
+)
+
+var globalLock = &sync.Mutex{}
+var clientControllerMap = make(map[string]*ContainerConn)
+var activeConnCounter = &atomic.Int32{}
+
+// a command exec'd in a container with a tty
+type ExecStream interface {
+	io.ReadWriteCloser
+	Resize(rows int, cols int) error
+	Wait() error
+	ExitCode() int
+}
+
+// the api of a container runtime
+type containerRuntime interface {
+	ping(ctx context.Context) error
+	// the id of the container (which has to be running)
+	findRunningContainer(ctx context.Context, container string) (string, error)
+	listRunningContainers(ctx context.Context) ([]wshrpc.ContainerInfo, error)
+	// streamLostFn is called when the exec's stream is lost while the command still runs
+	execInContainer(ctx context.Context, containerId string, command []string, rows int, cols int, streamLostFn func()) (ExecStream, error)
+}
+
+type ContainerConn struct {
+	Lock            *sync.Mutex
+	Status          string
+	Runtime         string
+	Name            string // the container's name or id (as given)
+	Client          containerRuntime
+	ContainerId     string
+	Error           string
+	LastConnectTime int64
+	ActiveConnNum   int
+	Reconnecting    bool
+}
+
+func IsContainerConnName(connName string) bool {
+	runtimeName, _ := parseConnName(connName)
+	return runtimeName != ""
+}
+
+// the runtime and the container of a connection name (an empty runtime if it is not a container
+// connection)
+func parseConnName(connName string) (string, string) {
+	for _, runtimeName := range AllRuntimes {
+		if container, ok := strings.CutPrefix(connName, runtimeName+"://"); ok {
+			return runtimeName, container
+		}
+	}
+	return "", ""
+}
+
+func makeRuntimeClient(runtimeName string, host string) (containerRuntime, error) {
+	switch runtimeName {
+	case Runtime_Containerd:
+		return makeCriClient(host)
+	case Runtime_Incus, Runtime_Lxd:
+		return makeIncusClient(runtimeName, host)
+	}
+	return makeDockerClient(runtimeName, host)
+}
+
+func GetAllConnStatus() []wshrpc.ConnStatus {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+
+	var connStatuses []wshrpc.ConnStatus
+	for _, conn := range clientControllerMap {
+		connStatuses = append(connStatuses, conn.DeriveConnStatus())
+	}
+	return connStatuses
+}
+
+func (conn *ContainerConn) DeriveConnStatus() wshrpc.ConnStatus {
+	conn.Lock.Lock()
+	defer conn.Lock.Unlock()
+	return wshrpc.ConnStatus{
+		Status:        conn.Status,
+		Connected:     conn.Status == Status_Connected,
+		WshEnabled:    false,
+		Connection:    conn.GetName(),
+		HasConnected:  (conn.LastConnectTime > 0),
+		ActiveConnNum: conn.ActiveConnNum,
+		Error:         conn.Error,
+	}
+}
+
+func (conn *ContainerConn) FireConnChangeEvent() {
+	status := conn.DeriveConnStatus()
+	event := wps.WaveEvent{
+		Event: wps.Event_ConnChange,
+		Scopes: []string{
+			fmt.Sprintf("connection:%s", conn.GetName()),
+		},
+		Data: status,
+	}
+	log.Printf("sending event: %+#v", event)
+	wps.Broker.Publish(event)
+}
+
+func (conn *ContainerConn) GetName() string {
+	// no lock required because the name is immutable
+	return conn.Runtime + "://" + conn.Name
+}
+
+func (conn *ContainerConn) GetStatus() string {
+	conn.Lock.Lock()
+	defer conn.Lock.Unlock()
+	return conn.Status
+}
+
+func (conn *ContainerConn) WithLock(fn func()) {
+	conn.Lock.Lock()
+	defer conn.Lock.Unlock()
+	fn()
+}
+
+// running shells are not closed (they are separate execs), but new ones need a reconnect
+func (conn *ContainerConn) Close() error {
+	defer conn.FireConnChangeEvent()
+	conn.WithLock(func() {
+		if conn.Status == Status_Connected || conn.Status == Status_Connecting {
+			conn.Status = Status_Disconnected
+		}
+		conn.Client = nil
+		conn.Reconnecting = false
+	})
+	return nil
+}
+
+func (conn *ContainerConn) Connect(ctx context.Context) error {
+	var connectAllowed bool
+	conn.WithLock(func() {
+		if conn.Status == Status_Connecting || conn.Status == Status_Connected {
+			connectAllowed = false
+		} else {
+			conn.Status = Status_Connecting
+			conn.Error = ""
+			connectAllowed = true
+		}
+	})
+	log.Printf("Connect %s\n", conn.GetName())
+	if !connectAllowed {
+		return fmt.Errorf("cannot connect to %q when status is %q", conn.GetName(), conn.GetStatus())
+	}
+	conn.FireConnChangeEvent()
+	client, containerId, err := conn.connectInternal(ctx)
+	conn.WithLock(func() {
+		if err != nil {
+			conn.Status = Status_Error
+			conn.Error = err.Error()
+			telemetry.GoUpdateActivityWrap(wshrpc.ActivityUpdate{
+				Conn: map[string]int{conn.Runtime + ":connecterror": 1},
+			}, "container-connconnect")
+		} else {
+			conn.Status = Status_Connected
+			conn.Client = client
+			conn.ContainerId = containerId
+			conn.LastConnectTime = time.Now().UnixMilli()
+			if conn.ActiveConnNum == 0 {
+				conn.ActiveConnNum = int(activeConnCounter.Add(1))
+			}
+			telemetry.GoUpdateActivityWrap(wshrpc.ActivityUpdate{
+				Conn: map[string]int{conn.Runtime + ":connect": 1},
+			}, "container-connconnect")
+		}
+	})
+	conn.FireConnChangeEvent()
+	return err
+}
+
+func (conn *ContainerConn) WaitForConnect(ctx context.Context) error {
+	for {
+		status := conn.DeriveConnStatus()
+		switch status.Status {
+		case Status_Connected:
+			return nil
+		case Status_Connecting:
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("context timeout")
+			case <-time.After(100 * time.Millisecond):
+			}
+		case Status_Error:
+			return fmt.Errorf("error: %v", status.Error)
+		default:
+			return fmt.Errorf("disconnected")
+		}
+	}
+}
+
+// checks the runtime and that the container is running
+func (conn *ContainerConn) connectInternal(ctx context.Context) (containerRuntime, string, error) {
+	client, err := makeRuntimeClient(conn.Runtime, findRuntimeHost(conn.Runtime, conn.GetName()))
+	if err != nil {
+		return nil, "", err
+	}
+	if err := client.ping(ctx); err != nil {
+		return nil, "", err
+	}
+	containerId, err := client.findRunningContainer(ctx, conn.Name)
+	if err != nil {
+		return nil, "", err
+	}
+	return client, containerId, nil
+}
+
+// starts command in the container with a tty of the given size
+func (conn *ContainerConn) StartExec(ctx context.Context, command []string, rows int, cols int) (ExecStream, error) {
+	var client containerRuntime
+	var containerId string
+	conn.WithLock(func() {
+		client = conn.Client
+		containerId = conn.ContainerId
+	})
+	if client == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+	return client.execInContainer(ctx, containerId, command, rows, cols, conn.handleStreamLost)
+}
+
+// called when an exec's stream is lost while its command runs.  if the runtime is gone, the
+// connection is marked disconnected and reconnects (in the background) once the runtime is back.
+func (conn *ContainerConn) handleStreamLost() {
+	var client containerRuntime
+	conn.WithLock(func() {
+		client = conn.Client
+	})
+	if client == nil {
+		return
+	}
+	ctx, cancelFn := context.WithTimeout(context.Background(), DockerApiTimeout)
+	defer cancelFn()
+	pingErr := client.ping(ctx)
+	if pingErr == nil {
+		return
+	}
+	var startReconnect bool
+	conn.WithLock(func() {
+		if conn.Status != Status_Connected {
+			return
+		}
+		conn.Status = Status_Disconnected
+		conn.Error = pingErr.Error()
+		conn.Client = nil
+		if !conn.Reconnecting {
+			conn.Reconnecting = true
+			startReconnect = true
+		}
+	})
+	conn.FireConnChangeEvent()
+	if startReconnect {
+		go func() {
+			defer panichandler.PanicHandler("docker:ContainerConn:reconnectLoop")
+			conn.reconnectLoop(client)
+		}()
+	}
+}
+
+// waits for the runtime to answer, then connects again (stops if the connection was closed or
+// connected in the meantime)
+func (conn *ContainerConn) reconnectLoop(client containerRuntime) {
+	defer conn.WithLock(func() {
+		conn.Reconnecting = false
+	})
+	deadline := time.Now().Add(ReconnectTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(ReconnectPollInterval)
+		var stillWanted bool
+		conn.WithLock(func() {
+			stillWanted = conn.Reconnecting && conn.Status == Status_Disconnected
+		})
+		if !stillWanted {
+			return
+		}
+		ctx, cancelFn := context.WithTimeout(context.Background(), DockerApiTimeout)
+		err := client.ping(ctx)
+		cancelFn()
+		if err != nil {
+			continue
+		}
+		ctx, cancelFn = context.WithTimeout(context.Background(), DockerApiTimeout)
+		err = conn.Connect(ctx)
+		cancelFn()
+		if err != nil {
+			log.Printf("container: reconnecting to %s: %v\n", conn.GetName(), err)
+		}
+		return
+	}
+}
+
+func getConnInternal(runtimeName string, name string) *ContainerConn {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+	connName := runtimeName + "://" + name
+	rtn := clientControllerMap[connName]
+	if rtn == nil {
+		rtn = &ContainerConn{Lock: &sync.Mutex{}, Status: Status_Init, Runtime: runtimeName, Name: name}
+		clientControllerMap[connName] = rtn
+	}
+	return rtn
+}
+
+// gets the connection for a docker://, podman://, containerd://, incus:// or lxd:// connection name
+func GetContainerConn(ctx context.Context, connName string, shouldConnect bool) (*ContainerConn, error) {
+	runtimeName, name := parseConnName(connName)
+	if runtimeName == "" || name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("invalid container connection %q (expected docker://, podman://, containerd://, incus:// or lxd:// and the container)", connName)
+	}
+	conn := getConnInternal(runtimeName, name)
+	if shouldConnect && conn.GetStatus() != Status_Connected {
+		conn.Connect(ctx)
+	}
+	return conn, nil
+}
+
+// Convenience function for ensuring a connection is established
+func EnsureConnection(ctx context.Context, connName string) error {
+	conn, err := GetContainerConn(ctx, connName, false)
+	if err != nil {
+		return err
+	}
+	connStatus := conn.DeriveConnStatus()
+	switch connStatus.Status {
+	case Status_Connected:
+		return nil
+	case Status_Connecting:
+		return conn.WaitForConnect(ctx)
+	case Status_Init, Status_Disconnected:
+		return conn.Connect(ctx)
+	case Status_Error:
+		return fmt.Errorf("connection error: %s", connStatus.Error)
+	default:
+		return fmt.Errorf("unknown connection status %q", connStatus.Status)
+	}
+}
+
+// the running containers of each runtime's default daemon (from its setting, environment or
+// default socket).  runtimes that can't be reached are skipped, the error is only returned when
+// none can be.
+func ListContainers(ctx context.Context) ([]wshrpc.ContainerInfo, error) {
+	var rtn []wshrpc.ContainerInfo
+	var firstErr error
+	var reached bool
+	for _, runtimeName := range AllRuntimes {
+		client, err := makeRuntimeClient(runtimeName, findRuntimeHost(runtimeName, ""))
+		var containers []wshrpc.ContainerInfo
+		if err == nil {
+			containers, err = client.listRunningContainers(ctx)
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		reached = true
+		rtn = append(rtn, containers...)
+	}
+	if !reached {
+		return nil, firstErr
+	}
+	return rtn, nil
+}
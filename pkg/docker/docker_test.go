@@ -0,0 +1,145 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// a fake daemon with one exec, that echoes its stdin until it reads "exit\n" (or until the test
+// drops the stream with the exec still running)
+type fakeDaemon struct {
+	lock       sync.Mutex
+	execBody   map[string]any
+	resizes    []string
+	running    atomic.Bool
+	dropStream bool
+}
+
+func (d *fakeDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/"+DockerApiVersion)
+	switch {
+	case path == "/containers/web/exec" && r.Method == http.MethodPost:
+		d.lock.Lock()
+		json.NewDecoder(r.Body).Decode(&d.execBody)
+		d.lock.Unlock()
+		w.Write([]byte(`{"Id":"exec1"}`))
+	case path == "/exec/exec1/start":
+		if r.Header.Get("Upgrade") != "tcp" {
+			http.Error(w, `{"message":"no upgrade"}`, http.StatusBadRequest)
+			return
+		}
+		io.Copy(io.Discard, r.Body)
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		d.running.Store(true)
+		buf.WriteString("HTTP/1.1 101 UPGRADED\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+		buf.Flush()
+		if d.dropStream {
+			return
+		}
+		line, _ := buf.ReadString('\n')
+		for line != "exit\n" && line != "" {
+			conn.Write([]byte("got " + line))
+			line, _ = buf.ReadString('\n')
+		}
+		d.running.Store(false)
+	case path == "/exec/exec1/resize":
+		d.lock.Lock()
+		d.resizes = append(d.resizes, r.URL.Query().Get("h")+"x"+r.URL.Query().Get("w"))
+		d.lock.Unlock()
+	case path == "/exec/exec1/json":
+		json.NewEncoder(w).Encode(dockerExecInspect{Running: d.running.Load(), ExitCode: 3})
+	default:
+		http.Error(w, `{"message":"not found"}`, http.StatusNotFound)
+	}
+}
+
+func startFakeDaemon(t *testing.T, daemon *fakeDaemon) *dockerClient {
+	socketPath := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := &http.Server{Handler: daemon}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	client, err := makeDockerClient(Runtime_Docker, "unix://"+socketPath)
+	if err != nil {
+		t.Fatalf("makeDockerClient: %v", err)
+	}
+	return client
+}
+
+func TestExecSession(t *testing.T) {
+	daemon := &fakeDaemon{}
+	client := startFakeDaemon(t, daemon)
+	ctx, cancelFn := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFn()
+	session, err := openExec(ctx, client, "web", []string{"/bin/sh"}, 24, 80, func() {
+		t.Errorf("stream reported lost")
+	})
+	if err != nil {
+		t.Fatalf("openExec: %v", err)
+	}
+	if daemon.execBody["Tty"] != true {
+		t.Errorf("exec was created without a tty: %v", daemon.execBody)
+	}
+	if _, err := session.Write([]byte("hello\n")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	out := make([]byte, len("got hello\n"))
+	if _, err := io.ReadFull(session, out); err != nil || string(out) != "got hello\n" {
+		t.Fatalf("read %q, %v", out, err)
+	}
+	if err := session.Resize(40, 120); err != nil {
+		t.Fatalf("resize: %v", err)
+	}
+	session.Write([]byte("exit\n"))
+	if err := session.Wait(); err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+	if session.ExitCode() != 3 {
+		t.Errorf("exit code %d, expected 3", session.ExitCode())
+	}
+	daemon.lock.Lock()
+	defer daemon.lock.Unlock()
+	if len(daemon.resizes) != 1 || daemon.resizes[0] != "40x120" {
+		t.Errorf("resizes %v", daemon.resizes)
+	}
+}
+
+func TestExecStreamLost(t *testing.T) {
+	daemon := &fakeDaemon{dropStream: true}
+	client := startFakeDaemon(t, daemon)
+	var lostCalled atomic.Bool
+	session, err := openExec(context.Background(), client, "web", []string{"/bin/sh"}, 0, 0, func() {
+		lostCalled.Store(true)
+	})
+	if err != nil {
+		t.Fatalf("openExec: %v", err)
+	}
+	if err := session.Wait(); err == nil || !strings.Contains(err.Error(), "lost the exec stream") {
+		t.Errorf("expected a lost stream error, got %v", err)
+	}
+	if !lostCalled.Load() {
+		t.Errorf("the connection was not told about the lost stream")
+	}
+	if session.ExitCode() != -1 {
+		t.Errorf("exit code %d, expected -1", session.ExitCode())
+	}
+}
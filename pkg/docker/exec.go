@@ -0,0 +1,136 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+)
+
+const execExitRetries = 10
+const execExitRetryWait = 50 * time.Millisecond
+
+// a command exec'd in a container with a tty.  the exec's stream is the hijacked connection of
+// its start request.  the engine api can't attach to an exec again, so when the stream is lost
+// while the command still runs, the session ends with an error (and the connection checks the
+// daemon, see ContainerConn.handleStreamLost).
+type ExecSession struct {
+	client       *dockerClient
+	execId       string
+	stream       net.Conn
+	outReader    *io.PipeReader
+	outWriter    *io.PipeWriter
+	doneCh       chan struct{}
+	exitCode     int          // set before doneCh is closed
+	waitErr      error        // set before doneCh is closed
+	closed       *atomic.Bool // set when the session was closed by us
+	streamLostFn func()
+}
+
+func openExec(ctx context.Context, client *dockerClient, container string, command []string, rows int, cols int, streamLostFn func()) (*ExecSession, error) {
+	execId, err := client.createExec(ctx, container, command, rows, cols)
+	if err != nil {
+		return nil, fmt.Errorf("creating exec: %w", err)
+	}
+	stream, err := client.startExec(ctx, execId)
+	if err != nil {
+		return nil, err
+	}
+	outReader, outWriter := io.Pipe()
+	session := &ExecSession{
+		client:       client,
+		execId:       execId,
+		stream:       stream,
+		outReader:    outReader,
+		outWriter:    outWriter,
+		doneCh:       make(chan struct{}),
+		exitCode:     -1,
+		closed:       &atomic.Bool{},
+		streamLostFn: streamLostFn,
+	}
+	go func() {
+		defer panichandler.PanicHandler("docker:ExecSession:readLoop")
+		session.readLoop()
+	}()
+	return session, nil
+}
+
+func (s *ExecSession) readLoop() {
+	_, copyErr := io.Copy(s.outWriter, s.stream)
+	closed := s.closed.Load()
+	exitCode := -1
+	var waitErr error
+	// the exit code comes from the exec's inspect (the stream ends when the command exits)
+	inspect, err := s.client.inspectExec(context.Background(), s.execId)
+	for retry := 0; err == nil && inspect.Running && copyErr == nil && !closed && retry < execExitRetries; retry++ {
+		// a clean end of the stream means the command exited, the daemon may not have updated the exec yet
+		time.Sleep(execExitRetryWait)
+		inspect, err = s.client.inspectExec(context.Background(), s.execId)
+	}
+	switch {
+	case err != nil:
+		waitErr = fmt.Errorf("cannot get the exit code: %w", err)
+	case inspect.Running && !closed:
+		waitErr = errors.New("lost the exec stream (the command is still running in the container, but it can't be attached again)")
+		if copyErr != nil {
+			waitErr = fmt.Errorf("lost the exec stream: %w (the command is still running in the container, but it can't be attached again)", copyErr)
+		}
+	case !inspect.Running:
+		exitCode = inspect.ExitCode
+	}
+	if waitErr != nil && !closed && s.streamLostFn != nil {
+		s.streamLostFn()
+	}
+	s.exitCode = exitCode
+	s.waitErr = waitErr
+	s.outWriter.Close()
+	close(s.doneCh)
+}
+
+// the command's output (with a tty, stdout and stderr together)
+func (s *ExecSession) Read(b []byte) (int, error) {
+	return s.outReader.Read(b)
+}
+
+// writes to the command's stdin
+func (s *ExecSession) Write(b []byte) (int, error) {
+	return s.stream.Write(b)
+}
+
+func (s *ExecSession) Resize(rows int, cols int) error {
+	return s.client.resizeExec(context.Background(), s.execId, rows, cols)
+}
+
+// closes the stream (the command gets a hangup from its tty)
+func (s *ExecSession) Close() error {
+	if s.closed.Swap(true) {
+		return nil
+	}
+	err := s.stream.Close()
+	s.outReader.Close()
+	return err
+}
+
+// waits for the command to finish (or the stream to be lost)
+func (s *ExecSession) Wait() error {
+	<-s.doneCh
+	return s.waitErr
+}
+
+// only valid once Wait() has returned (-1 if it is not known)
+func (s *ExecSession) ExitCode() int {
+	select {
+	case <-s.doneCh:
+		return s.exitCode
+	default:
+		return -1
+	}
+}
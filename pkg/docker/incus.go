@@ -0,0 +1,399 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/util/shellutil"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// a minimal client of the incus (and lxd, which has the same api) REST api on its unix socket.  an
+// exec is an operation with websockets: one for the terminal (binary messages both ways) and a
+// control one (for window resizes).  the exit code is in the operation once the command is done.
+// instances can be containers or virtual machines (exec in a vm needs its agent), only the
+// default project is used.
+
+const DefaultIncusSocket = "/var/lib/incus/unix.socket"
+const DefaultLxdSocket = "/var/lib/lxd/unix.socket"
+const DefaultLxdSnapSocket = "/var/snap/lxd/common/lxd/unix.socket"
+const incusApiHost = "incus" // the host in request urls (it is a unix socket)
+
+type incusClient struct {
+	Runtime    string // Runtime_Incus or Runtime_Lxd
+	Host       string
+	DialFn     func(ctx context.Context) (net.Conn, error)
+	HttpClient *http.Client
+}
+
+// the envelope of every api response
+type incusResponse struct {
+	Type     string          `json:"type"` // sync, async or error
+	Error    string          `json:"error"`
+	Metadata json.RawMessage `json:"metadata"`
+}
+
+// the fields of an instance that are used here
+type incusInstance struct {
+	Name   string            `json:"name"`
+	Status string            `json:"status"`
+	Type   string            `json:"type"`
+	Config map[string]string `json:"config"`
+}
+
+type incusOperation struct {
+	Id       string `json:"id"`
+	Status   string `json:"status"`
+	Err      string `json:"err"`
+	Metadata struct {
+		Fds    map[string]string `json:"fds"`
+		Return *int              `json:"return"`
+	} `json:"metadata"`
+}
+
+// the socket from the runtime's environment (INCUS_SOCKET or LXD_SOCKET, then INCUS_DIR or
+// LXD_DIR), or its default socket
+func findIncusSocket(runtimeName string) string {
+	envPrefix := "INCUS"
+	if runtimeName == Runtime_Lxd {
+		envPrefix = "LXD"
+	}
+	if socketPath := os.Getenv(envPrefix + "_SOCKET"); socketPath != "" {
+		return socketPath
+	}
+	if dir := os.Getenv(envPrefix + "_DIR"); dir != "" {
+		return strings.TrimSuffix(dir, "/") + "/unix.socket"
+	}
+	if runtimeName == Runtime_Incus {
+		return DefaultIncusSocket
+	}
+	// lxd is usually installed as a snap
+	if _, err := os.Stat(DefaultLxdSnapSocket); err == nil {
+		return DefaultLxdSnapSocket
+	}
+	return DefaultLxdSocket
+}
+
+func makeIncusClient(runtimeName string, host string) (*incusClient, error) {
+	hostUrl, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s host %q: %w", runtimeName, host, err)
+	}
+	if hostUrl.Scheme != "unix" {
+		return nil, fmt.Errorf("%s host %q is not supported (use unix://)", runtimeName, host)
+	}
+	socketPath := hostUrl.Path
+	rtn := &incusClient{Runtime: runtimeName, Host: host}
+	rtn.DialFn = func(ctx context.Context) (net.Conn, error) {
+		d := net.Dialer{}
+		return d.DialContext(ctx, "unix", socketPath)
+	}
+	rtn.HttpClient = &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return rtn.DialFn(ctx)
+			},
+		},
+	}
+	return rtn, nil
+}
+
+// does an api request, decoding the response's metadata into rtn (if not nil)
+func (c *incusClient) doRequest(ctx context.Context, method string, path string, body any, rtn any) error {
+	ctx, cancelFn := context.WithTimeout(ctx, DockerApiTimeout)
+	defer cancelFn()
+	var bodyReader io.Reader
+	if body != nil {
+		bodyBytes, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		bodyReader = bytes.NewReader(bodyBytes)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, "http://"+incusApiHost+path, bodyReader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.HttpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot reach %s at %s: %w", c.Runtime, c.Host, err)
+	}
+	defer resp.Body.Close()
+	var apiResp incusResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 16*1024*1024)).Decode(&apiResp); err != nil {
+		return fmt.Errorf("%s %s: %s (%v)", c.Runtime, path, resp.Status, err)
+	}
+	if apiResp.Type == "error" || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s: %s", resp.Status, apiResp.Error)
+	}
+	if rtn == nil {
+		return nil
+	}
+	return json.Unmarshal(apiResp.Metadata, rtn)
+}
+
+func (c *incusClient) ping(ctx context.Context) error {
+	return c.doRequest(ctx, http.MethodGet, "/1.0", nil, nil)
+}
+
+func (c *incusClient) findRunningContainer(ctx context.Context, container string) (string, error) {
+	var instance incusInstance
+	if err := c.doRequest(ctx, http.MethodGet, "/1.0/instances/"+url.PathEscape(container), nil, &instance); err != nil {
+		return "", fmt.Errorf("instance %s: %w", container, err)
+	}
+	if instance.Status != "Running" {
+		return "", fmt.Errorf("instance %s is %s", container, strings.ToLower(instance.Status))
+	}
+	// instances are only known by name
+	return instance.Name, nil
+}
+
+func (c *incusClient) listRunningContainers(ctx context.Context) ([]wshrpc.ContainerInfo, error) {
+	var instances []incusInstance
+	if err := c.doRequest(ctx, http.MethodGet, "/1.0/instances?recursion=1", nil, &instances); err != nil {
+		return nil, err
+	}
+	var rtn []wshrpc.ContainerInfo
+	for _, instance := range instances {
+		if instance.Status != "Running" {
+			continue
+		}
+		rtn = append(rtn, wshrpc.ContainerInfo{
+			Connection: c.Runtime + "://" + instance.Name,
+			Runtime:    c.Runtime,
+			Id:         instance.Name,
+			Name:       instance.Name,
+			Image:      instance.Config["image.description"],
+			Status:     instance.Type,
+		})
+	}
+	return rtn, nil
+}
+
+func (c *incusClient) dialWebsocket(ctx context.Context, operationId string, secret string) (*websocket.Conn, error) {
+	dialer := websocket.Dialer{
+		NetDialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return c.DialFn(ctx)
+		},
+		HandshakeTimeout: DockerApiTimeout,
+	}
+	wsUrl := fmt.Sprintf("ws://%s/1.0/operations/%s/websocket?secret=%s", incusApiHost, url.PathEscape(operationId), url.QueryEscape(secret))
+	ws, resp, err := dialer.DialContext(ctx, wsUrl, nil)
+	if resp != nil && resp.Body != nil {
+		resp.Body.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s exec stream: %w", c.Runtime, err)
+	}
+	return ws, nil
+}
+
+func (c *incusClient) getOperation(ctx context.Context, operationId string) (*incusOperation, error) {
+	var rtn incusOperation
+	if err := c.doRequest(ctx, http.MethodGet, "/1.0/operations/"+url.PathEscape(operationId), nil, &rtn); err != nil {
+		return nil, err
+	}
+	return &rtn, nil
+}
+
+func (c *incusClient) execInContainer(ctx context.Context, containerId string, command []string, rows int, cols int, streamLostFn func()) (ExecStream, error) {
+	body := map[string]any{
+		"command":            command,
+		"environment":        map[string]string{"TERM": shellutil.DefaultTermType},
+		"interactive":        true,
+		"wait-for-websocket": true,
+		"width":              cols,
+		"height":             rows,
+	}
+	var op incusOperation
+	if err := c.doRequest(ctx, http.MethodPost, "/1.0/instances/"+url.PathEscape(containerId)+"/exec", body, &op); err != nil {
+		return nil, fmt.Errorf("creating exec: %w", err)
+	}
+	if op.Metadata.Fds["0"] == "" || op.Metadata.Fds["control"] == "" {
+		return nil, errors.New("creating exec: no websockets")
+	}
+	// the command starts once both websockets are connected
+	dataWs, err := c.dialWebsocket(ctx, op.Id, op.Metadata.Fds["0"])
+	if err != nil {
+		return nil, err
+	}
+	controlWs, err := c.dialWebsocket(ctx, op.Id, op.Metadata.Fds["control"])
+	if err != nil {
+		dataWs.Close()
+		return nil, err
+	}
+	outReader, outWriter := io.Pipe()
+	session := &incusExecSession{
+		client:       c,
+		operationId:  op.Id,
+		dataWs:       dataWs,
+		controlWs:    controlWs,
+		writeLock:    &sync.Mutex{},
+		outReader:    outReader,
+		outWriter:    outWriter,
+		doneCh:       make(chan struct{}),
+		exitCode:     -1,
+		closed:       &atomic.Bool{},
+		streamLostFn: streamLostFn,
+	}
+	go func() {
+		defer panichandler.PanicHandler("docker:incusExecSession:readLoop")
+		session.readLoop()
+	}()
+	go func() {
+		defer panichandler.PanicHandler("docker:incusExecSession:drainControl")
+		// the control websocket has nothing to read, but its close has to be handled
+		for {
+			if _, _, err := controlWs.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+	return session, nil
+}
+
+// a command exec'd in an incus instance.  like docker, an exec can't be attached again, so a lost
+// stream while the command still runs ends the session with an error.
+type incusExecSession struct {
+	client       *incusClient
+	operationId  string
+	dataWs       *websocket.Conn
+	controlWs    *websocket.Conn
+	writeLock    *sync.Mutex // for both websockets
+	outReader    *io.PipeReader
+	outWriter    *io.PipeWriter
+	doneCh       chan struct{}
+	exitCode     int          // set before doneCh is closed
+	waitErr      error        // set before doneCh is closed
+	closed       *atomic.Bool // set when the session was closed by us
+	streamLostFn func()
+}
+
+func (s *incusExecSession) readLoop() {
+	var readErr error
+	for {
+		msgType, msg, err := s.dataWs.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				readErr = err
+			}
+			break
+		}
+		if msgType != websocket.BinaryMessage && msgType != websocket.TextMessage {
+			continue
+		}
+		// an empty message is the end of the output
+		if len(msg) == 0 {
+			break
+		}
+		// errors mean the reader was closed, the output is not wanted anymore
+		s.outWriter.Write(msg)
+	}
+	closed := s.closed.Load()
+	exitCode := -1
+	var waitErr error
+	var streamLost bool
+	op, err := s.client.getOperation(context.Background(), s.operationId)
+	for retry := 0; err == nil && op.Status == "Running" && readErr == nil && !closed && retry < execExitRetries; retry++ {
+		// the operation is updated right after the output ends
+		time.Sleep(execExitRetryWait)
+		op, err = s.client.getOperation(context.Background(), s.operationId)
+	}
+	switch {
+	case err != nil:
+		waitErr = fmt.Errorf("cannot get the exit code: %w", err)
+		streamLost = true
+	case op.Status == "Running" && !closed:
+		streamLost = true
+		waitErr = errors.New("lost the exec stream (the command is still running in the instance, but it can't be attached again)")
+		if readErr != nil {
+			waitErr = fmt.Errorf("lost the exec stream: %w (the command is still running in the instance, but it can't be attached again)", readErr)
+		}
+	case op.Metadata.Return != nil:
+		exitCode = *op.Metadata.Return
+	case op.Err != "" && !closed:
+		waitErr = errors.New(op.Err)
+	}
+	if streamLost && !closed && s.streamLostFn != nil {
+		s.streamLostFn()
+	}
+	s.exitCode = exitCode
+	s.waitErr = waitErr
+	s.outWriter.Close()
+	close(s.doneCh)
+}
+
+func (s *incusExecSession) Read(b []byte) (int, error) {
+	return s.outReader.Read(b)
+}
+
+func (s *incusExecSession) Write(b []byte) (int, error) {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	if err := s.dataWs.WriteMessage(websocket.BinaryMessage, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (s *incusExecSession) Resize(rows int, cols int) error {
+	msg := map[string]any{
+		"command": "window-resize",
+		"args":    map[string]string{"width": strconv.Itoa(cols), "height": strconv.Itoa(rows)},
+	}
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	return s.controlWs.WriteJSON(msg)
+}
+
+// closes the websockets (the command gets a hangup from its tty)
+func (s *incusExecSession) Close() error {
+	if s.closed.Swap(true) {
+		return nil
+	}
+	s.writeLock.Lock()
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	s.dataWs.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second))
+	s.controlWs.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second))
+	s.writeLock.Unlock()
+	err := s.dataWs.Close()
+	s.controlWs.Close()
+	s.outReader.Close()
+	return err
+}
+
+func (s *incusExecSession) Wait() error {
+	<-s.doneCh
+	return s.waitErr
+}
+
+// only valid once Wait() has returned (-1 if it is not known)
+func (s *incusExecSession) ExitCode() int {
+	select {
+	case <-s.doneCh:
+		return s.exitCode
+	default:
+		return -1
+	}
+}
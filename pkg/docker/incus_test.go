@@ -0,0 +1,157 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// a fake incus daemon: a running instance "web", and an exec that echoes its input (and exits
+// with 3 on "exit")
+func startFakeIncus(t *testing.T, resizeCh chan string) *incusClient {
+	upgrader := websocket.Upgrader{}
+	exited := &atomic.Bool{}
+	writeSync := func(w http.ResponseWriter, metadata string) {
+		w.Write([]byte(`{"type": "sync", "status": "Success", "status_code": 200, "metadata": ` + metadata + `}`))
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /1.0", func(w http.ResponseWriter, r *http.Request) {
+		writeSync(w, `{"api_version": "1.0"}`)
+	})
+	mux.HandleFunc("GET /1.0/instances", func(w http.ResponseWriter, r *http.Request) {
+		writeSync(w, `[{"name": "web", "status": "Running", "type": "container", "config": {"image.description": "Debian bookworm"}},
+			{"name": "db", "status": "Stopped", "type": "virtual-machine"}]`)
+	})
+	mux.HandleFunc("GET /1.0/instances/{name}", func(w http.ResponseWriter, r *http.Request) {
+		switch r.PathValue("name") {
+		case "web":
+			writeSync(w, `{"name": "web", "status": "Running", "type": "container"}`)
+		case "db":
+			writeSync(w, `{"name": "db", "status": "Stopped", "type": "virtual-machine"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"type": "error", "error": "Instance not found", "error_code": 404}`))
+		}
+	})
+	mux.HandleFunc("POST /1.0/instances/web/exec", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Command     []string `json:"command"`
+			Interactive bool     `json:"interactive"`
+			Width       int      `json:"width"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if !req.Interactive || req.Width != 80 || strings.Join(req.Command, " ") != "/bin/sh -c exec bash" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"type": "error", "error": "unexpected exec", "error_code": 400}`))
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"type": "async", "operation": "/1.0/operations/op1", "metadata": {"id": "op1", "status": "Running", "metadata": {"fds": {"0": "datasecret", "control": "controlsecret"}}}}`))
+	})
+	mux.HandleFunc("GET /1.0/operations/op1", func(w http.ResponseWriter, r *http.Request) {
+		if exited.Load() {
+			writeSync(w, `{"id": "op1", "status": "Success", "metadata": {"return": 3}}`)
+		} else {
+			writeSync(w, `{"id": "op1", "status": "Running", "metadata": {}}`)
+		}
+	})
+	mux.HandleFunc("GET /1.0/operations/op1/websocket", func(w http.ResponseWriter, r *http.Request) {
+		secret := r.URL.Query().Get("secret")
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		for {
+			_, msg, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			if secret == "controlsecret" {
+				resizeCh <- string(msg)
+				continue
+			}
+			if string(msg) == "exit\n" {
+				exited.Store(true)
+				ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				return
+			}
+			ws.WriteMessage(websocket.BinaryMessage, msg)
+		}
+	})
+	socketPath := filepath.Join(t.TempDir(), "incus.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	client, err := makeIncusClient(Runtime_Incus, "unix://"+socketPath)
+	if err != nil {
+		t.Fatalf("makeIncusClient: %v", err)
+	}
+	return client
+}
+
+func TestIncusExec(t *testing.T) {
+	resizeCh := make(chan string, 1)
+	client := startFakeIncus(t, resizeCh)
+	ctx, cancelFn := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFn()
+	if err := client.ping(ctx); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+	containers, err := client.listRunningContainers(ctx)
+	if err != nil {
+		t.Fatalf("listRunningContainers: %v", err)
+	}
+	if len(containers) != 1 || containers[0].Connection != "incus://web" || containers[0].Image != "Debian bookworm" {
+		t.Errorf("unexpected instances %+v", containers)
+	}
+	if _, err := client.findRunningContainer(ctx, "db"); err == nil || !strings.Contains(err.Error(), "stopped") {
+		t.Errorf("expected a stopped error, got %v", err)
+	}
+	if _, err := client.findRunningContainer(ctx, "nope"); err == nil || !strings.Contains(err.Error(), "Instance not found") {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+	if _, err := client.execInContainer(ctx, "web", []string{"ls"}, 24, 80, nil); err == nil || !strings.Contains(err.Error(), "unexpected exec") {
+		t.Errorf("expected the exec error, got %v", err)
+	}
+	session, err := client.execInContainer(ctx, "web", []string{"/bin/sh", "-c", "exec bash"}, 24, 80, nil)
+	if err != nil {
+		t.Fatalf("execInContainer: %v", err)
+	}
+	defer session.Close()
+	if err := session.Resize(30, 100); err != nil {
+		t.Fatalf("Resize: %v", err)
+	}
+	if resize := <-resizeCh; resize != `{"args":{"height":"30","width":"100"},"command":"window-resize"}`+"\n" {
+		t.Errorf("unexpected resize %q", resize)
+	}
+	session.Write([]byte("hello\n"))
+	buf := make([]byte, 1024)
+	n, err := session.Read(buf)
+	if err != nil || string(buf[:n]) != "hello\n" {
+		t.Errorf("got %q, %v", buf[:n], err)
+	}
+	session.Write([]byte("exit\n"))
+	if _, err := io.ReadAll(session); err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if err := session.Wait(); err != nil || session.ExitCode() != 3 {
+		t.Errorf("Wait: %v, exit code %d", err, session.ExitCode())
+	}
+}
@@ -18,6 +18,7 @@ import (
 
 	"github.com/wavetermdev/waveterm/pkg/ijson"
 	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/wtrace"
 )
 
 const (
@@ -109,6 +110,11 @@ func (f *WaveFile) DeepCopy() *WaveFile {
 
 func (WaveFile) UseDBMap() {}
 
+// spans are named "filestore.<Op>" and carry the zone and file name
+func startFileSpan(ctx context.Context, spanName string, zoneId string, name string, kvs ...any) (context.Context, *wtrace.Span) {
+	return wtrace.Start(ctx, spanName, append([]any{"filestore.zoneid", zoneId, "filestore.name", name}, kvs...)...)
+}
+
 type FileData struct {
 	ZoneId  string `json:"zoneid"`
 	Name    string `json:"name"`
@@ -140,7 +146,8 @@ func (s *FileStore) MakeFile(ctx context.Context, zoneId string, name string, me
 	if opts.IJsonBudget < 0 {
 		return fmt.Errorf("ijson budget must be non-negative")
 	}
-	return withLock(s, zoneId, name, func(entry *CacheEntry) error {
+	ctx, span := startFileSpan(ctx, "filestore.MakeFile", zoneId, name, "filestore.circular", opts.Circular, "filestore.ijson", opts.IJson)
+	return span.EndErr(withLock(s, zoneId, name, func(entry *CacheEntry) error {
 		if entry.File != nil {
 			return fs.ErrExist
 		}
@@ -155,18 +162,19 @@ func (s *FileStore) MakeFile(ctx context.Context, zoneId string, name string, me
 			Meta:      meta,
 		}
 		return dbInsertFile(ctx, file)
-	})
+	}))
 }
 
 func (s *FileStore) DeleteFile(ctx context.Context, zoneId string, name string) error {
-	return withLock(s, zoneId, name, func(entry *CacheEntry) error {
+	ctx, span := startFileSpan(ctx, "filestore.DeleteFile", zoneId, name)
+	return span.EndErr(withLock(s, zoneId, name, func(entry *CacheEntry) error {
 		err := dbDeleteFile(ctx, zoneId, name)
 		if err != nil {
 			return fmt.Errorf("error deleting file: %v", err)
 		}
 		entry.clear()
 		return nil
-	})
+	}))
 }
 
 func (s *FileStore) DeleteZone(ctx context.Context, zoneId string) error {
@@ -233,7 +241,8 @@ func (s *FileStore) WriteMeta(ctx context.Context, zoneId string, name string, m
 }
 
 func (s *FileStore) WriteFile(ctx context.Context, zoneId string, name string, data []byte) error {
-	return withLock(s, zoneId, name, func(entry *CacheEntry) error {
+	ctx, span := startFileSpan(ctx, "filestore.WriteFile", zoneId, name, "filestore.size", len(data))
+	return span.EndErr(withLock(s, zoneId, name, func(entry *CacheEntry) error {
 		err := entry.loadFileIntoCache(ctx)
 		if err != nil {
 			return err
@@ -241,14 +250,15 @@ func (s *FileStore) WriteFile(ctx context.Context, zoneId string, name string, d
 		entry.writeAt(0, data, true)
 		// since WriteFile can *truncate* the file, we need to flush the file to the DB immediately
 		return entry.flushToDB(ctx, true)
-	})
+	}))
 }
 
 func (s *FileStore) WriteAt(ctx context.Context, zoneId string, name string, offset int64, data []byte) error {
 	if offset < 0 {
 		return fmt.Errorf("offset must be non-negative")
 	}
-	return withLock(s, zoneId, name, func(entry *CacheEntry) error {
+	ctx, span := startFileSpan(ctx, "filestore.WriteAt", zoneId, name, "filestore.offset", offset, "filestore.size", len(data))
+	return span.EndErr(withLock(s, zoneId, name, func(entry *CacheEntry) error {
 		err := entry.loadFileIntoCache(ctx)
 		if err != nil {
 			return err
@@ -265,11 +275,12 @@ func (s *FileStore) WriteAt(ctx context.Context, zoneId string, name string, off
 		}
 		entry.writeAt(offset, data, false)
 		return nil
-	})
+	}))
 }
 
 func (s *FileStore) AppendData(ctx context.Context, zoneId string, name string, data []byte) error {
-	return withLock(s, zoneId, name, func(entry *CacheEntry) error {
+	ctx, span := startFileSpan(ctx, "filestore.AppendData", zoneId, name, "filestore.size", len(data))
+	return span.EndErr(withLock(s, zoneId, name, func(entry *CacheEntry) error {
 		err := entry.loadFileIntoCache(ctx)
 		if err != nil {
 			return err
@@ -284,7 +295,7 @@ func (s *FileStore) AppendData(ctx context.Context, zoneId string, name string,
 		}
 		entry.writeAt(entry.File.Size, data, false)
 		return nil
-	})
+	}))
 }
 
 func metaIncrement(file *WaveFile, key string, amount int) int {
@@ -332,7 +343,8 @@ func (s *FileStore) AppendIJson(ctx context.Context, zoneId string, name string,
 	if err != nil {
 		return err
 	}
-	return withLock(s, zoneId, name, func(entry *CacheEntry) error {
+	ctx, span := startFileSpan(ctx, "filestore.AppendIJson", zoneId, name)
+	return span.EndErr(withLock(s, zoneId, name, func(entry *CacheEntry) error {
 		err := entry.loadFileIntoCache(ctx)
 		if err != nil {
 			return err
@@ -365,7 +377,7 @@ func (s *FileStore) AppendIJson(ctx context.Context, zoneId string, name string,
 			}
 		}
 		return nil
-	})
+	}))
 }
 
 func (s *FileStore) GetAllZoneIds(ctx context.Context) ([]string, error) {
@@ -375,6 +387,8 @@ func (s *FileStore) GetAllZoneIds(ctx context.Context) ([]string, error) {
 // returns (offset, data, error)
 // we return the offset because the offset may have been adjusted if the size was too big (for circular files)
 func (s *FileStore) ReadAt(ctx context.Context, zoneId string, name string, offset int64, size int64) (rtnOffset int64, rtnData []byte, rtnErr error) {
+	ctx, span := startFileSpan(ctx, "filestore.ReadAt", zoneId, name, "filestore.offset", offset, "filestore.size", size)
+	defer func() { span.EndErr(rtnErr) }()
 	withLock(s, zoneId, name, func(entry *CacheEntry) error {
 		rtnOffset, rtnData, rtnErr = entry.readAt(ctx, offset, size, false)
 		return nil
@@ -384,6 +398,8 @@ func (s *FileStore) ReadAt(ctx context.Context, zoneId string, name string, offs
 
 // returns (offset, data, error)
 func (s *FileStore) ReadFile(ctx context.Context, zoneId string, name string) (rtnOffset int64, rtnData []byte, rtnErr error) {
+	ctx, span := startFileSpan(ctx, "filestore.ReadFile", zoneId, name)
+	defer func() { span.EndErr(rtnErr) }()
 	withLock(s, zoneId, name, func(entry *CacheEntry) error {
 		rtnOffset, rtnData, rtnErr = entry.readAt(ctx, 0, 0, true)
 		return nil
@@ -391,6 +407,18 @@ func (s *FileStore) ReadFile(ctx context.Context, zoneId string, name string) (r
 	return
 }
 
+type FileStoreStats struct {
+	NumZones  int   `json:"numzones"`
+	NumFiles  int   `json:"numfiles"`
+	NumParts  int   `json:"numparts"`
+	TotalSize int64 `json:"totalsize"` // logical size (circular files can report more than is stored)
+}
+
+// counts from the DB (does not include unflushed cache entries)
+func (s *FileStore) GetStats(ctx context.Context) (FileStoreStats, error) {
+	return dbGetStats(ctx)
+}
+
 type FlushStats struct {
 	FlushDuration   time.Duration
 	NumDirtyEntries int
@@ -403,9 +431,12 @@ func (s *FileStore) FlushCache(ctx context.Context) (stats FlushStats, rtnErr er
 		return stats, fmt.Errorf("flush already in progress")
 	}
 	defer s.setIsFlushing(false)
+	ctx, span := wtrace.Start(ctx, "filestore.FlushCache")
 	startTime := time.Now()
 	defer func() {
 		stats.FlushDuration = time.Since(startTime)
+		span.SetAttrs("filestore.numdirty", stats.NumDirtyEntries, "filestore.numcommitted", stats.NumCommitted)
+		span.EndErr(rtnErr)
 	}()
 
 	// get a copy of dirty keys so we can iterate without the lock
@@ -91,6 +91,17 @@ func dbGetZoneFiles(ctx context.Context, zoneId string) ([]*WaveFile, error) {
 	})
 }
 
+func dbGetStats(ctx context.Context) (FileStoreStats, error) {
+	return WithTxRtn(ctx, func(tx *TxWrap) (FileStoreStats, error) {
+		var stats FileStoreStats
+		stats.NumZones = tx.GetInt("SELECT count(DISTINCT zoneid) FROM db_wave_file")
+		stats.NumFiles = tx.GetInt("SELECT count(*) FROM db_wave_file")
+		stats.TotalSize = tx.GetInt64("SELECT COALESCE(sum(size), 0) FROM db_wave_file")
+		stats.NumParts = tx.GetInt("SELECT count(*) FROM db_file_data")
+		return stats, nil
+	})
+}
+
 func dbWriteCacheEntry(ctx context.Context, file *WaveFile, dataEntries map[int]*DataCacheEntry, replace bool) error {
 	return WithTx(ctx, func(tx *TxWrap) error {
 		query := `SELECT zoneid FROM db_wave_file WHERE zoneid = ? AND name = ?`
@@ -0,0 +1,484 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// automation hooks (hooks.json in the config dir) run a command when an event happens: a
+// connection connects, a command finishes or fails in a terminal, a workspace is opened, a watched
+// file changes, or on an interval.  the event payload is passed to the command as WAVETERM_HOOK_*
+// env vars and as json on stdin (both can be customized with templates).  a hook doesn't run again
+// while it is still running, so a hook that triggers its own event can't run away.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/util/shellutil"
+	"github.com/wavetermdev/waveterm/pkg/util/utilfn"
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+	"github.com/wavetermdev/waveterm/pkg/wps"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+const (
+	HookEvent_ConnConnected    = "conn:connected"
+	HookEvent_ConnDisconnected = "conn:disconnected"
+	HookEvent_ConnError        = "conn:error"
+	HookEvent_CmdDone          = "cmd:done"
+	HookEvent_CmdFailed        = "cmd:failed"
+	HookEvent_WorkspaceOpen    = "workspace:open"
+	HookEvent_FileChange       = "file:change"
+	HookEvent_Interval         = "interval"
+)
+
+var allHookEvents = map[string]bool{
+	HookEvent_ConnConnected:    true,
+	HookEvent_ConnDisconnected: true,
+	HookEvent_ConnError:        true,
+	HookEvent_CmdDone:          true,
+	HookEvent_CmdFailed:        true,
+	HookEvent_WorkspaceOpen:    true,
+	HookEvent_FileChange:       true,
+	HookEvent_Interval:         true,
+}
+
+// conn status => hook event
+var connStatusEvents = map[string]string{
+	"connected":    HookEvent_ConnConnected,
+	"disconnected": HookEvent_ConnDisconnected,
+	"error":        HookEvent_ConnError,
+}
+
+const DefaultHookTimeout = 60 * time.Second
+const MinHookInterval = 10 * time.Second
+const HookWatchRenewInterval = time.Minute // must be less than the file watch expire time
+const MaxHookOutputLog = 4096
+const HookWatchIdPrefix = "hook:"
+const LocalConnName = "local" // connection name for local terminals in hook filters
+
+var subscribeEvents = []string{wps.Event_ConnChange, wps.Event_CmdDone, wps.Event_WorkspaceOpen, wps.Event_FileChange}
+
+// the event payload passed to hook commands (and their templates)
+type HookPayload struct {
+	Hook          string `json:"hook"`
+	Event         string `json:"event"`
+	Ts            int64  `json:"ts"`
+	Connection    string `json:"connection,omitempty"`
+	Status        string `json:"status,omitempty"`
+	Error         string `json:"error,omitempty"`
+	BlockId       string `json:"blockid,omitempty"`
+	Command       string `json:"command,omitempty"`
+	ExitCode      int    `json:"exitcode,omitempty"`
+	Cwd           string `json:"cwd,omitempty"`
+	WindowId      string `json:"windowid,omitempty"`
+	WorkspaceId   string `json:"workspaceid,omitempty"`
+	WorkspaceName string `json:"workspacename,omitempty"`
+	Path          string `json:"path,omitempty"`
+	FileOp        string `json:"fileop,omitempty"`
+}
+
+type hookState struct {
+	Name      string
+	Config    wconfig.HookConfigType
+	MatchRe   *regexp.Regexp
+	EnvTmpls  map[string]*template.Template
+	StdinTmpl *template.Template
+	Interval  time.Duration
+	Running   bool
+	StopCh    chan struct{}
+}
+
+type hookManager struct {
+	Lock       *sync.Mutex
+	Hooks      map[string]*hookState
+	ConnStatus map[string]string // last status seen for each connection
+	Subscribed bool
+}
+
+var globalManager = &hookManager{
+	Lock:       &sync.Mutex{},
+	Hooks:      make(map[string]*hookState),
+	ConnStatus: make(map[string]string),
+}
+
+// a wconfig update handler, (re)starts the hooks whose config changed
+func ApplyConfig(fullConfig wconfig.FullConfigType) {
+	globalManager.applyConfig(fullConfig.Hooks)
+}
+
+func makeHookState(name string, config wconfig.HookConfigType) (*hookState, error) {
+	if !allHookEvents[config.Event] {
+		return nil, fmt.Errorf("unknown event %q", config.Event)
+	}
+	if strings.TrimSpace(config.Command) == "" {
+		return nil, fmt.Errorf("no command")
+	}
+	state := &hookState{Name: name, Config: config, EnvTmpls: make(map[string]*template.Template)}
+	if config.Match != "" {
+		matchRe, err := regexp.Compile(config.Match)
+		if err != nil {
+			return nil, fmt.Errorf("invalid match regexp: %w", err)
+		}
+		state.MatchRe = matchRe
+	}
+	for key, val := range config.Env {
+		tmpl, err := template.New(key).Option("missingkey=zero").Parse(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid env template %q: %w", key, err)
+		}
+		state.EnvTmpls[key] = tmpl
+	}
+	if config.Stdin != "" {
+		tmpl, err := template.New("stdin").Option("missingkey=zero").Parse(config.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stdin template: %w", err)
+		}
+		state.StdinTmpl = tmpl
+	}
+	switch config.Event {
+	case HookEvent_Interval:
+		interval, err := time.ParseDuration(config.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid interval %q: %w", config.Interval, err)
+		}
+		if interval < MinHookInterval {
+			return nil, fmt.Errorf("interval %v is less than the minimum (%v)", interval, MinHookInterval)
+		}
+		state.Interval = interval
+	case HookEvent_FileChange:
+		if len(config.Paths) == 0 {
+			return nil, fmt.Errorf("no paths to watch")
+		}
+	}
+	return state, nil
+}
+
+func (m *hookManager) applyConfig(configs map[string]wconfig.HookConfigType) {
+	m.Lock.Lock()
+	defer m.Lock.Unlock()
+	for name, state := range m.Hooks {
+		config, ok := configs[name]
+		if ok && !config.Disabled && reflect.DeepEqual(config, state.Config) {
+			continue
+		}
+		state.stop()
+		delete(m.Hooks, name)
+	}
+	for name, config := range configs {
+		if config.Disabled || m.Hooks[name] != nil {
+			continue
+		}
+		state, err := makeHookState(name, config)
+		if err != nil {
+			log.Printf("[hook:%s] invalid hook: %v\n", name, err)
+			continue
+		}
+		state.start()
+		m.Hooks[name] = state
+	}
+	if len(m.Hooks) > 0 && !m.Subscribed {
+		m.subscribe()
+	}
+}
+
+// call with Lock held
+func (m *hookManager) subscribe() {
+	m.Subscribed = true
+	client := wshclient.GetBareRpcClient()
+	client.EventListener.On(wps.Event_ConnChange, m.handleConnChange)
+	client.EventListener.On(wps.Event_CmdDone, m.handleCmdDone)
+	client.EventListener.On(wps.Event_WorkspaceOpen, m.handleWorkspaceOpen)
+	client.EventListener.On(wps.Event_FileChange, m.handleFileChange)
+	for _, event := range subscribeEvents {
+		wps.Broker.Subscribe(wshclient.BareClientRoute, wps.SubscriptionRequest{Event: event, AllScopes: true})
+	}
+}
+
+func (state *hookState) start() {
+	state.StopCh = make(chan struct{})
+	stopCh := state.StopCh
+	switch state.Config.Event {
+	case HookEvent_Interval:
+		go func() {
+			defer panichandler.PanicHandler("hooks:interval")
+			ticker := time.NewTicker(state.Interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stopCh:
+					return
+				case <-ticker.C:
+					globalManager.runHook(state, HookPayload{})
+				}
+			}
+		}()
+	case HookEvent_FileChange:
+		// file watches expire unless they are renewed
+		go func() {
+			defer panichandler.PanicHandler("hooks:filewatch")
+			for {
+				setHookFileWatch(state.Name, state.Config.Paths)
+				select {
+				case <-stopCh:
+					setHookFileWatch(state.Name, nil)
+					return
+				case <-time.After(HookWatchRenewInterval):
+				}
+			}
+		}()
+	}
+}
+
+func (state *hookState) stop() {
+	if state.StopCh != nil {
+		close(state.StopCh)
+		state.StopCh = nil
+	}
+}
+
+func setHookFileWatch(name string, paths []string) {
+	data := wshrpc.CommandRemoteWatchFilesData{WatchId: HookWatchIdPrefix + name, Paths: paths}
+	opts := &wshrpc.RpcOpts{Route: wshutil.MakeConnectionRouteId(wshrpc.LocalConnName)}
+	err := wshclient.RemoteWatchFilesCommand(wshclient.GetBareRpcClient(), data, opts)
+	if err != nil {
+		log.Printf("[hook:%s] error watching files: %v\n", name, err)
+	}
+}
+
+// checks a hook's connection and match filters
+func (state *hookState) matches(connection string, matchStr string) bool {
+	if state.Config.Connection != "" {
+		if connection == "" {
+			connection = LocalConnName
+		}
+		if connection != state.Config.Connection {
+			return false
+		}
+	}
+	if state.MatchRe != nil && !state.MatchRe.MatchString(matchStr) {
+		return false
+	}
+	return true
+}
+
+// runs the hooks for a hook event that pass their filters
+func (m *hookManager) fireEvent(hookEvent string, payload HookPayload, matchStr string) {
+	m.Lock.Lock()
+	var toRun []*hookState
+	for _, state := range m.Hooks {
+		if state.Config.Event == hookEvent && state.matches(payload.Connection, matchStr) {
+			toRun = append(toRun, state)
+		}
+	}
+	m.Lock.Unlock()
+	for _, state := range toRun {
+		m.runHook(state, payload)
+	}
+}
+
+func (m *hookManager) handleConnChange(event *wps.WaveEvent) {
+	var status wshrpc.ConnStatus
+	if err := utilfn.ReUnmarshal(&status, event.Data); err != nil {
+		return
+	}
+	m.Lock.Lock()
+	prevStatus := m.ConnStatus[status.Connection]
+	m.ConnStatus[status.Connection] = status.Status
+	m.Lock.Unlock()
+	hookEvent := connStatusEvents[status.Status]
+	if hookEvent == "" || prevStatus == status.Status {
+		return
+	}
+	if hookEvent == HookEvent_ConnDisconnected && prevStatus != "connected" {
+		// connections start out disconnected
+		return
+	}
+	payload := HookPayload{Connection: status.Connection, Status: status.Status, Error: status.Error}
+	m.fireEvent(hookEvent, payload, status.Connection)
+}
+
+func (m *hookManager) handleCmdDone(event *wps.WaveEvent) {
+	var data wps.CmdDoneEventData
+	if err := utilfn.ReUnmarshal(&data, event.Data); err != nil {
+		return
+	}
+	payload := HookPayload{
+		Connection: data.Connection,
+		BlockId:    data.BlockId,
+		Command:    data.Command,
+		ExitCode:   data.ExitCode,
+		Cwd:        data.Cwd,
+	}
+	m.fireEvent(HookEvent_CmdDone, payload, data.Command)
+	if data.HasExitCode && data.ExitCode != 0 {
+		m.fireEvent(HookEvent_CmdFailed, payload, data.Command)
+	}
+}
+
+func (m *hookManager) handleWorkspaceOpen(event *wps.WaveEvent) {
+	var data wps.WorkspaceOpenEventData
+	if err := utilfn.ReUnmarshal(&data, event.Data); err != nil {
+		return
+	}
+	payload := HookPayload{WindowId: data.WindowId, WorkspaceId: data.WorkspaceId, WorkspaceName: data.WorkspaceName}
+	m.fireEvent(HookEvent_WorkspaceOpen, payload, data.WorkspaceName)
+}
+
+func (m *hookManager) handleFileChange(event *wps.WaveEvent) {
+	var data wshrpc.FileChangeEventData
+	if err := utilfn.ReUnmarshal(&data, event.Data); err != nil {
+		return
+	}
+	name, ok := strings.CutPrefix(data.WatchId, HookWatchIdPrefix)
+	if !ok {
+		// a file watch for a preview block
+		return
+	}
+	m.Lock.Lock()
+	state := m.Hooks[name]
+	m.Lock.Unlock()
+	if state == nil || state.Config.Event != HookEvent_FileChange || !state.matches("", data.Path) {
+		return
+	}
+	m.runHook(state, HookPayload{Path: data.Path, FileOp: data.Op})
+}
+
+// WAVETERM_HOOK_* env vars for the non-empty payload fields
+func makePayloadEnv(payload HookPayload) []string {
+	barr, err := json.Marshal(payload)
+	if err != nil {
+		return nil
+	}
+	// UseNumber so timestamps aren't formatted as floats
+	decoder := json.NewDecoder(bytes.NewReader(barr))
+	decoder.UseNumber()
+	var fields map[string]any
+	if err := decoder.Decode(&fields); err != nil {
+		return nil
+	}
+	var rtn []string
+	for key, val := range fields {
+		rtn = append(rtn, fmt.Sprintf("WAVETERM_HOOK_%s=%v", strings.ToUpper(key), val))
+	}
+	return rtn
+}
+
+func (state *hookState) makeEnv(payload HookPayload) ([]string, error) {
+	env := os.Environ()
+	wshBinDir := filepath.Join(wavebase.GetWaveDataDir(), shellutil.WaveHomeBinDir)
+	env = append(env, "PATH="+wshBinDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	jwtToken, err := wshutil.MakeClientJWTToken(wshrpc.RpcContext{}, wavebase.GetDomainSocketName())
+	if err != nil {
+		return nil, fmt.Errorf("error making jwt token: %w", err)
+	}
+	env = append(env, wshutil.WaveJwtTokenVarName+"="+jwtToken)
+	env = append(env, makePayloadEnv(payload)...)
+	for key, tmpl := range state.EnvTmpls {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, payload); err != nil {
+			return nil, fmt.Errorf("error in env template %q: %w", key, err)
+		}
+		env = append(env, key+"="+buf.String())
+	}
+	return env, nil
+}
+
+func (state *hookState) makeStdin(payload HookPayload) ([]byte, error) {
+	if state.StdinTmpl == nil {
+		return json.Marshal(payload)
+	}
+	var buf bytes.Buffer
+	if err := state.StdinTmpl.Execute(&buf, payload); err != nil {
+		return nil, fmt.Errorf("error in stdin template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func makeShellCmd(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// runs the hook's command in the background (skipped if the hook is still running)
+func (m *hookManager) runHook(state *hookState, payload HookPayload) {
+	m.Lock.Lock()
+	if state.Running {
+		m.Lock.Unlock()
+		log.Printf("[hook:%s] still running, skipping %s event\n", state.Name, state.Config.Event)
+		return
+	}
+	state.Running = true
+	m.Lock.Unlock()
+	payload.Hook = state.Name
+	payload.Event = state.Config.Event
+	payload.Ts = time.Now().UnixMilli()
+	go func() {
+		defer panichandler.PanicHandler("hooks:runHook")
+		defer func() {
+			m.Lock.Lock()
+			state.Running = false
+			m.Lock.Unlock()
+		}()
+		if err := state.execCommand(payload); err != nil {
+			log.Printf("[hook:%s] %v\n", state.Name, err)
+		}
+	}()
+}
+
+func (state *hookState) execCommand(payload HookPayload) error {
+	env, err := state.makeEnv(payload)
+	if err != nil {
+		return err
+	}
+	stdin, err := state.makeStdin(payload)
+	if err != nil {
+		return err
+	}
+	timeout := DefaultHookTimeout
+	if state.Config.Timeout > 0 {
+		timeout = time.Duration(state.Config.Timeout * float64(time.Second))
+	}
+	ctx, cancelFn := context.WithTimeout(context.Background(), timeout)
+	defer cancelFn()
+	cmd := makeShellCmd(ctx, state.Config.Command)
+	cmd.Env = env
+	cmd.Stdin = bytes.NewReader(stdin)
+	if state.Config.Cwd != "" {
+		cwd, err := wavebase.ExpandHomeDir(state.Config.Cwd)
+		if err != nil {
+			return err
+		}
+		cmd.Dir = cwd
+	}
+	startTime := time.Now()
+	output, err := cmd.CombinedOutput()
+	if len(output) > MaxHookOutputLog {
+		output = output[len(output)-MaxHookOutputLog:]
+	}
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %v", timeout)
+		}
+		return fmt.Errorf("%s hook failed: %v\n%s", payload.Event, err, strings.TrimSpace(string(output)))
+	}
+	log.Printf("[hook:%s] ran for %s event (%dms)\n", state.Name, payload.Event, time.Since(startTime).Milliseconds())
+	return nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package hooks
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+)
+
+func TestMakeHookState(t *testing.T) {
+	bad := []wconfig.HookConfigType{
+		{Event: "cmd:exploded", Command: "true"},
+		{Event: HookEvent_CmdFailed},
+		{Event: HookEvent_CmdFailed, Command: "true", Match: "("},
+		{Event: HookEvent_Interval, Command: "true", Interval: "1s"},
+		{Event: HookEvent_FileChange, Command: "true"},
+		{Event: HookEvent_CmdDone, Command: "true", Env: map[string]string{"X": "{{.Command"}},
+	}
+	for _, config := range bad {
+		if _, err := makeHookState("test", config); err == nil {
+			t.Errorf("expected an error for %+v", config)
+		}
+	}
+	state, err := makeHookState("test", wconfig.HookConfigType{Event: HookEvent_Interval, Command: "true", Interval: "5m"})
+	if err != nil || state.Interval.Minutes() != 5 {
+		t.Errorf("unexpected result %+v, %v", state, err)
+	}
+}
+
+func TestHookMatches(t *testing.T) {
+	state, err := makeHookState("test", wconfig.HookConfigType{Event: HookEvent_CmdFailed, Command: "true", Connection: "local", Match: `^make\b`})
+	if err != nil {
+		t.Fatalf("makeHookState: %v", err)
+	}
+	if !state.matches("", "make test") {
+		t.Errorf("expected a local make command to match")
+	}
+	if state.matches("user@host", "make test") {
+		t.Errorf("expected a remote command not to match")
+	}
+	if state.matches("", "cmake .") {
+		t.Errorf("expected cmake not to match")
+	}
+}
+
+func TestHookPayload(t *testing.T) {
+	config := wconfig.HookConfigType{
+		Event:   HookEvent_CmdFailed,
+		Command: "true",
+		Env:     map[string]string{"MSG": "{{.Command}} failed ({{.ExitCode}})"},
+		Stdin:   "{{.Cwd}}",
+	}
+	state, err := makeHookState("test", config)
+	if err != nil {
+		t.Fatalf("makeHookState: %v", err)
+	}
+	payload := HookPayload{Hook: "test", Event: HookEvent_CmdFailed, Ts: 1700000000123, Command: "make", ExitCode: 2, Cwd: "/src"}
+	env, err := state.makeEnv(payload)
+	if err != nil {
+		t.Fatalf("makeEnv: %v", err)
+	}
+	for _, expected := range []string{"MSG=make failed (2)", "WAVETERM_HOOK_COMMAND=make", "WAVETERM_HOOK_EXITCODE=2", "WAVETERM_HOOK_TS=1700000000123"} {
+		if !slices.Contains(env, expected) {
+			t.Errorf("env is missing %q", expected)
+		}
+	}
+	stdin, err := state.makeStdin(payload)
+	if err != nil || string(stdin) != "/src" {
+		t.Errorf("unexpected stdin %q, %v", stdin, err)
+	}
+}
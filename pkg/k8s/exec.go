@@ -0,0 +1,323 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package k8s
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+)
+
+// runs commands in a pod's container over the api server's websocket exec protocol (what kubectl
+// exec uses).  each message starts with its stream: stdin, stdout, stderr, an error stream (the
+// exit status, sent when the command is done) and a resize stream.  with a tty, stderr is merged
+// into stdout.
+
+const ExecSubprotocolV5 = "v5.channel.k8s.io"
+const ExecSubprotocolV4 = "v4.channel.k8s.io"
+const ApiRequestTimeout = 15 * time.Second
+
+const (
+	execStream_Stdin  = 0
+	execStream_Stdout = 1
+	execStream_Stderr = 2
+	execStream_Error  = 3
+	execStream_Resize = 4
+)
+
+// the parts of a pod that are used here
+type podInfo struct {
+	Metadata struct {
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+	Spec struct {
+		Containers []struct {
+			Name string `json:"name"`
+		} `json:"containers"`
+	} `json:"spec"`
+	Status struct {
+		Phase string `json:"phase"`
+	} `json:"status"`
+}
+
+// a metav1.Status (api errors, and the exit status of an exec)
+type apiStatus struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Reason  string `json:"reason"`
+	Details struct {
+		Causes []struct {
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"causes"`
+	} `json:"details"`
+}
+
+type ExecOpts struct {
+	Namespace string
+	Pod       string
+	Container string
+	Command   []string
+	Rows      int
+	Cols      int
+}
+
+func makeApiError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var status apiStatus
+	if err := json.Unmarshal(body, &status); err == nil && status.Message != "" {
+		return fmt.Errorf("%s: %s", resp.Status, status.Message)
+	}
+	return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
+
+func (rc *restConfig) getPod(ctx context.Context, namespace string, podName string) (*podInfo, error) {
+	authHeader, clientCert, err := rc.AuthFn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancelFn := context.WithTimeout(ctx, ApiRequestTimeout)
+	defer cancelFn()
+	podUrl := rc.Server + "/api/v1/namespaces/" + url.PathEscape(namespace) + "/pods/" + url.PathEscape(podName)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, podUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	if authHeader != "" {
+		req.Header.Set("Authorization", authHeader)
+	}
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: rc.makeTLSConfig(clientCert)}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("pod %s not found in namespace %s", podName, namespace)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("getting pod %s: %w", podName, makeApiError(resp))
+	}
+	var pod podInfo
+	if err := json.NewDecoder(resp.Body).Decode(&pod); err != nil {
+		return nil, fmt.Errorf("getting pod %s: %w", podName, err)
+	}
+	return &pod, nil
+}
+
+// the container to use when none is given (like kubectl, the default-container annotation or the
+// first container)
+func (pod *podInfo) defaultContainer() string {
+	if container := pod.Metadata.Annotations["kubectl.kubernetes.io/default-container"]; container != "" {
+		return container
+	}
+	if len(pod.Spec.Containers) > 0 {
+		return pod.Spec.Containers[0].Name
+	}
+	return ""
+}
+
+func (pod *podInfo) hasContainer(container string) bool {
+	for _, podContainer := range pod.Spec.Containers {
+		if podContainer.Name == container {
+			return true
+		}
+	}
+	return false
+}
+
+func makeExecUrl(server string, opts ExecOpts) string {
+	query := url.Values{}
+	for _, arg := range opts.Command {
+		query.Add("command", arg)
+	}
+	query.Set("container", opts.Container)
+	query.Set("stdin", "true")
+	query.Set("stdout", "true")
+	query.Set("tty", "true")
+	execUrl := strings.Replace(server, "http", "ws", 1)
+	return execUrl + "/api/v1/namespaces/" + url.PathEscape(opts.Namespace) + "/pods/" + url.PathEscape(opts.Pod) + "/exec?" + query.Encode()
+}
+
+func openExec(ctx context.Context, rc *restConfig, opts ExecOpts) (*ExecSession, error) {
+	authHeader, clientCert, err := rc.AuthFn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	if authHeader != "" {
+		header.Set("Authorization", authHeader)
+	}
+	session, err := DialExec(ctx, makeExecUrl(rc.Server, opts), rc.makeTLSConfig(clientCert), header, opts.Rows, opts.Cols)
+	if err != nil {
+		return nil, fmt.Errorf("exec in pod %s: %w", opts.Pod, err)
+	}
+	return session, nil
+}
+
+// opens an exec stream (execUrl is a ws:// or wss:// url).  the CRI streaming servers of container
+// runtimes (which the kubelet proxies to) speak the same protocol, so this is used for them too.
+func DialExec(ctx context.Context, execUrl string, tlsConfig *tls.Config, header http.Header, rows int, cols int) (*ExecSession, error) {
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		TLSClientConfig:  tlsConfig,
+		Subprotocols:     []string{ExecSubprotocolV5, ExecSubprotocolV4},
+		HandshakeTimeout: ApiRequestTimeout,
+	}
+	ws, resp, err := dialer.DialContext(ctx, execUrl, header)
+	if err != nil {
+		if resp != nil {
+			return nil, makeApiError(resp)
+		}
+		return nil, err
+	}
+	outReader, outWriter := io.Pipe()
+	session := &ExecSession{
+		ws:        ws,
+		writeLock: &sync.Mutex{},
+		outReader: outReader,
+		outWriter: outWriter,
+		doneCh:    make(chan struct{}),
+		exitCode:  -1,
+	}
+	if rows > 0 && cols > 0 {
+		if err := session.Resize(rows, cols); err != nil {
+			ws.Close()
+			return nil, err
+		}
+	}
+	go func() {
+		defer panichandler.PanicHandler("k8s:ExecSession:readLoop")
+		session.readLoop()
+	}()
+	return session, nil
+}
+
+// a command running in a container with a tty
+type ExecSession struct {
+	ws        *websocket.Conn
+	writeLock *sync.Mutex
+	outReader *io.PipeReader
+	outWriter *io.PipeWriter
+	doneCh    chan struct{}
+	exitCode  int   // set before doneCh is closed
+	waitErr   error // set before doneCh is closed
+}
+
+// the exit status from the error stream
+func parseExitStatus(msg []byte) (int, error) {
+	var status apiStatus
+	if err := json.Unmarshal(msg, &status); err != nil {
+		return -1, fmt.Errorf("bad exit status: %w", err)
+	}
+	if status.Status == "Success" {
+		return 0, nil
+	}
+	if status.Reason == "NonZeroExitCode" {
+		for _, cause := range status.Details.Causes {
+			if cause.Reason == "ExitCode" {
+				exitCode, err := strconv.Atoi(cause.Message)
+				if err == nil {
+					return exitCode, nil
+				}
+			}
+		}
+	}
+	return -1, errors.New(status.Message)
+}
+
+func (s *ExecSession) readLoop() {
+	var exitCode = -1
+	var waitErr error
+	var gotStatus bool
+	for {
+		msgType, msg, err := s.ws.ReadMessage()
+		if err != nil {
+			if !gotStatus {
+				waitErr = err
+				if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+					waitErr = fmt.Errorf("exec stream closed without an exit status")
+				}
+			}
+			break
+		}
+		if msgType != websocket.BinaryMessage || len(msg) == 0 {
+			continue
+		}
+		switch msg[0] {
+		case execStream_Stdout, execStream_Stderr:
+			// errors mean the reader was closed, the output is not wanted anymore
+			s.outWriter.Write(msg[1:])
+		case execStream_Error:
+			exitCode, waitErr = parseExitStatus(msg[1:])
+			gotStatus = true
+		}
+	}
+	s.exitCode = exitCode
+	s.waitErr = waitErr
+	s.outWriter.Close()
+	close(s.doneCh)
+}
+
+func (s *ExecSession) writeStream(stream byte, data []byte) error {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	msg := make([]byte, len(data)+1)
+	msg[0] = stream
+	copy(msg[1:], data)
+	return s.ws.WriteMessage(websocket.BinaryMessage, msg)
+}
+
+// the command's output (stdout and stderr)
+func (s *ExecSession) Read(b []byte) (int, error) {
+	return s.outReader.Read(b)
+}
+
+// writes to the command's stdin
+func (s *ExecSession) Write(b []byte) (int, error) {
+	if err := s.writeStream(execStream_Stdin, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (s *ExecSession) Resize(rows int, cols int) error {
+	size, _ := json.Marshal(map[string]int{"Width": cols, "Height": rows})
+	return s.writeStream(execStream_Resize, size)
+}
+
+// closes the stream (which ends the command, like a hangup)
+func (s *ExecSession) Close() error {
+	err := s.ws.Close()
+	s.outReader.Close()
+	return err
+}
+
+// waits for the command to finish (or the stream to close)
+func (s *ExecSession) Wait() error {
+	<-s.doneCh
+	return s.waitErr
+}
+
+// only valid once Wait() has returned (-1 if it is not known)
+func (s *ExecSession) ExitCode() int {
+	select {
+	case <-s.doneCh:
+		return s.exitCode
+	default:
+		return -1
+	}
+}
@@ -0,0 +1,305 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// connections to kubernetes pods (k8s://namespace/pod[/container][@context]).  there is nothing
+// to keep open: connecting checks the pod (and resolves the container), and each shell is a new
+// exec in the container.  wsh is not installed in pods.
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/telemetry"
+	"github.com/wavetermdev/waveterm/pkg/wps"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const ConnPrefix = "k8s://"
+
+const (
+	Status_Init         = "init"
+	Status_Connecting   = "connecting"
+	Status_Connected    = "connected"
+	Status_Disconnected = "disconnected"
+	Status_Error        = "error"
+)
+
+var globalLock = &sync.Mutex{}
+var clientControllerMap = make(map[string]*K8sConn)
+var activeConnCounter = &atomic.Int32{}
+
+type K8sName struct {
+	Context   string `json:"context,omitempty"` // empty for the current context
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Container string `json:"container,omitempty"` // empty for the pod's default container
+}
+
+type K8sConn struct {
+	Lock            *sync.Mutex
+	Status          string
+	Name            K8sName
+	Config          *restConfig
+	Container       string // the resolved container
+	Error           string
+	LastConnectTime int64
+	ActiveConnNum   int
+}
+
+func IsK8sConnName(connName string) bool {
+	return strings.HasPrefix(connName, ConnPrefix)
+}
+
+// parses "namespace/pod[/container][@context]" (without the k8s:// prefix)
+func ParseK8sName(name string) (K8sName, error) {
+	var rtn K8sName
+	podPath, kubeContext, _ := strings.Cut(name, "@")
+	rtn.Context = kubeContext
+	parts := strings.Split(podPath, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return rtn, fmt.Errorf("invalid kubernetes connection %q (expected namespace/pod[/container][@context])", name)
+	}
+	rtn.Namespace = parts[0]
+	rtn.Pod = parts[1]
+	if len(parts) == 3 {
+		rtn.Container = parts[2]
+	}
+	return rtn, nil
+}
+
+func (name K8sName) String() string {
+	rtn := name.Namespace + "/" + name.Pod
+	if name.Container != "" {
+		rtn += "/" + name.Container
+	}
+	if name.Context != "" {
+		rtn += "@" + name.Context
+	}
+	return rtn
+}
+
+func GetAllConnStatus() []wshrpc.ConnStatus {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+
+	var connStatuses []wshrpc.ConnStatus
+	for _, conn := range clientControllerMap {
+		connStatuses = append(connStatuses, conn.DeriveConnStatus())
+	}
+	return connStatuses
+}
+
+func (conn *K8sConn) DeriveConnStatus() wshrpc.ConnStatus {
+	conn.Lock.Lock()
+	defer conn.Lock.Unlock()
+	return wshrpc.ConnStatus{
+		Status:        conn.Status,
+		Connected:     conn.Status == Status_Connected,
+		WshEnabled:    false,
+		Connection:    conn.GetName(),
+		HasConnected:  (conn.LastConnectTime > 0),
+		ActiveConnNum: conn.ActiveConnNum,
+		Error:         conn.Error,
+	}
+}
+
+func (conn *K8sConn) FireConnChangeEvent() {
+	status := conn.DeriveConnStatus()
+	event := wps.WaveEvent{
+		Event: wps.Event_ConnChange,
+		Scopes: []string{
+			fmt.Sprintf("connection:%s", conn.GetName()),
+		},
+		Data: status,
+	}
+	log.Printf("sending event: %+#v", event)
+	wps.Broker.Publish(event)
+}
+
+func (conn *K8sConn) GetName() string {
+	// no lock required because the name is immutable
+	return ConnPrefix + conn.Name.String()
+}
+
+func (conn *K8sConn) GetStatus() string {
+	conn.Lock.Lock()
+	defer conn.Lock.Unlock()
+	return conn.Status
+}
+
+func (conn *K8sConn) WithLock(fn func()) {
+	conn.Lock.Lock()
+	defer conn.Lock.Unlock()
+	fn()
+}
+
+// running shells are not closed (they are separate execs), but new ones need a reconnect
+func (conn *K8sConn) Close() error {
+	defer conn.FireConnChangeEvent()
+	conn.WithLock(func() {
+		if conn.Status == Status_Connected || conn.Status == Status_Connecting {
+			conn.Status = Status_Disconnected
+		}
+		conn.Config = nil
+	})
+	return nil
+}
+
+func (conn *K8sConn) Connect(ctx context.Context) error {
+	var connectAllowed bool
+	conn.WithLock(func() {
+		if conn.Status == Status_Connecting || conn.Status == Status_Connected {
+			connectAllowed = false
+		} else {
+			conn.Status = Status_Connecting
+			conn.Error = ""
+			connectAllowed = true
+		}
+	})
+	log.Printf("Connect %s\n", conn.GetName())
+	if !connectAllowed {
+		return fmt.Errorf("cannot connect to %q when status is %q", conn.GetName(), conn.GetStatus())
+	}
+	conn.FireConnChangeEvent()
+	config, container, err := conn.connectInternal(ctx)
+	conn.WithLock(func() {
+		if err != nil {
+			conn.Status = Status_Error
+			conn.Error = err.Error()
+			telemetry.GoUpdateActivityWrap(wshrpc.ActivityUpdate{
+				Conn: map[string]int{"k8s:connecterror": 1},
+			}, "k8s-connconnect")
+		} else {
+			conn.Status = Status_Connected
+			conn.Config = config
+			conn.Container = container
+			conn.LastConnectTime = time.Now().UnixMilli()
+			if conn.ActiveConnNum == 0 {
+				conn.ActiveConnNum = int(activeConnCounter.Add(1))
+			}
+			telemetry.GoUpdateActivityWrap(wshrpc.ActivityUpdate{
+				Conn: map[string]int{"k8s:connect": 1},
+			}, "k8s-connconnect")
+		}
+	})
+	conn.FireConnChangeEvent()
+	return err
+}
+
+func (conn *K8sConn) WaitForConnect(ctx context.Context) error {
+	for {
+		status := conn.DeriveConnStatus()
+		switch status.Status {
+		case Status_Connected:
+			return nil
+		case Status_Connecting:
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("context timeout")
+			case <-time.After(100 * time.Millisecond):
+			}
+		case Status_Error:
+			return fmt.Errorf("error: %v", status.Error)
+		default:
+			return fmt.Errorf("disconnected")
+		}
+	}
+}
+
+// loads the context's config and checks that the pod is running
+func (conn *K8sConn) connectInternal(ctx context.Context) (*restConfig, string, error) {
+	kubeConfig, err := readKubeConfig(ctx, conn.Name.Context)
+	if err != nil {
+		return nil, "", err
+	}
+	config, err := makeRestConfig(kubeConfig)
+	if err != nil {
+		return nil, "", err
+	}
+	pod, err := config.getPod(ctx, conn.Name.Namespace, conn.Name.Pod)
+	if err != nil {
+		return nil, "", err
+	}
+	if pod.Status.Phase != "Running" {
+		return nil, "", fmt.Errorf("pod %s is %s", conn.Name.Pod, strings.ToLower(pod.Status.Phase))
+	}
+	container := conn.Name.Container
+	if container == "" {
+		container = pod.defaultContainer()
+	} else if !pod.hasContainer(container) {
+		return nil, "", fmt.Errorf("pod %s has no container %s", conn.Name.Pod, container)
+	}
+	return config, container, nil
+}
+
+// starts command in the container with a tty of the given size
+func (conn *K8sConn) StartExec(ctx context.Context, command []string, rows int, cols int) (*ExecSession, error) {
+	var config *restConfig
+	var container string
+	conn.WithLock(func() {
+		config = conn.Config
+		container = conn.Container
+	})
+	if config == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+	return openExec(ctx, config, ExecOpts{
+		Namespace: conn.Name.Namespace,
+		Pod:       conn.Name.Pod,
+		Container: container,
+		Command:   command,
+		Rows:      rows,
+		Cols:      cols,
+	})
+}
+
+func getConnInternal(name K8sName) *K8sConn {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+	rtn := clientControllerMap[name.String()]
+	if rtn == nil {
+		rtn = &K8sConn{Lock: &sync.Mutex{}, Status: Status_Init, Name: name}
+		clientControllerMap[name.String()] = rtn
+	}
+	return rtn
+}
+
+// gets the connection for a k8s:// connection name
+func GetK8sConn(ctx context.Context, connName string, shouldConnect bool) (*K8sConn, error) {
+	name, err := ParseK8sName(strings.TrimPrefix(connName, ConnPrefix))
+	if err != nil {
+		return nil, err
+	}
+	conn := getConnInternal(name)
+	if shouldConnect && conn.GetStatus() != Status_Connected {
+		conn.Connect(ctx)
+	}
+	return conn, nil
+}
+
+// Convenience function for ensuring a connection is established
+func EnsureConnection(ctx context.Context, connName string) error {
+	conn, err := GetK8sConn(ctx, connName, false)
+	if err != nil {
+		return err
+	}
+	connStatus := conn.DeriveConnStatus()
+	switch connStatus.Status {
+	case Status_Connected:
+		return nil
+	case Status_Connecting:
+		return conn.WaitForConnect(ctx)
+	case Status_Init, Status_Disconnected:
+		return conn.Connect(ctx)
+	case Status_Error:
+		return fmt.Errorf("connection error: %s", connStatus.Error)
+	default:
+		return fmt.Errorf("unknown connection status %q", connStatus.Status)
+	}
+}
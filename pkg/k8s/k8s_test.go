@@ -0,0 +1,145 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package k8s
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestParseK8sName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected K8sName
+	}{
+		{"default/web-0", K8sName{Namespace: "default", Pod: "web-0"}},
+		{"default/web-0/app", K8sName{Namespace: "default", Pod: "web-0", Container: "app"}},
+		{"prod/api-1@arn:aws:eks:us-east-1:123:cluster/prod", K8sName{Context: "arn:aws:eks:us-east-1:123:cluster/prod", Namespace: "prod", Pod: "api-1"}},
+	}
+	for _, test := range tests {
+		name, err := ParseK8sName(test.name)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if name != test.expected || name.String() != test.name {
+			t.Errorf("%s: got %+v (%s)", test.name, name, name.String())
+		}
+	}
+	for _, badName := range []string{"web-0", "default/", "a/b/c/d"} {
+		if _, err := ParseK8sName(badName); err == nil {
+			t.Errorf("%s: expected an error", badName)
+		}
+	}
+}
+
+// a fake api server: the pod, and an exec that echoes stdin (with the resize messages it got)
+// and exits with 3
+func startFakeApiServer(t *testing.T) string {
+	upgrader := websocket.Upgrader{Subprotocols: []string{ExecSubprotocolV5}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/namespaces/default/pods/web-0", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"spec": {"containers": [{"name": "app"}, {"name": "sidecar"}]}, "status": {"phase": "Running"}}`))
+	})
+	mux.HandleFunc("/api/v1/namespaces/default/pods/web-0/exec", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.Header.Get("Authorization") != "Bearer token" || query.Get("container") != "app" || query.Get("tty") != "true" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"kind": "Status", "status": "Failure", "message": "exec forbidden"}`))
+			return
+		}
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		for {
+			_, msg, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			switch msg[0] {
+			case execStream_Resize:
+				ws.WriteMessage(websocket.BinaryMessage, append([]byte{execStream_Stdout}, msg[1:]...))
+			case execStream_Stdin:
+				if string(msg[1:]) == "exit\n" {
+					status := `{"status": "Failure", "reason": "NonZeroExitCode", "details": {"causes": [{"reason": "ExitCode", "message": "3"}]}}`
+					ws.WriteMessage(websocket.BinaryMessage, append([]byte{execStream_Error}, status...))
+					ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+					return
+				}
+				ws.WriteMessage(websocket.BinaryMessage, append([]byte{execStream_Stdout}, msg[1:]...))
+			}
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func makeTestRestConfig(server string, token string) *restConfig {
+	return &restConfig{
+		Server:    server,
+		TLSConfig: &tls.Config{},
+		AuthFn: func(context.Context) (string, *tls.Certificate, error) {
+			return "Bearer " + token, nil, nil
+		},
+	}
+}
+
+func TestExec(t *testing.T) {
+	server := startFakeApiServer(t)
+	ctx, cancelFn := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFn()
+	config := makeTestRestConfig(server, "token")
+	pod, err := config.getPod(ctx, "default", "web-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pod.defaultContainer() != "app" || !pod.hasContainer("sidecar") {
+		t.Errorf("unexpected containers %+v", pod.Spec.Containers)
+	}
+	if _, err := config.getPod(ctx, "default", "web-1"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+	opts := ExecOpts{Namespace: "default", Pod: "web-0", Container: "app", Command: []string{"sh"}, Rows: 24, Cols: 80}
+	if _, err := openExec(ctx, makeTestRestConfig(server, "wrong"), opts); err == nil || !strings.Contains(err.Error(), "exec forbidden") {
+		t.Errorf("expected a forbidden error, got %v", err)
+	}
+	session, err := openExec(ctx, config, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	buf := make([]byte, 1024)
+	n, err := session.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var size map[string]int
+	if err := json.Unmarshal(buf[:n], &size); err != nil || size["Width"] != 80 || size["Height"] != 24 {
+		t.Errorf("unexpected resize %q", buf[:n])
+	}
+	session.Write([]byte("hello\n"))
+	n, err = session.Read(buf)
+	if err != nil || string(buf[:n]) != "hello\n" {
+		t.Errorf("got %q, %v", buf[:n], err)
+	}
+	session.Write([]byte("exit\n"))
+	if _, err := io.ReadAll(session); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Wait(); err != nil || session.ExitCode() != 3 {
+		t.Errorf("got exit code %d, %v", session.ExitCode(), err)
+	}
+}
@@ -0,0 +1,306 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the kubeconfig is read with "kubectl config view" (which merges KUBECONFIG's files and inlines
+// the referenced cert files), so kubectl has to be installed.  exec credential plugins (like
+// "aws eks get-token" or "gke-gcloud-auth-plugin") are run here, and their credentials are cached
+// until they expire.
+
+const KubectlTimeout = 15 * time.Second
+const ExecPluginTimeout = 60 * time.Second
+const DefaultExecCredentialTime = 10 * time.Minute
+
+type kubeConfig struct {
+	CurrentContext string             `json:"current-context"`
+	Contexts       []kubeNamedContext `json:"contexts"`
+	Clusters       []kubeNamedCluster `json:"clusters"`
+	Users          []kubeNamedUser    `json:"users"`
+}
+
+type kubeNamedContext struct {
+	Name    string `json:"name"`
+	Context struct {
+		Cluster   string `json:"cluster"`
+		User      string `json:"user"`
+		Namespace string `json:"namespace"`
+	} `json:"context"`
+}
+
+type kubeNamedCluster struct {
+	Name    string `json:"name"`
+	Cluster struct {
+		Server                   string `json:"server"`
+		CertificateAuthorityData string `json:"certificate-authority-data"`
+		InsecureSkipTlsVerify    bool   `json:"insecure-skip-tls-verify"`
+		TlsServerName            string `json:"tls-server-name"`
+	} `json:"cluster"`
+}
+
+type kubeNamedUser struct {
+	Name string   `json:"name"`
+	User kubeUser `json:"user"`
+}
+
+type kubeUser struct {
+	Token                 string          `json:"token"`
+	TokenFile             string          `json:"tokenFile"`
+	ClientCertificateData string          `json:"client-certificate-data"`
+	ClientKeyData         string          `json:"client-key-data"`
+	Username              string          `json:"username"`
+	Password              string          `json:"password"`
+	Exec                  *kubeExecConfig `json:"exec"`
+}
+
+type kubeExecConfig struct {
+	ApiVersion string   `json:"apiVersion"`
+	Command    string   `json:"command"`
+	Args       []string `json:"args"`
+	Env        []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"env"`
+}
+
+// the status of an ExecCredential (what an exec plugin prints)
+type execCredentialStatus struct {
+	Token                 string `json:"token"`
+	ClientCertificateData string `json:"clientCertificateData"`
+	ClientKeyData         string `json:"clientKeyData"`
+	ExpirationTimestamp   string `json:"expirationTimestamp"`
+}
+
+// how to talk to a context's api server
+type restConfig struct {
+	Context   string
+	Server    string
+	Namespace string // the context's default namespace
+	TLSConfig *tls.Config
+	AuthFn    func(ctx context.Context) (string, *tls.Certificate, error) // authorization header, client cert
+}
+
+type execCredentialCacheEntry struct {
+	Status    *execCredentialStatus
+	ExpiresAt time.Time
+}
+
+var execCredentialLock = &sync.Mutex{}
+var execCredentialCache = make(map[string]execCredentialCacheEntry)
+
+func runKubectl(ctx context.Context, args ...string) ([]byte, error) {
+	ctx, cancelFn := context.WithTimeout(ctx, KubectlTimeout)
+	defer cancelFn()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "kubectl", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, fmt.Errorf("kubectl was not found (it is used to read the kubeconfig)")
+		}
+		return nil, fmt.Errorf("kubectl %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// the kubeconfig, reduced to the context (the current context if contextName is empty)
+func readKubeConfig(ctx context.Context, contextName string) (*kubeConfig, error) {
+	args := []string{"config", "view", "--raw", "--flatten", "--minify", "--output", "json"}
+	if contextName != "" {
+		args = append(args, "--context", contextName)
+	}
+	out, err := runKubectl(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	var config kubeConfig
+	if err := json.Unmarshal(out, &config); err != nil {
+		return nil, fmt.Errorf("cannot parse the kubeconfig: %w", err)
+	}
+	return &config, nil
+}
+
+func decodeKubeData(data string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+}
+
+func makeRestConfig(config *kubeConfig) (*restConfig, error) {
+	if len(config.Contexts) == 0 {
+		return nil, fmt.Errorf("no kubernetes context found (is a kubeconfig set up?)")
+	}
+	kubeContext := config.Contexts[0]
+	rtn := &restConfig{Context: kubeContext.Name, Namespace: kubeContext.Context.Namespace}
+	for _, cluster := range config.Clusters {
+		if cluster.Name != kubeContext.Context.Cluster {
+			continue
+		}
+		rtn.Server = strings.TrimSuffix(cluster.Cluster.Server, "/")
+		rtn.TLSConfig = &tls.Config{
+			ServerName:         cluster.Cluster.TlsServerName,
+			InsecureSkipVerify: cluster.Cluster.InsecureSkipTlsVerify,
+		}
+		if cluster.Cluster.CertificateAuthorityData != "" {
+			caPem, err := decodeKubeData(cluster.Cluster.CertificateAuthorityData)
+			if err != nil {
+				return nil, fmt.Errorf("cluster %s: bad certificate-authority-data: %w", cluster.Name, err)
+			}
+			rtn.TLSConfig.RootCAs = x509.NewCertPool()
+			if !rtn.TLSConfig.RootCAs.AppendCertsFromPEM(caPem) {
+				return nil, fmt.Errorf("cluster %s: no certificates in certificate-authority-data", cluster.Name)
+			}
+		}
+	}
+	if rtn.Server == "" {
+		return nil, fmt.Errorf("context %s: cluster %q has no server", kubeContext.Name, kubeContext.Context.Cluster)
+	}
+	var user kubeUser
+	for _, namedUser := range config.Users {
+		if namedUser.Name == kubeContext.Context.User {
+			user = namedUser.User
+		}
+	}
+	authFn, err := makeAuthFn(kubeContext.Name, user)
+	if err != nil {
+		return nil, fmt.Errorf("context %s: %w", kubeContext.Name, err)
+	}
+	rtn.AuthFn = authFn
+	return rtn, nil
+}
+
+func makeClientCert(certData []byte, keyData []byte) (*tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(certData, keyData)
+	if err != nil {
+		return nil, fmt.Errorf("bad client certificate: %w", err)
+	}
+	return &cert, nil
+}
+
+func makeAuthFn(contextName string, user kubeUser) (func(ctx context.Context) (string, *tls.Certificate, error), error) {
+	var clientCert *tls.Certificate
+	if user.ClientCertificateData != "" {
+		certData, err := decodeKubeData(user.ClientCertificateData)
+		if err != nil {
+			return nil, fmt.Errorf("bad client-certificate-data: %w", err)
+		}
+		keyData, err := decodeKubeData(user.ClientKeyData)
+		if err != nil {
+			return nil, fmt.Errorf("bad client-key-data: %w", err)
+		}
+		clientCert, err = makeClientCert(certData, keyData)
+		if err != nil {
+			return nil, err
+		}
+	}
+	token := user.Token
+	if token == "" && user.TokenFile != "" {
+		tokenData, err := os.ReadFile(user.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read tokenFile: %w", err)
+		}
+		token = strings.TrimSpace(string(tokenData))
+	}
+	switch {
+	case user.Exec != nil:
+		return func(ctx context.Context) (string, *tls.Certificate, error) {
+			return getExecCredential(ctx, contextName, user.Exec)
+		}, nil
+	case token != "":
+		return func(context.Context) (string, *tls.Certificate, error) {
+			return "Bearer " + token, clientCert, nil
+		}, nil
+	case user.Username != "":
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(user.Username + ":" + user.Password))
+		return func(context.Context) (string, *tls.Certificate, error) {
+			return "Basic " + basicAuth, clientCert, nil
+		}, nil
+	default:
+		return func(context.Context) (string, *tls.Certificate, error) {
+			return "", clientCert, nil
+		}, nil
+	}
+}
+
+func runExecPlugin(ctx context.Context, execConfig *kubeExecConfig) (*execCredentialStatus, error) {
+	ctx, cancelFn := context.WithTimeout(ctx, ExecPluginTimeout)
+	defer cancelFn()
+	execInfo, _ := json.Marshal(map[string]any{
+		"apiVersion": execConfig.ApiVersion,
+		"kind":       "ExecCredential",
+		"spec":       map[string]any{"interactive": false},
+	})
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, execConfig.Command, execConfig.Args...)
+	cmd.Env = append(os.Environ(), "KUBERNETES_EXEC_INFO="+string(execInfo))
+	for _, envVar := range execConfig.Env {
+		cmd.Env = append(cmd.Env, envVar.Name+"="+envVar.Value)
+	}
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("credential plugin %s: %w: %s", execConfig.Command, err, strings.TrimSpace(stderr.String()))
+	}
+	var credential struct {
+		Status *execCredentialStatus `json:"status"`
+	}
+	if err := json.Unmarshal(out, &credential); err != nil || credential.Status == nil {
+		return nil, fmt.Errorf("credential plugin %s: unexpected output", execConfig.Command)
+	}
+	return credential.Status, nil
+}
+
+// the credentials from the context's exec plugin (cached until they expire)
+func getExecCredential(ctx context.Context, contextName string, execConfig *kubeExecConfig) (string, *tls.Certificate, error) {
+	execCredentialLock.Lock()
+	defer execCredentialLock.Unlock()
+	entry, ok := execCredentialCache[contextName]
+	if !ok || time.Now().After(entry.ExpiresAt) {
+		status, err := runExecPlugin(ctx, execConfig)
+		if err != nil {
+			return "", nil, err
+		}
+		entry = execCredentialCacheEntry{Status: status, ExpiresAt: time.Now().Add(DefaultExecCredentialTime)}
+		if expiresAt, err := time.Parse(time.RFC3339, status.ExpirationTimestamp); err == nil {
+			// refresh a little early
+			entry.ExpiresAt = expiresAt.Add(-30 * time.Second)
+		}
+		execCredentialCache[contextName] = entry
+	}
+	var clientCert *tls.Certificate
+	if entry.Status.ClientCertificateData != "" {
+		var err error
+		clientCert, err = makeClientCert([]byte(entry.Status.ClientCertificateData), []byte(entry.Status.ClientKeyData))
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	if entry.Status.Token == "" {
+		return "", clientCert, nil
+	}
+	return "Bearer " + entry.Status.Token, clientCert, nil
+}
+
+// the tls config for a request (with the client cert, which may come from an exec plugin)
+func (rc *restConfig) makeTLSConfig(clientCert *tls.Certificate) *tls.Config {
+	tlsConfig := rc.TLSConfig.Clone()
+	if clientCert != nil {
+		tlsConfig.Certificates = []tls.Certificate{*clientCert}
+	}
+	return tlsConfig
+}
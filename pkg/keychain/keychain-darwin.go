@@ -0,0 +1,69 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build darwin
+
+package keychain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// the macOS Keychain, through the security tool (the secret is written to "security -i" on stdin
+// so it never shows up in the process list)
+
+const securityPath = "/usr/bin/security"
+
+// "security" exits with 44 (errSecItemNotFound) when there is no such item
+const securityNotFoundExitCode = 44
+
+func backendAvailable() bool {
+	_, err := exec.LookPath(securityPath)
+	return err == nil
+}
+
+func runSecurity(stdin string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(securityPath, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == securityNotFoundExitCode {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("security: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// quotes an argument for the "security -i" command line (which splits like a shell)
+func quoteSecurityArg(arg string) string {
+	return "'" + strings.ReplaceAll(arg, "'", `'"'"'`) + "'"
+}
+
+func backendGet(key string) (string, error) {
+	out, err := runSecurity("", "find-generic-password", "-s", ServiceName, "-a", key, "-w")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(out, "\n"), nil
+}
+
+func backendSet(key string, label string, secret string) error {
+	cmdLine := fmt.Sprintf("add-generic-password -U -s %s -a %s -l %s -w %s\n",
+		quoteSecurityArg(ServiceName), quoteSecurityArg(key), quoteSecurityArg(label), quoteSecurityArg(secret))
+	_, err := runSecurity(cmdLine, "-i")
+	return err
+}
+
+func backendDelete(key string) error {
+	_, err := runSecurity("", "delete-generic-password", "-s", ServiceName, "-a", key)
+	return err
+}
@@ -0,0 +1,58 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !darwin && !windows
+
+package keychain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// the Secret Service (gnome-keyring, kwallet, keepassxc) through libsecret's secret-tool.  the
+// secret is passed on stdin.  secret-tool needs a session bus, so there is no keychain without one.
+
+func backendAvailable() bool {
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		return false
+	}
+	_, err := exec.LookPath("secret-tool")
+	return err == nil
+}
+
+func runSecretTool(stdin string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("secret-tool", args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && stderr.Len() == 0 {
+			// lookup and clear exit with 1 (and print nothing) when there is no such secret
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("secret-tool: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+func backendGet(key string) (string, error) {
+	return runSecretTool("", "lookup", "service", ServiceName, "account", key)
+}
+
+func backendSet(key string, label string, secret string) error {
+	_, err := runSecretTool(secret, "store", "--label="+label, "service", ServiceName, "account", key)
+	return err
+}
+
+func backendDelete(key string) error {
+	_, err := runSecretTool("", "clear", "service", ServiceName, "account", key)
+	return err
+}
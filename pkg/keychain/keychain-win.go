@@ -0,0 +1,120 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build windows
+
+package keychain
+
+import (
+	"errors"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// the Windows Credential Manager (generic credentials named waveterm:<key>)
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+)
+
+var (
+	modAdvapi32     = windows.NewLazySystemDLL("advapi32.dll")
+	procCredReadW   = modAdvapi32.NewProc("CredReadW")
+	procCredWriteW  = modAdvapi32.NewProc("CredWriteW")
+	procCredDeleteW = modAdvapi32.NewProc("CredDeleteW")
+	procCredFree    = modAdvapi32.NewProc("CredFree")
+)
+
+// CREDENTIALW
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        windows.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+func backendAvailable() bool {
+	return modAdvapi32.Load() == nil && procCredReadW.Find() == nil
+}
+
+func credTarget(key string) (*uint16, error) {
+	return windows.UTF16PtrFromString(ServiceName + ":" + key)
+}
+
+func credError(err error) error {
+	if errors.Is(err, windows.ERROR_NOT_FOUND) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func backendGet(key string) (string, error) {
+	target, err := credTarget(key)
+	if err != nil {
+		return "", err
+	}
+	var cred *credential
+	ret, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred)))
+	if ret == 0 {
+		return "", credError(err)
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+	if cred.CredentialBlobSize == 0 {
+		return "", nil
+	}
+	return string(unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)), nil
+}
+
+func backendSet(key string, label string, secret string) error {
+	target, err := credTarget(key)
+	if err != nil {
+		return err
+	}
+	comment, err := windows.UTF16PtrFromString(label)
+	if err != nil {
+		return err
+	}
+	userName, err := windows.UTF16PtrFromString(ServiceName)
+	if err != nil {
+		return err
+	}
+	cred := credential{
+		Type:               credTypeGeneric,
+		TargetName:         target,
+		Comment:            comment,
+		CredentialBlobSize: uint32(len(secret)),
+		Persist:            credPersistLocalMachine,
+		UserName:           userName,
+	}
+	if len(secret) > 0 {
+		blob := []byte(secret)
+		cred.CredentialBlob = &blob[0]
+	}
+	ret, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0)
+	if ret == 0 {
+		return err
+	}
+	return nil
+}
+
+func backendDelete(key string) error {
+	target, err := credTarget(key)
+	if err != nil {
+		return err
+	}
+	ret, _, err := procCredDeleteW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0)
+	if ret == 0 {
+		return credError(err)
+	}
+	return nil
+}
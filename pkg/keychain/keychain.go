@@ -0,0 +1,174 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// stores ssh passwords, key passphrases, and totp secrets in the os keychain (the macOS Keychain, the Windows
+// Credential Manager, or the Secret Service through libsecret).  the os keychains can't all be
+// enumerated, so the names of the stored secrets (never the secrets) are also kept in an index
+// file in the data dir, which is what List returns.
+package keychain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wlog"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const ServiceName = "waveterm"
+const IndexFileName = "keychain_index.json"
+
+const (
+	Kind_Password   = "password"
+	Kind_Passphrase = "passphrase"
+	Kind_Totp       = "totp"
+)
+
+// offered on password and passphrase prompts when a keychain is available
+const SaveCheckboxMsg = "Save in the system keychain"
+
+var ErrNotFound = errors.New("secret not found in the keychain")
+
+var indexLock = &sync.Mutex{}
+var keychainLog = wlog.Logger("keychain")
+
+// the key of the password for user@host:port
+func PasswordKey(target string) string {
+	return Kind_Password + ":" + target
+}
+
+// the key of the passphrase of an identity file
+func PassphraseKey(identityFile string) string {
+	return Kind_Passphrase + ":" + identityFile
+}
+
+// the key of the totp secret of a connection
+func TotpKey(connection string) string {
+	return Kind_Totp + ":" + connection
+}
+
+// whether a keychain backend is available (prompts only offer to save secrets when it is)
+func Available() bool {
+	return backendAvailable()
+}
+
+// whether a secret is stored under key (from the index, the keychain isn't asked)
+func Has(key string) bool {
+	indexLock.Lock()
+	defer indexLock.Unlock()
+	_, ok := readIndex()[key]
+	return ok
+}
+
+// the stored secret for key (ErrNotFound if there is none).  only keys in the index are looked up,
+// so connecting doesn't ask the keychain (which may prompt to unlock it) when nothing was saved.
+func Get(key string) (string, error) {
+	if !Has(key) || !backendAvailable() {
+		return "", ErrNotFound
+	}
+	return backendGet(key)
+}
+
+// stores secret under key, connection is the connection it was entered for ("" for passphrases,
+// which belong to the key file)
+func Set(key string, connection string, secret string) error {
+	if !backendAvailable() {
+		return fmt.Errorf("no keychain is available")
+	}
+	if strings.ContainsAny(secret, "\r\n") {
+		return fmt.Errorf("cannot store a secret with a newline in the keychain")
+	}
+	kind, target, ok := strings.Cut(key, ":")
+	if !ok {
+		return fmt.Errorf("invalid keychain key %q", key)
+	}
+	label := fmt.Sprintf("Wave Terminal SSH %s (%s)", kind, target)
+	if err := backendSet(key, label, secret); err != nil {
+		return err
+	}
+	return updateIndex(func(index map[string]wshrpc.StoredSecret) {
+		index[key] = wshrpc.StoredSecret{
+			Key:        key,
+			Kind:       kind,
+			Target:     target,
+			Connection: connection,
+			CreatedTs:  time.Now().UnixMilli(),
+		}
+	})
+}
+
+// deletes the secret (a secret that is already gone is not an error)
+func Delete(key string) error {
+	if backendAvailable() {
+		if err := backendDelete(key); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	return updateIndex(func(index map[string]wshrpc.StoredSecret) {
+		delete(index, key)
+	})
+}
+
+// deletes every secret in the index
+func DeleteAll() error {
+	var firstErr error
+	for _, secret := range List() {
+		if err := Delete(secret.Key); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// the stored secrets (from the index, sorted by key)
+func List() []wshrpc.StoredSecret {
+	indexLock.Lock()
+	defer indexLock.Unlock()
+	index := readIndex()
+	rtn := make([]wshrpc.StoredSecret, 0, len(index))
+	for _, secret := range index {
+		rtn = append(rtn, secret)
+	}
+	sort.Slice(rtn, func(i, j int) bool { return rtn[i].Key < rtn[j].Key })
+	return rtn
+}
+
+func indexPath() string {
+	return filepath.Join(wavebase.GetWaveDataDir(), IndexFileName)
+}
+
+func readIndex() map[string]wshrpc.StoredSecret {
+	index := make(map[string]wshrpc.StoredSecret)
+	data, err := os.ReadFile(indexPath())
+	if err != nil {
+		return index
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		keychainLog.Warn("invalid keychain index", "err", err)
+	}
+	return index
+}
+
+func updateIndex(fn func(index map[string]wshrpc.StoredSecret)) error {
+	indexLock.Lock()
+	defer indexLock.Unlock()
+	index := readIndex()
+	fn(index)
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := indexPath() + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, indexPath())
+}
@@ -0,0 +1,81 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !darwin && !windows
+
+package keychain
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+)
+
+// a secret-tool that keeps the secrets in files (named by the hex of the account)
+const fakeSecretTool = `#!/bin/sh
+cmd=$1
+eval "key=\${$#}"
+f="$FAKE_SECRET_DIR/$(printf %s "$key" | od -An -tx1 | tr -d ' \n')"
+case $cmd in
+store) cat > "$f" ;;
+lookup) [ -f "$f" ] || exit 1; cat "$f" ;;
+clear) [ -f "$f" ] || exit 1; rm "$f" ;;
+esac
+`
+
+func TestSecretServiceKeychain(t *testing.T) {
+	binDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(binDir, "secret-tool"), []byte(fakeSecretTool), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+":/usr/bin:/bin")
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", "unix:path=/nonexistent")
+	t.Setenv("FAKE_SECRET_DIR", t.TempDir())
+	oldDataDir := wavebase.DataHome_VarCache
+	wavebase.DataHome_VarCache = t.TempDir()
+	defer func() { wavebase.DataHome_VarCache = oldDataDir }()
+
+	if !Available() {
+		t.Fatal("expected the secret service to be available")
+	}
+	passwordKey := PasswordKey("user@host:2222")
+	passphraseKey := PassphraseKey("/home/user/.ssh/id_ed25519")
+	if _, err := Get(passwordKey); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	if err := Set(passwordKey, "user@host:2222", "hunter2 'quoted'"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := Set(passphraseKey, "", "correct horse"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := Set(passwordKey, "", "two\nlines"); err == nil {
+		t.Errorf("expected an error for a secret with a newline")
+	}
+	if secret, err := Get(passwordKey); err != nil || secret != "hunter2 'quoted'" {
+		t.Errorf("Get: %q, %v", secret, err)
+	}
+	secrets := List()
+	if len(secrets) != 2 || secrets[0].Key != passphraseKey || secrets[1].Kind != Kind_Password || secrets[1].Target != "user@host:2222" {
+		t.Errorf("unexpected list %+v", secrets)
+	}
+	if err := Delete(passwordKey); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if Has(passwordKey) {
+		t.Errorf("deleted key is still in the index")
+	}
+	// a secret that is gone from the keychain is still removed from the index
+	if err := backendDelete(passphraseKey); err != nil {
+		t.Fatalf("backendDelete: %v", err)
+	}
+	if err := DeleteAll(); err != nil {
+		t.Fatalf("DeleteAll: %v", err)
+	}
+	if len(List()) != 0 {
+		t.Errorf("expected an empty list, got %+v", List())
+	}
+}
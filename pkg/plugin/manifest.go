@@ -0,0 +1,96 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const PluginsDirName = "plugins"
+const ManifestFileName = "plugin.json"
+
+var pluginNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+var commandNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_:.-]*$`)
+
+func GetPluginsDir() string {
+	return filepath.Join(wavebase.GetWaveConfigDir(), PluginsDirName)
+}
+
+func validateManifest(manifest *wshrpc.PluginManifest) error {
+	if !pluginNameRe.MatchString(manifest.Name) {
+		return fmt.Errorf("invalid plugin name %q (lowercase letters, digits, '-' and '_')", manifest.Name)
+	}
+	if manifest.Command == "" {
+		return fmt.Errorf("plugin %q has no command", manifest.Name)
+	}
+	for _, perm := range manifest.Permissions {
+		if _, ok := PermissionScopes[perm]; !ok {
+			return fmt.Errorf("plugin %q requests unknown permission %q", manifest.Name, perm)
+		}
+	}
+	for _, command := range manifest.Commands {
+		if !commandNameRe.MatchString(command) {
+			return fmt.Errorf("plugin %q declares invalid command %q", manifest.Name, command)
+		}
+	}
+	for _, view := range manifest.Views {
+		if view.Name == "" {
+			return fmt.Errorf("plugin %q declares a view with no name", manifest.Name)
+		}
+	}
+	return nil
+}
+
+// reads and validates plugin.json in dir.  the plugin name must match the directory name.
+func readManifest(dir string) (*wshrpc.PluginManifest, error) {
+	barr, err := os.ReadFile(filepath.Join(dir, ManifestFileName))
+	if err != nil {
+		return nil, err
+	}
+	var manifest wshrpc.PluginManifest
+	if err := json.Unmarshal(barr, &manifest); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", ManifestFileName, err)
+	}
+	if err := validateManifest(&manifest); err != nil {
+		return nil, err
+	}
+	if manifest.Name != filepath.Base(dir) {
+		return nil, fmt.Errorf("plugin name %q does not match its directory %q", manifest.Name, filepath.Base(dir))
+	}
+	return &manifest, nil
+}
+
+// reads every manifest in the plugins directory (invalid manifests are logged and skipped)
+func readAllManifests() map[string]*wshrpc.PluginManifest {
+	rtn := make(map[string]*wshrpc.PluginManifest)
+	entries, err := os.ReadDir(GetPluginsDir())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("error reading plugins directory: %v\n", err)
+		}
+		return rtn
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		manifest, err := readManifest(filepath.Join(GetPluginsDir(), entry.Name()))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.Printf("[plugin:%s] skipping plugin: %v\n", entry.Name(), err)
+			}
+			continue
+		}
+		rtn[manifest.Name] = manifest
+	}
+	return rtn
+}
@@ -0,0 +1,106 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package plugin
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+// a plugin may only call the rpc commands in the scopes its manifest asks for.  calls to other
+// plugins need the "plugins" scope (and are checked again by the receiving plugin's declared
+// commands).  the scopes are enforced on the plugin's route, so a plugin can't get around them by
+// setting its own source or route.
+
+const (
+	Scope_BlocksRead = "blocks:read"
+	Scope_Blocks     = "blocks"
+	Scope_BlockFiles = "blockfiles"
+	Scope_Events     = "events"
+	Scope_VDom       = "vdom"
+	Scope_Files      = "files"
+	Scope_Notify     = "notify"
+	Scope_Conns      = "connections"
+	Scope_Plugins    = "plugins"
+)
+
+var PermissionScopes = map[string][]string{
+	Scope_BlocksRead: {wshrpc.Command_GetMeta, wshrpc.Command_BlockInfo, wshrpc.Command_ResolveIds},
+	Scope_Blocks: {
+		wshrpc.Command_GetMeta, wshrpc.Command_BlockInfo, wshrpc.Command_ResolveIds,
+		wshrpc.Command_SetMeta, wshrpc.Command_CreateBlock, wshrpc.Command_DeleteBlock, wshrpc.Command_SetView,
+	},
+	Scope_BlockFiles: {wshrpc.Command_FileRead, wshrpc.Command_FileWrite, wshrpc.Command_FileAppend, wshrpc.Command_FileAppendIJson},
+	Scope_Events: {
+		wshrpc.Command_EventPublish, wshrpc.Command_EventSub, wshrpc.Command_EventUnsub,
+		wshrpc.Command_EventUnsubAll, wshrpc.Command_EventReadHistory,
+	},
+	Scope_VDom: {wshrpc.Command_VDomCreateContext, wshrpc.Command_VDomAsyncInitiation},
+	Scope_Files: {
+		wshrpc.Command_RemoteStreamFile, wshrpc.Command_RemoteFileInfo, wshrpc.Command_RemoteFileTouch,
+		wshrpc.Command_RemoteWriteFile, wshrpc.Command_RemoteFileDelete, wshrpc.Command_RemoteFileJoin,
+		wshrpc.Command_RemoteMkdir, wshrpc.Command_RemoteListEntries, wshrpc.Command_RemoteReadLines,
+		wshrpc.Command_RemoteSearchFile,
+	},
+	Scope_Notify:  {wshrpc.Command_Notify},
+	Scope_Conns:   {wshrpc.Command_ConnStatus, wshrpc.Command_ConnList, wshrpc.Command_ConnEnsure},
+	Scope_Plugins: {},
+}
+
+// commands any plugin may send
+var alwaysAllowedCommands = map[string]bool{
+	wshrpc.Command_Message: true,
+}
+
+func hasPermission(manifest *wshrpc.PluginManifest, scope string) bool {
+	for _, perm := range manifest.Permissions {
+		if perm == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// checks a command sent by the plugin
+func checkOutgoingCommand(manifest *wshrpc.PluginManifest, msg *wshutil.RpcMessage) error {
+	if strings.HasPrefix(msg.Route, "plugin:") && msg.Route != wshutil.MakePluginRouteId(manifest.Name) {
+		if !hasPermission(manifest, Scope_Plugins) {
+			return fmt.Errorf("plugin %q does not have the %q permission (calling %q on %s)", manifest.Name, Scope_Plugins, msg.Command, msg.Route)
+		}
+		return nil
+	}
+	if alwaysAllowedCommands[msg.Command] {
+		return nil
+	}
+	for _, perm := range manifest.Permissions {
+		for _, command := range PermissionScopes[perm] {
+			if command == msg.Command {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("plugin %q is not permitted to call %q", manifest.Name, msg.Command)
+}
+
+// checks a command sent to the plugin.  plugins only receive the commands they declare, events
+// they subscribed to, and vdom renders when they have views.
+func checkIncomingCommand(manifest *wshrpc.PluginManifest, msg *wshutil.RpcMessage) error {
+	switch msg.Command {
+	case wshrpc.Command_EventRecv:
+		return nil
+	case wshrpc.Command_VDomRender, wshrpc.Command_VDomUrlRequest:
+		if len(manifest.Views) > 0 {
+			return nil
+		}
+	}
+	for _, command := range manifest.Commands {
+		if command == msg.Command {
+			return nil
+		}
+	}
+	return fmt.Errorf("plugin %q does not handle command %q", manifest.Name, msg.Command)
+}
@@ -0,0 +1,476 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// plugins are sidecar processes that speak the wshrpc protocol (packets on stdin/stdout, see
+// packetparser).  each plugin is registered on the router as "plugin:<name>", so it can render
+// vdom blocks (blocks with "vdom:route" set to its route) and handle the rpc commands its
+// manifest declares.  the commands a plugin can call are limited by its permission scopes.
+// plugins that exit unexpectedly are restarted with a backoff, until they crash too often.
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/util/packetparser"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+const MaxRestarts = 5
+const RestartBaseDelay = 1 * time.Second
+const StableRunTime = 1 * time.Minute // a plugin that ran this long has its restart count reset
+const StopGraceTime = 2 * time.Second // time to exit after stdin is closed, before it is killed
+const OutChSize = 32
+
+type pluginProc struct {
+	Cmd     *exec.Cmd
+	Stdin   io.WriteCloser
+	Client  *pluginRpcClient
+	Started time.Time
+}
+
+type Plugin struct {
+	Manifest      *wshrpc.PluginManifest
+	Dir           string
+	Status        string
+	Restarts      int
+	LastError     string
+	Proc          *pluginProc // nil when not running
+	StopRequested bool
+	RestartTimer  *time.Timer
+}
+
+var globalLock = &sync.Mutex{}
+var plugins = make(map[string]*Plugin)
+
+// reads the manifests and starts the autostart plugins
+func LoadPlugins() {
+	Reload()
+	globalLock.Lock()
+	var autoStart []string
+	for name, p := range plugins {
+		if p.Manifest.AutoStart {
+			autoStart = append(autoStart, name)
+		}
+	}
+	globalLock.Unlock()
+	for _, name := range autoStart {
+		if err := Start(name); err != nil {
+			log.Printf("[plugin:%s] error starting plugin: %v\n", name, err)
+		}
+	}
+}
+
+// re-reads the manifests.  removed plugins are stopped, and running plugins whose manifest changed
+// are restarted.
+func Reload() {
+	manifests := readAllManifests()
+	var toRestart []string
+	globalLock.Lock()
+	for name, p := range plugins {
+		if manifests[name] == nil {
+			p.stop()
+			delete(plugins, name)
+		}
+	}
+	for name, manifest := range manifests {
+		p := plugins[name]
+		if p == nil {
+			plugins[name] = &Plugin{
+				Manifest: manifest,
+				Dir:      filepath.Join(GetPluginsDir(), name),
+				Status:   wshrpc.PluginStatus_Stopped,
+			}
+			continue
+		}
+		if reflect.DeepEqual(p.Manifest, manifest) {
+			continue
+		}
+		p.Manifest = manifest
+		if p.Proc != nil {
+			toRestart = append(toRestart, name)
+		}
+	}
+	globalLock.Unlock()
+	for _, name := range toRestart {
+		if err := Restart(name); err != nil {
+			log.Printf("[plugin:%s] error restarting plugin: %v\n", name, err)
+		}
+	}
+}
+
+func getPlugin(name string) (*Plugin, error) {
+	p := plugins[name]
+	if p == nil {
+		return nil, fmt.Errorf("plugin %q not found", name)
+	}
+	return p, nil
+}
+
+func Start(name string) error {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+	p, err := getPlugin(name)
+	if err != nil {
+		return err
+	}
+	if p.Proc != nil {
+		return nil
+	}
+	// starting by hand resets a failed plugin
+	p.Restarts = 0
+	p.StopRequested = false
+	return p.start()
+}
+
+func Stop(name string) error {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+	p, err := getPlugin(name)
+	if err != nil {
+		return err
+	}
+	p.stop()
+	return nil
+}
+
+// stops the plugin, waits for it to exit (up to the grace time) and starts it again
+func Restart(name string) error {
+	globalLock.Lock()
+	p, err := getPlugin(name)
+	if err != nil {
+		globalLock.Unlock()
+		return err
+	}
+	proc := p.Proc
+	p.stop()
+	globalLock.Unlock()
+	if proc != nil {
+		proc.Client.waitDone(2 * StopGraceTime)
+	}
+	return Start(name)
+}
+
+func StopAll() {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+	for _, p := range plugins {
+		p.stop()
+	}
+}
+
+func List() []wshrpc.PluginInfo {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+	rtn := make([]wshrpc.PluginInfo, 0, len(plugins))
+	for name, p := range plugins {
+		info := wshrpc.PluginInfo{
+			Manifest:  *p.Manifest,
+			Dir:       p.Dir,
+			Route:     wshutil.MakePluginRouteId(name),
+			Status:    p.Status,
+			Restarts:  p.Restarts,
+			LastError: p.LastError,
+		}
+		if p.Proc != nil && p.Proc.Cmd.Process != nil {
+			info.Pid = p.Proc.Cmd.Process.Pid
+		}
+		rtn = append(rtn, info)
+	}
+	sort.Slice(rtn, func(i, j int) bool { return rtn[i].Manifest.Name < rtn[j].Manifest.Name })
+	return rtn
+}
+
+func (p *Plugin) resolveCommand() (string, error) {
+	command := p.Manifest.Command
+	if filepath.IsAbs(command) {
+		return command, nil
+	}
+	localPath := filepath.Join(p.Dir, command)
+	if _, err := os.Stat(localPath); err == nil {
+		return localPath, nil
+	}
+	return exec.LookPath(command)
+}
+
+// call with globalLock held
+func (p *Plugin) start() error {
+	if p.RestartTimer != nil {
+		p.RestartTimer.Stop()
+		p.RestartTimer = nil
+	}
+	name := p.Manifest.Name
+	routeId := wshutil.MakePluginRouteId(name)
+	cmdPath, err := p.resolveCommand()
+	if err != nil {
+		p.Status = wshrpc.PluginStatus_Failed
+		p.LastError = err.Error()
+		return fmt.Errorf("cannot find plugin command %q: %w", p.Manifest.Command, err)
+	}
+	cmd := exec.Command(cmdPath, p.Manifest.Args...)
+	cmd.Dir = p.Dir
+	cmd.Env = os.Environ()
+	for key, val := range p.Manifest.Env {
+		cmd.Env = append(cmd.Env, key+"="+val)
+	}
+	cmd.Env = append(cmd.Env, "WAVETERM_PLUGIN_NAME="+name, "WAVETERM_PLUGIN_ROUTE="+routeId, "WAVETERM_PLUGIN_DIR="+p.Dir)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		p.Status = wshrpc.PluginStatus_Failed
+		p.LastError = err.Error()
+		return fmt.Errorf("error starting plugin: %w", err)
+	}
+	log.Printf("[plugin:%s] started (pid %d)\n", name, cmd.Process.Pid)
+	client := makePluginRpcClient(p.Manifest, stdin)
+	proc := &pluginProc{Cmd: cmd, Stdin: stdin, Client: client, Started: time.Now()}
+	p.Proc = proc
+	p.Status = wshrpc.PluginStatus_Running
+	p.LastError = ""
+	wshutil.DefaultRouter.RegisterRoute(routeId, client, true)
+	go func() {
+		defer panichandler.PanicHandler("plugin:logStderr")
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			log.Printf("[plugin:%s] %s\n", name, scanner.Text())
+		}
+	}()
+	go func() {
+		defer panichandler.PanicHandler("plugin:runProc")
+		client.readOutput(stdout)
+		waitErr := cmd.Wait()
+		p.handleExit(proc, waitErr)
+	}()
+	return nil
+}
+
+// call with globalLock held
+func (p *Plugin) stop() {
+	p.StopRequested = true
+	if p.RestartTimer != nil {
+		p.RestartTimer.Stop()
+		p.RestartTimer = nil
+	}
+	if p.Proc == nil {
+		if p.Status != wshrpc.PluginStatus_Failed {
+			p.Status = wshrpc.PluginStatus_Stopped
+		}
+		return
+	}
+	proc := p.Proc
+	// plugins should exit when stdin is closed, ones that don't are killed
+	proc.Stdin.Close()
+	time.AfterFunc(StopGraceTime, func() {
+		if !proc.Client.waitDone(0) {
+			proc.Cmd.Process.Kill()
+		}
+	})
+}
+
+func (p *Plugin) handleExit(proc *pluginProc, waitErr error) {
+	name := proc.Client.Manifest.Name
+	wshutil.DefaultRouter.UnregisterRoute(wshutil.MakePluginRouteId(name))
+	proc.Client.close()
+	globalLock.Lock()
+	defer globalLock.Unlock()
+	if p.Proc != proc {
+		return
+	}
+	p.Proc = nil
+	if p.StopRequested {
+		log.Printf("[plugin:%s] stopped\n", name)
+		p.Status = wshrpc.PluginStatus_Stopped
+		return
+	}
+	if waitErr != nil {
+		p.LastError = fmt.Sprintf("plugin exited: %v", waitErr)
+	} else {
+		p.LastError = "plugin exited"
+	}
+	if time.Since(proc.Started) > StableRunTime {
+		p.Restarts = 0
+	}
+	if p.Restarts >= MaxRestarts {
+		log.Printf("[plugin:%s] %s, not restarting (restarted %d times)\n", name, p.LastError, p.Restarts)
+		p.Status = wshrpc.PluginStatus_Failed
+		return
+	}
+	delay := RestartBaseDelay << p.Restarts
+	p.Restarts++
+	p.Status = wshrpc.PluginStatus_Stopped
+	log.Printf("[plugin:%s] %s, restarting in %v\n", name, p.LastError, delay)
+	p.RestartTimer = time.AfterFunc(delay, func() {
+		globalLock.Lock()
+		defer globalLock.Unlock()
+		if p.StopRequested || p.Proc != nil || plugins[name] != p {
+			return
+		}
+		p.RestartTimer = nil
+		if err := p.start(); err != nil {
+			log.Printf("[plugin:%s] error restarting plugin: %v\n", name, err)
+		}
+	})
+}
+
+// the router side of a plugin's stdin/stdout.  messages are checked against the plugin's
+// permissions in both directions, denied commands get an error response.
+type pluginRpcClient struct {
+	Manifest  *wshrpc.PluginManifest
+	RouteId   string
+	WriteLock *sync.Mutex
+	Stdin     io.Writer
+	OutCh     chan []byte
+	CloseOnce *sync.Once
+	DoneCh    chan struct{}
+}
+
+func makePluginRpcClient(manifest *wshrpc.PluginManifest, stdin io.Writer) *pluginRpcClient {
+	return &pluginRpcClient{
+		Manifest:  manifest,
+		RouteId:   wshutil.MakePluginRouteId(manifest.Name),
+		WriteLock: &sync.Mutex{},
+		Stdin:     stdin,
+		OutCh:     make(chan []byte, OutChSize),
+		CloseOnce: &sync.Once{},
+		DoneCh:    make(chan struct{}),
+	}
+}
+
+func makeErrorResponse(msg *wshutil.RpcMessage, err error) []byte {
+	barr, _ := json.Marshal(wshutil.RpcMessage{ResId: msg.ReqId, Error: err.Error()})
+	return barr
+}
+
+func (c *pluginRpcClient) writePacket(msgBytes []byte) error {
+	c.WriteLock.Lock()
+	defer c.WriteLock.Unlock()
+	return packetparser.WritePacket(c.Stdin, msgBytes)
+}
+
+// a message routed to the plugin
+func (c *pluginRpcClient) SendRpcMessage(msgBytes []byte) {
+	var msg wshutil.RpcMessage
+	if err := json.Unmarshal(msgBytes, &msg); err != nil {
+		return
+	}
+	if msg.Command != "" {
+		if err := checkIncomingCommand(c.Manifest, &msg); err != nil {
+			if msg.ReqId != "" {
+				c.sendOut(makeErrorResponse(&msg, err))
+			}
+			return
+		}
+	}
+	if err := c.writePacket(msgBytes); err != nil && msg.Command != "" && msg.ReqId != "" {
+		c.sendOut(makeErrorResponse(&msg, fmt.Errorf("plugin %q is not running", c.Manifest.Name)))
+	}
+}
+
+// OutCh is never closed (plugin output may still be sent to it), so the router's read loop ends
+// on DoneCh, once the queued messages are read
+func (c *pluginRpcClient) RecvRpcMessage() ([]byte, bool) {
+	select {
+	case msgBytes := <-c.OutCh:
+		return msgBytes, true
+	default:
+	}
+	select {
+	case msgBytes := <-c.OutCh:
+		return msgBytes, true
+	case <-c.DoneCh:
+		return nil, false
+	}
+}
+
+func (c *pluginRpcClient) sendOut(msgBytes []byte) {
+	select {
+	case c.OutCh <- msgBytes:
+	case <-c.DoneCh:
+	}
+}
+
+// a message sent by the plugin
+func (c *pluginRpcClient) handlePluginMessage(msgBytes []byte) {
+	var msg wshutil.RpcMessage
+	if err := json.Unmarshal(msgBytes, &msg); err != nil {
+		log.Printf("[plugin:%s] invalid message: %v\n", c.Manifest.Name, err)
+		return
+	}
+	if msg.Command == "" {
+		// responses and cancels are routed by their rpc id
+		c.sendOut(msgBytes)
+		return
+	}
+	if err := checkOutgoingCommand(c.Manifest, &msg); err != nil {
+		log.Printf("[plugin:%s] %v\n", c.Manifest.Name, err)
+		if msg.ReqId != "" {
+			c.writePacket(makeErrorResponse(&msg, err))
+		}
+		return
+	}
+	msg.Source = c.RouteId
+	newBytes, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	c.sendOut(newBytes)
+}
+
+// reads the plugin's stdout until it closes.  lines that aren't packets are logged.
+func (c *pluginRpcClient) readOutput(stdout io.Reader) {
+	packetCh := make(chan []byte, OutChSize)
+	rawCh := make(chan []byte, OutChSize)
+	go func() {
+		defer panichandler.PanicHandler("plugin:readRaw")
+		for line := range rawCh {
+			log.Printf("[plugin:%s] %s", c.Manifest.Name, line)
+		}
+	}()
+	go packetparser.Parse(stdout, packetCh, rawCh)
+	for packet := range packetCh {
+		c.handlePluginMessage(packet)
+	}
+}
+
+func (c *pluginRpcClient) close() {
+	c.CloseOnce.Do(func() {
+		close(c.DoneCh)
+	})
+}
+
+// waits up to timeout for the plugin to exit, returns true if it did
+func (c *pluginRpcClient) waitDone(timeout time.Duration) bool {
+	select {
+	case <-c.DoneCh:
+		return true
+	default:
+	}
+	select {
+	case <-c.DoneCh:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package plugin
+
+import (
+	"testing"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+func TestValidateManifest(t *testing.T) {
+	manifest := &wshrpc.PluginManifest{Name: "my-plugin", Command: "./run", Permissions: []string{Scope_Events}}
+	if err := validateManifest(manifest); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	bad := []wshrpc.PluginManifest{
+		{Name: "My Plugin", Command: "./run"},
+		{Name: "noexec"},
+		{Name: "perms", Command: "./run", Permissions: []string{"everything"}},
+		{Name: "views", Command: "./run", Views: []wshrpc.PluginView{{DisplayName: "No Name"}}},
+	}
+	for _, manifest := range bad {
+		if err := validateManifest(&manifest); err == nil {
+			t.Errorf("expected an error for %+v", manifest)
+		}
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	manifest := &wshrpc.PluginManifest{
+		Name:        "myplugin",
+		Commands:    []string{"myplugin:run"},
+		Permissions: []string{Scope_BlocksRead, Scope_Events},
+	}
+	allowed := []wshutil.RpcMessage{
+		{Command: wshrpc.Command_GetMeta},
+		{Command: wshrpc.Command_EventSub},
+		{Command: wshrpc.Command_Message},
+	}
+	for _, msg := range allowed {
+		if err := checkOutgoingCommand(manifest, &msg); err != nil {
+			t.Errorf("expected %q to be allowed: %v", msg.Command, err)
+		}
+	}
+	denied := []wshutil.RpcMessage{
+		{Command: wshrpc.Command_SetMeta},
+		{Command: wshrpc.Command_ControllerInput},
+		{Command: wshrpc.Command_Authenticate},
+		{Command: wshrpc.Command_RouteAnnounce},
+		{Command: "other:run", Route: "plugin:other"},
+	}
+	for _, msg := range denied {
+		if err := checkOutgoingCommand(manifest, &msg); err == nil {
+			t.Errorf("expected %q (route %q) to be denied", msg.Command, msg.Route)
+		}
+	}
+	if err := checkIncomingCommand(manifest, &wshutil.RpcMessage{Command: "myplugin:run"}); err != nil {
+		t.Errorf("expected declared command to be allowed: %v", err)
+	}
+	if err := checkIncomingCommand(manifest, &wshutil.RpcMessage{Command: wshrpc.Command_VDomRender}); err == nil {
+		t.Errorf("expected vdomrender to be denied for a plugin without views")
+	}
+}
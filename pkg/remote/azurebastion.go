@@ -0,0 +1,325 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/remote/conndebug"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// tunnels the ssh connection through an Azure Bastion host (azure:bastion), like
+// "az network bastion tunnel".  the bastion (Standard sku, with native client support) gives out
+// a tunnel token for the vm and port, and the tunnel is a websocket that carries the tcp stream
+// as binary messages.  the token is released when the tunnel is closed.
+//
+// the access token and the bastion's endpoint come from the az cli ("az account
+// get-access-token" and "az network bastion show"), so it has to be installed and logged in.
+
+const BastionApiTimeout = 15 * time.Second
+const BastionAzTimeout = 30 * time.Second
+const BastionEndpointCacheTime = time.Hour
+
+type bastionTunnelOpts struct {
+	Bastion       string
+	ResourceGroup string
+	Subscription  string
+	VmId          string // the vm's resource id
+}
+
+type bastionTokenResponse struct {
+	AuthToken string `json:"authToken"`
+	NodeId    string `json:"nodeId"`
+}
+
+type azAccessToken struct {
+	AccessToken string `json:"accessToken"`
+	ExpiresOn   int64  `json:"expires_on"`
+}
+
+type bastionCacheEntry struct {
+	Value     string
+	ExpiresAt time.Time
+}
+
+// az is slow to start, so the access tokens and bastion endpoints are cached
+type bastionCache struct {
+	Lock      *sync.Mutex
+	Tokens    map[string]bastionCacheEntry // by subscription
+	Endpoints map[string]bastionCacheEntry // by subscription/resourcegroup/bastion
+}
+
+var bastionCacheVal = &bastionCache{
+	Lock:      &sync.Mutex{},
+	Tokens:    make(map[string]bastionCacheEntry),
+	Endpoints: make(map[string]bastionCacheEntry),
+}
+
+// the bastion options for a connection (nil when azure:bastion is not set)
+func makeBastionTunnelOpts(sshKeywords *wshrpc.ConnKeywords) *bastionTunnelOpts {
+	if sshKeywords.AzureBastion == "" {
+		return nil
+	}
+	return &bastionTunnelOpts{
+		Bastion:       sshKeywords.AzureBastion,
+		ResourceGroup: sshKeywords.AzureResourceGroup,
+		Subscription:  sshKeywords.AzureSubscription,
+		VmId:          sshKeywords.AzureVmId,
+	}
+}
+
+func runAz(ctx context.Context, subscription string, args ...string) (string, error) {
+	if subscription != "" {
+		args = append(args, "--subscription", subscription)
+	}
+	ctx, cancelFn := context.WithTimeout(ctx, BastionAzTimeout)
+	defer cancelFn()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "az", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return "", fmt.Errorf("az was not found (install the Azure CLI)")
+		}
+		return "", fmt.Errorf("az %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func getCachedBastionValue(cache map[string]bastionCacheEntry, key string, fetchFn func() (string, time.Time, error)) (string, error) {
+	bastionCacheVal.Lock.Lock()
+	defer bastionCacheVal.Lock.Unlock()
+	if entry, ok := cache[key]; ok && time.Now().Before(entry.ExpiresAt) {
+		return entry.Value, nil
+	}
+	value, expiresAt, err := fetchFn()
+	if err != nil {
+		return "", err
+	}
+	cache[key] = bastionCacheEntry{Value: value, ExpiresAt: expiresAt}
+	return value, nil
+}
+
+func getAzAccessToken(ctx context.Context, subscription string) (string, error) {
+	return getCachedBastionValue(bastionCacheVal.Tokens, subscription, func() (string, time.Time, error) {
+		out, err := runAz(ctx, subscription, "account", "get-access-token", "--output", "json")
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		var token azAccessToken
+		if err := json.Unmarshal([]byte(out), &token); err != nil || token.AccessToken == "" {
+			return "", time.Time{}, fmt.Errorf("az account get-access-token: unexpected output")
+		}
+		// refresh a few minutes early
+		expiresAt := time.Now().Add(10 * time.Minute)
+		if token.ExpiresOn > 0 {
+			expiresAt = time.Unix(token.ExpiresOn, 0).Add(-5 * time.Minute)
+		}
+		return token.AccessToken, expiresAt, nil
+	})
+}
+
+// the bastion's dns name (like bst-xxxx.bastion.azure.com)
+func getBastionEndpoint(ctx context.Context, opts *bastionTunnelOpts) (string, error) {
+	key := opts.Subscription + "/" + opts.ResourceGroup + "/" + opts.Bastion
+	return getCachedBastionValue(bastionCacheVal.Endpoints, key, func() (string, time.Time, error) {
+		out, err := runAz(ctx, opts.Subscription, "network", "bastion", "show", "--name", opts.Bastion, "--resource-group", opts.ResourceGroup, "--query", "dnsName", "--output", "tsv")
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		if out == "" {
+			return "", time.Time{}, fmt.Errorf("bastion %s has no dns name", opts.Bastion)
+		}
+		return out, time.Now().Add(BastionEndpointCacheTime), nil
+	})
+}
+
+// opens a bastion tunnel to the vm's port (networkAddr's port)
+func dialBastionTunnel(ctx context.Context, opts *bastionTunnelOpts, networkAddr string) (net.Conn, error) {
+	_, port, err := net.SplitHostPort(networkAddr)
+	if err != nil {
+		return nil, err
+	}
+	if opts.ResourceGroup == "" || opts.VmId == "" {
+		return nil, fmt.Errorf("azure:bastion is set, but azure:resourcegroup or azure:vmid is not")
+	}
+	accessToken, err := getAzAccessToken(ctx, opts.Subscription)
+	if err != nil {
+		return nil, fmt.Errorf("azure access token: %w", err)
+	}
+	endpoint, err := getBastionEndpoint(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("bastion %s: %w", opts.Bastion, err)
+	}
+	conndebug.Logf(ctx, "dial: bastion tunnel through %s (%s) to %s port %s", opts.Bastion, endpoint, opts.VmId, port)
+	return openBastionTunnel(ctx, "https://"+endpoint, accessToken, opts.VmId, port)
+}
+
+func requestBastionToken(ctx context.Context, baseUrl string, accessToken string, vmId string, port string) (*bastionTokenResponse, error) {
+	form := url.Values{}
+	form.Set("resourceId", vmId)
+	form.Set("protocol", "tcptunnel")
+	form.Set("workloadHostPort", port)
+	form.Set("aztoken", accessToken)
+	form.Set("token", "")
+	ctx, cancelFn := context.WithTimeout(ctx, BastionApiTimeout)
+	defer cancelFn()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseUrl+"/api/tokens", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bastion token: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var tokenResp bastionTokenResponse
+	if err := json.Unmarshal(body, &tokenResp); err != nil || tokenResp.AuthToken == "" {
+		return nil, fmt.Errorf("bastion token: unexpected response")
+	}
+	return &tokenResp, nil
+}
+
+// releases the tunnel token (best effort, the bastion expires it anyway)
+func deleteBastionToken(baseUrl string, tokenResp *bastionTokenResponse) {
+	ctx, cancelFn := context.WithTimeout(context.Background(), BastionApiTimeout)
+	defer cancelFn()
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, baseUrl+"/api/tokens/"+url.PathEscape(tokenResp.AuthToken), nil)
+	if err != nil {
+		return
+	}
+	if tokenResp.NodeId != "" {
+		req.Header.Set("X-Node-Id", tokenResp.NodeId)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err == nil {
+		resp.Body.Close()
+	}
+}
+
+func openBastionTunnel(ctx context.Context, baseUrl string, accessToken string, vmId string, port string) (net.Conn, error) {
+	tokenResp, err := requestBastionToken(ctx, baseUrl, accessToken, vmId, port)
+	if err != nil {
+		return nil, err
+	}
+	wsUrl := strings.Replace(baseUrl, "http", "ws", 1) + "/webtunnelv2/" + url.PathEscape(tokenResp.AuthToken) + "?X-Node-Id=" + url.QueryEscape(tokenResp.NodeId)
+	dialer := websocket.Dialer{Proxy: http.ProxyFromEnvironment}
+	ws, resp, err := dialer.DialContext(ctx, wsUrl, nil)
+	if err != nil {
+		go deleteBastionToken(baseUrl, tokenResp)
+		if resp != nil {
+			return nil, fmt.Errorf("bastion tunnel: %s", resp.Status)
+		}
+		return nil, fmt.Errorf("bastion tunnel: %w", err)
+	}
+	remoteAddr := &bastionAddr{vm: vmId[strings.LastIndex(vmId, "/")+1:], port: port}
+	return &bastionConn{ws: ws, writeLock: &sync.Mutex{}, closeOnce: &sync.Once{}, remoteAddr: remoteAddr, baseUrl: baseUrl, token: tokenResp}, nil
+}
+
+// the vm (the last part of its resource id) and port the tunnel goes to
+type bastionAddr struct {
+	vm   string
+	port string
+}
+
+func (a *bastionAddr) Network() string {
+	return "bastion"
+}
+
+func (a *bastionAddr) String() string {
+	return net.JoinHostPort(a.vm, a.port)
+}
+
+// a tcp stream over the bastion's websocket (each binary message is a chunk of the stream)
+type bastionConn struct {
+	ws         *websocket.Conn
+	writeLock  *sync.Mutex
+	closeOnce  *sync.Once
+	remoteAddr net.Addr
+	baseUrl    string
+	token      *bastionTokenResponse
+	pending    []byte
+}
+
+func (c *bastionConn) Read(b []byte) (int, error) {
+	for len(c.pending) == 0 {
+		msgType, msg, err := c.ws.ReadMessage()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				return 0, io.EOF
+			}
+			return 0, err
+		}
+		if msgType == websocket.BinaryMessage {
+			c.pending = msg
+		}
+	}
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+func (c *bastionConn) Write(b []byte) (int, error) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	if err := c.ws.WriteMessage(websocket.BinaryMessage, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *bastionConn) Close() error {
+	err := c.ws.Close()
+	c.closeOnce.Do(func() {
+		go func() {
+			defer panichandler.PanicHandler("bastionConn:deleteToken")
+			deleteBastionToken(c.baseUrl, c.token)
+		}()
+	})
+	return err
+}
+
+func (c *bastionConn) LocalAddr() net.Addr {
+	return c.ws.LocalAddr()
+}
+
+func (c *bastionConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+func (c *bastionConn) SetDeadline(t time.Time) error {
+	if err := c.ws.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.ws.SetWriteDeadline(t)
+}
+
+func (c *bastionConn) SetReadDeadline(t time.Time) error {
+	return c.ws.SetReadDeadline(t)
+}
+
+func (c *bastionConn) SetWriteDeadline(t time.Time) error {
+	return c.ws.SetWriteDeadline(t)
+}
@@ -0,0 +1,94 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const testBastionVmId = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm-1"
+
+// a fake bastion that gives out a token for the vm, echoes the tunnel's data back, and reports
+// the deleted tokens
+func startFakeBastion(t *testing.T, deleted chan string) string {
+	upgrader := websocket.Upgrader{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/tokens", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("aztoken") != "token" || r.Form.Get("resourceId") != testBastionVmId || r.Form.Get("protocol") != "tcptunnel" {
+			http.Error(w, "not authorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(bastionTokenResponse{AuthToken: "tunnel-" + r.Form.Get("workloadHostPort"), NodeId: "node-1"})
+	})
+	mux.HandleFunc("DELETE /api/tokens/{token}", func(w http.ResponseWriter, r *http.Request) {
+		deleted <- r.PathValue("token") + "@" + r.Header.Get("X-Node-Id")
+	})
+	mux.HandleFunc("/webtunnelv2/{token}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("token") != "tunnel-22" || r.URL.Query().Get("X-Node-Id") != "node-1" {
+			http.Error(w, "bad token", http.StatusForbidden)
+			return
+		}
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		for {
+			msgType, msg, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			ws.WriteMessage(msgType, msg)
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestBastionTunnel(t *testing.T) {
+	deleted := make(chan string, 4)
+	baseUrl := startFakeBastion(t, deleted)
+	ctx, cancelFn := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFn()
+	if _, err := openBastionTunnel(ctx, baseUrl, "wrong", testBastionVmId, "22"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected a 401 error, got %v", err)
+	}
+	conn, err := openBastionTunnel(ctx, baseUrl, "token", testBastionVmId, "22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn.RemoteAddr().String() != "vm-1:22" {
+		t.Errorf("remote addr %q", conn.RemoteAddr())
+	}
+	data := bytes.Repeat([]byte("0123456789"), 5000)
+	go conn.Write(data)
+	echoed := make([]byte, len(data))
+	if _, err := io.ReadFull(conn, echoed); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(echoed, data) {
+		t.Errorf("echoed data does not match")
+	}
+	conn.Close()
+	select {
+	case token := <-deleted:
+		if token != "tunnel-22@node-1" {
+			t.Errorf("deleted token %q", token)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("the tunnel token was not deleted")
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package conncontroller
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/docker"
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/remote"
+	"github.com/wavetermdev/waveterm/pkg/remote/conndebug"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"golang.org/x/crypto/ssh"
+)
+
+// running one command on several connections at once (like pssh)
+
+const DefaultBroadcastParallel = 32
+
+// sends the output of a broadcast command as it arrives, tagged with the connection
+type broadcastWriter struct {
+	connName  string
+	eventType string
+	eventFn   func(wshrpc.ConnBroadcastEvent)
+}
+
+func (bw *broadcastWriter) Write(p []byte) (int, error) {
+	bw.eventFn(wshrpc.ConnBroadcastEvent{
+		Connection: bw.connName,
+		Type:       bw.eventType,
+		Data64:     base64.StdEncoding.EncodeToString(p),
+	})
+	return len(p), nil
+}
+
+// the connection's client, connecting it first if needed (connections that failed are retried)
+func getBroadcastClient(ctx context.Context, connName string) (*ssh.Client, error) {
+	opts, err := remote.ParseOpts(connName)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing connection name: %w", err)
+	}
+	conn := GetConn(ctx, opts, false, &wshrpc.ConnKeywords{})
+	switch conn.GetStatus() {
+	case Status_Connected:
+	case Status_Connecting:
+		err = conn.WaitForConnect(ctx)
+	default:
+		err = conn.Connect(ctx, &wshrpc.ConnKeywords{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	client := conn.GetClient()
+	if client == nil {
+		return nil, fmt.Errorf("connection %q is not connected", connName)
+	}
+	return client, nil
+}
+
+// runs the command on one connection, returns its exit code (-1 if there isn't one)
+func runBroadcastCommand(ctx context.Context, connName string, cmd string, eventFn func(wshrpc.ConnBroadcastEvent)) (int, error) {
+	client, err := getBroadcastClient(ctx, connName)
+	if err != nil {
+		return -1, err
+	}
+	conndebug.LogConnf(connName, "broadcast: running %q", cmd)
+	stdout := &broadcastWriter{connName: connName, eventType: wshrpc.BroadcastEvent_Stdout, eventFn: eventFn}
+	stderr := &broadcastWriter{connName: connName, eventType: wshrpc.BroadcastEvent_Stderr, eventFn: eventFn}
+	exitCode, _, err := runConnCommand(ctx, connName, client, cmd, nil, nil, stdout, stderr)
+	return exitCode, err
+}
+
+// Broadcast runs data.Command on every connection in data.Connections concurrently, sending
+// output, exit codes, and errors to eventFn as they happen.  each connection finishes with an
+// "exit" or an "error" event.  eventFn is called from several goroutines.
+func Broadcast(ctx context.Context, data wshrpc.CommandConnBroadcastData, eventFn func(wshrpc.ConnBroadcastEvent)) error {
+	if strings.TrimSpace(data.Command) == "" {
+		return fmt.Errorf("no command given")
+	}
+	if len(data.Connections) == 0 {
+		return fmt.Errorf("no connections given")
+	}
+	for _, connName := range data.Connections {
+		if connName == "" || connName == "local" || strings.HasPrefix(connName, "wsl://") || strings.HasPrefix(connName, "k8s://") || docker.IsContainerConnName(connName) || strings.HasPrefix(connName, "telnet://") {
+			return fmt.Errorf("broadcast is only supported on ssh connections, not %q", connName)
+		}
+	}
+	if data.TimeoutMs > 0 {
+		var cancelFn context.CancelFunc
+		ctx, cancelFn = context.WithTimeout(ctx, time.Duration(data.TimeoutMs)*time.Millisecond)
+		defer cancelFn()
+	}
+	maxParallel := data.MaxParallel
+	if maxParallel <= 0 {
+		maxParallel = DefaultBroadcastParallel
+	}
+	sem := make(chan struct{}, maxParallel)
+	var wg sync.WaitGroup
+	seen := make(map[string]bool)
+	for _, connName := range data.Connections {
+		if seen[connName] {
+			continue
+		}
+		seen[connName] = true
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer panichandler.PanicHandler("conncontroller:Broadcast")
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				eventFn(wshrpc.ConnBroadcastEvent{Connection: connName, Type: wshrpc.BroadcastEvent_Error, Error: ctx.Err().Error()})
+				return
+			}
+			defer func() { <-sem }()
+			exitCode, err := runBroadcastCommand(ctx, connName, data.Command, eventFn)
+			if err != nil {
+				eventFn(wshrpc.ConnBroadcastEvent{Connection: connName, Type: wshrpc.BroadcastEvent_Error, Error: err.Error()})
+				return
+			}
+			eventFn(wshrpc.ConnBroadcastEvent{Connection: connName, Type: wshrpc.BroadcastEvent_Exit, ExitCode: exitCode})
+		}()
+	}
+	wg.Wait()
+	return nil
+}
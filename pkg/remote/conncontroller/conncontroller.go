@@ -9,10 +9,10 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
-	"log"
 	"net"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -20,8 +20,10 @@ import (
 
 	"github.com/kevinburke/ssh_config"
 	"github.com/skeema/knownhosts"
+	"github.com/wavetermdev/waveterm/pkg/audit"
 	"github.com/wavetermdev/waveterm/pkg/panichandler"
 	"github.com/wavetermdev/waveterm/pkg/remote"
+	"github.com/wavetermdev/waveterm/pkg/remote/conndebug"
 	"github.com/wavetermdev/waveterm/pkg/telemetry"
 	"github.com/wavetermdev/waveterm/pkg/userinput"
 	"github.com/wavetermdev/waveterm/pkg/util/shellutil"
@@ -29,8 +31,10 @@ import (
 	"github.com/wavetermdev/waveterm/pkg/wavebase"
 	"github.com/wavetermdev/waveterm/pkg/waveobj"
 	"github.com/wavetermdev/waveterm/pkg/wconfig"
+	"github.com/wavetermdev/waveterm/pkg/wlog"
 	"github.com/wavetermdev/waveterm/pkg/wps"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
 	"github.com/wavetermdev/waveterm/pkg/wshutil"
 	"golang.org/x/crypto/ssh"
 )
@@ -44,10 +48,14 @@ const (
 )
 
 const DefaultConnectionTimeout = 60 * time.Second
+const WshHandshakeTimeout = 5 * time.Second
+
+const wshInstallPath = "~/.waveterm/bin/wsh"
 
 var globalLock = &sync.Mutex{}
 var clientControllerMap = make(map[remote.SSHOpts]*SSHConn)
 var activeConnCounter = &atomic.Int32{}
+var connLog = wlog.Logger("conncontroller")
 
 type SSHConn struct {
 	Lock               *sync.Mutex
@@ -55,16 +63,26 @@ type SSHConn struct {
 	WshEnabled         *atomic.Bool
 	Opts               *remote.SSHOpts
 	Client             *ssh.Client
+	ClientStopCh       chan struct{} // closed when this conn is done with Client (the client can be shared)
 	SockName           string
 	DomainSockListener net.Listener
 	ConnController     *ssh.Session
 	Error              string
+	ErrorCode          string
 	WshError           string
+	WshVersion         string // reported by the connserver in the version handshake
+	WshUpdateTime      int64  // when the helper was last replaced after a version mismatch
 	HasWaiter          *atomic.Bool
 	LastConnectTime    int64
 	ActiveConnNum      int
+	Timeline           []wshrpc.ConnTimelineEvent
+	Forwards           []remote.PortForward
+	FailedForwards     []wshrpc.PortForwardInfo
 }
 
+const MaxConnTimelineEvents = 100
+const KeepAliveInterval = 15 * time.Second
+
 func GetAllConnStatus() []wshrpc.ConnStatus {
 	globalLock.Lock()
 	defer globalLock.Unlock()
@@ -76,6 +94,30 @@ func GetAllConnStatus() []wshrpc.ConnStatus {
 	return connStatuses
 }
 
+func GetAllWshHelperStatus() []wshrpc.WshHelperStatus {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+
+	var rtn []wshrpc.WshHelperStatus
+	for _, conn := range clientControllerMap {
+		rtn = append(rtn, conn.DeriveWshHelperStatus())
+	}
+	return rtn
+}
+
+// status change history for every connection (used for diagnostic bundles)
+func GetAllConnTimelines() map[string][]wshrpc.ConnTimelineEvent {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+	rtn := make(map[string][]wshrpc.ConnTimelineEvent)
+	for _, conn := range clientControllerMap {
+		conn.Lock.Lock()
+		rtn[conn.Opts.String()] = append([]wshrpc.ConnTimelineEvent(nil), conn.Timeline...)
+		conn.Lock.Unlock()
+	}
+	return rtn
+}
+
 func GetNumSSHHasConnected() int {
 	globalLock.Lock()
 	defer globalLock.Unlock()
@@ -100,12 +142,28 @@ func (conn *SSHConn) DeriveConnStatus() wshrpc.ConnStatus {
 		HasConnected:  (conn.LastConnectTime > 0),
 		ActiveConnNum: conn.ActiveConnNum,
 		Error:         conn.Error,
+		ErrorCode:     conn.ErrorCode,
 		WshError:      conn.WshError,
 	}
 }
 
+func (conn *SSHConn) DeriveWshHelperStatus() wshrpc.WshHelperStatus {
+	conn.Lock.Lock()
+	defer conn.Lock.Unlock()
+	return wshrpc.WshHelperStatus{
+		Connection:      conn.Opts.String(),
+		WshEnabled:      conn.WshEnabled.Load(),
+		Version:         conn.WshVersion,
+		ExpectedVersion: wavebase.WaveVersion,
+		UpToDate:        conn.WshVersion == wavebase.WaveVersion,
+		UpdateTime:      conn.WshUpdateTime,
+		WshError:        conn.WshError,
+	}
+}
+
 func (conn *SSHConn) FireConnChangeEvent() {
 	status := conn.DeriveConnStatus()
+	conn.recordTimelineEvent(status)
 	event := wps.WaveEvent{
 		Event: wps.Event_ConnChange,
 		Scopes: []string{
@@ -113,10 +171,31 @@ func (conn *SSHConn) FireConnChangeEvent() {
 		},
 		Data: status,
 	}
-	log.Printf("sending event: %+#v", event)
+	connLog.Debug("sending conn change event", wlog.ConnAttr(conn.GetName()), "status", status.Status)
 	wps.Broker.Publish(event)
 }
 
+// only changes are recorded (conn change events are also fired for no-op updates)
+func (conn *SSHConn) recordTimelineEvent(status wshrpc.ConnStatus) {
+	conn.Lock.Lock()
+	defer conn.Lock.Unlock()
+	if len(conn.Timeline) > 0 {
+		last := conn.Timeline[len(conn.Timeline)-1]
+		if last.Status == status.Status && last.Error == status.Error && last.WshError == status.WshError {
+			return
+		}
+	}
+	conn.Timeline = append(conn.Timeline, wshrpc.ConnTimelineEvent{
+		Ts:       time.Now().UnixMilli(),
+		Status:   status.Status,
+		Error:    status.Error,
+		WshError: status.WshError,
+	})
+	if len(conn.Timeline) > MaxConnTimelineEvents {
+		conn.Timeline = conn.Timeline[len(conn.Timeline)-MaxConnTimelineEvents:]
+	}
+}
+
 func (conn *SSHConn) Close() error {
 	defer conn.FireConnChangeEvent()
 	conn.WithLock(func() {
@@ -139,6 +218,11 @@ func (conn *SSHConn) Close() error {
 
 func (conn *SSHConn) close_nolock() {
 	// does not set status (that should happen at another level)
+	for _, forward := range conn.Forwards {
+		forward.Close()
+	}
+	conn.Forwards = nil
+	conn.FailedForwards = nil
 	if conn.DomainSockListener != nil {
 		conn.DomainSockListener.Close()
 		conn.DomainSockListener = nil
@@ -147,8 +231,14 @@ func (conn *SSHConn) close_nolock() {
 		conn.ConnController.Close()
 		conn.ConnController = nil
 	}
+	conn.WshVersion = ""
+	if conn.ClientStopCh != nil {
+		close(conn.ClientStopCh)
+		conn.ClientStopCh = nil
+	}
 	if conn.Client != nil {
-		conn.Client.Close()
+		// closes the client unless it is still shared (or kept open by ControlPersist)
+		remote.ReleaseClient(conn.Client)
 		conn.Client = nil
 	}
 }
@@ -188,11 +278,13 @@ func (conn *SSHConn) OpenDomainSocketListener() error {
 		return fmt.Errorf("error generating random string: %w", err)
 	}
 	sockName := fmt.Sprintf("/tmp/waveterm-%s.sock", randStr)
-	log.Printf("remote domain socket %s %q\n", conn.GetName(), conn.GetDomainSocketName())
+	connLog.Debug("remote domain socket", wlog.ConnAttr(conn.GetName()), "socket", conn.GetDomainSocketName())
 	listener, err := client.ListenUnix(sockName)
 	if err != nil {
+		conndebug.LogConnf(conn.GetName(), "channel: remote domain socket forward %s failed: %v", sockName, err)
 		return fmt.Errorf("unable to request connection domain socket: %v", err)
 	}
+	conndebug.LogConnf(conn.GetName(), "channel: remote domain socket forward %s opened", sockName)
 	conn.WithLock(func() {
 		conn.SockName = sockName
 		conn.DomainSockListener = listener
@@ -209,6 +301,10 @@ func (conn *SSHConn) OpenDomainSocketListener() error {
 }
 
 func (conn *SSHConn) StartConnServer() error {
+	return conn.startConnServer(remote.GetWshPath(conn.GetClient()))
+}
+
+func (conn *SSHConn) startConnServer(wshPath string) error {
 	var allowed bool
 	conn.WithLock(func() {
 		if conn.Status != Status_Connecting {
@@ -221,7 +317,6 @@ func (conn *SSHConn) StartConnServer() error {
 		return fmt.Errorf("cannot start conn server for %q when status is %q", conn.GetName(), conn.GetStatus())
 	}
 	client := conn.GetClient()
-	wshPath := remote.GetWshPath(client)
 	rpcCtx := wshrpc.RpcContext{
 		ClientType: wshrpc.ClientType_ConnServer,
 		Conn:       conn.GetName(),
@@ -233,8 +328,10 @@ func (conn *SSHConn) StartConnServer() error {
 	}
 	sshSession, err := client.NewSession()
 	if err != nil {
+		conndebug.LogConnf(conn.GetName(), "channel: session for conn server failed: %v", err)
 		return fmt.Errorf("unable to create ssh session for conn controller: %w", err)
 	}
+	conndebug.LogConnf(conn.GetName(), "channel: session opened for conn server")
 	pipeRead, pipeWrite := io.Pipe()
 	sshSession.Stdout = pipeWrite
 	sshSession.Stderr = pipeWrite
@@ -248,7 +345,7 @@ func (conn *SSHConn) StartConnServer() error {
 	} else {
 		cmdStr = fmt.Sprintf("%s=\"%s\" %s connserver", wshutil.WaveJwtTokenVarName, jwtToken, wshPath)
 	}
-	log.Printf("starting conn controller: %s\n", cmdStr)
+	connLog.Info("starting conn controller", wlog.ConnAttr(conn.GetName()), "cmd", cmdStr)
 	err = sshSession.Start(cmdStr)
 	if err != nil {
 		return fmt.Errorf("unable to start conn controller: %w", err)
@@ -259,12 +356,15 @@ func (conn *SSHConn) StartConnServer() error {
 	// service the I/O
 	go func() {
 		defer panichandler.PanicHandler("conncontroller:sshSession.Wait")
-		// wait for termination, clear the controller
+		// wait for termination, clear the controller (unless it was already replaced)
 		defer conn.WithLock(func() {
-			conn.ConnController = nil
+			if conn.ConnController == sshSession {
+				conn.ConnController = nil
+			}
 		})
 		waitErr := sshSession.Wait()
-		log.Printf("conn controller (%q) terminated: %v", conn.GetName(), waitErr)
+		connLog.Info("conn controller terminated", wlog.ConnAttr(conn.GetName()), "err", waitErr)
+		conndebug.LogConnf(conn.GetName(), "channel: conn server session closed (err: %v)", waitErr)
 	}()
 	go func() {
 		defer panichandler.PanicHandler("conncontroller:sshSession-output")
@@ -273,10 +373,10 @@ func (conn *SSHConn) StartConnServer() error {
 			if !strings.HasSuffix(lineStr, "\n") {
 				lineStr += "\n"
 			}
-			log.Printf("[conncontroller:%s:output] %s", conn.GetName(), lineStr)
+			connLog.Info("conn controller output", wlog.ConnAttr(conn.GetName()), "line", lineStr)
 		})
 		if readErr != nil && readErr != io.EOF {
-			log.Printf("[conncontroller:%s] error reading output: %v\n", conn.GetName(), readErr)
+			connLog.Warn("error reading conn controller output", wlog.ConnAttr(conn.GetName()), "err", readErr)
 		}
 	}()
 	regCtx, cancelFn := context.WithTimeout(context.Background(), 5*time.Second)
@@ -289,6 +389,82 @@ func (conn *SSHConn) StartConnServer() error {
 	return nil
 }
 
+// the version of the wsh running the connserver (helpers from before the handshake don't know
+// remotegetinfo, which is an error here)
+func (conn *SSHConn) getWshHelperVersion() (string, error) {
+	opts := &wshrpc.RpcOpts{
+		Route:   wshutil.MakeConnectionRouteId(conn.GetName()),
+		Timeout: int(WshHandshakeTimeout.Milliseconds()),
+	}
+	info, err := wshclient.RemoteGetInfoCommand(wshclient.GetBareRpcClient(), opts)
+	if err != nil {
+		return "", err
+	}
+	return info.WshVersion, nil
+}
+
+// stops the connserver and waits for its route to go away (otherwise the cleanup of the old
+// route would remove the route of the next connserver)
+func (conn *SSHConn) stopConnServer() error {
+	var session *ssh.Session
+	conn.WithLock(func() {
+		session = conn.ConnController
+		conn.ConnController = nil
+	})
+	if session != nil {
+		session.Signal(ssh.SIGTERM)
+		session.Close()
+	}
+	routeId := wshutil.MakeConnectionRouteId(conn.GetName())
+	startTime := time.Now()
+	for wshutil.DefaultRouter.GetRpc(routeId) != nil {
+		if time.Since(startTime) > WshHandshakeTimeout {
+			return fmt.Errorf("timeout waiting for the connserver to stop")
+		}
+		time.Sleep(30 * time.Millisecond)
+	}
+	return nil
+}
+
+// the version handshake with the connserver that was just started.  a helper that is not the
+// version of this backend (or too old to answer) is replaced with the matching binary, and the
+// connserver is restarted from the install path (a different wsh earlier in the PATH would
+// otherwise win again).
+func (conn *SSHConn) negotiateWshVersion(ctx context.Context, clientDisplayName string) error {
+	helperVersion, err := conn.getWshHelperVersion()
+	if err == nil && helperVersion == wavebase.WaveVersion {
+		conn.WithLock(func() {
+			conn.WshVersion = helperVersion
+		})
+		return nil
+	}
+	connLog.Info("wsh helper does not match, replacing it", wlog.ConnAttr(conn.GetName()), "version", helperVersion, "expected", wavebase.WaveVersion, "err", err)
+	if err := conn.stopConnServer(); err != nil {
+		return err
+	}
+	err = conn.CheckAndInstallWsh(ctx, clientDisplayName, &WshInstallOpts{Force: true, NoUserPrompt: true})
+	if err != nil {
+		return err
+	}
+	if err := conn.startConnServer(wshInstallPath); err != nil {
+		return err
+	}
+	helperVersion, err = conn.getWshHelperVersion()
+	if err == nil && helperVersion != wavebase.WaveVersion {
+		err = fmt.Errorf("wsh is %s after reinstalling (expected %s)", helperVersion, wavebase.WaveVersion)
+	}
+	if err != nil {
+		conn.stopConnServer()
+		return fmt.Errorf("wsh version handshake failed: %w", err)
+	}
+	conn.WithLock(func() {
+		conn.WshVersion = helperVersion
+		conn.WshUpdateTime = time.Now().UnixMilli()
+	})
+	connLog.Info("replaced wsh helper", wlog.ConnAttr(conn.GetName()), "version", helperVersion)
+	return nil
+}
+
 type WshInstallOpts struct {
 	Force        bool
 	NoUserPrompt bool
@@ -348,7 +524,7 @@ func (conn *SSHConn) CheckAndInstallWsh(ctx context.Context, clientDisplayName s
 			meta["conn:wshenabled"] = false
 			err = wconfig.SetConnectionsConfigValue(conn.GetName(), meta)
 			if err != nil {
-				log.Printf("warning: error writing to connections file: %v", err)
+				connLog.Warn("error writing to connections file", wlog.ConnAttr(conn.GetName()), "err", err)
 			}
 			return &WshInstallSkipError{}
 		}
@@ -362,22 +538,25 @@ func (conn *SSHConn) CheckAndInstallWsh(ctx context.Context, clientDisplayName s
 			}
 		}
 	}
-	log.Printf("attempting to install wsh to `%s`", clientDisplayName)
-	clientOs, err := remote.GetClientOs(client)
-	if err != nil {
-		return err
-	}
-	clientArch, err := remote.GetClientArch(client)
+	connLog.Info("attempting to install wsh", wlog.ConnAttr(conn.GetName()), "client", clientDisplayName)
+	clientOs, clientArch, err := remote.GetClientPlatform(client)
 	if err != nil {
 		return err
 	}
 	// attempt to install extension
 	wshLocalPath := shellutil.GetWshBinaryPath(wavebase.WaveVersion, clientOs, clientArch)
-	err = remote.CpHostToRemote(client, wshLocalPath, "~/.waveterm/bin/wsh")
+	if _, err := os.Stat(wshLocalPath); err != nil {
+		return fmt.Errorf("no wsh binary for %s/%s: %w", clientOs, clientArch, err)
+	}
+	err = remote.SftpInstallFile(client, wshLocalPath, wshInstallPath)
+	if errors.Is(err, remote.ErrSftpUnavailable) {
+		connLog.Info("sftp is not available, installing wsh with the shell", wlog.ConnAttr(conn.GetName()), "err", err)
+		err = remote.CpHostToRemote(client, wshLocalPath, wshInstallPath)
+	}
 	if err != nil {
 		return err
 	}
-	log.Printf("successfully installed wsh on %s\n", conn.GetName())
+	connLog.Info("successfully installed wsh", wlog.ConnAttr(conn.GetName()))
 	return nil
 }
 
@@ -388,6 +567,7 @@ func (conn *SSHConn) GetClient() *ssh.Client {
 }
 
 func (conn *SSHConn) Reconnect(ctx context.Context) error {
+	remote.PublishConnEvent(conn.GetName(), wshrpc.ConnLifecycleEvent{Type: wshrpc.ConnEvent_Reconnecting})
 	err := conn.Close()
 	if err != nil {
 		return err
@@ -428,19 +608,23 @@ func (conn *SSHConn) Connect(ctx context.Context, connFlags *wshrpc.ConnKeywords
 		} else {
 			conn.Status = Status_Connecting
 			conn.Error = ""
+			conn.ErrorCode = ""
 			connectAllowed = true
 		}
 	})
-	log.Printf("Connect %s\n", conn.GetName())
+	connLog.Info("connecting", wlog.ConnAttr(conn.GetName()))
 	if !connectAllowed {
 		return fmt.Errorf("cannot connect to %q when status is %q", conn.GetName(), conn.GetStatus())
 	}
 	conn.FireConnChangeEvent()
+	ctx = userinput.WithRoute(ctx, &userinput.InputRoute{ConnName: conn.GetName()})
+	ctx = conndebug.WithConn(ctx, conn.GetName())
 	err := conn.connectInternal(ctx, connFlags)
 	conn.WithLock(func() {
 		if err != nil {
 			conn.Status = Status_Error
 			conn.Error = err.Error()
+			conn.ErrorCode = remote.GetConnErrorCode(err)
 			conn.close_nolock()
 			telemetry.GoUpdateActivityWrap(wshrpc.ActivityUpdate{
 				Conn: map[string]int{"ssh:connecterror": 1},
@@ -458,8 +642,12 @@ func (conn *SSHConn) Connect(ctx context.Context, connFlags *wshrpc.ConnKeywords
 	})
 	conn.FireConnChangeEvent()
 	if err != nil {
+		audit.Record(audit.Event_ConnError, conn.GetName(), "", err.Error())
+		remote.PublishConnEvent(conn.GetName(), remote.MakeConnErrorEvent(err))
 		return err
 	}
+	audit.Record(audit.Event_ConnConnect, conn.GetName(), "", "")
+	go remountConn(conn)
 
 	// logic for saving connection and potential flags (we only save once a connection has been made successfully)
 	// at the moment, identity files is the only saved flag
@@ -471,7 +659,7 @@ func (conn *SSHConn) Connect(ctx context.Context, connFlags *wshrpc.ConnKeywords
 	}
 	if err != nil {
 		// i do not consider this a critical failure
-		log.Printf("config read error: unable to save connection %s: %v", conn.GetName(), err)
+		connLog.Error("config read error, unable to save connection", wlog.ConnAttr(conn.GetName()), "err", err)
 	}
 
 	meta := make(map[string]any)
@@ -487,7 +675,7 @@ func (conn *SSHConn) Connect(ctx context.Context, connFlags *wshrpc.ConnKeywords
 	err = wconfig.SetConnectionsConfigValue(conn.GetName(), meta)
 	if err != nil {
 		// i do not consider this a critical failure
-		log.Printf("config write error: unable to save connection %s: %v", conn.GetName(), err)
+		connLog.Error("config write error, unable to save connection", wlog.ConnAttr(conn.GetName()), "err", err)
 	}
 	return nil
 }
@@ -501,13 +689,14 @@ func (conn *SSHConn) WithLock(fn func()) {
 func (conn *SSHConn) connectInternal(ctx context.Context, connFlags *wshrpc.ConnKeywords) error {
 	client, _, err := remote.ConnectToClient(ctx, conn.Opts, nil, 0, connFlags)
 	if err != nil {
-		log.Printf("error: failed to connect to client %s: %s\n", conn.GetName(), err)
+		connLog.Error("failed to connect to client", wlog.ConnAttr(conn.GetName()), "err", err)
 		return err
 	}
 	fmtAddr := knownhosts.Normalize(fmt.Sprintf("%s@%s", client.User(), client.RemoteAddr().String()))
 	clientDisplayName := fmt.Sprintf("%s (%s)", conn.GetName(), fmtAddr)
 	conn.WithLock(func() {
 		conn.Client = client
+		conn.ClientStopCh = make(chan struct{})
 	})
 	config := wconfig.ReadFullConfig()
 	enableWsh := config.Settings.ConnWshEnabled
@@ -523,14 +712,15 @@ func (conn *SSHConn) connectInternal(ctx context.Context, connFlags *wshrpc.Conn
 	}
 	if enableWsh {
 		installErr := conn.CheckAndInstallWsh(ctx, clientDisplayName, &WshInstallOpts{NoUserPrompt: !askBeforeInstall})
+		conndebug.Logf(ctx, "wsh: install check result: %v", installErr)
 		if errors.Is(installErr, &WshInstallSkipError{}) {
 			// skips are not true errors
 			conn.WithLock(func() {
 				conn.WshEnabled.Store(false)
 			})
 		} else if installErr != nil {
-			log.Printf("error: unable to install wsh shell extensions for %s: %v\n", conn.GetName(), err)
-			log.Print("attempting to run with nowsh instead")
+			connLog.Error("unable to install wsh shell extensions", wlog.ConnAttr(conn.GetName()), "err", err)
+			connLog.Info("attempting to run with nowsh instead", wlog.ConnAttr(conn.GetName()))
 			conn.WithLock(func() {
 				conn.WshError = installErr.Error()
 			})
@@ -543,15 +733,20 @@ func (conn *SSHConn) connectInternal(ctx context.Context, connFlags *wshrpc.Conn
 			dsErr := conn.OpenDomainSocketListener()
 			var csErr error
 			if dsErr != nil {
-				log.Printf("error: unable to open domain socket listener for %s: %v\n", conn.GetName(), dsErr)
+				connLog.Error("unable to open domain socket listener", wlog.ConnAttr(conn.GetName()), "err", dsErr)
 			} else {
 				csErr = conn.StartConnServer()
 				if csErr != nil {
-					log.Printf("error: unable to start conn server for %s: %v\n", conn.GetName(), csErr)
+					connLog.Error("unable to start conn server", wlog.ConnAttr(conn.GetName()), "err", csErr)
+				} else {
+					csErr = conn.negotiateWshVersion(ctx, clientDisplayName)
+					if csErr != nil {
+						connLog.Error("wsh version handshake failed", wlog.ConnAttr(conn.GetName()), "err", csErr)
+					}
 				}
 			}
 			if dsErr != nil || csErr != nil {
-				log.Print("attempting to run with nowsh instead")
+				connLog.Info("attempting to run with nowsh instead", wlog.ConnAttr(conn.GetName()))
 				conn.WithLock(func() {
 					conn.WshError = csErr.Error()
 				})
@@ -561,19 +756,305 @@ func (conn *SSHConn) connectInternal(ctx context.Context, connFlags *wshrpc.Conn
 	} else {
 		conn.WshEnabled.Store(false)
 	}
+	conndebug.Logf(ctx, "connected (wsh enabled: %v)", conn.WshEnabled.Load())
+	if err := conn.startConfiguredForwards(client); err != nil {
+		return err
+	}
+	if localCmd := remote.GetLocalCommand(conn.GetName(), conn.Opts, client.User()); localCmd != "" {
+		if err := remote.RunLocalCommand(ctx, localCmd); err != nil {
+			connLog.Warn("LocalCommand failed", wlog.ConnAttr(conn.GetName()), "err", err)
+		}
+	}
 	conn.HasWaiter.Store(true)
 	go conn.waitForDisconnect()
+	go conn.runKeepAlives(client)
+	return nil
+}
+
+// starts the forwards from the ssh config files (LocalForward, RemoteForward, DynamicForward) and
+// connections.json (ssh:localforward, ssh:remoteforward, ssh:dynamicforward, ssh:forwardgpgagent).  like ssh, a forward that fails
+// doesn't fail the connection, unless ExitOnForwardFailure is set (then a *remote.ForwardFailedError is returned).
+func (conn *SSHConn) startConfiguredForwards(client *ssh.Client) error {
+	type configuredForward struct {
+		forwardType string
+		spec        string
+		source      string
+	}
+	var forwards []configuredForward
+	sshConfigKeywords := []struct{ keyword, forwardType string }{
+		{"LocalForward", wshrpc.ForwardType_Local},
+		{"RemoteForward", wshrpc.ForwardType_Remote},
+		{"DynamicForward", wshrpc.ForwardType_Dynamic},
+	}
+	for _, kw := range sshConfigKeywords {
+		for _, spec := range remote.GetSshConfigForwards(conn.Opts.SSHHost, conn.Opts.SSHUser, kw.keyword) {
+			forwards = append(forwards, configuredForward{kw.forwardType, spec, wshrpc.ForwardSource_SshConfig})
+		}
+	}
+	if connSettings, ok := wconfig.ReadFullConfig().Connections[conn.GetName()]; ok {
+		for _, spec := range connSettings.SshLocalForward {
+			forwards = append(forwards, configuredForward{wshrpc.ForwardType_Local, spec, wshrpc.ForwardSource_Config})
+		}
+		for _, spec := range connSettings.SshRemoteForward {
+			forwards = append(forwards, configuredForward{wshrpc.ForwardType_Remote, spec, wshrpc.ForwardSource_Config})
+		}
+		for _, spec := range connSettings.SshDynamicForward {
+			forwards = append(forwards, configuredForward{wshrpc.ForwardType_Dynamic, spec, wshrpc.ForwardSource_Config})
+		}
+		if connSettings.SshForwardGpgAgent && !slices.Contains(connSettings.SshRemoteForward, wshrpc.ForwardSpec_GpgAgent) {
+			forwards = append(forwards, configuredForward{wshrpc.ForwardType_Remote, wshrpc.ForwardSpec_GpgAgent, wshrpc.ForwardSource_Config})
+		}
+	}
+	if len(forwards) == 0 {
+		return nil
+	}
+	exitOnFailure := remote.GetExitOnForwardFailure(conn.GetName(), conn.Opts.SSHHost, conn.Opts.SSHUser)
+	for _, forward := range forwards {
+		_, err := conn.startForward(client, forward.forwardType, forward.spec, forward.source)
+		if err != nil && exitOnFailure {
+			conndebug.LogConnf(conn.GetName(), "forward: ExitOnForwardFailure is set, closing the connection")
+			return &remote.ForwardFailedError{Type: forward.forwardType, Spec: forward.spec, Err: err}
+		}
+	}
+	return nil
+}
+
+// parses a forward, with the StreamLocalBindUnlink and StreamLocalBindMask settings for the connection.
+// the "gpg-agent" remote forward is looked up (and its stale remote socket removed) through client.
+func (conn *SSHConn) parseForwardSpec(client *ssh.Client, forwardType string, specStr string) (*remote.ForwardSpec, error) {
+	if forwardType == wshrpc.ForwardType_Remote && specStr == wshrpc.ForwardSpec_GpgAgent {
+		return remote.MakeGpgAgentForwardSpec(client)
+	}
+	spec, err := remote.ParseForwardSpec(forwardType, specStr)
+	if err != nil {
+		return nil, err
+	}
+	spec.BindUnlink, spec.BindMask = remote.GetStreamLocalBindOpts(conn.GetName(), conn.Opts.SSHHost, conn.Opts.SSHUser)
+	return spec, nil
+}
+
+func (conn *SSHConn) startForward(client *ssh.Client, forwardType string, specStr string, source string) (*wshrpc.PortForwardInfo, error) {
+	spec, err := conn.parseForwardSpec(client, forwardType, specStr)
+	var forward remote.PortForward
+	if err == nil {
+		forward, err = remote.StartForward(client, conn.GetName(), forwardType, *spec, source)
+	}
+	if err != nil {
+		connLog.Warn("unable to start forward", wlog.ConnAttr(conn.GetName()), "type", forwardType, "forward", specStr, "err", err)
+		conndebug.LogConnf(conn.GetName(), "forward: %s %q failed: %v", forwardType, specStr, err)
+		conn.WithLock(func() {
+			conn.FailedForwards = append(conn.FailedForwards, wshrpc.PortForwardInfo{
+				Connection: conn.GetName(),
+				Type:       forwardType,
+				Spec:       specStr,
+				Source:     source,
+				Error:      err.Error(),
+			})
+		})
+		return nil, err
+	}
+	var stale bool
+	conn.WithLock(func() {
+		// the connection can drop while the forward is starting
+		if conn.Client != client {
+			stale = true
+			return
+		}
+		conn.Forwards = append(conn.Forwards, forward)
+	})
+	if stale {
+		forward.Close()
+		return nil, fmt.Errorf("connection %q is closed", conn.GetName())
+	}
+	info := forward.GetInfo()
+	connLog.Info("started forward", wlog.ConnAttr(conn.GetName()), "type", forwardType, "listen", info.ListenAddr, "target", info.TargetAddr)
+	conndebug.LogConnf(conn.GetName(), "forward: %s %s -> %s opened", forwardType, info.ListenAddr, info.TargetAddr)
+	return &info, nil
+}
+
+// active forwards (and the ones that failed to start)
+func (conn *SSHConn) GetForwards() []wshrpc.PortForwardInfo {
+	conn.Lock.Lock()
+	forwards := append([]remote.PortForward(nil), conn.Forwards...)
+	rtn := append([]wshrpc.PortForwardInfo(nil), conn.FailedForwards...)
+	conn.Lock.Unlock()
+	for _, forward := range forwards {
+		rtn = append(rtn, forward.GetInfo())
+	}
+	return rtn
+}
+
+func (conn *SSHConn) fireForwardsEvent() {
+	wps.Broker.Publish(wps.WaveEvent{
+		Event:  wps.Event_ConnForwards,
+		Scopes: []string{fmt.Sprintf("connection:%s", conn.GetName())},
+		Data:   conn.GetForwards(),
+	})
+}
+
+// starts a new forward on a connected connection.  unlike configured forwards, an error is
+// returned (and not recorded) when the forward can't be started.
+func (conn *SSHConn) AddForward(forwardType string, specStr string) (*wshrpc.PortForwardInfo, error) {
+	client := conn.GetClient()
+	if client == nil || conn.GetStatus() != Status_Connected {
+		return nil, fmt.Errorf("connection %q is not connected", conn.GetName())
+	}
+	for _, info := range conn.GetForwards() {
+		if info.Error == "" && info.Type == forwardType && info.Spec == specStr {
+			return nil, fmt.Errorf("%s forward %q already exists", forwardType, specStr)
+		}
+	}
+	spec, err := conn.parseForwardSpec(client, forwardType, specStr)
+	if err != nil {
+		return nil, err
+	}
+	forward, err := remote.StartForward(client, conn.GetName(), forwardType, *spec, wshrpc.ForwardSource_User)
+	if err != nil {
+		return nil, err
+	}
+	var stale bool
+	conn.WithLock(func() {
+		if conn.Client != client {
+			stale = true
+			return
+		}
+		conn.Forwards = append(conn.Forwards, forward)
+	})
+	if stale {
+		forward.Close()
+		return nil, fmt.Errorf("connection %q is closed", conn.GetName())
+	}
+	info := forward.GetInfo()
+	connLog.Info("added forward", wlog.ConnAttr(conn.GetName()), "type", forwardType, "listen", info.ListenAddr, "target", info.TargetAddr)
+	conndebug.LogConnf(conn.GetName(), "forward: %s %s -> %s added", forwardType, info.ListenAddr, info.TargetAddr)
+	conn.fireForwardsEvent()
+	return &info, nil
+}
+
+// closes a forward (or clears a failed one), returns an error if there is no such forward
+func (conn *SSHConn) RemoveForward(forwardType string, specStr string) error {
+	var removed remote.PortForward
+	var found bool
+	conn.WithLock(func() {
+		for idx, forward := range conn.Forwards {
+			info := forward.GetInfo()
+			if info.Type == forwardType && info.Spec == specStr {
+				removed = forward
+				found = true
+				conn.Forwards = append(conn.Forwards[:idx:idx], conn.Forwards[idx+1:]...)
+				return
+			}
+		}
+		for idx, info := range conn.FailedForwards {
+			if info.Type == forwardType && info.Spec == specStr {
+				found = true
+				conn.FailedForwards = append(conn.FailedForwards[:idx:idx], conn.FailedForwards[idx+1:]...)
+				return
+			}
+		}
+	})
+	if !found {
+		return fmt.Errorf("no %s forward %q on connection %q", forwardType, specStr, conn.GetName())
+	}
+	if removed != nil {
+		removed.Close()
+		conndebug.LogConnf(conn.GetName(), "forward: %s %q closed", forwardType, specStr)
+	}
+	conn.fireForwardsEvent()
 	return nil
 }
 
+// returns the address of a socks proxy for the connection (starting one on a free port if the
+// connection doesn't have a dynamic forward yet)
+func (conn *SSHConn) GetSocksProxy() (string, error) {
+	for _, info := range conn.GetForwards() {
+		if info.Type == wshrpc.ForwardType_Dynamic && info.Error == "" {
+			return info.ListenAddr, nil
+		}
+	}
+	info, err := conn.AddForward(wshrpc.ForwardType_Dynamic, "0")
+	if err != nil {
+		return "", err
+	}
+	return info.ListenAddr, nil
+}
+
+// forwards for every connection
+func GetAllForwards() []wshrpc.PortForwardInfo {
+	globalLock.Lock()
+	conns := make([]*SSHConn, 0, len(clientControllerMap))
+	for _, conn := range clientControllerMap {
+		conns = append(conns, conn)
+	}
+	globalLock.Unlock()
+	rtn := []wshrpc.PortForwardInfo{}
+	for _, conn := range conns {
+		rtn = append(rtn, conn.GetForwards()...)
+	}
+	return rtn
+}
+
+// sends openssh keepalive requests while client is the connection's client.  the round trip
+// times (and failures) go into the connection's stats, and the debug log when it is enabled,
+// so stalls show up there.
+func (conn *SSHConn) runKeepAlives(client *ssh.Client) {
+	defer panichandler.PanicHandler("conncontroller:runKeepAlives")
+	stats := remote.GetClientStats(client)
+	ticker := time.NewTicker(KeepAliveInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if conn.GetClient() != client {
+			return
+		}
+		startTime := time.Now()
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		rtt := time.Since(startTime)
+		if stats != nil {
+			stats.RecordKeepAlive(rtt, err)
+		}
+		if err != nil {
+			conndebug.LogConnf(conn.GetName(), "keepalive: failed after %v: %v", rtt.Round(time.Millisecond), err)
+			return
+		}
+		conndebug.LogConnf(conn.GetName(), "keepalive: rtt %v", rtt.Round(time.Millisecond))
+	}
+}
+
+// traffic, round trip time, and channel counts for the connection
+func (conn *SSHConn) GetStats() (*wshrpc.ConnStatsInfo, error) {
+	client := conn.GetClient()
+	if client == nil || conn.GetStatus() != Status_Connected {
+		return nil, fmt.Errorf("connection %q is not connected", conn.GetName())
+	}
+	stats := remote.GetClientStats(client)
+	if stats == nil {
+		return nil, fmt.Errorf("no stats for connection %q", conn.GetName())
+	}
+	info := stats.GetInfo(conn.GetName())
+	return &info, nil
+}
+
 func (conn *SSHConn) waitForDisconnect() {
 	defer conn.FireConnChangeEvent()
 	defer conn.HasWaiter.Store(false)
-	client := conn.GetClient()
+	var client *ssh.Client
+	var stopCh chan struct{}
+	conn.WithLock(func() {
+		client = conn.Client
+		stopCh = conn.ClientStopCh
+	})
 	if client == nil {
 		return
 	}
-	err := client.Wait()
+	err := remote.WaitClient(client, stopCh)
+	conndebug.LogConnf(conn.GetName(), "disconnected (err: %v)", err)
+	var details string
+	if err != nil {
+		details = err.Error()
+	}
+	audit.Record(audit.Event_ConnDisconnect, conn.GetName(), "", details)
+	remote.PublishConnEvent(conn.GetName(), wshrpc.ConnLifecycleEvent{Type: wshrpc.ConnEvent_Disconnected, Error: details})
+	setMountsStatus(conn.GetName(), wshrpc.MountStatus_Disconnected, details)
 	conn.WithLock(func() {
 		// disconnects happen for a variety of reasons (like network, etc. and are typically transient)
 		// so we just set the status to "disconnected" here (not error)
@@ -0,0 +1,90 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package conncontroller
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// the connections (from GetConnectionsList) with their display settings, for organizing and
+// searching large lists.  favorites come first, then connections are sorted by group (ungrouped
+// ones first), display:order, and name.
+
+func makeConnListEntry(connName string, connSettings wshrpc.ConnKeywords, status string) wshrpc.ConnListEntry {
+	return wshrpc.ConnListEntry{
+		Connection: connName,
+		Group:      connSettings.DisplayGroup,
+		Tags:       connSettings.DisplayTags,
+		Color:      connSettings.DisplayColor,
+		Favorite:   connSettings.DisplayFavorite,
+		Hidden:     connSettings.DisplayHidden != nil && *connSettings.DisplayHidden,
+		Order:      connSettings.DisplayOrder,
+		Status:     status,
+	}
+}
+
+func connListEntryMatches(entry wshrpc.ConnListEntry, filter wshrpc.ConnListFilter) bool {
+	if entry.Hidden && !filter.ShowHidden {
+		return false
+	}
+	if filter.Favorites && !entry.Favorite {
+		return false
+	}
+	if filter.Group != "" && !strings.EqualFold(entry.Group, filter.Group) {
+		return false
+	}
+	for _, tag := range filter.Tags {
+		if !slices.ContainsFunc(entry.Tags, func(entryTag string) bool { return strings.EqualFold(entryTag, tag) }) {
+			return false
+		}
+	}
+	if filter.Query == "" {
+		return true
+	}
+	query := strings.ToLower(filter.Query)
+	if strings.Contains(strings.ToLower(entry.Connection), query) || strings.Contains(strings.ToLower(entry.Group), query) {
+		return true
+	}
+	return slices.ContainsFunc(entry.Tags, func(tag string) bool { return strings.Contains(strings.ToLower(tag), query) })
+}
+
+func compareConnListEntries(a wshrpc.ConnListEntry, b wshrpc.ConnListEntry) int {
+	if a.Favorite != b.Favorite {
+		if a.Favorite {
+			return -1
+		}
+		return 1
+	}
+	return cmp.Or(
+		cmp.Compare(strings.ToLower(a.Group), strings.ToLower(b.Group)),
+		cmp.Compare(a.Order, b.Order),
+		cmp.Compare(a.Connection, b.Connection),
+	)
+}
+
+func ListConnectionInfo(filter wshrpc.ConnListFilter) ([]wshrpc.ConnListEntry, error) {
+	connNames, err := GetConnectionsList()
+	if err != nil {
+		return nil, err
+	}
+	statusMap := make(map[string]string)
+	for _, status := range GetAllConnStatus() {
+		statusMap[status.Connection] = status.Status
+	}
+	connections := wconfig.ReadFullConfig().Connections
+	rtn := []wshrpc.ConnListEntry{}
+	for _, connName := range connNames {
+		entry := makeConnListEntry(connName, connections[connName], statusMap[connName])
+		if connListEntryMatches(entry, filter) {
+			rtn = append(rtn, entry)
+		}
+	}
+	slices.SortStableFunc(rtn, compareConnListEntries)
+	return rtn, nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package conncontroller
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/remote"
+	"github.com/wavetermdev/waveterm/pkg/remote/conndebug"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"golang.org/x/crypto/ssh"
+)
+
+// runs cmd in a new session on client, returns its exit code (-1 if there isn't one) and the
+// signal that killed it.  the session is killed if ctx is done.
+func runConnCommand(ctx context.Context, connName string, client *ssh.Client, cmd string, env map[string]string, stdin io.Reader, stdout io.Writer, stderr io.Writer) (int, string, error) {
+	// keeps the (shared) client open until the command is done, even if the connection is closed
+	if !remote.RetainClient(client) {
+		return -1, "", fmt.Errorf("connection %q is closing", connName)
+	}
+	defer remote.ReleaseClient(client)
+	session, err := client.NewSession()
+	if err != nil {
+		return -1, "", err
+	}
+	defer session.Close()
+	for envKey, envVal := range env {
+		// like the shell, these might not be accepted (depending on AcceptEnv)
+		session.Setenv(envKey, envVal)
+	}
+	session.Stdin = stdin
+	session.Stdout = stdout
+	session.Stderr = stderr
+	if err := session.Start(cmd); err != nil {
+		return -1, "", err
+	}
+	waitCh := make(chan error, 1)
+	go func() {
+		waitCh <- session.Wait()
+	}()
+	select {
+	case err = <-waitCh:
+	case <-ctx.Done():
+		session.Signal(ssh.SIGKILL)
+		session.Close()
+		return -1, "", ctx.Err()
+	}
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		if exitErr.Signal() != "" {
+			return -1, exitErr.Signal(), nil
+		}
+		return exitErr.ExitStatus(), "", nil
+	}
+	if err != nil {
+		return -1, "", err
+	}
+	return 0, "", nil
+}
+
+// sends output chunks of an exec as events
+type execWriter struct {
+	eventType string
+	eventFn   func(wshrpc.ConnExecEvent)
+}
+
+func (ew *execWriter) Write(p []byte) (int, error) {
+	ew.eventFn(wshrpc.ConnExecEvent{Type: ew.eventType, Data64: base64.StdEncoding.EncodeToString(p)})
+	return len(p), nil
+}
+
+// Exec runs a one-off command on a connected connection (it is not connected for you), sending
+// stdout and stderr to eventFn as they arrive, and then an "exit" event with the exit status
+func (conn *SSHConn) Exec(ctx context.Context, data wshrpc.CommandConnExecData, eventFn func(wshrpc.ConnExecEvent)) error {
+	if strings.TrimSpace(data.Command) == "" {
+		return fmt.Errorf("no command given")
+	}
+	client := conn.GetClient()
+	if client == nil || conn.GetStatus() != Status_Connected {
+		return fmt.Errorf("connection %q is not connected", conn.GetName())
+	}
+	var stdin io.Reader
+	if data.Stdin64 != "" {
+		stdinData, err := base64.StdEncoding.DecodeString(data.Stdin64)
+		if err != nil {
+			return fmt.Errorf("invalid stdin: %w", err)
+		}
+		stdin = bytes.NewReader(stdinData)
+	}
+	cmd := data.Command
+	if data.Cwd != "" {
+		// on its own line, so a failed cd stops commands with ";" or newlines in them too
+		cmd = fmt.Sprintf("cd %s || exit 1\n%s", remote.QuoteRemotePath(data.Cwd), cmd)
+	}
+	if data.TimeoutMs > 0 {
+		var cancelFn context.CancelFunc
+		ctx, cancelFn = context.WithTimeout(ctx, time.Duration(data.TimeoutMs)*time.Millisecond)
+		defer cancelFn()
+	}
+	conndebug.LogConnf(conn.GetName(), "exec: running %q", cmd)
+	stdout := &execWriter{eventType: wshrpc.ExecEvent_Stdout, eventFn: eventFn}
+	stderr := &execWriter{eventType: wshrpc.ExecEvent_Stderr, eventFn: eventFn}
+	exitCode, exitSignal, err := runConnCommand(ctx, conn.GetName(), client, cmd, data.Env, stdin, stdout, stderr)
+	if err != nil {
+		return err
+	}
+	eventFn(wshrpc.ConnExecEvent{Type: wshrpc.ExecEvent_Exit, ExitCode: exitCode, ExitSignal: exitSignal})
+	return nil
+}
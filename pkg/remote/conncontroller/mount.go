@@ -0,0 +1,222 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package conncontroller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/docker"
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/remote"
+	"github.com/wavetermdev/waveterm/pkg/remote/conndebug"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// mounts make a remote directory available under a "mount://<name>/" path, which the file
+// apis (FileService) resolve to the connection and remote path.  mounts are kept while the
+// connection is down (file operations on them fail), and are re-mounted when it reconnects.
+
+const MountResolveTimeout = 10 * time.Second
+
+var mountNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+var mountsLock = &sync.Mutex{}
+var mounts = make(map[string]*wshrpc.MountInfo)
+
+// resolves the remote directory to an absolute path (following symlinks), so later
+// reconnects (which might land in another home directory) can't change what is mounted
+func resolveMountDir(ctx context.Context, conn *SSHConn, remotePath string) (string, error) {
+	client := conn.GetClient()
+	if client == nil || conn.GetStatus() != Status_Connected {
+		return "", fmt.Errorf("connection %q is not connected", conn.GetName())
+	}
+	ctx, cancelFn := context.WithTimeout(ctx, MountResolveTimeout)
+	defer cancelFn()
+	var stdout, stderr bytes.Buffer
+	cmd := fmt.Sprintf("cd %s && pwd -P", remote.QuoteRemotePath(remotePath))
+	exitCode, _, err := runConnCommand(ctx, conn.GetName(), client, cmd, nil, nil, &stdout, &stderr)
+	if err != nil {
+		return "", err
+	}
+	if exitCode != 0 {
+		return "", fmt.Errorf("cannot mount %s: %s", remotePath, strings.TrimSpace(stderr.String()))
+	}
+	absPath := strings.TrimSpace(stdout.String())
+	if !strings.HasPrefix(absPath, "/") {
+		return "", fmt.Errorf("cannot mount %s: unexpected output %q", remotePath, absPath)
+	}
+	return absPath, nil
+}
+
+// Mount adds a mount for data.RemotePath (a directory) on data.Connection, connecting it if
+// needed.  the mount name defaults to the base name of the directory.
+func Mount(ctx context.Context, data wshrpc.CommandConnMountData) (*wshrpc.MountInfo, error) {
+	if data.RemotePath == "" {
+		data.RemotePath = "~"
+	}
+	conn, err := connectForMount(ctx, data.Connection)
+	if err != nil {
+		return nil, err
+	}
+	absPath, err := resolveMountDir(ctx, conn, data.RemotePath)
+	if err != nil {
+		return nil, err
+	}
+	name := data.Name
+	if name == "" {
+		name = path.Base(absPath)
+		if name == "/" {
+			name = "root"
+		}
+	}
+	if !mountNameRe.MatchString(name) {
+		return nil, fmt.Errorf("invalid mount name %q (use letters, numbers, '.', '_', and '-')", name)
+	}
+	mountsLock.Lock()
+	defer mountsLock.Unlock()
+	if mounts[name] != nil {
+		return nil, fmt.Errorf("mount %q already exists", name)
+	}
+	info := &wshrpc.MountInfo{
+		Name:       name,
+		Connection: data.Connection,
+		RemotePath: data.RemotePath,
+		MountPath:  absPath,
+		Status:     wshrpc.MountStatus_Mounted,
+		MountedTs:  time.Now().UnixMilli(),
+	}
+	mounts[name] = info
+	conndebug.LogConnf(data.Connection, "mounted %s as %s%s", absPath, wshrpc.MountPathPrefix, name)
+	rtn := *info
+	return &rtn, nil
+}
+
+func connectForMount(ctx context.Context, connName string) (*SSHConn, error) {
+	if connName == "" || connName == "local" || strings.HasPrefix(connName, "wsl://") || strings.HasPrefix(connName, "k8s://") || docker.IsContainerConnName(connName) || strings.HasPrefix(connName, "telnet://") {
+		return nil, fmt.Errorf("mounts are only supported on ssh connections")
+	}
+	opts, err := remote.ParseOpts(connName)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing connection name: %w", err)
+	}
+	conn := GetConn(ctx, opts, false, &wshrpc.ConnKeywords{})
+	switch conn.GetStatus() {
+	case Status_Connected:
+	case Status_Connecting:
+		err = conn.WaitForConnect(ctx)
+	default:
+		err = conn.Connect(ctx, &wshrpc.ConnKeywords{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+func Unmount(name string) error {
+	mountsLock.Lock()
+	defer mountsLock.Unlock()
+	info := mounts[name]
+	if info == nil {
+		return fmt.Errorf("mount %q not found", name)
+	}
+	delete(mounts, name)
+	conndebug.LogConnf(info.Connection, "unmounted %s%s", wshrpc.MountPathPrefix, name)
+	return nil
+}
+
+func GetMounts() []wshrpc.MountInfo {
+	mountsLock.Lock()
+	defer mountsLock.Unlock()
+	rtn := make([]wshrpc.MountInfo, 0, len(mounts))
+	for _, info := range mounts {
+		rtn = append(rtn, *info)
+	}
+	sort.Slice(rtn, func(i, j int) bool {
+		return rtn[i].Name < rtn[j].Name
+	})
+	return rtn
+}
+
+// ResolveMountPath converts a "mount://<name>/<path>" path into the connection and the remote
+// path, and returns the mount (nil for other paths, which are returned unchanged).  the path
+// can't go above the mounted directory.
+func ResolveMountPath(connName string, filePath string) (string, string, *wshrpc.MountInfo, error) {
+	if !strings.HasPrefix(filePath, wshrpc.MountPathPrefix) {
+		return connName, filePath, nil, nil
+	}
+	name, subPath, _ := strings.Cut(strings.TrimPrefix(filePath, wshrpc.MountPathPrefix), "/")
+	mountsLock.Lock()
+	info := mounts[name]
+	var mountInfo wshrpc.MountInfo
+	if info != nil {
+		mountInfo = *info
+	}
+	mountsLock.Unlock()
+	if info == nil {
+		return "", "", nil, fmt.Errorf("mount %q not found", name)
+	}
+	if mountInfo.Status != wshrpc.MountStatus_Mounted {
+		return "", "", nil, fmt.Errorf("mount %q is not available (%s)", name, mountInfo.Status)
+	}
+	// cleaned as an absolute path so ".." stops at the mount's root
+	subPath = path.Clean("/" + subPath)
+	return mountInfo.Connection, path.Join(mountInfo.MountPath, subPath), &mountInfo, nil
+}
+
+func setMountsStatus(connName string, status string, errStr string) {
+	mountsLock.Lock()
+	defer mountsLock.Unlock()
+	for _, info := range mounts {
+		if info.Connection == connName {
+			info.Status = status
+			info.Error = errStr
+		}
+	}
+}
+
+// re-mounts the connection's mounts after it (re)connects.  the remote directory is checked
+// again, a mount whose directory is gone is put in the error state.
+func remountConn(conn *SSHConn) {
+	defer panichandler.PanicHandler("conncontroller:remountConn")
+	connName := conn.GetName()
+	var toRemount []wshrpc.MountInfo
+	mountsLock.Lock()
+	for _, info := range mounts {
+		if info.Connection == connName {
+			toRemount = append(toRemount, *info)
+		}
+	}
+	mountsLock.Unlock()
+	for _, mountInfo := range toRemount {
+		absPath, err := resolveMountDir(context.Background(), conn, mountInfo.MountPath)
+		mountsLock.Lock()
+		info := mounts[mountInfo.Name]
+		if info != nil && info.Connection == connName {
+			if err != nil {
+				info.Status = wshrpc.MountStatus_Error
+				info.Error = err.Error()
+			} else {
+				info.MountPath = absPath
+				info.Status = wshrpc.MountStatus_Mounted
+				info.Error = ""
+				info.MountedTs = time.Now().UnixMilli()
+			}
+		}
+		mountsLock.Unlock()
+		if err != nil {
+			conndebug.LogConnf(connName, "cannot re-mount %s%s: %v", wshrpc.MountPathPrefix, mountInfo.Name, err)
+		} else {
+			conndebug.LogConnf(connName, "re-mounted %s%s", wshrpc.MountPathPrefix, mountInfo.Name)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// verbose per-connection debug log (the equivalent of "ssh -vvv" for Wave's
+// ssh client).  enabled per connection with the "conn:debuglog" keyword.  events
+// are written to a circular file in the client zone
+// (wavefile://client/conndebug/<connection>.log).
+package conndebug
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/filestore"
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+	"github.com/wavetermdev/waveterm/pkg/wstore"
+)
+
+const FileNamePrefix = "conndebug/"
+const MaxLogFileSize = 1024 * 1024
+const TimeFormat = "2006-01-02 15:04:05.000"
+
+type connNameKey struct{}
+
+var clientIdLock = &sync.Mutex{}
+var clientId string
+
+var writeLock = &sync.Mutex{}
+
+func FileName(connName string) string {
+	return FileNamePrefix + connName + ".log"
+}
+
+func IsEnabled(connName string) bool {
+	connConfig, ok := wconfig.ReadFullConfig().Connections[connName]
+	return ok && connConfig.ConnDebugLog != nil && *connConfig.ConnDebugLog
+}
+
+// WithConn tags ctx with the connection being debugged (nested calls keep the outer connection,
+// so proxy jump hops are logged to the target connection's log)
+func WithConn(ctx context.Context, connName string) context.Context {
+	if ConnFromContext(ctx) != "" {
+		return ctx
+	}
+	return context.WithValue(ctx, connNameKey{}, connName)
+}
+
+func ConnFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	connName, _ := ctx.Value(connNameKey{}).(string)
+	return connName
+}
+
+// Logf logs to the debug log of the connection in ctx (no-op if there is none, or it is not enabled)
+func Logf(ctx context.Context, format string, args ...any) {
+	LogConnf(ConnFromContext(ctx), format, args...)
+}
+
+func LogConnf(connName string, format string, args ...any) {
+	if connName == "" || !IsEnabled(connName) {
+		return
+	}
+	line := fmt.Sprintf("%s %s", time.Now().Format(TimeFormat), fmt.Sprintf(format, args...))
+	if !strings.HasSuffix(line, "\n") {
+		line += "\n"
+	}
+	ctx, cancelFn := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancelFn()
+	// errors are ignored, the debug log must never break the connection
+	appendLine(ctx, connName, line)
+}
+
+func getClientId(ctx context.Context) (string, error) {
+	clientIdLock.Lock()
+	defer clientIdLock.Unlock()
+	if clientId != "" {
+		return clientId, nil
+	}
+	client, err := wstore.DBGetSingleton[*waveobj.Client](ctx)
+	if err != nil {
+		return "", fmt.Errorf("error getting client: %w", err)
+	}
+	clientId = client.OID
+	return clientId, nil
+}
+
+func appendLine(ctx context.Context, connName string, line string) error {
+	zoneId, err := getClientId(ctx)
+	if err != nil {
+		return err
+	}
+	writeLock.Lock()
+	defer writeLock.Unlock()
+	fileName := FileName(connName)
+	err = filestore.WFS.MakeFile(ctx, zoneId, fileName, nil, filestore.FileOptsType{MaxSize: MaxLogFileSize, Circular: true})
+	if err != nil && err != fs.ErrExist {
+		return err
+	}
+	return filestore.WFS.AppendData(ctx, zoneId, fileName, []byte(line))
+}
+
+// ReadLog returns the connection's debug log ("" if nothing has been logged)
+func ReadLog(ctx context.Context, connName string) (string, error) {
+	zoneId, err := getClientId(ctx)
+	if err != nil {
+		return "", err
+	}
+	_, data, err := filestore.WFS.ReadFile(ctx, zoneId, FileName(connName))
+	if err == fs.ErrNotExist {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading debug log: %w", err)
+	}
+	return string(data), nil
+}
+
+func ClearLog(ctx context.Context, connName string) error {
+	zoneId, err := getClientId(ctx)
+	if err != nil {
+		return err
+	}
+	writeLock.Lock()
+	defer writeLock.Unlock()
+	err = filestore.WFS.DeleteFile(ctx, zoneId, FileName(connName))
+	if err != nil && err != fs.ErrNotExist {
+		return err
+	}
+	return nil
+}
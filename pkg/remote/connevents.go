@@ -0,0 +1,101 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/remote/conndebug"
+	"github.com/wavetermdev/waveterm/pkg/userinput"
+	"github.com/wavetermdev/waveterm/pkg/wlog"
+	"github.com/wavetermdev/waveterm/pkg/wps"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// lifecycle events for connections (connecting, auth, connected, disconnected, ...) are
+// published as "conn:lifecycle", scoped to "connection:<name>", so connection progress can be
+// shown while it happens.  events from ConnectToClient go to the connection in ctx (see
+// conndebug.WithConn), so the hops of a ProxyJump are reported on the target connection.
+
+var connEventLog = wlog.Logger("connevents")
+
+func PublishConnEvent(connName string, event wshrpc.ConnLifecycleEvent) {
+	if connName == "" {
+		return
+	}
+	event.Connection = connName
+	if event.Ts == 0 {
+		event.Ts = time.Now().UnixMilli()
+	}
+	connEventLog.Debug("conn event", wlog.ConnAttr(connName), "type", event.Type, "host", event.Host, "jumpnum", event.JumpNum, "authmethod", event.AuthMethod, "error", event.Error)
+	wps.Broker.Publish(wps.WaveEvent{
+		Event:  wps.Event_ConnLifecycle,
+		Scopes: []string{"connection:" + connName},
+		Data:   event,
+	})
+}
+
+func publishConnEventCtx(ctx context.Context, event wshrpc.ConnLifecycleEvent) {
+	PublishConnEvent(conndebug.ConnFromContext(ctx), event)
+}
+
+func makeHopEvent(eventType string, debugInfo *ConnectionDebugInfo) wshrpc.ConnLifecycleEvent {
+	event := wshrpc.ConnLifecycleEvent{Type: eventType, JumpNum: debugInfo.JumpNum}
+	if debugInfo.NextOpts != nil {
+		event.Host = debugInfo.NextOpts.String()
+	}
+	return event
+}
+
+// the hop being connected, as json (the debug info holds the jump host's client)
+func makeConnEventDebugInfo(debugInfo *ConnectionDebugInfo) *wshrpc.ConnEventDebugInfo {
+	if debugInfo == nil {
+		return nil
+	}
+	rtn := &wshrpc.ConnEventDebugInfo{JumpNum: debugInfo.JumpNum}
+	if debugInfo.NextOpts != nil {
+		rtn.Host = debugInfo.NextOpts.String()
+	}
+	if debugInfo.CurrentClient != nil {
+		rtn.ViaAddr = debugInfo.CurrentClient.RemoteAddr().String()
+	}
+	return rtn
+}
+
+// an "error" event for err, with the hop it happened on when it is a ConnectionError
+func MakeConnErrorEvent(err error) wshrpc.ConnLifecycleEvent {
+	event := wshrpc.ConnLifecycleEvent{Type: wshrpc.ConnEvent_Error, Error: err.Error(), ErrorCode: GetConnErrorCode(err)}
+	var connErr ConnectionError
+	if errors.As(err, &connErr) {
+		event.DebugInfo = makeConnEventDebugInfo(connErr.ConnectionDebugInfo)
+		if event.DebugInfo != nil {
+			event.Host = event.DebugInfo.Host
+			event.JumpNum = event.DebugInfo.JumpNum
+		}
+	}
+	return event
+}
+
+// returns the ConnErrorCode_* for a connection error ("" if it has none)
+func GetConnErrorCode(err error) string {
+	var revokedErr *HostKeyRevokedError
+	if errors.As(err, &revokedErr) {
+		return wshrpc.ConnErrorCode_HostKeyRevoked
+	}
+	var krlErr *HostKeyKRLRevokedError
+	if errors.As(err, &krlErr) {
+		return wshrpc.ConnErrorCode_HostKeyKRLRevoked
+	}
+	var forwardErr *ForwardFailedError
+	if errors.As(err, &forwardErr) {
+		return wshrpc.ConnErrorCode_ForwardFailed
+	}
+	var noPromptErr *userinput.NoPromptError
+	if errors.As(err, &noPromptErr) {
+		return wshrpc.ConnErrorCode_InputRequired
+	}
+	return ""
+}
@@ -0,0 +1,155 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// imports the saved sessions of other ssh clients (or the hosts of an ssh config) as connections
+// in connections.json.  each source has a connImporter that reads its sessions, the merge into
+// connections.json (and the conflict reporting) is the same for all of them.
+
+// a connImporter reads the sessions of a source (from path, or its default location)
+type connImporter interface {
+	ReadConns(path string) ([]*importedConn, error)
+}
+
+// a session converted to a connection.  sessions with Err set are skipped.
+type importedConn struct {
+	Session  string
+	ConnName string
+	Meta     waveobj.MetaMapType
+	Warnings []string
+	Err      error
+}
+
+var connImporters = map[string]connImporter{
+	wshrpc.ConnImportSource_Putty:     puttyImporter{source: wshrpc.ConnImportSource_Putty},
+	wshrpc.ConnImportSource_Kitty:     puttyImporter{source: wshrpc.ConnImportSource_Kitty},
+	wshrpc.ConnImportSource_Termius:   termiusImporter{},
+	wshrpc.ConnImportSource_SecureCrt: secureCrtImporter{},
+	wshrpc.ConnImportSource_SshConfig: sshConfigImporter{},
+}
+
+// makes the [user@]host[:port] connection name (port 0 or 22 is left out)
+func makeImportConnName(userName string, host string, port int) (string, error) {
+	if host == "" {
+		return "", fmt.Errorf("no host name")
+	}
+	connName := host
+	if userName != "" {
+		connName = userName + "@" + host
+	}
+	if port != 22 && port > 0 {
+		connName += ":" + strconv.Itoa(port)
+	}
+	if _, err := ParseOpts(connName); err != nil {
+		return "", fmt.Errorf("cannot make a connection name for %q", connName)
+	}
+	return connName, nil
+}
+
+// sets a list keyword (like ssh:identityfile), unless vals is empty
+func setImportListValue(meta waveobj.MetaMapType, key string, vals []string) {
+	if len(vals) == 0 {
+		return
+	}
+	var listVal []any
+	for _, val := range vals {
+		listVal = append(listVal, val)
+	}
+	meta[key] = listVal
+}
+
+// compares a value being imported with the saved one (the saved one was decoded from json)
+func isSameConnValue(saved any, val any) bool {
+	return reflect.DeepEqual(saved, val) || fmt.Sprint(saved) == fmt.Sprint(val)
+}
+
+// ImportConnections imports the sessions of data.Source as connections.  a connection that is
+// already saved with different settings is a conflict, which is only overwritten with data.Overwrite.
+func ImportConnections(data wshrpc.CommandConnImportData) (*wshrpc.ConnImportResult, error) {
+	importer, ok := connImporters[data.Source]
+	if !ok {
+		return nil, fmt.Errorf("invalid import source %q", data.Source)
+	}
+	conns, err := importer.ReadConns(data.Path)
+	if err != nil {
+		return nil, fmt.Errorf("reading sessions: %w", err)
+	}
+	sort.SliceStable(conns, func(i, j int) bool {
+		return conns[i].Session < conns[j].Session
+	})
+	savedConns, cerrs := wconfig.ReadWaveHomeConfigFile(wconfig.ConnectionsFile)
+	if len(cerrs) > 0 {
+		return nil, fmt.Errorf("error reading %s: %v", wconfig.ConnectionsFile, cerrs[0])
+	}
+	rtn := &wshrpc.ConnImportResult{}
+	importedFrom := make(map[string]string)
+	for _, conn := range conns {
+		entry := wshrpc.ConnImportEntry{
+			Session:    conn.Session,
+			Connection: conn.ConnName,
+			Warnings:   conn.Warnings,
+			Keywords:   conn.Meta,
+		}
+		switch {
+		case conn.Err != nil:
+			entry.Status = wshrpc.ConnImportStatus_Skipped
+			entry.Message = conn.Err.Error()
+		case importedFrom[conn.ConnName] != "":
+			entry.Status = wshrpc.ConnImportStatus_Conflict
+			entry.Message = fmt.Sprintf("also the connection of session %q", importedFrom[conn.ConnName])
+		default:
+			importedFrom[conn.ConnName] = conn.Session
+			entry.Status, entry.Message = importConn(savedConns.GetMap(conn.ConnName), conn.ConnName, conn.Meta, data)
+		}
+		rtn.Entries = append(rtn.Entries, entry)
+	}
+	return rtn, nil
+}
+
+func importConn(saved waveobj.MetaMapType, connName string, meta waveobj.MetaMapType, data wshrpc.CommandConnImportData) (string, string) {
+	status := wshrpc.ConnImportStatus_Added
+	toMerge := make(waveobj.MetaMapType)
+	if saved != nil {
+		status = wshrpc.ConnImportStatus_Unchanged
+		var conflictKeys []string
+		for key, val := range meta {
+			savedVal, ok := saved[key]
+			if !ok {
+				toMerge[key] = val
+				status = wshrpc.ConnImportStatus_Updated
+			} else if !isSameConnValue(savedVal, val) {
+				conflictKeys = append(conflictKeys, key)
+				toMerge[key] = val
+			}
+		}
+		if len(conflictKeys) > 0 {
+			sort.Strings(conflictKeys)
+			if !data.Overwrite {
+				return wshrpc.ConnImportStatus_Conflict, fmt.Sprintf("already saved with a different %s", strings.Join(conflictKeys, ", "))
+			}
+			status = wshrpc.ConnImportStatus_Updated
+		}
+	} else {
+		toMerge = meta
+	}
+	if data.DryRun || status == wshrpc.ConnImportStatus_Unchanged {
+		return status, ""
+	}
+	if err := wconfig.SetConnectionsConfigValue(connName, toMerge); err != nil {
+		return wshrpc.ConnImportStatus_Skipped, err.Error()
+	}
+	return status, ""
+}
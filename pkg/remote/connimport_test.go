@@ -0,0 +1,133 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+)
+
+func checkImportedConn(t *testing.T, conn *importedConn, session string, connName string, meta waveobj.MetaMapType, numWarnings int) {
+	t.Helper()
+	if conn.Err != nil {
+		t.Errorf("%s: %v", session, conn.Err)
+		return
+	}
+	if conn.Session != session || conn.ConnName != connName {
+		t.Errorf("got session %q connection %q, expected %q %q", conn.Session, conn.ConnName, session, connName)
+	}
+	if !reflect.DeepEqual(conn.Meta, meta) || len(conn.Warnings) != numWarnings {
+		t.Errorf("%s: got %v (warnings %v)", session, conn.Meta, conn.Warnings)
+	}
+}
+
+func TestParseTermiusExport(t *testing.T) {
+	export := `{"hosts": [
+		{"label": "bastion", "address": "bastion.example.com", "ssh_config": {"identity": {"username": "jump", "ssh_key": {"label": "jump", "path": "~/.ssh/jump"}}}},
+		{"label": "db", "address": "10.0.0.5", "group": "prod", "ssh_config": {"port": 2222, "identity": {"username": "dba", "ssh_key": {"label": "dbkey", "private_key": "-----BEGIN"}}, "host_chain": ["bastion"]}},
+		{"label": "broken"}
+	]}`
+	conns, err := parseTermiusExport([]byte(export))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conns) != 3 {
+		t.Fatalf("got %d hosts", len(conns))
+	}
+	checkImportedConn(t, conns[0], "bastion", "jump@bastion.example.com", waveobj.MetaMapType{"ssh:identityfile": []any{"~/.ssh/jump"}}, 0)
+	checkImportedConn(t, conns[1], "prod/db", "dba@10.0.0.5:2222", waveobj.MetaMapType{"ssh:proxyjump": []any{"jump@bastion.example.com"}}, 1)
+	if conns[2].Err == nil {
+		t.Errorf("a host without an address should be skipped")
+	}
+}
+
+func TestParseSecureCrtExport(t *testing.T) {
+	export := `<?xml version="1.0" encoding="UTF-8"?>
+<VanDyke version="3.0">
+	<key name="Sessions">
+		<key name="Default">
+			<string name="Protocol Name">SSH2</string>
+		</key>
+		<key name="prod">
+			<key name="bastion">
+				<string name="Hostname">bastion.example.com</string>
+				<string name="Username">jump</string>
+				<string name="Protocol Name">SSH2</string>
+				<dword name="[SSH2] Port">22</dword>
+				<string name="Identity Filename V2">/home/me/.ssh/jump::rawkey</string>
+				<string name="Firewall Name">None</string>
+			</key>
+			<key name="web">
+				<string name="Hostname">web.internal</string>
+				<string name="Username">deploy</string>
+				<string name="Protocol Name">SSH2</string>
+				<dword name="[SSH2] Port">2200</dword>
+				<string name="Firewall Name">Session:prod/bastion</string>
+			</key>
+			<key name="switch">
+				<string name="Hostname">switch.internal</string>
+				<string name="Protocol Name">Telnet</string>
+			</key>
+		</key>
+	</key>
+</VanDyke>`
+	conns, err := parseSecureCrtExport([]byte(export))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conns) != 3 {
+		t.Fatalf("got %d sessions", len(conns))
+	}
+	checkImportedConn(t, conns[0], "prod/bastion", "jump@bastion.example.com", waveobj.MetaMapType{"ssh:identityfile": []any{"/home/me/.ssh/jump"}}, 0)
+	checkImportedConn(t, conns[1], "prod/web", "deploy@web.internal:2200", waveobj.MetaMapType{"ssh:proxyjump": []any{"jump@bastion.example.com"}}, 0)
+	if conns[2].Err == nil {
+		t.Errorf("telnet sessions should be skipped")
+	}
+}
+
+func TestConvertSshConfigHosts(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config")
+	config := `Host bastion
+    HostName bastion.example.com
+    User jump
+
+Host web web2
+    HostName %h.internal
+    Port 2222
+    ProxyJump bastion
+    IdentityFile ~/.ssh/web
+    LocalForward 8080 localhost:80
+
+Match exec "false"
+    User nobody
+
+Host *.internal *
+    IdentityFile ~/.ssh/default
+    Compression yes
+`
+	if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := parseSshConfigFile(configPath, dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conns := convertSshConfigHosts(file)
+	if len(conns) != 3 {
+		t.Fatalf("got %d hosts", len(conns))
+	}
+	checkImportedConn(t, conns[0], "bastion", "jump@bastion.example.com", waveobj.MetaMapType{
+		"ssh:identityfile": []any{"~/.ssh/default"},
+	}, 0)
+	checkImportedConn(t, conns[2], "web2", "web2.internal:2222", waveobj.MetaMapType{
+		"ssh:identityfile": []any{"~/.ssh/web", "~/.ssh/default"},
+		"ssh:proxyjump":    []any{"jump@bastion.example.com"},
+		"ssh:localforward": []any{"8080 localhost:80"},
+	}, 0)
+}
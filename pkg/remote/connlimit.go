@@ -0,0 +1,148 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// limits how many ssh connections are dialed and authenticated at once, in total
+// (conn:maxconcurrent) and per host (conn:maxconcurrentperhost).  opening many tabs at once
+// otherwise dials every host together, which trips sshd's MaxStartups and other rate limits.
+// a slot is only held while one hop dials and authenticates (the jump hosts before it are
+// already connected), so proxy jumps can't deadlock on their own slots.  connections over the
+// limit wait in a queue (in order, unless only their host is full) and get a "queued" event.
+
+const (
+	DefaultMaxConcurrentConns        = 8
+	DefaultMaxConcurrentConnsPerHost = 3
+)
+
+type connSlotWaiter struct {
+	Host       string
+	MaxTotal   int // 0 is unlimited
+	MaxPerHost int
+	Granted    bool
+	ReadyCh    chan struct{}
+}
+
+type connLimiter struct {
+	Lock         *sync.Mutex
+	Active       int
+	ActiveByHost map[string]int
+	Queue        []*connSlotWaiter
+}
+
+var globalConnLimiter = makeConnLimiter()
+
+func makeConnLimiter() *connLimiter {
+	return &connLimiter{Lock: &sync.Mutex{}, ActiveByHost: make(map[string]int)}
+}
+
+// the configured limits (0 is unlimited)
+func getConnLimits() (int, int) {
+	maxTotal, maxPerHost := DefaultMaxConcurrentConns, DefaultMaxConcurrentConnsPerHost
+	watcher := wconfig.GetWatcher()
+	if watcher == nil {
+		return maxTotal, maxPerHost
+	}
+	settings := watcher.GetFullConfig().Settings
+	if settings.ConnMaxConcurrent != nil {
+		maxTotal = max(int(*settings.ConnMaxConcurrent), 0)
+	}
+	if settings.ConnMaxConcurrentPerHost != nil {
+		maxPerHost = max(int(*settings.ConnMaxConcurrentPerHost), 0)
+	}
+	return maxTotal, maxPerHost
+}
+
+func (w *connSlotWaiter) fits(l *connLimiter) bool {
+	if w.MaxTotal > 0 && l.Active >= w.MaxTotal {
+		return false
+	}
+	return w.MaxPerHost <= 0 || l.ActiveByHost[w.Host] < w.MaxPerHost
+}
+
+// grants slots to the waiters that fit, in order
+func (l *connLimiter) dispatch_nolock() {
+	remaining := l.Queue[:0]
+	for _, waiter := range l.Queue {
+		if !waiter.fits(l) {
+			remaining = append(remaining, waiter)
+			continue
+		}
+		l.Active++
+		l.ActiveByHost[waiter.Host]++
+		waiter.Granted = true
+		close(waiter.ReadyCh)
+	}
+	l.Queue = remaining
+}
+
+func (l *connLimiter) release(host string) {
+	l.Lock.Lock()
+	defer l.Lock.Unlock()
+	l.Active--
+	l.ActiveByHost[host]--
+	if l.ActiveByHost[host] <= 0 {
+		delete(l.ActiveByHost, host)
+	}
+	l.dispatch_nolock()
+}
+
+// waits for a slot for host, onQueued is called (with the number of connections being made and
+// the number waiting ahead of it) if it has to wait.  the returned func releases the slot.
+func (l *connLimiter) acquire(ctx context.Context, host string, maxTotal int, maxPerHost int, onQueued func(active int, ahead int)) (func(), error) {
+	waiter := &connSlotWaiter{Host: host, MaxTotal: maxTotal, MaxPerHost: maxPerHost, ReadyCh: make(chan struct{})}
+	l.Lock.Lock()
+	l.Queue = append(l.Queue, waiter)
+	l.dispatch_nolock()
+	active, ahead := l.Active, len(l.Queue)-1
+	l.Lock.Unlock()
+	releaseFn := func() { l.release(host) }
+	select {
+	case <-waiter.ReadyCh:
+		return releaseFn, nil
+	default:
+	}
+	if onQueued != nil {
+		onQueued(active, ahead)
+	}
+	select {
+	case <-waiter.ReadyCh:
+		return releaseFn, nil
+	case <-ctx.Done():
+	}
+	l.Lock.Lock()
+	granted := waiter.Granted
+	if !granted {
+		for idx, queued := range l.Queue {
+			if queued == waiter {
+				l.Queue = append(l.Queue[:idx], l.Queue[idx+1:]...)
+				break
+			}
+		}
+	}
+	l.Lock.Unlock()
+	if granted {
+		// the slot was granted as ctx was canceled
+		l.release(host)
+	}
+	return nil, fmt.Errorf("canceled while waiting to connect: %w", ctx.Err())
+}
+
+// waits for a connection slot for the hop in debugInfo (networkAddr is its host:port)
+func acquireConnSlot(connCtx context.Context, networkAddr string, debugInfo *ConnectionDebugInfo) (func(), error) {
+	maxTotal, maxPerHost := getConnLimits()
+	return globalConnLimiter.acquire(connCtx, networkAddr, maxTotal, maxPerHost, func(active int, ahead int) {
+		event := makeHopEvent(wshrpc.ConnEvent_Queued, debugInfo)
+		event.Detail = fmt.Sprintf("%d connecting, %d queued ahead", active, ahead)
+		publishConnEventCtx(connCtx, event)
+	})
+}
@@ -0,0 +1,49 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestConnLimiter(t *testing.T) {
+	limiter := makeConnLimiter()
+	ctx := context.Background()
+	releaseA1, err := limiter.acquire(ctx, "a:22", 2, 1, nil)
+	if err != nil {
+		t.Fatalf("first slot: %v", err)
+	}
+	// a second connection to the same host waits for the first, even with room in total
+	queuedCh := make(chan int, 1)
+	acquiredCh := make(chan func(), 1)
+	go func() {
+		release, _ := limiter.acquire(ctx, "a:22", 2, 1, func(active int, ahead int) { queuedCh <- active })
+		acquiredCh <- release
+	}()
+	if active := <-queuedCh; active != 1 {
+		t.Errorf("expected 1 active connection, got %d", active)
+	}
+	// other hosts go past the waiting one
+	releaseB, err := limiter.acquire(ctx, "b:22", 2, 1, func(int, int) { t.Errorf("b should not be queued") })
+	if err != nil {
+		t.Fatalf("slot for b: %v", err)
+	}
+	// the total limit is reached, so c is canceled while it waits
+	cancelCtx, cancelFn := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancelFn()
+	if _, err := limiter.acquire(cancelCtx, "c:22", 2, 1, nil); err == nil {
+		t.Errorf("expected c to time out waiting")
+	}
+	releaseA1()
+	releaseA2 := <-acquiredCh
+	releaseA2()
+	releaseB()
+	limiter.Lock.Lock()
+	defer limiter.Lock.Unlock()
+	if limiter.Active != 0 || len(limiter.ActiveByHost) != 0 || len(limiter.Queue) != 0 {
+		t.Errorf("limiter not empty: active=%d byhost=%v queue=%d", limiter.Active, limiter.ActiveByHost, len(limiter.Queue))
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"golang.org/x/crypto/ssh"
+)
+
+// traffic and health stats for each ssh.Client.  bytes are counted on the network connection
+// (so they include ssh's own framing and encryption), channels are the ones opened from this
+// side (sessions, local forwards, ...), and round trip times come from keepalive requests.
+
+var clientStatsLock = &sync.Mutex{}
+var clientStatsMap = make(map[*ssh.Client]*ClientStats)
+
+type ClientStats struct {
+	startTime      time.Time
+	bytesSent      *atomic.Int64
+	bytesRecv      *atomic.Int64
+	activeChannels *atomic.Int64
+	totalChannels  *atomic.Int64
+	kex            *kexSniffer
+
+	lock              *sync.Mutex
+	lastRtt           time.Duration
+	avgRtt            time.Duration
+	lastKeepAlive     time.Time
+	keepAliveFailures int
+	// the rates are measured between keepalives
+	sampleTime time.Time
+	sampleSent int64
+	sampleRecv int64
+	sendRate   float64
+	recvRate   float64
+}
+
+func makeClientStats() *ClientStats {
+	now := time.Now()
+	return &ClientStats{
+		startTime:      now,
+		bytesSent:      &atomic.Int64{},
+		bytesRecv:      &atomic.Int64{},
+		activeChannels: &atomic.Int64{},
+		totalChannels:  &atomic.Int64{},
+		kex:            makeKexSniffer(),
+		lock:           &sync.Mutex{},
+		sampleTime:     now,
+	}
+}
+
+// counts the bytes read and written on the connection, and watches the key exchange
+type statsConn struct {
+	net.Conn
+	stats *ClientStats
+}
+
+func (sc *statsConn) Read(p []byte) (int, error) {
+	n, err := sc.Conn.Read(p)
+	sc.stats.bytesRecv.Add(int64(n))
+	sc.stats.kex.addRecv(p[:n])
+	return n, err
+}
+
+func (sc *statsConn) Write(p []byte) (int, error) {
+	n, err := sc.Conn.Write(p)
+	sc.stats.bytesSent.Add(int64(n))
+	sc.stats.kex.addSent(p[:n])
+	return n, err
+}
+
+// counts the channels opened through the connection
+type statsSshConn struct {
+	ssh.Conn
+	stats *ClientStats
+}
+
+func (sc *statsSshConn) OpenChannel(name string, data []byte) (ssh.Channel, <-chan *ssh.Request, error) {
+	ch, reqs, err := sc.Conn.OpenChannel(name, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	sc.stats.activeChannels.Add(1)
+	sc.stats.totalChannels.Add(1)
+	return &statsChannel{Channel: ch, stats: sc.stats, closeOnce: &sync.Once{}}, reqs, nil
+}
+
+type statsChannel struct {
+	ssh.Channel
+	stats     *ClientStats
+	closeOnce *sync.Once
+}
+
+func (sc *statsChannel) Close() error {
+	sc.closeOnce.Do(func() {
+		sc.stats.activeChannels.Add(-1)
+	})
+	return sc.Channel.Close()
+}
+
+// RecordKeepAlive records the result of a keepalive request, and updates the transfer rates
+func (cs *ClientStats) RecordKeepAlive(rtt time.Duration, err error) {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	now := time.Now()
+	cs.lastKeepAlive = now
+	if err != nil {
+		cs.keepAliveFailures++
+	} else {
+		cs.lastRtt = rtt
+		if cs.avgRtt == 0 {
+			cs.avgRtt = rtt
+		} else {
+			// exponentially weighted, like tcp's smoothed rtt
+			cs.avgRtt = (7*cs.avgRtt + rtt) / 8
+		}
+	}
+	sent, recv := cs.bytesSent.Load(), cs.bytesRecv.Load()
+	if elapsed := now.Sub(cs.sampleTime).Seconds(); elapsed > 0 {
+		cs.sendRate = float64(sent-cs.sampleSent) / elapsed
+		cs.recvRate = float64(recv-cs.sampleRecv) / elapsed
+	}
+	cs.sampleTime, cs.sampleSent, cs.sampleRecv = now, sent, recv
+}
+
+func (cs *ClientStats) GetInfo(connName string) wshrpc.ConnStatsInfo {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	rtn := wshrpc.ConnStatsInfo{
+		Connection:        connName,
+		ConnectedTs:       cs.startTime.UnixMilli(),
+		BytesSent:         cs.bytesSent.Load(),
+		BytesRecv:         cs.bytesRecv.Load(),
+		SendRate:          cs.sendRate,
+		RecvRate:          cs.recvRate,
+		RttMs:             float64(cs.lastRtt.Microseconds()) / 1000,
+		AvgRttMs:          float64(cs.avgRtt.Microseconds()) / 1000,
+		KeepAliveFailures: cs.keepAliveFailures,
+		ActiveChannels:    cs.activeChannels.Load(),
+		TotalChannels:     cs.totalChannels.Load(),
+	}
+	if !cs.lastKeepAlive.IsZero() {
+		rtn.LastKeepAliveTs = cs.lastKeepAlive.UnixMilli()
+	}
+	if algos := cs.kex.getNegotiated(); algos != nil {
+		rtn.KexAlgorithm = algos.Kex
+		rtn.HostKeyAlgorithm = algos.HostKey
+		rtn.CipherSend, rtn.CipherRecv = algos.CipherSend, algos.CipherRecv
+		rtn.MACSend, rtn.MACRecv = algos.MACSend, algos.MACRecv
+		rtn.PostQuantumKex = isPostQuantumKex(algos.Kex)
+		rtn.ServerPostQuantumKex = algos.ServerPqKex
+	}
+	return rtn
+}
+
+// GetClientStats returns the stats for a client (nil if it wasn't made by ConnectToClient)
+func GetClientStats(client *ssh.Client) *ClientStats {
+	clientStatsLock.Lock()
+	defer clientStatsLock.Unlock()
+	return clientStatsMap[client]
+}
+
+func registerClientStats(client *ssh.Client, stats *ClientStats) {
+	clientStatsLock.Lock()
+	clientStatsMap[client] = stats
+	clientStatsLock.Unlock()
+	go func() {
+		client.Wait()
+		clientStatsLock.Lock()
+		delete(clientStatsMap, client)
+		clientStatsLock.Unlock()
+	}()
+}
@@ -0,0 +1,42 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestClientStats(t *testing.T) {
+	stats := makeClientStats()
+	conn1, conn2 := net.Pipe()
+	defer conn2.Close()
+	sc := &statsConn{Conn: conn1, stats: stats}
+	go func() {
+		io.CopyN(io.Discard, conn2, 10)
+		conn2.Write([]byte("hello"))
+	}()
+	sc.Write(make([]byte, 10))
+	buf := make([]byte, 5)
+	io.ReadFull(sc, buf)
+	sc.Close()
+
+	stats.sampleTime = time.Now().Add(-time.Second)
+	stats.RecordKeepAlive(40*time.Millisecond, nil)
+	stats.RecordKeepAlive(80*time.Millisecond, nil)
+	stats.RecordKeepAlive(0, fmt.Errorf("timeout"))
+	info := stats.GetInfo("user@host")
+	if info.BytesSent != 10 || info.BytesRecv != 5 {
+		t.Errorf("got %d sent, %d received", info.BytesSent, info.BytesRecv)
+	}
+	if info.RttMs != 80 || info.AvgRttMs != 45 {
+		t.Errorf("got rtt %vms, avg %vms", info.RttMs, info.AvgRttMs)
+	}
+	if info.KeepAliveFailures != 1 || info.LastKeepAliveTs == 0 {
+		t.Errorf("got %d keepalive failures, last at %d", info.KeepAliveFailures, info.LastKeepAliveTs)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"html/template"
 	"io"
 	"log"
+	"net"
 	"os"
 	"os/user"
 	"path/filepath"
@@ -20,20 +21,57 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
-var userHostRe = regexp.MustCompile(`^([a-zA-Z0-9][a-zA-Z0-9._@\\-]*@)?([a-zA-Z0-9][a-zA-Z0-9.-]*)(?::([0-9]+))?$`)
+var sshUserRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._@\\-]*$`)
+var sshHostRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9.-]*$`)
 
+// parses [user@]host[:port].  an ipv6 host is written in brackets ([user@][2001:db8::1]:2222),
+// which can be left off when there is no port.  the ssh://[user@]host[:port] uris that ProxyJump
+// takes are also accepted.
 func ParseOpts(input string) (*SSHOpts, error) {
-	m := userHostRe.FindStringSubmatch(input)
-	if m == nil {
-		return nil, fmt.Errorf("invalid format of user@host argument")
+	hostPort := input
+	if rest, ok := strings.CutPrefix(input, "ssh://"); ok {
+		// a zone in a uri is escaped as %25
+		hostPort = strings.ReplaceAll(strings.TrimSuffix(rest, "/"), "%25", "%")
+	}
+	var remoteUser string
+	if idx := strings.LastIndex(hostPort, "@"); idx >= 0 {
+		remoteUser, hostPort = hostPort[:idx], hostPort[idx+1:]
+		if !sshUserRe.MatchString(remoteUser) {
+			return nil, fmt.Errorf("invalid format of user@host argument")
+		}
+	}
+	var remoteHost, remotePortStr string
+	if strings.HasPrefix(hostPort, "[") {
+		endIdx := strings.Index(hostPort, "]")
+		if endIdx < 0 {
+			return nil, fmt.Errorf("invalid format of user@host argument (missing ])")
+		}
+		remoteHost = hostPort[1:endIdx]
+		if rest := hostPort[endIdx+1:]; rest != "" {
+			var ok bool
+			if remotePortStr, ok = strings.CutPrefix(rest, ":"); !ok {
+				return nil, fmt.Errorf("invalid format of user@host argument")
+			}
+		}
+		if !isIPv6Host(remoteHost) {
+			return nil, fmt.Errorf("invalid ipv6 address %q in user@host argument", remoteHost)
+		}
+	} else if strings.Count(hostPort, ":") > 1 {
+		remoteHost = hostPort
+		if !isIPv6Host(remoteHost) {
+			return nil, fmt.Errorf("invalid ipv6 address %q in user@host argument (use [address]:port for a port)", remoteHost)
+		}
+	} else {
+		remoteHost, remotePortStr, _ = strings.Cut(hostPort, ":")
+		if !sshHostRe.MatchString(remoteHost) {
+			return nil, fmt.Errorf("invalid format of user@host argument")
+		}
 	}
-	remoteUser, remoteHost, remotePortStr := m[1], m[2], m[3]
-	remoteUser = strings.Trim(remoteUser, "@")
 	var remotePort int
 	if remotePortStr != "" {
 		var err error
 		remotePort, err = strconv.Atoi(remotePortStr)
-		if err != nil {
+		if err != nil || remotePort < 0 || remotePort > 65535 {
 			return nil, fmt.Errorf("invalid port specified on user@host argument")
 		}
 	}
@@ -41,6 +79,12 @@ func ParseOpts(input string) (*SSHOpts, error) {
 	return &SSHOpts{SSHHost: remoteHost, SSHUser: remoteUser, SSHPort: remotePort}, nil
 }
 
+// an ipv6 address, optionally with a zone (fe80::1%eth0)
+func isIPv6Host(host string) bool {
+	addr, _, _ := strings.Cut(host, "%")
+	return strings.Contains(addr, ":") && net.ParseIP(addr) != nil
+}
+
 func DetectShell(client *ssh.Client) (string, error) {
 	wshPath := GetWshPath(client)
 
@@ -227,6 +271,34 @@ func GetClientArch(client *ssh.Client) (string, error) {
 	return "", fmt.Errorf("unable to determine architecture: {unix: %s, cmd: %s, powershell: %s}", unixErr, cmdErr, psErr)
 }
 
+// the os and arch of the remote, with a single "uname -sm" where it works (falling back to
+// GetClientOs and GetClientArch)
+func GetClientPlatform(client *ssh.Client) (string, string, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return "", "", err
+	}
+	out, err := session.Output("uname -sm")
+	if err == nil {
+		fields := strings.Fields(strings.ToLower(string(out)))
+		if len(fields) == 2 {
+			if fields[1] == "x86_64" {
+				fields[1] = "x64"
+			}
+			return fields[0], fields[1], nil
+		}
+	}
+	clientOs, err := GetClientOs(client)
+	if err != nil {
+		return "", "", err
+	}
+	clientArch, err := GetClientArch(client)
+	if err != nil {
+		return "", "", err
+	}
+	return clientOs, clientArch, nil
+}
+
 var installTemplateRawBash = `bash -c ' \
 mkdir -p {{.installDir}}; \
 cat > {{.tempPath}}; \
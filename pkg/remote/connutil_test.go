@@ -0,0 +1,45 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"testing"
+)
+
+func TestParseOpts(t *testing.T) {
+	tests := []struct {
+		input  string
+		opts   SSHOpts
+		output string
+	}{
+		{"host", SSHOpts{SSHHost: "host"}, "host"},
+		{"user@host.example.com:2222", SSHOpts{SSHUser: "user", SSHHost: "host.example.com", SSHPort: 2222}, "user@host.example.com:2222"},
+		{`DOMAIN\user@host`, SSHOpts{SSHUser: `DOMAIN\user`, SSHHost: "host"}, `DOMAIN\user@host`},
+		{"me@corp.com@host", SSHOpts{SSHUser: "me@corp.com", SSHHost: "host"}, "me@corp.com@host"},
+		{"user@[2001:db8::1]:2222", SSHOpts{SSHUser: "user", SSHHost: "2001:db8::1", SSHPort: 2222}, "user@[2001:db8::1]:2222"},
+		{"[::1]", SSHOpts{SSHHost: "::1"}, "[::1]"},
+		{"user@2001:db8::1", SSHOpts{SSHUser: "user", SSHHost: "2001:db8::1"}, "user@[2001:db8::1]"},
+		{"[fe80::1%eth0]:22", SSHOpts{SSHHost: "fe80::1%eth0", SSHPort: 22}, "[fe80::1%eth0]:22"},
+		{"ssh://user@[2001:db8::1]:2222", SSHOpts{SSHUser: "user", SSHHost: "2001:db8::1", SSHPort: 2222}, "user@[2001:db8::1]:2222"},
+		{"ssh://jump.example.com/", SSHOpts{SSHHost: "jump.example.com"}, "jump.example.com"},
+	}
+	for _, test := range tests {
+		opts, err := ParseOpts(test.input)
+		if err != nil {
+			t.Errorf("%q: %v", test.input, err)
+			continue
+		}
+		if *opts != test.opts {
+			t.Errorf("%q: got %+v, expected %+v", test.input, *opts, test.opts)
+		}
+		if got := opts.String(); got != test.output {
+			t.Errorf("%q: String() is %q, expected %q", test.input, got, test.output)
+		}
+	}
+	for _, bad := range []string{"", "user@", "[2001:db8::1", "[host]:22", "[::1]22", "2001:db8::zz", "host:port", "host:70000", "-host", "user name@host"} {
+		if opts, err := ParseOpts(bad); err == nil {
+			t.Errorf("expected an error for %q, got %+v", bad, *opts)
+		}
+	}
+}
@@ -0,0 +1,604 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"golang.org/x/crypto/ssh"
+)
+
+// rsync-style directory sync over an ssh.Client.  like the file copies, this only needs a posix
+// shell on the remote: the remote tree is listed with find (or find and stat, without gnu find),
+// and changed files are copied with CopyFile, so each one is verified.  whole files are copied
+// (there is no rolling checksum), and symlinks and special files are skipped.
+
+const SyncDebounceTime = 500 * time.Millisecond
+const SyncPollInterval = 10 * time.Second
+const syncBatchSize = 100
+
+// exits with 3 if the directory doesn't exist.  the fields are: type, size, modtime, mode, path
+const remoteSyncListCmd = `[ -e %[1]s ] || exit 3
+cd %[1]s || exit 1
+if find . -maxdepth 0 -printf '' >/dev/null 2>&1; then
+find . -mindepth 1 \( -type f -o -type d \) -printf '%%y %%s %%T@ %%m %%P\n'
+else
+find . -mindepth 1 \( -type f -o -type d \) -exec stat -f '%%Sp %%z %%m %%Lp %%N' {} +
+fi`
+
+// the paths are read from stdin (NUL separated)
+const remoteSyncSumCmd = `cd %s || exit 1
+if command -v sha256sum >/dev/null 2>&1; then xargs -0 sha256sum --
+elif command -v shasum >/dev/null 2>&1; then xargs -0 shasum -a 256 --
+else exit 4; fi`
+
+type syncEntry struct {
+	IsDir   bool
+	Size    int64
+	ModTime int64 // unix seconds
+	Mode    os.FileMode
+}
+
+// relative paths (separated by "/") to entries
+type syncTree map[string]*syncEntry
+
+type syncPlan struct {
+	Deletes []string // the top-most paths to remove from the destination
+	Mkdirs  []string
+	Copies  []string
+	Bytes   int64
+}
+
+func (plan *syncPlan) isEmpty() bool {
+	return len(plan.Deletes) == 0 && len(plan.Mkdirs) == 0 && len(plan.Copies) == 0
+}
+
+func (plan *syncPlan) getChanges(src syncTree) []wshrpc.ConnSyncChange {
+	var rtn []wshrpc.ConnSyncChange
+	for _, relPath := range plan.Deletes {
+		rtn = append(rtn, wshrpc.ConnSyncChange{Action: wshrpc.SyncAction_Delete, Path: relPath})
+	}
+	for _, relPath := range plan.Mkdirs {
+		rtn = append(rtn, wshrpc.ConnSyncChange{Action: wshrpc.SyncAction_Mkdir, Path: relPath})
+	}
+	for _, relPath := range plan.Copies {
+		rtn = append(rtn, wshrpc.ConnSyncChange{Action: wshrpc.SyncAction_Copy, Path: relPath, Size: src[relPath].Size})
+	}
+	return rtn
+}
+
+func sortedSyncPaths(tree syncTree) []string {
+	rtn := make([]string, 0, len(tree))
+	for relPath := range tree {
+		rtn = append(rtn, relPath)
+	}
+	sort.Strings(rtn)
+	return rtn
+}
+
+// patterns match a name anywhere in the tree ("node_modules", "*.o") or a relative path
+// ("build/*").  partial copies (".wavepart" files) are always excluded.
+func isSyncExcluded(relPath string, excludes []string) bool {
+	if strings.HasSuffix(relPath, FileCopyPartSuffix) {
+		return true
+	}
+	parts := strings.Split(relPath, "/")
+	for idx, part := range parts {
+		prefix := strings.Join(parts[:idx+1], "/")
+		for _, pattern := range excludes {
+			if matched, _ := path.Match(pattern, part); matched {
+				return true
+			}
+			if matched, _ := path.Match(pattern, prefix); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// returns false if the directory doesn't exist
+func listLocalSyncTree(root string, excludes []string) (syncTree, bool, error) {
+	finfo, err := os.Stat(root)
+	if errors.Is(err, fs.ErrNotExist) {
+		return syncTree{}, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if !finfo.IsDir() {
+		return nil, false, fmt.Errorf("%s is not a directory", root)
+	}
+	tree := make(syncTree)
+	err = filepath.WalkDir(root, func(filePath string, dirEntry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if filePath == root {
+			return nil
+		}
+		relPath, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		if isSyncExcluded(relPath, excludes) {
+			if dirEntry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !dirEntry.IsDir() && !dirEntry.Type().IsRegular() {
+			return nil
+		}
+		info, err := dirEntry.Info()
+		if err != nil {
+			// removed while walking
+			return nil
+		}
+		entry := &syncEntry{IsDir: info.IsDir(), ModTime: info.ModTime().Unix(), Mode: info.Mode().Perm()}
+		if !entry.IsDir {
+			entry.Size = info.Size()
+		}
+		tree[relPath] = entry
+		return nil
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("cannot list %s: %w", root, err)
+	}
+	return tree, true, nil
+}
+
+func parseRemoteSyncTree(output string, excludes []string) syncTree {
+	tree := make(syncTree)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.SplitN(line, " ", 5)
+		if len(fields) != 5 {
+			continue
+		}
+		// gnu find prints "f" or "d", stat prints the mode string ("-rw-r--r--")
+		isDir := strings.HasPrefix(fields[0], "d")
+		if !isDir && fields[0] != "f" && !strings.HasPrefix(fields[0], "-") {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		mtimeStr, _, _ := strings.Cut(fields[2], ".")
+		mtime, err := strconv.ParseInt(mtimeStr, 10, 64)
+		if err != nil {
+			continue
+		}
+		mode, err := strconv.ParseUint(fields[3], 8, 32)
+		if err != nil {
+			continue
+		}
+		relPath := strings.TrimPrefix(fields[4], "./")
+		if relPath == "" || isSyncExcluded(relPath, excludes) {
+			continue
+		}
+		entry := &syncEntry{IsDir: isDir, ModTime: mtime, Mode: os.FileMode(mode).Perm()}
+		if !isDir {
+			entry.Size = size
+		}
+		tree[relPath] = entry
+	}
+	return tree
+}
+
+// returns false if the directory doesn't exist
+func listRemoteSyncTree(client *ssh.Client, root string, excludes []string) (syncTree, bool, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, false, err
+	}
+	defer session.Close()
+	out, err := session.Output(fmt.Sprintf(remoteSyncListCmd, QuoteRemotePath(root)))
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitStatus() == 3 {
+		return syncTree{}, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("cannot list %s on the remote: %w", root, err)
+	}
+	return parseRemoteSyncTree(string(out), excludes), true, nil
+}
+
+func remoteSyncSums(client *ssh.Client, root string, relPaths []string) (map[string]string, error) {
+	rtn := make(map[string]string)
+	if len(relPaths) == 0 {
+		return rtn, nil
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	session.Stdin = strings.NewReader(strings.Join(relPaths, "\x00"))
+	out, err := session.Output(fmt.Sprintf(remoteSyncSumCmd, QuoteRemotePath(root)))
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitStatus() == 4 {
+		return nil, fmt.Errorf("comparing checksums needs sha256sum or shasum on the remote")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot checksum files on the remote: %w", err)
+	}
+	// "<sha256>  <path>"
+	for _, line := range strings.Split(string(out), "\n") {
+		if len(line) < 67 {
+			continue
+		}
+		rtn[line[66:]] = line[:64]
+	}
+	return rtn, nil
+}
+
+// files with the same size (the others are copied anyway)
+func getSyncSumCandidates(src syncTree, dest syncTree) []string {
+	var rtn []string
+	for _, relPath := range sortedSyncPaths(src) {
+		srcEntry, destEntry := src[relPath], dest[relPath]
+		if srcEntry.IsDir || destEntry == nil || destEntry.IsDir || srcEntry.Size != destEntry.Size {
+			continue
+		}
+		rtn = append(rtn, relPath)
+	}
+	return rtn
+}
+
+func isSyncParentDeleted(relPath string, deleted map[string]bool) bool {
+	for dir := path.Dir(relPath); dir != "."; dir = path.Dir(dir) {
+		if deleted[dir] {
+			return true
+		}
+	}
+	return false
+}
+
+// compares the trees.  files are the same if their sizes and modtimes (or checksums, when the
+// sums are given) match.  destination entries that are in the way of a source entry of the
+// other type are always deleted.
+func makeSyncPlan(src syncTree, dest syncTree, deleteExtra bool, srcSums map[string]string, destSums map[string]string) *syncPlan {
+	plan := &syncPlan{}
+	deleted := make(map[string]bool)
+	for _, relPath := range sortedSyncPaths(dest) {
+		if isSyncParentDeleted(relPath, deleted) {
+			continue
+		}
+		srcEntry := src[relPath]
+		if (srcEntry == nil && deleteExtra) || (srcEntry != nil && srcEntry.IsDir != dest[relPath].IsDir) {
+			plan.Deletes = append(plan.Deletes, relPath)
+			deleted[relPath] = true
+		}
+	}
+	for _, relPath := range sortedSyncPaths(src) {
+		srcEntry, destEntry := src[relPath], dest[relPath]
+		if deleted[relPath] {
+			destEntry = nil
+		}
+		if srcEntry.IsDir {
+			if destEntry == nil {
+				plan.Mkdirs = append(plan.Mkdirs, relPath)
+			}
+			continue
+		}
+		if destEntry != nil && srcEntry.Size == destEntry.Size {
+			if srcSums != nil {
+				if srcSums[relPath] != "" && srcSums[relPath] == destSums[relPath] {
+					continue
+				}
+			} else if srcEntry.ModTime == destEntry.ModTime {
+				continue
+			}
+		}
+		plan.Copies = append(plan.Copies, relPath)
+		plan.Bytes += srcEntry.Size
+	}
+	return plan
+}
+
+// runs cmdFn(quotedPaths) on the remote (in root) for batches of paths
+func runRemoteSyncBatches(client *ssh.Client, root string, relPaths []string, cmdFn func([]string) string) error {
+	for start := 0; start < len(relPaths); start += syncBatchSize {
+		var quotedPaths []string
+		for _, relPath := range relPaths[start:min(start+syncBatchSize, len(relPaths))] {
+			// "./" so a leading "~" isn't expanded
+			quotedPaths = append(quotedPaths, QuoteRemotePath("./"+relPath))
+		}
+		_, err := runRemoteOutput(client, fmt.Sprintf("cd %s || exit 1\n%s", QuoteRemotePath(root), cmdFn(quotedPaths)))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setRemoteSyncAttrs(client *ssh.Client, root string, relPaths []string, src syncTree) error {
+	return runRemoteSyncBatches(client, root, relPaths, func(quotedPaths []string) string {
+		var cmds []string
+		for idx, quotedPath := range quotedPaths {
+			entry := src[relPaths[idx]]
+			if entry == nil {
+				continue
+			}
+			stamp := time.Unix(entry.ModTime, 0).UTC().Format("200601021504.05")
+			cmds = append(cmds, fmt.Sprintf("chmod %o %s; TZ=UTC touch -t %s %s", entry.Mode, quotedPath, stamp, quotedPath))
+		}
+		return strings.Join(cmds, "\n")
+	})
+}
+
+type syncRoundState struct {
+	ctx        context.Context
+	client     *ssh.Client
+	data       wshrpc.CommandConnSyncData
+	progress   wshrpc.ConnSyncProgress
+	progressFn func(wshrpc.ConnSyncProgress)
+}
+
+// copies one file of the plan, reporting the bytes copied so far
+func (st *syncRoundState) copyFile(relPath string, size int64) error {
+	copyData := wshrpc.CommandConnCopyFileData{
+		Connection: st.data.Connection,
+		Direction:  wshrpc.CopyDirection_Upload,
+		LocalPath:  filepath.Join(st.data.LocalPath, filepath.FromSlash(relPath)),
+		RemotePath: path.Join(st.data.RemotePath, relPath),
+		Overwrite:  true,
+	}
+	if st.data.Direction == wshrpc.SyncDirection_Pull {
+		copyData.Direction = wshrpc.CopyDirection_Download
+	}
+	st.progress.Path = relPath
+	bytesBase := st.progress.BytesDone
+	err := CopyFile(st.ctx, st.client, copyData, func(copyProgress wshrpc.ConnCopyFileProgress) {
+		progress := st.progress
+		progress.BytesDone = bytesBase + copyProgress.Bytes
+		st.progressFn(progress)
+	})
+	if err != nil {
+		return fmt.Errorf("cannot copy %s: %w", relPath, err)
+	}
+	st.progress.FilesDone++
+	st.progress.BytesDone = bytesBase + size
+	return nil
+}
+
+func (st *syncRoundState) applyPush(plan *syncPlan, src syncTree, destExists bool) error {
+	root := st.data.RemotePath
+	if !destExists {
+		if _, err := runRemoteOutput(st.client, "mkdir -p "+QuoteRemotePath(root)); err != nil {
+			return fmt.Errorf("cannot create %s on the remote: %w", root, err)
+		}
+	}
+	err := runRemoteSyncBatches(st.client, root, plan.Deletes, func(quotedPaths []string) string {
+		return "rm -rf " + strings.Join(quotedPaths, " ")
+	})
+	if err != nil {
+		return fmt.Errorf("cannot delete files on the remote: %w", err)
+	}
+	err = runRemoteSyncBatches(st.client, root, plan.Mkdirs, func(quotedPaths []string) string {
+		return "mkdir -p " + strings.Join(quotedPaths, " ")
+	})
+	if err != nil {
+		return fmt.Errorf("cannot create directories on the remote: %w", err)
+	}
+	for _, relPath := range plan.Copies {
+		if err := st.copyFile(relPath, src[relPath].Size); err != nil {
+			return err
+		}
+	}
+	// the modtimes are kept, so the next sync sees the files as unchanged
+	if err := setRemoteSyncAttrs(st.client, root, plan.Copies, src); err != nil {
+		return fmt.Errorf("cannot set file times on the remote: %w", err)
+	}
+	return nil
+}
+
+func (st *syncRoundState) applyPull(plan *syncPlan, src syncTree) error {
+	root := st.data.LocalPath
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return err
+	}
+	for _, relPath := range plan.Deletes {
+		if err := os.RemoveAll(filepath.Join(root, filepath.FromSlash(relPath))); err != nil {
+			return err
+		}
+	}
+	for _, relPath := range plan.Mkdirs {
+		if err := os.MkdirAll(filepath.Join(root, filepath.FromSlash(relPath)), 0755); err != nil {
+			return err
+		}
+	}
+	for _, relPath := range plan.Copies {
+		entry := src[relPath]
+		if err := st.copyFile(relPath, entry.Size); err != nil {
+			return err
+		}
+		localPath := filepath.Join(root, filepath.FromSlash(relPath))
+		mtime := time.Unix(entry.ModTime, 0)
+		os.Chmod(localPath, entry.Mode)
+		if err := os.Chtimes(localPath, mtime, mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lists both trees, and copies the changes.  returns false if there was nothing to do (after the
+// first round, which is always reported, these rounds aren't reported).
+func syncRound(ctx context.Context, client *ssh.Client, data wshrpc.CommandConnSyncData, round int, progressFn func(wshrpc.ConnSyncProgress)) (bool, error) {
+	localTree, localExists, err := listLocalSyncTree(data.LocalPath, data.Exclude)
+	if err != nil {
+		return false, err
+	}
+	remoteTree, remoteExists, err := listRemoteSyncTree(client, data.RemotePath, data.Exclude)
+	if err != nil {
+		return false, err
+	}
+	src, dest, destExists := localTree, remoteTree, remoteExists
+	if data.Direction == wshrpc.SyncDirection_Pull {
+		src, dest, destExists = remoteTree, localTree, localExists
+		if !remoteExists {
+			return false, fmt.Errorf("%s does not exist on the remote", data.RemotePath)
+		}
+	} else if !localExists {
+		return false, fmt.Errorf("%s does not exist", data.LocalPath)
+	}
+	var srcSums, destSums map[string]string
+	if data.Checksum {
+		candidates := getSyncSumCandidates(src, dest)
+		localSums := make(map[string]string)
+		for _, relPath := range candidates {
+			// errors leave the sum empty, so the file is copied
+			localSums[relPath], _ = localSha256(filepath.Join(data.LocalPath, filepath.FromSlash(relPath)))
+		}
+		remoteSums, err := remoteSyncSums(client, data.RemotePath, candidates)
+		if err != nil {
+			return false, err
+		}
+		srcSums, destSums = localSums, remoteSums
+		if data.Direction == wshrpc.SyncDirection_Pull {
+			srcSums, destSums = remoteSums, localSums
+		}
+	}
+	plan := makeSyncPlan(src, dest, data.Delete, srcSums, destSums)
+	if round > 1 && plan.isEmpty() {
+		return false, nil
+	}
+	st := &syncRoundState{
+		ctx:    ctx,
+		client: client,
+		data:   data,
+		progress: wshrpc.ConnSyncProgress{
+			Connection: data.Connection,
+			Direction:  data.Direction,
+			Round:      round,
+			FilesTotal: len(plan.Copies),
+			BytesTotal: plan.Bytes,
+		},
+		progressFn: progressFn,
+	}
+	planned := st.progress
+	planned.Changes = plan.getChanges(src)
+	progressFn(planned)
+	if !data.DryRun {
+		if data.Direction == wshrpc.SyncDirection_Pull {
+			err = st.applyPull(plan, src)
+		} else {
+			err = st.applyPush(plan, src, destExists)
+		}
+		if err != nil {
+			return true, err
+		}
+	}
+	st.progress.Path = ""
+	st.progress.Done = true
+	progressFn(st.progress)
+	return true, nil
+}
+
+func addSyncWatchDirs(watcher *fsnotify.Watcher, root string, excludes []string) {
+	filepath.WalkDir(root, func(filePath string, dirEntry fs.DirEntry, err error) error {
+		if err != nil || !dirEntry.IsDir() {
+			return nil
+		}
+		if filePath != root {
+			relPath, err := filepath.Rel(root, filePath)
+			if err != nil || isSyncExcluded(filepath.ToSlash(relPath), excludes) {
+				return filepath.SkipDir
+			}
+		}
+		watcher.Add(filePath)
+		return nil
+	})
+}
+
+// SyncDir syncs data.LocalPath and data.RemotePath (in data.Direction), calling progressFn as it
+// goes.  with data.Watch it keeps syncing until ctx is done: pushes are started by changes to
+// the local directory, and pulls poll the remote every SyncPollInterval.  errors in these later
+// rounds are reported (and retried on the next change) instead of stopping the sync.
+func SyncDir(ctx context.Context, client *ssh.Client, data wshrpc.CommandConnSyncData, progressFn func(wshrpc.ConnSyncProgress)) error {
+	if data.LocalPath == "" || data.RemotePath == "" {
+		return fmt.Errorf("local and remote paths are required")
+	}
+	if data.Direction != wshrpc.SyncDirection_Push && data.Direction != wshrpc.SyncDirection_Pull {
+		return fmt.Errorf("invalid sync direction %q", data.Direction)
+	}
+	if data.Watch && data.DryRun {
+		return fmt.Errorf("a dry run can't watch for changes")
+	}
+	round := 1
+	if _, err := syncRound(ctx, client, data, round, progressFn); err != nil {
+		return err
+	}
+	if !data.Watch {
+		return nil
+	}
+	closedCh := make(chan struct{})
+	go func() {
+		client.Wait()
+		close(closedCh)
+	}()
+	var notifyCh <-chan fsnotify.Event
+	var notifyErrCh <-chan error
+	var watcher *fsnotify.Watcher
+	if data.Direction == wshrpc.SyncDirection_Push {
+		var err error
+		watcher, err = fsnotify.NewWatcher()
+		if err == nil {
+			defer watcher.Close()
+			addSyncWatchDirs(watcher, data.LocalPath, data.Exclude)
+			notifyCh, notifyErrCh = watcher.Events, watcher.Errors
+		}
+	}
+	var pollCh <-chan time.Time
+	if notifyCh == nil {
+		ticker := time.NewTicker(SyncPollInterval)
+		defer ticker.Stop()
+		pollCh = ticker.C
+	}
+	var debounceCh <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-closedCh:
+			return fmt.Errorf("connection closed")
+		case <-notifyCh:
+			debounceCh = time.After(SyncDebounceTime)
+			continue
+		case <-notifyErrCh:
+			continue
+		case <-debounceCh:
+			debounceCh = nil
+		case <-pollCh:
+		}
+		changed, err := syncRound(ctx, client, data, round+1, progressFn)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			progressFn(wshrpc.ConnSyncProgress{Connection: data.Connection, Direction: data.Direction, Round: round + 1, Error: err.Error(), Done: true})
+		}
+		if changed || err != nil {
+			round++
+		}
+		if watcher != nil {
+			addSyncWatchDirs(watcher, data.LocalPath, data.Exclude)
+		}
+	}
+}
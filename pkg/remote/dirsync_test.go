@@ -0,0 +1,127 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRemoteSyncTree(t *testing.T) {
+	// gnu find, then stat (bsd)
+	output := "d 4096 1700000000.5 755 src\n" +
+		"f 12 1700000001.0000000000 644 src/main go.c\n" +
+		"f 5 1700000002.0 644 node_modules/x.js\n" +
+		"f 5 1700000002.0 644 big.bin.wavepart\n" +
+		"-rw------- 7 1700000003 600 ./notes.txt\n" +
+		"drwxr-xr-x 64 1700000004 755 ./docs\n" +
+		"garbage\n"
+	tree := parseRemoteSyncTree(output, []string{"node_modules"})
+	expected := syncTree{
+		"src":           {IsDir: true, ModTime: 1700000000, Mode: 0755},
+		"src/main go.c": {Size: 12, ModTime: 1700000001, Mode: 0644},
+		"notes.txt":     {Size: 7, ModTime: 1700000003, Mode: 0600},
+		"docs":          {IsDir: true, ModTime: 1700000004, Mode: 0755},
+	}
+	if !reflect.DeepEqual(tree, expected) {
+		t.Errorf("got %v", tree)
+	}
+}
+
+func TestIsSyncExcluded(t *testing.T) {
+	excludes := []string{"*.o", "build/*", ".git"}
+	tests := map[string]bool{
+		"main.o":         true,
+		"src/util.o":     true,
+		"build/out":      true,
+		"build":          false,
+		"src/build/out":  false,
+		".git/config":    true,
+		"src/main.c":     false,
+		"file.wavepart":  true,
+		"src/.gitignore": false,
+	}
+	for relPath, expected := range tests {
+		if isSyncExcluded(relPath, excludes) != expected {
+			t.Errorf("isSyncExcluded(%q) should be %v", relPath, expected)
+		}
+	}
+}
+
+func TestMakeSyncPlan(t *testing.T) {
+	src := syncTree{
+		"a.txt":       {Size: 3, ModTime: 100},
+		"b.txt":       {Size: 3, ModTime: 100},
+		"c.txt":       {Size: 4, ModTime: 100},
+		"dir":         {IsDir: true},
+		"dir/new.txt": {Size: 10, ModTime: 100},
+		"conflict":    {Size: 1, ModTime: 100},
+	}
+	dest := syncTree{
+		"a.txt":          {Size: 3, ModTime: 100}, // same
+		"b.txt":          {Size: 3, ModTime: 200}, // modtime changed
+		"c.txt":          {Size: 3, ModTime: 100}, // size changed
+		"conflict":       {IsDir: true},
+		"conflict/x":     {Size: 1},
+		"extra":          {IsDir: true},
+		"extra/file.txt": {Size: 1},
+	}
+	plan := makeSyncPlan(src, dest, false, nil, nil)
+	if !reflect.DeepEqual(plan.Deletes, []string{"conflict"}) {
+		t.Errorf("deletes without deleteExtra: %v", plan.Deletes)
+	}
+	if !reflect.DeepEqual(plan.Mkdirs, []string{"dir"}) {
+		t.Errorf("mkdirs: %v", plan.Mkdirs)
+	}
+	if !reflect.DeepEqual(plan.Copies, []string{"b.txt", "c.txt", "conflict", "dir/new.txt"}) {
+		t.Errorf("copies: %v", plan.Copies)
+	}
+	if plan.Bytes != 18 {
+		t.Errorf("bytes: %d", plan.Bytes)
+	}
+	plan = makeSyncPlan(src, dest, true, nil, nil)
+	if !reflect.DeepEqual(plan.Deletes, []string{"conflict", "extra"}) {
+		t.Errorf("deletes with deleteExtra: %v", plan.Deletes)
+	}
+	// with checksums, the modtime doesn't matter
+	srcSums := map[string]string{"a.txt": "1", "b.txt": "2"}
+	destSums := map[string]string{"a.txt": "x", "b.txt": "2"}
+	plan = makeSyncPlan(src, dest, false, srcSums, destSums)
+	if !reflect.DeepEqual(plan.Copies, []string{"a.txt", "c.txt", "conflict", "dir/new.txt"}) {
+		t.Errorf("copies with checksums: %v", plan.Copies)
+	}
+	if plan := makeSyncPlan(src, src, true, nil, nil); !plan.isEmpty() {
+		t.Errorf("expected an empty plan, got %+v", plan)
+	}
+}
+
+func TestListLocalSyncTree(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "sub", "skip"), 0755)
+	os.WriteFile(filepath.Join(root, "sub", "file.txt"), []byte("hello"), 0640)
+	os.WriteFile(filepath.Join(root, "sub", "skip", "x"), []byte("x"), 0644)
+	mtime := time.Unix(1700000000, 0)
+	os.Chtimes(filepath.Join(root, "sub", "file.txt"), mtime, mtime)
+	if err := os.Symlink("sub/file.txt", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	tree, exists, err := listLocalSyncTree(root, []string{"skip"})
+	if err != nil || !exists {
+		t.Fatalf("listing failed: %v", err)
+	}
+	if len(tree) != 2 || tree["sub"] == nil || !tree["sub"].IsDir {
+		t.Fatalf("unexpected tree %v", tree)
+	}
+	fileEntry := tree["sub/file.txt"]
+	if fileEntry == nil || fileEntry.Size != 5 || fileEntry.ModTime != 1700000000 || fileEntry.Mode != 0640 {
+		t.Errorf("unexpected entry %+v", fileEntry)
+	}
+	_, exists, err = listLocalSyncTree(filepath.Join(root, "missing"), nil)
+	if err != nil || exists {
+		t.Errorf("a missing directory should not exist (err %v)", err)
+	}
+}
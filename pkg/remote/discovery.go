@@ -0,0 +1,405 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// finds ssh servers on the local network, to suggest as connections.  hosts advertising
+// _ssh._tcp over mDNS (avahi, macOS "Remote Login") are always looked for, and subnets are only
+// scanned when asked for ("local" is the subnets of this machine's interfaces, each limited to
+// its /24).  a scanned host only counts if it answers with an ssh version line.
+
+const (
+	DefaultDiscoveryTimeout = 3 * time.Second // how long to wait for mDNS answers
+	DiscoveryProbeTimeout   = time.Second     // for each scanned address
+	MaxDiscoveryScanHosts   = 4096
+	DiscoveryScanWorkers    = 128
+	DiscoveryTag            = "discovered"
+	mdnsSshService          = "_ssh._tcp.local."
+)
+
+var mdnsAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// the records from mDNS answers, by name
+type mdnsResults struct {
+	Instances map[string]string                 // instances of _ssh._tcp (lowercased, to the name as sent)
+	Srv       map[string]dnsmessage.SRVResource // by instance
+	Addrs     map[string][]netip.Addr           // by host name
+}
+
+func makeMdnsResults() *mdnsResults {
+	return &mdnsResults{Instances: make(map[string]string), Srv: make(map[string]dnsmessage.SRVResource), Addrs: make(map[string][]netip.Addr)}
+}
+
+func makeMdnsQuery() ([]byte, error) {
+	name, err := dnsmessage.NewName(mdnsSshService)
+	if err != nil {
+		return nil, err
+	}
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{})
+	if err := builder.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := builder.Question(dnsmessage.Question{Name: name, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, err
+	}
+	return builder.Finish()
+}
+
+// adds the records of an mDNS response (answers and additional records) to results
+func (results *mdnsResults) parseResponse(msg []byte) error {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(msg)
+	if err != nil {
+		return err
+	}
+	if !header.Response {
+		return nil
+	}
+	if err := parser.SkipAllQuestions(); err != nil {
+		return err
+	}
+	var resources []dnsmessage.Resource
+	answers, err := parser.AllAnswers()
+	if err != nil {
+		return err
+	}
+	resources = append(resources, answers...)
+	if err := parser.SkipAllAuthorities(); err != nil {
+		return err
+	}
+	if additionals, err := parser.AllAdditionals(); err == nil {
+		resources = append(resources, additionals...)
+	}
+	for _, resource := range resources {
+		name := strings.ToLower(resource.Header.Name.String())
+		switch body := resource.Body.(type) {
+		case *dnsmessage.PTRResource:
+			if name == mdnsSshService {
+				results.Instances[strings.ToLower(body.PTR.String())] = body.PTR.String()
+			}
+		case *dnsmessage.SRVResource:
+			results.Srv[name] = *body
+		case *dnsmessage.AResource:
+			results.addAddr(name, netip.AddrFrom4(body.A))
+		case *dnsmessage.AAAAResource:
+			results.addAddr(name, netip.AddrFrom16(body.AAAA))
+		}
+	}
+	return nil
+}
+
+func (results *mdnsResults) addAddr(name string, addr netip.Addr) {
+	if !slices.Contains(results.Addrs[name], addr) {
+		results.Addrs[name] = append(results.Addrs[name], addr)
+	}
+}
+
+// the ssh servers in results (instances without a SRV record are left out)
+func (results *mdnsResults) hosts() []wshrpc.DiscoveredHost {
+	var rtn []wshrpc.DiscoveredHost
+	for instance, instanceName := range results.Instances {
+		srv, ok := results.Srv[instance]
+		if !ok {
+			continue
+		}
+		if strings.HasSuffix(instance, "."+mdnsSshService) {
+			instanceName = instanceName[:len(instanceName)-len(mdnsSshService)-1]
+		}
+		target := strings.ToLower(srv.Target.String())
+		host := wshrpc.DiscoveredHost{
+			Host:   strings.TrimSuffix(target, "."),
+			Port:   int(srv.Port),
+			Name:   unescapeMdnsInstance(instanceName),
+			Source: wshrpc.DiscoverySource_Mdns,
+		}
+		for _, addr := range results.Addrs[target] {
+			host.Addrs = append(host.Addrs, addr.String())
+		}
+		rtn = append(rtn, host)
+	}
+	return rtn
+}
+
+// instance names are labels, where "\032" is a space and "\." a dot
+func unescapeMdnsInstance(instance string) string {
+	var sb strings.Builder
+	for idx := 0; idx < len(instance); idx++ {
+		if instance[idx] != '\\' || idx+1 >= len(instance) {
+			sb.WriteByte(instance[idx])
+			continue
+		}
+		if idx+3 < len(instance) {
+			if val, err := strconv.Atoi(instance[idx+1 : idx+4]); err == nil && val < 256 {
+				sb.WriteByte(byte(val))
+				idx += 3
+				continue
+			}
+		}
+		sb.WriteByte(instance[idx+1])
+		idx++
+	}
+	return sb.String()
+}
+
+// asks for _ssh._tcp over mDNS, and collects the answers until ctx is done.  the query comes from
+// an unprivileged port, so responders answer it directly (a "legacy unicast" query).
+func discoverMdnsHosts(ctx context.Context) ([]wshrpc.DiscoveredHost, error) {
+	query, err := makeMdnsQuery()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		return nil, fmt.Errorf("mdns: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.WriteToUDP(query, mdnsAddr); err != nil {
+		return nil, fmt.Errorf("mdns: %w", err)
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(DefaultDiscoveryTimeout)
+	}
+	conn.SetReadDeadline(deadline)
+	results := makeMdnsResults()
+	buf := make([]byte, 9000)
+	for ctx.Err() == nil {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			break
+		}
+		results.parseResponse(buf[:n])
+	}
+	return results.hosts(), nil
+}
+
+// the addresses to scan in subnets (CIDRs, or "local")
+func expandScanSubnets(subnets []string) ([]netip.Addr, error) {
+	var prefixes []netip.Prefix
+	for _, subnet := range subnets {
+		if strings.ToLower(subnet) == "local" {
+			prefixes = append(prefixes, localScanPrefixes()...)
+			continue
+		}
+		prefix, err := netip.ParsePrefix(subnet)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(subnet)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid subnet %q: %w", subnet, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	var rtn []netip.Addr
+	for _, prefix := range prefixes {
+		hostBits := prefix.Addr().BitLen() - prefix.Bits()
+		if hostBits > 16 {
+			return nil, fmt.Errorf("subnet %s is too large to scan (at most %d addresses)", prefix, MaxDiscoveryScanHosts)
+		}
+		for addr := prefix.Addr(); prefix.Contains(addr); addr = addr.Next() {
+			// the network and broadcast addresses of ipv4 subnets
+			if addr.Is4() && hostBits >= 2 && (addr == prefix.Addr() || !prefix.Contains(addr.Next())) {
+				continue
+			}
+			if !slices.Contains(rtn, addr) {
+				rtn = append(rtn, addr)
+			}
+			if len(rtn) > MaxDiscoveryScanHosts {
+				return nil, fmt.Errorf("too many addresses to scan (at most %d)", MaxDiscoveryScanHosts)
+			}
+		}
+	}
+	return rtn, nil
+}
+
+// the ipv4 subnets of this machine's interfaces (at most a /24 around each address)
+func localScanPrefixes() []netip.Prefix {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var rtn []netip.Prefix
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.To4() == nil {
+				continue
+			}
+			ip, _ := netip.AddrFromSlice(ipNet.IP.To4())
+			bits, _ := ipNet.Mask.Size()
+			prefix := netip.PrefixFrom(ip, max(bits, 24)).Masked()
+			if !slices.Contains(rtn, prefix) {
+				rtn = append(rtn, prefix)
+			}
+		}
+	}
+	return rtn
+}
+
+// connects to addr and reads its ssh version line ("" if it isn't an ssh server)
+func probeSshServer(ctx context.Context, addr string, timeout time.Duration) string {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return ""
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * timeout))
+	reader := bufio.NewReaderSize(conn, 256)
+	// like the version exchange, servers can send other lines first
+	for range 5 {
+		line, err := reader.ReadString('\n')
+		if strings.HasPrefix(line, "SSH-") {
+			return strings.TrimSpace(line)
+		}
+		if err != nil {
+			return ""
+		}
+	}
+	return ""
+}
+
+// scans addrs for ssh servers on port, naming them by reverse dns when it has a name
+func scanSshHosts(ctx context.Context, addrs []netip.Addr, port int, probeTimeout time.Duration) []wshrpc.DiscoveredHost {
+	var lock sync.Mutex
+	var rtn []wshrpc.DiscoveredHost
+	addrCh := make(chan netip.Addr)
+	var wg sync.WaitGroup
+	for range min(DiscoveryScanWorkers, len(addrs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for addr := range addrCh {
+				version := probeSshServer(ctx, net.JoinHostPort(addr.String(), strconv.Itoa(port)), probeTimeout)
+				if version == "" {
+					continue
+				}
+				host := wshrpc.DiscoveredHost{Host: addr.String(), Port: port, Addrs: []string{addr.String()}, Source: wshrpc.DiscoverySource_Scan, ServerVersion: version}
+				lookupCtx, cancelFn := context.WithTimeout(ctx, probeTimeout)
+				if names, err := net.DefaultResolver.LookupAddr(lookupCtx, addr.String()); err == nil && len(names) > 0 {
+					host.Name = strings.TrimSuffix(names[0], ".")
+				}
+				cancelFn()
+				lock.Lock()
+				rtn = append(rtn, host)
+				lock.Unlock()
+			}
+		}()
+	}
+	for _, addr := range addrs {
+		select {
+		case addrCh <- addr:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(addrCh)
+	wg.Wait()
+	return rtn
+}
+
+// merges scanned hosts into the mDNS ones (a scanned address of an mDNS host only adds the
+// server version), and names the connections
+func mergeDiscoveredHosts(mdnsHosts []wshrpc.DiscoveredHost, scanHosts []wshrpc.DiscoveredHost) []wshrpc.DiscoveredHost {
+	rtn := slices.Clone(mdnsHosts)
+	for _, scanned := range scanHosts {
+		idx := slices.IndexFunc(rtn, func(host wshrpc.DiscoveredHost) bool {
+			return host.Port == scanned.Port && slices.Contains(host.Addrs, scanned.Host)
+		})
+		if idx >= 0 {
+			rtn[idx].ServerVersion = scanned.ServerVersion
+			continue
+		}
+		rtn = append(rtn, scanned)
+	}
+	for idx := range rtn {
+		host := &rtn[idx]
+		connHost := host.Host
+		if host.Source == wshrpc.DiscoverySource_Scan && host.Name != "" {
+			connHost = host.Name
+		}
+		opts := SSHOpts{SSHHost: connHost}
+		if host.Port != 22 {
+			opts.SSHPort = host.Port
+		}
+		host.Connection = opts.String()
+		host.Keywords = waveobj.MetaMapType{"display:tags": []string{DiscoveryTag}}
+	}
+	slices.SortFunc(rtn, func(a, b wshrpc.DiscoveredHost) int {
+		return strings.Compare(a.Connection, b.Connection)
+	})
+	return slices.CompactFunc(rtn, func(a, b wshrpc.DiscoveredHost) bool {
+		return a.Connection == b.Connection
+	})
+}
+
+// DiscoverHosts finds ssh servers with mDNS (unless NoMdns) and by scanning data.Subnets.  mDNS
+// answers are collected for data.TimeoutMs, a scan takes as long as it needs.
+func DiscoverHosts(ctx context.Context, data wshrpc.CommandDiscoverHostsData) ([]wshrpc.DiscoveredHost, error) {
+	timeout := DefaultDiscoveryTimeout
+	if data.TimeoutMs > 0 {
+		timeout = time.Duration(data.TimeoutMs) * time.Millisecond
+	}
+	port := data.Port
+	if port == 0 {
+		port = 22
+	}
+	if port < 1 || port > 65535 {
+		return nil, fmt.Errorf("invalid port %d", port)
+	}
+	scanAddrs, err := expandScanSubnets(data.Subnets)
+	if err != nil {
+		return nil, err
+	}
+	var mdnsHosts, scanHosts []wshrpc.DiscoveredHost
+	var mdnsErr error
+	var wg sync.WaitGroup
+	if !data.NoMdns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mdnsCtx, cancelFn := context.WithTimeout(ctx, timeout)
+			defer cancelFn()
+			mdnsHosts, mdnsErr = discoverMdnsHosts(mdnsCtx)
+		}()
+	}
+	if len(scanAddrs) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			scanHosts = scanSshHosts(ctx, scanAddrs, port, DiscoveryProbeTimeout)
+		}()
+	}
+	wg.Wait()
+	if mdnsErr != nil && len(scanAddrs) == 0 {
+		return nil, mdnsErr
+	}
+	return mergeDiscoveredHosts(mdnsHosts, scanHosts), nil
+}
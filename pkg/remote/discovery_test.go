@@ -0,0 +1,160 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func makeTestMdnsResponse(t *testing.T) []byte {
+	mustName := func(name string) dnsmessage.Name {
+		rtn, err := dnsmessage.NewName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rtn
+	}
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{Response: true, Authoritative: true})
+	builder.EnableCompression()
+	if err := builder.StartAnswers(); err != nil {
+		t.Fatal(err)
+	}
+	ptrHeader := dnsmessage.ResourceHeader{Name: mustName(mdnsSshService), Class: dnsmessage.ClassINET, TTL: 120}
+	builder.PTRResource(ptrHeader, dnsmessage.PTRResource{PTR: mustName(`Build\032Box._ssh._tcp.local.`)})
+	builder.PTRResource(ptrHeader, dnsmessage.PTRResource{PTR: mustName(`nosrv._ssh._tcp.local.`)})
+	if err := builder.StartAdditionals(); err != nil {
+		t.Fatal(err)
+	}
+	header := dnsmessage.ResourceHeader{Name: mustName(`Build\032Box._ssh._tcp.local.`), Class: dnsmessage.ClassINET, TTL: 120}
+	builder.SRVResource(header, dnsmessage.SRVResource{Port: 2222, Target: mustName("buildbox.local.")})
+	header.Name = mustName("buildbox.local.")
+	builder.AResource(header, dnsmessage.AResource{A: [4]byte{192, 168, 1, 20}})
+	builder.AResource(header, dnsmessage.AResource{A: [4]byte{192, 168, 1, 20}})
+	msg, err := builder.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestParseMdnsResponse(t *testing.T) {
+	results := makeMdnsResults()
+	if err := results.parseResponse(makeTestMdnsResponse(t)); err != nil {
+		t.Fatal(err)
+	}
+	hosts := results.hosts()
+	if len(hosts) != 1 {
+		t.Fatalf("got %d hosts, expected 1", len(hosts))
+	}
+	host := hosts[0]
+	if host.Host != "buildbox.local" || host.Port != 2222 || host.Name != "Build Box" || !slices.Equal(host.Addrs, []string{"192.168.1.20"}) {
+		t.Errorf("got %+v", host)
+	}
+	// a query (our own, looped back) adds nothing
+	query, err := makeMdnsQuery()
+	if err != nil {
+		t.Fatal(err)
+	}
+	results = makeMdnsResults()
+	if err := results.parseResponse(query); err != nil || len(results.Instances) > 0 {
+		t.Errorf("query: got %v, %d instances", err, len(results.Instances))
+	}
+}
+
+func TestExpandScanSubnets(t *testing.T) {
+	addrs, err := expandScanSubnets([]string{"10.0.0.0/30", "10.0.0.1", "192.168.5.7/31"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []netip.Addr{
+		netip.MustParseAddr("10.0.0.1"),
+		netip.MustParseAddr("10.0.0.2"),
+		netip.MustParseAddr("192.168.5.6"),
+		netip.MustParseAddr("192.168.5.7"),
+	}
+	if !slices.Equal(addrs, expected) {
+		t.Errorf("got %v, expected %v", addrs, expected)
+	}
+	if addrs, err := expandScanSubnets([]string{"10.0.0.0/24"}); err != nil || len(addrs) != 254 {
+		t.Errorf("/24: got %d addresses, %v", len(addrs), err)
+	}
+	for _, subnet := range []string{"10.0.0.0/8", "10.0.0.0/20,", "not-a-subnet"} {
+		if _, err := expandScanSubnets([]string{subnet}); err == nil {
+			t.Errorf("%q should be an error", subnet)
+		}
+	}
+	if _, err := expandScanSubnets([]string{"10.0.0.0/20", "10.1.0.0/20"}); err == nil {
+		t.Errorf("more than %d addresses should be an error", MaxDiscoveryScanHosts)
+	}
+}
+
+func startTestBannerServer(t *testing.T, banner string) (string, int) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte(banner))
+			conn.Close()
+		}
+	}()
+	return listener.Addr().String(), listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestProbeSshServer(t *testing.T) {
+	ctx := context.Background()
+	addr, _ := startTestBannerServer(t, "hello\r\nSSH-2.0-OpenSSH_9.9\r\n")
+	if version := probeSshServer(ctx, addr, time.Second); version != "SSH-2.0-OpenSSH_9.9" {
+		t.Errorf("got version %q", version)
+	}
+	addr, _ = startTestBannerServer(t, "HTTP/1.1 400 Bad Request\r\n\r\n")
+	if version := probeSshServer(ctx, addr, time.Second); version != "" {
+		t.Errorf("not an ssh server, got version %q", version)
+	}
+	_, port := startTestBannerServer(t, "SSH-2.0-Test\r\n")
+	hosts := scanSshHosts(ctx, []netip.Addr{netip.MustParseAddr("127.0.0.1")}, port, time.Second)
+	if len(hosts) != 1 || hosts[0].ServerVersion != "SSH-2.0-Test" || hosts[0].Source != wshrpc.DiscoverySource_Scan {
+		t.Errorf("scan got %+v", hosts)
+	}
+}
+
+func TestMergeDiscoveredHosts(t *testing.T) {
+	mdnsHosts := []wshrpc.DiscoveredHost{
+		{Host: "buildbox.local", Port: 22, Addrs: []string{"192.168.1.20"}, Source: wshrpc.DiscoverySource_Mdns},
+	}
+	scanHosts := []wshrpc.DiscoveredHost{
+		{Host: "192.168.1.20", Port: 22, Addrs: []string{"192.168.1.20"}, Source: wshrpc.DiscoverySource_Scan, ServerVersion: "SSH-2.0-A"},
+		{Host: "192.168.1.30", Port: 2222, Addrs: []string{"192.168.1.30"}, Source: wshrpc.DiscoverySource_Scan, Name: "nas.lan"},
+		{Host: "fe80::1", Port: 22, Addrs: []string{"fe80::1"}, Source: wshrpc.DiscoverySource_Scan},
+	}
+	hosts := mergeDiscoveredHosts(mdnsHosts, scanHosts)
+	var conns []string
+	for _, host := range hosts {
+		conns = append(conns, host.Connection)
+	}
+	expected := []string{"[fe80::1]", "buildbox.local", "nas.lan:2222"}
+	if !slices.Equal(conns, expected) {
+		t.Fatalf("got %v, expected %v", conns, expected)
+	}
+	if hosts[1].ServerVersion != "SSH-2.0-A" || hosts[1].Source != wshrpc.DiscoverySource_Mdns {
+		t.Errorf("mdns host not merged: %+v", hosts[1])
+	}
+	if tags, ok := hosts[2].Keywords["display:tags"].([]string); !ok || !slices.Equal(tags, []string{DiscoveryTag}) {
+		t.Errorf("got keywords %v", hosts[2].Keywords)
+	}
+}
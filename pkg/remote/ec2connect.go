@@ -0,0 +1,324 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/remote/conndebug"
+	"github.com/wavetermdev/waveterm/pkg/util/shellutil"
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"golang.org/x/crypto/ssh"
+)
+
+// EC2 Instance Connect (ec2:instanceid): before authenticating, a new ed25519 key is pushed to
+// the instance with the SendSSHPublicKey api, and offered first.  the instance accepts it for 60
+// seconds, for the connection's user.
+//
+// the aws credentials are found like the aws cli does (a subset of it): the AWS_ACCESS_KEY_ID
+// environment variables (unless ec2:profile is set), then the profile (ec2:profile, AWS_PROFILE,
+// or "default") in ~/.aws/credentials and ~/.aws/config, with static keys or credential_process.
+// sso and assumed roles are not supported directly, they work through a profile whose
+// credential_process is "aws configure export-credentials --profile <profile> --format process".
+
+const Ec2InstanceConnectService = "ec2-instance-connect"
+const Ec2InstanceConnectTarget = "AWSEC2InstanceConnectService.SendSSHPublicKey"
+const Ec2InstanceConnectTimeout = 15 * time.Second
+const AwsCredentialProcessTimeout = 30 * time.Second
+
+const awsSigningAlgorithm = "AWS4-HMAC-SHA256"
+const awsDateFormat = "20060102T150405Z"
+
+type awsCredentials struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// the output of a credential_process
+type awsProcessCredentials struct {
+	Version         int    `json:"Version"`
+	AccessKeyId     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	SessionToken    string `json:"SessionToken"`
+}
+
+func awsConfigFilePath(envVar string, defaultPath string) string {
+	if path := os.Getenv(envVar); path != "" {
+		return path
+	}
+	path, _ := wavebase.ExpandHomeDir(defaultPath)
+	return path
+}
+
+// reads the keys of a section of an aws ini file (nil if the file or section is not there)
+func readAwsIniSection(path string, section string) map[string]string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var rtn map[string]string
+	inSection := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := strings.Join(strings.Fields(line[1:len(line)-1]), " ")
+			inSection = name == section
+			if inSection && rtn == nil {
+				rtn = make(map[string]string)
+			}
+			continue
+		}
+		key, val, ok := strings.Cut(line, "=")
+		if inSection && ok {
+			rtn[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(val)
+		}
+	}
+	return rtn
+}
+
+// the profile's settings from the config file, overridden by the ones in the credentials file
+func readAwsProfile(profile string) map[string]string {
+	rtn := make(map[string]string)
+	configSection := "profile " + profile
+	if profile == "default" {
+		configSection = "default"
+	}
+	for key, val := range readAwsIniSection(awsConfigFilePath("AWS_CONFIG_FILE", "~/.aws/config"), configSection) {
+		rtn[key] = val
+	}
+	for key, val := range readAwsIniSection(awsConfigFilePath("AWS_SHARED_CREDENTIALS_FILE", "~/.aws/credentials"), profile) {
+		rtn[key] = val
+	}
+	return rtn
+}
+
+func runAwsCredentialProcess(ctx context.Context, cmdStr string) (*awsCredentials, error) {
+	ctx, cancelFn := context.WithTimeout(ctx, AwsCredentialProcessTimeout)
+	defer cancelFn()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd.exe", "/C", cmdStr)
+	} else {
+		cmd = exec.CommandContext(ctx, shellutil.DetectLocalShellPath(), "-c", cmdStr)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("credential_process failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	var processCreds awsProcessCredentials
+	if err := json.Unmarshal(out, &processCreds); err != nil {
+		return nil, fmt.Errorf("credential_process output: %w", err)
+	}
+	if processCreds.Version != 1 || processCreds.AccessKeyId == "" || processCreds.SecretAccessKey == "" {
+		return nil, fmt.Errorf("credential_process output is not version 1 credentials")
+	}
+	return &awsCredentials{AccessKeyId: processCreds.AccessKeyId, SecretAccessKey: processCreds.SecretAccessKey, SessionToken: processCreds.SessionToken}, nil
+}
+
+// finds the aws credentials and region (region overrides the profile's region)
+func resolveAwsCredentials(ctx context.Context, profile string, region string) (*awsCredentials, string, error) {
+	if profile == "" {
+		profile = os.Getenv("AWS_PROFILE")
+	}
+	var creds *awsCredentials
+	if profile == "" && os.Getenv("AWS_ACCESS_KEY_ID") != "" && os.Getenv("AWS_SECRET_ACCESS_KEY") != "" {
+		creds = &awsCredentials{
+			AccessKeyId:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+	}
+	if profile == "" {
+		profile = "default"
+	}
+	profileSettings := readAwsProfile(profile)
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = profileSettings["region"]
+	}
+	if region == "" {
+		return nil, "", fmt.Errorf("no aws region (set ec2:region)")
+	}
+	if creds != nil {
+		return creds, region, nil
+	}
+	if profileSettings["aws_access_key_id"] != "" && profileSettings["aws_secret_access_key"] != "" {
+		creds = &awsCredentials{
+			AccessKeyId:     profileSettings["aws_access_key_id"],
+			SecretAccessKey: profileSettings["aws_secret_access_key"],
+			SessionToken:    profileSettings["aws_session_token"],
+		}
+		return creds, region, nil
+	}
+	if cmdStr := profileSettings["credential_process"]; cmdStr != "" {
+		creds, err := runAwsCredentialProcess(ctx, cmdStr)
+		if err != nil {
+			return nil, "", fmt.Errorf("aws profile %q: %w", profile, err)
+		}
+		return creds, region, nil
+	}
+	for _, key := range []string{"sso_session", "sso_start_url", "role_arn", "web_identity_token_file"} {
+		if profileSettings[key] != "" {
+			return nil, "", fmt.Errorf("aws profile %q uses %s, which is not supported (use a profile with \"credential_process = aws configure export-credentials --profile %s --format process\")", profile, key, profile)
+		}
+	}
+	return nil, "", fmt.Errorf("no aws credentials found for profile %q", profile)
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// signs req with aws signature version 4 (every header set on req is signed, along with host).
+// the request must not have a query string.
+func signAwsRequest(req *http.Request, body []byte, creds *awsCredentials, region string, service string, now time.Time) {
+	amzDate := now.UTC().Format(awsDateFormat)
+	dateStamp := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+	headers := map[string]string{"host": req.URL.Host}
+	for name, vals := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(vals, ","))
+	}
+	var headerNames []string
+	for name := range headers {
+		headerNames = append(headerNames, name)
+	}
+	sort.Strings(headerNames)
+	var canonicalHeaders strings.Builder
+	for _, name := range headerNames {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{req.Method, path, "", canonicalHeaders.String(), signedHeaders, sha256Hex(body)}, "\n")
+	scope := dateStamp + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{awsSigningAlgorithm, amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+	signingKey := hmacSha256([]byte("AWS4"+creds.SecretAccessKey), dateStamp)
+	signingKey = hmacSha256(signingKey, region)
+	signingKey = hmacSha256(signingKey, service)
+	signingKey = hmacSha256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(signingKey, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s", awsSigningAlgorithm, creds.AccessKeyId, scope, signedHeaders, signature))
+}
+
+func ec2InstanceConnectEndpoint(region string) string {
+	domain := "amazonaws.com"
+	if strings.HasPrefix(region, "cn-") {
+		domain = "amazonaws.com.cn"
+	}
+	return "https://" + Ec2InstanceConnectService + "." + region + "." + domain + "/"
+}
+
+// calls SendSSHPublicKey, so the instance accepts publicKey for osUser (for 60 seconds)
+func sendEc2SshPublicKey(ctx context.Context, creds *awsCredentials, region string, instanceId string, osUser string, publicKey ssh.PublicKey) error {
+	body, err := json.Marshal(map[string]string{
+		"InstanceId":     instanceId,
+		"InstanceOSUser": osUser,
+		"SSHPublicKey":   strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey))),
+	})
+	if err != nil {
+		return err
+	}
+	ctx, cancelFn := context.WithTimeout(ctx, Ec2InstanceConnectTimeout)
+	defer cancelFn()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ec2InstanceConnectEndpoint(region), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", Ec2InstanceConnectTarget)
+	signAwsRequest(req, body, creds, region, Ec2InstanceConnectService, time.Now())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode != http.StatusOK {
+		var awsErr struct {
+			Type     string `json:"__type"`
+			Message  string `json:"Message"`
+			Message2 string `json:"message"`
+		}
+		json.Unmarshal(respBody, &awsErr)
+		errType := awsErr.Type
+		if idx := strings.LastIndex(errType, "#"); idx >= 0 {
+			errType = errType[idx+1:]
+		}
+		message := awsErr.Message
+		if message == "" {
+			message = awsErr.Message2
+		}
+		if errType == "" && message == "" {
+			message = strings.TrimSpace(string(respBody))
+		}
+		return fmt.Errorf("%s: %s %s", resp.Status, errType, message)
+	}
+	return nil
+}
+
+// pushes a new key for ec2:instanceid and returns its signer
+func pushEc2InstanceConnectKey(connCtx context.Context, sshKeywords *wshrpc.ConnKeywords) (ssh.Signer, error) {
+	creds, region, err := resolveAwsCredentials(connCtx, sshKeywords.Ec2Profile, sshKeywords.Ec2Region)
+	if err != nil {
+		return nil, fmt.Errorf("ec2 instance connect: %w", err)
+	}
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	conndebug.Logf(connCtx, "ec2 instance connect: pushing key %s for %s to %s (%s)", ssh.FingerprintSHA256(signer.PublicKey()), sshKeywords.SshUser, sshKeywords.Ec2InstanceId, region)
+	err = sendEc2SshPublicKey(connCtx, creds, region, sshKeywords.Ec2InstanceId, sshKeywords.SshUser, signer.PublicKey())
+	if err != nil {
+		return nil, fmt.Errorf("ec2 instance connect for %s: %w", sshKeywords.Ec2InstanceId, err)
+	}
+	return signer, nil
+}
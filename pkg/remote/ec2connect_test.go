@@ -0,0 +1,62 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSignAwsRequest(t *testing.T) {
+	// the get-vanilla and post-vanilla cases of the aws sigv4 test suite
+	creds := &awsCredentials{AccessKeyId: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	expected := map[string]string{
+		http.MethodGet:  "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		http.MethodPost: "5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+	}
+	for method, signature := range expected {
+		req, _ := http.NewRequest(method, "https://example.amazonaws.com/", nil)
+		signAwsRequest(req, nil, creds, "us-east-1", "service", now)
+		authHeader := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=" + signature
+		if req.Header.Get("Authorization") != authHeader {
+			t.Errorf("%s: got %q", method, req.Header.Get("Authorization"))
+		}
+	}
+}
+
+func TestResolveAwsCredentials(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config")
+	credsPath := filepath.Join(dir, "credentials")
+	os.WriteFile(configPath, []byte("[default]\nregion = us-west-2\n\n[profile proc]\nregion=eu-west-1\ncredential_process = echo '{\"Version\": 1, \"AccessKeyId\": \"AKPROC\", \"SecretAccessKey\": \"secret\"}'\n\n[profile sso]\nsso_session = corp\n"), 0600)
+	os.WriteFile(credsPath, []byte("[default]\naws_access_key_id = AKDEFAULT\naws_secret_access_key = secret\n"), 0600)
+	t.Setenv("AWS_CONFIG_FILE", configPath)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credsPath)
+	for _, envVar := range []string{"AWS_PROFILE", "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_REGION", "AWS_DEFAULT_REGION"} {
+		t.Setenv(envVar, "")
+	}
+	ctx := context.Background()
+	creds, region, err := resolveAwsCredentials(ctx, "", "")
+	if err != nil || creds.AccessKeyId != "AKDEFAULT" || region != "us-west-2" {
+		t.Errorf("default profile: %v %q %v", creds, region, err)
+	}
+	creds, region, err = resolveAwsCredentials(ctx, "proc", "")
+	if err != nil || creds.AccessKeyId != "AKPROC" || region != "eu-west-1" {
+		t.Errorf("credential_process profile: %v %q %v", creds, region, err)
+	}
+	if _, _, err := resolveAwsCredentials(ctx, "sso", "us-east-1"); err == nil {
+		t.Errorf("sso profiles should be an error")
+	}
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKENV")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	creds, region, err = resolveAwsCredentials(ctx, "", "ap-south-1")
+	if err != nil || creds.AccessKeyId != "AKENV" || region != "ap-south-1" {
+		t.Errorf("environment: %v %q %v", creds, region, err)
+	}
+}
@@ -0,0 +1,296 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"golang.org/x/crypto/ssh"
+)
+
+// scp-style file copies over an ssh.Client.  these only need a posix shell on the remote (not
+// wsh), data is streamed through "cat" and "tail -c", and the result is verified with
+// sha256sum (or shasum).  files are written to a ".wavepart" file next to the destination and
+// renamed when the copy is verified, so an interrupted copy can be resumed.
+
+const FileCopyPartSuffix = ".wavepart"
+const FileCopyProgressInterval = 200 * time.Millisecond
+
+// quotes a path for the remote shell, a leading "~/" is kept outside of the quotes so it expands
+func QuoteRemotePath(path string) string {
+	quote := func(s string) string {
+		return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+	}
+	if path == "~" {
+		return `"$HOME"`
+	}
+	if strings.HasPrefix(path, "~/") {
+		return `"$HOME"/` + quote(path[2:])
+	}
+	return quote(path)
+}
+
+func runRemoteOutput(client *ssh.Client, cmd string) (string, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+	out, err := session.Output(cmd)
+	return strings.TrimSpace(string(out)), err
+}
+
+// returns -1 if the file doesn't exist
+func remoteFileSize(client *ssh.Client, path string) (int64, error) {
+	qpath := QuoteRemotePath(path)
+	out, err := runRemoteOutput(client, fmt.Sprintf("if [ -f %s ]; then wc -c < %s; elif [ -e %s ]; then echo notafile; else echo -1; fi", qpath, qpath, qpath))
+	if err != nil {
+		return 0, fmt.Errorf("cannot stat %s: %w", path, err)
+	}
+	if out == "notafile" {
+		return 0, fmt.Errorf("%s is not a file", path)
+	}
+	size, err := strconv.ParseInt(out, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("cannot stat %s: unexpected output %q", path, out)
+	}
+	return size, nil
+}
+
+// returns "" (with no error) if neither sha256sum nor shasum is installed
+func remoteSha256(client *ssh.Client, path string) (string, error) {
+	qpath := QuoteRemotePath(path)
+	out, err := runRemoteOutput(client, fmt.Sprintf("if command -v sha256sum >/dev/null 2>&1; then sha256sum < %s; elif command -v shasum >/dev/null 2>&1; then shasum -a 256 < %s; fi", qpath, qpath))
+	if err != nil {
+		return "", fmt.Errorf("cannot checksum %s: %w", path, err)
+	}
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return fields[0], nil
+}
+
+func localSha256(path string) (string, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, fd); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// counts bytes, reports progress (at most every FileCopyProgressInterval), and stops when ctx is done
+type copyProgressWriter struct {
+	ctx        context.Context
+	progress   *wshrpc.ConnCopyFileProgress
+	progressFn func(wshrpc.ConnCopyFileProgress)
+	lastTs     time.Time
+}
+
+func (w *copyProgressWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	w.progress.Bytes += int64(len(p))
+	if w.progressFn != nil && time.Since(w.lastTs) >= FileCopyProgressInterval {
+		w.lastTs = time.Now()
+		w.progressFn(*w.progress)
+	}
+	return len(p), nil
+}
+
+// compares the checksums and renames the part file (on the remote for uploads, locally for downloads)
+func finishFileCopy(client *ssh.Client, data wshrpc.CommandConnCopyFileData, localPath string, remotePath string, progress *wshrpc.ConnCopyFileProgress) error {
+	localSum, err := localSha256(localPath)
+	if err != nil {
+		return fmt.Errorf("cannot checksum %s: %w", localPath, err)
+	}
+	remoteSum, err := remoteSha256(client, remotePath)
+	if err != nil {
+		return err
+	}
+	progress.Checksum = localSum
+	if remoteSum != "" {
+		if remoteSum != localSum {
+			if data.Direction == wshrpc.CopyDirection_Upload {
+				runRemoteOutput(client, "rm -f "+QuoteRemotePath(remotePath))
+			} else {
+				os.Remove(localPath)
+			}
+			return fmt.Errorf("checksum mismatch (local %s, remote %s), the partial file was removed", localSum, remoteSum)
+		}
+		progress.Verified = true
+	}
+	if data.Direction == wshrpc.CopyDirection_Upload {
+		_, err = runRemoteOutput(client, fmt.Sprintf("mv -f %s %s", QuoteRemotePath(remotePath), QuoteRemotePath(data.RemotePath)))
+	} else {
+		err = os.Rename(localPath, data.LocalPath)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot rename the partial file: %w", err)
+	}
+	return nil
+}
+
+// runs cmd on the remote with stdin/stdout connected, the session is closed if ctx is done
+func runRemoteCopy(ctx context.Context, client *ssh.Client, cmd string, stdin io.Reader, stdout io.Writer) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	session.Stdin = stdin
+	session.Stdout = stdout
+	var stderr strings.Builder
+	session.Stderr = &stderr
+	stopFn := context.AfterFunc(ctx, func() {
+		session.Close()
+	})
+	defer stopFn()
+	err = session.Run(cmd)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if err != nil && stderr.Len() > 0 {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return err
+}
+
+// CopyFile uploads or downloads a file, calling progressFn as it goes (and once more when it is done)
+func CopyFile(ctx context.Context, client *ssh.Client, data wshrpc.CommandConnCopyFileData, progressFn func(wshrpc.ConnCopyFileProgress)) error {
+	if data.LocalPath == "" || data.RemotePath == "" {
+		return fmt.Errorf("local and remote paths are required")
+	}
+	progress := &wshrpc.ConnCopyFileProgress{
+		Connection: data.Connection,
+		Direction:  data.Direction,
+		LocalPath:  data.LocalPath,
+		RemotePath: data.RemotePath,
+	}
+	var err error
+	switch data.Direction {
+	case wshrpc.CopyDirection_Upload:
+		err = uploadFile(ctx, client, data, progress, progressFn)
+	case wshrpc.CopyDirection_Download:
+		err = downloadFile(ctx, client, data, progress, progressFn)
+	default:
+		return fmt.Errorf("invalid copy direction %q", data.Direction)
+	}
+	if err != nil {
+		return err
+	}
+	progress.Done = true
+	if progressFn != nil {
+		progressFn(*progress)
+	}
+	return nil
+}
+
+func uploadFile(ctx context.Context, client *ssh.Client, data wshrpc.CommandConnCopyFileData, progress *wshrpc.ConnCopyFileProgress, progressFn func(wshrpc.ConnCopyFileProgress)) error {
+	fd, err := os.Open(data.LocalPath)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	finfo, err := fd.Stat()
+	if err != nil {
+		return err
+	}
+	if !finfo.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a file", data.LocalPath)
+	}
+	progress.TotalBytes = finfo.Size()
+	destSize, err := remoteFileSize(client, data.RemotePath)
+	if err != nil {
+		return err
+	}
+	if destSize >= 0 && !data.Overwrite {
+		return fmt.Errorf("%s already exists on the remote (use overwrite to replace it)", data.RemotePath)
+	}
+	partPath := data.RemotePath + FileCopyPartSuffix
+	var offset int64
+	if data.Resume {
+		partSize, err := remoteFileSize(client, partPath)
+		if err != nil {
+			return err
+		}
+		if partSize > 0 && partSize <= progress.TotalBytes {
+			offset = partSize
+		}
+	}
+	redirect := ">"
+	if offset > 0 {
+		redirect = ">>"
+		if _, err := fd.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	progress.ResumedFrom = offset
+	progress.Bytes = offset
+	writer := &copyProgressWriter{ctx: ctx, progress: progress, progressFn: progressFn, lastTs: time.Now()}
+	reader := io.TeeReader(io.LimitReader(fd, progress.TotalBytes-offset), writer)
+	err = runRemoteCopy(ctx, client, fmt.Sprintf("cat %s %s", redirect, QuoteRemotePath(partPath)), reader, nil)
+	if err != nil {
+		return fmt.Errorf("upload failed after %d bytes (it can be resumed): %w", progress.Bytes, err)
+	}
+	return finishFileCopy(client, data, data.LocalPath, partPath, progress)
+}
+
+func downloadFile(ctx context.Context, client *ssh.Client, data wshrpc.CommandConnCopyFileData, progress *wshrpc.ConnCopyFileProgress, progressFn func(wshrpc.ConnCopyFileProgress)) error {
+	srcSize, err := remoteFileSize(client, data.RemotePath)
+	if err != nil {
+		return err
+	}
+	if srcSize < 0 {
+		return fmt.Errorf("%s does not exist on the remote", data.RemotePath)
+	}
+	progress.TotalBytes = srcSize
+	if _, err := os.Stat(data.LocalPath); err == nil && !data.Overwrite {
+		return fmt.Errorf("%s already exists (use overwrite to replace it)", data.LocalPath)
+	}
+	partPath := data.LocalPath + FileCopyPartSuffix
+	var offset int64
+	if data.Resume {
+		if finfo, err := os.Stat(partPath); err == nil && finfo.Size() <= srcSize {
+			offset = finfo.Size()
+		}
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if offset > 0 {
+		flags = os.O_WRONLY | os.O_APPEND
+	}
+	fd, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return err
+	}
+	progress.ResumedFrom = offset
+	progress.Bytes = offset
+	writer := &copyProgressWriter{ctx: ctx, progress: progress, progressFn: progressFn, lastTs: time.Now()}
+	// tail -c +N starts at byte N (1-based)
+	cmd := fmt.Sprintf("tail -c +%d %s", offset+1, QuoteRemotePath(data.RemotePath))
+	err = runRemoteCopy(ctx, client, cmd, nil, io.MultiWriter(fd, writer))
+	closeErr := fd.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("download failed after %d bytes (it can be resumed): %w", progress.Bytes, err)
+	}
+	return finishFileCopy(client, data, partPath, data.RemotePath, progress)
+}
@@ -0,0 +1,351 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/wavetermdev/waveterm/pkg/remote/conndebug"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// tunnels the ssh connection through Google's Identity-Aware Proxy (gcp:iap), like
+// "gcloud compute start-iap-tunnel", so GCE instances without an external ip can be reached.
+// the tunnel is a websocket to tunnel.cloudproxy.app that carries the tcp stream in the relay
+// subprotocol: DATA frames both ways, and ACKs of the received bytes.  a broken tunnel is not
+// reconnected, the connection fails instead (and can be reconnected).
+//
+// the access token comes from "gcloud auth print-access-token" (or CLOUDSDK_AUTH_ACCESS_TOKEN),
+// the project defaults to gcloud's, and the instance defaults to the connection's host name.
+
+const IapTunnelHost = "tunnel.cloudproxy.app"
+const IapTunnelSubprotocol = "relay.tunnel.cloudproxy.app"
+const IapTunnelOrigin = "bot:iap-tunneler"
+const IapDefaultInterface = "nic0"
+const IapGcloudTimeout = 30 * time.Second
+const IapTokenCacheTime = 10 * time.Minute
+
+const (
+	iapTag_ConnectSuccessSid   = 0x0001
+	iapTag_ReconnectSuccessAck = 0x0002
+	iapTag_Data                = 0x0004
+	iapTag_Ack                 = 0x0007
+
+	iapMaxDataFrameSize = 16 * 1024
+	iapAckThreshold     = 2 * iapMaxDataFrameSize
+)
+
+type iapTunnelOpts struct {
+	Project   string
+	Zone      string
+	Instance  string
+	Interface string
+}
+
+type iapTokenCache struct {
+	Lock      *sync.Mutex
+	Token     string
+	FetchTime time.Time
+}
+
+var iapToken = &iapTokenCache{Lock: &sync.Mutex{}}
+
+// the iap options for a connection (nil when gcp:iap is not set)
+func makeIapTunnelOpts(sshKeywords *wshrpc.ConnKeywords) *iapTunnelOpts {
+	if !sshKeywords.GcpIap {
+		return nil
+	}
+	rtn := &iapTunnelOpts{
+		Project:   sshKeywords.GcpProject,
+		Zone:      sshKeywords.GcpZone,
+		Instance:  sshKeywords.GcpInstance,
+		Interface: sshKeywords.GcpInterface,
+	}
+	if rtn.Instance == "" {
+		rtn.Instance = sshKeywords.SshHostName
+	}
+	if rtn.Interface == "" {
+		rtn.Interface = IapDefaultInterface
+	}
+	return rtn
+}
+
+func runGcloud(ctx context.Context, args ...string) (string, error) {
+	ctx, cancelFn := context.WithTimeout(ctx, IapGcloudTimeout)
+	defer cancelFn()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "gcloud", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return "", fmt.Errorf("gcloud was not found (install the Google Cloud CLI)")
+		}
+		return "", fmt.Errorf("gcloud %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func getIapAccessToken(ctx context.Context) (string, error) {
+	if token := os.Getenv("CLOUDSDK_AUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+	iapToken.Lock.Lock()
+	defer iapToken.Lock.Unlock()
+	if iapToken.Token != "" && time.Since(iapToken.FetchTime) < IapTokenCacheTime {
+		return iapToken.Token, nil
+	}
+	token, err := runGcloud(ctx, "auth", "print-access-token")
+	if err != nil {
+		return "", err
+	}
+	iapToken.Token = token
+	iapToken.FetchTime = time.Now()
+	return token, nil
+}
+
+func makeIapConnectUrl(opts *iapTunnelOpts, port string) string {
+	query := url.Values{}
+	query.Set("project", opts.Project)
+	query.Set("zone", opts.Zone)
+	query.Set("instance", opts.Instance)
+	query.Set("interface", opts.Interface)
+	query.Set("port", port)
+	query.Set("newWebsocket", "True")
+	return (&url.URL{Scheme: "wss", Host: IapTunnelHost, Path: "/v4/connect", RawQuery: query.Encode()}).String()
+}
+
+// opens an iap tunnel to the instance's port (networkAddr's port)
+func dialIapTunnel(ctx context.Context, opts *iapTunnelOpts, networkAddr string) (net.Conn, error) {
+	_, port, err := net.SplitHostPort(networkAddr)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Zone == "" {
+		return nil, fmt.Errorf("gcp:iap is set, but gcp:zone is not")
+	}
+	tunnelOpts := *opts
+	if tunnelOpts.Project == "" {
+		tunnelOpts.Project, err = runGcloud(ctx, "config", "get-value", "project")
+		if err != nil || tunnelOpts.Project == "" {
+			return nil, fmt.Errorf("gcp:iap is set, but gcp:project is not (and gcloud has no default project)")
+		}
+	}
+	token, err := getIapAccessToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("iap access token: %w", err)
+	}
+	conndebug.Logf(ctx, "dial: iap tunnel to %s port %s (project %s, zone %s)", tunnelOpts.Instance, port, tunnelOpts.Project, tunnelOpts.Zone)
+	return connectIapTunnel(ctx, makeIapConnectUrl(&tunnelOpts, port), token, &iapAddr{instance: tunnelOpts.Instance, port: port})
+}
+
+func connectIapTunnel(ctx context.Context, connectUrl string, token string, remoteAddr *iapAddr) (net.Conn, error) {
+	dialer := websocket.Dialer{
+		Proxy:        http.ProxyFromEnvironment,
+		Subprotocols: []string{IapTunnelSubprotocol},
+	}
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+token)
+	header.Set("Origin", IapTunnelOrigin)
+	ws, resp, err := dialer.DialContext(ctx, connectUrl, header)
+	if err != nil {
+		if resp != nil {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			return nil, fmt.Errorf("iap tunnel: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+		}
+		return nil, fmt.Errorf("iap tunnel: %w", err)
+	}
+	conn := &iapConn{ws: ws, writeLock: &sync.Mutex{}, remoteAddr: remoteAddr}
+	// the tunnel is open once the relay sends the session id
+	if deadline, ok := ctx.Deadline(); ok {
+		ws.SetReadDeadline(deadline)
+	}
+	stopFn := context.AfterFunc(ctx, func() {
+		ws.SetReadDeadline(time.Now())
+	})
+	err = conn.readConnectSuccess()
+	if !stopFn() && err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		ws.Close()
+		return nil, err
+	}
+	ws.SetReadDeadline(time.Time{})
+	return conn, nil
+}
+
+// the instance (and port) the tunnel goes to
+type iapAddr struct {
+	instance string
+	port     string
+}
+
+func (a *iapAddr) Network() string {
+	return "iap"
+}
+
+func (a *iapAddr) String() string {
+	return net.JoinHostPort(a.instance, a.port)
+}
+
+// a tcp stream over the relay subprotocol.  Read is only called from one goroutine (as ssh does),
+// writes (data and acks) are serialized.
+type iapConn struct {
+	ws         *websocket.Conn
+	writeLock  *sync.Mutex
+	remoteAddr *iapAddr
+	pending    []byte
+	received   uint64
+	acked      uint64
+}
+
+// turns a close from the relay into an error with its reason
+func iapCloseError(err error) error {
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		if closeErr.Code == websocket.CloseNormalClosure {
+			return io.EOF
+		}
+		return fmt.Errorf("iap tunnel closed (%d): %s", closeErr.Code, closeErr.Text)
+	}
+	return err
+}
+
+func (c *iapConn) readFrame() (uint16, []byte, error) {
+	for {
+		msgType, msg, err := c.ws.ReadMessage()
+		if err != nil {
+			return 0, nil, iapCloseError(err)
+		}
+		if msgType != websocket.BinaryMessage {
+			continue
+		}
+		if len(msg) < 2 {
+			return 0, nil, fmt.Errorf("iap tunnel: short frame")
+		}
+		return binary.BigEndian.Uint16(msg), msg[2:], nil
+	}
+}
+
+// a length-prefixed field (of a CONNECT_SUCCESS_SID or DATA frame)
+func iapFrameField(payload []byte) ([]byte, error) {
+	if len(payload) < 4 {
+		return nil, fmt.Errorf("iap tunnel: short frame")
+	}
+	fieldLen := binary.BigEndian.Uint32(payload)
+	if uint32(len(payload)-4) < fieldLen {
+		return nil, fmt.Errorf("iap tunnel: short frame")
+	}
+	return payload[4 : 4+fieldLen], nil
+}
+
+func (c *iapConn) readConnectSuccess() error {
+	tag, payload, err := c.readFrame()
+	if err != nil {
+		return err
+	}
+	if tag != iapTag_ConnectSuccessSid {
+		return fmt.Errorf("iap tunnel: unexpected frame %#04x before connect", tag)
+	}
+	_, err = iapFrameField(payload)
+	return err
+}
+
+func (c *iapConn) writeFrame(frame []byte) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	return c.ws.WriteMessage(websocket.BinaryMessage, frame)
+}
+
+func (c *iapConn) Read(b []byte) (int, error) {
+	for len(c.pending) == 0 {
+		tag, payload, err := c.readFrame()
+		if err != nil {
+			return 0, err
+		}
+		switch tag {
+		case iapTag_Data:
+			data, err := iapFrameField(payload)
+			if err != nil {
+				return 0, err
+			}
+			c.pending = data
+			c.received += uint64(len(data))
+		case iapTag_Ack, iapTag_ReconnectSuccessAck:
+			// acks of what we sent, the relay keeps it until then (only needed to reconnect)
+		default:
+			return 0, fmt.Errorf("iap tunnel: unknown frame %#04x", tag)
+		}
+	}
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	if c.received-c.acked >= iapAckThreshold {
+		frame := make([]byte, 10)
+		binary.BigEndian.PutUint16(frame, iapTag_Ack)
+		binary.BigEndian.PutUint64(frame[2:], c.received)
+		if err := c.writeFrame(frame); err != nil {
+			return n, err
+		}
+		c.acked = c.received
+	}
+	return n, nil
+}
+
+func (c *iapConn) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		chunk := b[written:min(written+iapMaxDataFrameSize, len(b))]
+		frame := make([]byte, 6+len(chunk))
+		binary.BigEndian.PutUint16(frame, iapTag_Data)
+		binary.BigEndian.PutUint32(frame[2:], uint32(len(chunk)))
+		copy(frame[6:], chunk)
+		if err := c.writeFrame(frame); err != nil {
+			return written, iapCloseError(err)
+		}
+		written += len(chunk)
+	}
+	return written, nil
+}
+
+func (c *iapConn) Close() error {
+	return c.ws.Close()
+}
+
+func (c *iapConn) LocalAddr() net.Addr {
+	return c.ws.LocalAddr()
+}
+
+func (c *iapConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+func (c *iapConn) SetDeadline(t time.Time) error {
+	if err := c.ws.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.ws.SetWriteDeadline(t)
+}
+
+func (c *iapConn) SetReadDeadline(t time.Time) error {
+	return c.ws.SetReadDeadline(t)
+}
+
+func (c *iapConn) SetWriteDeadline(t time.Time) error {
+	return c.ws.SetWriteDeadline(t)
+}
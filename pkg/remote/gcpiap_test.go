@@ -0,0 +1,89 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// a fake iap relay that echoes the tunnel's data back, and counts the acks it gets
+func startFakeIapRelay(t *testing.T, acks chan uint64) string {
+	upgrader := websocket.Upgrader{
+		Subprotocols: []string{IapTunnelSubprotocol},
+		CheckOrigin:  func(r *http.Request) bool { return r.Header.Get("Origin") == IapTunnelOrigin },
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" || r.URL.Query().Get("instance") != "vm-1" {
+			http.Error(w, "not authorized", http.StatusForbidden)
+			return
+		}
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		sid := []byte{0, iapTag_ConnectSuccessSid, 0, 0, 0, 3, 's', 'i', 'd'}
+		ws.WriteMessage(websocket.BinaryMessage, sid)
+		for {
+			_, msg, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			switch binary.BigEndian.Uint16(msg) {
+			case iapTag_Data:
+				ws.WriteMessage(websocket.BinaryMessage, msg)
+			case iapTag_Ack:
+				acks <- binary.BigEndian.Uint64(msg[2:])
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func TestIapTunnel(t *testing.T) {
+	acks := make(chan uint64, 16)
+	relayUrl := startFakeIapRelay(t, acks)
+	ctx, cancelFn := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFn()
+	if _, err := connectIapTunnel(ctx, relayUrl+"/v4/connect?instance=vm-1", "wrong", &iapAddr{instance: "vm-1", port: "22"}); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("expected a 403 error, got %v", err)
+	}
+	conn, err := connectIapTunnel(ctx, relayUrl+"/v4/connect?instance=vm-1", "token", &iapAddr{instance: "vm-1", port: "22"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if conn.RemoteAddr().String() != "vm-1:22" {
+		t.Errorf("remote addr %q", conn.RemoteAddr())
+	}
+	// larger than a frame, and enough to be acked
+	data := bytes.Repeat([]byte("0123456789"), 5000)
+	go conn.Write(data)
+	echoed := make([]byte, len(data))
+	if _, err := io.ReadFull(conn, echoed); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(echoed, data) {
+		t.Errorf("echoed data does not match")
+	}
+	select {
+	case ack := <-acks:
+		if ack < iapAckThreshold || ack > uint64(len(data)) {
+			t.Errorf("ack of %d bytes", ack)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("received data was not acked")
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"golang.org/x/crypto/ssh"
+)
+
+// gpg-agent forwarding (ssh:forwardgpgagent) is a remote forward from the remote's standard
+// agent socket to the local agent's "extra" socket, which gpg-agent provides for remote use
+// (it can sign and decrypt, but can't change the keyring or export keys).
+
+const gpgconfTimeout = 5 * time.Second
+
+// run on the remote to find (and clear) the agent socket.  the socket directory is created
+// first, as /run/user/<uid>/gnupg is not there until gpg runs.  the old socket (left by an
+// earlier forward, or by a gpg-agent that was started on the remote) is removed so the ssh
+// server can listen on it, since most servers don't set StreamLocalBindUnlink.
+const remoteGpgSocketCmd = `if command -v gpgconf >/dev/null 2>&1; then
+gpgconf --create-socketdir >/dev/null 2>&1
+path=$(gpgconf --list-dirs agent-socket 2>/dev/null)
+fi
+if [ -z "$path" ]; then
+mkdir -p "$HOME/.gnupg" && chmod 700 "$HOME/.gnupg"
+path="$HOME/.gnupg/S.gpg-agent"
+fi
+rm -f "$path"
+echo "$path"`
+
+func runGpgconf(args ...string) (string, error) {
+	ctx, cancelFn := context.WithTimeout(context.Background(), gpgconfTimeout)
+	defer cancelFn()
+	out, err := exec.CommandContext(ctx, "gpgconf", args...).Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// the local agent's extra socket, starting gpg-agent if it isn't running
+func getLocalGpgExtraSocket() (string, error) {
+	runGpgconf("--launch", "gpg-agent")
+	path, err := runGpgconf("--list-dirs", "agent-extra-socket")
+	if err != nil || path == "" {
+		path = filepath.Join(wavebase.GetHomeDir(), ".gnupg", "S.gpg-agent.extra")
+	}
+	finfo, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("no local gpg-agent extra socket (is gpg-agent running?): %w", err)
+	}
+	if finfo.Mode()&os.ModeSocket == 0 {
+		return "", fmt.Errorf("%s is not a socket", path)
+	}
+	return path, nil
+}
+
+func prepareRemoteGpgSocket(client *ssh.Client) (string, error) {
+	path, err := runRemoteOutput(client, remoteGpgSocketCmd)
+	if err != nil {
+		return "", fmt.Errorf("cannot find the remote gpg-agent socket: %w", err)
+	}
+	if !strings.HasPrefix(path, "/") || strings.Contains(path, "\n") {
+		return "", fmt.Errorf("cannot find the remote gpg-agent socket: unexpected output %q", path)
+	}
+	return path, nil
+}
+
+// MakeGpgAgentForwardSpec returns the remote forward for gpg-agent forwarding.  the spec is
+// built directly (not parsed), so socket paths with spaces work.
+func MakeGpgAgentForwardSpec(client *ssh.Client) (*ForwardSpec, error) {
+	localPath, err := getLocalGpgExtraSocket()
+	if err != nil {
+		return nil, err
+	}
+	remotePath, err := prepareRemoteGpgSocket(client)
+	if err != nil {
+		return nil, err
+	}
+	return &ForwardSpec{
+		Spec:          wshrpc.ForwardSpec_GpgAgent,
+		ListenNetwork: "unix",
+		ListenAddr:    remotePath,
+		TargetNetwork: "unix",
+		TargetAddr:    localPath,
+	}, nil
+}
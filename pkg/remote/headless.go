@@ -0,0 +1,38 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/wavetermdev/waveterm/pkg/userinput"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// headless connections (wsh conn connect --headless) never prompt.  the password, passphrase,
+// and host key policy are given up front and are used in place of the prompts, and any other
+// prompt fails the connection with a userinput.NoPromptError (ConnErrorCode_InputRequired).
+
+type headlessContextKey struct{}
+
+// marks connCtx as headless, opts may be empty
+func WithHeadless(ctx context.Context, opts *wshrpc.ConnHeadlessOpts) (context.Context, error) {
+	if opts == nil {
+		opts = &wshrpc.ConnHeadlessOpts{}
+	}
+	switch opts.StrictHostKeyChecking {
+	case "", StrictHostKeyChecking_Yes, StrictHostKeyChecking_AcceptNew, StrictHostKeyChecking_No:
+	default:
+		return nil, fmt.Errorf("invalid headless host key policy %q (must be yes, accept-new, or no)", opts.StrictHostKeyChecking)
+	}
+	ctx = userinput.WithNoPrompt(ctx)
+	return context.WithValue(ctx, headlessContextKey{}, opts), nil
+}
+
+// the headless options for connCtx (nil if the connection isn't headless)
+func getHeadlessOpts(connCtx context.Context) *wshrpc.ConnHeadlessOpts {
+	opts, _ := connCtx.Value(headlessContextKey{}).(*wshrpc.ConnHeadlessOpts)
+	return opts
+}
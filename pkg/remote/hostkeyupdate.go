@@ -0,0 +1,359 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/wavetermdev/waveterm/pkg/audit"
+	"github.com/wavetermdev/waveterm/pkg/remote/conndebug"
+	"github.com/wavetermdev/waveterm/pkg/userinput"
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"golang.org/x/crypto/ssh"
+)
+
+// openssh's host key rotation extension (UpdateHostKeys).  after authentication the server sends
+// every host key it has ("hostkeys-00@openssh.com").  keys that are new to known_hosts must be
+// proven with a signature over the session id ("hostkeys-prove-00@openssh.com") before they are
+// added, and keys the server no longer has are removed.  like ssh, this only happens when the
+// host was verified with a plain known_hosts entry, and only the user's known_hosts files change.
+
+const (
+	hostKeysRequestType      = "hostkeys-00@openssh.com"
+	hostKeysProveRequestType = "hostkeys-prove-00@openssh.com"
+)
+
+const (
+	UpdateHostKeys_Yes = "yes"
+	UpdateHostKeys_No  = "no"
+	UpdateHostKeys_Ask = "ask"
+)
+
+// like ssh, UpdateHostKeys defaults to yes unless UserKnownHostsFile was changed
+func normalizeUpdateHostKeys(value string, defaultKnownHostsFile bool) string {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "yes", "true":
+		return UpdateHostKeys_Yes
+	case "ask":
+		return UpdateHostKeys_Ask
+	case "no", "false":
+		return UpdateHostKeys_No
+	}
+	if defaultKnownHostsFile {
+		return UpdateHostKeys_Yes
+	}
+	return UpdateHostKeys_No
+}
+
+type hostKeyUpdater struct {
+	connCtx   context.Context
+	routeCtx  context.Context
+	connName  string
+	mode      string
+	hashHosts bool
+	files     []string // the user's known_hosts files
+
+	lock     *sync.Mutex
+	hostname string
+	hostKey  ssh.PublicKey // set once the host key matched known_hosts
+	handled  bool
+}
+
+// returns nil if host keys should not be updated
+func makeHostKeyUpdater(connCtx context.Context, connName string, sshKeywords *wshrpc.ConnKeywords) *hostKeyUpdater {
+	mode := sshKeywords.SshUpdateHostKeys
+	if mode != UpdateHostKeys_Yes && mode != UpdateHostKeys_Ask {
+		return nil
+	}
+	var files []string
+	for _, filename := range sshKeywords.SshUserKnownHostsFile {
+		filePath, err := wavebase.ExpandHomeDir(filename)
+		if err != nil {
+			continue
+		}
+		files = append(files, filePath)
+	}
+	if len(files) == 0 {
+		return nil
+	}
+	return &hostKeyUpdater{
+		connCtx:   connCtx,
+		routeCtx:  userinput.WithRoute(context.Background(), userinput.RouteFromContext(connCtx)),
+		connName:  connName,
+		mode:      mode,
+		hashHosts: sshKeywords.SshHashKnownHosts,
+		files:     files,
+		lock:      &sync.Mutex{},
+	}
+}
+
+// called by the host key callback when key matched a known_hosts entry
+func (u *hostKeyUpdater) setVerifiedKey(hostname string, key ssh.PublicKey) {
+	if u == nil {
+		return
+	}
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.hostname = hostname
+	u.hostKey = key
+}
+
+// passes every global request but "hostkeys-00@openssh.com" on to the returned channel
+func (u *hostKeyUpdater) filterRequests(conn ssh.Conn, reqs <-chan *ssh.Request) <-chan *ssh.Request {
+	if u == nil {
+		return reqs
+	}
+	rtn := make(chan *ssh.Request)
+	go func() {
+		defer close(rtn)
+		for req := range reqs {
+			if req.Type != hostKeysRequestType {
+				rtn <- req
+				continue
+			}
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+			go u.handleHostKeys(conn, req.Payload)
+		}
+	}()
+	return rtn
+}
+
+func (u *hostKeyUpdater) handleHostKeys(conn ssh.Conn, payload []byte) {
+	u.lock.Lock()
+	if u.handled || u.hostKey == nil {
+		u.lock.Unlock()
+		conndebug.Logf(u.connCtx, "hostkeys: ignoring the server's host keys (already handled, or the host key was not in known_hosts)")
+		return
+	}
+	u.handled = true
+	hostname, hostKey := u.hostname, u.hostKey
+	u.lock.Unlock()
+
+	err := u.updateHostKeys(conn, hostname, hostKey, payload)
+	if err != nil {
+		log.Printf("unable to update host keys for %s: %v", hostname, err)
+		conndebug.Logf(u.connCtx, "hostkeys: not updated: %v", err)
+	}
+}
+
+func (u *hostKeyUpdater) updateHostKeys(conn ssh.Conn, hostname string, hostKey ssh.PublicKey, payload []byte) error {
+	serverKeys, err := parseHostKeysPayload(payload)
+	if err != nil {
+		return err
+	}
+	conndebug.Logf(u.connCtx, "hostkeys: server has %d host key(s)", len(serverKeys))
+	host := normalizeKnownHost(hostname)
+	plan, err := planHostKeyUpdate(u.files, host, hostKey, serverKeys)
+	if err != nil || plan == nil {
+		return err
+	}
+	if len(plan.add) > 0 {
+		signatures, err := requestHostKeyProofs(conn, plan.add)
+		if err != nil {
+			return err
+		}
+		if err := verifyHostKeyProofs(conn.SessionID(), plan.add, signatures); err != nil {
+			return err
+		}
+	}
+	if u.mode == UpdateHostKeys_Ask {
+		request := &userinput.UserInputRequest{
+			ResponseType: "confirm",
+			QueryText:    plan.describe(host),
+			Markdown:     true,
+			Title:        "Update Host Keys",
+			OkLabel:      "Update",
+			CancelLabel:  "Skip",
+			ConnName:     u.connName,
+		}
+		resp, err := userinput.GetTimedUserInput(u.routeCtx, userinput.PromptType_HostKey, request)
+		if err != nil {
+			return err
+		}
+		if !resp.Confirm {
+			conndebug.Logf(u.connCtx, "hostkeys: update skipped by the user")
+			return nil
+		}
+	}
+	for _, key := range plan.add {
+		if err := writeToKnownHosts(plan.file, makeKnownHostsLine(hostname, key, u.hashHosts), nil); err != nil {
+			return err
+		}
+		conndebug.Logf(u.connCtx, "hostkeys: added %s %s to %s", key.Type(), ssh.FingerprintSHA256(key), plan.file)
+		audit.Record(audit.Event_HostKeyAccepted, u.connName, "", fmt.Sprintf("%s %s %s (%s, UpdateHostKeys)", hostname, key.Type(), ssh.FingerprintSHA256(key), plan.file))
+	}
+	for _, entry := range plan.remove {
+		if _, err := DeleteKnownHosts([]string{entry.File}, host, entry.Fingerprint); err != nil {
+			return err
+		}
+		conndebug.Logf(u.connCtx, "hostkeys: removed %s %s from %s", entry.KeyType, entry.Fingerprint, entry.File)
+		audit.Record(audit.Event_HostKeyRemoved, u.connName, "", fmt.Sprintf("%s %s %s (%s, UpdateHostKeys)", host, entry.KeyType, entry.Fingerprint, entry.File))
+	}
+	return nil
+}
+
+// a list of key blobs.  certificates, duplicates, and key types we can't parse are skipped.
+func parseHostKeysPayload(payload []byte) ([]ssh.PublicKey, error) {
+	var rtn []ssh.PublicKey
+	seen := make(map[string]bool)
+	for len(payload) > 0 {
+		var msg struct {
+			KeyBlob []byte
+			Rest    []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(payload, &msg); err != nil {
+			return nil, fmt.Errorf("invalid %s message: %w", hostKeysRequestType, err)
+		}
+		payload = msg.Rest
+		key, err := ssh.ParsePublicKey(msg.KeyBlob)
+		if err != nil {
+			continue
+		}
+		if _, ok := key.(*ssh.Certificate); ok || seen[string(msg.KeyBlob)] {
+			continue
+		}
+		seen[string(msg.KeyBlob)] = true
+		rtn = append(rtn, key)
+	}
+	return rtn, nil
+}
+
+type hostKeyUpdatePlan struct {
+	file   string // where new keys are written
+	add    []ssh.PublicKey
+	remove []wshrpc.KnownHostEntry
+}
+
+func (plan *hostKeyUpdatePlan) describe(host string) string {
+	var lines []string
+	for _, key := range plan.add {
+		lines = append(lines, fmt.Sprintf("- add %s %s", key.Type(), ssh.FingerprintSHA256(key)))
+	}
+	for _, entry := range plan.remove {
+		lines = append(lines, fmt.Sprintf("- remove %s %s (%s:%d)", entry.KeyType, entry.Fingerprint, entry.File, entry.Line))
+	}
+	return fmt.Sprintf("The server %s has sent an updated list of its host keys. "+
+		"**Would you like to update your known_hosts files?**  \n%s", host, strings.Join(lines, "  \n"))
+}
+
+// compares the server's keys with the host's plain (not wildcard, hashed is ok) entries in the
+// files.  returns nil if nothing should change.
+func planHostKeyUpdate(files []string, host string, hostKey ssh.PublicKey, serverKeys []ssh.PublicKey) (*hostKeyUpdatePlan, error) {
+	hostKeyBlob := string(hostKey.Marshal())
+	if !slices.ContainsFunc(serverKeys, func(key ssh.PublicKey) bool { return string(key.Marshal()) == hostKeyBlob }) {
+		return nil, fmt.Errorf("the server's list of host keys does not include the key it used")
+	}
+	plan := &hostKeyUpdatePlan{}
+	knownBlobs := make(map[string]bool)
+	revokedBlobs := make(map[string]bool)
+	for _, file := range files {
+		lines, err := readKnownHostsFile(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		for _, line := range lines {
+			if line.key == nil || !line.matchesHost(host) {
+				continue
+			}
+			blob := string(line.key.Marshal())
+			switch {
+			case line.entry.Marker == KnownHostsMarker_Revoked:
+				revokedBlobs[blob] = true
+			case line.entry.Marker != "":
+				continue
+			case line.hasWildcard():
+				// the host matched a pattern for other hosts too, ssh does not update these
+				if blob == hostKeyBlob {
+					return nil, nil
+				}
+			default:
+				knownBlobs[blob] = true
+				if blob == hostKeyBlob && plan.file == "" {
+					plan.file = file
+				}
+				if !slices.ContainsFunc(serverKeys, func(key ssh.PublicKey) bool { return string(key.Marshal()) == blob }) {
+					plan.remove = append(plan.remove, line.entry)
+				}
+			}
+		}
+	}
+	if plan.file == "" {
+		// the key was found in a global known_hosts file
+		return nil, nil
+	}
+	for _, key := range serverKeys {
+		blob := string(key.Marshal())
+		if !knownBlobs[blob] && !revokedBlobs[blob] {
+			plan.add = append(plan.add, key)
+		}
+	}
+	if len(plan.add) == 0 && len(plan.remove) == 0 {
+		return nil, nil
+	}
+	return plan, nil
+}
+
+func requestHostKeyProofs(conn ssh.Conn, keys []ssh.PublicKey) ([]*ssh.Signature, error) {
+	var payload []byte
+	for _, key := range keys {
+		payload = append(payload, ssh.Marshal(struct{ KeyBlob []byte }{key.Marshal()})...)
+	}
+	ok, reply, err := conn.SendRequest(hostKeysProveRequestType, true, payload)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("the server refused to prove its host keys")
+	}
+	var signatures []*ssh.Signature
+	for len(reply) > 0 {
+		var msg struct {
+			SigBlob []byte
+			Rest    []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(reply, &msg); err != nil {
+			return nil, fmt.Errorf("invalid %s reply: %w", hostKeysProveRequestType, err)
+		}
+		reply = msg.Rest
+		sig := &ssh.Signature{}
+		if err := ssh.Unmarshal(msg.SigBlob, sig); err != nil {
+			return nil, fmt.Errorf("invalid %s signature: %w", hostKeysProveRequestType, err)
+		}
+		signatures = append(signatures, sig)
+	}
+	return signatures, nil
+}
+
+// the data the server signs with each key to prove it has the private key
+func makeHostKeyProofData(sessionId []byte, key ssh.PublicKey) []byte {
+	return ssh.Marshal(struct {
+		RequestType string
+		SessionId   []byte
+		KeyBlob     []byte
+	}{hostKeysProveRequestType, sessionId, key.Marshal()})
+}
+
+func verifyHostKeyProofs(sessionId []byte, keys []ssh.PublicKey, signatures []*ssh.Signature) error {
+	if len(signatures) != len(keys) {
+		return fmt.Errorf("the server proved %d of %d host keys", len(signatures), len(keys))
+	}
+	for idx, key := range keys {
+		if err := key.Verify(makeHostKeyProofData(sessionId, key), signatures[idx]); err != nil {
+			return fmt.Errorf("invalid proof for %s host key %s: %w", key.Type(), ssh.FingerprintSHA256(key), err)
+		}
+	}
+	return nil
+}
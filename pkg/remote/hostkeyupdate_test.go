@@ -0,0 +1,91 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestHostKeyUpdate(t *testing.T) {
+	var signers []ssh.Signer
+	for i := 0; i < 3; i++ {
+		_, key, _ := ed25519.GenerateKey(rand.Reader)
+		signer, err := ssh.NewSignerFromKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signers = append(signers, signer)
+	}
+	current, retired, added := signers[0].PublicKey(), signers[1].PublicKey(), signers[2].PublicKey()
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	lines := []string{
+		makeKnownHostsLine("example.com:22", current, true),
+		makeKnownHostsLine("example.com:22", retired, false),
+		"@revoked * " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(added))),
+	}
+	if err := os.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var payload []byte
+	for _, key := range []ssh.PublicKey{current, added, current} {
+		payload = append(payload, ssh.Marshal(struct{ KeyBlob []byte }{key.Marshal()})...)
+	}
+	serverKeys, err := parseHostKeysPayload(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(serverKeys) != 2 {
+		t.Fatalf("got %d server keys, expected 2 (duplicates are skipped)", len(serverKeys))
+	}
+
+	// the new key is revoked, so only the retired key is removed
+	plan, err := planHostKeyUpdate([]string{file}, "example.com", current, serverKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan == nil || plan.file != file || len(plan.add) != 0 || len(plan.remove) != 1 || plan.remove[0].Fingerprint != ssh.FingerprintSHA256(retired) {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+
+	lines[2] = "# not revoked"
+	if err := os.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	plan, err = planHostKeyUpdate([]string{file}, "example.com", current, serverKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan == nil || len(plan.add) != 1 || string(plan.add[0].Marshal()) != string(added.Marshal()) {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+	if _, err := planHostKeyUpdate([]string{file}, "example.com", retired, serverKeys); err == nil {
+		t.Errorf("expected an error when the server's list does not have its own key")
+	}
+	if plan, _ := planHostKeyUpdate([]string{file}, "other.com", current, serverKeys); plan != nil {
+		t.Errorf("expected no update for a host that is not in the file")
+	}
+
+	sessionId := []byte("session")
+	sig, err := signers[2].Sign(rand.Reader, makeHostKeyProofData(sessionId, added))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyHostKeyProofs(sessionId, plan.add, []*ssh.Signature{sig}); err != nil {
+		t.Errorf("valid proof: %v", err)
+	}
+	if err := verifyHostKeyProofs([]byte("other session"), plan.add, []*ssh.Signature{sig}); err == nil {
+		t.Errorf("expected a proof for another session to fail")
+	}
+	if err := verifyHostKeyProofs(sessionId, plan.add, nil); err == nil {
+		t.Errorf("expected a missing proof to fail")
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"golang.org/x/crypto/ssh/agent"
+
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+)
+
+// an ssh agent that lives in the wave process, used when there is no agent to talk to (no
+// SSH_AUTH_SOCK or IdentityAgent, or its socket is gone, which is common on windows and in fresh
+// linux sessions).  keys unlocked through a passphrase prompt (or the passphrase cache or the
+// keychain) are added to it, so later connections and every ProxyJump hop can use them without
+// decrypting the key again.  the keys are only held in memory, until wave quits or
+// "wsh conn flushpassphrases".
+
+var internalAgent = agent.NewKeyring().(agent.ExtendedAgent)
+
+// whether the internal agent is used when no agent is available (conn:internalagent, defaults on)
+func internalAgentEnabled() bool {
+	watcher := wconfig.GetWatcher()
+	if watcher == nil {
+		return true
+	}
+	enabled := watcher.GetFullConfig().Settings.ConnInternalAgent
+	return enabled == nil || *enabled
+}
+
+func isInternalAgent(agentClient agent.ExtendedAgent) bool {
+	return agentClient != nil && agentClient == internalAgent
+}
+
+// removes every key from the internal agent, returns how many there were
+func flushInternalAgent() int {
+	keys, err := internalAgent.List()
+	if err != nil {
+		return 0
+	}
+	internalAgent.RemoveAll()
+	return len(keys)
+}
@@ -0,0 +1,523 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kevinburke/ssh_config"
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"golang.org/x/crypto/ssh"
+	xknownhosts "golang.org/x/crypto/ssh/knownhosts"
+)
+
+// reading and editing known_hosts files (so a host key can be forgotten without editing the
+// files by hand).  hosts are matched like ssh: a line's comma separated patterns can have
+// wildcards and "!" negation, hashed hosts ("|1|salt|hash") are compared by hash, and a host on a
+// port other than 22 is written as "[host]:port".
+
+const KnownHostsFetchTimeout = 15 * time.Second
+
+var errHostKeyFetched = errors.New("host key fetched")
+
+// plain host keys (not certificates) in x/crypto's order
+var defaultHostKeyAlgos = []string{
+	ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+	ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSA,
+	ssh.KeyAlgoED25519,
+}
+
+type knownHostLine struct {
+	entry wshrpc.KnownHostEntry
+	key   ssh.PublicKey // nil if the line can't be parsed
+	text  string
+}
+
+// every line of a known_hosts file (comments and blank lines have no entry)
+func readKnownHostsFile(path string) ([]*knownHostLine, error) {
+	barr, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rtn []*knownHostLine
+	text := strings.TrimSuffix(string(barr), "\n")
+	if text == "" {
+		return nil, nil
+	}
+	for idx, lineText := range strings.Split(text, "\n") {
+		line := &knownHostLine{text: lineText}
+		rtn = append(rtn, line)
+		fields := strings.Fields(lineText)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		entry := wshrpc.KnownHostEntry{File: path, Line: idx + 1}
+		if strings.HasPrefix(fields[0], "@") {
+			entry.Marker = fields[0]
+			fields = fields[1:]
+		}
+		if len(fields) < 3 {
+			entry.Error = "missing fields"
+			line.entry = entry
+			continue
+		}
+		entry.Hosts = fields[0]
+		entry.Hashed = strings.HasPrefix(fields[0], "|1|")
+		entry.KeyType = fields[1]
+		keyBytes, err := base64.StdEncoding.DecodeString(fields[2])
+		if err == nil {
+			line.key, err = ssh.ParsePublicKey(keyBytes)
+		}
+		if err != nil {
+			entry.Error = fmt.Sprintf("invalid key: %v", err)
+		} else {
+			entry.Fingerprint = ssh.FingerprintSHA256(line.key)
+		}
+		line.entry = entry
+	}
+	return rtn, nil
+}
+
+func (line *knownHostLine) isEntry() bool {
+	return line.entry.File != ""
+}
+
+func matchHashedKnownHost(hashed string, host string) bool {
+	// |1|base64(salt)|base64(hmac-sha1(salt, host))
+	parts := strings.Split(hashed, "|")
+	if len(parts) != 4 || parts[1] != "1" {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	hash, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(host))
+	return hmac.Equal(mac.Sum(nil), hash)
+}
+
+// host is normalized ("host" for port 22, "[host]:port" otherwise)
+func (line *knownHostLine) matchesHost(host string) bool {
+	if !line.isEntry() || line.entry.Hosts == "" {
+		return false
+	}
+	found := false
+	for _, pattern := range strings.Split(line.entry.Hosts, ",") {
+		if strings.HasPrefix(pattern, "|1|") {
+			if matchHashedKnownHost(pattern, host) {
+				found = true
+			}
+			continue
+		}
+		negate := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		if matchSshPattern(strings.ToLower(pattern), strings.ToLower(host)) {
+			if negate {
+				return false
+			}
+			found = true
+		}
+	}
+	return found
+}
+
+func (line *knownHostLine) hasWildcard() bool {
+	for _, pattern := range strings.Split(line.entry.Hosts, ",") {
+		if !strings.HasPrefix(pattern, "|1|") && strings.ContainsAny(pattern, "*?!") {
+			return true
+		}
+	}
+	return false
+}
+
+// "host" or "host:port" to the form used in known_hosts
+func normalizeKnownHost(host string) string {
+	if strings.HasPrefix(host, "[") && strings.Contains(host, "]:") {
+		return host
+	}
+	return xknownhosts.Normalize(host)
+}
+
+// the known_hosts files to use and the host to look for.  with no connection, the ssh defaults
+// are used (and host must be given).
+func GetKnownHostsTarget(connName string, host string) ([]string, string, error) {
+	if connName == "" {
+		var files []string
+		for _, keyword := range []string{"UserKnownHostsFile", "GlobalKnownHostsFile"} {
+			for _, file := range strings.Fields(ssh_config.Default(keyword)) {
+				files = append(files, wavebase.ExpandHomeDirSafe(file))
+			}
+		}
+		if host == "" {
+			return files, "", nil
+		}
+		return files, normalizeKnownHost(host), nil
+	}
+	opts, err := ParseOpts(connName)
+	if err != nil {
+		return nil, "", err
+	}
+	sshKeywords, err := resolveSshKeywords(opts, &wshrpc.ConnKeywords{})
+	if err != nil {
+		return nil, "", err
+	}
+	files, err := getKnownHostsFiles(sshKeywords)
+	if err != nil {
+		return nil, "", err
+	}
+	if host == "" {
+		host = net.JoinHostPort(sshKeywords.SshHostName, sshKeywords.SshPort)
+	}
+	return files, normalizeKnownHost(host), nil
+}
+
+// the entries in the files (only the ones for host, if it is set).  missing files are skipped.
+func ListKnownHosts(files []string, host string) ([]wshrpc.KnownHostEntry, error) {
+	rtn := []wshrpc.KnownHostEntry{}
+	for _, file := range files {
+		lines, err := readKnownHostsFile(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		for _, line := range lines {
+			if !line.isEntry() || (host != "" && !line.matchesHost(host)) {
+				continue
+			}
+			rtn = append(rtn, line.entry)
+		}
+	}
+	return rtn, nil
+}
+
+// removes the host's keys (like "ssh-keygen -R", a line with several hosts is removed).
+// @cert-authority and @revoked lines are kept, and so are lines with wildcards (they are for
+// other hosts too).  if fingerprint is set only that key is removed.  the old file is saved with
+// a ".old" suffix.  returns the number of lines removed.
+func DeleteKnownHosts(files []string, host string, fingerprint string) (int, error) {
+	if host == "" {
+		return 0, fmt.Errorf("a host is required")
+	}
+	numRemoved := 0
+	for _, file := range files {
+		lines, err := readKnownHostsFile(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return numRemoved, err
+		}
+		var keep []string
+		fileRemoved := 0
+		for _, line := range lines {
+			if line.entry.Marker == "" && !line.hasWildcard() && line.matchesHost(host) && (fingerprint == "" || line.entry.Fingerprint == fingerprint) {
+				fileRemoved++
+				continue
+			}
+			keep = append(keep, line.text)
+		}
+		if fileRemoved == 0 {
+			continue
+		}
+		if err := rewriteKnownHostsFile(file, keep); err != nil {
+			return numRemoved, err
+		}
+		numRemoved += fileRemoved
+	}
+	return numRemoved, nil
+}
+
+func rewriteKnownHostsFile(file string, lines []string) error {
+	finfo, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	oldContents, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(file+".old", oldContents, finfo.Mode().Perm()); err != nil {
+		return fmt.Errorf("cannot back up %s: %w", file, err)
+	}
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.WriteString(line + "\n")
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".tmp*")
+	if err != nil {
+		return err
+	}
+	_, err = tmpFile.Write(buf.Bytes())
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpFile.Name(), finfo.Mode().Perm())
+	}
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), file)
+	}
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return fmt.Errorf("cannot write %s: %w", file, err)
+	}
+	return nil
+}
+
+const KnownHostsMarker_CertAuthority = "@cert-authority"
+const KnownHostsMarker_Revoked = "@revoked"
+
+// HostKeyRevokedError is returned when a host key is marked @revoked in known_hosts (for a host
+// certificate, the certificate, its key, or the authority that signed it).  like ssh, a revoked
+// key is refused for every host, without asking.
+type HostKeyRevokedError struct {
+	Hostname    string
+	KeyType     string
+	Fingerprint string
+	File        string
+	Line        int
+	IsCA        bool // the revoked key is the authority that signed the host's certificate
+}
+
+func (e *HostKeyRevokedError) Error() string {
+	what := "host key"
+	if e.IsCA {
+		what = "certificate authority (which signed the host certificate)"
+	}
+	return fmt.Sprintf("the %s %s of %s (%s) is revoked in %s:%d", e.KeyType, what, e.Hostname, e.Fingerprint, e.File, e.Line)
+}
+
+// the parseable lines of the files (unreadable files are skipped)
+func readKnownHostsKeys(files []string) []*knownHostLine {
+	var rtn []*knownHostLine
+	for _, file := range files {
+		lines, _ := readKnownHostsFile(file)
+		for _, line := range lines {
+			if line.key != nil {
+				rtn = append(rtn, line)
+			}
+		}
+	}
+	return rtn
+}
+
+func isSameKey(a ssh.PublicKey, b ssh.PublicKey) bool {
+	return bytes.Equal(a.Marshal(), b.Marshal())
+}
+
+// returns a *HostKeyRevokedError if key is revoked
+func checkRevokedHostKey(lines []*knownHostLine, hostname string, key ssh.PublicKey) error {
+	checkKeys := []ssh.PublicKey{key}
+	cert, isCert := key.(*ssh.Certificate)
+	if isCert {
+		checkKeys = append(checkKeys, cert.Key, cert.SignatureKey)
+	}
+	for _, line := range lines {
+		if line.entry.Marker != KnownHostsMarker_Revoked {
+			continue
+		}
+		for idx, checkKey := range checkKeys {
+			if !isSameKey(line.key, checkKey) {
+				continue
+			}
+			return &HostKeyRevokedError{
+				Hostname:    hostname,
+				KeyType:     checkKey.Type(),
+				Fingerprint: ssh.FingerprintSHA256(checkKey),
+				File:        line.entry.File,
+				Line:        line.entry.Line,
+				IsCA:        isCert && idx == 2,
+			}
+		}
+	}
+	return nil
+}
+
+// finds the @cert-authority line for host that signed cert, and checks that cert is a valid
+// host certificate for host (principals, validity period, and signature).  the line is nil if
+// no authority in known_hosts signed it.
+func checkHostCert(lines []*knownHostLine, hostname string, cert *ssh.Certificate) (*knownHostLine, error) {
+	host := normalizeKnownHost(hostname)
+	var caLine *knownHostLine
+	for _, line := range lines {
+		if line.entry.Marker == KnownHostsMarker_CertAuthority && isSameKey(line.key, cert.SignatureKey) && line.matchesHost(host) {
+			caLine = line
+			break
+		}
+	}
+	if caLine == nil {
+		return nil, nil
+	}
+	if cert.CertType != ssh.HostCert {
+		return caLine, fmt.Errorf("not a host certificate")
+	}
+	// like ssh, the principal is the hostname without the port
+	principal, _, err := net.SplitHostPort(hostname)
+	if err != nil {
+		principal = hostname
+	}
+	checker := &ssh.CertChecker{}
+	if err := checker.CheckCert(principal, cert); err != nil {
+		return caLine, err
+	}
+	return caLine, nil
+}
+
+// compares a host key with the known_hosts entries for host
+func CheckKnownHostKey(files []string, host string, key ssh.PublicKey) (string, []wshrpc.KnownHostEntry, error) {
+	entries, err := ListKnownHosts(files, host)
+	if err != nil {
+		return "", nil, err
+	}
+	fingerprint := ssh.FingerprintSHA256(key)
+	status := wshrpc.KnownHostStatus_Unknown
+	for _, entry := range entries {
+		switch {
+		case entry.Error != "" || entry.Marker == KnownHostsMarker_CertAuthority:
+			continue
+		case entry.Marker == KnownHostsMarker_Revoked:
+			if entry.Fingerprint == fingerprint {
+				return wshrpc.KnownHostStatus_Revoked, entries, nil
+			}
+		case entry.Fingerprint == fingerprint:
+			status = wshrpc.KnownHostStatus_Known
+		case status != wshrpc.KnownHostStatus_Known:
+			status = wshrpc.KnownHostStatus_Changed
+		}
+	}
+	return status, entries, nil
+}
+
+func hostKeyAlgorithmsForKeyType(keyType string) []string {
+	if keyType == ssh.KeyAlgoRSA {
+		return []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+	}
+	return []string{keyType}
+}
+
+// connects to the connection's host (through its jump hosts) far enough to get its host key,
+// without checking it or authenticating.  key types already in known_hosts are asked for first
+// (like ssh) so a host with several keys isn't reported as changed, and host certificates
+// aren't asked for.
+func FetchHostKey(ctx context.Context, connName string) (string, ssh.PublicKey, error) {
+	opts, err := ParseOpts(connName)
+	if err != nil {
+		return "", nil, err
+	}
+	sshKeywords, err := resolveSshKeywords(opts, &wshrpc.ConnKeywords{})
+	if err != nil {
+		return "", nil, err
+	}
+	networkAddr := net.JoinHostPort(sshKeywords.SshHostName, sshKeywords.SshPort)
+	var hostKeyAlgos []string
+	if files, err := getKnownHostsFiles(sshKeywords); err == nil {
+		entries, _ := ListKnownHosts(files, normalizeKnownHost(networkAddr))
+		for _, entry := range entries {
+			if entry.Marker == "" && entry.Error == "" {
+				hostKeyAlgos = append(hostKeyAlgos, hostKeyAlgorithmsForKeyType(entry.KeyType)...)
+			}
+		}
+	}
+	for _, algo := range defaultHostKeyAlgos {
+		if !slices.Contains(hostKeyAlgos, algo) {
+			hostKeyAlgos = append(hostKeyAlgos, algo)
+		}
+	}
+	var jumpClient *ssh.Client
+	defer func() {
+		if jumpClient != nil {
+			ReleaseClient(jumpClient)
+		}
+	}()
+	var jumpNum int32
+	for _, proxyName := range sshKeywords.SshProxyJump {
+		proxyOpts, err := ParseOpts(proxyName)
+		if err != nil {
+			return "", nil, err
+		}
+		jumpNum++
+		// the reference to the previous hop is handed over
+		jumpClient, jumpNum, err = ConnectToClient(ctx, proxyOpts, jumpClient, jumpNum, &wshrpc.ConnKeywords{})
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	var conn net.Conn
+	if jumpClient == nil {
+		dialer := net.Dialer{Timeout: KnownHostsFetchTimeout}
+		conn, err = dialer.DialContext(ctx, sshDialNetwork(sshKeywords.SshAddressFamily), networkAddr)
+	} else {
+		conn, err = jumpClient.DialContext(ctx, "tcp", networkAddr)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	defer conn.Close()
+	var hostKey ssh.PublicKey
+	clientConfig := &ssh.ClientConfig{
+		User: sshKeywords.SshUser,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			hostKey = key
+			return errHostKeyFetched
+		},
+		HostKeyAlgorithms: hostKeyAlgos,
+		Timeout:           KnownHostsFetchTimeout,
+	}
+	stopFn := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stopFn()
+	conn.SetDeadline(time.Now().Add(KnownHostsFetchTimeout))
+	_, _, _, err = ssh.NewClientConn(conn, networkAddr, clientConfig)
+	if hostKey == nil {
+		if err == nil {
+			err = fmt.Errorf("no host key received")
+		}
+		return "", nil, err
+	}
+	return normalizeKnownHost(networkAddr), hostKey, nil
+}
+
+// fetches the connection's host key and compares it with its known_hosts files
+func VerifyKnownHost(ctx context.Context, connName string) (*wshrpc.KnownHostsVerifyResult, error) {
+	files, _, err := GetKnownHostsTarget(connName, "")
+	if err != nil {
+		return nil, err
+	}
+	host, key, err := FetchHostKey(ctx, connName)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get the host key for %q: %w", connName, err)
+	}
+	status, entries, err := CheckKnownHostKey(files, host, key)
+	if err != nil {
+		return nil, err
+	}
+	return &wshrpc.KnownHostsVerifyResult{
+		Host:        host,
+		KeyType:     key.Type(),
+		Fingerprint: ssh.FingerprintSHA256(key),
+		Status:      status,
+		Entries:     entries,
+	}, nil
+}
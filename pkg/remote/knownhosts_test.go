@@ -0,0 +1,178 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"golang.org/x/crypto/ssh"
+)
+
+func makeTestHostKey(t *testing.T) ssh.PublicKey {
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestKnownHosts(t *testing.T) {
+	keyA, keyB, keyC := makeTestHostKey(t), makeTestHostKey(t), makeTestHostKey(t)
+	lines := []string{
+		"# comment",
+		makeKnownHostsLine("a.example.com:22", keyA, false),
+		makeKnownHostsLine("a.example.com:2222", keyB, false),
+		makeKnownHostsLine("hashed.example.com:22", keyA, true),
+		"*.example.com,!skip.example.com " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(keyC))),
+		"@revoked revoked.example.com " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(keyB))),
+		"broken.example.com ssh-ed25519 notbase64!",
+	}
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	files := []string{file, filepath.Join(t.TempDir(), "missing")}
+
+	all, err := ListKnownHosts(files, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 6 {
+		t.Fatalf("got %d entries, expected 6", len(all))
+	}
+	if all[5].Error == "" {
+		t.Errorf("broken line should have an error")
+	}
+	numEntries := map[string]int{
+		"a.example.com":        2, // its own line and the wildcard
+		"[a.example.com]:2222": 1,
+		"hashed.example.com":   2,
+		"skip.example.com":     0,
+		"revoked.example.com":  2,
+		"other.com":            0,
+	}
+	for host, expected := range numEntries {
+		entries, err := ListKnownHosts(files, host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != expected {
+			t.Errorf("%s: got %d entries, expected %d", host, len(entries), expected)
+		}
+	}
+
+	statuses := []struct {
+		host   string
+		key    ssh.PublicKey
+		status string
+	}{
+		{"a.example.com", keyA, wshrpc.KnownHostStatus_Known},
+		{"a.example.com", keyC, wshrpc.KnownHostStatus_Known},
+		{"a.example.com", keyB, wshrpc.KnownHostStatus_Changed},
+		{"hashed.example.com", keyA, wshrpc.KnownHostStatus_Known},
+		{"revoked.example.com", keyB, wshrpc.KnownHostStatus_Revoked},
+		{"other.com", keyA, wshrpc.KnownHostStatus_Unknown},
+	}
+	for _, test := range statuses {
+		status, _, err := CheckKnownHostKey(files, test.host, test.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != test.status {
+			t.Errorf("%s: got %q, expected %q", test.host, status, test.status)
+		}
+	}
+
+	// only the hashed line matches, the wildcard line has another key
+	numRemoved, err := DeleteKnownHosts(files, "hashed.example.com", ssh.FingerprintSHA256(keyA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if numRemoved != 1 {
+		t.Errorf("removed %d entries, expected 1", numRemoved)
+	}
+	if _, err := os.Stat(file + ".old"); err != nil {
+		t.Errorf("no backup: %v", err)
+	}
+	// the revoked and wildcard lines are kept
+	if numRemoved, _ := DeleteKnownHosts(files, "revoked.example.com", ""); numRemoved != 0 {
+		t.Errorf("removed %d entries for revoked.example.com, expected 0", numRemoved)
+	}
+	if numRemoved, _ := DeleteKnownHosts(files, "a.example.com", ""); numRemoved != 1 {
+		t.Errorf("removed %d entries for a.example.com, expected 1", numRemoved)
+	}
+	remaining, err := ListKnownHosts(files, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remaining) != 4 {
+		t.Errorf("%d entries remain, expected 4", len(remaining))
+	}
+	contents, _ := os.ReadFile(file)
+	if !strings.HasPrefix(string(contents), "# comment\n") || !strings.Contains(string(contents), "@revoked") || !strings.Contains(string(contents), "*.example.com") {
+		t.Errorf("comments, @revoked, and wildcard lines should be kept:\n%s", contents)
+	}
+}
+
+func TestKnownHostsMarkers(t *testing.T) {
+	_, caPriv, _ := ed25519.GenerateKey(rand.Reader)
+	caSigner, err := ssh.NewSignerFromKey(caPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, revokedKey := makeTestHostKey(t), makeTestHostKey(t)
+	makeCert := func(key ssh.PublicKey, principal string) *ssh.Certificate {
+		cert := &ssh.Certificate{
+			Key:             key,
+			CertType:        ssh.HostCert,
+			ValidPrincipals: []string{principal},
+			ValidBefore:     ssh.CertTimeInfinity,
+		}
+		if err := cert.SignCert(rand.Reader, caSigner); err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+	lines := []string{
+		"@cert-authority *.example.com " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(caSigner.PublicKey()))),
+		"@revoked * " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(revokedKey))),
+	}
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	markerLines := readKnownHostsKeys([]string{file})
+
+	cert := makeCert(hostKey, "a.example.com")
+	if caLine, err := checkHostCert(markerLines, "a.example.com:22", cert); caLine == nil || err != nil {
+		t.Errorf("certificate should be valid (err %v)", err)
+	}
+	if caLine, err := checkHostCert(markerLines, "b.example.com:22", cert); caLine == nil || err == nil {
+		t.Errorf("certificate for another principal should be invalid")
+	}
+	if caLine, _ := checkHostCert(markerLines, "other.com:22", makeCert(hostKey, "other.com")); caLine != nil {
+		t.Errorf("the authority doesn't cover other.com")
+	}
+	if err := checkRevokedHostKey(markerLines, "a.example.com:22", cert); err != nil {
+		t.Errorf("certificate is not revoked: %v", err)
+	}
+	var revokedErr *HostKeyRevokedError
+	err = checkRevokedHostKey(markerLines, "other.com:22", revokedKey)
+	if !errors.As(err, &revokedErr) || revokedErr.IsCA || revokedErr.Line != 2 {
+		t.Errorf("expected a revoked error, got %v", err)
+	}
+	// a certificate is revoked through the key it certifies
+	err = checkRevokedHostKey(markerLines, "a.example.com:22", makeCert(revokedKey, "a.example.com"))
+	if GetConnErrorCode(err) != wshrpc.ConnErrorCode_HostKeyRevoked {
+		t.Errorf("expected a revoked certificate key, got %v", err)
+	}
+}
@@ -0,0 +1,356 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// RevokedHostKeys (in ssh_config) names a file of revoked host keys, either an OpenSSH key
+// revocation list (KRL, see PROTOCOL.krl and "ssh-keygen -k") or a list of public keys.
+// like ssh, a host key in the file is refused for every host, and so is a host certificate
+// that is revoked, whose key is revoked, or whose authority is revoked.
+
+const krlMagic = "SSHKRL\n\x00"
+const krlFormatVersion = 1
+
+const (
+	krlSection_Certificates      = 1
+	krlSection_ExplicitKey       = 2
+	krlSection_FingerprintSha1   = 3
+	krlSection_Signature         = 4
+	krlSection_FingerprintSha256 = 5
+)
+
+const (
+	krlCertSection_SerialList   = 0x20
+	krlCertSection_SerialRange  = 0x21
+	krlCertSection_SerialBitmap = 0x22
+	krlCertSection_KeyId        = 0x23
+	krlCertSection_Extension    = 0x24
+)
+
+// HostKeyKRLRevokedError is returned when a host key is listed in the RevokedHostKeys file.
+// unlike a changed key, this means the key was revoked by whoever manages the file.
+type HostKeyKRLRevokedError struct {
+	Hostname    string
+	KeyType     string
+	Fingerprint string
+	File        string
+	Reason      string // what matched, like "key", "sha256 fingerprint", or "certificate serial 12"
+}
+
+func (e *HostKeyKRLRevokedError) Error() string {
+	return fmt.Sprintf("the %s host key of %s (%s) has been revoked by an administrator (%s listed in RevokedHostKeys file %s)", e.KeyType, e.Hostname, e.Fingerprint, e.Reason, e.File)
+}
+
+type krlSerialRange struct {
+	Min uint64
+	Max uint64
+}
+
+type krlSerialBitmap struct {
+	Offset uint64
+	Bits   *big.Int
+}
+
+type krlCertSection struct {
+	CaKey   []byte // the authority's key blob, empty for certificates from any authority
+	Serials map[uint64]bool
+	Ranges  []krlSerialRange
+	Bitmaps []krlSerialBitmap
+	KeyIds  map[string]bool
+}
+
+type revokedKeyList struct {
+	Keys         map[string]bool // plain key blobs
+	Sha1         map[string]bool // sha1 of the key blobs
+	Sha256       map[string]bool
+	CertSections []*krlCertSection
+}
+
+func makeRevokedKeyList() *revokedKeyList {
+	return &revokedKeyList{Keys: make(map[string]bool), Sha1: make(map[string]bool), Sha256: make(map[string]bool)}
+}
+
+type krlReader struct {
+	data []byte
+	err  error
+}
+
+func (r *krlReader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.data) < n {
+		r.err = errors.New("truncated")
+		r.data = nil
+		return nil
+	}
+	rtn := r.data[:n]
+	r.data = r.data[n:]
+	return rtn
+}
+
+func (r *krlReader) byte() byte {
+	b := r.take(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *krlReader) uint32() uint32 {
+	b := r.take(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *krlReader) uint64() uint64 {
+	b := r.take(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func (r *krlReader) string() []byte {
+	n := r.uint32()
+	if r.err != nil {
+		return nil
+	}
+	if uint64(n) > uint64(len(r.data)) {
+		r.err = errors.New("truncated")
+		return nil
+	}
+	return r.take(int(n))
+}
+
+func (r *krlReader) done() bool {
+	return r.err != nil || len(r.data) == 0
+}
+
+// parses a binary KRL (signatures aren't verified, ssh doesn't either)
+func parseKRL(data []byte) (*revokedKeyList, error) {
+	if !bytes.HasPrefix(data, []byte(krlMagic)) {
+		return nil, errors.New("not a KRL")
+	}
+	r := &krlReader{data: data[len(krlMagic):]}
+	if version := r.uint32(); r.err == nil && version != krlFormatVersion {
+		return nil, fmt.Errorf("unsupported KRL format version %d", version)
+	}
+	r.uint64() // krl version
+	r.uint64() // generated date
+	r.uint64() // flags
+	r.string() // reserved
+	r.string() // comment
+	krl := makeRevokedKeyList()
+	for !r.done() {
+		sectionType := r.byte()
+		sectionData := r.string()
+		if r.err != nil {
+			break
+		}
+		sr := &krlReader{data: sectionData}
+		switch sectionType {
+		case krlSection_Certificates:
+			certSection, err := parseKRLCertSection(sr)
+			if err != nil {
+				return nil, err
+			}
+			krl.CertSections = append(krl.CertSections, certSection)
+		case krlSection_ExplicitKey:
+			for !sr.done() {
+				krl.Keys[string(sr.string())] = true
+			}
+		case krlSection_FingerprintSha1:
+			for !sr.done() {
+				krl.Sha1[string(sr.string())] = true
+			}
+		case krlSection_FingerprintSha256:
+			for !sr.done() {
+				krl.Sha256[string(sr.string())] = true
+			}
+		case krlSection_Signature:
+		default:
+			return nil, fmt.Errorf("unsupported KRL section type %d", sectionType)
+		}
+		if sr.err != nil {
+			return nil, fmt.Errorf("invalid KRL section (type %d): %w", sectionType, sr.err)
+		}
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("invalid KRL: %w", r.err)
+	}
+	return krl, nil
+}
+
+func parseKRLCertSection(r *krlReader) (*krlCertSection, error) {
+	rtn := &krlCertSection{Serials: make(map[uint64]bool), KeyIds: make(map[string]bool)}
+	rtn.CaKey = r.string()
+	r.string() // reserved
+	for !r.done() {
+		subType := r.byte()
+		sr := &krlReader{data: r.string()}
+		if r.err != nil {
+			break
+		}
+		switch subType {
+		case krlCertSection_SerialList:
+			for !sr.done() {
+				rtn.Serials[sr.uint64()] = true
+			}
+		case krlCertSection_SerialRange:
+			rtn.Ranges = append(rtn.Ranges, krlSerialRange{Min: sr.uint64(), Max: sr.uint64()})
+		case krlCertSection_SerialBitmap:
+			offset := sr.uint64()
+			bits := new(big.Int).SetBytes(sr.string())
+			rtn.Bitmaps = append(rtn.Bitmaps, krlSerialBitmap{Offset: offset, Bits: bits})
+		case krlCertSection_KeyId:
+			for !sr.done() {
+				rtn.KeyIds[string(sr.string())] = true
+			}
+		case krlCertSection_Extension:
+		default:
+			return nil, fmt.Errorf("unsupported KRL certificate section type %d", subType)
+		}
+		if sr.err != nil {
+			return nil, fmt.Errorf("invalid KRL certificate section (type %d): %w", subType, sr.err)
+		}
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("invalid KRL certificate section: %w", r.err)
+	}
+	return rtn, nil
+}
+
+// a file that isn't a KRL is a list of public keys (one per line, like authorized_keys)
+func parseRevokedKeysText(data []byte) *revokedKeyList {
+	krl := makeRevokedKeyList()
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			continue
+		}
+		if cert, ok := key.(*ssh.Certificate); ok {
+			key = cert.Key
+		}
+		krl.Keys[string(key.Marshal())] = true
+	}
+	return krl
+}
+
+func readRevokedKeysFile(file string) (*revokedKeyList, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte(krlMagic)) {
+		return parseKRL(data)
+	}
+	return parseRevokedKeysText(data), nil
+}
+
+func (krl *revokedKeyList) keyRevokedReason(key ssh.PublicKey) string {
+	blob := key.Marshal()
+	if krl.Keys[string(blob)] {
+		return "key"
+	}
+	sha1Sum := sha1.Sum(blob)
+	if krl.Sha1[string(sha1Sum[:])] {
+		return "sha1 fingerprint"
+	}
+	sha256Sum := sha256.Sum256(blob)
+	if krl.Sha256[string(sha256Sum[:])] {
+		return "sha256 fingerprint"
+	}
+	return ""
+}
+
+func (krl *revokedKeyList) certRevokedReason(cert *ssh.Certificate) string {
+	caBlob := cert.SignatureKey.Marshal()
+	for _, section := range krl.CertSections {
+		if len(section.CaKey) > 0 && !bytes.Equal(section.CaKey, caBlob) {
+			continue
+		}
+		if section.KeyIds[cert.KeyId] {
+			return fmt.Sprintf("certificate key id %q", cert.KeyId)
+		}
+		// like ssh, serial 0 (legacy certificates) is never revoked by serial
+		if cert.Serial == 0 {
+			continue
+		}
+		revoked := section.Serials[cert.Serial]
+		for _, serialRange := range section.Ranges {
+			revoked = revoked || (cert.Serial >= serialRange.Min && cert.Serial <= serialRange.Max)
+		}
+		for _, bitmap := range section.Bitmaps {
+			if cert.Serial >= bitmap.Offset && cert.Serial-bitmap.Offset < uint64(bitmap.Bits.BitLen()) {
+				revoked = revoked || bitmap.Bits.Bit(int(cert.Serial-bitmap.Offset)) == 1
+			}
+		}
+		if revoked {
+			return fmt.Sprintf("certificate serial %d", cert.Serial)
+		}
+	}
+	return ""
+}
+
+// returns what revoked the key ("" if it isn't revoked).  for a certificate, the certificate,
+// its key, and its authority are checked.
+func (krl *revokedKeyList) revokedReason(key ssh.PublicKey) string {
+	cert, isCert := key.(*ssh.Certificate)
+	if !isCert {
+		return krl.keyRevokedReason(key)
+	}
+	if reason := krl.certRevokedReason(cert); reason != "" {
+		return reason
+	}
+	if reason := krl.keyRevokedReason(cert.Key); reason != "" {
+		return reason
+	}
+	if reason := krl.keyRevokedReason(cert.SignatureKey); reason != "" {
+		return "certificate authority " + reason
+	}
+	return ""
+}
+
+// checks key against the RevokedHostKeys file.  like ssh, a file that can't be read or parsed
+// fails the connection.
+func checkKRLRevokedHostKey(file string, hostname string, key ssh.PublicKey) error {
+	krl, err := readRevokedKeysFile(file)
+	if err != nil {
+		return fmt.Errorf("cannot check the host key against RevokedHostKeys file %s: %w", file, err)
+	}
+	reason := krl.revokedReason(key)
+	if reason == "" {
+		return nil
+	}
+	return &HostKeyKRLRevokedError{
+		Hostname:    hostname,
+		KeyType:     key.Type(),
+		Fingerprint: ssh.FingerprintSHA256(key),
+		File:        file,
+		Reason:      reason,
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func appendKRLString(buf []byte, s []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(s)))
+	return append(buf, s...)
+}
+
+func appendKRLSection(buf []byte, sectionType byte, data []byte) []byte {
+	return appendKRLString(append(buf, sectionType), data)
+}
+
+func TestRevokedHostKeys(t *testing.T) {
+	_, caPriv, _ := ed25519.GenerateKey(rand.Reader)
+	caSigner, err := ssh.NewSignerFromKey(caPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	explicitKey, sha256Key, goodKey := makeTestHostKey(t), makeTestHostKey(t), makeTestHostKey(t)
+	makeCert := func(serial uint64, keyId string) *ssh.Certificate {
+		cert := &ssh.Certificate{Key: goodKey, Serial: serial, KeyId: keyId, CertType: ssh.HostCert, ValidBefore: ssh.CertTimeInfinity}
+		if err := cert.SignCert(rand.Reader, caSigner); err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+
+	krl := []byte(krlMagic)
+	krl = binary.BigEndian.AppendUint32(krl, krlFormatVersion)
+	krl = binary.BigEndian.AppendUint64(krl, 1) // krl version
+	krl = binary.BigEndian.AppendUint64(krl, 0) // generated date
+	krl = binary.BigEndian.AppendUint64(krl, 0) // flags
+	krl = appendKRLString(krl, nil)
+	krl = appendKRLString(krl, []byte("test krl"))
+	krl = appendKRLSection(krl, krlSection_ExplicitKey, appendKRLString(nil, explicitKey.Marshal()))
+	sum := sha256.Sum256(sha256Key.Marshal())
+	krl = appendKRLSection(krl, krlSection_FingerprintSha256, appendKRLString(nil, sum[:]))
+	certSection := appendKRLString(nil, caSigner.PublicKey().Marshal())
+	certSection = appendKRLString(certSection, nil)
+	certSection = appendKRLSection(certSection, krlCertSection_SerialList, binary.BigEndian.AppendUint64(nil, 5))
+	certSection = appendKRLSection(certSection, krlCertSection_SerialRange, binary.BigEndian.AppendUint64(binary.BigEndian.AppendUint64(nil, 10), 20))
+	// serials 100 and 102
+	certSection = appendKRLSection(certSection, krlCertSection_SerialBitmap, appendKRLString(binary.BigEndian.AppendUint64(nil, 100), []byte{0x05}))
+	certSection = appendKRLSection(certSection, krlCertSection_KeyId, appendKRLString(nil, []byte("badhost")))
+	krl = appendKRLSection(krl, krlSection_Certificates, certSection)
+
+	dir := t.TempDir()
+	krlFile := filepath.Join(dir, "revoked.krl")
+	if err := os.WriteFile(krlFile, krl, 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		key     ssh.PublicKey
+		revoked bool
+	}{
+		{"explicit key", explicitKey, true},
+		{"sha256", sha256Key, true},
+		{"good key", goodKey, false},
+		{"serial list", makeCert(5, "host"), true},
+		{"serial range", makeCert(15, "host"), true},
+		{"serial bitmap", makeCert(102, "host"), true},
+		{"serial not in bitmap", makeCert(101, "host"), false},
+		{"key id", makeCert(0, "badhost"), true},
+		{"good cert", makeCert(30, "host"), false},
+	}
+	for _, test := range tests {
+		err := checkKRLRevokedHostKey(krlFile, "host.example.com:22", test.key)
+		var krlErr *HostKeyKRLRevokedError
+		if errors.As(err, &krlErr) != test.revoked {
+			t.Errorf("%s: expected revoked=%v, got %v", test.name, test.revoked, err)
+		}
+	}
+	if err := checkKRLRevokedHostKey(filepath.Join(dir, "missing"), "host.example.com:22", goodKey); err == nil {
+		t.Errorf("a missing file should fail the check")
+	}
+	if err := os.WriteFile(krlFile, krl[:len(krl)-3], 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkKRLRevokedHostKey(krlFile, "host.example.com:22", goodKey); err == nil {
+		t.Errorf("a truncated KRL should fail the check")
+	}
+
+	// a plain list of keys
+	listFile := filepath.Join(dir, "revoked_keys")
+	contents := "# revoked\n" + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(explicitKey))) + " old-server\n"
+	if err := os.WriteFile(listFile, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkKRLRevokedHostKey(listFile, "host.example.com:22", explicitKey); GetConnErrorCode(err) != "hostkey-krl-revoked" {
+		t.Errorf("expected the listed key to be revoked, got %v", err)
+	}
+	if err := checkKRLRevokedHostKey(listFile, "host.example.com:22", goodKey); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
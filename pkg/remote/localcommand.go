@@ -0,0 +1,88 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"context"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/remote/conndebug"
+	"github.com/wavetermdev/waveterm/pkg/trimquotes"
+	"github.com/wavetermdev/waveterm/pkg/util/shellutil"
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// LocalCommand runs on this machine once a connection is made, if PermitLocalCommand is set
+// (ssh:localcommand and ssh:permitlocalcommand in connections.json take priority).  like ssh,
+// it runs with the user's shell and the connection waits for it, but a failure is only logged.
+
+const MaxLocalCommandLogLen = 4096
+
+// the LocalCommand for a host, with its tokens expanded ("" if there is none or it isn't permitted)
+func GetLocalCommand(connName string, opts *SSHOpts, remoteUser string) string {
+	sshConfig, err := WaveSshConfigUserSettings().Resolve(opts.SSHHost, opts.SSHUser)
+	if err != nil {
+		sshConfig = nil
+	}
+	connSettings := wconfig.ReadFullConfig().Connections[connName]
+	return expandLocalCommand(sshConfig, connSettings, opts, remoteUser)
+}
+
+func expandLocalCommand(sshConfig *SshConfigResult, connSettings wshrpc.ConnKeywords, opts *SSHOpts, remoteUser string) string {
+	var permit bool
+	var cmdStr, hostName, port string
+	if sshConfig != nil {
+		permit = strings.ToLower(trimquotes.TryTrimQuotes(sshConfig.Get("PermitLocalCommand"))) == "yes"
+		cmdStr = trimquotes.TryTrimQuotes(strings.TrimSpace(sshConfig.Get("LocalCommand")))
+		if sshConfig.IsSet("HostName") {
+			hostName = trimquotes.TryTrimQuotes(sshConfig.Get("HostName"))
+		}
+		port = trimquotes.TryTrimQuotes(sshConfig.Get("Port"))
+	}
+	if connSettings.SshPermitLocalCommand != nil {
+		permit = *connSettings.SshPermitLocalCommand
+	}
+	if connSettings.SshLocalCommand != "" {
+		cmdStr = connSettings.SshLocalCommand
+	}
+	if !permit || cmdStr == "" || strings.ToLower(cmdStr) == "none" {
+		return ""
+	}
+	if hostName == "" {
+		hostName = opts.SSHHost
+	}
+	if opts.SSHPort != 0 {
+		port = strconv.Itoa(opts.SSHPort)
+	} else if port == "" {
+		port = "22"
+	}
+	localUser, _ := userCurrent()
+	return makeSshTokenReplacer(hostName, opts.SSHHost, port, remoteUser, localUser).Replace(cmdStr)
+}
+
+// runs an expanded LocalCommand for a connection (in ctx), logging its output
+func RunLocalCommand(ctx context.Context, cmdStr string) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd.exe", "/C", cmdStr)
+	} else {
+		cmd = exec.CommandContext(ctx, shellutil.DetectLocalShellPath(), "-c", cmdStr)
+	}
+	conndebug.Logf(ctx, "localcommand: running %q", cmdStr)
+	output, err := cmd.CombinedOutput()
+	if len(output) > 0 {
+		outStr := strings.ToValidUTF8(string(output[:min(len(output), MaxLocalCommandLogLen)]), "")
+		conndebug.Logf(ctx, "localcommand: output: %s", strings.TrimSpace(outStr))
+	}
+	if err != nil {
+		conndebug.Logf(ctx, "localcommand: failed: %v", err)
+		return err
+	}
+	conndebug.Logf(ctx, "localcommand: done")
+	return nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+func TestExpandLocalCommand(t *testing.T) {
+	dir := t.TempDir()
+	config := `
+Host web
+  HostName web.example.com
+  Port 2222
+  PermitLocalCommand yes
+  LocalCommand "echo %r@%h:%p %n 100%%"
+Host db
+  LocalCommand echo db
+`
+	configPath := filepath.Join(dir, "config")
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	settings := MakeSshConfigSettings(configPath, "")
+	web, err := settings.Resolve("web", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := expandLocalCommand(web, wshrpc.ConnKeywords{}, &SSHOpts{SSHHost: "web"}, "deploy"); got != "echo deploy@web.example.com:2222 web 100%" {
+		t.Errorf("web: got %q", got)
+	}
+	if got := expandLocalCommand(web, wshrpc.ConnKeywords{}, &SSHOpts{SSHHost: "web", SSHPort: 22}, "deploy"); got != "echo deploy@web.example.com:22 web 100%" {
+		t.Errorf("web with port: got %q", got)
+	}
+	denied := false
+	if got := expandLocalCommand(web, wshrpc.ConnKeywords{SshPermitLocalCommand: &denied}, &SSHOpts{SSHHost: "web"}, "deploy"); got != "" {
+		t.Errorf("not permitted in connections.json: got %q", got)
+	}
+	db, err := settings.Resolve("db", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := expandLocalCommand(db, wshrpc.ConnKeywords{}, &SSHOpts{SSHHost: "db"}, "root"); got != "" {
+		t.Errorf("db without PermitLocalCommand: got %q", got)
+	}
+	permitted := true
+	if got := expandLocalCommand(db, wshrpc.ConnKeywords{SshPermitLocalCommand: &permitted, SshLocalCommand: "notify %h"}, &SSHOpts{SSHHost: "db"}, "root"); got != "notify db" {
+		t.Errorf("db from connections.json: got %q", got)
+	}
+}
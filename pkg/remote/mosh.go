@@ -0,0 +1,132 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/util/utilfn"
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+	"golang.org/x/crypto/ssh"
+)
+
+// mosh terminals (conn:mosh).  like the mosh script, the ssh connection is only used to start
+// mosh-server on the remote.  the local mosh-client then talks to it directly over udp, so the
+// terminal survives roaming, sleep, and high-latency or lossy links.
+
+const DefaultMoshServer = "mosh-server"
+const DefaultMoshClient = "mosh-client"
+const MoshStartTimeout = 15 * time.Second
+
+var moshConnectRe = regexp.MustCompile(`(?m)^MOSH CONNECT (\d+) ([A-Za-z0-9/+]{22})\s*$`)
+
+type MoshSettings struct {
+	Enabled    bool
+	ServerPath string // on the remote
+	ClientPath string // local
+}
+
+// where mosh-client should connect, and the session key
+type MoshConnectInfo struct {
+	Host string
+	Port string
+	Key  string
+}
+
+// conn:mosh, conn:moshserver, and conn:moshclient from connections.json
+func GetMoshSettings(connName string) MoshSettings {
+	rtn := MoshSettings{ServerPath: DefaultMoshServer, ClientPath: DefaultMoshClient}
+	connSettings, ok := wconfig.ReadFullConfig().Connections[connName]
+	if !ok {
+		return rtn
+	}
+	rtn.Enabled = connSettings.ConnMosh
+	if connSettings.ConnMoshServer != "" {
+		rtn.ServerPath = connSettings.ConnMoshServer
+	}
+	if connSettings.ConnMoshClient != "" {
+		rtn.ClientPath = connSettings.ConnMoshClient
+	}
+	return rtn
+}
+
+// the command that starts mosh-server.  env is set for the server (which passes it on to the
+// shell), and cmdStr (if set) is run instead of the user's login shell.
+func makeMoshServerCmd(serverPath string, env map[string]string, cmdStr string) string {
+	var parts []string
+	envKeys := make([]string, 0, len(env))
+	for envKey := range env {
+		envKeys = append(envKeys, envKey)
+	}
+	sort.Strings(envKeys)
+	for _, envKey := range envKeys {
+		parts = append(parts, envKey+"="+utilfn.ShellQuote(env[envKey], false, -1))
+	}
+	parts = append(parts, QuoteRemotePath(serverPath), "new", "-s", "-c", "256", "-l", "LANG="+wavebase.DetermineLang())
+	if cmdStr != "" {
+		parts = append(parts, "--", "sh", "-c", utilfn.ShellQuote(cmdStr, false, -1))
+	}
+	return strings.Join(parts, " ")
+}
+
+// finds the "MOSH CONNECT <port> <key>" line that mosh-server prints before it detaches
+func parseMoshConnect(output string) (string, string, error) {
+	match := moshConnectRe.FindStringSubmatch(strings.ReplaceAll(output, "\r", ""))
+	if match == nil {
+		output = strings.TrimSpace(output)
+		if output == "" {
+			return "", "", fmt.Errorf("mosh-server did not start (no output)")
+		}
+		return "", "", fmt.Errorf("mosh-server did not start: %s", utilfn.EllipsisStr(output, 200))
+	}
+	return match[1], match[2], nil
+}
+
+// StartMoshServer starts mosh-server on the remote.  like the mosh script, a pty is requested so
+// mosh-server can set up the terminal's locale, and the server listens on the address that the
+// ssh connection was made to (-s), which is the address mosh-client connects to.
+func StartMoshServer(client *ssh.Client, serverPath string, termSize waveobj.TermSize, env map[string]string, cmdStr string) (*MoshConnectInfo, error) {
+	host, _, err := net.SplitHostPort(client.RemoteAddr().String())
+	if err != nil {
+		return nil, fmt.Errorf("cannot get the address of the remote: %w", err)
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	if err := session.RequestPty("xterm-256color", termSize.Rows, termSize.Cols, nil); err != nil {
+		return nil, fmt.Errorf("cannot start mosh-server: %w", err)
+	}
+	type outputResult struct {
+		output []byte
+		err    error
+	}
+	resultCh := make(chan outputResult, 1)
+	go func() {
+		output, err := session.CombinedOutput(makeMoshServerCmd(serverPath, env, cmdStr))
+		resultCh <- outputResult{output: output, err: err}
+	}()
+	var result outputResult
+	select {
+	case result = <-resultCh:
+	case <-time.After(MoshStartTimeout):
+		return nil, fmt.Errorf("timed out waiting for mosh-server to start")
+	}
+	port, key, err := parseMoshConnect(string(result.output))
+	if err != nil {
+		if _, ok := result.err.(*ssh.ExitError); ok && strings.Contains(string(result.output), "not found") {
+			return nil, fmt.Errorf("%s is not installed on the remote: %w", serverPath, err)
+		}
+		return nil, err
+	}
+	return &MoshConnectInfo{Host: host, Port: port, Key: key}, nil
+}
@@ -0,0 +1,36 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMoshConnect(t *testing.T) {
+	output := "\r\nMOSH CONNECT 60001 4NeCCgvZFe2RnPgrcU1PQw\r\n\r\nmosh-server (mosh 1.4.0) [build mosh 1.4.0]\r\n[mosh-server detached, pid = 1234]\r\n"
+	port, key, err := parseMoshConnect(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port != "60001" || key != "4NeCCgvZFe2RnPgrcU1PQw" {
+		t.Errorf("got port %q key %q", port, key)
+	}
+	if _, _, err := parseMoshConnect("bash: mosh-server: command not found\r\n"); err == nil || !strings.Contains(err.Error(), "command not found") {
+		t.Errorf("expected the server's output in the error, got %v", err)
+	}
+	if _, _, err := parseMoshConnect(""); err == nil {
+		t.Errorf("expected an error for no output")
+	}
+}
+
+func TestMakeMoshServerCmd(t *testing.T) {
+	cmd := makeMoshServerCmd("~/bin/mosh-server", map[string]string{"B": "two words", "A": "1"}, "top -d 1")
+	if !strings.HasPrefix(cmd, `A=1 B='two words' "$HOME"/'bin/mosh-server' new -s -c 256 -l LANG=`) {
+		t.Errorf("unexpected command %q", cmd)
+	}
+	if !strings.HasSuffix(cmd, ` -- sh -c 'top -d 1'`) {
+		t.Errorf("unexpected command %q", cmd)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+)
+
+// key passphrases that decrypted their identity file, kept in memory (by identity file) so that
+// reconnects and proxy jump hops using the same key don't prompt again.  entries expire after
+// conn:passphrasecachesecs, and are never written anywhere.
+
+const DefaultPassphraseCacheTtl = time.Hour
+
+type passphraseCacheEntry struct {
+	Passphrase string
+	Expires    time.Time
+}
+
+var passphraseCache = struct {
+	Lock    *sync.Mutex
+	Entries map[string]passphraseCacheEntry
+}{Lock: &sync.Mutex{}, Entries: make(map[string]passphraseCacheEntry)}
+
+// the configured ttl (0 turns the cache off)
+func getPassphraseCacheTtl() time.Duration {
+	watcher := wconfig.GetWatcher()
+	if watcher == nil {
+		return DefaultPassphraseCacheTtl
+	}
+	ttlSecs := watcher.GetFullConfig().Settings.ConnPassphraseCacheSecs
+	if ttlSecs == nil {
+		return DefaultPassphraseCacheTtl
+	}
+	if *ttlSecs <= 0 {
+		return 0
+	}
+	return time.Duration(*ttlSecs) * time.Second
+}
+
+func getCachedPassphrase(identityFile string) (string, bool) {
+	passphraseCache.Lock.Lock()
+	defer passphraseCache.Lock.Unlock()
+	entry, ok := passphraseCache.Entries[identityFile]
+	if !ok {
+		return "", false
+	}
+	if time.Now().After(entry.Expires) {
+		delete(passphraseCache.Entries, identityFile)
+		return "", false
+	}
+	return entry.Passphrase, true
+}
+
+func cachePassphrase(identityFile string, passphrase string) {
+	ttl := getPassphraseCacheTtl()
+	if ttl <= 0 {
+		return
+	}
+	passphraseCache.Lock.Lock()
+	defer passphraseCache.Lock.Unlock()
+	passphraseCache.Entries[identityFile] = passphraseCacheEntry{Passphrase: passphrase, Expires: time.Now().Add(ttl)}
+}
+
+func forgetCachedPassphrase(identityFile string) {
+	passphraseCache.Lock.Lock()
+	defer passphraseCache.Lock.Unlock()
+	delete(passphraseCache.Entries, identityFile)
+}
+
+// forgets every cached passphrase (and the keys held by the internal agent), returns how many
+// (unexpired passphrases and keys) there were
+func FlushPassphraseCache() int {
+	passphraseCache.Lock.Lock()
+	defer passphraseCache.Lock.Unlock()
+	count := flushInternalAgent()
+	now := time.Now()
+	for _, entry := range passphraseCache.Entries {
+		if now.Before(entry.Expires) {
+			count++
+		}
+	}
+	passphraseCache.Entries = make(map[string]passphraseCacheEntry)
+	return count
+}
@@ -0,0 +1,496 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/trimquotes"
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"golang.org/x/crypto/ssh"
+)
+
+// port forwards over an ssh.Client.  specs use the ssh_config syntax:
+//
+//	LocalForward [bind_address:]port host:hostport
+//	LocalForward [bind_address:]port /remote/socket
+//	LocalForward /local/socket host:hostport
+//	LocalForward /local/socket /remote/socket
+//	RemoteForward [bind_address:]port host:hostport
+//	RemoteForward /remote/socket /local/socket
+//	DynamicForward [bind_address:]port
+//
+// the "ssh -L" / "ssh -R" form ([bind_address:]port:host:hostport) is also accepted.
+
+const DefaultForwardBindAddr = "localhost"
+
+// like ssh, local sockets are only accessible by the user unless StreamLocalBindMask says otherwise
+const DefaultStreamLocalBindMask = 0177
+
+type ForwardSpec struct {
+	Spec          string // as configured
+	ListenNetwork string // "tcp" or "unix"
+	ListenAddr    string
+	TargetNetwork string
+	TargetAddr    string
+	BindUnlink    bool        // remove a stale local socket before listening (StreamLocalBindUnlink)
+	BindMask      os.FileMode // the mask for the mode of a local listening socket (StreamLocalBindMask)
+}
+
+func (spec ForwardSpec) String() string {
+	return fmt.Sprintf("%s -> %s", spec.ListenAddr, spec.TargetAddr)
+}
+
+// PortForward is an active forward on a connection
+type PortForward interface {
+	GetInfo() wshrpc.PortForwardInfo
+	Close() error
+}
+
+func isSocketPath(addr string) bool {
+	return strings.HasPrefix(addr, "/") || strings.HasPrefix(addr, "~")
+}
+
+// splits "host:port" (or "[v6addr]:port") from the right
+func splitHostPort(addr string) (string, string, error) {
+	idx := strings.LastIndex(addr, ":")
+	if idx == -1 {
+		return "", addr, nil
+	}
+	host, port := addr[:idx], addr[idx+1:]
+	if strings.HasPrefix(host, "[") {
+		if !strings.HasSuffix(host, "]") {
+			return "", "", fmt.Errorf("invalid address %q", addr)
+		}
+		host = host[1 : len(host)-1]
+	}
+	return host, port, nil
+}
+
+func checkPort(portStr string) error {
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 0 || port > 65535 {
+		return fmt.Errorf("invalid port %q", portStr)
+	}
+	return nil
+}
+
+// a listen address is "port", "bind:port", "*:port" (all interfaces), or a socket path
+func parseListenAddr(addr string, isLocal bool) (string, string, error) {
+	if isLocal && isSocketPath(addr) {
+		path, err := wavebase.ExpandHomeDir(addr)
+		return "unix", path, err
+	}
+	if strings.HasPrefix(addr, "/") {
+		return "unix", addr, nil
+	}
+	host, port, err := splitHostPort(addr)
+	if err != nil {
+		return "", "", err
+	}
+	if err := checkPort(port); err != nil {
+		return "", "", err
+	}
+	if host == "" {
+		host = DefaultForwardBindAddr
+	} else if host == "*" {
+		host = ""
+	}
+	return "tcp", net.JoinHostPort(host, port), nil
+}
+
+func parseTargetAddr(addr string, isLocal bool) (string, string, error) {
+	if isLocal && isSocketPath(addr) {
+		path, err := wavebase.ExpandHomeDir(addr)
+		return "unix", path, err
+	}
+	if strings.HasPrefix(addr, "/") {
+		return "unix", addr, nil
+	}
+	host, port, err := splitHostPort(addr)
+	if err != nil {
+		return "", "", err
+	}
+	if host == "" {
+		return "", "", fmt.Errorf("target %q must be host:port", addr)
+	}
+	if err := checkPort(port); err != nil {
+		return "", "", err
+	}
+	return "tcp", net.JoinHostPort(host, port), nil
+}
+
+// splits the "ssh -L" form, [bind_address:]port:host:hostport.  either side can also be a
+// socket path (/local/socket:host:hostport, port:/remote/socket, /local/socket:/remote/socket).
+func splitColonForwardSpec(spec string) (string, string, error) {
+	if isSocketPath(spec) {
+		listenStr, targetStr, ok := strings.Cut(spec, ":")
+		if !ok || targetStr == "" {
+			return "", "", fmt.Errorf("invalid forward %q", spec)
+		}
+		return listenStr, targetStr, nil
+	}
+	if idx := strings.Index(spec, ":/"); idx > 0 {
+		return spec[:idx], spec[idx+1:], nil
+	}
+	idx := strings.LastIndex(spec, ":")
+	if idx == -1 {
+		return "", "", fmt.Errorf("invalid forward %q", spec)
+	}
+	rest := spec[:idx]
+	var hostStart int
+	if strings.HasSuffix(rest, "]") {
+		hostStart = strings.LastIndex(rest, "[")
+	} else {
+		hostStart = strings.LastIndex(rest, ":") + 1
+	}
+	if hostStart <= 0 {
+		return "", "", fmt.Errorf("invalid forward %q", spec)
+	}
+	return rest[:hostStart-1], spec[hostStart:], nil
+}
+
+// local forwards listen locally and connect on the remote, remote forwards are the other way around
+func ParseForwardSpec(forwardType string, spec string) (*ForwardSpec, error) {
+	spec = trimquotes.TryTrimQuotes(strings.TrimSpace(spec))
+	if forwardType == wshrpc.ForwardType_Dynamic {
+		return parseDynamicForwardSpec(spec)
+	}
+	fields := strings.Fields(spec)
+	var listenStr, targetStr string
+	switch len(fields) {
+	case 1:
+		var err error
+		listenStr, targetStr, err = splitColonForwardSpec(fields[0])
+		if err != nil {
+			return nil, err
+		}
+	case 2:
+		listenStr, targetStr = fields[0], fields[1]
+	default:
+		return nil, fmt.Errorf("invalid forward %q", spec)
+	}
+	rtn := &ForwardSpec{Spec: spec}
+	var err error
+	isRemote := forwardType == wshrpc.ForwardType_Remote
+	rtn.ListenNetwork, rtn.ListenAddr, err = parseListenAddr(listenStr, !isRemote)
+	if err != nil {
+		return nil, fmt.Errorf("invalid forward %q: %w", spec, err)
+	}
+	rtn.TargetNetwork, rtn.TargetAddr, err = parseTargetAddr(targetStr, isRemote)
+	if err != nil {
+		return nil, fmt.Errorf("invalid forward %q: %w", spec, err)
+	}
+	return rtn, nil
+}
+
+// a dynamic forward only has a listen address, the targets come from the socks requests
+func parseDynamicForwardSpec(spec string) (*ForwardSpec, error) {
+	if spec == "" || strings.ContainsAny(spec, " \t") || isSocketPath(spec) {
+		return nil, fmt.Errorf("invalid dynamic forward %q, must be [bind_address:]port", spec)
+	}
+	rtn := &ForwardSpec{Spec: spec}
+	var err error
+	rtn.ListenNetwork, rtn.ListenAddr, err = parseListenAddr(spec, true)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dynamic forward %q: %w", spec, err)
+	}
+	return rtn, nil
+}
+
+// forwards (LocalForward, RemoteForward, ...) from the ssh config files for a host
+func GetSshConfigForwards(hostPattern string, userName string, keyword string) []string {
+	sshConfig, err := WaveSshConfigUserSettings().Resolve(hostPattern, userName)
+	if err != nil {
+		return nil
+	}
+	var rtn []string
+	for _, spec := range sshConfig.GetAll(keyword) {
+		spec = trimquotes.TryTrimQuotes(strings.TrimSpace(spec))
+		if spec != "" {
+			rtn = append(rtn, spec)
+		}
+	}
+	return rtn
+}
+
+// ForwardFailedError is returned when a configured forward can't be started and
+// ExitOnForwardFailure is set, so the connection is not made.
+type ForwardFailedError struct {
+	Type string
+	Spec string
+	Err  error
+}
+
+func (e *ForwardFailedError) Error() string {
+	return fmt.Sprintf("%s forward %q failed and ExitOnForwardFailure is set: %v", e.Type, e.Spec, e.Err)
+}
+
+func (e *ForwardFailedError) Unwrap() error {
+	return e.Err
+}
+
+// ExitOnForwardFailure from the ssh config files for a host (ssh:exitonforwardfailure in
+// connections.json takes priority)
+func GetExitOnForwardFailure(connName string, hostPattern string, userName string) bool {
+	var exit bool
+	if sshConfig, err := WaveSshConfigUserSettings().Resolve(hostPattern, userName); err == nil {
+		exit = strings.ToLower(trimquotes.TryTrimQuotes(sshConfig.Get("ExitOnForwardFailure"))) == "yes"
+	}
+	if connSettings, ok := wconfig.ReadFullConfig().Connections[connName]; ok && connSettings.SshExitOnForwardFailure != nil {
+		exit = *connSettings.SshExitOnForwardFailure
+	}
+	return exit
+}
+
+// StreamLocalBindUnlink and StreamLocalBindMask from the ssh config files for a host
+// (ssh:streamlocalbindunlink in connections.json takes priority)
+func GetStreamLocalBindOpts(connName string, hostPattern string, userName string) (bool, os.FileMode) {
+	var unlink bool
+	mask := os.FileMode(DefaultStreamLocalBindMask)
+	if sshConfig, err := WaveSshConfigUserSettings().Resolve(hostPattern, userName); err == nil {
+		unlink = strings.ToLower(trimquotes.TryTrimQuotes(sshConfig.Get("StreamLocalBindUnlink"))) == "yes"
+		if maskStr := trimquotes.TryTrimQuotes(sshConfig.Get("StreamLocalBindMask")); maskStr != "" {
+			if val, err := strconv.ParseUint(maskStr, 8, 32); err == nil && val <= 0777 {
+				mask = os.FileMode(val)
+			} else {
+				log.Printf("invalid StreamLocalBindMask %q for %s, using %04o\n", maskStr, connName, DefaultStreamLocalBindMask)
+			}
+		}
+	}
+	if connSettings, ok := wconfig.ReadFullConfig().Connections[connName]; ok && connSettings.SshStreamLocalBindUnlink != nil {
+		unlink = *connSettings.SshStreamLocalBindUnlink
+	}
+	return unlink, mask
+}
+
+// listens on a local tcp port or socket.  like ssh, an existing socket file is only removed
+// with BindUnlink (other files are never removed), and the socket's mode is limited by BindMask.
+func listenLocal(spec ForwardSpec) (net.Listener, error) {
+	if spec.ListenNetwork != "unix" {
+		return net.Listen(spec.ListenNetwork, spec.ListenAddr)
+	}
+	if spec.BindUnlink {
+		if finfo, err := os.Lstat(spec.ListenAddr); err == nil && finfo.Mode()&os.ModeSocket != 0 {
+			if err := os.Remove(spec.ListenAddr); err != nil {
+				return nil, fmt.Errorf("cannot remove stale socket: %w", err)
+			}
+		}
+	}
+	listener, err := net.Listen("unix", spec.ListenAddr)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(spec.ListenAddr, 0666&^spec.BindMask); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("cannot set socket mode: %w", err)
+	}
+	return listener, nil
+}
+
+// copies in both directions until both sides are done, then closes both
+func pipeConns(conn1 io.ReadWriteCloser, conn2 io.ReadWriteCloser) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	copyFn := func(dst io.ReadWriteCloser, src io.ReadWriteCloser) {
+		defer wg.Done()
+		io.Copy(dst, src)
+		if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		} else {
+			dst.Close()
+		}
+	}
+	go copyFn(conn1, conn2)
+	go copyFn(conn2, conn1)
+	wg.Wait()
+	conn1.Close()
+	conn2.Close()
+}
+
+// tracks the open connections of a forward so they can be closed with it
+type forwardConns struct {
+	lock   *sync.Mutex
+	conns  map[net.Conn]bool
+	total  *atomic.Int64
+	closed bool
+}
+
+func makeForwardConns() *forwardConns {
+	return &forwardConns{lock: &sync.Mutex{}, conns: make(map[net.Conn]bool), total: &atomic.Int64{}}
+}
+
+func (fc *forwardConns) add(conns ...net.Conn) bool {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+	if fc.closed {
+		return false
+	}
+	for _, conn := range conns {
+		fc.conns[conn] = true
+	}
+	fc.total.Add(1)
+	return true
+}
+
+func (fc *forwardConns) remove(conns ...net.Conn) {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+	for _, conn := range conns {
+		delete(fc.conns, conn)
+	}
+}
+
+// returns the number of active (proxied) connections
+func (fc *forwardConns) numActive(connsPerProxy int) int {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+	return len(fc.conns) / connsPerProxy
+}
+
+func (fc *forwardConns) closeAll() {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+	fc.closed = true
+	for conn := range fc.conns {
+		conn.Close()
+	}
+	fc.conns = make(map[net.Conn]bool)
+}
+
+// a forward that accepts connections on a listener and connects each one to its target with
+// connectFn (which can also read a handshake from the accepted connection, as socks does)
+type listenerForward struct {
+	Type      string
+	Spec      ForwardSpec
+	ConnName  string
+	Source    string
+	listener  net.Listener
+	connectFn func(conn net.Conn) (net.Conn, error)
+	conns     *forwardConns
+}
+
+func startListenerForward(forwardType string, connName string, spec ForwardSpec, source string, listener net.Listener, connectFn func(conn net.Conn) (net.Conn, error)) *listenerForward {
+	lf := &listenerForward{
+		Type:      forwardType,
+		Spec:      spec,
+		ConnName:  connName,
+		Source:    source,
+		listener:  listener,
+		connectFn: connectFn,
+		conns:     makeForwardConns(),
+	}
+	go lf.serve()
+	return lf
+}
+
+func (lf *listenerForward) serve() {
+	defer panichandler.PanicHandler("listenerForward:serve")
+	for {
+		conn, err := lf.listener.Accept()
+		if err != nil {
+			return
+		}
+		go lf.handleConn(conn)
+	}
+}
+
+func (lf *listenerForward) handleConn(conn net.Conn) {
+	defer panichandler.PanicHandler("listenerForward:handleConn")
+	targetConn, err := lf.connectFn(conn)
+	if err != nil {
+		log.Printf("%s forward %q (%s): %v\n", lf.Type, lf.Spec.Spec, lf.ConnName, err)
+		conn.Close()
+		return
+	}
+	if !lf.conns.add(conn, targetConn) {
+		conn.Close()
+		targetConn.Close()
+		return
+	}
+	defer lf.conns.remove(conn, targetConn)
+	pipeConns(conn, targetConn)
+}
+
+func (lf *listenerForward) GetInfo() wshrpc.PortForwardInfo {
+	return wshrpc.PortForwardInfo{
+		Connection:  lf.ConnName,
+		Type:        lf.Type,
+		Spec:        lf.Spec.Spec,
+		ListenAddr:  lf.listener.Addr().String(),
+		TargetAddr:  lf.Spec.TargetAddr,
+		Source:      lf.Source,
+		ActiveConns: lf.conns.numActive(2),
+		TotalConns:  lf.conns.total.Load(),
+	}
+}
+
+// stops listening and closes the forwarded connections
+func (lf *listenerForward) Close() error {
+	err := lf.listener.Close()
+	lf.conns.closeAll()
+	return err
+}
+
+// listens locally, and dials the target through the ssh connection (ssh -L)
+func StartLocalForward(client *ssh.Client, connName string, spec ForwardSpec, source string) (PortForward, error) {
+	listener, err := listenLocal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen on %s: %w", spec.ListenAddr, err)
+	}
+	connectFn := func(conn net.Conn) (net.Conn, error) {
+		targetConn, err := client.Dial(spec.TargetNetwork, spec.TargetAddr)
+		if err != nil {
+			return nil, fmt.Errorf("cannot connect to %s: %w", spec.TargetAddr, err)
+		}
+		return targetConn, nil
+	}
+	return startListenerForward(wshrpc.ForwardType_Local, connName, spec, source, listener, connectFn), nil
+}
+
+// asks the ssh server to listen, and dials the target locally (ssh -R)
+func StartRemoteForward(client *ssh.Client, connName string, spec ForwardSpec, source string) (PortForward, error) {
+	var listener net.Listener
+	var err error
+	if spec.ListenNetwork == "unix" {
+		listener, err = client.ListenUnix(spec.ListenAddr)
+	} else {
+		listener, err = client.Listen(spec.ListenNetwork, spec.ListenAddr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("remote cannot listen on %s: %w", spec.ListenAddr, err)
+	}
+	connectFn := func(conn net.Conn) (net.Conn, error) {
+		targetConn, err := net.Dial(spec.TargetNetwork, spec.TargetAddr)
+		if err != nil {
+			return nil, fmt.Errorf("cannot connect to %s: %w", spec.TargetAddr, err)
+		}
+		return targetConn, nil
+	}
+	return startListenerForward(wshrpc.ForwardType_Remote, connName, spec, source, listener, connectFn), nil
+}
+
+func StartForward(client *ssh.Client, connName string, forwardType string, spec ForwardSpec, source string) (PortForward, error) {
+	switch forwardType {
+	case wshrpc.ForwardType_Local:
+		return StartLocalForward(client, connName, spec, source)
+	case wshrpc.ForwardType_Remote:
+		return StartRemoteForward(client, connName, spec, source)
+	case wshrpc.ForwardType_Dynamic:
+		return StartDynamicForward(client, connName, spec, source)
+	default:
+		return nil, fmt.Errorf("unknown forward type %q", forwardType)
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+func TestParseForwardSpec(t *testing.T) {
+	tests := []struct {
+		spec   string
+		listen string
+		target string
+	}{
+		{"8080 localhost:80", "localhost:8080", "localhost:80"},
+		{"127.0.0.1:5432 db.internal:5432", "127.0.0.1:5432", "db.internal:5432"},
+		{"*:3000 web:3000", ":3000", "web:3000"},
+		{"[::1]:8080 [fe80::1]:80", "[::1]:8080", "[fe80::1]:80"},
+		{"9000 /var/run/docker.sock", "localhost:9000", "/var/run/docker.sock"},
+		{"8080:localhost:80", "localhost:8080", "localhost:80"},
+		{"0.0.0.0:8080:[::1]:80", "0.0.0.0:8080", "[::1]:80"},
+		{"/tmp/docker.sock /var/run/docker.sock", "/tmp/docker.sock", "/var/run/docker.sock"},
+		{"/tmp/docker.sock:/var/run/docker.sock", "/tmp/docker.sock", "/var/run/docker.sock"},
+		{"2375:/var/run/docker.sock", "localhost:2375", "/var/run/docker.sock"},
+		{"/tmp/web.sock:localhost:80", "/tmp/web.sock", "localhost:80"},
+	}
+	for _, test := range tests {
+		spec, err := ParseForwardSpec(wshrpc.ForwardType_Local, test.spec)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.spec, err)
+			continue
+		}
+		if spec.ListenAddr != test.listen || spec.TargetAddr != test.target {
+			t.Errorf("%q: got %s -> %s, expected %s -> %s", test.spec, spec.ListenAddr, spec.TargetAddr, test.listen, test.target)
+		}
+	}
+	for _, bad := range []string{"", "8080", "8080 localhost", "99999 localhost:80", "8080 :80", "a b c"} {
+		if _, err := ParseForwardSpec(wshrpc.ForwardType_Local, bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestParseRemoteForwardSpec(t *testing.T) {
+	// remote socket paths are used as-is (~ is not expanded on this side)
+	spec, err := ParseForwardSpec(wshrpc.ForwardType_Remote, "~/app.sock localhost:3000")
+	if err == nil {
+		t.Errorf("relative remote socket: expected an error, got %s", spec.ListenAddr)
+	}
+	spec, err = ParseForwardSpec(wshrpc.ForwardType_Remote, "/tmp/app.sock localhost:3000")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if spec.ListenNetwork != "unix" || spec.ListenAddr != "/tmp/app.sock" || spec.TargetAddr != "localhost:3000" {
+		t.Errorf("got %s %s -> %s", spec.ListenNetwork, spec.ListenAddr, spec.TargetAddr)
+	}
+	// a remote gpg-agent forward, back to the local agent's socket
+	spec, err = ParseForwardSpec(wshrpc.ForwardType_Remote, "/run/user/1000/gnupg/S.gpg-agent:/tmp/S.gpg-agent.extra")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if spec.ListenNetwork != "unix" || spec.TargetNetwork != "unix" || spec.ListenAddr != "/run/user/1000/gnupg/S.gpg-agent" || spec.TargetAddr != "/tmp/S.gpg-agent.extra" {
+		t.Errorf("got %s %s -> %s %s", spec.ListenNetwork, spec.ListenAddr, spec.TargetNetwork, spec.TargetAddr)
+	}
+}
+
+func TestListenLocalSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fwd.sock")
+	spec := ForwardSpec{ListenNetwork: "unix", ListenAddr: path, BindMask: DefaultStreamLocalBindMask}
+	listener, err := listenLocal(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	finfo, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if finfo.Mode().Perm() != 0600 {
+		t.Errorf("got socket mode %04o, expected 0600", finfo.Mode().Perm())
+	}
+	// a socket left behind (like one from a crashed process) is only removed with BindUnlink
+	if l, ok := listener.(*net.UnixListener); ok {
+		l.SetUnlinkOnClose(false)
+	}
+	listener.Close()
+	if _, err := listenLocal(spec); err == nil {
+		t.Fatalf("expected an error listening on a stale socket without BindUnlink")
+	}
+	spec.BindUnlink = true
+	listener, err = listenLocal(spec)
+	if err != nil {
+		t.Fatalf("BindUnlink: %v", err)
+	}
+	listener.Close()
+
+	// regular files are never removed
+	filePath := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(filePath, []byte("data"), 0600)
+	if _, err := listenLocal(ForwardSpec{ListenNetwork: "unix", ListenAddr: filePath, BindUnlink: true}); err == nil {
+		t.Errorf("expected an error listening on a regular file")
+	}
+}
+
+func TestParseDynamicForwardSpec(t *testing.T) {
+	spec, err := ParseForwardSpec(wshrpc.ForwardType_Dynamic, "1080")
+	if err != nil || spec.ListenAddr != "localhost:1080" {
+		t.Errorf("1080: got %v, %v", spec, err)
+	}
+	for _, bad := range []string{"", "1080 localhost:80", "/tmp/socks.sock"} {
+		if _, err := ParseForwardSpec(wshrpc.ForwardType_Dynamic, bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestSocksConnect(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	var dialedAddr string
+	dialFn := func(network string, addr string) (net.Conn, error) {
+		dialedAddr = addr
+		targetConn, _ := net.Pipe()
+		return targetConn, nil
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		targetConn, err := socksConnect(serverConn, dialFn)
+		if targetConn != nil {
+			targetConn.Close()
+		}
+		errCh <- err
+	}()
+	clientConn.Write([]byte{0x05, 0x01, 0x00})
+	methodReply := make([]byte, 2)
+	io.ReadFull(clientConn, methodReply)
+	if !bytes.Equal(methodReply, []byte{0x05, 0x00}) {
+		t.Fatalf("bad method reply %v", methodReply)
+	}
+	req := []byte{0x05, 0x01, 0x00, 0x03, byte(len("example.com"))}
+	req = append(req, "example.com"...)
+	req = append(req, 0x01, 0xbb)
+	clientConn.Write(req)
+	reply := make([]byte, 10)
+	io.ReadFull(clientConn, reply)
+	if reply[1] != socksReplySuccess {
+		t.Fatalf("bad reply %v", reply)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dialedAddr != "example.com:443" {
+		t.Errorf("dialed %q, expected example.com:443", dialedAddr)
+	}
+}
+
+func TestForwardFailedError(t *testing.T) {
+	listenErr := fmt.Errorf("listen tcp 127.0.0.1:8080: bind: address already in use")
+	err := fmt.Errorf("connecting: %w", &ForwardFailedError{Type: wshrpc.ForwardType_Local, Spec: "8080 localhost:80", Err: listenErr})
+	if code := GetConnErrorCode(err); code != wshrpc.ConnErrorCode_ForwardFailed {
+		t.Errorf("got error code %q", code)
+	}
+	if !errors.Is(err, listenErr) {
+		t.Errorf("the listen error should be unwrapped")
+	}
+	if event := MakeConnErrorEvent(err); event.ErrorCode != wshrpc.ConnErrorCode_ForwardFailed || event.Error != err.Error() {
+		t.Errorf("got event %+v", event)
+	}
+}
@@ -0,0 +1,13 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !windows
+
+package remote
+
+import "fmt"
+
+// only windows keeps sessions in the registry
+func readPuttyRegistrySessions(source string) ([]*puttySession, error) {
+	return nil, fmt.Errorf("saved sessions are only in the registry on windows")
+}
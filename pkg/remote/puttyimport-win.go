@@ -0,0 +1,68 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build windows
+
+package remote
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"golang.org/x/sys/windows/registry"
+)
+
+const puttyRegistryPath = `Software\SimonTatham\PuTTY\Sessions`
+const kittyRegistryPath = `Software\9bis.com\KiTTY\Sessions`
+
+func readPuttyRegistrySessions(source string) ([]*puttySession, error) {
+	regPath := puttyRegistryPath
+	if source == wshrpc.ConnImportSource_Kitty {
+		regPath = kittyRegistryPath
+	}
+	sessionsKey, err := registry.OpenKey(registry.CURRENT_USER, regPath, registry.ENUMERATE_SUB_KEYS)
+	if err == registry.ErrNotExist {
+		return nil, fmt.Errorf("no saved sessions found (HKEY_CURRENT_USER\\%s)", regPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening HKEY_CURRENT_USER\\%s: %w", regPath, err)
+	}
+	defer sessionsKey.Close()
+	names, err := sessionsKey.ReadSubKeyNames(-1)
+	if err != nil {
+		return nil, fmt.Errorf("listing sessions: %w", err)
+	}
+	var rtn []*puttySession
+	for _, name := range names {
+		sessionPath := regPath + `\` + name
+		session, err := readPuttyRegistrySession(sessionPath, name)
+		if err != nil {
+			return nil, fmt.Errorf("reading HKEY_CURRENT_USER\\%s: %w", sessionPath, err)
+		}
+		rtn = append(rtn, session)
+	}
+	return rtn, nil
+}
+
+func readPuttyRegistrySession(sessionPath string, name string) (*puttySession, error) {
+	key, err := registry.OpenKey(registry.CURRENT_USER, sessionPath, registry.QUERY_VALUE)
+	if err != nil {
+		return nil, err
+	}
+	defer key.Close()
+	valueNames, err := key.ReadValueNames(-1)
+	if err != nil {
+		return nil, err
+	}
+	session := &puttySession{Name: decodePuttySessionName(name), Source: `HKEY_CURRENT_USER\` + sessionPath, Values: make(map[string]string)}
+	for _, valueName := range valueNames {
+		// PuTTY stores strings and dwords
+		if strVal, _, err := key.GetStringValue(valueName); err == nil {
+			session.Values[valueName] = strVal
+		} else if intVal, _, err := key.GetIntegerValue(valueName); err == nil {
+			session.Values[valueName] = strconv.FormatUint(intVal, 10)
+		}
+	}
+	return session, nil
+}
@@ -0,0 +1,253 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// imports PuTTY and KiTTY saved sessions as connections (see connimport.go).  sessions are
+// read from the registry on windows, or from session files: PuTTY's ~/.putty/sessions (one
+// "Key=Value" per line) and KiTTY's portable Sessions folder (one "Key\Value\" per line).
+// the connection is named [user@]host[:port], and the settings Wave supports (key file, ssh
+// jump proxy, port forwards, X11) are saved with it.
+
+const puttyDefaultSession = "Default Settings"
+
+// PuTTY's ProxyMethod values
+const (
+	puttyProxy_None    = 0
+	puttyProxy_Socks4  = 1
+	puttyProxy_Socks5  = 2
+	puttyProxy_Http    = 3
+	puttyProxy_Telnet  = 4
+	puttyProxy_Command = 5
+	puttyProxy_SshJump = 6 // "SSH to proxy and use port forwarding" (PuTTY 0.77+)
+)
+
+type puttySession struct {
+	Name   string
+	Source string // the registry key or file the session was read from
+	Values map[string]string
+}
+
+func (s *puttySession) getString(key string) string {
+	return strings.TrimSpace(s.Values[key])
+}
+
+func (s *puttySession) getInt(key string, def int) int {
+	val, err := strconv.Atoi(s.getString(key))
+	if err != nil {
+		return def
+	}
+	return val
+}
+
+// session names are %-escaped in the registry and in file names
+func decodePuttySessionName(name string) string {
+	decoded, err := url.PathUnescape(name)
+	if err != nil {
+		return name
+	}
+	return decoded
+}
+
+// parses a session file, in PuTTY's "Key=Value" or KiTTY's "Key\Value\" format
+func parsePuttySessionFile(name string, path string, data []byte) *puttySession {
+	session := &puttySession{Name: decodePuttySessionName(name), Source: path, Values: make(map[string]string)}
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		eqIdx := strings.Index(line, "=")
+		bsIdx := strings.Index(line, "\\")
+		if bsIdx >= 0 && (eqIdx < 0 || bsIdx < eqIdx) {
+			session.Values[line[:bsIdx]] = strings.TrimSuffix(line[bsIdx+1:], "\\")
+		} else if eqIdx >= 0 {
+			session.Values[line[:eqIdx]] = line[eqIdx+1:]
+		}
+	}
+	return session
+}
+
+func readPuttySessionDir(dir string) ([]*puttySession, error) {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var rtn []*puttySession
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, dirEntry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		rtn = append(rtn, parsePuttySessionFile(dirEntry.Name(), path, data))
+	}
+	return rtn, nil
+}
+
+// reads the sessions from path (a session file or a directory of them).  with no path, the
+// sessions are read from the registry (windows) or ~/.putty/sessions.
+func readPuttySessions(source string, path string) ([]*puttySession, error) {
+	if path == "" {
+		if runtime.GOOS == "windows" {
+			return readPuttyRegistrySessions(source)
+		}
+		if source == wshrpc.ConnImportSource_Kitty {
+			return nil, fmt.Errorf("give the path of KiTTY's Sessions folder")
+		}
+		path = "~/.putty/sessions"
+	}
+	path, err := wavebase.ExpandHomeDir(path)
+	if err != nil {
+		return nil, err
+	}
+	finfo, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if finfo.IsDir() {
+		return readPuttySessionDir(path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return []*puttySession{parsePuttySessionFile(filepath.Base(path), path, data)}, nil
+}
+
+// converts a PuTTY PortForwardings value ("L8080=localhost:80,R2222=localhost:22,D1080")
+func convertPuttyPortForwards(value string) (local []string, remote []string, dynamic []string) {
+	for _, spec := range strings.Split(value, ",") {
+		spec = strings.TrimSpace(spec)
+		// an optional 4 or 6 limits the forward to ipv4 or ipv6
+		spec = strings.TrimLeft(spec, "46")
+		if len(spec) < 2 {
+			continue
+		}
+		fwdType, rest := spec[0], spec[1:]
+		if fwdType == 'D' {
+			dynamic = append(dynamic, rest)
+			continue
+		}
+		listen, target, ok := strings.Cut(rest, "=")
+		if !ok || listen == "" || target == "" {
+			continue
+		}
+		switch fwdType {
+		case 'L':
+			local = append(local, listen+" "+target)
+		case 'R':
+			remote = append(remote, listen+" "+target)
+		}
+	}
+	return local, remote, dynamic
+}
+
+// a PuTTY key file path (.ppk keys are used as the OpenSSH key next to them, if there is one)
+func convertPuttyKeyFile(keyFile string) (string, string) {
+	if !strings.EqualFold(filepath.Ext(keyFile), ".ppk") {
+		return keyFile, ""
+	}
+	opensshKey := strings.TrimSuffix(keyFile, filepath.Ext(keyFile))
+	if _, err := os.Stat(opensshKey); err == nil {
+		return opensshKey, ""
+	}
+	return "", fmt.Sprintf("key %s is in PuTTY's format, convert it with \"puttygen %s -O private-openssh -o %s\" and add it as ssh:identityfile", keyFile, keyFile, opensshKey)
+}
+
+// converts a session to a connection name and the keywords to save for it
+func convertPuttySession(session *puttySession) (string, waveobj.MetaMapType, []string, error) {
+	protocol := session.getString("Protocol")
+	if protocol != "" && protocol != "ssh" {
+		return "", nil, nil, fmt.Errorf("%s sessions are not supported", protocol)
+	}
+	host := session.getString("HostName")
+	if host == "" {
+		return "", nil, nil, fmt.Errorf("no host name")
+	}
+	userName := session.getString("UserName")
+	if atIdx := strings.LastIndex(host, "@"); atIdx >= 0 {
+		userName, host = host[:atIdx], host[atIdx+1:]
+	}
+	connName, err := makeImportConnName(userName, host, session.getInt("PortNumber", 22))
+	if err != nil {
+		return "", nil, nil, err
+	}
+	var warnings []string
+	meta := make(waveobj.MetaMapType)
+	if keyFile := session.getString("PublicKeyFile"); keyFile != "" {
+		identityFile, warning := convertPuttyKeyFile(keyFile)
+		if identityFile != "" {
+			meta["ssh:identityfile"] = []any{identityFile}
+		}
+		if warning != "" {
+			warnings = append(warnings, warning)
+		}
+	}
+	proxyHost := session.getString("ProxyHost")
+	switch proxyMethod := session.getInt("ProxyMethod", puttyProxy_None); {
+	case proxyMethod == puttyProxy_None || proxyHost == "":
+	case proxyMethod == puttyProxy_SshJump:
+		jump := proxyHost
+		if proxyUser := session.getString("ProxyUsername"); proxyUser != "" {
+			jump = proxyUser + "@" + jump
+		}
+		if proxyPort := session.getInt("ProxyPort", 22); proxyPort != 22 && proxyPort > 0 {
+			jump += ":" + strconv.Itoa(proxyPort)
+		}
+		meta["ssh:proxyjump"] = []any{jump}
+	case proxyMethod == puttyProxy_Socks4 || proxyMethod == puttyProxy_Socks5 || proxyMethod == puttyProxy_Http:
+		warnings = append(warnings, fmt.Sprintf("connecting through the proxy %s is not supported, not imported", proxyHost))
+	default:
+		warnings = append(warnings, fmt.Sprintf("proxy method %d (%s) is not supported, not imported", proxyMethod, proxyHost))
+	}
+	local, remote, dynamic := convertPuttyPortForwards(session.getString("PortForwardings"))
+	setImportListValue(meta, "ssh:localforward", local)
+	setImportListValue(meta, "ssh:remoteforward", remote)
+	setImportListValue(meta, "ssh:dynamicforward", dynamic)
+	if session.getInt("X11Forward", 0) == 1 {
+		meta["ssh:forwardx11"] = true
+	}
+	return connName, meta, warnings, nil
+}
+
+type puttyImporter struct {
+	source string // putty or kitty
+}
+
+func (p puttyImporter) ReadConns(path string) ([]*importedConn, error) {
+	sessions, err := readPuttySessions(p.source, path)
+	if err != nil {
+		return nil, err
+	}
+	var rtn []*importedConn
+	for _, session := range sessions {
+		if session.Name == puttyDefaultSession {
+			continue
+		}
+		conn := &importedConn{Session: session.Name}
+		conn.ConnName, conn.Meta, conn.Warnings, conn.Err = convertPuttySession(session)
+		rtn = append(rtn, conn)
+	}
+	return rtn, nil
+}
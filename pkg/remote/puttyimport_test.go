@@ -0,0 +1,59 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+)
+
+func TestConvertPuttySession(t *testing.T) {
+	dir := t.TempDir()
+	ppkFile := filepath.Join(dir, "work.ppk")
+	os.WriteFile(filepath.Join(dir, "work"), []byte("key"), 0600)
+	puttyFile := "HostName=admin@build.example.com\nPortNumber=2222\nProtocol=ssh\nPublicKeyFile=" + ppkFile + "\n" +
+		"ProxyMethod=6\nProxyHost=bastion.example.com\nProxyPort=22\nProxyUsername=jump\n" +
+		"PortForwardings=L8080=localhost:80,4R2222=localhost:22,D1080\nCompression=1\n"
+	session := parsePuttySessionFile("build%20server", "build%20server", []byte(puttyFile))
+	if session.Name != "build server" {
+		t.Errorf("session name %q", session.Name)
+	}
+	connName, meta, warnings, err := convertPuttySession(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if connName != "admin@build.example.com:2222" {
+		t.Errorf("connection name %q", connName)
+	}
+	expected := waveobj.MetaMapType{
+		"ssh:identityfile":   []any{filepath.Join(dir, "work")},
+		"ssh:proxyjump":      []any{"jump@bastion.example.com"},
+		"ssh:localforward":   []any{"8080 localhost:80"},
+		"ssh:remoteforward":  []any{"2222 localhost:22"},
+		"ssh:dynamicforward": []any{"1080"},
+	}
+	if !reflect.DeepEqual(meta, expected) || len(warnings) != 0 {
+		t.Errorf("got %v (warnings %v)", meta, warnings)
+	}
+
+	// kitty's format, with an unsupported proxy and a .ppk key without an openssh key
+	kittyFile := "HostName\\db.example.com\\\r\nUserName\\dba\\\r\nPortNumber\\22\\\r\nPublicKeyFile\\C:\\keys\\db.ppk\\\r\nProxyMethod\\2\\\r\nProxyHost\\proxy\\\r\n"
+	session = parsePuttySessionFile("db", "db", []byte(kittyFile))
+	connName, meta, warnings, err = convertPuttySession(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if connName != "dba@db.example.com" || len(meta) != 0 || len(warnings) != 2 {
+		t.Errorf("got %q %v (warnings %v)", connName, meta, warnings)
+	}
+
+	session = parsePuttySessionFile("serial", "serial", []byte("Protocol=serial\nHostName=\n"))
+	if _, _, _, err := convertPuttySession(session); err == nil {
+		t.Errorf("serial sessions should be skipped")
+	}
+}
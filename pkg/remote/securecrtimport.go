@@ -0,0 +1,158 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+)
+
+// imports the sessions of a SecureCRT xml export (File > Export Settings).  sessions are the keys
+// under "Sessions" that have a Hostname (the other keys are folders).  a session's firewall can be
+// another session ("Session:folder/name"), which is its jump host.
+
+const secureCrtDefaultSession = "Default"
+const secureCrtFirewallSessionPrefix = "Session:"
+
+type secureCrtExport struct {
+	XMLName xml.Name        `xml:"VanDyke"`
+	Keys    []*secureCrtKey `xml:"key"`
+}
+
+type secureCrtKey struct {
+	Name    string           `xml:"name,attr"`
+	Keys    []*secureCrtKey  `xml:"key"`
+	Strings []secureCrtValue `xml:"string"`
+	Dwords  []secureCrtValue `xml:"dword"`
+}
+
+type secureCrtValue struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:",chardata"`
+}
+
+type secureCrtSession struct {
+	Path string // folder/name
+	Key  *secureCrtKey
+}
+
+func (k *secureCrtKey) getString(name string) string {
+	for _, val := range k.Strings {
+		if val.Name == name {
+			return strings.TrimSpace(val.Value)
+		}
+	}
+	return ""
+}
+
+func (k *secureCrtKey) getDword(name string, def int) int {
+	for _, val := range k.Dwords {
+		if val.Name == name {
+			if intVal, err := strconv.Atoi(strings.TrimSpace(val.Value)); err == nil {
+				return intVal
+			}
+		}
+	}
+	return def
+}
+
+func (k *secureCrtKey) isSession() bool {
+	return k.getString("Hostname") != "" || k.getString("Protocol Name") != ""
+}
+
+func collectSecureCrtSessions(key *secureCrtKey, folder string, sessions []*secureCrtSession) []*secureCrtSession {
+	for _, child := range key.Keys {
+		path := child.Name
+		if folder != "" {
+			path = folder + "/" + child.Name
+		}
+		if child.isSession() {
+			sessions = append(sessions, &secureCrtSession{Path: path, Key: child})
+		} else {
+			sessions = collectSecureCrtSessions(child, path, sessions)
+		}
+	}
+	return sessions
+}
+
+func (s *secureCrtSession) connName() (string, error) {
+	protocol := s.Key.getString("Protocol Name")
+	if protocol != "" && !strings.EqualFold(protocol, "SSH2") {
+		return "", fmt.Errorf("%s sessions are not supported", protocol)
+	}
+	return makeImportConnName(s.Key.getString("Username"), s.Key.getString("Hostname"), s.Key.getDword("[SSH2] Port", 22))
+}
+
+func parseSecureCrtExport(data []byte) ([]*importedConn, error) {
+	var export secureCrtExport
+	if err := xml.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("not a securecrt export: %w", err)
+	}
+	var sessions []*secureCrtSession
+	for _, key := range export.Keys {
+		if key.Name == "Sessions" {
+			sessions = collectSecureCrtSessions(key, "", sessions)
+		}
+	}
+	sessionConns := make(map[string]string)
+	for _, session := range sessions {
+		if connName, err := session.connName(); err == nil {
+			sessionConns[session.Path] = connName
+		}
+	}
+	var rtn []*importedConn
+	for _, session := range sessions {
+		if session.Path == secureCrtDefaultSession {
+			continue
+		}
+		conn := &importedConn{Session: session.Path}
+		rtn = append(rtn, conn)
+		conn.ConnName, conn.Err = session.connName()
+		if conn.Err != nil {
+			continue
+		}
+		conn.Meta = make(waveobj.MetaMapType)
+		// the key file is saved as "path::rawkey" (or with another key format after the "::")
+		if identityFile, _, _ := strings.Cut(session.Key.getString("Identity Filename V2"), "::"); identityFile != "" {
+			setImportListValue(conn.Meta, "ssh:identityfile", []string{identityFile})
+		}
+		firewall := session.Key.getString("Firewall Name")
+		switch {
+		case firewall == "" || strings.EqualFold(firewall, "None"):
+		case strings.HasPrefix(firewall, secureCrtFirewallSessionPrefix):
+			jumpSession := strings.TrimPrefix(firewall, secureCrtFirewallSessionPrefix)
+			if jumpConn, ok := sessionConns[jumpSession]; ok {
+				setImportListValue(conn.Meta, "ssh:proxyjump", []string{jumpConn})
+			} else {
+				conn.Warnings = append(conn.Warnings, fmt.Sprintf("jump session %q not found, not imported", jumpSession))
+			}
+		default:
+			conn.Warnings = append(conn.Warnings, fmt.Sprintf("connecting through the firewall %q is not supported, not imported", firewall))
+		}
+	}
+	return rtn, nil
+}
+
+type secureCrtImporter struct{}
+
+func (secureCrtImporter) ReadConns(path string) ([]*importedConn, error) {
+	if path == "" {
+		return nil, fmt.Errorf("give the path of the securecrt xml export")
+	}
+	path, err := wavebase.ExpandHomeDir(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseSecureCrtExport(data)
+}
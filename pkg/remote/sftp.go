@@ -0,0 +1,583 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// a minimal sftp (version 3) client over the "sftp" subsystem, for installing files on hosts
+// without relying on their shell.  requests are sent one at a time, except for the writes of an
+// upload, which are pipelined (up to sftpMaxPendingWrites) so that the upload isn't bound by the
+// round trip time.
+
+const sftpProtocolVersion = 3
+const sftpChunkSize = 32 * 1024 // the largest write every server accepts
+const sftpMaxPendingWrites = 64
+const sftpMaxPacketSize = 256 * 1024
+const sftpPosixRenameExt = "posix-rename@openssh.com"
+
+const (
+	sftpPacket_Init     = 1
+	sftpPacket_Version  = 2
+	sftpPacket_Open     = 3
+	sftpPacket_Close    = 4
+	sftpPacket_Read     = 5
+	sftpPacket_Write    = 6
+	sftpPacket_Setstat  = 9
+	sftpPacket_Remove   = 13
+	sftpPacket_Mkdir    = 14
+	sftpPacket_Realpath = 16
+	sftpPacket_Stat     = 17
+	sftpPacket_Rename   = 18
+	sftpPacket_Status   = 101
+	sftpPacket_Handle   = 102
+	sftpPacket_Data     = 103
+	sftpPacket_Name     = 104
+	sftpPacket_Attrs    = 105
+	sftpPacket_Extended = 200
+)
+
+const (
+	sftpStatus_Ok         = 0
+	sftpStatus_Eof        = 1
+	sftpStatus_NoSuchFile = 2
+)
+
+const (
+	sftpOpen_Read  = 0x01
+	sftpOpen_Write = 0x02
+	sftpOpen_Creat = 0x08
+	sftpOpen_Trunc = 0x10
+)
+
+const (
+	sftpAttr_Size        = 0x01
+	sftpAttr_UidGid      = 0x02
+	sftpAttr_Permissions = 0x04
+	sftpAttr_AcModTime   = 0x08
+	sftpAttr_Extended    = 0x80000000
+)
+
+const sftpModeTypeMask = 0170000
+const sftpModeDir = 0040000
+
+// the host has no sftp subsystem (the install falls back to the shell)
+var ErrSftpUnavailable = errors.New("sftp is not available")
+
+// the error of an sftp STATUS reply
+type SftpStatusError struct {
+	Code    uint32
+	Message string
+}
+
+func (e *SftpStatusError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("sftp: %s (status %d)", e.Message, e.Code)
+	}
+	return fmt.Sprintf("sftp: status %d", e.Code)
+}
+
+func isSftpNoSuchFile(err error) bool {
+	var statusErr *SftpStatusError
+	return errors.As(err, &statusErr) && statusErr.Code == sftpStatus_NoSuchFile
+}
+
+type sftpAttrs struct {
+	Size        uint64
+	Permissions uint32
+	HasPerms    bool
+}
+
+func (a *sftpAttrs) isDir() bool {
+	return a.HasPerms && a.Permissions&sftpModeTypeMask == sftpModeDir
+}
+
+type sftpClient struct {
+	reader     io.Reader
+	writer     io.WriteCloser
+	closeFn    func() error
+	nextId     uint32
+	extensions map[string]string
+}
+
+// starts the sftp subsystem on a new session of client
+func newSftpClient(client *ssh.Client) (*sftpClient, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		session.Close()
+		return nil, fmt.Errorf("%w: %v", ErrSftpUnavailable, err)
+	}
+	rtn, err := startSftpClient(stdout, stdin, session.Close)
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	return rtn, nil
+}
+
+// does the version exchange on an sftp stream
+func startSftpClient(reader io.Reader, writer io.WriteCloser, closeFn func() error) (*sftpClient, error) {
+	c := &sftpClient{reader: reader, writer: writer, closeFn: closeFn, extensions: make(map[string]string)}
+	if err := c.writePacket(sftpPacket_Init, binary.BigEndian.AppendUint32(nil, sftpProtocolVersion)); err != nil {
+		return nil, fmt.Errorf("sftp init: %w", err)
+	}
+	pktType, data, err := c.readPacket()
+	if err != nil {
+		return nil, fmt.Errorf("sftp init: %w", err)
+	}
+	if pktType != sftpPacket_Version {
+		return nil, fmt.Errorf("sftp init: unexpected packet %d", pktType)
+	}
+	buf := &sftpBuf{data: data}
+	version := buf.uint32()
+	for buf.err == nil && len(buf.data) > 0 {
+		name := buf.string()
+		c.extensions[name] = buf.string()
+	}
+	if buf.err != nil {
+		return nil, fmt.Errorf("sftp init: %w", buf.err)
+	}
+	if version < sftpProtocolVersion {
+		return nil, fmt.Errorf("sftp init: unsupported version %d", version)
+	}
+	return c, nil
+}
+
+func (c *sftpClient) Close() error {
+	c.writer.Close()
+	if c.closeFn != nil {
+		return c.closeFn()
+	}
+	return nil
+}
+
+// sends a packet (the id, if the packet has one, is the start of payload)
+func (c *sftpClient) writePacket(pktType byte, payload []byte) error {
+	pkt := make([]byte, 5, 5+len(payload))
+	binary.BigEndian.PutUint32(pkt, uint32(1+len(payload)))
+	pkt[4] = pktType
+	_, err := c.writer.Write(append(pkt, payload...))
+	return err
+}
+
+func (c *sftpClient) readPacket() (byte, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return 0, nil, err
+	}
+	pktLen := binary.BigEndian.Uint32(header)
+	if pktLen < 1 || pktLen > sftpMaxPacketSize {
+		return 0, nil, fmt.Errorf("bad sftp packet length %d", pktLen)
+	}
+	data := make([]byte, pktLen-1)
+	if _, err := io.ReadFull(c.reader, data); err != nil {
+		return 0, nil, err
+	}
+	return header[4], data, nil
+}
+
+// sends a request, returning its id
+func (c *sftpClient) sendRequest(pktType byte, payload []byte) (uint32, error) {
+	c.nextId++
+	id := c.nextId
+	return id, c.writePacket(pktType, append(binary.BigEndian.AppendUint32(nil, id), payload...))
+}
+
+// reads a reply, returning its id and the rest of it (a STATUS reply that isn't OK is an error)
+func (c *sftpClient) readReply() (uint32, byte, *sftpBuf, error) {
+	pktType, data, err := c.readPacket()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	buf := &sftpBuf{data: data}
+	id := buf.uint32()
+	if buf.err != nil {
+		return 0, 0, nil, buf.err
+	}
+	if pktType == sftpPacket_Status {
+		code := buf.uint32()
+		message := buf.string()
+		if buf.err == nil && code != sftpStatus_Ok {
+			return id, pktType, buf, &SftpStatusError{Code: code, Message: message}
+		}
+	}
+	return id, pktType, buf, nil
+}
+
+// sends a request and waits for its reply, which has to be of type expectedType
+func (c *sftpClient) request(pktType byte, payload []byte, expectedType byte) (*sftpBuf, error) {
+	id, err := c.sendRequest(pktType, payload)
+	if err != nil {
+		return nil, err
+	}
+	replyId, replyType, buf, err := c.readReply()
+	if err != nil {
+		return nil, err
+	}
+	if replyId != id {
+		return nil, fmt.Errorf("sftp: reply for request %d, expected %d", replyId, id)
+	}
+	if replyType != expectedType {
+		return nil, fmt.Errorf("sftp: unexpected reply %d to request %d", replyType, pktType)
+	}
+	return buf, nil
+}
+
+func (c *sftpClient) realPath(p string) (string, error) {
+	buf, err := c.request(sftpPacket_Realpath, appendSftpString(nil, p), sftpPacket_Name)
+	if err != nil {
+		return "", err
+	}
+	if buf.uint32() < 1 {
+		return "", fmt.Errorf("sftp: no path for %s", p)
+	}
+	rtn := buf.string()
+	return rtn, buf.err
+}
+
+func (c *sftpClient) stat(p string) (*sftpAttrs, error) {
+	buf, err := c.request(sftpPacket_Stat, appendSftpString(nil, p), sftpPacket_Attrs)
+	if err != nil {
+		return nil, err
+	}
+	attrs := buf.attrs()
+	return attrs, buf.err
+}
+
+func (c *sftpClient) mkdir(p string, perm uint32) error {
+	_, err := c.request(sftpPacket_Mkdir, appendSftpPermAttrs(appendSftpString(nil, p), perm), sftpPacket_Status)
+	return err
+}
+
+// creates the directory and its parents (like mkdir -p)
+func (c *sftpClient) mkdirAll(p string, perm uint32) error {
+	attrs, err := c.stat(p)
+	if err == nil {
+		if !attrs.isDir() {
+			return fmt.Errorf("%s is not a directory", p)
+		}
+		return nil
+	}
+	if !isSftpNoSuchFile(err) {
+		return err
+	}
+	if parent := path.Dir(p); parent != p {
+		if err := c.mkdirAll(parent, perm); err != nil {
+			return err
+		}
+	}
+	return c.mkdir(p, perm)
+}
+
+func (c *sftpClient) setPermissions(p string, perm uint32) error {
+	_, err := c.request(sftpPacket_Setstat, appendSftpPermAttrs(appendSftpString(nil, p), perm), sftpPacket_Status)
+	return err
+}
+
+func (c *sftpClient) remove(p string) error {
+	_, err := c.request(sftpPacket_Remove, appendSftpString(nil, p), sftpPacket_Status)
+	return err
+}
+
+// renames oldPath to newPath, replacing newPath (atomically if the server has posix-rename)
+func (c *sftpClient) rename(oldPath string, newPath string) error {
+	if _, ok := c.extensions[sftpPosixRenameExt]; ok {
+		payload := appendSftpString(appendSftpString(appendSftpString(nil, sftpPosixRenameExt), oldPath), newPath)
+		_, err := c.request(sftpPacket_Extended, payload, sftpPacket_Status)
+		return err
+	}
+	// a plain rename fails when newPath exists
+	if err := c.remove(newPath); err != nil && !isSftpNoSuchFile(err) {
+		return err
+	}
+	_, err := c.request(sftpPacket_Rename, appendSftpString(appendSftpString(nil, oldPath), newPath), sftpPacket_Status)
+	return err
+}
+
+func (c *sftpClient) open(p string, flags uint32, perm uint32) (string, error) {
+	payload := binary.BigEndian.AppendUint32(appendSftpString(nil, p), flags)
+	buf, err := c.request(sftpPacket_Open, appendSftpPermAttrs(payload, perm), sftpPacket_Handle)
+	if err != nil {
+		return "", err
+	}
+	handle := buf.string()
+	return handle, buf.err
+}
+
+func (c *sftpClient) closeHandle(handle string) error {
+	_, err := c.request(sftpPacket_Close, appendSftpString(nil, handle), sftpPacket_Status)
+	return err
+}
+
+// writes the contents of r to p (created or truncated), returning the number of bytes written
+func (c *sftpClient) writeFile(p string, r io.Reader, perm uint32) (int64, error) {
+	handle, err := c.open(p, sftpOpen_Write|sftpOpen_Creat|sftpOpen_Trunc, perm)
+	if err != nil {
+		return 0, err
+	}
+	written, err := c.writeHandle(handle, r)
+	closeErr := c.closeHandle(handle)
+	if err == nil {
+		err = closeErr
+	}
+	return written, err
+}
+
+func (c *sftpClient) writeHandle(handle string, r io.Reader) (int64, error) {
+	pending := make(map[uint32]bool)
+	var offset int64
+	var firstErr error
+	// waits for one reply (the server may answer out of order)
+	waitOne := func() {
+		id, _, _, err := c.readReply()
+		if !pending[id] && err == nil {
+			err = fmt.Errorf("sftp: unexpected reply for request %d", id)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(pending, id)
+	}
+	chunk := make([]byte, sftpChunkSize)
+	for firstErr == nil {
+		n, readErr := io.ReadFull(r, chunk)
+		if n > 0 {
+			payload := appendSftpString(nil, handle)
+			payload = binary.BigEndian.AppendUint64(payload, uint64(offset))
+			payload = appendSftpBytes(payload, chunk[:n])
+			id, err := c.sendRequest(sftpPacket_Write, payload)
+			if err != nil {
+				return offset, err
+			}
+			pending[id] = true
+			offset += int64(n)
+			if len(pending) >= sftpMaxPendingWrites {
+				waitOne()
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			firstErr = readErr
+		}
+	}
+	for len(pending) > 0 {
+		pendingBefore := len(pending)
+		waitOne()
+		if len(pending) == pendingBefore {
+			// the connection is broken, the other replies won't come
+			break
+		}
+	}
+	return offset, firstErr
+}
+
+// the sha256 of the file at p (read back over sftp)
+func (c *sftpClient) sha256File(p string) (string, error) {
+	handle, err := c.open(p, sftpOpen_Read, 0)
+	if err != nil {
+		return "", err
+	}
+	defer c.closeHandle(handle)
+	hash := sha256.New()
+	var offset uint64
+	for {
+		payload := binary.BigEndian.AppendUint64(appendSftpString(nil, handle), offset)
+		payload = binary.BigEndian.AppendUint32(payload, sftpChunkSize)
+		buf, err := c.request(sftpPacket_Read, payload, sftpPacket_Data)
+		var statusErr *SftpStatusError
+		if errors.As(err, &statusErr) && statusErr.Code == sftpStatus_Eof {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		data := buf.bytes()
+		if buf.err != nil {
+			return "", buf.err
+		}
+		hash.Write(data)
+		offset += uint64(len(data))
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func appendSftpBytes(b []byte, data []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(data)))
+	return append(b, data...)
+}
+
+func appendSftpString(b []byte, s string) []byte {
+	return appendSftpBytes(b, []byte(s))
+}
+
+// attrs with only the permissions (0 for no attrs)
+func appendSftpPermAttrs(b []byte, perm uint32) []byte {
+	if perm == 0 {
+		return binary.BigEndian.AppendUint32(b, 0)
+	}
+	b = binary.BigEndian.AppendUint32(b, sftpAttr_Permissions)
+	return binary.BigEndian.AppendUint32(b, perm)
+}
+
+// reads the fields of a packet (the first error sticks, later reads return zero values)
+type sftpBuf struct {
+	data []byte
+	err  error
+}
+
+func (b *sftpBuf) take(n int) []byte {
+	if b.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(b.data) {
+		b.err = errors.New("sftp: short packet")
+		return nil
+	}
+	rtn := b.data[:n]
+	b.data = b.data[n:]
+	return rtn
+}
+
+func (b *sftpBuf) uint32() uint32 {
+	if data := b.take(4); data != nil {
+		return binary.BigEndian.Uint32(data)
+	}
+	return 0
+}
+
+func (b *sftpBuf) uint64() uint64 {
+	if data := b.take(8); data != nil {
+		return binary.BigEndian.Uint64(data)
+	}
+	return 0
+}
+
+func (b *sftpBuf) bytes() []byte {
+	n := b.uint32()
+	if b.err != nil {
+		return nil
+	}
+	return b.take(int(n))
+}
+
+func (b *sftpBuf) string() string {
+	return string(b.bytes())
+}
+
+func (b *sftpBuf) attrs() *sftpAttrs {
+	rtn := &sftpAttrs{}
+	flags := b.uint32()
+	if flags&sftpAttr_Size != 0 {
+		rtn.Size = b.uint64()
+	}
+	if flags&sftpAttr_UidGid != 0 {
+		b.take(8)
+	}
+	if flags&sftpAttr_Permissions != 0 {
+		rtn.Permissions = b.uint32()
+		rtn.HasPerms = true
+	}
+	if flags&sftpAttr_AcModTime != 0 {
+		b.take(8)
+	}
+	if flags&sftpAttr_Extended != 0 {
+		count := b.uint32()
+		for i := uint32(0); i < count && b.err == nil; i++ {
+			b.string()
+			b.string()
+		}
+	}
+	return rtn
+}
+
+// resolves a "~/" path against the sftp home directory (where the server starts)
+func resolveSftpPath(c *sftpClient, p string) (string, error) {
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p, nil
+	}
+	home, err := c.realPath(".")
+	if err != nil {
+		return "", fmt.Errorf("cannot find the home directory: %w", err)
+	}
+	return path.Join(home, strings.TrimPrefix(p, "~")), nil
+}
+
+// installs the local file sourcePath at destPath ("~/" is the remote home) over sftp: the file is
+// uploaded next to destPath, checked against the sha256 of sourcePath, made executable and then
+// renamed over destPath, so a failed upload never leaves a partial file in place.
+func SftpInstallFile(client *ssh.Client, sourcePath string, destPath string) error {
+	input, err := os.Open(sourcePath)
+	if err != nil {
+		return fmt.Errorf("cannot open local file %s to send to host: %v", sourcePath, err)
+	}
+	defer input.Close()
+	c, err := newSftpClient(client)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	installPath, err := resolveSftpPath(c, destPath)
+	if err != nil {
+		return err
+	}
+	if err := c.mkdirAll(path.Dir(installPath), 0755); err != nil {
+		return fmt.Errorf("cannot create %s: %w", path.Dir(installPath), err)
+	}
+	tempPath := installPath + ".temp"
+	localHash := sha256.New()
+	if _, err := c.writeFile(tempPath, io.TeeReader(input, localHash), 0755); err != nil {
+		c.remove(tempPath)
+		return fmt.Errorf("cannot upload %s: %w", tempPath, err)
+	}
+	expectedSum := hex.EncodeToString(localHash.Sum(nil))
+	remoteSum, err := remoteSha256(client, tempPath)
+	if err == nil && remoteSum == "" {
+		// no checksum tool on the host, the file is read back instead
+		remoteSum, err = c.sha256File(tempPath)
+	}
+	if err != nil {
+		c.remove(tempPath)
+		return fmt.Errorf("cannot verify %s: %w", tempPath, err)
+	}
+	if remoteSum != expectedSum {
+		c.remove(tempPath)
+		return fmt.Errorf("checksum mismatch after uploading %s (expected %s, got %s)", installPath, expectedSum, remoteSum)
+	}
+	// the open mode is subject to the umask
+	if err := c.setPermissions(tempPath, 0755); err != nil {
+		c.remove(tempPath)
+		return err
+	}
+	if err := c.rename(tempPath, installPath); err != nil {
+		c.remove(tempPath)
+		return fmt.Errorf("cannot install %s: %w", installPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"path"
+	"testing"
+)
+
+// a fake sftp server with an in-memory filesystem (home is /home/user, and a plain rename fails
+// when the target exists, like the sftp v3 spec says).  replies are queued, like the window of an
+// ssh channel, so the pipelined writes don't block on the replies.
+type fakeSftpServer struct {
+	reader io.Reader
+	writer chan []byte
+	dirs   map[string]bool
+	files  map[string][]byte
+	perms  map[string]uint32
+	writes int
+}
+
+func (s *fakeSftpServer) reply(pktType byte, id uint32, payload []byte) {
+	pkt := binary.BigEndian.AppendUint32(nil, uint32(5+len(payload)))
+	pkt = append(pkt, pktType)
+	pkt = binary.BigEndian.AppendUint32(pkt, id)
+	s.writer <- append(pkt, payload...)
+}
+
+func (s *fakeSftpServer) status(id uint32, code uint32) {
+	s.reply(sftpPacket_Status, id, appendSftpString(appendSftpString(binary.BigEndian.AppendUint32(nil, code), ""), ""))
+}
+
+func (s *fakeSftpServer) serve() {
+	header := make([]byte, 5)
+	for {
+		if _, err := io.ReadFull(s.reader, header); err != nil {
+			return
+		}
+		data := make([]byte, binary.BigEndian.Uint32(header)-1)
+		if _, err := io.ReadFull(s.reader, data); err != nil {
+			return
+		}
+		buf := &sftpBuf{data: data}
+		if header[4] == sftpPacket_Init {
+			pkt := binary.BigEndian.AppendUint32(nil, 5)
+			pkt = append(pkt, sftpPacket_Version)
+			s.writer <- binary.BigEndian.AppendUint32(pkt, sftpProtocolVersion)
+			continue
+		}
+		id := buf.uint32()
+		switch header[4] {
+		case sftpPacket_Realpath:
+			s.reply(sftpPacket_Name, id, binary.BigEndian.AppendUint32(appendSftpString(appendSftpString(binary.BigEndian.AppendUint32(nil, 1), "/home/user"), ""), 0))
+		case sftpPacket_Stat:
+			p := buf.string()
+			if s.dirs[p] {
+				s.reply(sftpPacket_Attrs, id, appendSftpPermAttrs(nil, sftpModeDir|0755))
+			} else if data, ok := s.files[p]; ok {
+				attrs := binary.BigEndian.AppendUint32(nil, sftpAttr_Size)
+				s.reply(sftpPacket_Attrs, id, binary.BigEndian.AppendUint64(attrs, uint64(len(data))))
+			} else {
+				s.status(id, sftpStatus_NoSuchFile)
+			}
+		case sftpPacket_Mkdir:
+			p := buf.string()
+			if !s.dirs[path.Dir(p)] {
+				s.status(id, sftpStatus_NoSuchFile)
+				continue
+			}
+			s.dirs[p] = true
+			s.status(id, sftpStatus_Ok)
+		case sftpPacket_Open:
+			p := buf.string()
+			flags := buf.uint32()
+			if flags&sftpOpen_Creat != 0 {
+				s.files[p] = nil
+			} else if _, ok := s.files[p]; !ok {
+				s.status(id, sftpStatus_NoSuchFile)
+				continue
+			}
+			s.reply(sftpPacket_Handle, id, appendSftpString(nil, p))
+		case sftpPacket_Close:
+			s.status(id, sftpStatus_Ok)
+		case sftpPacket_Write:
+			p := buf.string()
+			offset := buf.uint64()
+			chunk := buf.bytes()
+			if offset != uint64(len(s.files[p])) {
+				s.status(id, 4)
+				continue
+			}
+			s.files[p] = append(s.files[p], chunk...)
+			s.writes++
+			s.status(id, sftpStatus_Ok)
+		case sftpPacket_Read:
+			p := buf.string()
+			offset := buf.uint64()
+			length := uint64(buf.uint32())
+			data := s.files[p]
+			if offset >= uint64(len(data)) {
+				s.status(id, sftpStatus_Eof)
+				continue
+			}
+			s.reply(sftpPacket_Data, id, appendSftpBytes(nil, data[offset:min(offset+length, uint64(len(data)))]))
+		case sftpPacket_Setstat:
+			p := buf.string()
+			attrs := buf.attrs()
+			s.perms[p] = attrs.Permissions
+			s.status(id, sftpStatus_Ok)
+		case sftpPacket_Remove:
+			p := buf.string()
+			if _, ok := s.files[p]; !ok {
+				s.status(id, sftpStatus_NoSuchFile)
+				continue
+			}
+			delete(s.files, p)
+			s.status(id, sftpStatus_Ok)
+		case sftpPacket_Rename:
+			oldPath, newPath := buf.string(), buf.string()
+			if _, ok := s.files[newPath]; ok {
+				s.status(id, 4)
+				continue
+			}
+			s.files[newPath] = s.files[oldPath]
+			s.perms[newPath] = s.perms[oldPath]
+			delete(s.files, oldPath)
+			s.status(id, sftpStatus_Ok)
+		default:
+			s.status(id, 8)
+		}
+	}
+}
+
+func TestSftpUpload(t *testing.T) {
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+	server := &fakeSftpServer{
+		reader: serverReader,
+		writer: make(chan []byte, 2*sftpMaxPendingWrites),
+		dirs:   map[string]bool{"/": true, "/home": true, "/home/user": true},
+		files:  map[string][]byte{"/home/user/.waveterm/bin/wsh": []byte("old wsh")},
+		perms:  make(map[string]uint32),
+	}
+	go server.serve()
+	go func() {
+		for pkt := range server.writer {
+			serverWriter.Write(pkt)
+		}
+	}()
+	c, err := startSftpClient(clientReader, clientWriter, nil)
+	if err != nil {
+		t.Fatalf("startSftpClient: %v", err)
+	}
+	defer c.Close()
+
+	installPath, err := resolveSftpPath(c, "~/.waveterm/bin/wsh")
+	if err != nil || installPath != "/home/user/.waveterm/bin/wsh" {
+		t.Fatalf("resolveSftpPath: %q, %v", installPath, err)
+	}
+	if err := c.mkdirAll(path.Dir(installPath), 0755); err != nil {
+		t.Fatalf("mkdirAll: %v", err)
+	}
+	if !server.dirs["/home/user/.waveterm"] || !server.dirs["/home/user/.waveterm/bin"] {
+		t.Errorf("directories not created: %v", server.dirs)
+	}
+	// more than sftpMaxPendingWrites chunks, so the writes wait for replies
+	data := bytes.Repeat([]byte("0123456789abcdef"), sftpChunkSize*(sftpMaxPendingWrites+3)/16+100)
+	written, err := c.writeFile(installPath+".temp", bytes.NewReader(data), 0755)
+	if err != nil || written != int64(len(data)) {
+		t.Fatalf("writeFile: %d, %v", written, err)
+	}
+	if server.writes != sftpMaxPendingWrites+4 {
+		t.Errorf("expected %d writes, got %d", sftpMaxPendingWrites+4, server.writes)
+	}
+	sum, err := c.sha256File(installPath + ".temp")
+	expectedSum := sha256.Sum256(data)
+	if err != nil || sum != hex.EncodeToString(expectedSum[:]) {
+		t.Errorf("sha256File: %q, %v", sum, err)
+	}
+	if err := c.setPermissions(installPath+".temp", 0755); err != nil {
+		t.Fatalf("setPermissions: %v", err)
+	}
+	// no posix-rename, so the old file is removed first
+	if err := c.rename(installPath+".temp", installPath); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	if !bytes.Equal(server.files[installPath], data) || server.perms[installPath] != 0755 {
+		t.Errorf("install did not replace %s (%d bytes, perms %o)", installPath, len(server.files[installPath]), server.perms[installPath])
+	}
+	if _, ok := server.files[installPath+".temp"]; ok {
+		t.Errorf("temp file was left behind")
+	}
+	if _, err := c.stat("/home/user/nope"); !isSftpNoSuchFile(err) {
+		t.Errorf("expected no such file, got %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"golang.org/x/crypto/ssh"
+)
+
+// a minimal SOCKS5 server (RFC 1928) for DynamicForward (ssh -D).  only the CONNECT command with
+// no authentication is supported, which is what ssh supports as well (besides SOCKS4).
+
+const SocksHandshakeTimeout = 10 * time.Second
+
+const (
+	socks5Version = 0x05
+
+	socksMethodNoAuth       = 0x00
+	socksMethodNoAcceptable = 0xff
+
+	socksCmdConnect = 0x01
+
+	socksAtypIPv4   = 0x01
+	socksAtypDomain = 0x03
+	socksAtypIPv6   = 0x04
+
+	socksReplySuccess             = 0x00
+	socksReplyHostUnreachable     = 0x04
+	socksReplyCmdNotSupported     = 0x07
+	socksReplyAddrTypeUnsupported = 0x08
+)
+
+// reads the method negotiation and the request, returns the requested "host:port"
+func readSocksRequest(conn net.Conn) (string, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", fmt.Errorf("reading socks greeting: %w", err)
+	}
+	if header[0] != socks5Version {
+		return "", fmt.Errorf("unsupported socks version %d", header[0])
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", fmt.Errorf("reading socks methods: %w", err)
+	}
+	hasNoAuth := false
+	for _, method := range methods {
+		if method == socksMethodNoAuth {
+			hasNoAuth = true
+		}
+	}
+	if !hasNoAuth {
+		conn.Write([]byte{socks5Version, socksMethodNoAcceptable})
+		return "", fmt.Errorf("socks client requires authentication")
+	}
+	if _, err := conn.Write([]byte{socks5Version, socksMethodNoAuth}); err != nil {
+		return "", err
+	}
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(conn, req); err != nil {
+		return "", fmt.Errorf("reading socks request: %w", err)
+	}
+	if req[0] != socks5Version {
+		return "", fmt.Errorf("unsupported socks version %d", req[0])
+	}
+	if req[1] != socksCmdConnect {
+		writeSocksReply(conn, socksReplyCmdNotSupported)
+		return "", fmt.Errorf("unsupported socks command %d", req[1])
+	}
+	var host string
+	switch req[3] {
+	case socksAtypIPv4, socksAtypIPv6:
+		addrLen := net.IPv4len
+		if req[3] == socksAtypIPv6 {
+			addrLen = net.IPv6len
+		}
+		addr := make([]byte, addrLen)
+		if _, err := io.ReadFull(conn, addr); err != nil {
+			return "", fmt.Errorf("reading socks address: %w", err)
+		}
+		host = net.IP(addr).String()
+	case socksAtypDomain:
+		domainLen := make([]byte, 1)
+		if _, err := io.ReadFull(conn, domainLen); err != nil {
+			return "", fmt.Errorf("reading socks address: %w", err)
+		}
+		domain := make([]byte, domainLen[0])
+		if _, err := io.ReadFull(conn, domain); err != nil {
+			return "", fmt.Errorf("reading socks address: %w", err)
+		}
+		host = string(domain)
+	default:
+		writeSocksReply(conn, socksReplyAddrTypeUnsupported)
+		return "", fmt.Errorf("unsupported socks address type %d", req[3])
+	}
+	portBytes := make([]byte, 2)
+	if _, err := io.ReadFull(conn, portBytes); err != nil {
+		return "", fmt.Errorf("reading socks port: %w", err)
+	}
+	port := binary.BigEndian.Uint16(portBytes)
+	return net.JoinHostPort(host, strconv.Itoa(int(port))), nil
+}
+
+// the bound address isn't meaningful for a forward over ssh, so it is always 0.0.0.0:0
+func writeSocksReply(conn net.Conn, reply byte) error {
+	_, err := conn.Write([]byte{socks5Version, reply, 0x00, socksAtypIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+// does the socks handshake on conn, and connects to the requested address with dialFn
+func socksConnect(conn net.Conn, dialFn func(network string, addr string) (net.Conn, error)) (net.Conn, error) {
+	conn.SetDeadline(time.Now().Add(SocksHandshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+	targetAddr, err := readSocksRequest(conn)
+	if err != nil {
+		return nil, err
+	}
+	targetConn, err := dialFn("tcp", targetAddr)
+	if err != nil {
+		writeSocksReply(conn, socksReplyHostUnreachable)
+		return nil, fmt.Errorf("cannot connect to %s: %w", targetAddr, err)
+	}
+	if err := writeSocksReply(conn, socksReplySuccess); err != nil {
+		targetConn.Close()
+		return nil, err
+	}
+	return targetConn, nil
+}
+
+// listens locally as a SOCKS5 proxy, and dials the requested addresses through the ssh connection (ssh -D)
+func StartDynamicForward(client *ssh.Client, connName string, spec ForwardSpec, source string) (PortForward, error) {
+	listener, err := net.Listen(spec.ListenNetwork, spec.ListenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen on %s: %w", spec.ListenAddr, err)
+	}
+	connectFn := func(conn net.Conn) (net.Conn, error) {
+		return socksConnect(conn, client.Dial)
+	}
+	return startListenerForward(wshrpc.ForwardType_Dynamic, connName, spec, source, listener, connectFn), nil
+}
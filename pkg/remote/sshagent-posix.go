@@ -0,0 +1,21 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !windows
+
+package remote
+
+import (
+	"io"
+	"net"
+)
+
+// opens the ssh agent socket at agentPath (the IdentityAgent or SSH_AUTH_SOCK), also returns the
+// name of the agent for the logs
+func dialIdentityAgent(agentPath string) (io.ReadWriteCloser, string, error) {
+	conn, err := net.Dial("unix", agentPath)
+	if err != nil {
+		return nil, agentPath, err
+	}
+	return conn, agentPath, nil
+}
@@ -0,0 +1,220 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build windows
+
+package remote
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// on windows the ssh agent is usually the OpenSSH agent service, which listens on a named pipe,
+// or Pageant, which is asked through a shared memory mapping and a WM_COPYDATA message.  with no
+// IdentityAgent or SSH_AUTH_SOCK, the OpenSSH pipe is tried and then Pageant.  "pageant" as the
+// IdentityAgent picks Pageant, and a unix socket path (from wsl or cygwin agents) still works.
+
+const OpenSshAgentPipe = `\\.\pipe\openssh-ssh-agent`
+const PageantAgentName = "pageant"
+
+const (
+	agentPipeBusyRetries = 10
+	agentPipeBusyWait    = 50 * time.Millisecond
+	pageantMaxMsgLen     = 8192
+	pageantCopyDataId    = 0x804e50ba
+	wmCopyData           = 0x004A
+)
+
+var errPageantNotRunning = errors.New("pageant is not running")
+
+var (
+	modUser32        = windows.NewLazySystemDLL("user32.dll")
+	procFindWindowW  = modUser32.NewProc("FindWindowW")
+	procSendMessageW = modUser32.NewProc("SendMessageW")
+)
+
+var pageantLock = &sync.Mutex{}
+
+// COPYDATASTRUCT
+type copyDataStruct struct {
+	DwData uintptr
+	CbData uint32
+	LpData uintptr
+}
+
+// opens the ssh agent at agentPath (the IdentityAgent or SSH_AUTH_SOCK), also returns the name of
+// the agent for the logs
+func dialIdentityAgent(agentPath string) (io.ReadWriteCloser, string, error) {
+	if agentPath == "" {
+		conn, pipeErr := dialAgentPipe(OpenSshAgentPipe)
+		if pipeErr == nil {
+			return conn, OpenSshAgentPipe, nil
+		}
+		if findPageantWindow() != 0 {
+			return &pageantConn{}, PageantAgentName, nil
+		}
+		return nil, OpenSshAgentPipe, fmt.Errorf("%w, and %w", pipeErr, errPageantNotRunning)
+	}
+	if strings.EqualFold(agentPath, PageantAgentName) {
+		if findPageantWindow() == 0 {
+			return nil, PageantAgentName, errPageantNotRunning
+		}
+		return &pageantConn{}, PageantAgentName, nil
+	}
+	// ssh on windows also takes the pipe with forward slashes
+	if strings.HasPrefix(agentPath, "//./pipe/") {
+		agentPath = strings.ReplaceAll(agentPath, "/", `\`)
+	}
+	if strings.HasPrefix(strings.ToLower(agentPath), `\\.\pipe\`) {
+		conn, err := dialAgentPipe(agentPath)
+		return conn, agentPath, err
+	}
+	conn, err := net.Dial("unix", agentPath)
+	if err != nil {
+		return nil, agentPath, err
+	}
+	return conn, agentPath, nil
+}
+
+// opens a named pipe, waiting a little when all of its instances are busy
+func dialAgentPipe(pipePath string) (io.ReadWriteCloser, error) {
+	for try := 0; ; try++ {
+		file, err := os.OpenFile(pipePath, os.O_RDWR, 0)
+		if err == nil {
+			return file, nil
+		}
+		if !errors.Is(err, windows.ERROR_PIPE_BUSY) || try >= agentPipeBusyRetries {
+			return nil, err
+		}
+		time.Sleep(agentPipeBusyWait)
+	}
+}
+
+func findPageantWindow() uintptr {
+	if modUser32.Load() != nil || procFindWindowW.Find() != nil {
+		return 0
+	}
+	name, err := windows.UTF16PtrFromString("Pageant")
+	if err != nil {
+		return 0
+	}
+	hwnd, _, _ := procFindWindowW.Call(uintptr(unsafe.Pointer(name)), uintptr(unsafe.Pointer(name)))
+	return hwnd
+}
+
+// pageant answers one request at a time: the agent client writes a whole request and then reads
+// the reply, so the request is sent once it is complete, and the reply is buffered for the reads
+type pageantConn struct {
+	request []byte
+	reply   bytes.Buffer
+}
+
+func (c *pageantConn) Write(p []byte) (int, error) {
+	c.request = append(c.request, p...)
+	if len(c.request) < 4 || len(c.request) < 4+int(binary.BigEndian.Uint32(c.request)) {
+		return len(p), nil
+	}
+	reply, err := pageantQuery(c.request)
+	c.request = nil
+	if err != nil {
+		return 0, err
+	}
+	c.reply.Write(reply)
+	return len(p), nil
+}
+
+func (c *pageantConn) Read(p []byte) (int, error) {
+	if c.reply.Len() == 0 {
+		return 0, io.EOF
+	}
+	return c.reply.Read(p)
+}
+
+func (c *pageantConn) Close() error {
+	return nil
+}
+
+// the mapping must be owned by the user, pageant refuses requests from other users
+func pageantSecurityAttributes() (*windows.SecurityAttributes, error) {
+	tokenUser, err := windows.GetCurrentProcessToken().GetTokenUser()
+	if err != nil {
+		return nil, fmt.Errorf("getting the user sid: %w", err)
+	}
+	sd, err := windows.NewSecurityDescriptor()
+	if err != nil {
+		return nil, err
+	}
+	if err := sd.SetOwner(tokenUser.User.Sid, false); err != nil {
+		return nil, err
+	}
+	return &windows.SecurityAttributes{
+		Length:             uint32(unsafe.Sizeof(windows.SecurityAttributes{})),
+		SecurityDescriptor: sd,
+	}, nil
+}
+
+// sends an agent request to pageant: the request is written to a named shared memory mapping,
+// the name of the mapping is sent to the pageant window, and the reply replaces the request
+func pageantQuery(request []byte) ([]byte, error) {
+	if len(request) > pageantMaxMsgLen {
+		return nil, fmt.Errorf("agent request is too large for pageant (%d bytes)", len(request))
+	}
+	pageantLock.Lock()
+	defer pageantLock.Unlock()
+	hwnd := findPageantWindow()
+	if hwnd == 0 {
+		return nil, errPageantNotRunning
+	}
+	mapName := fmt.Sprintf("WavePageantRequest%08x", windows.GetCurrentThreadId())
+	mapNamePtr, err := windows.UTF16PtrFromString(mapName)
+	if err != nil {
+		return nil, err
+	}
+	sa, err := pageantSecurityAttributes()
+	if err != nil {
+		return nil, err
+	}
+	fileMap, err := windows.CreateFileMapping(windows.InvalidHandle, sa, windows.PAGE_READWRITE, 0, pageantMaxMsgLen, mapNamePtr)
+	if err != nil {
+		return nil, fmt.Errorf("creating the pageant request mapping: %w", err)
+	}
+	defer windows.CloseHandle(fileMap)
+	addr, err := windows.MapViewOfFile(fileMap, windows.FILE_MAP_WRITE, 0, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("mapping the pageant request: %w", err)
+	}
+	defer windows.UnmapViewOfFile(addr)
+	// the view is outside the go heap
+	buf := unsafe.Slice((*byte)(unsafe.Add(nil, addr)), pageantMaxMsgLen)
+	copy(buf, request)
+
+	mapNameBytes := append([]byte(mapName), 0)
+	cds := copyDataStruct{
+		DwData: pageantCopyDataId,
+		CbData: uint32(len(mapNameBytes)),
+		LpData: uintptr(unsafe.Pointer(&mapNameBytes[0])),
+	}
+	ret, _, _ := procSendMessageW.Call(hwnd, wmCopyData, 0, uintptr(unsafe.Pointer(&cds)))
+	runtime.KeepAlive(mapNameBytes)
+	if ret == 0 {
+		return nil, fmt.Errorf("pageant refused the request")
+	}
+	replyLen := binary.BigEndian.Uint32(buf)
+	if replyLen > pageantMaxMsgLen-4 {
+		return nil, fmt.Errorf("invalid pageant reply length %d", replyLen)
+	}
+	return bytes.Clone(buf[:4+replyLen]), nil
+}
@@ -0,0 +1,143 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"golang.org/x/crypto/ssh"
+)
+
+// the Ciphers, MACs, KexAlgorithms, and HostKeyAlgorithms keywords.  like ssh, a list starting
+// with "+" is added to the defaults, "-" removes algorithms from the defaults, "^" puts them
+// first, and any other list replaces the defaults.  names can have "*" and "?" wildcards.  the
+// defaults and the supported algorithms are golang.org/x/crypto/ssh's, so legacy algorithms
+// (like aes128-cbc or diffie-hellman-group1-sha1) can be turned on, but algorithms the library
+// doesn't have (like umac-64@openssh.com) are left out.
+
+var defaultSshCiphers = []string{
+	"aes128-gcm@openssh.com", "aes256-gcm@openssh.com", "chacha20-poly1305@openssh.com",
+	"aes128-ctr", "aes192-ctr", "aes256-ctr",
+}
+
+var supportedSshCiphers = append(slices.Clone(defaultSshCiphers),
+	"arcfour256", "arcfour128", "arcfour", "aes128-cbc", "3des-cbc",
+)
+
+var defaultSshMACs = []string{
+	"hmac-sha2-256-etm@openssh.com", "hmac-sha2-512-etm@openssh.com", "hmac-sha2-256", "hmac-sha2-512",
+	"hmac-sha1", "hmac-sha1-96",
+}
+
+var supportedSshMACs = defaultSshMACs
+
+var defaultSshKexAlgorithms = []string{
+	"curve25519-sha256", "curve25519-sha256@libssh.org",
+	"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+	"diffie-hellman-group14-sha256", "diffie-hellman-group14-sha1",
+}
+
+var supportedSshKexAlgorithms = append(slices.Clone(defaultSshKexAlgorithms),
+	"diffie-hellman-group16-sha512", "diffie-hellman-group-exchange-sha256",
+	"diffie-hellman-group-exchange-sha1", "diffie-hellman-group1-sha1",
+)
+
+var supportedSshHostKeyAlgorithms = []string{
+	ssh.CertAlgoED25519v01, ssh.CertAlgoECDSA256v01, ssh.CertAlgoECDSA384v01, ssh.CertAlgoECDSA521v01,
+	ssh.CertAlgoRSASHA512v01, ssh.CertAlgoRSASHA256v01, ssh.CertAlgoRSAv01, ssh.CertAlgoDSAv01,
+	ssh.KeyAlgoED25519, ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+	ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA, ssh.KeyAlgoDSA,
+}
+
+// applies an algorithm list (keyword is only for the errors) to defaults
+func applySshAlgorithmList(keyword string, list string, defaults []string, supported []string) ([]string, error) {
+	list = strings.TrimSpace(list)
+	if list == "" {
+		return defaults, nil
+	}
+	var op byte
+	if list[0] == '+' || list[0] == '-' || list[0] == '^' {
+		op, list = list[0], list[1:]
+	}
+	var patterns []string
+	for _, pattern := range strings.Split(list, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("%s %q has no algorithms", keyword, string(op)+list)
+	}
+	matchesAny := func(algo string) bool {
+		return slices.ContainsFunc(patterns, func(pattern string) bool { return matchSshPattern(pattern, algo) })
+	}
+	var named []string
+	for _, pattern := range patterns {
+		for _, algo := range supported {
+			if matchSshPattern(pattern, algo) && !slices.Contains(named, algo) {
+				named = append(named, algo)
+			}
+		}
+	}
+	var rtn []string
+	switch op {
+	case '+':
+		rtn = slices.Clone(defaults)
+		for _, algo := range named {
+			if !slices.Contains(rtn, algo) {
+				rtn = append(rtn, algo)
+			}
+		}
+	case '-':
+		rtn = slices.DeleteFunc(slices.Clone(defaults), matchesAny)
+	case '^':
+		rtn = append(named, slices.DeleteFunc(slices.Clone(defaults), func(algo string) bool { return slices.Contains(named, algo) })...)
+	default:
+		rtn = named
+	}
+	if len(rtn) == 0 {
+		return nil, fmt.Errorf("%s %q leaves no supported algorithms", keyword, strings.TrimSpace(string(op)+list))
+	}
+	return rtn, nil
+}
+
+// the ciphers, macs, and key exchanges for sshKeywords (nil slices keep the library defaults)
+func makeSshAlgorithmConfig(sshKeywords *wshrpc.ConnKeywords) (ssh.Config, error) {
+	var config ssh.Config
+	var err error
+	if sshKeywords.SshCiphers != "" {
+		if config.Ciphers, err = applySshAlgorithmList("Ciphers", sshKeywords.SshCiphers, defaultSshCiphers, supportedSshCiphers); err != nil {
+			return config, err
+		}
+	}
+	if sshKeywords.SshMACs != "" {
+		if config.MACs, err = applySshAlgorithmList("MACs", sshKeywords.SshMACs, defaultSshMACs, supportedSshMACs); err != nil {
+			return config, err
+		}
+	}
+	if sshKeywords.SshKexAlgorithms != "" {
+		if config.KeyExchanges, err = applySshAlgorithmList("KexAlgorithms", sshKeywords.SshKexAlgorithms, defaultSshKexAlgorithms, supportedSshKexAlgorithms); err != nil {
+			return config, err
+		}
+	}
+	return config, nil
+}
+
+// the host key algorithms for sshKeywords.  knownHostAlgos (the algorithms for the keys already
+// in known_hosts) come first in the defaults, so a known key isn't rejected for another type.
+func makeSshHostKeyAlgorithms(sshKeywords *wshrpc.ConnKeywords, knownHostAlgos []string) ([]string, error) {
+	if sshKeywords.SshHostKeyAlgorithms == "" {
+		return knownHostAlgos, nil
+	}
+	defaults := slices.Clone(knownHostAlgos)
+	for _, algo := range supportedSshHostKeyAlgorithms {
+		if !slices.Contains(defaults, algo) {
+			defaults = append(defaults, algo)
+		}
+	}
+	return applySshAlgorithmList("HostKeyAlgorithms", sshKeywords.SshHostKeyAlgorithms, defaults, supportedSshHostKeyAlgorithms)
+}
@@ -0,0 +1,42 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestApplySshAlgorithmList(t *testing.T) {
+	defaults := []string{"a-ctr", "b-gcm", "c-ctr"}
+	supported := []string{"a-ctr", "b-gcm", "c-ctr", "d-cbc", "e-cbc"}
+	tests := []struct {
+		list     string
+		expected []string
+	}{
+		{"", defaults},
+		{"+d-cbc", []string{"a-ctr", "b-gcm", "c-ctr", "d-cbc"}},
+		{"+*-cbc", []string{"a-ctr", "b-gcm", "c-ctr", "d-cbc", "e-cbc"}},
+		{"-*-ctr", []string{"b-gcm"}},
+		{"^c-ctr,e-cbc", []string{"c-ctr", "e-cbc", "a-ctr", "b-gcm"}},
+		{"e-cbc, b-gcm", []string{"e-cbc", "b-gcm"}},
+		{"e-cbc,unknown-cipher", []string{"e-cbc"}},
+		{"?-cbc", []string{"d-cbc", "e-cbc"}},
+	}
+	for _, test := range tests {
+		got, err := applySshAlgorithmList("Ciphers", test.list, defaults, supported)
+		if err != nil {
+			t.Errorf("%q: %v", test.list, err)
+			continue
+		}
+		if !slices.Equal(got, test.expected) {
+			t.Errorf("%q: got %v, expected %v", test.list, got, test.expected)
+		}
+	}
+	for _, bad := range []string{"unknown-cipher", "-*", "^"} {
+		if got, err := applySshAlgorithmList("Ciphers", bad, defaults, supported); err == nil {
+			t.Errorf("expected an error for %q, got %v", bad, got)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"github.com/wavetermdev/waveterm/pkg/remote/conndebug"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"golang.org/x/crypto/ssh"
+)
+
+// the banner a server sends before authentication (sshd's Banner, often a legal notice) is
+// published as a "banner" event with the text in Detail.  like ssh, control characters are
+// removed so a banner can't send escape sequences, and very long banners are cut short.
+
+const MaxSshBannerLen = 16 * 1024
+
+func sanitizeSshBanner(banner string) string {
+	banner = strings.ReplaceAll(banner, "\r\n", "\n")
+	banner = strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' {
+			return r
+		}
+		if unicode.IsControl(r) || r == unicode.ReplacementChar {
+			return -1
+		}
+		return r
+	}, banner)
+	if len(banner) > MaxSshBannerLen {
+		banner = strings.ToValidUTF8(banner[:MaxSshBannerLen], "") + "\n[banner truncated]"
+	}
+	return strings.TrimRight(banner, "\n\t ")
+}
+
+func makeBannerCallback(connCtx context.Context, debugInfo *ConnectionDebugInfo) ssh.BannerCallback {
+	return func(message string) error {
+		banner := sanitizeSshBanner(message)
+		if banner == "" {
+			return nil
+		}
+		conndebug.Logf(connCtx, "banner: %d bytes from the server", len(banner))
+		event := makeHopEvent(wshrpc.ConnEvent_Banner, debugInfo)
+		event.Detail = banner
+		publishConnEventCtx(connCtx, event)
+		return nil
+	}
+}
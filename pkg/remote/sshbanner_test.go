@@ -0,0 +1,31 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeSshBanner(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Authorized use only.\r\n", "Authorized use only."},
+		{"line one\n\tline two\n\n", "line one\n\tline two"},
+		{"\x1b[31mred\x1b[0m\x07", "[31mred[0m"},
+		{"caf\xc3\xa9 \xff", "café"},
+		{"\r\n\r\n", ""},
+	}
+	for _, test := range tests {
+		if got := sanitizeSshBanner(test.input); got != test.expected {
+			t.Errorf("%q: got %q, expected %q", test.input, got, test.expected)
+		}
+	}
+	long := sanitizeSshBanner(strings.Repeat("x", MaxSshBannerLen+100))
+	if !strings.HasSuffix(long, "[banner truncated]") || len(long) > MaxSshBannerLen+len("\n[banner truncated]") {
+		t.Errorf("long banner not truncated (%d bytes)", len(long))
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
 	"math"
@@ -17,18 +18,24 @@ import (
 	"os/exec"
 	"os/user"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/kevinburke/ssh_config"
 	"github.com/skeema/knownhosts"
+	"github.com/wavetermdev/waveterm/pkg/audit"
+	"github.com/wavetermdev/waveterm/pkg/keychain"
+	"github.com/wavetermdev/waveterm/pkg/remote/conndebug"
 	"github.com/wavetermdev/waveterm/pkg/trimquotes"
 	"github.com/wavetermdev/waveterm/pkg/userinput"
 	"github.com/wavetermdev/waveterm/pkg/util/shellutil"
 	"github.com/wavetermdev/waveterm/pkg/wavebase"
 	"github.com/wavetermdev/waveterm/pkg/wconfig"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wtrace"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
 	xknownhosts "golang.org/x/crypto/ssh/knownhosts"
@@ -36,13 +43,16 @@ import (
 
 const SshProxyJumpMaxDepth = 10
 
-var waveSshConfigUserSettingsInternal *ssh_config.UserSettings
+// used when ConnectTimeout is not set, so a dropped SYN or a slow resolver can't hang a connect
+const DefaultSshConnectTimeout = 30 * time.Second
+
+var waveSshConfigUserSettingsInternal *SshConfigSettings
 var configUserSettingsOnce = &sync.Once{}
 
-func WaveSshConfigUserSettings() *ssh_config.UserSettings {
+func WaveSshConfigUserSettings() *SshConfigSettings {
 	configUserSettingsOnce.Do(func() {
-		waveSshConfigUserSettingsInternal = ssh_config.DefaultUserSettings
-		waveSshConfigUserSettingsInternal.IgnoreMatchDirective = true
+		waveSshConfigUserSettingsInternal = MakeSshConfigSettings(filepath.Join(wavebase.GetHomeDir(), ".ssh", "config"), filepath.Join("/", "etc", "ssh", "ssh_config"))
+		waveSshConfigUserSettingsInternal.generatedConfigPath = VagrantSshConfigPath()
 	})
 	return waveSshConfigUserSettingsInternal
 }
@@ -57,6 +67,10 @@ func (uice UserInputCancelError) Error() string {
 	return uice.Err.Error()
 }
 
+func (uice UserInputCancelError) Unwrap() error {
+	return uice.Err
+}
+
 type ConnectionDebugInfo struct {
 	CurrentClient *ssh.Client
 	NextOpts      *SSHOpts
@@ -75,6 +89,10 @@ func (ce ConnectionError) Error() string {
 	return fmt.Sprintf("Connecting from %v to %+#v (jump number %d), Error: %v", ce.CurrentClient, ce.NextOpts, ce.JumpNum, ce.Err)
 }
 
+func (ce ConnectionError) Unwrap() error {
+	return ce.Err
+}
+
 // This exists to trick the ssh library into continuing to try
 // different public keys even when the current key cannot be
 // properly parsed
@@ -127,20 +145,28 @@ func createPublicKeyCallback(connCtx context.Context, sshKeywords *wshrpc.ConnKe
 	var authSockSigners []ssh.Signer
 	authSockSigners = append(authSockSigners, authSockSignersExt...)
 	authSockSignersPtr := &authSockSigners
+	certs := loadCertificates(connCtx, sshKeywords, authSockSigners)
+	agentKeys := make(map[string]bool)
+	for _, authSockSigner := range authSockSigners {
+		agentKeys[string(authSockSigner.PublicKey().Marshal())] = true
+	}
 
 	return func() ([]ssh.Signer, error) {
 		// try auth sock
 		if len(*authSockSignersPtr) != 0 {
 			authSockSigner := (*authSockSignersPtr)[0]
 			*authSockSignersPtr = (*authSockSignersPtr)[1:]
-			return []ssh.Signer{authSockSigner}, nil
+			conndebug.Logf(connCtx, "publickey: offering agent key %s %s", authSockSigner.PublicKey().Type(), ssh.FingerprintSHA256(authSockSigner.PublicKey()))
+			return withCertSigners(connCtx, wrapSkAgentSigner(connCtx, authSockSigner), certs), nil
 		}
 
 		if len(*identityFilesPtr) == 0 {
+			conndebug.Logf(connCtx, "publickey: no identity files remaining")
 			return nil, ConnectionError{ConnectionDebugInfo: debugInfo, Err: fmt.Errorf("no identity files remaining")}
 		}
 		identityFile := (*identityFilesPtr)[0]
 		*identityFilesPtr = (*identityFilesPtr)[1:]
+		conndebug.Logf(connCtx, "publickey: trying identity file %s", identityFile)
 		privateKey, ok := existingKeys[identityFile]
 		if !ok {
 			log.Printf("error with existingKeys, this should never happen")
@@ -153,32 +179,92 @@ func createPublicKeyCallback(connCtx context.Context, sshKeywords *wshrpc.ConnKe
 			signer, err := ssh.NewSignerFromKey(unencryptedPrivateKey)
 			if err == nil {
 				if sshKeywords.SshAddKeysToAgent && agentClient != nil {
-					agentClient.Add(agent.AddedKey{
-						PrivateKey: unencryptedPrivateKey,
-					})
+					addKeyToAgent(agentClient, unencryptedPrivateKey, signer.PublicKey(), certs)
 				}
-				return []ssh.Signer{signer}, nil
+				return withCertSigners(connCtx, signer, certs), nil
 			}
 		}
 		if _, ok := err.(*ssh.PassphraseMissingError); !ok {
+			skKey, skErr := parseSkPrivateKey(privateKey)
+			if skErr == nil {
+				return createSkSigners(connCtx, sshKeywords, skKey, identityFile, agentKeys, certs, debugInfo)
+			}
+			if skErr != errNotSkKey {
+				err = skErr
+			}
+			conndebug.Logf(connCtx, "publickey: unable to parse %s, skipping: %v", identityFile, err)
+			// skip this key and try with the next
+			return createDummySigner()
+		}
+
+		decryptedKeySigners := func(unencryptedPrivateKey any) ([]ssh.Signer, error) {
+			signer, err := ssh.NewSignerFromKey(unencryptedPrivateKey)
+			if err != nil {
+				// skip this key and try with the next
+				return createDummySigner()
+			}
+			// unlocked keys always go to the internal agent, so they aren't decrypted again
+			if (sshKeywords.SshAddKeysToAgent && agentClient != nil) || isInternalAgent(agentClient) {
+				addKeyToAgent(agentClient, unencryptedPrivateKey, signer.PublicKey(), certs)
+			}
+			return withCertSigners(connCtx, signer, certs), nil
+		}
+
+		// a passphrase that worked earlier in this session is tried first
+		if passphrase, ok := getCachedPassphrase(identityFile); ok {
+			unencryptedPrivateKey, err := ssh.ParseRawPrivateKeyWithPassphrase(privateKey, []byte(passphrase))
+			if err == nil {
+				conndebug.Logf(connCtx, "publickey: decrypted %s with the cached passphrase", identityFile)
+				return decryptedKeySigners(unencryptedPrivateKey)
+			}
+			// the key was changed
+			forgetCachedPassphrase(identityFile)
+		}
+
+		// then a passphrase saved in the keychain (forgotten once it stops working)
+		passphraseKey := keychain.PassphraseKey(identityFile)
+		if passphrase, err := keychain.Get(passphraseKey); err == nil {
+			unencryptedPrivateKey, err := ssh.ParseRawPrivateKeyWithPassphrase(privateKey, []byte(passphrase))
+			if err == nil {
+				conndebug.Logf(connCtx, "publickey: decrypted %s with the passphrase from the keychain", identityFile)
+				cachePassphrase(identityFile, passphrase)
+				return decryptedKeySigners(unencryptedPrivateKey)
+			}
+			conndebug.Logf(connCtx, "publickey: the keychain passphrase for %s does not work, forgetting it", identityFile)
+			keychain.Delete(passphraseKey)
+		}
+
+		// a headless connection only has the passphrase it was given
+		if headless := getHeadlessOpts(connCtx); headless != nil {
+			if headless.Passphrase != "" {
+				unencryptedPrivateKey, err := ssh.ParseRawPrivateKeyWithPassphrase(privateKey, []byte(headless.Passphrase))
+				if err == nil {
+					conndebug.Logf(connCtx, "publickey: decrypted %s with the headless passphrase", identityFile)
+					return decryptedKeySigners(unencryptedPrivateKey)
+				}
+			}
+			conndebug.Logf(connCtx, "publickey: %s needs a passphrase that was not given (headless), skipping", identityFile)
 			// skip this key and try with the next
 			return createDummySigner()
 		}
 
 		// batch mode deactivates user input
 		if sshKeywords.SshBatchMode {
+			conndebug.Logf(connCtx, "publickey: %s needs a passphrase but batch mode is on, skipping", identityFile)
 			// skip this key and try with the next
 			return createDummySigner()
 		}
+		conndebug.Logf(connCtx, "publickey: %s is encrypted, prompting for passphrase", identityFile)
 
 		request := &userinput.UserInputRequest{
-			ResponseType: "text",
-			QueryText:    fmt.Sprintf("Enter passphrase for the SSH key: %s", identityFile),
-			Title:        "Publickey Auth + Passphrase",
+			QueryText:  fmt.Sprintf("Enter passphrase for the SSH key: %s", identityFile),
+			Title:      "Publickey Auth + Passphrase",
+			SecretOpts: &userinput.SecretOpts{AllowReveal: true},
+		}
+		if keychain.Available() {
+			request.CheckBoxMsg = keychain.SaveCheckboxMsg
 		}
-		ctx, cancelFn := context.WithTimeout(connCtx, 60*time.Second)
-		defer cancelFn()
-		response, err := userinput.GetUserInput(ctx, request)
+		response, err := userinput.GetUserSecret(connCtx, userinput.PromptType_Passphrase, request)
 		if err != nil {
 			// this is an error where we actually do want to stop
 			// trying keys
@@ -187,52 +273,260 @@ func createPublicKeyCallback(connCtx context.Context, sshKeywords *wshrpc.ConnKe
 		}
 		unencryptedPrivateKey, err = ssh.ParseRawPrivateKeyWithPassphrase(privateKey, []byte([]byte(response.Text)))
 		if err != nil {
+			conndebug.Logf(connCtx, "publickey: unable to decrypt %s, skipping: %v", identityFile, err)
 			// skip this key and try with the next
 			return createDummySigner()
 		}
-		signer, err := ssh.NewSignerFromKey(unencryptedPrivateKey)
+		cachePassphrase(identityFile, response.Text)
+		if response.CheckboxStat {
+			// the passphrase is known to be right, so it is saved right away
+			if err := keychain.Set(passphraseKey, "", response.Text); err != nil {
+				log.Printf("unable to save the passphrase for %s in the keychain: %v", identityFile, err)
+			}
+		}
+		return decryptedKeySigners(unencryptedPrivateKey)
+	}
+}
+
+// for IdentitiesOnly, the agent keys (and certificates) for the configured identity files and
+// certificate files.  like ssh, an identity's public key is read from "<identity>.pub" (or from
+// the private key if it is not encrypted).
+func filterConfiguredAgentSigners(sshKeywords *wshrpc.ConnKeywords, authSockSigners []ssh.Signer) []ssh.Signer {
+	configuredKeys := make(map[string]bool)
+	addPublicKeyFile := func(filePath string) bool {
+		pubBytes, err := os.ReadFile(filePath)
 		if err != nil {
-			// skip this key and try with the next
-			return createDummySigner()
+			return false
 		}
-		if sshKeywords.SshAddKeysToAgent && agentClient != nil {
-			agentClient.Add(agent.AddedKey{
-				PrivateKey: unencryptedPrivateKey,
-			})
+		pubKey, _, _, _, err := ssh.ParseAuthorizedKey(pubBytes)
+		if err != nil {
+			return false
 		}
-		return []ssh.Signer{signer}, nil
+		if cert, ok := pubKey.(*ssh.Certificate); ok {
+			configuredKeys[string(cert.Marshal())] = true
+			pubKey = cert.Key
+		}
+		configuredKeys[string(pubKey.Marshal())] = true
+		return true
 	}
+	for _, certFile := range sshKeywords.SshCertificateFile {
+		if filePath, err := wavebase.ExpandHomeDir(certFile); err == nil {
+			addPublicKeyFile(filePath)
+		}
+	}
+	for _, identityFile := range sshKeywords.SshIdentityFile {
+		filePath, err := wavebase.ExpandHomeDir(identityFile)
+		if err != nil || addPublicKeyFile(filePath+".pub") {
+			continue
+		}
+		privateKey, err := os.ReadFile(filePath)
+		if err != nil {
+			continue
+		}
+		if signer, err := ssh.ParsePrivateKey(privateKey); err == nil {
+			configuredKeys[string(signer.PublicKey().Marshal())] = true
+		} else if skKey, err := parseSkPrivateKey(privateKey); err == nil {
+			configuredKeys[string(skKey.pubKey.Marshal())] = true
+		}
+	}
+	var rtn []ssh.Signer
+	for _, signer := range authSockSigners {
+		pubKey := signer.PublicKey()
+		if configuredKeys[string(pubKey.Marshal())] {
+			rtn = append(rtn, signer)
+		} else if cert, ok := pubKey.(*ssh.Certificate); ok && configuredKeys[string(cert.Key.Marshal())] {
+			rtn = append(rtn, signer)
+		}
+	}
+	return rtn
+}
+
+func createSkSigners(connCtx context.Context, sshKeywords *wshrpc.ConnKeywords, skKey *skPrivateKey, identityFile string, agentKeys map[string]bool, certs []*ssh.Certificate, debugInfo *ConnectionDebugInfo) ([]ssh.Signer, error) {
+	if agentKeys[string(skKey.pubKey.Marshal())] {
+		conndebug.Logf(connCtx, "publickey: security key %s was already offered by the agent, skipping", identityFile)
+		return createDummySigner()
+	}
+	signer, err := makeSkHelperSigner(connCtx, sshKeywords, skKey, identityFile)
+	if err != nil {
+		var cancelErr UserInputCancelError
+		if errors.As(err, &cancelErr) {
+			return nil, ConnectionError{ConnectionDebugInfo: debugInfo, Err: err}
+		}
+		conndebug.Logf(connCtx, "publickey: unable to use security key %s, skipping: %v", identityFile, err)
+		return createDummySigner()
+	}
+	return withCertSigners(connCtx, signer, certs), nil
 }
 
+// loads the certificates from CertificateFile and the "<identity>-cert.pub" files next to the
+// identity files (like ssh).  certificates the agent already has are skipped.
+func loadCertificates(connCtx context.Context, sshKeywords *wshrpc.ConnKeywords, authSockSigners []ssh.Signer) []*ssh.Certificate {
+	agentKeys := make(map[string]bool)
+	for _, authSockSigner := range authSockSigners {
+		agentKeys[string(authSockSigner.PublicKey().Marshal())] = true
+	}
+	certFiles := append([]string(nil), sshKeywords.SshCertificateFile...)
+	for _, identityFile := range sshKeywords.SshIdentityFile {
+		certFiles = append(certFiles, identityFile+"-cert.pub")
+	}
+	var certs []*ssh.Certificate
+	for idx, certFile := range certFiles {
+		filePath, err := wavebase.ExpandHomeDir(certFile)
+		if err != nil {
+			continue
+		}
+		certBytes, err := os.ReadFile(filePath)
+		if err != nil {
+			// a missing CertificateFile is logged, the paired files are optional
+			if idx < len(sshKeywords.SshCertificateFile) {
+				conndebug.Logf(connCtx, "publickey: unable to read certificate %s: %v", certFile, err)
+			}
+			continue
+		}
+		pubKey, _, _, _, err := ssh.ParseAuthorizedKey(certBytes)
+		if err != nil {
+			conndebug.Logf(connCtx, "publickey: unable to parse certificate %s: %v", certFile, err)
+			continue
+		}
+		cert, ok := pubKey.(*ssh.Certificate)
+		if !ok {
+			conndebug.Logf(connCtx, "publickey: %s is not a certificate, skipping", certFile)
+			continue
+		}
+		if agentKeys[string(cert.Marshal())] {
+			continue
+		}
+		if cert.ValidBefore != ssh.CertTimeInfinity && time.Now().Unix() >= int64(cert.ValidBefore) {
+			conndebug.Logf(connCtx, "publickey: certificate %s has expired", certFile)
+		}
+		certs = append(certs, cert)
+	}
+	return certs
+}
+
+func matchingCertificates(pubKey ssh.PublicKey, certs []*ssh.Certificate) []*ssh.Certificate {
+	var rtn []*ssh.Certificate
+	for _, cert := range certs {
+		if bytes.Equal(cert.Key.Marshal(), pubKey.Marshal()) {
+			rtn = append(rtn, cert)
+		}
+	}
+	return rtn
+}
+
+// the signer with its certificates (offered first, like ssh) followed by the plain key
+func withCertSigners(connCtx context.Context, signer ssh.Signer, certs []*ssh.Certificate) []ssh.Signer {
+	var rtn []ssh.Signer
+	for _, cert := range matchingCertificates(signer.PublicKey(), certs) {
+		certSigner, err := ssh.NewCertSigner(cert, signer)
+		if err != nil {
+			conndebug.Logf(connCtx, "publickey: unable to use certificate %s: %v", ssh.FingerprintSHA256(cert), err)
+			continue
+		}
+		conndebug.Logf(connCtx, "publickey: offering certificate %s (key id %q)", cert.Type(), cert.KeyId)
+		rtn = append(rtn, certSigner)
+	}
+	return append(rtn, signer)
+}
+
+func addKeyToAgent(agentClient agent.ExtendedAgent, privateKey any, pubKey ssh.PublicKey, certs []*ssh.Certificate) {
+	agentClient.Add(agent.AddedKey{
+		PrivateKey: privateKey,
+	})
+	for _, cert := range matchingCertificates(pubKey, certs) {
+		agentClient.Add(agent.AddedKey{
+			PrivateKey:  privateKey,
+			Certificate: cert,
+		})
+	}
+}
+
+// a password saved in the keychain is sent first (after the password of a headless connection).
+// if the server asks again, it was rejected, so it is forgotten and the user is prompted.
 func createInteractivePasswordCallbackPrompt(connCtx context.Context, remoteDisplayName string, debugInfo *ConnectionDebugInfo) func() (secret string, err error) {
+	passwordKey := keychain.PasswordKey(remoteDisplayName)
+	headless := getHeadlessOpts(connCtx)
+	var triedHeadless, triedKeychain, usedKeychain bool
 	return func() (secret string, err error) {
-		ctx, cancelFn := context.WithTimeout(connCtx, 60*time.Second)
-		defer cancelFn()
+		if !triedHeadless && headless != nil && headless.Password != "" {
+			triedHeadless = true
+			conndebug.Logf(connCtx, "password: sending the headless password")
+			return headless.Password, nil
+		}
+		if !triedKeychain {
+			triedKeychain = true
+			if password, err := keychain.Get(passwordKey); err == nil {
+				conndebug.Logf(connCtx, "password: sending the password saved in the keychain")
+				usedKeychain = true
+				return password, nil
+			}
+		} else if usedKeychain {
+			conndebug.Logf(connCtx, "password: the keychain password was rejected, forgetting it")
+			keychain.Delete(passwordKey)
+			usedKeychain = false
+		}
+		conndebug.Logf(connCtx, "password: server requested password authentication, prompting")
 		queryText := fmt.Sprintf(
 			"Password Authentication requested from connection  \n"+
 				"%s\n\n"+
 				"Password:", remoteDisplayName)
 		request := &userinput.UserInputRequest{
-			ResponseType: "text",
-			QueryText:    queryText,
-			Markdown:     true,
-			Title:        "Password Authentication",
+			QueryText:  queryText,
+			Markdown:   true,
+			Title:      "Password Authentication",
+			SecretOpts: &userinput.SecretOpts{AllowReveal: true},
+		}
+		if keychain.Available() {
+			request.CheckBoxMsg = keychain.SaveCheckboxMsg
 		}
-		response, err := userinput.GetUserInput(ctx, request)
+		response, err := userinput.GetUserSecret(connCtx, userinput.PromptType_Password, request)
 		if err != nil {
 			return "", ConnectionError{ConnectionDebugInfo: debugInfo, Err: err}
 		}
+		if response.CheckboxStat {
+			if err := keychain.Set(passwordKey, debugInfo.NextOpts.String(), response.Text); err != nil {
+				log.Printf("unable to save the password for %s in the keychain: %v", remoteDisplayName, err)
+			}
+		}
 		return response.Text, nil
 	}
 }
 
-func createInteractiveKbdInteractiveChallenge(connCtx context.Context, remoteName string, debugInfo *ConnectionDebugInfo) func(name, instruction string, questions []string, echos []bool) (answers []string, err error) {
+// a verification code question matching conn:totpprompt is answered with a code from the totp
+// secret saved in the keychain.  that is only done once, if the server asks again the code was
+// rejected (the clock may be off), so the user is prompted.  a headless connection's password
+// answers the first password question the same way.
+func createInteractiveKbdInteractiveChallenge(connCtx context.Context, sshKeywords *wshrpc.ConnKeywords, remoteName string, debugInfo *ConnectionDebugInfo) func(name, instruction string, questions []string, echos []bool) (answers []string, err error) {
+	totpKey := keychain.TotpKey(debugInfo.NextOpts.String())
+	totpQuestionRe, err := makeTotpQuestionRe(sshKeywords.ConnTotpPrompt)
+	if err != nil {
+		conndebug.Logf(connCtx, "keyboard-interactive: %v", err)
+	}
+	headless := getHeadlessOpts(connCtx)
+	var triedTotp, triedHeadless bool
 	return func(name, instruction string, questions []string, echos []bool) (answers []string, err error) {
+		conndebug.Logf(connCtx, "keyboard-interactive: name=%q instruction=%q (%d questions)", name, instruction, len(questions))
 		if len(questions) != len(echos) {
 			return nil, fmt.Errorf("bad response from server: questions has len %d, echos has len %d", len(questions), len(echos))
 		}
 		for i, question := range questions {
 			echo := echos[i]
+			// answers are never logged
+			conndebug.Logf(connCtx, "keyboard-interactive: question %d %q (echo=%v)", i+1, question, echo)
+			if !triedTotp && totpQuestionRe != nil && totpQuestionRe.MatchString(question) {
+				if code, ok := getSavedTotpCode(connCtx, totpKey); ok {
+					triedTotp = true
+					conndebug.Logf(connCtx, "keyboard-interactive: answering question %d with the totp code from the keychain", i+1)
+					answers = append(answers, code)
+					continue
+				}
+			}
+			if !triedHeadless && headless != nil && headless.Password != "" && passwordQuestionRe.MatchString(question) {
+				triedHeadless = true
+				conndebug.Logf(connCtx, "keyboard-interactive: answering question %d with the headless password", i+1)
+				answers = append(answers, headless.Password)
+				continue
+			}
 			answer, err := promptChallengeQuestion(connCtx, question, echo, remoteName)
 			if err != nil {
 				return nil, ConnectionError{ConnectionDebugInfo: debugInfo, Err: err}
@@ -243,11 +537,20 @@ func createInteractiveKbdInteractiveChallenge(connCtx context.Context, remoteNam
 	}
 }
 
+func getSavedTotpCode(connCtx context.Context, totpKey string) (string, bool) {
+	secret, err := keychain.Get(totpKey)
+	if err != nil {
+		return "", false
+	}
+	totp, err := parseTotpSecret(secret)
+	if err != nil {
+		conndebug.Logf(connCtx, "keyboard-interactive: unable to use the saved totp secret: %v", err)
+		return "", false
+	}
+	return totp.Code(time.Now()), true
+}
+
 func promptChallengeQuestion(connCtx context.Context, question string, echo bool, remoteName string) (answer string, err error) {
-	// limited to 15 seconds for some reason. this should be investigated more
-	// in the future
-	ctx, cancelFn := context.WithTimeout(connCtx, 60*time.Second)
-	defer cancelFn()
 	queryText := fmt.Sprintf(
 		"Keyboard Interactive Authentication requested from connection  \n"+
 			"%s\n\n"+
@@ -259,13 +562,36 @@ func promptChallengeQuestion(connCtx context.Context, question string, echo bool
 		Title:        "Keyboard Interactive Authentication",
 		PublicText:   echo,
 	}
-	response, err := userinput.GetUserInput(ctx, request)
+	if otpOpts := getOtpOptsForQuestion(question); otpOpts != nil {
+		request.ResponseType = userinput.ResponseType_Otp
+		request.OtpOpts = otpOpts
+		request.Title = "Verification Code"
+		request.PublicText = true
+	}
+	response, err := userinput.GetTimedUserInput(connCtx, userinput.PromptType_KbdInteractive, request)
 	if err != nil {
 		return "", err
 	}
 	return response.Text, nil
 }
 
+var passwordQuestionRe = regexp.MustCompile(`(?i)password`)
+var otpQuestionRe = regexp.MustCompile(`(?i)verification code|one[- ]time (pass(word|code)|code)|\botp\b|authenticator|two[- ]factor|\b2fa\b|token code|passcode`)
+var duoQuestionRe = regexp.MustCompile(`(?i)passcode or option`)
+
+// returns otp options if a keyboard-interactive question looks like it is
+// asking for a verification code (google-authenticator pam, duo, etc.)
+func getOtpOptsForQuestion(question string) *userinput.OtpOpts {
+	if duoQuestionRe.MatchString(question) {
+		// duo also accepts option numbers ("1" for push), so the code is free-form
+		return &userinput.OtpOpts{}
+	}
+	if !otpQuestionRe.MatchString(question) {
+		return nil
+	}
+	return &userinput.OtpOpts{NumDigits: 6, Period: 30}
+}
+
 func openKnownHostsForEdit(knownHostsFilename string) (*os.File, error) {
 	path, _ := filepath.Split(knownHostsFilename)
 	err := os.MkdirAll(path, 0700)
@@ -275,6 +601,37 @@ func openKnownHostsForEdit(knownHostsFilename string) (*os.File, error) {
 	return os.OpenFile(knownHostsFilename, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
 }
 
+// like ssh, the hostname is hashed ("|1|salt|hash") when HashKnownHosts is on
+func makeKnownHostsLine(hostname string, key ssh.PublicKey, hashHosts bool) string {
+	host := xknownhosts.Normalize(hostname)
+	if hashHosts {
+		host = xknownhosts.HashHostname(host)
+	}
+	return xknownhosts.Line([]string{host}, key)
+}
+
+const (
+	StrictHostKeyChecking_Ask       = "ask"
+	StrictHostKeyChecking_Yes       = "yes"
+	StrictHostKeyChecking_No        = "no"
+	StrictHostKeyChecking_AcceptNew = "accept-new"
+)
+
+// maps the StrictHostKeyChecking values ssh accepts (including the "true"/"false"/"off"
+// aliases) to one of the constants above.  unrecognized values are treated as "ask"
+func normalizeStrictHostKeyChecking(value string) string {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "yes", "true":
+		return StrictHostKeyChecking_Yes
+	case "no", "false", "off":
+		return StrictHostKeyChecking_No
+	case "accept-new":
+		return StrictHostKeyChecking_AcceptNew
+	default:
+		return StrictHostKeyChecking_Ask
+	}
+}
+
 func writeToKnownHosts(knownHostsFile string, newLine string, getUserVerification func() (*userinput.UserInputResponse, error)) error {
 	if getUserVerification == nil {
 		getUserVerification = func() (*userinput.UserInputResponse, error) {
@@ -315,7 +672,7 @@ func writeToKnownHosts(knownHostsFile string, newLine string, getUserVerificatio
 	return f.Close()
 }
 
-func createUnknownKeyVerifier(knownHostsFile string, hostname string, remote string, key ssh.PublicKey) func() (*userinput.UserInputResponse, error) {
+func createUnknownKeyVerifier(routeCtx context.Context, connName string, knownHostsFile string, hostname string, remote string, key ssh.PublicKey) func() (*userinput.UserInputResponse, error) {
 	base64Key := base64.StdEncoding.EncodeToString(key.Marshal())
 	queryText := fmt.Sprintf(
 		"The authenticity of host '%s (%s)' can't be established "+
@@ -330,11 +687,12 @@ func createUnknownKeyVerifier(knownHostsFile string, hostname string, remote str
 		QueryText:    queryText,
 		Markdown:     true,
 		Title:        "Known Hosts Key Missing",
+		// remembered for this exact key, so a different key is always asked about
+		RememberKey:  "hostkey:" + ssh.FingerprintSHA256(key),
+		RememberConn: connName,
 	}
 	return func() (*userinput.UserInputResponse, error) {
-		ctx, cancelFn := context.WithTimeout(context.Background(), 60*time.Second)
-		defer cancelFn()
-		resp, err := userinput.GetUserInput(ctx, request)
+		resp, err := userinput.GetTimedUserInput(routeCtx, userinput.PromptType_HostKey, request)
 		if err != nil {
 			return nil, err
 		}
@@ -345,7 +703,7 @@ func createUnknownKeyVerifier(knownHostsFile string, hostname string, remote str
 	}
 }
 
-func createMissingKnownHostsVerifier(knownHostsFile string, hostname string, remote string, key ssh.PublicKey) func() (*userinput.UserInputResponse, error) {
+func createMissingKnownHostsVerifier(routeCtx context.Context, knownHostsFile string, hostname string, remote string, key ssh.PublicKey) func() (*userinput.UserInputResponse, error) {
 	base64Key := base64.StdEncoding.EncodeToString(key.Marshal())
 	queryText := fmt.Sprintf(
 		"The authenticity of host '%s (%s)' can't be established "+
@@ -363,9 +721,7 @@ func createMissingKnownHostsVerifier(knownHostsFile string, hostname string, rem
 		Title:        "Known Hosts File Missing",
 	}
 	return func() (*userinput.UserInputResponse, error) {
-		ctx, cancelFn := context.WithTimeout(context.Background(), 60*time.Second)
-		defer cancelFn()
-		resp, err := userinput.GetUserInput(ctx, request)
+		resp, err := userinput.GetTimedUserInput(routeCtx, userinput.PromptType_HostKey, request)
 		if err != nil {
 			return nil, err
 		}
@@ -385,19 +741,20 @@ func lineContainsMatch(line []byte, matches [][]byte) bool {
 	return false
 }
 
-func createHostKeyCallback(sshKeywords *wshrpc.ConnKeywords) (ssh.HostKeyCallback, HostKeyAlgorithms, error) {
+// the known_hosts files for a connection (expanded), the user files come first
+func getKnownHostsFiles(sshKeywords *wshrpc.ConnKeywords) ([]string, error) {
 	globalKnownHostsFiles := sshKeywords.SshGlobalKnownHostsFile
 	userKnownHostsFiles := sshKeywords.SshUserKnownHostsFile
 
 	osUser, err := user.Current()
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	var unexpandedKnownHostsFiles []string
 	if osUser.Username == "root" {
 		unexpandedKnownHostsFiles = globalKnownHostsFiles
 	} else {
-		unexpandedKnownHostsFiles = append(userKnownHostsFiles, globalKnownHostsFiles...)
+		unexpandedKnownHostsFiles = append(append([]string(nil), userKnownHostsFiles...), globalKnownHostsFiles...)
 	}
 
 	var knownHostsFiles []string
@@ -408,6 +765,15 @@ func createHostKeyCallback(sshKeywords *wshrpc.ConnKeywords) (ssh.HostKeyCallbac
 		}
 		knownHostsFiles = append(knownHostsFiles, filePath)
 	}
+	return knownHostsFiles, nil
+}
+
+// keyUpdater (if not nil) is told which key matched known_hosts, for UpdateHostKeys
+func createHostKeyCallback(connCtx context.Context, connName string, sshKeywords *wshrpc.ConnKeywords, keyUpdater *hostKeyUpdater) (ssh.HostKeyCallback, HostKeyAlgorithms, error) {
+	knownHostsFiles, err := getKnownHostsFiles(sshKeywords)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	// there are no good known hosts files
 	if len(knownHostsFiles) == 0 {
@@ -456,27 +822,92 @@ func createHostKeyCallback(sshKeywords *wshrpc.ConnKeywords) (ssh.HostKeyCallbac
 		}
 	}
 
+	// host key prompts are not bound to connCtx's deadline, but still open in the right window
+	routeCtx := userinput.WithRoute(context.Background(), userinput.RouteFromContext(connCtx))
+	strictHostKeyChecking := normalizeStrictHostKeyChecking(sshKeywords.SshStrictHostKeyChecking)
+	var revokedHostKeysFile string
+	if sshKeywords.SshRevokedHostKeys != "" {
+		revokedHostKeysFile, err = wavebase.ExpandHomeDir(sshKeywords.SshRevokedHostKeys)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid RevokedHostKeys %q: %w", sshKeywords.SshRevokedHostKeys, err)
+		}
+	}
 	waveHostKeyCallback := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		conndebug.Logf(connCtx, "hostkey: %s sent %s %s", hostname, key.Type(), ssh.FingerprintSHA256(key))
+		if revokedHostKeysFile != "" {
+			if err := checkKRLRevokedHostKey(revokedHostKeysFile, hostname, key); err != nil {
+				conndebug.Logf(connCtx, "hostkey: %v", err)
+				var krlErr *HostKeyKRLRevokedError
+				if errors.As(err, &krlErr) {
+					audit.Record(audit.Event_HostKeyRevoked, connName, "", err.Error())
+				}
+				return err
+			}
+		}
+		// the markers are checked here (the library only checks a certificate against @revoked,
+		// not its key or its authority, and refuses certificates from unknown authorities)
+		markerLines := readKnownHostsKeys(knownHostsFiles)
+		if err := checkRevokedHostKey(markerLines, hostname, key); err != nil {
+			conndebug.Logf(connCtx, "hostkey: %v", err)
+			audit.Record(audit.Event_HostKeyRevoked, connName, "", err.Error())
+			return err
+		}
+		if cert, ok := key.(*ssh.Certificate); ok {
+			caLine, err := checkHostCert(markerLines, hostname, cert)
+			if caLine != nil && err == nil {
+				conndebug.Logf(connCtx, "hostkey: certificate signed by @cert-authority %s (%s:%d)", caLine.entry.Fingerprint, caLine.entry.File, caLine.entry.Line)
+				return nil
+			}
+			// like ssh, fall back to the certificate's plain key
+			if caLine != nil {
+				conndebug.Logf(connCtx, "hostkey: invalid certificate from @cert-authority (%s:%d): %v, checking the plain key", caLine.entry.File, caLine.entry.Line, err)
+			} else {
+				conndebug.Logf(connCtx, "hostkey: no @cert-authority for %s, checking the plain key", ssh.FingerprintSHA256(cert.SignatureKey))
+			}
+			key = cert.Key
+		}
 		err := basicCallback(hostname, remote, key)
 		if err == nil {
+			conndebug.Logf(connCtx, "hostkey: matched known_hosts (%s)", strings.Join(knownHostsFiles, ", "))
 			// success
+			keyUpdater.setVerifiedKey(hostname, key)
 			return nil
-		} else if _, ok := err.(*xknownhosts.RevokedError); ok {
+		} else if rerr, ok := err.(*xknownhosts.RevokedError); ok {
+			conndebug.Logf(connCtx, "hostkey: key is revoked")
 			// revoked credentials are refused outright
-			return err
+			return &HostKeyRevokedError{
+				Hostname:    hostname,
+				KeyType:     key.Type(),
+				Fingerprint: ssh.FingerprintSHA256(key),
+				File:        rerr.Revoked.Filename,
+				Line:        rerr.Revoked.Line,
+			}
 		} else if _, ok := err.(*xknownhosts.KeyError); !ok {
+			conndebug.Logf(connCtx, "hostkey: error checking known_hosts: %v", err)
 			// this is an unknown error (note the !ok is opposite of usual)
 			return err
 		}
 		serr, _ := err.(*xknownhosts.KeyError)
-		if len(serr.Want) == 0 {
-			// the key was not found
+		if len(serr.Want) == 0 && strictHostKeyChecking == StrictHostKeyChecking_Yes {
+			conndebug.Logf(connCtx, "hostkey: host not in known_hosts, refused (StrictHostKeyChecking=yes)")
+			return fmt.Errorf("no %s host key is known for %s and StrictHostKeyChecking is set to yes", key.Type(), hostname)
+		} else if len(serr.Want) == 0 {
+			// the key was not found. with accept-new or no, it is added without asking (like ssh)
+			autoAccept := strictHostKeyChecking == StrictHostKeyChecking_AcceptNew || strictHostKeyChecking == StrictHostKeyChecking_No
+			if autoAccept {
+				conndebug.Logf(connCtx, "hostkey: host not in known_hosts, adding it (StrictHostKeyChecking=%s)", strictHostKeyChecking)
+			} else {
+				conndebug.Logf(connCtx, "hostkey: host not in known_hosts, asking the user")
+			}
 
 			// try to write to a file that could be read
 			err := fmt.Errorf("placeholder, should not be returned") // a null value here can cause problems with empty slice
 			for _, filename := range knownHostsFiles {
-				newLine := xknownhosts.Line([]string{xknownhosts.Normalize(hostname)}, key)
-				getUserVerification := createUnknownKeyVerifier(filename, hostname, remote.String(), key)
+				newLine := makeKnownHostsLine(hostname, key, sshKeywords.SshHashKnownHosts)
+				var getUserVerification func() (*userinput.UserInputResponse, error)
+				if !autoAccept {
+					getUserVerification = createUnknownKeyVerifier(routeCtx, connName, filename, hostname, remote.String(), key)
+				}
 				err = writeToKnownHosts(filename, newLine, getUserVerification)
 				if err == nil {
 					break
@@ -490,8 +921,11 @@ func createHostKeyCallback(sshKeywords *wshrpc.ConnKeywords) (ssh.HostKeyCallbac
 			// should catch cases where there is no known_hosts file
 			if err != nil {
 				for _, filename := range unreadableFiles {
-					newLine := xknownhosts.Line([]string{xknownhosts.Normalize(hostname)}, key)
-					getUserVerification := createMissingKnownHostsVerifier(filename, hostname, remote.String(), key)
+					newLine := makeKnownHostsLine(hostname, key, sshKeywords.SshHashKnownHosts)
+					var getUserVerification func() (*userinput.UserInputResponse, error)
+					if !autoAccept {
+						getUserVerification = createMissingKnownHostsVerifier(routeCtx, filename, hostname, remote.String(), key)
+					}
 					err = writeToKnownHosts(filename, newLine, getUserVerification)
 					if err == nil {
 						knownHostsFiles = []string{filename}
@@ -505,7 +939,15 @@ func createHostKeyCallback(sshKeywords *wshrpc.ConnKeywords) (ssh.HostKeyCallbac
 			if err != nil {
 				return fmt.Errorf("unable to create new knownhost key: %e", err)
 			}
+			audit.Record(audit.Event_HostKeyAccepted, connName, "", fmt.Sprintf("%s %s %s (%s)", hostname, key.Type(), ssh.FingerprintSHA256(key), strings.Join(knownHostsFiles, ", ")))
+		} else if strictHostKeyChecking == StrictHostKeyChecking_No {
+			// ssh still connects when checking is off, but the mismatch is worth a trace
+			conndebug.Logf(connCtx, "hostkey: KEY CHANGED (known_hosts has %d other key(s) for this host), ignored (StrictHostKeyChecking=no)", len(serr.Want))
+			log.Printf("warning: the %s host key for %s has changed, connecting anyway because StrictHostKeyChecking is set to no", key.Type(), hostname)
+			audit.Record(audit.Event_HostKeyIgnored, connName, "", fmt.Sprintf("%s %s %s (StrictHostKeyChecking=no)", hostname, key.Type(), ssh.FingerprintSHA256(key)))
+			return nil
 		} else {
+			conndebug.Logf(connCtx, "hostkey: KEY CHANGED (known_hosts has %d other key(s) for this host)", len(serr.Want))
 			// the key changed
 			correctKeyFingerprint := base64.StdEncoding.EncodeToString(key.Marshal())
 			var bulletListKnownHosts []string
@@ -533,6 +975,7 @@ func createHostKeyCallback(sshKeywords *wshrpc.ConnKeywords) (ssh.HostKeyCallbac
 				"%s", key.Type(), correctKeyFingerprint, strings.Join(bulletListKnownHosts, "  \n"), strings.Join(offendingKeysFmt, "  \n"))
 
 			log.Print(errorMsg)
+			audit.Record(audit.Event_HostKeyChanged, connName, "", fmt.Sprintf("%s %s %s (refused)", hostname, key.Type(), ssh.FingerprintSHA256(key)))
 			//update := scbus.MakeUpdatePacket()
 			// create update into alert message
 
@@ -551,28 +994,87 @@ func createHostKeyCallback(sshKeywords *wshrpc.ConnKeywords) (ssh.HostKeyCallbac
 	return waveHostKeyCallback, hostKeyAlgorithms, nil
 }
 
-func createClientConfig(connCtx context.Context, sshKeywords *wshrpc.ConnKeywords, debugInfo *ConnectionDebugInfo) (*ssh.ClientConfig, error) {
-	remoteName := sshKeywords.SshUser + "@" + xknownhosts.Normalize(sshKeywords.SshHostName+":"+sshKeywords.SshPort)
+func createClientConfig(connCtx context.Context, sshKeywords *wshrpc.ConnKeywords, debugInfo *ConnectionDebugInfo) (*ssh.ClientConfig, *hostKeyUpdater, error) {
+	remoteName := sshKeywords.SshUser + "@" + xknownhosts.Normalize(net.JoinHostPort(sshKeywords.SshHostName, sshKeywords.SshPort))
 
 	var authSockSigners []ssh.Signer
 	var agentClient agent.ExtendedAgent
-	conn, err := net.Dial("unix", sshKeywords.SshIdentityAgent)
+	conn, agentName, err := dialIdentityAgent(sshKeywords.SshIdentityAgent)
 	if err != nil {
 		log.Printf("Failed to open Identity Agent Socket: %v", err)
+		conndebug.Logf(connCtx, "agent: unable to open identity agent %q: %v", agentName, err)
+		if internalAgentEnabled() {
+			agentClient = internalAgent
+			authSockSigners, _ = agentClient.Signers()
+			conndebug.Logf(connCtx, "agent: using the internal agent, it has %d key(s)", len(authSockSigners))
+		}
 	} else {
 		agentClient = agent.NewClient(conn)
 		authSockSigners, _ = agentClient.Signers()
+		conndebug.Logf(connCtx, "agent: %q has %d key(s)", agentName, len(authSockSigners))
 	}
+	if agentClient != nil && sshKeywords.SshIdentitiesOnly {
+		authSockSigners = filterConfiguredAgentSigners(sshKeywords, authSockSigners)
+		conndebug.Logf(connCtx, "agent: IdentitiesOnly is set, offering %d agent key(s) that match an identity file", len(authSockSigners))
+	}
+
+	if sshKeywords.Ec2InstanceId != "" {
+		// the pushed key is offered first, the instance only accepts it for a minute
+		ec2Signer, err := pushEc2InstanceConnectKey(connCtx, sshKeywords)
+		if err != nil {
+			return nil, nil, err
+		}
+		authSockSigners = append([]ssh.Signer{ec2Signer}, authSockSigners...)
+	}
+
+	publicKeyFn := createPublicKeyCallback(connCtx, sshKeywords, authSockSigners, agentClient, debugInfo)
+	publicKeyCallback := ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+		_, span := wtrace.Start(connCtx, "ssh.auth.publickey", "ssh.host", remoteName)
+		defer span.End()
+		signers, err := publicKeyFn()
+		span.RecordError(err)
+		if err == nil && len(signers) > 0 {
+			event := makeHopEvent(wshrpc.ConnEvent_AuthMethodTried, debugInfo)
+			event.AuthMethod = "publickey"
+			event.Detail = signers[0].PublicKey().Type() + " " + ssh.FingerprintSHA256(signers[0].PublicKey())
+			publishConnEventCtx(connCtx, event)
+		}
+		return signers, err
+	})
+	kbdInteractiveFn := createInteractiveKbdInteractiveChallenge(connCtx, sshKeywords, remoteName, debugInfo)
+	keyboardInteractive := ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		_, span := wtrace.Start(connCtx, "ssh.auth.keyboard-interactive", "ssh.host", remoteName, "ssh.numquestions", len(questions))
+		defer span.End()
+		event := makeHopEvent(wshrpc.ConnEvent_AuthMethodTried, debugInfo)
+		event.AuthMethod = "keyboard-interactive"
+		publishConnEventCtx(connCtx, event)
+		answers, err := kbdInteractiveFn(name, instruction, questions, echos)
+		span.RecordError(err)
+		return answers, err
+	})
+	passwordFn := createInteractivePasswordCallbackPrompt(connCtx, remoteName, debugInfo)
+	passwordCallback := ssh.PasswordCallback(func() (string, error) {
+		_, span := wtrace.Start(connCtx, "ssh.auth.password", "ssh.host", remoteName)
+		defer span.End()
+		event := makeHopEvent(wshrpc.ConnEvent_AuthMethodTried, debugInfo)
+		event.AuthMethod = "password"
+		publishConnEventCtx(connCtx, event)
+		secret, err := passwordFn()
+		span.RecordError(err)
+		return secret, err
+	})
 
-	publicKeyCallback := ssh.PublicKeysCallback(createPublicKeyCallback(connCtx, sshKeywords, authSockSigners, agentClient, debugInfo))
-	keyboardInteractive := ssh.KeyboardInteractive(createInteractiveKbdInteractiveChallenge(connCtx, remoteName, debugInfo))
-	passwordCallback := ssh.PasswordCallback(createInteractivePasswordCallbackPrompt(connCtx, remoteName, debugInfo))
+	// a saved password gets a second try, for the prompt if it is rejected
+	passwordTries := 1
+	if keychain.Has(keychain.PasswordKey(remoteName)) {
+		passwordTries = 2
+	}
 
 	// exclude gssapi-with-mic and hostbased until implemented
 	authMethodMap := map[string]ssh.AuthMethod{
 		"publickey":            ssh.RetryableAuthMethod(publicKeyCallback, len(sshKeywords.SshIdentityFile)+len(authSockSigners)),
 		"keyboard-interactive": ssh.RetryableAuthMethod(keyboardInteractive, 1),
-		"password":             ssh.RetryableAuthMethod(passwordCallback, 1),
+		"password":             ssh.RetryableAuthMethod(passwordCallback, passwordTries),
 	}
 
 	// note: batch mode turns off interactive input
@@ -583,6 +1085,7 @@ func createClientConfig(connCtx context.Context, sshKeywords *wshrpc.ConnKeyword
 	}
 
 	var authMethods []ssh.AuthMethod
+	var authMethodNames []string
 	for _, authMethodName := range sshKeywords.SshPreferredAuthentications {
 		authMethodActive, ok := authMethodActiveMap[authMethodName]
 		if !ok || !authMethodActive {
@@ -593,57 +1096,223 @@ func createClientConfig(connCtx context.Context, sshKeywords *wshrpc.ConnKeyword
 			continue
 		}
 		authMethods = append(authMethods, authMethod)
+		authMethodNames = append(authMethodNames, authMethodName)
 	}
+	conndebug.Logf(connCtx, "auth methods (in order): %s", strings.Join(authMethodNames, ", "))
 
-	hostKeyCallback, hostKeyAlgorithms, err := createHostKeyCallback(sshKeywords)
+	keyUpdater := makeHostKeyUpdater(connCtx, debugInfo.NextOpts.String(), sshKeywords)
+	hostKeyCallback, hostKeyAlgorithms, err := createHostKeyCallback(connCtx, debugInfo.NextOpts.String(), sshKeywords, keyUpdater)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	networkAddr := sshKeywords.SshHostName + ":" + sshKeywords.SshPort
+	networkAddr := net.JoinHostPort(sshKeywords.SshHostName, sshKeywords.SshPort)
+	algorithmConfig, err := makeSshAlgorithmConfig(sshKeywords)
+	if err != nil {
+		return nil, nil, err
+	}
+	hostKeyAlgos, err := makeSshHostKeyAlgorithms(sshKeywords, hostKeyAlgorithms(networkAddr))
+	if err != nil {
+		return nil, nil, err
+	}
+	if sshKeywords.SshCiphers != "" || sshKeywords.SshMACs != "" || sshKeywords.SshKexAlgorithms != "" || sshKeywords.SshHostKeyAlgorithms != "" {
+		conndebug.Logf(connCtx, "algorithms: ciphers=%v macs=%v kex=%v hostkey=%v", algorithmConfig.Ciphers, algorithmConfig.MACs, algorithmConfig.KeyExchanges, hostKeyAlgos)
+	}
+	connectTimeout := DefaultSshConnectTimeout
+	if sshKeywords.SshConnectTimeout != nil {
+		connectTimeout = time.Duration(*sshKeywords.SshConnectTimeout) * time.Second
+	}
+	// authentication starts once the host key is accepted
+	authStartCallback := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := hostKeyCallback(hostname, remote, key)
+		if err == nil {
+			publishConnEventCtx(connCtx, makeHopEvent(wshrpc.ConnEvent_AuthStarted, debugInfo))
+		}
+		return err
+	}
 	return &ssh.ClientConfig{
+		Config:            algorithmConfig,
+		Timeout:           connectTimeout,
 		User:              sshKeywords.SshUser,
 		Auth:              authMethods,
-		HostKeyCallback:   hostKeyCallback,
-		HostKeyAlgorithms: hostKeyAlgorithms(networkAddr),
-	}, nil
+		HostKeyCallback:   authStartCallback,
+		HostKeyAlgorithms: hostKeyAlgos,
+		BannerCallback:    makeBannerCallback(connCtx, debugInfo),
+	}, keyUpdater, nil
+}
+
+type sshDialOpts struct {
+	network   string // "tcp", or "tcp4"/"tcp6" for AddressFamily inet/inet6
+	attempts  int
+	tailscale *bool              // conn:tailscale (see tailscale.go)
+	iap       *iapTunnelOpts     // gcp:iap (see gcpiap.go)
+	bastion   *bastionTunnelOpts // azure:bastion (see azurebastion.go)
+}
+
+func makeSshDialOpts(sshKeywords *wshrpc.ConnKeywords) sshDialOpts {
+	rtn := sshDialOpts{network: sshDialNetwork(sshKeywords.SshAddressFamily), attempts: 1, tailscale: sshKeywords.ConnTailscale, iap: makeIapTunnelOpts(sshKeywords), bastion: makeBastionTunnelOpts(sshKeywords)}
+	if sshKeywords.SshConnectionAttempts != nil && *sshKeywords.SshConnectionAttempts > 1 {
+		rtn.attempts = *sshKeywords.SshConnectionAttempts
+	}
+	return rtn
+}
+
+func sshDialNetwork(addressFamily string) string {
+	switch strings.ToLower(addressFamily) {
+	case "inet":
+		return "tcp4"
+	case "inet6":
+		return "tcp6"
+	default:
+		return "tcp"
+	}
 }
 
-func connectInternal(ctx context.Context, networkAddr string, clientConfig *ssh.ClientConfig, currentClient *ssh.Client) (*ssh.Client, error) {
-	var clientConn net.Conn
+// dials networkAddr (through currentClient if set).  like ssh, clientConfig.Timeout covers each
+// attempt (including the name lookup) and failed attempts are retried a second apart.  a direct
+// dial tries every address of the host (of the AddressFamily), racing ipv6 and ipv4 (RFC 6555).
+// through a jump host, the jump host resolves the name, so AddressFamily does not apply.
+func dialWithRetries(ctx context.Context, networkAddr string, clientConfig *ssh.ClientConfig, dialOpts sshDialOpts, currentClient *ssh.Client) (net.Conn, error) {
 	var err error
-	if currentClient == nil {
-		d := net.Dialer{Timeout: clientConfig.Timeout}
-		clientConn, err = d.DialContext(ctx, "tcp", networkAddr)
-		if err != nil {
+	for attempt := 1; ; attempt++ {
+		var clientConn net.Conn
+		dialCtx, cancelFn := ctx, context.CancelFunc(func() {})
+		if clientConfig.Timeout > 0 {
+			dialCtx, cancelFn = context.WithTimeout(ctx, clientConfig.Timeout)
+		}
+		_, dialSpan := wtrace.Start(ctx, "ssh.dial", "net.addr", networkAddr, "ssh.viajump", currentClient != nil, "ssh.attempt", attempt)
+		conndebug.Logf(ctx, "dial: %s (via jump host: %v, network: %s, timeout: %v, attempt %d of %d)", networkAddr, currentClient != nil, dialOpts.network, clientConfig.Timeout, attempt, dialOpts.attempts)
+		if currentClient == nil {
+			clientConn, err = dialDirect(ctx, dialCtx, networkAddr, dialOpts)
+		} else {
+			clientConn, err = currentClient.DialContext(dialCtx, "tcp", networkAddr)
+		}
+		cancelFn()
+		dialSpan.RecordError(err)
+		dialSpan.End()
+		if err == nil {
+			return clientConn, nil
+		}
+		if dialCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+			err = fmt.Errorf("connection to %s timed out after %v", networkAddr, clientConfig.Timeout)
+		}
+		conndebug.Logf(ctx, "dial: %s failed: %v", networkAddr, err)
+		if attempt >= dialOpts.attempts || ctx.Err() != nil {
 			return nil, err
 		}
-	} else {
-		clientConn, err = currentClient.DialContext(ctx, "tcp", networkAddr)
-		if err != nil {
+		select {
+		case <-ctx.Done():
 			return nil, err
+		case <-time.After(time.Second):
 		}
 	}
-	c, chans, reqs, err := ssh.NewClientConn(clientConn, networkAddr, clientConfig)
+}
+
+// dials networkAddr from this machine, through an iap tunnel (gcp:iap) or azure bastion
+// (azure:bastion), or over tailscale if it is a tailscale peer
+func dialDirect(ctx context.Context, dialCtx context.Context, networkAddr string, dialOpts sshDialOpts) (net.Conn, error) {
+	if dialOpts.iap != nil {
+		return dialIapTunnel(dialCtx, dialOpts.iap, networkAddr)
+	}
+	if dialOpts.bastion != nil {
+		return dialBastionTunnel(dialCtx, dialOpts.bastion, networkAddr)
+	}
+	tsRoute, err := resolveTailscaleRoute(dialCtx, dialOpts.tailscale, networkAddr)
 	if err != nil {
 		return nil, err
 	}
-	return ssh.NewClient(c, chans, reqs), nil
+	if tsRoute == nil {
+		d := net.Dialer{}
+		return d.DialContext(dialCtx, dialOpts.network, networkAddr)
+	}
+	if tsRoute.SocketPath == "" {
+		conndebug.Logf(ctx, "dial: %s is a tailscale peer, dialing %s", networkAddr, tsRoute.Addr)
+		d := net.Dialer{}
+		return d.DialContext(dialCtx, "tcp", tsRoute.Addr)
+	}
+	conndebug.Logf(ctx, "dial: %s through tailscaled (%s)", tsRoute.Addr, tsRoute.SocketPath)
+	return dialTailscale(dialCtx, tsRoute.SocketPath, tsRoute.Addr)
+}
+
+func connectInternal(ctx context.Context, networkAddr string, clientConfig *ssh.ClientConfig, dialOpts sshDialOpts, keyUpdater *hostKeyUpdater, currentClient *ssh.Client) (*ssh.Client, error) {
+	clientConn, err := dialWithRetries(ctx, networkAddr, clientConfig, dialOpts, currentClient)
+	if err != nil {
+		return nil, err
+	}
+	conndebug.Logf(ctx, "dial: connected to %s (%s)", networkAddr, clientConn.RemoteAddr())
+	stats := makeClientStats()
+	// like ssh, ConnectTimeout also bounds the version exchange and key exchange, so a server
+	// that accepts and then stalls can't hang the connection.  the deadline is cleared once the
+	// host key arrives, since host key and auth prompts wait for the user.  (channels of a jump
+	// host don't support deadlines, their hop is bounded by the jump host's own connection.)
+	handshakeConfig := clientConfig
+	if clientConfig.Timeout > 0 && clientConn.SetDeadline(time.Now().Add(clientConfig.Timeout)) == nil {
+		configCopy := *clientConfig
+		configCopy.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			clientConn.SetDeadline(time.Time{})
+			return clientConfig.HostKeyCallback(hostname, remote, key)
+		}
+		handshakeConfig = &configCopy
+	}
+	// the handshake includes host key verification and authentication
+	_, handshakeSpan := wtrace.Start(ctx, "ssh.handshake", "net.addr", networkAddr)
+	c, chans, reqs, err := ssh.NewClientConn(&statsConn{Conn: clientConn, stats: stats}, networkAddr, handshakeConfig)
+	handshakeSpan.RecordError(err)
+	handshakeSpan.End()
+	if err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			err = fmt.Errorf("ssh handshake with %s timed out after %v", networkAddr, clientConfig.Timeout)
+		}
+		conndebug.Logf(ctx, "handshake: %s failed: %v", networkAddr, err)
+		return nil, err
+	}
+	clientConn.SetDeadline(time.Time{})
+	conndebug.Logf(ctx, "handshake: authenticated to %s as %s (server %s)", networkAddr, c.User(), c.ServerVersion())
+	if algos := stats.kex.getNegotiated(); algos != nil {
+		conndebug.Logf(ctx, "handshake: kex %s, host key %s, cipher %s/%s, mac %s/%s", algos.Kex, algos.HostKey, algos.CipherSend, algos.CipherRecv, algos.MACSend, algos.MACRecv)
+		if len(algos.ServerPqKex) > 0 && !isPostQuantumKex(algos.Kex) {
+			conndebug.Logf(ctx, "handshake: server offers post-quantum key exchange (%s), which is not supported", strings.Join(algos.ServerPqKex, ","))
+		}
+	}
+	client := ssh.NewClient(&statsSshConn{Conn: c, stats: stats}, chans, keyUpdater.filterRequests(c, reqs))
+	registerClientStats(client, stats)
+	return client, nil
 }
 
 func ConnectToClient(connCtx context.Context, opts *SSHOpts, currentClient *ssh.Client, jumpNum int32, connFlags *wshrpc.ConnKeywords) (*ssh.Client, int32, error) {
-	debugInfo := &ConnectionDebugInfo{
-		CurrentClient: currentClient,
-		NextOpts:      opts,
-		JumpNum:       jumpNum,
+	// proxy jumps recurse through here, so each hop gets its own (nested) span
+	connCtx, span := wtrace.Start(connCtx, "ssh.connect", "ssh.host", opts.String(), "ssh.jumpnum", jumpNum)
+	conndebug.Logf(connCtx, "connect: %s (jump %d)", opts.String(), jumpNum)
+	publishConnEventCtx(connCtx, wshrpc.ConnLifecycleEvent{Type: wshrpc.ConnEvent_Connecting, Host: opts.String(), JumpNum: jumpNum})
+	poolKey := getClientPoolKey(connCtx, opts, currentClient, connFlags)
+	if client := acquirePooledClient(poolKey); client != nil {
+		// the pooled client already holds its own reference to the jump host
+		if currentClient != nil {
+			ReleaseClient(currentClient)
+		}
+		conndebug.Logf(connCtx, "connect: %s reusing shared connection", opts.String())
+		publishConnEventCtx(connCtx, wshrpc.ConnLifecycleEvent{Type: wshrpc.ConnEvent_Connected, Host: opts.String(), JumpNum: jumpNum, Detail: "shared"})
+		span.End()
+		return client, jumpNum, nil
 	}
-	if jumpNum > SshProxyJumpMaxDepth {
-		return nil, jumpNum, ConnectionError{ConnectionDebugInfo: debugInfo, Err: fmt.Errorf("ProxyJump %d exceeds Wave's max depth of %d", jumpNum, SshProxyJumpMaxDepth)}
+	startJumpNum := jumpNum
+	client, jumpNum, err := connectToClient(connCtx, opts, poolKey, currentClient, jumpNum, connFlags)
+	span.RecordError(err)
+	span.End()
+	if err != nil {
+		conndebug.Logf(connCtx, "connect: %s failed: %v", opts.String(), err)
+	} else {
+		publishConnEventCtx(connCtx, wshrpc.ConnLifecycleEvent{Type: wshrpc.ConnEvent_Connected, Host: opts.String(), JumpNum: startJumpNum})
 	}
-	// todo print final warning if logging gets turned off
-	sshConfigKeywords, err := findSshConfigKeywords(opts.SSHHost)
+	return client, jumpNum, err
+}
+
+// the keywords for a connection, from the ssh config files, connections.json, and connFlags
+// (from the command line)
+func resolveSshKeywords(opts *SSHOpts, connFlags *wshrpc.ConnKeywords) (*wshrpc.ConnKeywords, error) {
+	sshConfigKeywords, err := findSshConfigKeywords(opts.SSHHost, opts.SSHUser)
 	if err != nil {
-		return nil, debugInfo.JumpNum, ConnectionError{ConnectionDebugInfo: debugInfo, Err: err}
+		return nil, err
 	}
 
 	connFlags.SshUser = opts.SSHUser
@@ -655,11 +1324,35 @@ func ConnectToClient(connCtx context.Context, opts *SSHOpts, currentClient *ssh.
 	if !ok {
 		savedKeywords = wshrpc.ConnKeywords{}
 	}
+	return combineSshKeywords(connFlags, sshConfigKeywords, &savedKeywords)
+}
 
-	sshKeywords, err := combineSshKeywords(connFlags, sshConfigKeywords, &savedKeywords)
+// a reference to currentClient is passed in, it is kept by the new client (or released on error)
+func connectToClient(connCtx context.Context, opts *SSHOpts, poolKey string, currentClient *ssh.Client, jumpNum int32, connFlags *wshrpc.ConnKeywords) (rtnClient *ssh.Client, rtnJumpNum int32, rtnErr error) {
+	debugInfo := &ConnectionDebugInfo{
+		CurrentClient: currentClient,
+		NextOpts:      opts,
+		JumpNum:       jumpNum,
+	}
+	defer func() {
+		if rtnErr != nil && debugInfo.CurrentClient != nil {
+			ReleaseClient(debugInfo.CurrentClient)
+		}
+	}()
+	if jumpNum > SshProxyJumpMaxDepth {
+		return nil, jumpNum, ConnectionError{ConnectionDebugInfo: debugInfo, Err: fmt.Errorf("ProxyJump %d exceeds Wave's max depth of %d", jumpNum, SshProxyJumpMaxDepth)}
+	}
+	// todo print final warning if logging gets turned off
+	sshKeywords, err := resolveSshKeywords(opts, connFlags)
 	if err != nil {
 		return nil, debugInfo.JumpNum, ConnectionError{ConnectionDebugInfo: debugInfo, Err: err}
 	}
+	if headless := getHeadlessOpts(connCtx); headless != nil && headless.StrictHostKeyChecking != "" {
+		sshKeywords.SshStrictHostKeyChecking = headless.StrictHostKeyChecking
+	}
+	conndebug.Logf(connCtx, "config: user=%s hostname=%s port=%s identityfiles=%v preferredauth=%v proxyjump=%v batchmode=%v",
+		sshKeywords.SshUser, sshKeywords.SshHostName, sshKeywords.SshPort, sshKeywords.SshIdentityFile,
+		sshKeywords.SshPreferredAuthentications, sshKeywords.SshProxyJump, sshKeywords.SshBatchMode)
 
 	for _, proxyName := range sshKeywords.SshProxyJump {
 		proxyOpts, err := ParseOpts(proxyName)
@@ -673,22 +1366,36 @@ func ConnectToClient(connCtx context.Context, opts *SSHOpts, currentClient *ssh.
 		}
 
 		// do not apply supplied keywords to proxies - ssh config must be used for that
-		debugInfo.CurrentClient, jumpNum, err = ConnectToClient(connCtx, proxyOpts, debugInfo.CurrentClient, jumpNum, &wshrpc.ConnKeywords{})
+		var proxyClient *ssh.Client
+		proxyClient, jumpNum, err = ConnectToClient(connCtx, proxyOpts, debugInfo.CurrentClient, jumpNum, &wshrpc.ConnKeywords{})
+		// the reference to the previous hop was handed over (or released on error)
+		debugInfo.CurrentClient = nil
 		if err != nil {
 			// do not add a context on a recursive call
 			// (this can cause a recursive nested context that's arbitrarily deep)
 			return nil, jumpNum, err
 		}
+		debugInfo.CurrentClient = proxyClient
+	}
+	persist, err := ParseControlPersist(sshKeywords.SshControlPersist)
+	if err != nil {
+		return nil, debugInfo.JumpNum, ConnectionError{ConnectionDebugInfo: debugInfo, Err: err}
 	}
-	clientConfig, err := createClientConfig(connCtx, sshKeywords, debugInfo)
+	clientConfig, keyUpdater, err := createClientConfig(connCtx, sshKeywords, debugInfo)
 	if err != nil {
 		return nil, debugInfo.JumpNum, ConnectionError{ConnectionDebugInfo: debugInfo, Err: err}
 	}
-	networkAddr := sshKeywords.SshHostName + ":" + sshKeywords.SshPort
-	client, err := connectInternal(connCtx, networkAddr, clientConfig, debugInfo.CurrentClient)
+	networkAddr := net.JoinHostPort(sshKeywords.SshHostName, sshKeywords.SshPort)
+	releaseSlot, err := acquireConnSlot(connCtx, networkAddr, debugInfo)
+	if err != nil {
+		return nil, debugInfo.JumpNum, ConnectionError{ConnectionDebugInfo: debugInfo, Err: err}
+	}
+	client, err := connectInternal(connCtx, networkAddr, clientConfig, makeSshDialOpts(sshKeywords), keyUpdater, debugInfo.CurrentClient)
+	releaseSlot()
 	if err != nil {
 		return client, debugInfo.JumpNum, ConnectionError{ConnectionDebugInfo: debugInfo, Err: err}
 	}
+	addPooledClient(poolKey, client, debugInfo.CurrentClient, persist)
 	return client, debugInfo.JumpNum, nil
 }
 
@@ -731,6 +1438,11 @@ func combineSshKeywords(userProvidedOpts *wshrpc.ConnKeywords, configKeywords *w
 	sshKeywords.SshIdentityFile = append(sshKeywords.SshIdentityFile, userProvidedOpts.SshIdentityFile...)
 	sshKeywords.SshIdentityFile = append(sshKeywords.SshIdentityFile, configKeywords.SshIdentityFile...)
 
+	if savedKeywords != nil {
+		sshKeywords.SshCertificateFile = append(sshKeywords.SshCertificateFile, savedKeywords.SshCertificateFile...)
+	}
+	sshKeywords.SshCertificateFile = append(sshKeywords.SshCertificateFile, configKeywords.SshCertificateFile...)
+
 	// these are not officially supported in the waveterm frontend but can be configured
 	// in ssh config files
 	sshKeywords.SshBatchMode = configKeywords.SshBatchMode
@@ -739,10 +1451,70 @@ func combineSshKeywords(userProvidedOpts *wshrpc.ConnKeywords, configKeywords *w
 	sshKeywords.SshKbdInteractiveAuthentication = configKeywords.SshKbdInteractiveAuthentication
 	sshKeywords.SshPreferredAuthentications = configKeywords.SshPreferredAuthentications
 	sshKeywords.SshAddKeysToAgent = configKeywords.SshAddKeysToAgent
+	sshKeywords.SshIdentitiesOnly = configKeywords.SshIdentitiesOnly
 	sshKeywords.SshIdentityAgent = configKeywords.SshIdentityAgent
+	sshKeywords.SshSecurityKeyProvider = configKeywords.SshSecurityKeyProvider
 	sshKeywords.SshProxyJump = configKeywords.SshProxyJump
+	if savedKeywords != nil && len(savedKeywords.SshProxyJump) > 0 {
+		sshKeywords.SshProxyJump = savedKeywords.SshProxyJump
+	}
 	sshKeywords.SshUserKnownHostsFile = configKeywords.SshUserKnownHostsFile
 	sshKeywords.SshGlobalKnownHostsFile = configKeywords.SshGlobalKnownHostsFile
+	sshKeywords.SshHashKnownHosts = configKeywords.SshHashKnownHosts
+	sshKeywords.SshStrictHostKeyChecking = configKeywords.SshStrictHostKeyChecking
+	sshKeywords.SshRevokedHostKeys = configKeywords.SshRevokedHostKeys
+	sshKeywords.SshUpdateHostKeys = configKeywords.SshUpdateHostKeys
+	sshKeywords.SshCiphers = configKeywords.SshCiphers
+	sshKeywords.SshMACs = configKeywords.SshMACs
+	sshKeywords.SshKexAlgorithms = configKeywords.SshKexAlgorithms
+	sshKeywords.SshHostKeyAlgorithms = configKeywords.SshHostKeyAlgorithms
+	if savedKeywords != nil {
+		if savedKeywords.SshCiphers != "" {
+			sshKeywords.SshCiphers = savedKeywords.SshCiphers
+		}
+		if savedKeywords.SshMACs != "" {
+			sshKeywords.SshMACs = savedKeywords.SshMACs
+		}
+		if savedKeywords.SshKexAlgorithms != "" {
+			sshKeywords.SshKexAlgorithms = savedKeywords.SshKexAlgorithms
+		}
+		if savedKeywords.SshHostKeyAlgorithms != "" {
+			sshKeywords.SshHostKeyAlgorithms = savedKeywords.SshHostKeyAlgorithms
+		}
+	}
+
+	sshKeywords.SshAddressFamily = configKeywords.SshAddressFamily
+	sshKeywords.SshConnectTimeout = configKeywords.SshConnectTimeout
+	if savedKeywords != nil && savedKeywords.SshConnectTimeout != nil {
+		sshKeywords.SshConnectTimeout = savedKeywords.SshConnectTimeout
+	}
+	sshKeywords.SshConnectionAttempts = configKeywords.SshConnectionAttempts
+	if savedKeywords != nil && savedKeywords.SshConnectionAttempts != nil {
+		sshKeywords.SshConnectionAttempts = savedKeywords.SshConnectionAttempts
+	}
+
+	if savedKeywords != nil {
+		sshKeywords.ConnTailscale = savedKeywords.ConnTailscale
+		sshKeywords.ConnTotpPrompt = savedKeywords.ConnTotpPrompt
+		sshKeywords.Ec2InstanceId = savedKeywords.Ec2InstanceId
+		sshKeywords.Ec2Region = savedKeywords.Ec2Region
+		sshKeywords.Ec2Profile = savedKeywords.Ec2Profile
+		sshKeywords.GcpIap = savedKeywords.GcpIap
+		sshKeywords.GcpProject = savedKeywords.GcpProject
+		sshKeywords.GcpZone = savedKeywords.GcpZone
+		sshKeywords.GcpInstance = savedKeywords.GcpInstance
+		sshKeywords.GcpInterface = savedKeywords.GcpInterface
+		sshKeywords.AzureBastion = savedKeywords.AzureBastion
+		sshKeywords.AzureResourceGroup = savedKeywords.AzureResourceGroup
+		sshKeywords.AzureSubscription = savedKeywords.AzureSubscription
+		sshKeywords.AzureVmId = savedKeywords.AzureVmId
+	}
+
+	if savedKeywords != nil && savedKeywords.SshControlPersist != "" {
+		sshKeywords.SshControlPersist = savedKeywords.SshControlPersist
+	} else {
+		sshKeywords.SshControlPersist = configKeywords.SshControlPersist
+	}
 
 	return sshKeywords, nil
 }
@@ -750,79 +1522,63 @@ func combineSshKeywords(userProvidedOpts *wshrpc.ConnKeywords, configKeywords *w
 // note that a `var == "yes"` will default to false
 // but `var != "no"` will default to true
 // when given unexpected strings
-func findSshConfigKeywords(hostPattern string) (*wshrpc.ConnKeywords, error) {
+func findSshConfigKeywords(hostPattern string, userName string) (*wshrpc.ConnKeywords, error) {
 	WaveSshConfigUserSettings().ReloadConfigs()
-	sshKeywords := &wshrpc.ConnKeywords{}
-	var err error
-	//config := wconfig.ReadFullConfig()
-
-	userRaw, err := WaveSshConfigUserSettings().GetStrict(hostPattern, "User")
+	sshConfig, err := WaveSshConfigUserSettings().Resolve(hostPattern, userName)
 	if err != nil {
 		return nil, err
 	}
+	sshKeywords := &wshrpc.ConnKeywords{}
+
+	userRaw := sshConfig.Get("User")
 	sshKeywords.SshUser = trimquotes.TryTrimQuotes(userRaw)
 
-	hostNameRaw, err := WaveSshConfigUserSettings().GetStrict(hostPattern, "HostName")
-	if err != nil {
-		return nil, err
-	}
+	hostNameRaw := sshConfig.Get("HostName")
 	sshKeywords.SshHostName = trimquotes.TryTrimQuotes(hostNameRaw)
 
-	portRaw, err := WaveSshConfigUserSettings().GetStrict(hostPattern, "Port")
-	if err != nil {
-		return nil, err
-	}
+	portRaw := sshConfig.Get("Port")
 	sshKeywords.SshPort = trimquotes.TryTrimQuotes(portRaw)
 
-	identityFileRaw := WaveSshConfigUserSettings().GetAll(hostPattern, "IdentityFile")
+	identityFileRaw := sshConfig.GetAll("IdentityFile")
 	for i := 0; i < len(identityFileRaw); i++ {
 		identityFileRaw[i] = trimquotes.TryTrimQuotes(identityFileRaw[i])
 	}
 	sshKeywords.SshIdentityFile = identityFileRaw
 
-	batchModeRaw, err := WaveSshConfigUserSettings().GetStrict(hostPattern, "BatchMode")
-	if err != nil {
-		return nil, err
+	for _, certificateFile := range sshConfig.GetAll("CertificateFile") {
+		sshKeywords.SshCertificateFile = append(sshKeywords.SshCertificateFile, trimquotes.TryTrimQuotes(certificateFile))
 	}
+
+	batchModeRaw := sshConfig.Get("BatchMode")
 	sshKeywords.SshBatchMode = (strings.ToLower(trimquotes.TryTrimQuotes(batchModeRaw)) == "yes")
 
+	controlPersistRaw := sshConfig.Get("ControlPersist")
+	sshKeywords.SshControlPersist = trimquotes.TryTrimQuotes(controlPersistRaw)
+
 	// we currently do not support host-bound or unbound but will use yes when they are selected
-	pubkeyAuthenticationRaw, err := WaveSshConfigUserSettings().GetStrict(hostPattern, "PubkeyAuthentication")
-	if err != nil {
-		return nil, err
-	}
+	pubkeyAuthenticationRaw := sshConfig.Get("PubkeyAuthentication")
 	sshKeywords.SshPubkeyAuthentication = (strings.ToLower(trimquotes.TryTrimQuotes(pubkeyAuthenticationRaw)) != "no")
 
-	passwordAuthenticationRaw, err := WaveSshConfigUserSettings().GetStrict(hostPattern, "PasswordAuthentication")
-	if err != nil {
-		return nil, err
-	}
+	passwordAuthenticationRaw := sshConfig.Get("PasswordAuthentication")
 	sshKeywords.SshPasswordAuthentication = (strings.ToLower(trimquotes.TryTrimQuotes(passwordAuthenticationRaw)) != "no")
 
-	kbdInteractiveAuthenticationRaw, err := WaveSshConfigUserSettings().GetStrict(hostPattern, "KbdInteractiveAuthentication")
-	if err != nil {
-		return nil, err
-	}
+	kbdInteractiveAuthenticationRaw := sshConfig.Get("KbdInteractiveAuthentication")
 	sshKeywords.SshKbdInteractiveAuthentication = (strings.ToLower(trimquotes.TryTrimQuotes(kbdInteractiveAuthenticationRaw)) != "no")
 
 	// these are parsed as a single string and must be separated
 	// these are case sensitive in openssh so they are here too
-	preferredAuthenticationsRaw, err := WaveSshConfigUserSettings().GetStrict(hostPattern, "PreferredAuthentications")
-	if err != nil {
-		return nil, err
-	}
+	preferredAuthenticationsRaw := sshConfig.Get("PreferredAuthentications")
 	sshKeywords.SshPreferredAuthentications = strings.Split(trimquotes.TryTrimQuotes(preferredAuthenticationsRaw), ",")
-	addKeysToAgentRaw, err := WaveSshConfigUserSettings().GetStrict(hostPattern, "AddKeysToAgent")
-	if err != nil {
-		return nil, err
-	}
+	addKeysToAgentRaw := sshConfig.Get("AddKeysToAgent")
 	sshKeywords.SshAddKeysToAgent = (strings.ToLower(trimquotes.TryTrimQuotes(addKeysToAgentRaw)) == "yes")
-
-	identityAgentRaw, err := WaveSshConfigUserSettings().GetStrict(hostPattern, "IdentityAgent")
-	if err != nil {
-		return nil, err
-	}
-	if identityAgentRaw == "" {
+	identitiesOnlyRaw := sshConfig.Get("IdentitiesOnly")
+	sshKeywords.SshIdentitiesOnly = (strings.ToLower(trimquotes.TryTrimQuotes(identitiesOnlyRaw)) == "yes")
+
+	identityAgentRaw := sshConfig.Get("IdentityAgent")
+	if identityAgentRaw == "" && runtime.GOOS == "windows" {
+		// the windows shells don't take -c, an empty path tries the default agents
+		sshKeywords.SshIdentityAgent = os.Getenv("SSH_AUTH_SOCK")
+	} else if identityAgentRaw == "" {
 		shellPath := shellutil.DetectLocalShellPath()
 		authSockCommand := exec.Command(shellPath, "-c", "echo ${SSH_AUTH_SOCK}")
 		sshAuthSock, err := authSockCommand.Output()
@@ -843,10 +1599,9 @@ func findSshConfigKeywords(hostPattern string) (*wshrpc.ConnKeywords, error) {
 		sshKeywords.SshIdentityAgent = agentPath
 	}
 
-	proxyJumpRaw, err := WaveSshConfigUserSettings().GetStrict(hostPattern, "ProxyJump")
-	if err != nil {
-		return nil, err
-	}
+	sshKeywords.SshSecurityKeyProvider = trimquotes.TryTrimQuotes(sshConfig.Get("SecurityKeyProvider"))
+
+	proxyJumpRaw := sshConfig.Get("ProxyJump")
 	proxyJumpSplit := strings.Split(proxyJumpRaw, ",")
 	for _, proxyJumpName := range proxyJumpSplit {
 		proxyJumpName = strings.TrimSpace(proxyJumpName)
@@ -855,10 +1610,61 @@ func findSshConfigKeywords(hostPattern string) (*wshrpc.ConnKeywords, error) {
 		}
 		sshKeywords.SshProxyJump = append(sshKeywords.SshProxyJump, proxyJumpName)
 	}
-	rawUserKnownHostsFile, _ := WaveSshConfigUserSettings().GetStrict(hostPattern, "UserKnownHostsFile")
+	rawUserKnownHostsFile := sshConfig.Get("UserKnownHostsFile")
 	sshKeywords.SshUserKnownHostsFile = strings.Fields(rawUserKnownHostsFile) // TODO - smarter splitting escaped spaces and quotes
-	rawGlobalKnownHostsFile, _ := WaveSshConfigUserSettings().GetStrict(hostPattern, "GlobalKnownHostsFile")
+	rawGlobalKnownHostsFile := sshConfig.Get("GlobalKnownHostsFile")
 	sshKeywords.SshGlobalKnownHostsFile = strings.Fields(rawGlobalKnownHostsFile) // TODO - smarter splitting escaped spaces and quotes
+	hashKnownHostsRaw := sshConfig.Get("HashKnownHosts")
+	sshKeywords.SshHashKnownHosts = (strings.ToLower(trimquotes.TryTrimQuotes(hashKnownHostsRaw)) == "yes")
+	strictHostKeyCheckingRaw := sshConfig.Get("StrictHostKeyChecking")
+	sshKeywords.SshStrictHostKeyChecking = normalizeStrictHostKeyChecking(trimquotes.TryTrimQuotes(strictHostKeyCheckingRaw))
+	revokedHostKeysRaw := trimquotes.TryTrimQuotes(sshConfig.Get("RevokedHostKeys"))
+	if strings.ToLower(revokedHostKeysRaw) != "none" {
+		sshKeywords.SshRevokedHostKeys = revokedHostKeysRaw
+	}
+	updateHostKeysRaw := ""
+	if sshConfig.IsSet("UpdateHostKeys") {
+		updateHostKeysRaw = trimquotes.TryTrimQuotes(sshConfig.Get("UpdateHostKeys"))
+	}
+	sshKeywords.SshUpdateHostKeys = normalizeUpdateHostKeys(updateHostKeysRaw, !sshConfig.IsSet("UserKnownHostsFile"))
+	connectTimeoutRaw := strings.ToLower(trimquotes.TryTrimQuotes(sshConfig.Get("ConnectTimeout")))
+	if connectTimeoutRaw != "" && connectTimeoutRaw != "none" {
+		connectTimeout, err := strconv.Atoi(connectTimeoutRaw)
+		if err != nil || connectTimeout < 0 {
+			return nil, fmt.Errorf("invalid ConnectTimeout %q", connectTimeoutRaw)
+		}
+		sshKeywords.SshConnectTimeout = &connectTimeout
+	}
+	connectionAttemptsRaw := trimquotes.TryTrimQuotes(sshConfig.Get("ConnectionAttempts"))
+	if connectionAttemptsRaw != "" {
+		connectionAttempts, err := strconv.Atoi(connectionAttemptsRaw)
+		if err != nil || connectionAttempts < 1 {
+			return nil, fmt.Errorf("invalid ConnectionAttempts %q", connectionAttemptsRaw)
+		}
+		sshKeywords.SshConnectionAttempts = &connectionAttempts
+	}
+	addressFamilyRaw := strings.ToLower(trimquotes.TryTrimQuotes(sshConfig.Get("AddressFamily")))
+	switch addressFamilyRaw {
+	case "", "any":
+	case "inet", "inet6":
+		sshKeywords.SshAddressFamily = addressFamilyRaw
+	default:
+		return nil, fmt.Errorf("invalid AddressFamily %q", addressFamilyRaw)
+	}
+	// only set when configured, Get returns openssh's defaults (which have algorithms the ssh
+	// library doesn't support)
+	if sshConfig.IsSet("Ciphers") {
+		sshKeywords.SshCiphers = trimquotes.TryTrimQuotes(sshConfig.Get("Ciphers"))
+	}
+	if sshConfig.IsSet("MACs") {
+		sshKeywords.SshMACs = trimquotes.TryTrimQuotes(sshConfig.Get("MACs"))
+	}
+	if sshConfig.IsSet("KexAlgorithms") {
+		sshKeywords.SshKexAlgorithms = trimquotes.TryTrimQuotes(sshConfig.Get("KexAlgorithms"))
+	}
+	if sshConfig.IsSet("HostKeyAlgorithms") {
+		sshKeywords.SshHostKeyAlgorithms = trimquotes.TryTrimQuotes(sshConfig.Get("HostKeyAlgorithms"))
+	}
 
 	return sshKeywords, nil
 }
@@ -874,7 +1680,12 @@ func (opts SSHOpts) String() string {
 	if opts.SSHUser != "" {
 		stringRepr = opts.SSHUser + "@"
 	}
-	stringRepr = stringRepr + opts.SSHHost
+	if strings.Contains(opts.SSHHost, ":") {
+		// ipv6
+		stringRepr = stringRepr + "[" + opts.SSHHost + "]"
+	} else {
+		stringRepr = stringRepr + opts.SSHHost
+	}
 	if opts.SSHPort != 0 {
 		stringRepr = stringRepr + ":" + fmt.Sprint(opts.SSHPort)
 	}
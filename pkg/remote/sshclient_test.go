@@ -0,0 +1,269 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"golang.org/x/crypto/ssh"
+	xknownhosts "golang.org/x/crypto/ssh/knownhosts"
+)
+
+func makeTestCert(t *testing.T, pubKey ssh.PublicKey, caSigner ssh.Signer) []byte {
+	cert := &ssh.Certificate{
+		Key:             pubKey,
+		CertType:        ssh.UserCert,
+		KeyId:           "test",
+		ValidPrincipals: []string{"test"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	if err := cert.SignCert(rand.Reader, caSigner); err != nil {
+		t.Fatal(err)
+	}
+	return ssh.MarshalAuthorizedKey(cert)
+}
+
+func TestCertSigners(t *testing.T) {
+	dir := t.TempDir()
+	_, caKey, _ := ed25519.GenerateKey(rand.Reader)
+	caSigner, err := ssh.NewSignerFromKey(caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signers []ssh.Signer
+	for i := 0; i < 2; i++ {
+		_, key, _ := ed25519.GenerateKey(rand.Reader)
+		signer, err := ssh.NewSignerFromKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signers = append(signers, signer)
+	}
+	// the first key's certificate is paired by name, the second is from CertificateFile
+	identityFile := filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(identityFile+"-cert.pub", makeTestCert(t, signers[0].PublicKey(), caSigner), 0644); err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(dir, "other-cert.pub")
+	if err := os.WriteFile(certFile, makeTestCert(t, signers[1].PublicKey(), caSigner), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sshKeywords := &wshrpc.ConnKeywords{
+		SshIdentityFile:    []string{identityFile, filepath.Join(dir, "missing")},
+		SshCertificateFile: []string{certFile},
+	}
+	certs := loadCertificates(context.Background(), sshKeywords, nil)
+	if len(certs) != 2 {
+		t.Fatalf("got %d certificates, expected 2", len(certs))
+	}
+	for idx, signer := range signers {
+		rtn := withCertSigners(context.Background(), signer, certs)
+		if len(rtn) != 2 {
+			t.Fatalf("key %d: got %d signers, expected 2", idx, len(rtn))
+		}
+		cert, ok := rtn[0].PublicKey().(*ssh.Certificate)
+		if !ok || string(cert.Key.Marshal()) != string(signer.PublicKey().Marshal()) {
+			t.Errorf("key %d: the first signer is not its certificate", idx)
+		}
+		if rtn[1] != signer {
+			t.Errorf("key %d: the plain key should be offered after the certificate", idx)
+		}
+	}
+	// certificates the agent has are not loaded again
+	if certs := loadCertificates(context.Background(), sshKeywords, []ssh.Signer{mustCertSigner(t, certs[0], signers[1])}); len(certs) != 1 {
+		t.Errorf("got %d certificates with one in the agent, expected 1", len(certs))
+	}
+}
+
+func mustCertSigner(t *testing.T, cert *ssh.Certificate, signer ssh.Signer) ssh.Signer {
+	certSigner, err := ssh.NewCertSigner(cert, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certSigner
+}
+
+func TestHashedKnownHostsLine(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hostname := range []string{"example.com:22", "example.com:2222"} {
+		line := makeKnownHostsLine(hostname, key, true)
+		if strings.Contains(line, "example.com") || !strings.HasPrefix(line, "|1|") {
+			t.Errorf("%s: hostname is not hashed: %q", hostname, line)
+		}
+		knownHostsFile := filepath.Join(t.TempDir(), "known_hosts")
+		if err := os.WriteFile(knownHostsFile, []byte(line+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		callback, err := xknownhosts.New(knownHostsFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 22}
+		if err := callback(hostname, addr, key); err != nil {
+			t.Errorf("%s: hashed line does not match: %v", hostname, err)
+		}
+		if err := callback("other.com:22", addr, key); err == nil {
+			t.Errorf("%s: hashed line matches another host", hostname)
+		}
+	}
+	if line := makeKnownHostsLine("example.com:22", key, false); !strings.HasPrefix(line, "example.com ") {
+		t.Errorf("unhashed line: %q", line)
+	}
+}
+
+func TestStrictHostKeyChecking(t *testing.T) {
+	knownKey, otherKey := makeTestHostKey(t), makeTestHostKey(t)
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 22}
+	tests := []struct {
+		value    string
+		hostKey  ssh.PublicKey
+		hostname string
+		wantErr  bool
+		added    bool
+	}{
+		{"yes", otherKey, "new.example.com:22", true, false},
+		{"accept-new", otherKey, "new.example.com:22", false, true},
+		{"accept-new", otherKey, "known.example.com:22", true, false},
+		{"no", otherKey, "new.example.com:22", false, true},
+		{"off", otherKey, "known.example.com:22", false, false},
+		{"yes", knownKey, "known.example.com:22", false, false},
+	}
+	for _, test := range tests {
+		knownHostsFile := filepath.Join(t.TempDir(), "known_hosts")
+		if err := os.WriteFile(knownHostsFile, []byte(makeKnownHostsLine("known.example.com:22", knownKey, false)+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		// root only reads the global files
+		sshKeywords := &wshrpc.ConnKeywords{
+			SshUserKnownHostsFile:    []string{knownHostsFile},
+			SshGlobalKnownHostsFile:  []string{knownHostsFile},
+			SshStrictHostKeyChecking: normalizeStrictHostKeyChecking(test.value),
+		}
+		callback, _, err := createHostKeyCallback(context.Background(), "test", sshKeywords, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = callback(test.hostname, addr, test.hostKey)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s %s: got error %v", test.value, test.hostname, err)
+		}
+		status, _, _ := CheckKnownHostKey([]string{knownHostsFile}, strings.TrimSuffix(test.hostname, ":22"), test.hostKey)
+		if added := status == wshrpc.KnownHostStatus_Known && strings.HasPrefix(test.hostname, "new."); added != test.added {
+			t.Errorf("%s %s: key added = %v", test.value, test.hostname, added)
+		}
+	}
+}
+
+func TestDialWithRetries(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close() // nothing is listening on addr now
+	clientConfig := &ssh.ClientConfig{Timeout: time.Second}
+	start := time.Now()
+	if _, err := dialWithRetries(context.Background(), addr, clientConfig, sshDialOpts{network: "tcp", attempts: 2}, nil); err == nil {
+		t.Fatalf("expected the dial to fail")
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("two attempts took %v, expected a pause between them", elapsed)
+	}
+	ctx, cancelFn := context.WithCancel(context.Background())
+	cancelFn()
+	start = time.Now()
+	if _, err := dialWithRetries(ctx, addr, clientConfig, sshDialOpts{network: "tcp", attempts: 5}, nil); err == nil {
+		t.Fatalf("expected the dial to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("a canceled dial was retried (took %v)", elapsed)
+	}
+	// an ipv4 address can't be reached as inet6
+	if _, err := dialWithRetries(context.Background(), addr, clientConfig, sshDialOpts{network: sshDialNetwork("inet6"), attempts: 1}, nil); err == nil {
+		t.Errorf("expected an inet6 dial of an ipv4 address to fail")
+	}
+}
+
+func TestIdentitiesOnlyAgentSigners(t *testing.T) {
+	dir := t.TempDir()
+	var signers []ssh.Signer
+	var privateKeys []ed25519.PrivateKey
+	for i := 0; i < 3; i++ {
+		_, key, _ := ed25519.GenerateKey(rand.Reader)
+		signer, err := ssh.NewSignerFromKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signers = append(signers, signer)
+		privateKeys = append(privateKeys, key)
+	}
+	// the first identity is known by its .pub file (its private key is "encrypted"), the second by
+	// its private key, and the third is not configured
+	withPub := filepath.Join(dir, "id_pub")
+	if err := os.WriteFile(withPub, []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(withPub+".pub", ssh.MarshalAuthorizedKey(signers[0].PublicKey()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	noPub := filepath.Join(dir, "id_nopub")
+	pemBlock, err := ssh.MarshalPrivateKey(privateKeys[1], "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(noPub, pem.EncodeToMemory(pemBlock), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sshKeywords := &wshrpc.ConnKeywords{SshIdentityFile: []string{withPub, noPub, filepath.Join(dir, "missing")}}
+	filtered := filterConfiguredAgentSigners(sshKeywords, signers)
+	if len(filtered) != 2 || filtered[0] != signers[0] || filtered[1] != signers[1] {
+		t.Errorf("got %d agent signers, expected the first two", len(filtered))
+	}
+}
+
+func TestHandshakeTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	// accepts, and never sends a version line
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	clientConfig := &ssh.ClientConfig{
+		User:            "user",
+		Timeout:         300 * time.Millisecond,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+	dialOpts := sshDialOpts{network: "tcp", attempts: 1, tailscale: new(bool)}
+	start := time.Now()
+	_, err = connectInternal(context.Background(), listener.Addr().String(), clientConfig, dialOpts, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected a handshake timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("handshake took %v to time out", elapsed)
+	}
+}
@@ -0,0 +1,630 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kevinburke/ssh_config"
+	"github.com/wavetermdev/waveterm/pkg/util/shellutil"
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+)
+
+// reads the ssh config files (~/.ssh/config, then /etc/ssh/ssh_config) the way openssh does, so the
+// keywords agree with "ssh -G".  the ssh_config library can't do this because it doesn't support
+// Match blocks (with IgnoreMatchDirective, the keywords after a Match line end up in the Host block
+// before it).
+//
+// like openssh, the first value found for a keyword wins (multi-valued keywords like IdentityFile
+// and LocalForward collect every value), Host lines are matched against the alias, and Match
+// supports all, canonical, final, exec, host, originalhost, user, localuser, localnetwork, and
+// tagged (each can be negated with "!").
+//
+// with CanonicalizeHostname, the hostname is expanded with CanonicalDomains after the first pass
+// (like ssh, a name is canonical once it resolves), and the files are read again with Host lines
+// matched against the canonical name ("canonical" and "final" match in that pass).
+// CanonicalizePermittedCNAMEs is not supported, CNAMEs are not followed.
+
+const SshConfigMaxIncludeDepth = 16
+const SshMatchExecTimeout = 10 * time.Second
+const SshCanonicalizeLookupTimeout = 5 * time.Second
+
+var defaultSshIdentityFiles = []string{
+	"~/.ssh/id_rsa",
+	"~/.ssh/id_ecdsa",
+	"~/.ssh/id_ecdsa_sk",
+	"~/.ssh/id_ed25519",
+	"~/.ssh/id_ed25519_sk",
+	"~/.ssh/id_dsa",
+}
+
+type sshConfigLine struct {
+	key      string // lowercased
+	value    string // as written (quotes are kept, comments are removed)
+	args     []string
+	included []*sshConfigFile // for Include
+	pos      string
+}
+
+type sshConfigFile struct {
+	path  string
+	lines []*sshConfigLine
+}
+
+// SshConfigResult is the resolved config for one host
+type SshConfigResult struct {
+	values map[string][]string
+}
+
+// the first value for key (or the openssh default)
+func (r *SshConfigResult) Get(key string) string {
+	vals := r.values[strings.ToLower(key)]
+	if len(vals) > 0 {
+		return vals[0]
+	}
+	return ssh_config.Default(key)
+}
+
+// whether key was set in a config file (Get returns the default otherwise)
+func (r *SshConfigResult) IsSet(key string) bool {
+	return len(r.values[strings.ToLower(key)]) > 0
+}
+
+// every value for key (or the openssh defaults)
+func (r *SshConfigResult) GetAll(key string) []string {
+	vals := r.values[strings.ToLower(key)]
+	if len(vals) > 0 {
+		return append([]string(nil), vals...)
+	}
+	if strings.ToLower(key) == "identityfile" {
+		return append([]string(nil), defaultSshIdentityFiles...)
+	}
+	if def := ssh_config.Default(key); def != "" {
+		return []string{def}
+	}
+	return nil
+}
+
+type SshConfigSettings struct {
+	lock                *sync.Mutex
+	userConfigPath      string
+	generatedConfigPath string // written by wave (see vagrant.go), read after the user's config
+	systemConfigPath    string
+	loaded              bool
+	files               []*sshConfigFile
+	loadErr             error
+	cache               map[string]*SshConfigResult
+	lookupHost          func(ctx context.Context, host string) ([]string, error) // for CanonicalizeHostname
+}
+
+func MakeSshConfigSettings(userConfigPath string, systemConfigPath string) *SshConfigSettings {
+	return &SshConfigSettings{
+		lock:             &sync.Mutex{},
+		userConfigPath:   userConfigPath,
+		systemConfigPath: systemConfigPath,
+		lookupHost:       net.DefaultResolver.LookupHost,
+	}
+}
+
+// re-reads the config files (and forgets resolved hosts, Match exec results can change)
+func (s *SshConfigSettings) ReloadConfigs() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.loaded = false
+	s.files = nil
+	s.loadErr = nil
+	s.cache = nil
+}
+
+func (s *SshConfigSettings) load_nolock() {
+	if s.loaded {
+		return
+	}
+	s.loaded = true
+	s.cache = make(map[string]*SshConfigResult)
+	for _, configPath := range []string{s.userConfigPath, s.generatedConfigPath, s.systemConfigPath} {
+		if configPath == "" {
+			continue
+		}
+		file, err := parseSshConfigFile(configPath, filepath.Dir(configPath), 0)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			s.loadErr = err
+			return
+		}
+		s.files = append(s.files, file)
+	}
+}
+
+// resolves the config for a host alias.  user is the user given with the connection (it takes
+// priority over User for "Match user"), it can be empty.
+func (s *SshConfigSettings) Resolve(alias string, user string) (*SshConfigResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.load_nolock()
+	if s.loadErr != nil {
+		return nil, s.loadErr
+	}
+	cacheKey := user + "@" + alias
+	if rtn := s.cache[cacheKey]; rtn != nil {
+		return rtn, nil
+	}
+	eval := makeSshConfigEval(alias, user)
+	for _, file := range s.files {
+		if err := eval.applyFile(file); err != nil {
+			return nil, err
+		}
+	}
+	canonicalHost, err := eval.canonicalizeHostname(s.lookupHost)
+	if err != nil {
+		return nil, err
+	}
+	if canonicalHost != "" {
+		// like ssh, the canonical name replaces HostName and Host lines are matched against it
+		eval.canonical = canonicalHost
+		eval.values["hostname"] = []string{canonicalHost}
+	}
+	if eval.sawFinal || eval.canonicalizeEnabled() {
+		eval.final = true
+		for _, file := range s.files {
+			if err := eval.applyFile(file); err != nil {
+				return nil, err
+			}
+		}
+	}
+	rtn := &SshConfigResult{values: eval.values}
+	s.cache[cacheKey] = rtn
+	return rtn, nil
+}
+
+// same as the ssh_config library's UserSettings.GetStrict
+func (s *SshConfigSettings) GetStrict(alias string, key string) (string, error) {
+	result, err := s.Resolve(alias, "")
+	if err != nil {
+		return "", err
+	}
+	return result.Get(key), nil
+}
+
+// same as the ssh_config library's UserSettings.GetAll (errors return nil)
+func (s *SshConfigSettings) GetAll(alias string, key string) []string {
+	result, err := s.Resolve(alias, "")
+	if err != nil {
+		return nil
+	}
+	return result.GetAll(key)
+}
+
+// splits a config value into arguments (handling quotes), and returns where a trailing
+// comment starts (or len(val))
+func splitSshConfigArgs(val string) ([]string, int, error) {
+	var args []string
+	var cur strings.Builder
+	inArg := false
+	var quote byte
+	for idx := 0; idx < len(val); idx++ {
+		ch := val[idx]
+		if quote != 0 {
+			if ch == quote {
+				quote = 0
+			} else {
+				cur.WriteByte(ch)
+			}
+			continue
+		}
+		switch {
+		case ch == '"' || ch == '\'':
+			quote = ch
+			inArg = true
+		case ch == ' ' || ch == '\t':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		case ch == '#' && !inArg:
+			return args, idx, nil
+		default:
+			cur.WriteByte(ch)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, 0, fmt.Errorf("unterminated quote")
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, len(val), nil
+}
+
+// includeDir is where relative Include paths are found (~/.ssh or /etc/ssh)
+func parseSshConfigFile(path string, includeDir string, depth int) (*sshConfigFile, error) {
+	if depth > SshConfigMaxIncludeDepth {
+		return nil, fmt.Errorf("ssh config: too many nested includes at %s", path)
+	}
+	barr, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rtn := &sshConfigFile{path: path}
+	for lineIdx, lineStr := range strings.Split(string(barr), "\n") {
+		lineStr = strings.TrimSpace(strings.TrimSuffix(lineStr, "\r"))
+		if lineStr == "" || strings.HasPrefix(lineStr, "#") {
+			continue
+		}
+		pos := fmt.Sprintf("%s line %d", path, lineIdx+1)
+		keyEnd := strings.IndexAny(lineStr, " \t=")
+		if keyEnd == -1 {
+			return nil, fmt.Errorf("ssh config: %s: keyword %q has no value", pos, lineStr)
+		}
+		key := strings.ToLower(lineStr[:keyEnd])
+		rest := strings.TrimLeft(lineStr[keyEnd:], " \t")
+		rest = strings.TrimLeft(strings.TrimPrefix(rest, "="), " \t")
+		args, commentIdx, err := splitSshConfigArgs(rest)
+		if err != nil {
+			return nil, fmt.Errorf("ssh config: %s: %w", pos, err)
+		}
+		line := &sshConfigLine{
+			key:   key,
+			value: strings.TrimSpace(rest[:commentIdx]),
+			args:  args,
+			pos:   pos,
+		}
+		if key == "include" {
+			for _, arg := range args {
+				pattern, err := wavebase.ExpandHomeDir(arg)
+				if err != nil {
+					return nil, err
+				}
+				if !filepath.IsAbs(pattern) {
+					pattern = filepath.Join(includeDir, pattern)
+				}
+				matches, err := filepath.Glob(pattern)
+				if err != nil {
+					return nil, fmt.Errorf("ssh config: %s: %w", pos, err)
+				}
+				for _, match := range matches {
+					included, err := parseSshConfigFile(match, includeDir, depth+1)
+					if err != nil {
+						return nil, err
+					}
+					line.included = append(line.included, included)
+				}
+			}
+		}
+		rtn.lines = append(rtn.lines, line)
+	}
+	return rtn, nil
+}
+
+type sshConfigEval struct {
+	alias     string
+	canonical string // the canonical hostname, for the final pass
+	user      string
+	localUser string
+	final     bool
+	sawFinal  bool
+	values    map[string][]string
+}
+
+func makeSshConfigEval(alias string, user string) *sshConfigEval {
+	rtn := &sshConfigEval{
+		alias:  alias,
+		user:   user,
+		values: make(map[string][]string),
+	}
+	if localUser, err := userCurrent(); err == nil {
+		rtn.localUser = localUser
+	}
+	return rtn
+}
+
+func userCurrent() (string, error) {
+	localUser, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	return localUser.Username, nil
+}
+
+func (e *sshConfigEval) first(key string) string {
+	if vals := e.values[key]; len(vals) > 0 {
+		return vals[0]
+	}
+	return ""
+}
+
+// the target hostname so far (HostName, or the alias)
+func (e *sshConfigEval) hostName() string {
+	hostName := strings.Trim(e.first("hostname"), `"`)
+	if hostName == "" {
+		return e.alias
+	}
+	return strings.ReplaceAll(hostName, "%h", e.alias)
+}
+
+func (e *sshConfigEval) remoteUser() string {
+	if e.user != "" {
+		return e.user
+	}
+	if configUser := strings.Trim(e.first("user"), `"`); configUser != "" {
+		return configUser
+	}
+	return e.localUser
+}
+
+// a file starts as if it were under "Host *".  keywords in included files are applied in place,
+// and Host/Match lines in them don't change the block the Include was in.
+func (e *sshConfigEval) applyFile(file *sshConfigFile) error {
+	active := true
+	for _, line := range file.lines {
+		switch line.key {
+		case "host":
+			hostTarget := e.alias
+			if e.canonical != "" {
+				hostTarget = e.canonical
+			}
+			active = matchSshHostPatterns(line.args, hostTarget)
+		case "match":
+			var err error
+			active, err = e.evalMatch(line.args)
+			if err != nil {
+				return fmt.Errorf("ssh config: %s: %w", line.pos, err)
+			}
+		case "include":
+			if !active {
+				continue
+			}
+			for _, included := range line.included {
+				if err := e.applyFile(included); err != nil {
+					return err
+				}
+			}
+		default:
+			// the final pass sees every line again, and like ssh repeated values are only kept once
+			if active && !slices.Contains(e.values[line.key], line.value) {
+				e.values[line.key] = append(e.values[line.key], line.value)
+			}
+		}
+	}
+	return nil
+}
+
+func (e *sshConfigEval) canonicalizeEnabled() bool {
+	mode := strings.ToLower(strings.Trim(e.first("canonicalizehostname"), `"`))
+	return mode == "yes" || mode == "always"
+}
+
+// returns the canonical name of the target host, or "" if it is not changed.  with "yes", hosts
+// reached through ProxyJump or ProxyCommand are not canonicalized ("always" does them too).
+func (e *sshConfigEval) canonicalizeHostname(lookupHost func(ctx context.Context, host string) ([]string, error)) (string, error) {
+	mode := strings.ToLower(strings.Trim(e.first("canonicalizehostname"), `"`))
+	if mode != "yes" && mode != "always" {
+		return "", nil
+	}
+	if mode == "yes" {
+		for _, key := range []string{"proxyjump", "proxycommand"} {
+			if val := strings.Trim(e.first(key), `"`); val != "" && strings.ToLower(val) != "none" {
+				return "", nil
+			}
+		}
+	}
+	hostName := e.hostName()
+	if net.ParseIP(hostName) != nil {
+		return "", nil
+	}
+	if strings.HasSuffix(hostName, ".") {
+		// an explicitly fully qualified name
+		return strings.TrimSuffix(hostName, "."), nil
+	}
+	maxDots := 1
+	if maxDotsStr := strings.Trim(e.first("canonicalizemaxdots"), `"`); maxDotsStr != "" {
+		var err error
+		maxDots, err = strconv.Atoi(maxDotsStr)
+		if err != nil || maxDots < 0 {
+			return "", fmt.Errorf("ssh config: invalid CanonicalizeMaxDots %q", maxDotsStr)
+		}
+	}
+	if strings.Count(hostName, ".") > maxDots {
+		return "", nil
+	}
+	for _, domain := range strings.Fields(strings.Join(e.values["canonicaldomains"], " ")) {
+		fullHost := hostName + "." + strings.Trim(strings.Trim(domain, `"`), ".")
+		ctx, cancelFn := context.WithTimeout(context.Background(), SshCanonicalizeLookupTimeout)
+		// the trailing dot keeps the resolver from applying its own search domains
+		addrs, err := lookupHost(ctx, fullHost+".")
+		cancelFn()
+		if err == nil && len(addrs) > 0 {
+			return fullHost, nil
+		}
+	}
+	if strings.ToLower(strings.Trim(e.first("canonicalizefallbacklocal"), `"`)) == "no" {
+		return "", fmt.Errorf("could not resolve host %q with CanonicalDomains (CanonicalizeFallbackLocal is no)", hostName)
+	}
+	return "", nil
+}
+
+func (e *sshConfigEval) evalMatch(args []string) (bool, error) {
+	if len(args) == 0 {
+		return false, fmt.Errorf("Match needs criteria")
+	}
+	matched := true
+	for idx := 0; idx < len(args); idx++ {
+		criteria := strings.ToLower(args[idx])
+		negate := strings.HasPrefix(criteria, "!")
+		criteria = strings.TrimPrefix(criteria, "!")
+		var result bool
+		switch criteria {
+		case "all":
+			result = true
+		case "canonical":
+			result = e.final
+		case "final":
+			e.sawFinal = true
+			result = e.final
+		case "host", "originalhost", "user", "localuser", "localnetwork", "tagged", "exec":
+			if idx+1 >= len(args) {
+				return false, fmt.Errorf("Match %s needs an argument", criteria)
+			}
+			idx++
+			arg := args[idx]
+			switch criteria {
+			case "host":
+				result = matchSshPatternList(strings.ToLower(arg), strings.ToLower(e.hostName()))
+			case "originalhost":
+				result = matchSshPatternList(strings.ToLower(arg), strings.ToLower(e.alias))
+			case "user":
+				result = matchSshPatternList(arg, e.remoteUser())
+			case "localuser":
+				result = matchSshPatternList(arg, e.localUser)
+			case "localnetwork":
+				result = matchLocalNetwork(arg)
+			case "tagged":
+				result = matchSshPatternList(arg, strings.Trim(e.first("tag"), `"`))
+			case "exec":
+				if !matched {
+					// like ssh, commands aren't run once the Match can't succeed
+					continue
+				}
+				result = e.runMatchExec(arg)
+			}
+		default:
+			return false, fmt.Errorf("unsupported Match criteria %q", args[idx])
+		}
+		if result == negate {
+			matched = false
+		}
+	}
+	return matched, nil
+}
+
+// expands the tokens ssh allows in Match exec
+func (e *sshConfigEval) expandTokens(cmd string) string {
+	port := strings.Trim(e.first("port"), `"`)
+	if port == "" {
+		port = "22"
+	}
+	return makeSshTokenReplacer(e.hostName(), e.alias, port, e.remoteUser(), e.localUser).Replace(cmd)
+}
+
+// the % tokens ssh expands in commands (Match exec, LocalCommand), %C is a hash of %l%h%p%r
+func makeSshTokenReplacer(hostName string, alias string, port string, remoteUser string, localUser string) *strings.Replacer {
+	localHost, _ := os.Hostname()
+	shortLocalHost, _, _ := strings.Cut(localHost, ".")
+	connHash := sha1.Sum([]byte(localHost + hostName + port + remoteUser))
+	return strings.NewReplacer(
+		"%%", "%",
+		"%h", hostName,
+		"%n", alias,
+		"%p", port,
+		"%r", remoteUser,
+		"%u", localUser,
+		"%l", localHost,
+		"%L", shortLocalHost,
+		"%d", wavebase.GetHomeDir(),
+		"%C", hex.EncodeToString(connHash[:]),
+	)
+}
+
+func (e *sshConfigEval) runMatchExec(cmdStr string) bool {
+	ctx, cancelFn := context.WithTimeout(context.Background(), SshMatchExecTimeout)
+	defer cancelFn()
+	cmd := exec.CommandContext(ctx, shellutil.DetectLocalShellPath(), "-c", e.expandTokens(cmdStr))
+	return cmd.Run() == nil
+}
+
+func matchSshHostPatterns(patterns []string, alias string) bool {
+	found := false
+	for _, pattern := range patterns {
+		negate := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		if matchSshPattern(strings.ToLower(pattern), strings.ToLower(alias)) {
+			if negate {
+				return false
+			}
+			found = true
+		}
+	}
+	return found
+}
+
+// a comma separated list of patterns, any negated pattern that matches fails the match
+func matchSshPatternList(list string, val string) bool {
+	return matchSshHostPatterns(strings.Split(list, ","), val)
+}
+
+// "*" matches any run of characters, "?" matches one
+func matchSshPattern(pattern string, val string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if pattern == "" {
+				return true
+			}
+			for idx := 0; idx <= len(val); idx++ {
+				if matchSshPattern(pattern, val[idx:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if val == "" {
+				return false
+			}
+		default:
+			if val == "" || val[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern = pattern[1:]
+		val = val[1:]
+	}
+	return val == ""
+}
+
+// true if an address of a local interface is in one of the comma separated CIDR ranges
+func matchLocalNetwork(list string) bool {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	found := false
+	for _, cidr := range strings.Split(list, ",") {
+		negate := strings.HasPrefix(cidr, "!")
+		_, ipNet, err := net.ParseCIDR(strings.TrimPrefix(cidr, "!"))
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ip, _, err := net.ParseCIDR(addr.String())
+			if err != nil || !ipNet.Contains(ip) {
+				continue
+			}
+			if negate {
+				return false
+			}
+			found = true
+		}
+	}
+	return found
+}
@@ -0,0 +1,178 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSshConfigMatch(t *testing.T) {
+	dir := t.TempDir()
+	localUser, err := userCurrent()
+	if err != nil {
+		t.Skipf("no local user: %v", err)
+	}
+	includePath := filepath.Join(dir, "extra.conf")
+	err = os.WriteFile(includePath, []byte("Host inc\n  Port 2200\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := `
+Include extra.conf
+Host web
+  HostName web.internal.example.com
+Match host *.internal.example.com user deploy
+  IdentityFile ~/.ssh/deploy_key
+Match host *.internal.example.com
+  ProxyJump bastion
+Match originalhost web localuser ` + localUser + `
+  Port 2022
+Match exec "test %n = db"
+  User dbadmin
+Match exec "false"
+  BatchMode yes
+Match !originalhost web,db
+  Port = 2222 # comment
+Match final host web.internal.example.com
+  ControlPersist 10m
+Host *
+  User nobody
+  IdentityFile ~/.ssh/id_default
+`
+	configPath := filepath.Join(dir, "config")
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	settings := MakeSshConfigSettings(configPath, "")
+
+	web, err := settings.Resolve("web", "deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := web.Get("HostName"); got != "web.internal.example.com" {
+		t.Errorf("web HostName: got %q", got)
+	}
+	if got := web.Get("ProxyJump"); got != "bastion" {
+		t.Errorf("web ProxyJump: got %q", got)
+	}
+	if got := web.Get("Port"); got != "2022" {
+		t.Errorf("web Port: got %q", got)
+	}
+	if got := web.Get("ControlPersist"); got != "10m" {
+		t.Errorf("web ControlPersist: got %q", got)
+	}
+	if got := web.Get("BatchMode"); got != "no" {
+		t.Errorf("web BatchMode: got %q, expected the default", got)
+	}
+	if got, expected := web.GetAll("IdentityFile"), []string{"~/.ssh/deploy_key", "~/.ssh/id_default"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("web IdentityFile: got %v, expected %v", got, expected)
+	}
+
+	webOther, err := settings.Resolve("web", "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, expected := webOther.GetAll("IdentityFile"), []string{"~/.ssh/id_default"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("web (other user) IdentityFile: got %v, expected %v", got, expected)
+	}
+
+	db, err := settings.Resolve("db", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := db.Get("User"); got != "dbadmin" {
+		t.Errorf("db User: got %q", got)
+	}
+	if got := db.Get("Port"); got != "22" {
+		t.Errorf("db Port: got %q, expected the default", got)
+	}
+
+	inc, err := settings.Resolve("inc", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := inc.Get("Port"); got != "2200" {
+		t.Errorf("inc Port: got %q", got)
+	}
+	other, err := settings.Resolve("other", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := other.Get("Port"); got != "2222" {
+		t.Errorf("other Port: got %q", got)
+	}
+	if got := other.Get("User"); got != "nobody" {
+		t.Errorf("other User: got %q", got)
+	}
+	if got, expected := other.GetAll("ProxyJump"), []string(nil); !reflect.DeepEqual(got, expected) {
+		t.Errorf("other ProxyJump: got %v", got)
+	}
+}
+
+func TestSshConfigCanonicalize(t *testing.T) {
+	config := `
+CanonicalizeHostname yes
+CanonicalDomains example.com example.org
+Host jumped
+  ProxyJump bastion
+Host strict
+  CanonicalizeFallbackLocal no
+Match canonical host *.example.org
+  Port 2200
+Host app.example.org
+  User appuser
+`
+	configPath := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	settings := MakeSshConfigSettings(configPath, "")
+	var lookups []string
+	settings.lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		lookups = append(lookups, host)
+		if host == "app.example.org." {
+			return []string{"192.0.2.1"}, nil
+		}
+		return nil, fmt.Errorf("no such host")
+	}
+
+	app, err := settings.Resolve("app", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := app.Get("HostName"); got != "app.example.org" {
+		t.Errorf("app HostName: got %q", got)
+	}
+	if app.Get("Port") != "2200" || app.Get("User") != "appuser" {
+		t.Errorf("app: the final pass did not match the canonical name (Port %q, User %q)", app.Get("Port"), app.Get("User"))
+	}
+	if expected := []string{"app.example.com.", "app.example.org."}; !reflect.DeepEqual(lookups, expected) {
+		t.Errorf("lookups: got %v, expected %v", lookups, expected)
+	}
+
+	lookups = nil
+	for _, alias := range []string{"jumped", "a.b.c", "192.0.2.7"} {
+		result, err := settings.Resolve(alias, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := result.Get("HostName"); got != "" {
+			t.Errorf("%s HostName: got %q, expected it to be left alone", alias, got)
+		}
+	}
+	if len(lookups) != 0 {
+		t.Errorf("unexpected lookups %v", lookups)
+	}
+	if result, _ := settings.Resolve("fqdn.", ""); result == nil || result.Get("HostName") != "fqdn" {
+		t.Errorf("a trailing dot should make the name canonical")
+	}
+	if _, err := settings.Resolve("strict", ""); err == nil {
+		t.Errorf("expected an error for an unresolvable host with CanonicalizeFallbackLocal no")
+	}
+}
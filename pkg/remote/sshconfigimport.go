@@ -0,0 +1,173 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+)
+
+// imports the hosts of an ssh config file (~/.ssh/config by default, Includes are followed).  every
+// alias on a Host line without wildcards is a session, its keywords are collected like ssh does for
+// it (Host blocks with wildcards apply too) except that Match blocks are ignored.  ProxyJump hosts
+// that are aliases of the same file are saved as their connection names.
+
+const sshConfigImportDefaultPath = "~/.ssh/config"
+
+// keywords that collect every value (for the others the first value wins)
+var sshConfigImportMultiKeys = []string{"identityfile", "certificatefile", "localforward", "remoteforward", "dynamicforward"}
+
+func isConcreteSshHostPattern(pattern string) bool {
+	return pattern != "" && !strings.ContainsAny(pattern, "*?!")
+}
+
+func collectSshConfigAliases(file *sshConfigFile, aliases []string) []string {
+	for _, line := range file.lines {
+		switch line.key {
+		case "host":
+			for _, pattern := range line.args {
+				if isConcreteSshHostPattern(pattern) && !slices.Contains(aliases, pattern) {
+					aliases = append(aliases, pattern)
+				}
+			}
+		case "include":
+			for _, included := range line.included {
+				aliases = collectSshConfigAliases(included, aliases)
+			}
+		}
+	}
+	return aliases
+}
+
+func collectSshConfigHostValues(file *sshConfigFile, alias string, values map[string][]string) {
+	active := true
+	for _, line := range file.lines {
+		switch line.key {
+		case "host":
+			active = matchSshHostPatterns(line.args, alias)
+		case "match":
+			active = false
+		case "include":
+			if !active {
+				continue
+			}
+			for _, included := range line.included {
+				collectSshConfigHostValues(included, alias, values)
+			}
+		default:
+			if !active {
+				continue
+			}
+			val := strings.Join(line.args, " ")
+			if len(values[line.key]) == 0 || (slices.Contains(sshConfigImportMultiKeys, line.key) && !slices.Contains(values[line.key], val)) {
+				values[line.key] = append(values[line.key], val)
+			}
+		}
+	}
+}
+
+func firstSshConfigValue(values map[string][]string, key string) string {
+	if vals := values[key]; len(vals) > 0 {
+		return vals[0]
+	}
+	return ""
+}
+
+func sshConfigAliasConnName(alias string, values map[string][]string) (string, error) {
+	hostName := firstSshConfigValue(values, "hostname")
+	if hostName == "" {
+		hostName = alias
+	}
+	hostName = strings.ReplaceAll(hostName, "%h", alias)
+	port := 22
+	if portStr := firstSshConfigValue(values, "port"); portStr != "" {
+		var err error
+		port, err = strconv.Atoi(portStr)
+		if err != nil {
+			return "", fmt.Errorf("invalid port %q", portStr)
+		}
+	}
+	return makeImportConnName(firstSshConfigValue(values, "user"), hostName, port)
+}
+
+func convertSshConfigHosts(file *sshConfigFile) []*importedConn {
+	aliases := collectSshConfigAliases(file, nil)
+	aliasValues := make(map[string]map[string][]string)
+	aliasConns := make(map[string]string)
+	for _, alias := range aliases {
+		values := make(map[string][]string)
+		collectSshConfigHostValues(file, alias, values)
+		aliasValues[alias] = values
+		if connName, err := sshConfigAliasConnName(alias, values); err == nil {
+			aliasConns[alias] = connName
+		}
+	}
+	var rtn []*importedConn
+	for _, alias := range aliases {
+		values := aliasValues[alias]
+		conn := &importedConn{Session: alias}
+		rtn = append(rtn, conn)
+		conn.ConnName, conn.Err = sshConfigAliasConnName(alias, values)
+		if conn.Err != nil {
+			continue
+		}
+		conn.Meta = make(waveobj.MetaMapType)
+		var identityFiles []string
+		for _, identityFile := range values["identityfile"] {
+			if !strings.EqualFold(identityFile, "none") {
+				identityFiles = append(identityFiles, identityFile)
+			}
+		}
+		setImportListValue(conn.Meta, "ssh:identityfile", identityFiles)
+		setImportListValue(conn.Meta, "ssh:certificatefile", values["certificatefile"])
+		if proxyJump := firstSshConfigValue(values, "proxyjump"); proxyJump != "" && !strings.EqualFold(proxyJump, "none") {
+			var jumps []string
+			for _, jump := range strings.Split(proxyJump, ",") {
+				jump = strings.TrimSpace(jump)
+				if jumpConn, ok := aliasConns[jump]; ok {
+					jump = jumpConn
+				}
+				jumps = append(jumps, jump)
+			}
+			setImportListValue(conn.Meta, "ssh:proxyjump", jumps)
+		}
+		if proxyCommand := firstSshConfigValue(values, "proxycommand"); proxyCommand != "" && !strings.EqualFold(proxyCommand, "none") {
+			conn.Warnings = append(conn.Warnings, fmt.Sprintf("ProxyCommand %q is not supported, not imported", proxyCommand))
+		}
+		setImportListValue(conn.Meta, "ssh:localforward", values["localforward"])
+		setImportListValue(conn.Meta, "ssh:remoteforward", values["remoteforward"])
+		setImportListValue(conn.Meta, "ssh:dynamicforward", values["dynamicforward"])
+		if strings.EqualFold(firstSshConfigValue(values, "forwardx11"), "yes") {
+			conn.Meta["ssh:forwardx11"] = true
+		}
+	}
+	return rtn
+}
+
+type sshConfigImporter struct{}
+
+func (sshConfigImporter) ReadConns(path string) ([]*importedConn, error) {
+	if path == "" {
+		path = sshConfigImportDefaultPath
+	}
+	path, err := wavebase.ExpandHomeDir(path)
+	if err != nil {
+		return nil, err
+	}
+	// like ssh, relative Include paths of a user config are in ~/.ssh
+	includeDir, err := wavebase.ExpandHomeDir("~/.ssh")
+	if err != nil {
+		return nil, err
+	}
+	file, err := parseSshConfigFile(path, includeDir, 0)
+	if err != nil {
+		return nil, err
+	}
+	return convertSshConfigHosts(file), nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+)
+
+// the environment sent with each session (like ssh, the server only accepts the variables its
+// AcceptEnv allows).  SendEnv patterns (from the ssh config files, then ssh:sendenv) pick local
+// variables, and SetEnv (ssh:setenv, then the ssh config files) sets variables directly.
+func GetSshSessionEnv(connName string, hostPattern string, userName string) map[string]string {
+	var sendEnv, setEnv []string
+	if connSettings, ok := wconfig.ReadFullConfig().Connections[connName]; ok {
+		sendEnv = append(sendEnv, connSettings.SshSendEnv...)
+		setEnv = append(setEnv, connSettings.SshSetEnv...)
+	}
+	sshConfig, err := WaveSshConfigUserSettings().Resolve(hostPattern, userName)
+	if err != nil {
+		log.Printf("unable to read ssh config for the environment of %s: %v", connName, err)
+		return makeSessionEnv(sendEnv, setEnv, os.Environ())
+	}
+	configSendEnv := splitSshConfigValues(sshConfig.GetAll("SendEnv"))
+	configSetEnv := splitSshConfigValues(sshConfig.GetAll("SetEnv"))
+	return makeSessionEnv(append(configSendEnv, sendEnv...), append(setEnv, configSetEnv...), os.Environ())
+}
+
+// each value can have several (quoted) arguments
+func splitSshConfigValues(vals []string) []string {
+	var rtn []string
+	for _, val := range vals {
+		args, _, err := splitSshConfigArgs(val)
+		if err != nil {
+			continue
+		}
+		rtn = append(rtn, args...)
+	}
+	return rtn
+}
+
+// a "-pattern" in sendEnv removes the patterns before it that it matches (like ssh).  the first
+// SetEnv value for a name wins, and SetEnv overrides a variable picked by SendEnv.
+func makeSessionEnv(sendEnv []string, setEnv []string, environ []string) map[string]string {
+	var patterns []string
+	for _, pattern := range sendEnv {
+		if removePattern, ok := strings.CutPrefix(pattern, "-"); ok {
+			patterns = slices.DeleteFunc(patterns, func(existing string) bool {
+				return matchSshPattern(removePattern, existing)
+			})
+			continue
+		}
+		patterns = append(patterns, pattern)
+	}
+	rtn := make(map[string]string)
+	for _, envStr := range environ {
+		name, val, ok := strings.Cut(envStr, "=")
+		if !ok || name == "" {
+			continue
+		}
+		if slices.ContainsFunc(patterns, func(pattern string) bool { return matchSshPattern(pattern, name) }) {
+			rtn[name] = val
+		}
+	}
+	setNames := make(map[string]bool)
+	for _, setStr := range setEnv {
+		name, val, ok := strings.Cut(setStr, "=")
+		if !ok || name == "" || setNames[name] {
+			continue
+		}
+		setNames[name] = true
+		rtn[name] = val
+	}
+	return rtn
+}
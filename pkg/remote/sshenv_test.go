@@ -0,0 +1,30 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMakeSessionEnv(t *testing.T) {
+	environ := []string{"LANG=en_US.UTF-8", "LC_ALL=C", "LC_TIME=de_DE", "TERM_PROGRAM=waveterm", "SECRET=x", "MY_VAR=1"}
+	sendEnv := splitSshConfigValues([]string{"LANG LC_*", "TERM_PROGRAM", "-LC_ALL", "MY_VAR"})
+	setEnv := splitSshConfigValues([]string{`MY_VAR=override "GREETING=hello world"`, "MY_VAR=ignored"})
+	expected := map[string]string{
+		"LANG":         "en_US.UTF-8",
+		"LC_TIME":      "de_DE",
+		"TERM_PROGRAM": "waveterm",
+		"MY_VAR":       "override",
+		"GREETING":     "hello world",
+	}
+	// "-LC_ALL" only removes a pattern it matches, so LC_* still sends LC_ALL
+	expected["LC_ALL"] = "C"
+	if got := makeSessionEnv(sendEnv, setEnv, environ); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, expected %v", got, expected)
+	}
+	if got := makeSessionEnv([]string{"LC_*", "-LC_*"}, nil, environ); len(got) != 0 {
+		t.Errorf("removed patterns still sent %v", got)
+	}
+}
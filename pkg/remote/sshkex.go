@@ -0,0 +1,227 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+)
+
+// the ssh library doesn't say which algorithms a connection negotiated, so they are worked out
+// from the first key exchange: both KEXINIT messages are sent before anything is encrypted,
+// so they are read off the network connection (see statsConn) and negotiated the same way the
+// library does (the first of the client's algorithms that the server has).  later key
+// exchanges are encrypted, but they use the same lists.
+
+// post-quantum hybrid key exchanges.  golang.org/x/crypto/ssh doesn't have any of them yet, so
+// they are never negotiated, but servers that offer them are reported.
+var postQuantumSshKexAlgorithms = []string{
+	"mlkem768x25519-sha256",
+	"sntrup761x25519-sha512",
+	"sntrup761x25519-sha512@openssh.com",
+}
+
+const (
+	sshMsgKexInit    = 20
+	maxKexInitSniff  = 64 * 1024
+	sshAeadMacMarker = "<implicit>"
+)
+
+func isPostQuantumKex(algo string) bool {
+	return slices.Contains(postQuantumSshKexAlgorithms, algo)
+}
+
+// the algorithm name-lists of a KEXINIT message (compression and languages aren't needed)
+type sshKexInit struct {
+	KexAlgos     []string
+	HostKeyAlgos []string
+	CiphersC2S   []string
+	CiphersS2C   []string
+	MACsC2S      []string
+	MACsS2C      []string
+}
+
+// the algorithms negotiated for a connection ("send" is from this side to the server)
+type sshNegotiatedAlgorithms struct {
+	Kex         string
+	HostKey     string
+	CipherSend  string
+	CipherRecv  string
+	MACSend     string
+	MACRecv     string
+	ServerPqKex []string // the post-quantum key exchanges the server offered
+}
+
+func parseSshNameList(data []byte) ([]string, []byte, error) {
+	if len(data) < 4 {
+		return nil, nil, fmt.Errorf("short name-list")
+	}
+	size := binary.BigEndian.Uint32(data)
+	data = data[4:]
+	if uint32(len(data)) < size {
+		return nil, nil, fmt.Errorf("short name-list")
+	}
+	if size == 0 {
+		return nil, data, nil
+	}
+	return strings.Split(string(data[:size]), ","), data[size:], nil
+}
+
+// parses a KEXINIT payload (starting with the message number)
+func parseSshKexInit(payload []byte) (*sshKexInit, error) {
+	if len(payload) < 17 || payload[0] != sshMsgKexInit {
+		return nil, fmt.Errorf("not a KEXINIT message")
+	}
+	rest := payload[17:] // the message number and cookie
+	rtn := &sshKexInit{}
+	lists := []*[]string{&rtn.KexAlgos, &rtn.HostKeyAlgos, &rtn.CiphersC2S, &rtn.CiphersS2C, &rtn.MACsC2S, &rtn.MACsS2C}
+	for _, list := range lists {
+		var err error
+		if *list, rest, err = parseSshNameList(rest); err != nil {
+			return nil, err
+		}
+	}
+	return rtn, nil
+}
+
+func firstCommonAlgorithm(client []string, server []string) string {
+	for _, algo := range client {
+		if slices.Contains(server, algo) {
+			return algo
+		}
+	}
+	return ""
+}
+
+func isAeadCipher(cipher string) bool {
+	return strings.HasSuffix(cipher, "-gcm@openssh.com") || cipher == "chacha20-poly1305@openssh.com"
+}
+
+func negotiateSshAlgorithms(client *sshKexInit, server *sshKexInit) *sshNegotiatedAlgorithms {
+	rtn := &sshNegotiatedAlgorithms{
+		Kex:        firstCommonAlgorithm(client.KexAlgos, server.KexAlgos),
+		HostKey:    firstCommonAlgorithm(client.HostKeyAlgos, server.HostKeyAlgos),
+		CipherSend: firstCommonAlgorithm(client.CiphersC2S, server.CiphersC2S),
+		CipherRecv: firstCommonAlgorithm(client.CiphersS2C, server.CiphersS2C),
+		MACSend:    firstCommonAlgorithm(client.MACsC2S, server.MACsC2S),
+		MACRecv:    firstCommonAlgorithm(client.MACsS2C, server.MACsS2C),
+	}
+	// aead ciphers have their own integrity check, the negotiated mac isn't used
+	if isAeadCipher(rtn.CipherSend) {
+		rtn.MACSend = sshAeadMacMarker
+	}
+	if isAeadCipher(rtn.CipherRecv) {
+		rtn.MACRecv = sshAeadMacMarker
+	}
+	for _, algo := range server.KexAlgos {
+		if isPostQuantumKex(algo) {
+			rtn.ServerPqKex = append(rtn.ServerPqKex, algo)
+		}
+	}
+	return rtn
+}
+
+// reads the version line and the first packet (the KEXINIT) from one direction of a connection
+type kexInitSniffer struct {
+	buf        []byte
+	sawVersion bool
+	done       bool
+	kexInit    *sshKexInit
+}
+
+func (s *kexInitSniffer) add(data []byte) {
+	if s.done {
+		return
+	}
+	s.buf = append(s.buf, data...)
+	if !s.sawVersion {
+		// the server can send other lines before its version
+		for {
+			idx := bytes.IndexByte(s.buf, '\n')
+			if idx < 0 {
+				break
+			}
+			line := s.buf[:idx]
+			s.buf = s.buf[idx+1:]
+			if bytes.HasPrefix(line, []byte("SSH-")) {
+				s.sawVersion = true
+				break
+			}
+		}
+	}
+	if s.sawVersion && len(s.buf) >= 5 {
+		packetLen := binary.BigEndian.Uint32(s.buf)
+		paddingLen := uint32(s.buf[4])
+		if packetLen > maxKexInitSniff || paddingLen+1 > packetLen {
+			s.finish(nil)
+			return
+		}
+		if uint32(len(s.buf)) >= 4+packetLen {
+			kexInit, _ := parseSshKexInit(s.buf[5 : 4+packetLen-paddingLen])
+			s.finish(kexInit)
+			return
+		}
+	}
+	if len(s.buf) > maxKexInitSniff {
+		s.finish(nil)
+	}
+}
+
+func (s *kexInitSniffer) finish(kexInit *sshKexInit) {
+	s.done = true
+	s.kexInit = kexInit
+	s.buf = nil
+}
+
+// the KEXINIT messages sent and received on a connection
+type kexSniffer struct {
+	finished   *atomic.Bool // both directions are done, so nothing more is buffered
+	lock       *sync.Mutex
+	sent       *kexInitSniffer
+	recv       *kexInitSniffer
+	negotiated *sshNegotiatedAlgorithms
+}
+
+func makeKexSniffer() *kexSniffer {
+	return &kexSniffer{finished: &atomic.Bool{}, lock: &sync.Mutex{}, sent: &kexInitSniffer{}, recv: &kexInitSniffer{}}
+}
+
+func (k *kexSniffer) add(sniffer *kexInitSniffer, data []byte) {
+	if k.finished.Load() {
+		return
+	}
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if sniffer.done {
+		return
+	}
+	sniffer.add(data)
+	if k.sent.kexInit != nil && k.recv.kexInit != nil {
+		k.negotiated = negotiateSshAlgorithms(k.sent.kexInit, k.recv.kexInit)
+	}
+	if k.sent.done && k.recv.done {
+		k.finished.Store(true)
+	}
+}
+
+func (k *kexSniffer) addSent(data []byte) {
+	k.add(k.sent, data)
+}
+
+func (k *kexSniffer) addRecv(data []byte) {
+	k.add(k.recv, data)
+}
+
+// the negotiated algorithms (nil if the key exchange wasn't seen)
+func (k *kexSniffer) getNegotiated() *sshNegotiatedAlgorithms {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	return k.negotiated
+}
@@ -0,0 +1,119 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"slices"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestNegotiatedAlgorithms(t *testing.T) {
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true}
+	serverConfig.AddHostKey(hostSigner)
+	serverConfig.KeyExchanges = []string{"curve25519-sha256", "ecdh-sha2-nistp256"}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		sconn, chans, reqs, err := ssh.NewServerConn(conn, serverConfig)
+		if err != nil {
+			return
+		}
+		go ssh.DiscardRequests(reqs)
+		go func() {
+			for ch := range chans {
+				ch.Reject(ssh.Prohibited, "")
+			}
+		}()
+		sconn.Wait()
+	}()
+
+	clientConn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := makeClientStats()
+	clientConfig := &ssh.ClientConfig{
+		User:            "user",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Config: ssh.Config{
+			KeyExchanges: []string{"ecdh-sha2-nistp256", "curve25519-sha256"},
+			Ciphers:      []string{"aes256-ctr", "aes128-gcm@openssh.com"},
+			MACs:         []string{"hmac-sha2-512"},
+		},
+	}
+	c, _, _, err := ssh.NewClientConn(&statsConn{Conn: clientConn, stats: stats}, listener.Addr().String(), clientConfig)
+	if err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+	defer c.Close()
+	info := stats.GetInfo("user@host")
+	if info.KexAlgorithm != "ecdh-sha2-nistp256" || info.HostKeyAlgorithm != ssh.KeyAlgoED25519 {
+		t.Errorf("got kex %q, host key %q", info.KexAlgorithm, info.HostKeyAlgorithm)
+	}
+	if info.CipherSend != "aes256-ctr" || info.CipherRecv != "aes256-ctr" || info.MACSend != "hmac-sha2-512" || info.MACRecv != "hmac-sha2-512" {
+		t.Errorf("got cipher %s/%s, mac %s/%s", info.CipherSend, info.CipherRecv, info.MACSend, info.MACRecv)
+	}
+	if info.PostQuantumKex || len(info.ServerPostQuantumKex) > 0 {
+		t.Errorf("got post-quantum %v, server offers %v", info.PostQuantumKex, info.ServerPostQuantumKex)
+	}
+}
+
+func makeTestKexInitPacket(lists ...string) []byte {
+	payload := append([]byte{sshMsgKexInit}, make([]byte, 16)...)
+	for _, list := range lists {
+		payload = binary.BigEndian.AppendUint32(payload, uint32(len(list)))
+		payload = append(payload, list...)
+	}
+	padding := 8 - (len(payload)+5)%8 + 4
+	packet := binary.BigEndian.AppendUint32(nil, uint32(1+len(payload)+padding))
+	packet = append(packet, byte(padding))
+	packet = append(packet, payload...)
+	return append(packet, make([]byte, padding)...)
+}
+
+func TestKexSniffer(t *testing.T) {
+	sniffer := makeKexSniffer()
+	sent := append([]byte("SSH-2.0-Go\r\n"), makeTestKexInitPacket("curve25519-sha256,ext-info-c", "ssh-ed25519", "chacha20-poly1305@openssh.com", "chacha20-poly1305@openssh.com", "hmac-sha2-256", "hmac-sha2-256")...)
+	recv := append([]byte("notice\r\nSSH-2.0-OpenSSH_9.9\r\n"), makeTestKexInitPacket("sntrup761x25519-sha512@openssh.com,curve25519-sha256", "rsa-sha2-512,ssh-ed25519", "aes128-ctr,chacha20-poly1305@openssh.com", "chacha20-poly1305@openssh.com", "hmac-sha2-256", "hmac-sha2-256")...)
+	// the data arrives in pieces
+	for idx := range recv {
+		sniffer.addRecv(recv[idx : idx+1])
+	}
+	sniffer.addSent(sent)
+	algos := sniffer.getNegotiated()
+	if algos == nil {
+		t.Fatalf("no algorithms negotiated")
+	}
+	if algos.Kex != "curve25519-sha256" || algos.HostKey != "ssh-ed25519" || algos.CipherSend != "chacha20-poly1305@openssh.com" || algos.MACSend != sshAeadMacMarker {
+		t.Errorf("got %+v", *algos)
+	}
+	if !slices.Equal(algos.ServerPqKex, []string{"sntrup761x25519-sha512@openssh.com"}) {
+		t.Errorf("server post-quantum kex is %v", algos.ServerPqKex)
+	}
+	if !sniffer.finished.Load() {
+		t.Errorf("sniffer should be finished")
+	}
+}
@@ -0,0 +1,274 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"golang.org/x/crypto/ssh"
+)
+
+// a pool of shared ssh clients (like an openssh ControlMaster).  every client made by
+// ConnectToClient is put in the pool, keyed by its SSHOpts, the jump host it was dialed through,
+// and the connect options that change how it was authenticated (see getPoolKeyScope), and is reused for later connects to the same host while it is alive.  clients are
+// reference counted: each ConnectToClient returns a new reference, which must be given back with
+// ReleaseClient.  a client dialed through a jump host holds a reference to the jump host until it
+// is closed.
+//
+// when the last reference is released the client is closed after its ControlPersist time
+// ("no" closes it right away, "yes" or 0 keeps it open until the connection drops).
+
+const ControlPersistForever = time.Duration(-1)
+
+type pooledClient struct {
+	key       string
+	client    *ssh.Client
+	parent    *ssh.Client // the jump host this client was dialed through (if any)
+	refCount  int
+	persist   time.Duration
+	idleTimer *time.Timer
+	closing   bool
+	done      chan struct{}
+	err       error // set when done is closed
+}
+
+var clientPoolLock = &sync.Mutex{}
+var clientPoolByKey = make(map[string]*pooledClient)
+var clientPoolByClient = make(map[*ssh.Client]*pooledClient)
+
+// the options of a connect that change the user, the keys, or the host key policy.  a client is
+// only shared by connects with the same scope, so (for example) a client made by a headless
+// connect with StrictHostKeyChecking=no never serves a normal connect.
+func getPoolKeyScope(connCtx context.Context, connFlags *wshrpc.ConnKeywords) string {
+	var parts []string
+	if connFlags != nil {
+		if connFlags.SshUser != "" {
+			parts = append(parts, "user="+connFlags.SshUser)
+		}
+		if len(connFlags.SshIdentityFile) > 0 {
+			parts = append(parts, "identityfile="+strings.Join(connFlags.SshIdentityFile, ","))
+		}
+		if connFlags.SshStrictHostKeyChecking != "" {
+			parts = append(parts, "stricthostkeychecking="+connFlags.SshStrictHostKeyChecking)
+		}
+	}
+	if headless := getHeadlessOpts(connCtx); headless != nil {
+		parts = append(parts, "headless")
+		if headless.StrictHostKeyChecking != "" {
+			parts = append(parts, "stricthostkeychecking="+headless.StrictHostKeyChecking)
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " [" + strings.Join(parts, " ") + "]"
+}
+
+func getClientPoolKey(connCtx context.Context, opts *SSHOpts, currentClient *ssh.Client, connFlags *wshrpc.ConnKeywords) string {
+	key := opts.String() + getPoolKeyScope(connCtx, connFlags)
+	if currentClient == nil {
+		return key
+	}
+	clientPoolLock.Lock()
+	defer clientPoolLock.Unlock()
+	parent := clientPoolByClient[currentClient]
+	if parent == nil {
+		return fmt.Sprintf("%s via %p", key, currentClient)
+	}
+	return fmt.Sprintf("%s via %s", key, parent.key)
+}
+
+// returns a new reference to a live pooled client (or nil)
+func acquirePooledClient(key string) *ssh.Client {
+	clientPoolLock.Lock()
+	defer clientPoolLock.Unlock()
+	pc := clientPoolByKey[key]
+	if pc == nil || pc.closing {
+		return nil
+	}
+	pc.refCount++
+	if pc.idleTimer != nil {
+		pc.idleTimer.Stop()
+		pc.idleTimer = nil
+	}
+	return pc.client
+}
+
+// adds a new client to the pool (with one reference)
+func addPooledClient(key string, client *ssh.Client, parent *ssh.Client, persist time.Duration) {
+	pc := &pooledClient{
+		key:      key,
+		client:   client,
+		parent:   parent,
+		refCount: 1,
+		persist:  persist,
+		done:     make(chan struct{}),
+	}
+	clientPoolLock.Lock()
+	if old := clientPoolByKey[key]; old != nil {
+		// the old client is still in use, but new connects get the new one
+		old.closing = true
+	}
+	clientPoolByKey[key] = pc
+	clientPoolByClient[client] = pc
+	clientPoolLock.Unlock()
+	go waitPooledClient(pc)
+}
+
+func waitPooledClient(pc *pooledClient) {
+	defer panichandler.PanicHandler("waitPooledClient")
+	err := pc.client.Wait()
+	clientPoolLock.Lock()
+	pc.err = err
+	pc.closing = true
+	if pc.idleTimer != nil {
+		pc.idleTimer.Stop()
+		pc.idleTimer = nil
+	}
+	if clientPoolByKey[pc.key] == pc {
+		delete(clientPoolByKey, pc.key)
+	}
+	delete(clientPoolByClient, pc.client)
+	close(pc.done)
+	clientPoolLock.Unlock()
+	if pc.parent != nil {
+		ReleaseClient(pc.parent)
+	}
+}
+
+// takes another reference to a pooled client (so it stays open while in use), returns false if
+// the client isn't pooled or is closing.  the reference is given back with ReleaseClient.
+func RetainClient(client *ssh.Client) bool {
+	clientPoolLock.Lock()
+	defer clientPoolLock.Unlock()
+	pc := clientPoolByClient[client]
+	if pc == nil || pc.closing {
+		return false
+	}
+	pc.refCount++
+	if pc.idleTimer != nil {
+		pc.idleTimer.Stop()
+		pc.idleTimer = nil
+	}
+	return true
+}
+
+// gives back a reference from ConnectToClient (or RetainClient).  clients that aren't pooled are closed.
+func ReleaseClient(client *ssh.Client) {
+	if client == nil {
+		return
+	}
+	clientPoolLock.Lock()
+	pc := clientPoolByClient[client]
+	if pc == nil {
+		clientPoolLock.Unlock()
+		client.Close()
+		return
+	}
+	if pc.refCount > 0 {
+		pc.refCount--
+	}
+	if pc.refCount > 0 || pc.persist == ControlPersistForever {
+		clientPoolLock.Unlock()
+		return
+	}
+	if pc.persist == 0 || pc.closing {
+		pc.closing = true
+		clientPoolLock.Unlock()
+		client.Close()
+		return
+	}
+	pc.idleTimer = time.AfterFunc(pc.persist, func() {
+		clientPoolLock.Lock()
+		if pc.refCount > 0 || pc.closing {
+			clientPoolLock.Unlock()
+			return
+		}
+		pc.closing = true
+		clientPoolLock.Unlock()
+		client.Close()
+	})
+	clientPoolLock.Unlock()
+}
+
+// blocks until the client's connection is closed (returns the error from ssh.Client.Wait), or
+// until stopCh is closed (returns nil)
+func WaitClient(client *ssh.Client, stopCh <-chan struct{}) error {
+	clientPoolLock.Lock()
+	pc := clientPoolByClient[client]
+	clientPoolLock.Unlock()
+	if pc == nil {
+		errCh := make(chan error, 1)
+		go func() {
+			defer panichandler.PanicHandler("WaitClient")
+			errCh <- client.Wait()
+		}()
+		select {
+		case err := <-errCh:
+			return err
+		case <-stopCh:
+			return nil
+		}
+	}
+	select {
+	case <-pc.done:
+		return pc.err
+	case <-stopCh:
+		return nil
+	}
+}
+
+// parses an openssh ControlPersist value: "yes" or "0" (forever), "no" or "" (close when unused),
+// a number of seconds, or a time like "10m" or "1h30m" (units are s, m, h, d, and w)
+func ParseControlPersist(val string) (time.Duration, error) {
+	val = strings.ToLower(strings.TrimSpace(val))
+	switch val {
+	case "", "no", "false":
+		return 0, nil
+	case "yes", "true", "0":
+		return ControlPersistForever, nil
+	}
+	if secs, err := strconv.Atoi(val); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second, nil
+	}
+	var rtn time.Duration
+	numStart := 0
+	for idx, ch := range val {
+		if ch >= '0' && ch <= '9' {
+			continue
+		}
+		num, err := strconv.Atoi(val[numStart:idx])
+		if err != nil {
+			return 0, fmt.Errorf("invalid ControlPersist %q", val)
+		}
+		var unit time.Duration
+		switch ch {
+		case 's':
+			unit = time.Second
+		case 'm':
+			unit = time.Minute
+		case 'h':
+			unit = time.Hour
+		case 'd':
+			unit = 24 * time.Hour
+		case 'w':
+			unit = 7 * 24 * time.Hour
+		default:
+			return 0, fmt.Errorf("invalid ControlPersist %q", val)
+		}
+		rtn += time.Duration(num) * unit
+		numStart = idx + 1
+	}
+	if numStart != len(val) || rtn <= 0 {
+		return 0, fmt.Errorf("invalid ControlPersist %q", val)
+	}
+	return rtn, nil
+}
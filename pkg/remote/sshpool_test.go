@@ -0,0 +1,111 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParseControlPersist(t *testing.T) {
+	tests := map[string]time.Duration{
+		"":      0,
+		"no":    0,
+		"yes":   ControlPersistForever,
+		"0":     ControlPersistForever,
+		"600":   10 * time.Minute,
+		"10m":   10 * time.Minute,
+		"1h30m": 90 * time.Minute,
+		"1d":    24 * time.Hour,
+		"1w2s":  7*24*time.Hour + 2*time.Second,
+	}
+	for val, expected := range tests {
+		persist, err := ParseControlPersist(val)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", val, err)
+		} else if persist != expected {
+			t.Errorf("%q: got %v, expected %v", val, persist, expected)
+		}
+	}
+	for _, bad := range []string{"m", "10x", "-5", "1h30"} {
+		if _, err := ParseControlPersist(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+// an ssh client connected to a loopback server without authentication
+func makeTestSshClient(t *testing.T) *ssh.Client {
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true}
+	serverConfig.AddHostKey(hostSigner)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		sconn, chans, reqs, err := ssh.NewServerConn(conn, serverConfig)
+		if err != nil {
+			return
+		}
+		go ssh.DiscardRequests(reqs)
+		go func() {
+			for ch := range chans {
+				ch.Reject(ssh.Prohibited, "")
+			}
+		}()
+		sconn.Wait()
+	}()
+	client, err := ssh.Dial("tcp", listener.Addr().String(), &ssh.ClientConfig{User: "user", HostKeyCallback: ssh.InsecureIgnoreHostKey()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestPoolKeyScope(t *testing.T) {
+	opts := &SSHOpts{SSHHost: "pooltest.example", SSHUser: "user"}
+	headlessCtx, err := WithHeadless(context.Background(), &wshrpc.ConnHeadlessOpts{StrictHostKeyChecking: StrictHostKeyChecking_No})
+	if err != nil {
+		t.Fatal(err)
+	}
+	headlessKey := getClientPoolKey(headlessCtx, opts, nil, &wshrpc.ConnKeywords{})
+	client := makeTestSshClient(t)
+	addPooledClient(headlessKey, client, nil, ControlPersistForever)
+	normalKey := getClientPoolKey(context.Background(), opts, nil, &wshrpc.ConnKeywords{})
+	if normalKey == headlessKey {
+		t.Fatalf("headless and normal connects have the same pool key %q", normalKey)
+	}
+	if pooled := acquirePooledClient(normalKey); pooled != nil {
+		t.Fatalf("a normal connect got the client of a headless StrictHostKeyChecking=no connect")
+	}
+	if pooled := acquirePooledClient(headlessKey); pooled != client {
+		t.Errorf("the same headless connect should reuse its client")
+	}
+	flagsKey := getClientPoolKey(context.Background(), opts, nil, &wshrpc.ConnKeywords{SshIdentityFile: []string{"~/.ssh/other"}})
+	if flagsKey == normalKey {
+		t.Errorf("a connect with other identity files has the same pool key %q", flagsKey)
+	}
+}
@@ -0,0 +1,369 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/remote/conndebug"
+	"github.com/wavetermdev/waveterm/pkg/userinput"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"golang.org/x/crypto/ssh"
+)
+
+// security key (FIDO2) identities, the "sk-ecdsa-sha2-nistp256@openssh.com" and
+// "sk-ssh-ed25519@openssh.com" key types.  x/crypto can't sign with these, the private key
+// file only has a handle for the key on the device.  keys in the agent are signed by the
+// agent, and keys from identity files are signed by openssh's ssh-sk-helper.  either way the
+// user usually has to touch the key, so a prompt is shown until the signature is done.
+
+const (
+	skHelperVersion  = 5
+	skHelperMsgError = 0
+	skHelperMsgSign  = 1
+	skLogLevelError  = 2
+
+	skFlagUserPresenceRequired     = 0x01
+	skFlagUserVerificationRequired = 0x04
+)
+
+var skHelperPaths = []string{
+	"/usr/libexec/ssh-sk-helper",
+	"/usr/libexec/openssh/ssh-sk-helper",
+	"/usr/lib/openssh/ssh-sk-helper",
+	"/usr/lib/ssh/ssh-sk-helper",
+	"/opt/homebrew/libexec/ssh-sk-helper",
+	"/usr/local/libexec/ssh-sk-helper",
+}
+
+var errNotSkKey = errors.New("not a security key")
+
+func isSecurityKeyType(keyType string) bool {
+	return strings.HasPrefix(keyType, "sk-")
+}
+
+type skPrivateKey struct {
+	pubKey ssh.PublicKey
+	flags  uint8
+	// the key as ssh-sk-helper wants it (sshkey_private_serialize)
+	keyBlob []byte
+}
+
+// parses an (unencrypted) openssh private key file with a security key.  returns errNotSkKey
+// for other keys.
+func parseSkPrivateKey(pemBytes []byte) (*skPrivateKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil || block.Type != "OPENSSH PRIVATE KEY" {
+		return nil, errNotSkKey
+	}
+	const magic = "openssh-key-v1\x00"
+	if !bytes.HasPrefix(block.Bytes, []byte(magic)) {
+		return nil, errNotSkKey
+	}
+	var outer struct {
+		CipherName   string
+		KdfName      string
+		KdfOpts      string
+		NumKeys      uint32
+		PubKey       []byte
+		PrivKeyBlock []byte
+	}
+	if err := ssh.Unmarshal(block.Bytes[len(magic):], &outer); err != nil {
+		return nil, err
+	}
+	pubKey, err := ssh.ParsePublicKey(outer.PubKey)
+	if err != nil {
+		if strings.Contains(err.Error(), "unknown key algorithm") {
+			return nil, errNotSkKey
+		}
+		return nil, err
+	}
+	if !isSecurityKeyType(pubKey.Type()) {
+		return nil, errNotSkKey
+	}
+	if outer.CipherName != "none" {
+		return nil, fmt.Errorf("encrypted security key files are not supported, add the key to your ssh agent with ssh-add")
+	}
+	var priv struct {
+		Check1  uint32
+		Check2  uint32
+		KeyType string
+		Rest    []byte `ssh:"rest"`
+	}
+	if err := ssh.Unmarshal(outer.PrivKeyBlock, &priv); err != nil {
+		return nil, err
+	}
+	if priv.Check1 != priv.Check2 {
+		return nil, fmt.Errorf("invalid private key (check bytes don't match)")
+	}
+	var flags uint8
+	var rest []byte
+	switch priv.KeyType {
+	case ssh.KeyAlgoSKED25519:
+		var key struct {
+			Pub         []byte
+			Application string
+			Flags       uint8
+			KeyHandle   []byte
+			Reserved    []byte
+			Rest        []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(priv.Rest, &key); err != nil {
+			return nil, err
+		}
+		flags, rest = key.Flags, key.Rest
+	case ssh.KeyAlgoSKECDSA256:
+		var key struct {
+			Curve       string
+			Pub         []byte
+			Application string
+			Flags       uint8
+			KeyHandle   []byte
+			Reserved    []byte
+			Rest        []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(priv.Rest, &key); err != nil {
+			return nil, err
+		}
+		flags, rest = key.Flags, key.Rest
+	default:
+		return nil, fmt.Errorf("unsupported security key type %q", priv.KeyType)
+	}
+	// the key type through the reserved field (the comment and padding follow)
+	keyBlob := outer.PrivKeyBlock[8 : len(outer.PrivKeyBlock)-len(rest)]
+	return &skPrivateKey{pubKey: pubKey, flags: flags, keyBlob: keyBlob}, nil
+}
+
+func findSkHelper() (string, error) {
+	if helperPath := os.Getenv("SSH_SK_HELPER"); helperPath != "" {
+		return helperPath, nil
+	}
+	for _, helperPath := range skHelperPaths {
+		if _, err := os.Stat(helperPath); err == nil {
+			return helperPath, nil
+		}
+	}
+	if helperPath, err := exec.LookPath("ssh-sk-helper"); err == nil {
+		return helperPath, nil
+	}
+	return "", fmt.Errorf("ssh-sk-helper was not found, install openssh or add the key to your ssh agent with ssh-add")
+}
+
+// builds an ssh-sk-helper sign request (see ssh-sk-client.c)
+func makeSkSignRequest(keyBlob []byte, provider string, data []byte, pin string) []byte {
+	body := ssh.Marshal(struct {
+		Key      []byte
+		Provider string
+		Data     []byte
+		Alg      string
+		Compat   uint32
+		Pin      string
+	}{keyBlob, provider, data, "", 0, pin})
+	payload := ssh.Marshal(struct {
+		Type      uint32
+		LogStderr uint8
+		LogLevel  uint32
+		Body      []byte `ssh:"rest"`
+	}{skHelperMsgSign, 1, skLogLevelError, body})
+	msg := make([]byte, 5, 5+len(payload))
+	binary.BigEndian.PutUint32(msg, uint32(len(payload)+1))
+	msg[4] = skHelperVersion
+	return append(msg, payload...)
+}
+
+// parses the ssh-sk-helper response to a sign request
+func parseSkSignResponse(resp []byte) (*ssh.Signature, error) {
+	if len(resp) < 5 {
+		return nil, fmt.Errorf("short response from ssh-sk-helper")
+	}
+	msgLen := binary.BigEndian.Uint32(resp)
+	if int(msgLen) != len(resp)-4 || resp[4] != skHelperVersion {
+		return nil, fmt.Errorf("unexpected response from ssh-sk-helper (version %d)", resp[4])
+	}
+	payload := resp[5:]
+	if len(payload) < 4 {
+		return nil, fmt.Errorf("short response from ssh-sk-helper")
+	}
+	switch binary.BigEndian.Uint32(payload) {
+	case skHelperMsgError:
+		var errResp struct {
+			Type uint32
+			Code uint32
+		}
+		if err := ssh.Unmarshal(payload, &errResp); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("ssh-sk-helper failed (error %d)", errResp.Code)
+	case skHelperMsgSign:
+		var signResp struct {
+			Type uint32
+			Sig  []byte
+		}
+		if err := ssh.Unmarshal(payload, &signResp); err != nil {
+			return nil, err
+		}
+		sig := &ssh.Signature{}
+		if err := ssh.Unmarshal(signResp.Sig, sig); err != nil {
+			return nil, fmt.Errorf("invalid signature from ssh-sk-helper: %w", err)
+		}
+		return sig, nil
+	}
+	return nil, fmt.Errorf("unexpected response type from ssh-sk-helper")
+}
+
+// shows a prompt asking the user to touch their security key while signFn runs.  if the
+// user cancels the prompt (or doesn't touch the key before userinput:securitykeytimeoutms),
+// the ctx passed to signFn is canceled.
+func withTouchPrompt(connCtx context.Context, pubKey ssh.PublicKey, keyName string, signFn func(ctx context.Context) (*ssh.Signature, error)) (*ssh.Signature, error) {
+	var signCtx context.Context
+	var cancelSign context.CancelFunc
+	if touchTimeout := userinput.GetPromptTimeout(userinput.PromptType_SecurityKey); touchTimeout > 0 {
+		signCtx, cancelSign = context.WithTimeout(connCtx, touchTimeout)
+	} else {
+		signCtx, cancelSign = context.WithCancel(connCtx)
+	}
+	defer cancelSign()
+	promptCtx, cancelPrompt := context.WithCancel(signCtx)
+	defer cancelPrompt()
+	go func() {
+		defer panichandler.PanicHandler("withTouchPrompt")
+		request := &userinput.UserInputRequest{
+			ResponseType: userinput.ResponseType_Confirm,
+			Title:        "Security Key",
+			QueryText:    fmt.Sprintf("Touch your security key to authenticate.\n\n%s %s", keyName, ssh.FingerprintSHA256(pubKey)),
+			OkLabel:      "Hide",
+			CancelLabel:  "Cancel",
+		}
+		response, err := userinput.GetUserInput(promptCtx, request)
+		if promptCtx.Err() != nil {
+			// the signature is done (the prompt was withdrawn)
+			return
+		}
+		var noPromptErr *userinput.NoPromptError
+		if errors.As(err, &noPromptErr) {
+			// headless, the key still signs when it is touched
+			return
+		}
+		if err != nil || !response.Confirm {
+			conndebug.Logf(connCtx, "publickey: security key touch canceled by the user")
+			cancelSign()
+		}
+	}()
+	return signFn(signCtx)
+}
+
+// signs with an identity file security key through ssh-sk-helper
+type skHelperSigner struct {
+	connCtx  context.Context
+	key      *skPrivateKey
+	keyName  string
+	provider string
+	pin      string
+}
+
+func (s *skHelperSigner) PublicKey() ssh.PublicKey {
+	return s.key.pubKey
+}
+
+func (s *skHelperSigner) Sign(_ io.Reader, data []byte) (*ssh.Signature, error) {
+	helperPath, err := findSkHelper()
+	if err != nil {
+		return nil, err
+	}
+	request := makeSkSignRequest(s.key.keyBlob, s.provider, data, s.pin)
+	signFn := func(ctx context.Context) (*ssh.Signature, error) {
+		cmd := exec.CommandContext(ctx, helperPath)
+		cmd.Stdin = bytes.NewReader(request)
+		var stderr strings.Builder
+		cmd.Stderr = &stderr
+		resp, err := cmd.Output()
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("security key signature canceled: %w", ctx.Err())
+		}
+		if err != nil {
+			if stderr.Len() > 0 {
+				return nil, fmt.Errorf("ssh-sk-helper: %w: %s", err, strings.TrimSpace(stderr.String()))
+			}
+			return nil, fmt.Errorf("ssh-sk-helper: %w", err)
+		}
+		return parseSkSignResponse(resp)
+	}
+	conndebug.Logf(s.connCtx, "publickey: signing with security key %s through %s", s.keyName, helperPath)
+	if s.key.flags&skFlagUserPresenceRequired == 0 {
+		return signFn(s.connCtx)
+	}
+	return withTouchPrompt(s.connCtx, s.key.pubKey, s.keyName, signFn)
+}
+
+// makes a signer for a security key identity file (asking for the PIN if the key needs one)
+func makeSkHelperSigner(connCtx context.Context, sshKeywords *wshrpc.ConnKeywords, key *skPrivateKey, identityFile string) (ssh.Signer, error) {
+	provider := sshKeywords.SshSecurityKeyProvider
+	if provider == "" {
+		provider = os.Getenv("SSH_SK_PROVIDER")
+	}
+	if provider == "" {
+		provider = "internal"
+	}
+	signer := &skHelperSigner{connCtx: connCtx, key: key, keyName: identityFile, provider: provider}
+	if key.flags&skFlagUserVerificationRequired != 0 {
+		if sshKeywords.SshBatchMode {
+			return nil, fmt.Errorf("%s needs a PIN but batch mode is on", identityFile)
+		}
+		request := &userinput.UserInputRequest{
+			QueryText: fmt.Sprintf("Enter the PIN for the security key: %s", identityFile),
+			Title:     "Security Key PIN",
+		}
+		response, err := userinput.GetUserSecret(connCtx, userinput.PromptType_Passphrase, request)
+		if err != nil {
+			return nil, UserInputCancelError{Err: err}
+		}
+		signer.pin = response.Text
+	}
+	return signer, nil
+}
+
+// signs with a security key in the agent (the agent talks to the key, we only show the prompt)
+type skAgentSigner struct {
+	ssh.Signer
+	connCtx context.Context
+}
+
+func (s *skAgentSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	return withTouchPrompt(s.connCtx, s.Signer.PublicKey(), "agent key", func(ctx context.Context) (*ssh.Signature, error) {
+		type signResult struct {
+			sig *ssh.Signature
+			err error
+		}
+		resultCh := make(chan signResult, 1)
+		go func() {
+			defer panichandler.PanicHandler("skAgentSigner.Sign")
+			sig, err := s.Signer.Sign(rand, data)
+			resultCh <- signResult{sig, err}
+		}()
+		select {
+		case result := <-resultCh:
+			return result.sig, result.err
+		case <-ctx.Done():
+			return nil, fmt.Errorf("security key signature canceled: %w", ctx.Err())
+		}
+	})
+}
+
+// wraps agent signers for security keys so the touch prompt is shown
+func wrapSkAgentSigner(connCtx context.Context, signer ssh.Signer) ssh.Signer {
+	if !isSecurityKeyType(signer.PublicKey().Type()) {
+		return signer
+	}
+	return &skAgentSigner{Signer: signer, connCtx: connCtx}
+}
@@ -0,0 +1,109 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParseSkPrivateKey(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	pubBlob := ssh.Marshal(struct {
+		KeyType     string
+		Pub         []byte
+		Application string
+	}{ssh.KeyAlgoSKED25519, pub, "ssh:"})
+	keyFields := ssh.Marshal(struct {
+		KeyType     string
+		Pub         []byte
+		Application string
+		Flags       uint8
+		KeyHandle   []byte
+		Reserved    []byte
+	}{ssh.KeyAlgoSKED25519, pub, "ssh:", skFlagUserPresenceRequired | skFlagUserVerificationRequired, []byte("handle"), nil})
+	privBlock := ssh.Marshal(struct {
+		Check1 uint32
+		Check2 uint32
+		Key    []byte `ssh:"rest"`
+	}{7, 7, append(append([]byte(nil), keyFields...), ssh.Marshal(struct{ Comment string }{"test"})...)})
+	privBlock = append(privBlock, 1, 2, 3) // padding
+	keyFile := append([]byte("openssh-key-v1\x00"), ssh.Marshal(struct {
+		CipherName   string
+		KdfName      string
+		KdfOpts      string
+		NumKeys      uint32
+		PubKey       []byte
+		PrivKeyBlock []byte
+	}{"none", "none", "", 1, pubBlob, privBlock})...)
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: keyFile})
+
+	key, err := parseSkPrivateKey(pemBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.pubKey.Type() != ssh.KeyAlgoSKED25519 {
+		t.Errorf("got key type %q", key.pubKey.Type())
+	}
+	if key.flags != skFlagUserPresenceRequired|skFlagUserVerificationRequired {
+		t.Errorf("got flags %#x", key.flags)
+	}
+	if !bytes.Equal(key.keyBlob, keyFields) {
+		t.Errorf("key blob does not match the serialized key")
+	}
+
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	edPem, err := ssh.MarshalPrivateKey(edKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseSkPrivateKey(pem.EncodeToMemory(edPem)); err != errNotSkKey {
+		t.Errorf("ed25519 key: got %v, expected errNotSkKey", err)
+	}
+}
+
+func TestSkHelperMessages(t *testing.T) {
+	req := makeSkSignRequest([]byte("key"), "internal", []byte("data"), "1234")
+	if int(binary.BigEndian.Uint32(req)) != len(req)-4 || req[4] != skHelperVersion {
+		t.Fatalf("bad request framing")
+	}
+	frame := func(payload []byte) []byte {
+		msg := make([]byte, 5)
+		binary.BigEndian.PutUint32(msg, uint32(len(payload)+1))
+		msg[4] = skHelperVersion
+		return append(msg, payload...)
+	}
+	sigBlob := ssh.Marshal(struct {
+		Format  string
+		Blob    []byte
+		Flags   uint8
+		Counter uint32
+	}{ssh.KeyAlgoSKED25519, []byte("sig"), 1, 42})
+	sig, err := parseSkSignResponse(frame(ssh.Marshal(struct {
+		Type uint32
+		Sig  []byte
+	}{skHelperMsgSign, sigBlob})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig.Format != ssh.KeyAlgoSKED25519 || string(sig.Blob) != "sig" || len(sig.Rest) != 5 {
+		t.Errorf("unexpected signature %+v", sig)
+	}
+	if !bytes.Equal(ssh.Marshal(sig), sigBlob) {
+		t.Errorf("signature does not marshal back to the helper's encoding")
+	}
+	_, err = parseSkSignResponse(frame(ssh.Marshal(struct {
+		Type uint32
+		Code uint32
+	}{skHelperMsgError, 5})))
+	if err == nil {
+		t.Errorf("expected an error response to fail")
+	}
+}
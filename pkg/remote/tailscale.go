@@ -0,0 +1,326 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// dials tailscale peers with the help of the local tailscaled, through its LocalAPI socket.  the
+// tailnet's MagicDNS names (short or full) are resolved to the peer's tailscale ip from tailscaled's
+// status, so they work even when the system resolver doesn't know them.  when tailscaled runs with
+// userspace networking (no tun device, so the system can't reach the tailnet), tailscaled dials
+// the peer itself.
+//
+// conn:tailscale (per connection) turns this off (false), or always dials through tailscaled
+// (true).  when it is not set, this is only used for hosts that are tailscale peers.  the socket
+// is found in the usual places, or set with the conn:tailscalesocket setting.  windows is not
+// supported (tailscaled listens on a named pipe there, and always has a tun device).
+
+const TailscaleLocalApiHost = "local-tailscaled.sock"
+const TailscaleStatusTimeout = 2 * time.Second
+const TailscaleStatusCacheTime = 10 * time.Second
+const tailscaleDialUpgrade = "ts-dial"
+
+var defaultTailscaleSockets = map[string][]string{
+	"linux":   {"/var/run/tailscale/tailscaled.sock", "/run/tailscale/tailscaled.sock"},
+	"freebsd": {"/var/run/tailscale/tailscaled.sock"},
+	"darwin":  {"/var/run/tailscaled.socket"},
+}
+
+// the parts of tailscaled's status (ipnstate.Status) that are used here
+type tailscaleStatus struct {
+	BackendState string                          `json:"BackendState"`
+	TUN          bool                            `json:"TUN"`
+	Peer         map[string]*tailscalePeerStatus `json:"Peer"`
+}
+
+type tailscalePeerStatus struct {
+	HostName     string   `json:"HostName"`
+	DNSName      string   `json:"DNSName"`
+	OS           string   `json:"OS"`
+	TailscaleIPs []string `json:"TailscaleIPs"`
+	Online       bool     `json:"Online"`
+	SshHostKeys  []string `json:"sshHostKeys"` // set when the peer runs tailscale ssh
+}
+
+type tailscaleStatusCache struct {
+	Lock       *sync.Mutex
+	SocketPath string
+	Status     *tailscaleStatus
+	Err        error
+	FetchTime  time.Time
+}
+
+var tsStatusCache = &tailscaleStatusCache{Lock: &sync.Mutex{}}
+
+// how to dial a tailscale peer: Addr is its tailscale ip (and the port), SocketPath is set when
+// tailscaled has to dial it
+type tailscaleRoute struct {
+	Addr       string
+	SocketPath string
+}
+
+// the tailscaled socket (from the conn:tailscalesocket setting, or the first default that exists)
+func findTailscaleSocket() string {
+	if socketPath := wconfig.ReadFullConfig().Settings.ConnTailscaleSocket; socketPath != "" {
+		return socketPath
+	}
+	for _, socketPath := range defaultTailscaleSockets[runtime.GOOS] {
+		if _, err := os.Stat(socketPath); err == nil {
+			return socketPath
+		}
+	}
+	return ""
+}
+
+func dialTailscaleSocket(ctx context.Context, socketPath string) (net.Conn, error) {
+	d := net.Dialer{}
+	conn, err := d.DialContext(ctx, "unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to tailscaled: %w", err)
+	}
+	return conn, nil
+}
+
+func fetchTailscaleStatus(ctx context.Context, socketPath string) (*tailscaleStatus, error) {
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialTailscaleSocket(ctx, socketPath)
+			},
+		},
+		Timeout: TailscaleStatusTimeout,
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+TailscaleLocalApiHost+"/localapi/v0/status", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("tailscaled status: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var status tailscaleStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("decoding tailscaled status: %w", err)
+	}
+	return &status, nil
+}
+
+// tailscaled's status, cached for a few seconds (every connection attempt looks at it)
+func getTailscaleStatus(ctx context.Context, socketPath string) (*tailscaleStatus, error) {
+	tsStatusCache.Lock.Lock()
+	defer tsStatusCache.Lock.Unlock()
+	if tsStatusCache.SocketPath == socketPath && time.Since(tsStatusCache.FetchTime) < TailscaleStatusCacheTime {
+		return tsStatusCache.Status, tsStatusCache.Err
+	}
+	status, err := fetchTailscaleStatus(ctx, socketPath)
+	if ctx.Err() != nil {
+		// don't cache a canceled request
+		return status, err
+	}
+	tsStatusCache.SocketPath = socketPath
+	tsStatusCache.Status = status
+	tsStatusCache.Err = err
+	tsStatusCache.FetchTime = time.Now()
+	return status, err
+}
+
+// the MagicDNS name without the trailing dot
+func (p *tailscalePeerStatus) dnsName() string {
+	return strings.TrimSuffix(p.DNSName, ".")
+}
+
+// finds the peer for a host: its MagicDNS name (full or the first label) or tailscale ip
+func (s *tailscaleStatus) findPeer(host string) *tailscalePeerStatus {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, peer := range s.Peer {
+		dnsName := strings.ToLower(peer.dnsName())
+		shortName, _, _ := strings.Cut(dnsName, ".")
+		if host == dnsName || host == shortName {
+			return peer
+		}
+		for _, ip := range peer.TailscaleIPs {
+			if host == ip {
+				return peer
+			}
+		}
+	}
+	return nil
+}
+
+// returns how to dial networkAddr over tailscale, or nil to dial it normally.  mode is
+// conn:tailscale (nil means only for tailscale peers).
+func resolveTailscaleRoute(ctx context.Context, mode *bool, networkAddr string) (*tailscaleRoute, error) {
+	if mode != nil && !*mode {
+		return nil, nil
+	}
+	required := mode != nil && *mode
+	socketPath := findTailscaleSocket()
+	if socketPath == "" {
+		if required {
+			return nil, fmt.Errorf("conn:tailscale is set, but tailscaled's socket was not found (set conn:tailscalesocket)")
+		}
+		return nil, nil
+	}
+	host, port, err := net.SplitHostPort(networkAddr)
+	if err != nil {
+		return nil, err
+	}
+	status, err := getTailscaleStatus(ctx, socketPath)
+	if err != nil || status.BackendState != "Running" {
+		if !required {
+			return nil, nil
+		}
+		if err == nil {
+			err = fmt.Errorf("tailscale is %s", strings.ToLower(status.BackendState))
+		}
+		return nil, fmt.Errorf("conn:tailscale is set: %w", err)
+	}
+	peer := status.findPeer(host)
+	if peer == nil {
+		if !required {
+			return nil, nil
+		}
+		// tailscaled can still dial it (a subnet route, or a name it resolves)
+		return &tailscaleRoute{Addr: networkAddr, SocketPath: socketPath}, nil
+	}
+	rtn := &tailscaleRoute{Addr: networkAddr}
+	if len(peer.TailscaleIPs) > 0 {
+		rtn.Addr = net.JoinHostPort(peer.TailscaleIPs[0], port)
+	}
+	if required || !status.TUN {
+		rtn.SocketPath = socketPath
+	}
+	return rtn, nil
+}
+
+// a connection that tailscaled dialed (reads go through the reader that read the http response)
+type tailscaleDialConn struct {
+	net.Conn
+	reader     *bufio.Reader
+	remoteAddr net.Addr
+}
+
+func (c *tailscaleDialConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// the peer's address (known_hosts checks need a tcp address)
+func (c *tailscaleDialConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+// asks tailscaled to dial addr (the LocalAPI dial request, which upgrades the socket connection
+// to the dialed connection)
+func dialTailscale(ctx context.Context, socketPath string, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialTailscaleSocket(ctx, socketPath)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stopFn := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	rtnConn, err := upgradeTailscaleDial(conn, host, port)
+	if !stopFn() && err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return rtnConn, nil
+}
+
+func upgradeTailscaleDial(conn net.Conn, host string, port string) (net.Conn, error) {
+	req, err := http.NewRequest(http.MethodPost, "http://"+TailscaleLocalApiHost+"/localapi/v0/dial", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Connection", "upgrade")
+	req.Header.Set("Upgrade", tailscaleDialUpgrade)
+	req.Header.Set("Dial-Host", host)
+	req.Header.Set("Dial-Port", port)
+	if err := req.Write(conn); err != nil {
+		return nil, fmt.Errorf("tailscaled dial: %w", err)
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return nil, fmt.Errorf("tailscaled dial: %w", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusForbidden {
+			return nil, fmt.Errorf("tailscaled dial: access denied (make your user the tailscale operator with \"tailscale set --operator=$USER\")")
+		}
+		return nil, fmt.Errorf("tailscaled dial %s:%s: %s: %s", host, port, resp.Status, strings.TrimSpace(string(body)))
+	}
+	remoteAddr := &net.TCPAddr{IP: net.ParseIP(host)}
+	remoteAddr.Port, _ = strconv.Atoi(port)
+	return &tailscaleDialConn{Conn: conn, reader: reader, remoteAddr: remoteAddr}, nil
+}
+
+// ListTailscalePeers lists the peers of the tailnet (for suggesting connections), sorted by name
+func ListTailscalePeers(ctx context.Context) ([]wshrpc.TailscalePeer, error) {
+	socketPath := findTailscaleSocket()
+	if socketPath == "" {
+		return nil, fmt.Errorf("tailscale is not running")
+	}
+	status, err := getTailscaleStatus(ctx, socketPath)
+	if err != nil {
+		return nil, err
+	}
+	if status.BackendState != "Running" {
+		return nil, fmt.Errorf("tailscale is %s", strings.ToLower(status.BackendState))
+	}
+	var rtn []wshrpc.TailscalePeer
+	for _, peer := range status.Peer {
+		if peer.dnsName() == "" {
+			continue
+		}
+		rtn = append(rtn, wshrpc.TailscalePeer{
+			HostName:     peer.HostName,
+			DNSName:      peer.dnsName(),
+			OS:           peer.OS,
+			TailscaleIPs: peer.TailscaleIPs,
+			Online:       peer.Online,
+			TailscaleSsh: len(peer.SshHostKeys) > 0,
+		})
+	}
+	sort.Slice(rtn, func(i, j int) bool {
+		return rtn[i].DNSName < rtn[j].DNSName
+	})
+	return rtn, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// a fake tailscaled: the status has one peer, and dial requests are upgraded to an echo
+func startFakeTailscaled(t *testing.T) string {
+	socketPath := filepath.Join(t.TempDir(), "tailscaled.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/localapi/v0/status", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"BackendState": "Running", "TUN": false, "Peer": {"nodekey:1": {"HostName": "Build-Box", "DNSName": "build.tail1234.ts.net.", "OS": "linux", "TailscaleIPs": ["100.64.0.7", "fd7a:115c:a1e0::7"], "Online": true, "sshHostKeys": ["ssh-ed25519 AAAA"]}}}`)
+	})
+	mux.HandleFunc("/localapi/v0/dial", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != tailscaleDialUpgrade || r.Header.Get("Dial-Host") != "100.64.0.7" || r.Header.Get("Dial-Port") != "22" {
+			http.Error(w, "bad dial request", http.StatusBadRequest)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: ts-dial\r\nConnection: upgrade\r\n\r\nSSH-2.0-fake\r\n")
+		rw.Flush()
+		io.Copy(conn, rw)
+	})
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return socketPath
+}
+
+func TestTailscaleDial(t *testing.T) {
+	socketPath := startFakeTailscaled(t)
+	ctx, cancelFn := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFn()
+	status, err := fetchTailscaleStatus(ctx, socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range []string{"build", "BUILD.tail1234.ts.net", "build.tail1234.ts.net.", "100.64.0.7"} {
+		if status.findPeer(host) == nil {
+			t.Errorf("peer not found for %q", host)
+		}
+	}
+	if status.findPeer("Build-Box") != nil || status.findPeer("other") != nil {
+		t.Errorf("only MagicDNS names and tailscale ips should match")
+	}
+
+	conn, err := dialTailscale(ctx, socketPath, "100.64.0.7:22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr); !ok || tcpAddr.String() != "100.64.0.7:22" {
+		t.Errorf("remote addr %v", conn.RemoteAddr())
+	}
+	// the bytes that arrived with the http response must not be lost
+	buf := make([]byte, len("SSH-2.0-fake\r\n"))
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "SSH-2.0-fake\r\n" {
+		t.Fatalf("read %q: %v", buf, err)
+	}
+	conn.Write([]byte("ping"))
+	buf = make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Errorf("echo %q: %v", buf, err)
+	}
+
+	if _, err := dialTailscale(ctx, socketPath, "100.64.0.8:22"); err == nil {
+		t.Errorf("a failed dial should be an error")
+	}
+}
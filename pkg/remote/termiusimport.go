@@ -0,0 +1,139 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+)
+
+// imports the hosts of a Termius json export.  each host has an address and an ssh config with
+// the port, the identity (user name and key) and the host chain (the jump hosts, referenced by
+// label or address).  keys that only exist inside Termius can't be used, those are warnings.
+
+type termiusExport struct {
+	Hosts []*termiusHost `json:"hosts"`
+}
+
+type termiusHost struct {
+	Label     string            `json:"label"`
+	Address   string            `json:"address"`
+	Group     string            `json:"group,omitempty"`
+	SshConfig *termiusSshConfig `json:"ssh_config,omitempty"`
+}
+
+type termiusSshConfig struct {
+	Port      int              `json:"port,omitempty"`
+	Identity  *termiusIdentity `json:"identity,omitempty"`
+	HostChain []string         `json:"host_chain,omitempty"`
+}
+
+type termiusIdentity struct {
+	Username string         `json:"username,omitempty"`
+	SshKey   *termiusSshKey `json:"ssh_key,omitempty"`
+}
+
+type termiusSshKey struct {
+	Label      string `json:"label,omitempty"`
+	Path       string `json:"path,omitempty"` // the key file, when the key was added from one
+	PrivateKey string `json:"private_key,omitempty"`
+}
+
+func (h *termiusHost) sessionName() string {
+	name := h.Label
+	if name == "" {
+		name = h.Address
+	}
+	if h.Group != "" {
+		name = h.Group + "/" + name
+	}
+	return name
+}
+
+func (h *termiusHost) connName() (string, error) {
+	var userName string
+	var port int
+	if h.SshConfig != nil {
+		port = h.SshConfig.Port
+		if h.SshConfig.Identity != nil {
+			userName = h.SshConfig.Identity.Username
+		}
+	}
+	return makeImportConnName(userName, h.Address, port)
+}
+
+func parseTermiusExport(data []byte) ([]*importedConn, error) {
+	var export termiusExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("not a termius export: %w", err)
+	}
+	// the host chain references other hosts of the export
+	hostConns := make(map[string]string)
+	for _, host := range export.Hosts {
+		connName, err := host.connName()
+		if err != nil {
+			continue
+		}
+		hostConns[host.Address] = connName
+		if host.Label != "" {
+			hostConns[host.Label] = connName
+		}
+	}
+	var rtn []*importedConn
+	for _, host := range export.Hosts {
+		conn := &importedConn{Session: host.sessionName()}
+		rtn = append(rtn, conn)
+		conn.ConnName, conn.Err = host.connName()
+		if conn.Err != nil {
+			continue
+		}
+		conn.Meta = make(waveobj.MetaMapType)
+		if host.SshConfig == nil {
+			continue
+		}
+		if identity := host.SshConfig.Identity; identity != nil && identity.SshKey != nil {
+			sshKey := identity.SshKey
+			if sshKey.Path != "" {
+				setImportListValue(conn.Meta, "ssh:identityfile", []string{sshKey.Path})
+			} else if sshKey.PrivateKey != "" {
+				conn.Warnings = append(conn.Warnings, fmt.Sprintf("key %q is only stored in Termius, save it to a file and add it as ssh:identityfile", sshKey.Label))
+			}
+		}
+		var jumps []string
+		for _, chainHost := range host.SshConfig.HostChain {
+			if jumpConn, ok := hostConns[chainHost]; ok {
+				jumps = append(jumps, jumpConn)
+			} else if _, err := ParseOpts(chainHost); err == nil {
+				jumps = append(jumps, chainHost)
+			} else {
+				conn.Warnings = append(conn.Warnings, fmt.Sprintf("jump host %q not found, not imported", chainHost))
+				jumps = nil
+				break
+			}
+		}
+		setImportListValue(conn.Meta, "ssh:proxyjump", jumps)
+	}
+	return rtn, nil
+}
+
+type termiusImporter struct{}
+
+func (termiusImporter) ReadConns(path string) ([]*importedConn, error) {
+	if path == "" {
+		return nil, fmt.Errorf("give the path of the termius export")
+	}
+	path, err := wavebase.ExpandHomeDir(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseTermiusExport(data)
+}
@@ -0,0 +1,128 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// time-based one-time codes (rfc 6238) for keyboard-interactive verification code prompts.  the
+// secret for a connection is saved in the keychain, either as the base32 secret an authenticator
+// app is given or as the whole otpauth:// uri (which can also set the digits, period and algorithm).
+
+const (
+	TotpDefaultDigits = 6
+	TotpDefaultPeriod = 30
+)
+
+type totpSecret struct {
+	Key       []byte
+	Digits    int
+	Period    int
+	Algorithm string // SHA1, SHA256, or SHA512
+}
+
+// checks a secret before it is saved
+func ValidateTotpSecret(secret string) error {
+	_, err := parseTotpSecret(secret)
+	return err
+}
+
+func parseTotpSecret(secret string) (*totpSecret, error) {
+	secret = strings.TrimSpace(secret)
+	rtn := &totpSecret{Digits: TotpDefaultDigits, Period: TotpDefaultPeriod, Algorithm: "SHA1"}
+	if strings.HasPrefix(strings.ToLower(secret), "otpauth://") {
+		otpUrl, err := url.Parse(secret)
+		if err != nil {
+			return nil, fmt.Errorf("invalid otpauth uri: %w", err)
+		}
+		if !strings.EqualFold(otpUrl.Host, "totp") {
+			return nil, fmt.Errorf("otpauth uri is not for a time-based code (%q)", otpUrl.Host)
+		}
+		query := otpUrl.Query()
+		secret = query.Get("secret")
+		if digits := query.Get("digits"); digits != "" {
+			rtn.Digits, err = strconv.Atoi(digits)
+			if err != nil || rtn.Digits < 6 || rtn.Digits > 10 {
+				return nil, fmt.Errorf("invalid otpauth digits %q", digits)
+			}
+		}
+		if period := query.Get("period"); period != "" {
+			rtn.Period, err = strconv.Atoi(period)
+			if err != nil || rtn.Period <= 0 {
+				return nil, fmt.Errorf("invalid otpauth period %q", period)
+			}
+		}
+		if algorithm := query.Get("algorithm"); algorithm != "" {
+			rtn.Algorithm = strings.ToUpper(algorithm)
+		}
+	}
+	if rtn.Algorithm != "SHA1" && rtn.Algorithm != "SHA256" && rtn.Algorithm != "SHA512" {
+		return nil, fmt.Errorf("unsupported totp algorithm %q", rtn.Algorithm)
+	}
+	// authenticator apps show the secret in groups, lowercase, and without padding
+	secret = strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(secret))
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "="))
+	if err != nil {
+		return nil, fmt.Errorf("totp secret is not valid base32")
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("totp secret is empty")
+	}
+	rtn.Key = key
+	return rtn, nil
+}
+
+func (s *totpSecret) hashFn() func() hash.Hash {
+	switch s.Algorithm {
+	case "SHA256":
+		return sha256.New
+	case "SHA512":
+		return sha512.New
+	default:
+		return sha1.New
+	}
+}
+
+// the code for the period containing ts
+func (s *totpSecret) Code(ts time.Time) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(ts.Unix()/int64(s.Period)))
+	mac := hmac.New(s.hashFn(), s.Key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	// rfc 4226 dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	value := uint64(binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff)
+	modulus := uint64(1)
+	for i := 0; i < s.Digits; i++ {
+		modulus *= 10
+	}
+	return fmt.Sprintf("%0*d", s.Digits, value%modulus)
+}
+
+// the questions answered with the saved totp code, conn:totpprompt or the verification code
+// questions that get the otp prompt
+func makeTotpQuestionRe(totpPrompt string) (*regexp.Regexp, error) {
+	if totpPrompt == "" {
+		return otpQuestionRe, nil
+	}
+	re, err := regexp.Compile(totpPrompt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid conn:totpprompt %q: %w", totpPrompt, err)
+	}
+	return re, nil
+}
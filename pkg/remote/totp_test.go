@@ -0,0 +1,60 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+func TestTotpCode(t *testing.T) {
+	// the rfc 6238 test vectors (8 digits, the seed is repeated to the length of the hash)
+	seeds := map[string]string{
+		"SHA1":   "12345678901234567890",
+		"SHA256": "12345678901234567890123456789012",
+		"SHA512": "1234567890123456789012345678901234567890123456789012345678901234",
+	}
+	tests := []struct {
+		ts        int64
+		algorithm string
+		code      string
+	}{
+		{59, "SHA1", "94287082"},
+		{59, "SHA256", "46119246"},
+		{59, "SHA512", "90693936"},
+		{1111111109, "SHA1", "07081804"},
+		{1234567890, "SHA256", "91819424"},
+		{20000000000, "SHA512", "47863826"},
+	}
+	for _, test := range tests {
+		secret := base32.StdEncoding.EncodeToString([]byte(seeds[test.algorithm]))
+		totp, err := parseTotpSecret("otpauth://totp/test?digits=8&algorithm=" + test.algorithm + "&secret=" + secret)
+		if err != nil {
+			t.Fatalf("parse %s: %v", test.algorithm, err)
+		}
+		if got := totp.Code(time.Unix(test.ts, 0)); got != test.code {
+			t.Errorf("%s at %d: got %s, expected %s", test.algorithm, test.ts, got, test.code)
+		}
+	}
+}
+
+func TestParseTotpSecret(t *testing.T) {
+	// the way authenticator setup pages show the secret
+	totp, err := parseTotpSecret("gezd gnbv gy3t qojq gezd gnbv gy3t qojq")
+	if err != nil {
+		t.Fatalf("grouped secret: %v", err)
+	}
+	if totp.Digits != 6 || totp.Period != 30 || string(totp.Key) != "12345678901234567890" {
+		t.Errorf("unexpected secret %+v", totp)
+	}
+	if got := totp.Code(time.Unix(59, 0)); got != "287082" {
+		t.Errorf("got %s, expected 287082", got)
+	}
+	for _, bad := range []string{"", "not base32!", "otpauth://hotp/test?secret=GEZDGNBV", "otpauth://totp/test?secret=GEZDGNBV&algorithm=MD5", "otpauth://totp/test?secret=GEZDGNBV&digits=4"} {
+		if _, err := parseTotpSecret(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
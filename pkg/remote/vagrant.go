@@ -0,0 +1,197 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// discovers the vagrant machines (from vagrant's machine index, "vagrant global-status") and
+// writes the "vagrant ssh-config" of the running ones to a generated ssh config file that is read
+// after ~/.ssh/config.  each running machine becomes a connection named after its alias
+// (vagrant-<project>[-<machine>]).  the file is rewritten on each discovery, so the host, port and
+// key follow the machines, and only the machines that are running have an entry.
+
+const VagrantSshConfigFileName = "vagrant_ssh_config"
+const VagrantCommandTimeout = 30 * time.Second
+const VagrantListCacheTime = 30 * time.Second
+const vagrantAliasPrefix = "vagrant-"
+
+var vagrantAliasUnsafeRe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+var vagrantCache = struct {
+	Lock      *sync.Mutex
+	Machines  []wshrpc.VagrantMachine
+	FetchTime time.Time
+}{Lock: &sync.Mutex{}}
+
+// the generated ssh config file ("" before the data dir is known)
+func VagrantSshConfigPath() string {
+	dataDir := wavebase.GetWaveDataDir()
+	if dataDir == "" {
+		return ""
+	}
+	return filepath.Join(dataDir, VagrantSshConfigFileName)
+}
+
+func runVagrant(ctx context.Context, args ...string) ([]byte, error) {
+	ctx, cancelFn := context.WithTimeout(ctx, VagrantCommandTimeout)
+	defer cancelFn()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "vagrant", args...)
+	cmd.Stderr = &stderr
+	// keeps vagrant from checking for updates on every call
+	cmd.Env = append(os.Environ(), "VAGRANT_CHECKPOINT_DISABLE=1")
+	out, err := cmd.Output()
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, fmt.Errorf("vagrant was not found")
+		}
+		return nil, fmt.Errorf("vagrant %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// parses the machine readable output of "vagrant global-status" (lines of
+// timestamp,target,type,data...).  each machine starts with its machine-id line.
+func parseVagrantGlobalStatus(out string) []wshrpc.VagrantMachine {
+	var rtn []wshrpc.VagrantMachine
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.SplitN(strings.TrimRight(line, "\r"), ",", 4)
+		if len(fields) < 4 {
+			continue
+		}
+		val := strings.ReplaceAll(fields[3], "%!(VAGRANT_COMMA)", ",")
+		if fields[2] == "machine-id" {
+			rtn = append(rtn, wshrpc.VagrantMachine{Id: val})
+			continue
+		}
+		if len(rtn) == 0 {
+			continue
+		}
+		machine := &rtn[len(rtn)-1]
+		switch fields[2] {
+		case "name":
+			machine.Name = val
+		case "provider-name":
+			machine.Provider = val
+		case "machine-home":
+			machine.Directory = val
+		case "state":
+			machine.State = val
+		}
+	}
+	return rtn
+}
+
+// the connection names of the machines: vagrant-<project>, with the machine name when it is not
+// "default", and the id when that is still not unique
+func makeVagrantAliases(machines []wshrpc.VagrantMachine) []string {
+	aliases := make([]string, len(machines))
+	counts := make(map[string]int)
+	for idx, machine := range machines {
+		alias := vagrantAliasPrefix + filepath.Base(filepath.Clean(machine.Directory))
+		if machine.Name != "" && machine.Name != "default" {
+			alias += "-" + machine.Name
+		}
+		alias = strings.Trim(vagrantAliasUnsafeRe.ReplaceAllString(alias, "-"), "-.")
+		aliases[idx] = alias
+		counts[alias]++
+	}
+	for idx, machine := range machines {
+		if counts[aliases[idx]] > 1 {
+			aliases[idx] += "-" + machine.Id
+		}
+	}
+	return aliases
+}
+
+// the Host block of "vagrant ssh-config" (anything vagrant prints before it is dropped)
+func trimVagrantSshConfig(out string) (string, error) {
+	idx := strings.Index(out, "Host ")
+	if idx < 0 {
+		return "", fmt.Errorf("no Host in vagrant ssh-config output")
+	}
+	return strings.TrimSpace(out[idx:]) + "\n", nil
+}
+
+func writeVagrantSshConfig(configPath string, blocks []string) error {
+	var buf bytes.Buffer
+	buf.WriteString("# written by Wave from \"vagrant ssh-config\", it is replaced on each discovery\n\n")
+	for _, block := range blocks {
+		buf.WriteString(block)
+		buf.WriteString("\n")
+	}
+	tmpPath := configPath + ".tmp"
+	if err := os.WriteFile(tmpPath, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, configPath)
+}
+
+// runs the discovery (the ssh config of the running machines is written, and the ssh config files
+// are read again)
+func discoverVagrantMachines(ctx context.Context) ([]wshrpc.VagrantMachine, error) {
+	out, err := runVagrant(ctx, "global-status", "--machine-readable")
+	if err != nil {
+		return nil, err
+	}
+	machines := parseVagrantGlobalStatus(string(out))
+	aliases := makeVagrantAliases(machines)
+	var blocks []string
+	for idx := range machines {
+		if machines[idx].State != "running" {
+			continue
+		}
+		sshConfigOut, err := runVagrant(ctx, "ssh-config", "--host", aliases[idx], machines[idx].Id)
+		var block string
+		if err == nil {
+			block, err = trimVagrantSshConfig(string(sshConfigOut))
+		}
+		if err != nil {
+			machines[idx].Error = err.Error()
+			continue
+		}
+		blocks = append(blocks, block)
+		machines[idx].Connection = aliases[idx]
+	}
+	configPath := VagrantSshConfigPath()
+	if configPath == "" {
+		return nil, fmt.Errorf("wave data directory is not set")
+	}
+	if err := writeVagrantSshConfig(configPath, blocks); err != nil {
+		return nil, fmt.Errorf("writing %s: %w", configPath, err)
+	}
+	WaveSshConfigUserSettings().ReloadConfigs()
+	return machines, nil
+}
+
+// the vagrant machines (discovered at most every VagrantListCacheTime)
+func ListVagrantMachines(ctx context.Context) ([]wshrpc.VagrantMachine, error) {
+	vagrantCache.Lock.Lock()
+	defer vagrantCache.Lock.Unlock()
+	if !vagrantCache.FetchTime.IsZero() && time.Since(vagrantCache.FetchTime) < VagrantListCacheTime {
+		return vagrantCache.Machines, nil
+	}
+	machines, err := discoverVagrantMachines(ctx)
+	if err != nil {
+		return nil, err
+	}
+	vagrantCache.Machines = machines
+	vagrantCache.FetchTime = time.Now()
+	return machines, nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const testVagrantGlobalStatus = `1700000000,,metadata,machine-count,3
+1700000000,,machine-id,a1b2c3d
+1700000000,,provider-name,virtualbox
+1700000000,,machine-home,/home/user/web app
+1700000000,,state,running
+1700000000,,machine-id,e4f5a6b
+1700000000,,name,db
+1700000000,,provider-name,libvirt
+1700000000,,machine-home,/home/user/web app
+1700000000,,state,shutoff
+1700000000,,machine-id,c7d8e9f
+1700000000,,provider-name,virtualbox
+1700000000,,machine-home,/srv/other/web app
+1700000000,,state,running
+1700000000,,ui,info,id%!(VAGRANT_COMMA) name
+`
+
+const testVagrantSshConfig = `==> vagrant: A new version of Vagrant is available
+Host vagrant-web-app
+  HostName 127.0.0.1
+  User vagrant
+  Port 2222
+  UserKnownHostsFile /dev/null
+  StrictHostKeyChecking no
+  IdentityFile "/home/user/web app/.vagrant/machines/default/virtualbox/private_key"
+  IdentitiesOnly yes
+`
+
+func TestVagrantDiscovery(t *testing.T) {
+	machines := parseVagrantGlobalStatus(testVagrantGlobalStatus)
+	expected := []wshrpc.VagrantMachine{
+		{Id: "a1b2c3d", Provider: "virtualbox", Directory: "/home/user/web app", State: "running"},
+		{Id: "e4f5a6b", Name: "db", Provider: "libvirt", Directory: "/home/user/web app", State: "shutoff"},
+		{Id: "c7d8e9f", Provider: "virtualbox", Directory: "/srv/other/web app", State: "running"},
+	}
+	if !reflect.DeepEqual(machines, expected) {
+		t.Fatalf("got %+v", machines)
+	}
+	// the projects share a directory name, so those aliases get the id
+	aliases := makeVagrantAliases(machines)
+	expectedAliases := []string{"vagrant-web-app-a1b2c3d", "vagrant-web-app-db", "vagrant-web-app-c7d8e9f"}
+	if !reflect.DeepEqual(aliases, expectedAliases) {
+		t.Errorf("aliases %v, expected %v", aliases, expectedAliases)
+	}
+
+	block, err := trimVagrantSshConfig(testVagrantSshConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(t.TempDir(), VagrantSshConfigFileName)
+	if err := writeVagrantSshConfig(configPath, []string{block}); err != nil {
+		t.Fatal(err)
+	}
+	settings := MakeSshConfigSettings("", "")
+	settings.generatedConfigPath = configPath
+	result, err := settings.Resolve("vagrant-web-app", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Get("Port") != "2222" || result.Get("User") != "vagrant" || result.Get("StrictHostKeyChecking") != "no" {
+		t.Errorf("unexpected config %v", result.values)
+	}
+	if identityFiles := result.GetAll("IdentityFile"); len(identityFiles) != 1 || identityFiles[0] != `"/home/user/web app/.vagrant/machines/default/virtualbox/private_key"` {
+		t.Errorf("identity files %q", identityFiles)
+	}
+}
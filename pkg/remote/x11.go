@@ -0,0 +1,371 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/trimquotes"
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+	"golang.org/x/crypto/ssh"
+)
+
+// X11 forwarding (ForwardX11).  like ssh, the server gets a fake MIT-MAGIC-COOKIE-1, and the
+// fake cookie in each forwarded X11 connection is replaced with the real one from xauth before it
+// reaches the local X server.  without ForwardX11Trusted, the real cookie is an untrusted one
+// generated for the forwarding (so remote clients are limited by the X SECURITY extension).
+
+const X11AuthProto = "MIT-MAGIC-COOKIE-1"
+const X11UntrustedTimeout = 20 * time.Minute
+const X11CookieRefreshMargin = time.Minute // untrusted cookies are regenerated this long before they could expire
+const X11XauthTimeout = 5 * time.Second
+
+var xauthSearchPaths = []string{"/usr/bin/xauth", "/usr/X11R6/bin/xauth", "/opt/X11/bin/xauth", "/usr/local/bin/xauth"}
+
+type x11Display struct {
+	network string // "unix" or "tcp"
+	addr    string
+	screen  int
+}
+
+// parses $DISPLAY: ":0", "unix:0.0", "host:10.0", or a socket path (XQuartz's launchd socket,
+// ".../org.xquartz:0")
+func parseX11Display(display string) (*x11Display, error) {
+	colonIdx := strings.LastIndex(display, ":")
+	if colonIdx == -1 {
+		return nil, fmt.Errorf("invalid DISPLAY %q", display)
+	}
+	host, numStr := display[:colonIdx], display[colonIdx+1:]
+	screen := 0
+	if dispNum, screenStr, ok := strings.Cut(numStr, "."); ok {
+		var err error
+		screen, err = strconv.Atoi(screenStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DISPLAY %q", display)
+		}
+		numStr = dispNum
+	}
+	displayNum, err := strconv.Atoi(numStr)
+	if err != nil || displayNum < 0 {
+		return nil, fmt.Errorf("invalid DISPLAY %q", display)
+	}
+	if strings.HasPrefix(display, "/") {
+		// the socket is named with the display number
+		return &x11Display{network: "unix", addr: host + ":" + strconv.Itoa(displayNum), screen: screen}, nil
+	}
+	if host == "" || host == "unix" {
+		return &x11Display{network: "unix", addr: fmt.Sprintf("/tmp/.X11-unix/X%d", displayNum), screen: screen}, nil
+	}
+	return &x11Display{network: "tcp", addr: net.JoinHostPort(host, strconv.Itoa(6000+displayNum)), screen: screen}, nil
+}
+
+func getLocalX11Display() string {
+	display := os.Getenv("DISPLAY")
+	if display == "" && runtime.GOOS == "windows" {
+		// VcXsrv and Xming listen on tcp, and DISPLAY usually isn't set
+		return "localhost:0.0"
+	}
+	return display
+}
+
+type x11Settings struct {
+	enabled      bool
+	trusted      bool
+	xauthCommand string
+}
+
+// ForwardX11, ForwardX11Trusted, and XAuthLocation from the ssh config files
+// (ssh:forwardx11 and ssh:forwardx11trusted in connections.json take priority)
+func getX11Settings(connName string, hostPattern string, userName string) x11Settings {
+	var rtn x11Settings
+	if sshConfig, err := WaveSshConfigUserSettings().Resolve(hostPattern, userName); err == nil {
+		rtn.enabled = strings.ToLower(trimquotes.TryTrimQuotes(sshConfig.Get("ForwardX11"))) == "yes"
+		rtn.trusted = strings.ToLower(trimquotes.TryTrimQuotes(sshConfig.Get("ForwardX11Trusted"))) == "yes"
+		if xauthLocation := trimquotes.TryTrimQuotes(sshConfig.Get("XAuthLocation")); xauthLocation != "" {
+			rtn.xauthCommand = wavebase.ExpandHomeDirSafe(xauthLocation)
+		}
+	}
+	if connSettings, ok := wconfig.ReadFullConfig().Connections[connName]; ok {
+		if connSettings.SshForwardX11 != nil {
+			rtn.enabled = *connSettings.SshForwardX11
+		}
+		if connSettings.SshForwardX11Trusted != nil {
+			rtn.trusted = *connSettings.SshForwardX11Trusted
+		}
+	}
+	if rtn.xauthCommand == "" || !fileExists(rtn.xauthCommand) {
+		rtn.xauthCommand = findXauth()
+	}
+	return rtn
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func findXauth() string {
+	if path, err := exec.LookPath("xauth"); err == nil {
+		return path
+	}
+	for _, path := range xauthSearchPaths {
+		if fileExists(path) {
+			return path
+		}
+	}
+	return ""
+}
+
+func runXauth(xauthCommand string, args ...string) (string, error) {
+	ctx, cancelFn := context.WithTimeout(context.Background(), X11XauthTimeout)
+	defer cancelFn()
+	output, err := exec.CommandContext(ctx, xauthCommand, args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("xauth %s: %w", args[0], err)
+	}
+	return string(output), nil
+}
+
+// the real cookie for display (from "xauth list").  untrusted cookies are generated in a
+// temporary file, like ssh does.
+func getX11Cookie(xauthCommand string, display string, trusted bool) ([]byte, error) {
+	if xauthCommand == "" {
+		return nil, fmt.Errorf("xauth not found")
+	}
+	var fileArgs []string
+	if !trusted {
+		tmpDir, err := os.MkdirTemp("", "waveterm-xauth-*")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tmpDir)
+		fileArgs = []string{"-f", filepath.Join(tmpDir, "xauthfile")}
+		timeoutSecs := strconv.Itoa(int(X11UntrustedTimeout.Seconds()))
+		genArgs := append(append([]string(nil), fileArgs...), "generate", display, X11AuthProto, "untrusted", "timeout", timeoutSecs)
+		if _, err := runXauth(xauthCommand, genArgs...); err != nil {
+			return nil, fmt.Errorf("untrusted X11 forwarding setup failed: %w", err)
+		}
+	}
+	output, err := runXauth(xauthCommand, append(fileArgs, "list", display)...)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 3 && fields[1] == X11AuthProto {
+			return hex.DecodeString(fields[2])
+		}
+	}
+	return nil, fmt.Errorf("no %s for display %s", X11AuthProto, display)
+}
+
+type x11Forwarder struct {
+	display    *x11Display
+	fakeCookie []byte
+
+	lock          sync.Mutex
+	realCookie    []byte    // nil if the X server doesn't need one
+	cookieExpires time.Time // zero if realCookie doesn't expire (trusted forwarding)
+	displayStr    string
+	xauthCommand  string
+}
+
+// the real cookie for a new X11 connection.  the X server drops an untrusted cookie once it has
+// gone unused for X11UntrustedTimeout, and the forwarder lives as long as the ssh client, so the
+// cookie is regenerated before it could have expired.
+func (fwd *x11Forwarder) getRealCookie() ([]byte, error) {
+	fwd.lock.Lock()
+	defer fwd.lock.Unlock()
+	if fwd.cookieExpires.IsZero() || time.Now().Before(fwd.cookieExpires.Add(-X11CookieRefreshMargin)) {
+		return fwd.realCookie, nil
+	}
+	realCookie, err := getX11Cookie(fwd.xauthCommand, fwd.displayStr, false)
+	if err != nil {
+		return nil, fmt.Errorf("unable to regenerate the untrusted X11 cookie: %w", err)
+	}
+	if len(realCookie) != len(fwd.fakeCookie) {
+		return nil, fmt.Errorf("regenerated X11 cookie has length %d, expected %d", len(realCookie), len(fwd.fakeCookie))
+	}
+	fwd.realCookie = realCookie
+	fwd.cookieExpires = time.Now().Add(X11UntrustedTimeout)
+	return realCookie, nil
+}
+
+var x11ForwardersLock = &sync.Mutex{}
+var x11Forwarders = make(map[*ssh.Client]*x11Forwarder)
+
+// one forwarder per ssh client (x11 channels can only be handled once per client, and shared
+// connections share it).  the first session to ask decides the display and trust.
+func getX11Forwarder(client *ssh.Client, settings x11Settings) (*x11Forwarder, error) {
+	x11ForwardersLock.Lock()
+	defer x11ForwardersLock.Unlock()
+	if fwd := x11Forwarders[client]; fwd != nil {
+		return fwd, nil
+	}
+	displayStr := getLocalX11Display()
+	if displayStr == "" {
+		return nil, fmt.Errorf("DISPLAY is not set")
+	}
+	display, err := parseX11Display(displayStr)
+	if err != nil {
+		return nil, err
+	}
+	cookieTime := time.Now()
+	realCookie, err := getX11Cookie(settings.xauthCommand, displayStr, settings.trusted)
+	if err != nil {
+		if !settings.trusted {
+			return nil, err
+		}
+		// like ssh, trusted forwarding goes on without a cookie (for servers that don't check)
+		log.Printf("x11: no xauth data for %s, forwarding without authentication: %v", displayStr, err)
+		realCookie = nil
+	}
+	fakeCookie := make([]byte, 16)
+	if realCookie != nil {
+		fakeCookie = make([]byte, len(realCookie))
+	}
+	if _, err := rand.Read(fakeCookie); err != nil {
+		return nil, err
+	}
+	channels := client.HandleChannelOpen("x11")
+	if channels == nil {
+		return nil, fmt.Errorf("x11 channels are already handled for this connection")
+	}
+	fwd := &x11Forwarder{display: display, fakeCookie: fakeCookie, realCookie: realCookie, displayStr: displayStr, xauthCommand: settings.xauthCommand}
+	if !settings.trusted {
+		fwd.cookieExpires = cookieTime.Add(X11UntrustedTimeout)
+	}
+	x11Forwarders[client] = fwd
+	go func() {
+		defer panichandler.PanicHandler("x11Forwarder:channels")
+		for newChannel := range channels {
+			go fwd.handleChannel(newChannel)
+		}
+	}()
+	go func() {
+		defer panichandler.PanicHandler("x11Forwarder:wait")
+		client.Wait()
+		x11ForwardersLock.Lock()
+		defer x11ForwardersLock.Unlock()
+		delete(x11Forwarders, client)
+	}()
+	return fwd, nil
+}
+
+// RequestX11Forwarding sends "x11-req" on session (before its shell or command starts) if
+// ForwardX11 is set for the connection.  it is not an error if forwarding can't be set up.
+func RequestX11Forwarding(client *ssh.Client, session *ssh.Session, connName string, hostPattern string, userName string) {
+	settings := getX11Settings(connName, hostPattern, userName)
+	if !settings.enabled {
+		return
+	}
+	fwd, err := getX11Forwarder(client, settings)
+	if err != nil {
+		log.Printf("x11 forwarding for %s not set up: %v", connName, err)
+		return
+	}
+	payload := ssh.Marshal(struct {
+		SingleConnection bool
+		AuthProto        string
+		AuthCookie       string
+		ScreenNumber     uint32
+	}{false, X11AuthProto, hex.EncodeToString(fwd.fakeCookie), uint32(fwd.display.screen)})
+	ok, err := session.SendRequest("x11-req", true, payload)
+	if err != nil || !ok {
+		log.Printf("x11 forwarding request for %s refused by the server (err: %v)", connName, err)
+	}
+}
+
+func (fwd *x11Forwarder) handleChannel(newChannel ssh.NewChannel) {
+	defer panichandler.PanicHandler("x11Forwarder:handleChannel")
+	channel, reqs, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	setup, err := fwd.readSetup(channel)
+	if err != nil {
+		log.Printf("x11: closing forwarded connection: %v", err)
+		channel.Close()
+		return
+	}
+	localConn, err := net.DialTimeout(fwd.display.network, fwd.display.addr, 10*time.Second)
+	if err != nil {
+		log.Printf("x11: unable to connect to the local display %s: %v", fwd.display.addr, err)
+		channel.Close()
+		return
+	}
+	if _, err := localConn.Write(setup); err != nil {
+		localConn.Close()
+		channel.Close()
+		return
+	}
+	pipeConns(localConn, channel)
+}
+
+func x11Pad(n int) int {
+	return (n + 3) &^ 3
+}
+
+// reads the X11 connection setup (the first message of the client), checks it has the fake cookie,
+// and returns it with the real cookie instead
+func (fwd *x11Forwarder) readSetup(r io.Reader) ([]byte, error) {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	var order binary.ByteOrder
+	switch header[0] {
+	case 'B':
+		order = binary.BigEndian
+	case 'l':
+		order = binary.LittleEndian
+	default:
+		return nil, fmt.Errorf("bad byte order %#x in X11 connection setup", header[0])
+	}
+	nameLen, dataLen := int(order.Uint16(header[6:8])), int(order.Uint16(header[8:10]))
+	rest := make([]byte, x11Pad(nameLen)+x11Pad(dataLen))
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, err
+	}
+	authName, authData := string(rest[:nameLen]), rest[x11Pad(nameLen):x11Pad(nameLen)+dataLen]
+	if authName != X11AuthProto || !bytes.Equal(authData, fwd.fakeCookie) {
+		return nil, fmt.Errorf("X11 connection rejected because of wrong authentication")
+	}
+	realCookie, err := fwd.getRealCookie()
+	if err != nil {
+		return nil, err
+	}
+	newName, newData := []byte(X11AuthProto), realCookie
+	if newData == nil {
+		newName = nil
+	}
+	setup := make([]byte, 12, 12+x11Pad(len(newName))+x11Pad(len(newData)))
+	copy(setup, header)
+	order.PutUint16(setup[6:8], uint16(len(newName)))
+	order.PutUint16(setup[8:10], uint16(len(newData)))
+	setup = append(setup, newName...)
+	setup = append(setup, make([]byte, x11Pad(len(newName))-len(newName))...)
+	setup = append(setup, newData...)
+	setup = append(setup, make([]byte, x11Pad(len(newData))-len(newData))...)
+	return setup, nil
+}
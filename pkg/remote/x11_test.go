@@ -0,0 +1,101 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestParseX11Display(t *testing.T) {
+	tests := []struct {
+		display string
+		network string
+		addr    string
+		screen  int
+	}{
+		{":0", "unix", "/tmp/.X11-unix/X0", 0},
+		{"unix:1.2", "unix", "/tmp/.X11-unix/X1", 2},
+		{"localhost:10.0", "tcp", "localhost:6010", 0},
+		{"/private/tmp/com.apple.launchd.abc/org.xquartz:0", "unix", "/private/tmp/com.apple.launchd.abc/org.xquartz:0", 0},
+	}
+	for _, test := range tests {
+		display, err := parseX11Display(test.display)
+		if err != nil {
+			t.Fatalf("%s: %v", test.display, err)
+		}
+		if display.network != test.network || display.addr != test.addr || display.screen != test.screen {
+			t.Errorf("%s: got %+v", test.display, display)
+		}
+	}
+	if _, err := parseX11Display("nocolon"); err == nil {
+		t.Errorf("expected an error for a DISPLAY without a display number")
+	}
+}
+
+func makeX11Setup(name string, data []byte) []byte {
+	setup := make([]byte, 12)
+	setup[0] = 'l'
+	binary.LittleEndian.PutUint16(setup[2:4], 11)
+	binary.LittleEndian.PutUint16(setup[6:8], uint16(len(name)))
+	binary.LittleEndian.PutUint16(setup[8:10], uint16(len(data)))
+	setup = append(setup, name...)
+	setup = append(setup, make([]byte, x11Pad(len(name))-len(name))...)
+	setup = append(setup, data...)
+	return append(setup, make([]byte, x11Pad(len(data))-len(data))...)
+}
+
+func TestX11SetupCookie(t *testing.T) {
+	fakeCookie, realCookie := bytes.Repeat([]byte{1}, 16), bytes.Repeat([]byte{2}, 16)
+	fwd := &x11Forwarder{fakeCookie: fakeCookie, realCookie: realCookie}
+	setup, err := fwd.readSetup(bytes.NewReader(makeX11Setup(X11AuthProto, fakeCookie)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(setup, makeX11Setup(X11AuthProto, realCookie)) {
+		t.Errorf("the fake cookie was not replaced")
+	}
+	if _, err := fwd.readSetup(bytes.NewReader(makeX11Setup(X11AuthProto, realCookie))); err == nil {
+		t.Errorf("expected a connection without the fake cookie to be rejected")
+	}
+	fwd.realCookie = nil
+	setup, err = fwd.readSetup(bytes.NewReader(makeX11Setup(X11AuthProto, fakeCookie)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(setup, makeX11Setup("", nil)) {
+		t.Errorf("without a real cookie, the authentication should be removed")
+	}
+}
+
+func TestX11CookieRefresh(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as xauth")
+	}
+	// a fake xauth, "generate" does nothing and "list" prints a new cookie
+	xauthPath := filepath.Join(t.TempDir(), "xauth")
+	script := "#!/bin/sh\necho 'host/unix:0  MIT-MAGIC-COOKIE-1  03030303030303030303030303030303'\n"
+	if err := os.WriteFile(xauthPath, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	fakeCookie, realCookie := bytes.Repeat([]byte{1}, 16), bytes.Repeat([]byte{2}, 16)
+	fwd := &x11Forwarder{fakeCookie: fakeCookie, realCookie: realCookie, displayStr: ":0", xauthCommand: xauthPath}
+	fwd.cookieExpires = time.Now().Add(X11UntrustedTimeout)
+	if cookie, err := fwd.getRealCookie(); err != nil || !bytes.Equal(cookie, realCookie) {
+		t.Errorf("a fresh cookie should be kept, got %x (%v)", cookie, err)
+	}
+	fwd.cookieExpires = time.Now().Add(X11CookieRefreshMargin / 2)
+	cookie, err := fwd.getRealCookie()
+	if err != nil || !bytes.Equal(cookie, bytes.Repeat([]byte{3}, 16)) {
+		t.Fatalf("an expiring cookie should be regenerated, got %x (%v)", cookie, err)
+	}
+	if time.Until(fwd.cookieExpires) < X11UntrustedTimeout-time.Minute {
+		t.Errorf("the regenerated cookie expires at %v", fwd.cookieExpires)
+	}
+}
@@ -5,13 +5,13 @@ package blockservice
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"time"
 
 	"github.com/wavetermdev/waveterm/pkg/blockcontroller"
 	"github.com/wavetermdev/waveterm/pkg/filestore"
 	"github.com/wavetermdev/waveterm/pkg/tsgen/tsgenmeta"
+	"github.com/wavetermdev/waveterm/pkg/waveai"
 	"github.com/wavetermdev/waveterm/pkg/waveobj"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
 	"github.com/wavetermdev/waveterm/pkg/wstore"
@@ -79,15 +79,5 @@ func (bs *BlockService) SaveWaveAiData(ctx context.Context, blockId string, hist
 	if viewName != "waveai" {
 		return fmt.Errorf("invalid view type: %s", viewName)
 	}
-	historyBytes, err := json.Marshal(history)
-	if err != nil {
-		return fmt.Errorf("unable to serialize ai history: %v", err)
-	}
-	// ignore MakeFile error (already exists is ok)
-	filestore.WFS.MakeFile(ctx, blockId, "aidata", nil, filestore.FileOptsType{})
-	err = filestore.WFS.WriteFile(ctx, blockId, "aidata", historyBytes)
-	if err != nil {
-		return fmt.Errorf("cannot save terminal state: %w", err)
-	}
-	return nil
+	return waveai.SaveChat(ctx, blockId, history)
 }
@@ -9,7 +9,10 @@ import (
 	"log"
 	"time"
 
+	"github.com/wavetermdev/waveterm/pkg/docker"
+	"github.com/wavetermdev/waveterm/pkg/k8s"
 	"github.com/wavetermdev/waveterm/pkg/remote/conncontroller"
+	"github.com/wavetermdev/waveterm/pkg/telnet"
 	"github.com/wavetermdev/waveterm/pkg/waveobj"
 	"github.com/wavetermdev/waveterm/pkg/wcloud"
 	"github.com/wavetermdev/waveterm/pkg/wconfig"
@@ -43,7 +46,10 @@ func (cs *ClientService) GetTab(tabId string) (*waveobj.Tab, error) {
 func (cs *ClientService) GetAllConnStatus(ctx context.Context) ([]wshrpc.ConnStatus, error) {
 	sshStatuses := conncontroller.GetAllConnStatus()
 	wslStatuses := wsl.GetAllConnStatus()
-	return append(sshStatuses, wslStatuses...), nil
+	k8sStatuses := k8s.GetAllConnStatus()
+	dockerStatuses := docker.GetAllConnStatus()
+	telnetStatuses := telnet.GetAllConnStatus()
+	return append(append(append(append(sshStatuses, wslStatuses...), k8sStatuses...), dockerStatuses...), telnetStatuses...), nil
 }
 
 // moves the window to the front of the windowId stack
@@ -0,0 +1,137 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package fileservice
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/filestore"
+	"github.com/wavetermdev/waveterm/pkg/tsgen/tsgenmeta"
+	"github.com/wavetermdev/waveterm/pkg/util/linediff"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshremote"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshserver"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+// compares two files (on any connections, or a block file in the filestore) for diff blocks.  the
+// files are read here, so files on different connections can be compared.
+
+const MaxDiffFileSize = 64 * 1024 * 1024
+const DiffReadTimeout = 60 * time.Second
+const BinaryCheckSize = 8000 // like git, a NUL byte in the start of the file marks it as binary
+
+// a path on a connection, or a block file (ZoneId + FileName)
+type DiffSource struct {
+	Connection string `json:"connection,omitempty"`
+	Path       string `json:"path,omitempty"`
+	ZoneId     string `json:"zoneid,omitempty"`
+	FileName   string `json:"filename,omitempty"`
+}
+
+type FileDiff struct {
+	OldSize     int64               `json:"oldsize"`
+	NewSize     int64               `json:"newsize"`
+	OldChecksum string              `json:"oldchecksum"`
+	NewChecksum string              `json:"newchecksum"`
+	Identical   bool                `json:"identical,omitempty"`
+	Binary      bool                `json:"binary,omitempty"` // binary files are only compared by checksum (no hunks)
+	Hunks       []linediff.DiffHunk `json:"hunks"`
+	Added       int                 `json:"added"`
+	Removed     int                 `json:"removed"`
+	Approximate bool                `json:"approximate,omitempty"` // a large changed region is shown as replaced
+	Truncated   bool                `json:"truncated,omitempty"`   // too many changed lines, later hunks were left out
+}
+
+func isBinaryData(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), BinaryCheckSize)], 0) >= 0
+}
+
+func readDiffSource(src DiffSource) ([]byte, error) {
+	if src.ZoneId != "" {
+		ctx, cancelFn := context.WithTimeout(context.Background(), DefaultTimeout)
+		defer cancelFn()
+		finfo, err := filestore.WFS.Stat(ctx, src.ZoneId, src.FileName)
+		if err != nil {
+			return nil, fmt.Errorf("error reading block file %q: %w", src.FileName, err)
+		}
+		if finfo.Size > MaxDiffFileSize {
+			return nil, fmt.Errorf("block file %q is too large to compare (max %d bytes)", src.FileName, MaxDiffFileSize)
+		}
+		_, data, err := filestore.WFS.ReadFile(ctx, src.ZoneId, src.FileName)
+		if err != nil {
+			return nil, fmt.Errorf("error reading block file %q: %w", src.FileName, err)
+		}
+		return data, nil
+	}
+	if src.Path == "" {
+		return nil, fmt.Errorf("no path to compare")
+	}
+	connection, filePath, _, err := resolveFilePath(src.Connection, src.Path)
+	if err != nil {
+		return nil, err
+	}
+	client := wshserver.GetMainRpcClient()
+	fileInfo, err := wshclient.RemoteFileInfoCommand(client, filePath, &wshrpc.RpcOpts{Route: wshutil.MakeConnectionRouteId(connection)})
+	if err != nil {
+		return nil, err
+	}
+	if fileInfo.NotFound {
+		return nil, fmt.Errorf("file not found: %q", src.Path)
+	}
+	if fileInfo.IsDir {
+		return nil, fmt.Errorf("cannot compare directory %q", src.Path)
+	}
+	if fileInfo.Size > MaxDiffFileSize {
+		return nil, fmt.Errorf("file %q is too large to compare (max %d bytes)", src.Path, MaxDiffFileSize)
+	}
+	if fileInfo.Size == 0 {
+		return nil, nil
+	}
+	return readRemoteRange(connection, filePath, 0, fileInfo.Size, DiffReadTimeout)
+}
+
+func (fs *FileService) DiffFiles_Meta() tsgenmeta.MethodMeta {
+	return tsgenmeta.MethodMeta{
+		Desc:     "compare two files (paths on any connection, or block files), returning line based hunks",
+		ArgNames: []string{"oldsrc", "newsrc", "opts"},
+	}
+}
+
+func (fs *FileService) DiffFiles(oldSrc DiffSource, newSrc DiffSource, opts linediff.DiffOpts) (*FileDiff, error) {
+	oldData, err := readDiffSource(oldSrc)
+	if err != nil {
+		return nil, err
+	}
+	newData, err := readDiffSource(newSrc)
+	if err != nil {
+		return nil, err
+	}
+	rtn := &FileDiff{
+		OldSize:     int64(len(oldData)),
+		NewSize:     int64(len(newData)),
+		OldChecksum: wshremote.ChecksumBytes(oldData),
+		NewChecksum: wshremote.ChecksumBytes(newData),
+		Hunks:       []linediff.DiffHunk{},
+	}
+	rtn.Identical = rtn.OldChecksum == rtn.NewChecksum
+	if isBinaryData(oldData) || isBinaryData(newData) {
+		rtn.Binary = true
+		return rtn, nil
+	}
+	if rtn.Identical {
+		return rtn, nil
+	}
+	result := linediff.Diff(linediff.SplitLines(oldData), linediff.SplitLines(newData), opts)
+	rtn.Hunks = result.Hunks
+	rtn.Added = result.Added
+	rtn.Removed = result.Removed
+	rtn.Approximate = result.Approximate
+	rtn.Truncated = result.Truncated
+	return rtn, nil
+}
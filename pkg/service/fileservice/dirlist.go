@@ -0,0 +1,152 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package fileservice
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshremote"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshserver"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+// directory listings are paginated by the connserver (or the local wshremote impl) and cached
+// here for a few seconds so paging and re-renders don't go back to the remote host.  changes
+// made through the FileService invalidate the connection's cached listings.
+
+const DirListCacheTTL = 10 * time.Second
+const DirListCacheMaxSize = 200
+const DirListTimeout = 10 * time.Second
+
+type dirListCacheEntry struct {
+	Conn string
+	Ts   time.Time
+	Data *wshrpc.RemoteListEntriesRtnData
+}
+
+var dirListCacheLock = &sync.Mutex{}
+var dirListCache = make(map[string]*dirListCacheEntry)
+
+func makeDirListCacheKey(connection string, path string, opts wshrpc.FileListOpts) string {
+	optsBytes, _ := json.Marshal(opts)
+	return connection + "\x00" + path + "\x00" + string(optsBytes)
+}
+
+func getCachedDirList(key string) *wshrpc.RemoteListEntriesRtnData {
+	dirListCacheLock.Lock()
+	defer dirListCacheLock.Unlock()
+	entry := dirListCache[key]
+	if entry == nil || time.Since(entry.Ts) > DirListCacheTTL {
+		return nil
+	}
+	return entry.Data
+}
+
+func setCachedDirList(key string, connection string, data *wshrpc.RemoteListEntriesRtnData) {
+	dirListCacheLock.Lock()
+	defer dirListCacheLock.Unlock()
+	if len(dirListCache) >= DirListCacheMaxSize {
+		for cacheKey, entry := range dirListCache {
+			if time.Since(entry.Ts) > DirListCacheTTL {
+				delete(dirListCache, cacheKey)
+			}
+		}
+		if len(dirListCache) >= DirListCacheMaxSize {
+			dirListCache = make(map[string]*dirListCacheEntry)
+		}
+	}
+	dirListCache[key] = &dirListCacheEntry{Conn: connection, Ts: time.Now(), Data: data}
+}
+
+func invalidateDirListCache(connection string) {
+	if connection == "" {
+		connection = wshrpc.LocalConnName
+	}
+	dirListCacheLock.Lock()
+	defer dirListCacheLock.Unlock()
+	for key, entry := range dirListCache {
+		if entry.Conn == connection {
+			delete(dirListCache, key)
+		}
+	}
+}
+
+func isCommandNotFoundErr(err error, command string) bool {
+	return err != nil && strings.Contains(err.Error(), fmt.Sprintf("command %q not found", command))
+}
+
+// for connservers that predate remotelistentries, read the whole directory and page it here
+func (fs *FileService) listEntriesFallback(connection string, path string, opts wshrpc.FileListOpts) (*wshrpc.RemoteListEntriesRtnData, error) {
+	fullFile, err := fs.ReadFile(connection, path)
+	if err != nil {
+		return nil, err
+	}
+	if !fullFile.Info.IsDir {
+		return nil, fmt.Errorf("%q is not a directory", path)
+	}
+	fiBytes, err := base64.StdEncoding.DecodeString(fullFile.Data64)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding directory listing: %w", err)
+	}
+	var allEntries []*wshrpc.FileInfo
+	err = json.Unmarshal(fiBytes, &allEntries)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding directory listing: %w", err)
+	}
+	rtn := &wshrpc.RemoteListEntriesRtnData{Dir: fullFile.Info, Entries: []*wshrpc.FileInfo{}}
+	var fileInfos []*wshrpc.FileInfo
+	for _, finfo := range allEntries {
+		if finfo.Name == ".." {
+			rtn.Parent = finfo
+			continue
+		}
+		if !opts.All && strings.HasPrefix(finfo.Name, ".") {
+			continue
+		}
+		fileInfos = append(fileInfos, finfo)
+	}
+	wshremote.SortFileInfos(fileInfos, opts)
+	rtn.Total = len(fileInfos)
+	if opts.Limit <= 0 {
+		opts.Limit = wshremote.DefaultDirListLimit
+	}
+	if opts.Offset < len(fileInfos) {
+		endIdx := min(opts.Offset+opts.Limit, len(fileInfos))
+		rtn.Entries = fileInfos[opts.Offset:endIdx]
+		rtn.HasMore = endIdx < len(fileInfos)
+	}
+	return rtn, nil
+}
+
+func (fs *FileService) ListEntries(connection string, path string, opts wshrpc.FileListOpts, refresh bool) (*wshrpc.RemoteListEntriesRtnData, error) {
+	connection, path, mapper, err := resolveFilePath(connection, path)
+	if err != nil {
+		return nil, err
+	}
+	cacheKey := makeDirListCacheKey(connection, path, opts)
+	if !refresh {
+		if cached := getCachedDirList(cacheKey); cached != nil {
+			return mapper.mapListEntries(cached), nil
+		}
+	}
+	connRoute := wshutil.MakeConnectionRouteId(connection)
+	client := wshserver.GetMainRpcClient()
+	data := wshrpc.CommandRemoteListEntriesData{Path: path, Opts: &opts}
+	rtn, err := wshclient.RemoteListEntriesCommand(client, data, &wshrpc.RpcOpts{Route: connRoute, Timeout: int(DirListTimeout.Milliseconds())})
+	if isCommandNotFoundErr(err, wshrpc.Command_RemoteListEntries) {
+		rtn, err = fs.listEntriesFallback(connection, path, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	setCachedDirList(cacheKey, connection, rtn)
+	return mapper.mapListEntries(rtn), nil
+}
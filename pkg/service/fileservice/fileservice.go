@@ -14,6 +14,7 @@ import (
 	"github.com/wavetermdev/waveterm/pkg/wconfig"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshremote"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshserver"
 	"github.com/wavetermdev/waveterm/pkg/wshutil"
 )
@@ -24,25 +25,36 @@ const DefaultTimeout = 2 * time.Second
 type FileService struct{}
 
 type FullFile struct {
-	Info   *wshrpc.FileInfo `json:"info"`
-	Data64 string           `json:"data64"` // base64 encoded
+	Info     *wshrpc.FileInfo `json:"info"`
+	Data64   string           `json:"data64"`             // base64 encoded
+	Checksum string           `json:"checksum,omitempty"` // sha256 of the contents (not set for directories)
 }
 
 func (fs *FileService) SaveFile_Meta() tsgenmeta.MethodMeta {
 	return tsgenmeta.MethodMeta{
-		Desc:     "save file",
-		ArgNames: []string{"connection", "path", "data64"},
+		Desc:     "save file (the file is replaced atomically).  if checksum is set the save fails if the file changed since it was read.  returns the new checksum",
+		ArgNames: []string{"connection", "path", "data64", "checksum"},
 	}
 }
 
-func (fs *FileService) SaveFile(connection string, path string, data64 string) error {
-	if connection == "" {
-		connection = wshrpc.LocalConnName
+func (fs *FileService) SaveFile(connection string, path string, data64 string, checksum string) (string, error) {
+	connection, path, _, err := resolveFilePath(connection, path)
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(data64)
+	if err != nil {
+		return "", fmt.Errorf("cannot decode base64 data: %w", err)
 	}
+	invalidateDirListCache(connection)
 	connRoute := wshutil.MakeConnectionRouteId(connection)
 	client := wshserver.GetMainRpcClient()
-	writeData := wshrpc.CommandRemoteWriteFileData{Path: path, Data64: data64}
-	return wshclient.RemoteWriteFileCommand(client, writeData, &wshrpc.RpcOpts{Route: connRoute})
+	writeData := wshrpc.CommandRemoteWriteFileData{Path: path, Data64: data64, Checksum: checksum}
+	err = wshclient.RemoteWriteFileCommand(client, writeData, &wshrpc.RpcOpts{Route: connRoute})
+	if err != nil {
+		return "", err
+	}
+	return wshremote.ChecksumBytes(data), nil
 }
 
 func (fs *FileService) StatFile_Meta() tsgenmeta.MethodMeta {
@@ -53,41 +65,66 @@ func (fs *FileService) StatFile_Meta() tsgenmeta.MethodMeta {
 }
 
 func (fs *FileService) StatFile(connection string, path string) (*wshrpc.FileInfo, error) {
-	if connection == "" {
-		connection = wshrpc.LocalConnName
+	connection, path, mapper, err := resolveFilePath(connection, path)
+	if err != nil {
+		return nil, err
 	}
 	connRoute := wshutil.MakeConnectionRouteId(connection)
 	client := wshserver.GetMainRpcClient()
-	return wshclient.RemoteFileInfoCommand(client, path, &wshrpc.RpcOpts{Route: connRoute})
+	finfo, err := wshclient.RemoteFileInfoCommand(client, path, &wshrpc.RpcOpts{Route: connRoute})
+	if err != nil {
+		return nil, err
+	}
+	return mapper.mapFileInfo(finfo), nil
 }
 
 func (fs *FileService) Mkdir(connection string, path string) error {
-	if connection == "" {
-		connection = wshrpc.LocalConnName
+	connection, path, _, err := resolveFilePath(connection, path)
+	if err != nil {
+		return err
 	}
+	invalidateDirListCache(connection)
 	connRoute := wshutil.MakeConnectionRouteId(connection)
 	client := wshserver.GetMainRpcClient()
 	return wshclient.RemoteMkdirCommand(client, path, &wshrpc.RpcOpts{Route: connRoute})
 }
 
 func (fs *FileService) TouchFile(connection string, path string) error {
-	if connection == "" {
-		connection = wshrpc.LocalConnName
+	connection, path, _, err := resolveFilePath(connection, path)
+	if err != nil {
+		return err
 	}
+	invalidateDirListCache(connection)
 	connRoute := wshutil.MakeConnectionRouteId(connection)
 	client := wshserver.GetMainRpcClient()
 	return wshclient.RemoteFileTouchCommand(client, path, &wshrpc.RpcOpts{Route: connRoute})
 }
 
 func (fs *FileService) Rename(connection string, path string, newPath string) error {
-	if connection == "" {
-		connection = wshrpc.LocalConnName
+	newConnection, newPath, _, err := resolveFilePath(connection, newPath)
+	if err != nil {
+		return err
 	}
+	connection, path, _, err = resolveFilePath(connection, path)
+	if err != nil {
+		return err
+	}
+	if newConnection != connection {
+		return fmt.Errorf("cannot rename %q to %q (they are on different connections)", path, newPath)
+	}
+	invalidateDirListCache(connection)
 	connRoute := wshutil.MakeConnectionRouteId(connection)
 	client := wshserver.GetMainRpcClient()
 	return wshclient.RemoteFileRenameCommand(client, [2]string{path, newPath}, &wshrpc.RpcOpts{Route: connRoute})
 }
 
+func (fs *FileService) ListEntries_Meta() tsgenmeta.MethodMeta {
+	return tsgenmeta.MethodMeta{
+		Desc:     "list a directory (paginated, cached for a few seconds unless refresh is set)",
+		ArgNames: []string{"connection", "path", "opts", "refresh"},
+	}
+}
+
 func (fs *FileService) ReadFile_Meta() tsgenmeta.MethodMeta {
 	return tsgenmeta.MethodMeta{
 		Desc:     "read file",
@@ -96,8 +133,9 @@ func (fs *FileService) ReadFile_Meta() tsgenmeta.MethodMeta {
 }
 
 func (fs *FileService) ReadFile(connection string, path string) (*FullFile, error) {
-	if connection == "" {
-		connection = wshrpc.LocalConnName
+	connection, path, mapper, err := resolveFilePath(connection, path)
+	if err != nil {
+		return nil, err
 	}
 	connRoute := wshutil.MakeConnectionRouteId(connection)
 	client := wshserver.GetMainRpcClient()
@@ -119,7 +157,7 @@ func (fs *FileService) ReadFile(connection string, path string) (*FullFile, erro
 			if len(resp.FileInfo) != 1 {
 				return nil, fmt.Errorf("stream file protocol error, first pk fileinfo len=%d", len(resp.FileInfo))
 			}
-			fullFile.Info = resp.FileInfo[0]
+			fullFile.Info = mapper.mapFileInfo(resp.FileInfo[0])
 			if fullFile.Info.IsDir {
 				isDir = true
 			}
@@ -129,7 +167,7 @@ func (fs *FileService) ReadFile(connection string, path string) (*FullFile, erro
 			if len(resp.FileInfo) == 0 {
 				continue
 			}
-			fileInfoArr = append(fileInfoArr, resp.FileInfo...)
+			fileInfoArr = append(fileInfoArr, mapper.mapFileInfos(resp.FileInfo)...)
 		} else {
 			if resp.Data64 == "" {
 				continue
@@ -150,6 +188,9 @@ func (fs *FileService) ReadFile(connection string, path string) (*FullFile, erro
 	} else {
 		// we can avoid this re-encoding if we ensure the remote side always encodes chunks of 3 bytes so we don't get padding chars
 		fullFile.Data64 = base64.StdEncoding.EncodeToString(fileBuf.Bytes())
+		if !fullFile.Info.NotFound {
+			fullFile.Checksum = wshremote.ChecksumBytes(fileBuf.Bytes())
+		}
 	}
 	return fullFile, nil
 }
@@ -172,9 +213,11 @@ func (fs *FileService) DeleteFile_Meta() tsgenmeta.MethodMeta {
 }
 
 func (fs *FileService) DeleteFile(connection string, path string) error {
-	if connection == "" {
-		connection = wshrpc.LocalConnName
+	connection, path, _, err := resolveFilePath(connection, path)
+	if err != nil {
+		return err
 	}
+	invalidateDirListCache(connection)
 	connRoute := wshutil.MakeConnectionRouteId(connection)
 	client := wshserver.GetMainRpcClient()
 	return wshclient.RemoteFileDeleteCommand(client, path, &wshrpc.RpcOpts{Route: connRoute})
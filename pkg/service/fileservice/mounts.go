@@ -0,0 +1,89 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package fileservice
+
+import (
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/remote/conncontroller"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// the file apis also take "mount://<name>/<path>" paths (see conncontroller.Mount).  they are
+// resolved to the mount's connection and remote path, and the paths in the results are
+// converted back, so browsing a mount stays inside of it.
+
+type mountMapper struct {
+	prefix string // mount://<name>
+	root   string // the mounted directory on the remote
+}
+
+// returns the connection and path to use, and a mapper for the results (nil if the path isn't
+// in a mount)
+func resolveFilePath(connection string, path string) (string, string, *mountMapper, error) {
+	if connection == "" {
+		connection = wshrpc.LocalConnName
+	}
+	connection, path, mountInfo, err := conncontroller.ResolveMountPath(connection, path)
+	if err != nil || mountInfo == nil {
+		return connection, path, nil, err
+	}
+	return connection, path, &mountMapper{prefix: wshrpc.MountPathPrefix + mountInfo.Name, root: mountInfo.MountPath}, nil
+}
+
+// remote paths outside of the mount (like symlink targets) are left as they are
+func (mm *mountMapper) toMountPath(path string) string {
+	if path == mm.root {
+		return mm.prefix + "/"
+	}
+	if mm.root == "/" && strings.HasPrefix(path, "/") {
+		return mm.prefix + path
+	}
+	if strings.HasPrefix(path, mm.root+"/") {
+		return mm.prefix + strings.TrimPrefix(path, mm.root)
+	}
+	return path
+}
+
+func (mm *mountMapper) isOutside(path string) bool {
+	return mm.toMountPath(path) == path
+}
+
+// returns a copy (results can be cached), the mapper can be nil
+func (mm *mountMapper) mapFileInfo(finfo *wshrpc.FileInfo) *wshrpc.FileInfo {
+	if mm == nil || finfo == nil {
+		return finfo
+	}
+	rtn := *finfo
+	rtn.Path = mm.toMountPath(finfo.Path)
+	rtn.Dir = mm.toMountPath(finfo.Dir)
+	return &rtn
+}
+
+func (mm *mountMapper) mapFileInfos(finfos []*wshrpc.FileInfo) []*wshrpc.FileInfo {
+	if mm == nil {
+		return finfos
+	}
+	rtn := make([]*wshrpc.FileInfo, 0, len(finfos))
+	for _, finfo := range finfos {
+		rtn = append(rtn, mm.mapFileInfo(finfo))
+	}
+	return rtn
+}
+
+func (mm *mountMapper) mapListEntries(data *wshrpc.RemoteListEntriesRtnData) *wshrpc.RemoteListEntriesRtnData {
+	if mm == nil || data == nil {
+		return data
+	}
+	rtn := *data
+	rtn.Dir = mm.mapFileInfo(data.Dir)
+	rtn.Entries = mm.mapFileInfos(data.Entries)
+	// the mount's root has no parent
+	if data.Parent != nil && mm.isOutside(data.Parent.Path) {
+		rtn.Parent = nil
+	} else {
+		rtn.Parent = mm.mapFileInfo(data.Parent)
+	}
+	return &rtn
+}
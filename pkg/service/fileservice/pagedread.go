@@ -0,0 +1,114 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package fileservice
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/tsgen/tsgenmeta"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshserver"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+// paged reads for files too large to load into a preview block: pages of lines for text files,
+// byte ranges for the hex view, and search (run on the connection, next to the file).
+
+const MaxReadRangeSize = 1024 * 1024
+const PagedReadTimeout = 10 * time.Second
+const SearchFileTimeout = 10 * time.Second
+
+func (fs *FileService) ReadLines_Meta() tsgenmeta.MethodMeta {
+	return tsgenmeta.MethodMeta{
+		Desc:     "read a page of lines from a (large) text file",
+		ArgNames: []string{"connection", "path", "startline", "numlines"},
+	}
+}
+
+func (fs *FileService) ReadLines(connection string, path string, startLine int, numLines int) (*wshrpc.RemoteReadLinesRtnData, error) {
+	connection, path, _, err := resolveFilePath(connection, path)
+	if err != nil {
+		return nil, err
+	}
+	connRoute := wshutil.MakeConnectionRouteId(connection)
+	client := wshserver.GetMainRpcClient()
+	data := wshrpc.CommandRemoteReadLinesData{Path: path, StartLine: startLine, NumLines: numLines}
+	return wshclient.RemoteReadLinesCommand(client, data, &wshrpc.RpcOpts{Route: connRoute, Timeout: int(PagedReadTimeout.Milliseconds())})
+}
+
+func (fs *FileService) ReadFileRange_Meta() tsgenmeta.MethodMeta {
+	return tsgenmeta.MethodMeta{
+		Desc:     "read a byte range of a file (base64 encoded, max 1MB)",
+		ArgNames: []string{"connection", "path", "offset", "size"},
+	}
+}
+
+func (fs *FileService) ReadFileRange(connection string, path string, offset int64, size int64) (string, error) {
+	connection, path, _, err := resolveFilePath(connection, path)
+	if err != nil {
+		return "", err
+	}
+	if offset < 0 || size <= 0 || size > MaxReadRangeSize {
+		return "", fmt.Errorf("invalid range %d+%d (max size %d)", offset, size, MaxReadRangeSize)
+	}
+	data, err := readRemoteRange(connection, path, offset, size, PagedReadTimeout)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// reads [offset, offset+size) of a file on a connection (stopping early at the end of the file)
+func readRemoteRange(connection string, path string, offset int64, size int64, timeout time.Duration) ([]byte, error) {
+	connRoute := wshutil.MakeConnectionRouteId(connection)
+	client := wshserver.GetMainRpcClient()
+	streamFileData := wshrpc.CommandRemoteStreamFileData{Path: path, ByteRange: fmt.Sprintf("%d-%d", offset, offset+size)}
+	rtnCh := wshclient.RemoteStreamFileCommand(client, streamFileData, &wshrpc.RpcOpts{Route: connRoute, Timeout: int(timeout.Milliseconds())})
+	var buf bytes.Buffer
+	var rtnErr error
+	for respUnion := range rtnCh {
+		if respUnion.Error != nil {
+			rtnErr = respUnion.Error
+			continue
+		}
+		if len(respUnion.Response.FileInfo) == 1 && respUnion.Response.FileInfo[0].IsDir && rtnErr == nil {
+			rtnErr = fmt.Errorf("%q is a directory", path)
+		}
+		if respUnion.Response.Data64 == "" || rtnErr != nil {
+			continue
+		}
+		decoder := base64.NewDecoder(base64.StdEncoding, strings.NewReader(respUnion.Response.Data64))
+		if _, err := io.Copy(&buf, decoder); err != nil {
+			rtnErr = fmt.Errorf("decoding file data: %w", err)
+		}
+	}
+	if rtnErr != nil {
+		return nil, rtnErr
+	}
+	return buf.Bytes(), nil
+}
+
+func (fs *FileService) SearchFile_Meta() tsgenmeta.MethodMeta {
+	return tsgenmeta.MethodMeta{
+		Desc:     "search a file, returns the matching lines (continue from nextline if it isn't -1)",
+		ArgNames: []string{"connection", "opts"},
+	}
+}
+
+func (fs *FileService) SearchFile(connection string, opts wshrpc.CommandRemoteSearchFileData) (*wshrpc.RemoteSearchFileRtnData, error) {
+	connection, filePath, _, err := resolveFilePath(connection, opts.Path)
+	if err != nil {
+		return nil, err
+	}
+	opts.Path = filePath
+	connRoute := wshutil.MakeConnectionRouteId(connection)
+	client := wshserver.GetMainRpcClient()
+	return wshclient.RemoteSearchFileCommand(client, opts, &wshrpc.RpcOpts{Route: connRoute, Timeout: int(SearchFileTimeout.Milliseconds())})
+}
@@ -11,8 +11,9 @@ type UserInputService struct {
 }
 
 func (uis *UserInputService) SendUserInputResponse(response *userinput.UserInputResponse) {
-	select {
-	case userinput.MainUserInputHandler.Channels[response.RequestId] <- response:
-	default:
-	}
+	userinput.MainUserInputHandler.SendResponse(response)
+}
+
+func (uis *UserInputService) SendNotificationAction(notificationId string) {
+	userinput.MainUserInputHandler.RunNotificationAction(notificationId)
 }
@@ -1,6 +1,7 @@
 package shellexec
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"os/exec"
@@ -225,3 +226,60 @@ func (wcw WslCmdWrap) KillGraceful(timeout time.Duration) {
 func (wcw WslCmdWrap) SetSize(w int, h int) error {
 	return nil
 }
+
+// a shell over a single stream with a tty (an exec in a kubernetes, docker, podman or containerd
+// container, or a telnet session)
+type StreamSession interface {
+	io.ReadWriteCloser
+	Resize(rows int, cols int) error
+	Wait() error
+	ExitCode() int
+}
+
+// a shell over a stream session.  the stream is its pty (stdout and stderr are merged into it), so
+// there are no separate pipes.
+type StreamSessionWrap struct {
+	StreamSession
+	Kind string // "k8s", the container runtime, or "telnet"
+}
+
+func (ssw StreamSessionWrap) Kill() {
+	ssw.StreamSession.Close()
+}
+
+func (ssw StreamSessionWrap) KillGraceful(timeout time.Duration) {
+	ssw.Kill()
+}
+
+// the session was started when the stream was opened
+func (ssw StreamSessionWrap) Start() error {
+	return nil
+}
+
+func (ssw StreamSessionWrap) StdinPipe() (io.WriteCloser, error) {
+	return nil, fmt.Errorf("%s sessions have no separate stdin", ssw.Kind)
+}
+
+func (ssw StreamSessionWrap) StdoutPipe() (io.ReadCloser, error) {
+	return nil, fmt.Errorf("%s sessions have no separate stdout", ssw.Kind)
+}
+
+func (ssw StreamSessionWrap) StderrPipe() (io.ReadCloser, error) {
+	return nil, fmt.Errorf("%s sessions have no separate stderr", ssw.Kind)
+}
+
+func (ssw StreamSessionWrap) SetSize(h int, w int) error {
+	return ssw.StreamSession.Resize(h, w)
+}
+
+func (ssw StreamSessionWrap) Fd() uintptr {
+	return ^uintptr(0)
+}
+
+func (ssw StreamSessionWrap) Name() string {
+	return ssw.Kind + "-stream"
+}
+
+func (ssw StreamSessionWrap) WriteString(s string) (int, error) {
+	return ssw.Write([]byte(s))
+}
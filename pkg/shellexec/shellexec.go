@@ -12,6 +12,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
 	"sync"
@@ -19,15 +20,19 @@ import (
 	"time"
 
 	"github.com/creack/pty"
+	"github.com/wavetermdev/waveterm/pkg/docker"
+	"github.com/wavetermdev/waveterm/pkg/k8s"
 	"github.com/wavetermdev/waveterm/pkg/panichandler"
 	"github.com/wavetermdev/waveterm/pkg/remote"
 	"github.com/wavetermdev/waveterm/pkg/remote/conncontroller"
+	"github.com/wavetermdev/waveterm/pkg/telnet"
 	"github.com/wavetermdev/waveterm/pkg/util/shellutil"
 	"github.com/wavetermdev/waveterm/pkg/util/utilfn"
 	"github.com/wavetermdev/waveterm/pkg/wavebase"
 	"github.com/wavetermdev/waveterm/pkg/waveobj"
 	"github.com/wavetermdev/waveterm/pkg/wshutil"
 	"github.com/wavetermdev/waveterm/pkg/wsl"
+	"golang.org/x/crypto/ssh"
 )
 
 const DefaultGracefulKillWait = 400 * time.Millisecond
@@ -165,7 +170,14 @@ func StartWslShellProc(ctx context.Context, termSize waveobj.TermSize, cmdStr st
 	}
 
 	homeDir := wsl.GetHomeDir(conn.Context, client)
-	shellOpts = append(shellOpts, "~", "-d", client.Name())
+	startDir := cmdOpts.Cwd
+	if startDir == "" {
+		startDir = conn.GetStartDir()
+	}
+	shellOpts = append(shellOpts, "--cd", startDir, "-d", client.Name())
+	if client.User != "" {
+		shellOpts = append(shellOpts, "-u", client.User)
+	}
 
 	var subShellOpts []string
 
@@ -269,6 +281,8 @@ func StartRemoteShellProcNoWsh(termSize waveobj.TermSize, cmdStr string, cmdOpts
 	session.Stdout = remoteStdoutWrite
 	session.Stderr = remoteStdoutWrite
 
+	setupSshSession(session, conn)
+
 	session.RequestPty("xterm-256color", termSize.Rows, termSize.Cols, nil)
 	sessionWrap := MakeSessionWrap(session, "", pipePty)
 	err = session.Shell()
@@ -363,6 +377,7 @@ func StartRemoteShellProc(termSize waveobj.TermSize, cmdStr string, cmdOpts Comm
 	session.Stdout = remoteStdoutWrite
 	session.Stderr = remoteStdoutWrite
 
+	setupSshSession(session, conn)
 	for envKey, envVal := range cmdOpts.Env {
 		// note these might fail depending on server settings, but we still try
 		session.Setenv(envKey, envVal)
@@ -393,6 +408,143 @@ func StartRemoteShellProc(termSize waveobj.TermSize, cmdStr string, cmdOpts Comm
 	return &ShellProc{Cmd: sessionWrap, ConnName: conn.GetName(), CloseOnce: &sync.Once{}, DoneCh: make(chan any)}, nil
 }
 
+// starts mosh-server on the remote (through the ssh connection) and runs the local mosh-client
+// in a pty to talk to it.  the remote shell doesn't get wave's shell integration.
+func StartMoshShellProc(termSize waveobj.TermSize, cmdStr string, cmdOpts CommandOptsType, conn *conncontroller.SSHConn) (*ShellProc, error) {
+	settings := remote.GetMoshSettings(conn.GetName())
+	clientPath, err := exec.LookPath(settings.ClientPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find %s (is mosh installed?): %w", settings.ClientPath, err)
+	}
+	if termSize.Rows == 0 || termSize.Cols == 0 {
+		termSize.Rows = shellutil.DefaultTermRows
+		termSize.Cols = shellutil.DefaultTermCols
+	}
+	if termSize.Rows <= 0 || termSize.Cols <= 0 {
+		return nil, fmt.Errorf("invalid term size: %v", termSize)
+	}
+	moshInfo, err := remote.StartMoshServer(conn.GetClient(), settings.ServerPath, termSize, cmdOpts.Env, cmdStr)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("mosh-server started for %s on %s port %s", conn.GetName(), moshInfo.Host, moshInfo.Port)
+	ecmd := exec.Command(clientPath, moshInfo.Host, moshInfo.Port)
+	ecmd.Env = os.Environ()
+	envToAdd := map[string]string{"MOSH_KEY": moshInfo.Key, "TERM": shellutil.DefaultTermType}
+	if os.Getenv("LANG") == "" {
+		// mosh-client refuses to start without a utf-8 locale
+		envToAdd["LANG"] = wavebase.DetermineLang()
+	}
+	shellutil.UpdateCmdEnv(ecmd, envToAdd)
+	cmdPty, err := pty.StartWithSize(ecmd, &pty.Winsize{Rows: uint16(termSize.Rows), Cols: uint16(termSize.Cols)})
+	if err != nil {
+		return nil, err
+	}
+	cmdWrap := MakeCmdWrap(ecmd, cmdPty)
+	return &ShellProc{Cmd: cmdWrap, ConnName: conn.GetName(), CloseOnce: &sync.Once{}, DoneCh: make(chan any)}, nil
+}
+
+var envVarNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// the shell script that starts the command (or a login shell) in a container (kubernetes, docker,
+// podman or containerd).  the container's shell is not known, so it uses bash if there is one, and
+// sh otherwise.
+func makeContainerStartScript(cmdStr string, cmdOpts CommandOptsType) string {
+	var script strings.Builder
+	if cmdOpts.Cwd != "" {
+		script.WriteString("cd " + utilfn.ShellQuote(cmdOpts.Cwd, false, -1) + " 2>/dev/null; ")
+	}
+	script.WriteString("export TERM=" + shellutil.DefaultTermType + "; ")
+	envKeys := utilfn.GetOrderedMapKeys(cmdOpts.Env)
+	for _, envKey := range envKeys {
+		if !envVarNameRe.MatchString(envKey) {
+			continue
+		}
+		script.WriteString("export " + envKey + "=" + utilfn.ShellQuote(cmdOpts.Env[envKey], false, -1) + "; ")
+	}
+	if cmdStr != "" {
+		script.WriteString(cmdStr)
+		return script.String()
+	}
+	loginOpt := ""
+	if cmdOpts.Login {
+		loginOpt = " -l"
+	}
+	if cmdOpts.ShellPath != "" {
+		script.WriteString("exec " + utilfn.ShellQuote(cmdOpts.ShellPath, false, -1) + loginOpt)
+		return script.String()
+	}
+	script.WriteString("if command -v bash >/dev/null 2>&1; then exec bash" + loginOpt + "; fi; exec sh" + loginOpt)
+	return script.String()
+}
+
+// execs the command (or a shell) in the pod's container, with a tty.  there is no wsh (or shell
+// integration) in the container.
+func StartK8sShellProc(ctx context.Context, termSize waveobj.TermSize, cmdStr string, cmdOpts CommandOptsType, conn *k8s.K8sConn) (*ShellProc, error) {
+	if termSize.Rows == 0 || termSize.Cols == 0 {
+		termSize.Rows = shellutil.DefaultTermRows
+		termSize.Cols = shellutil.DefaultTermCols
+	}
+	if termSize.Rows <= 0 || termSize.Cols <= 0 {
+		return nil, fmt.Errorf("invalid term size: %v", termSize)
+	}
+	command := []string{"/bin/sh", "-c", makeContainerStartScript(cmdStr, cmdOpts)}
+	session, err := conn.StartExec(ctx, command, termSize.Rows, termSize.Cols)
+	if err != nil {
+		return nil, err
+	}
+	return &ShellProc{Cmd: StreamSessionWrap{StreamSession: session, Kind: "k8s"}, ConnName: conn.GetName(), CloseOnce: &sync.Once{}, DoneCh: make(chan any)}, nil
+}
+
+// execs the command (or a shell) in the docker, podman or containerd container, with a tty.  like kubernetes, there is
+// no wsh (or shell integration) in the container.
+func StartContainerShellProc(ctx context.Context, termSize waveobj.TermSize, cmdStr string, cmdOpts CommandOptsType, conn *docker.ContainerConn) (*ShellProc, error) {
+	if termSize.Rows == 0 || termSize.Cols == 0 {
+		termSize.Rows = shellutil.DefaultTermRows
+		termSize.Cols = shellutil.DefaultTermCols
+	}
+	if termSize.Rows <= 0 || termSize.Cols <= 0 {
+		return nil, fmt.Errorf("invalid term size: %v", termSize)
+	}
+	command := []string{"/bin/sh", "-c", makeContainerStartScript(cmdStr, cmdOpts)}
+	session, err := conn.StartExec(ctx, command, termSize.Rows, termSize.Cols)
+	if err != nil {
+		return nil, err
+	}
+	return &ShellProc{Cmd: StreamSessionWrap{StreamSession: session, Kind: conn.Runtime}, ConnName: conn.GetName(), CloseOnce: &sync.Once{}, DoneCh: make(chan any)}, nil
+}
+
+// telnet has no commands, the shell is whatever the host presents (usually a login prompt)
+func StartTelnetShellProc(ctx context.Context, termSize waveobj.TermSize, cmdStr string, conn *telnet.TelnetConn) (*ShellProc, error) {
+	if cmdStr != "" {
+		return nil, fmt.Errorf("cannot run commands on telnet connection %s", conn.GetName())
+	}
+	if termSize.Rows == 0 || termSize.Cols == 0 {
+		termSize.Rows = shellutil.DefaultTermRows
+		termSize.Cols = shellutil.DefaultTermCols
+	}
+	if termSize.Rows <= 0 || termSize.Cols <= 0 {
+		return nil, fmt.Errorf("invalid term size: %v", termSize)
+	}
+	session, err := conn.StartSession(ctx, termSize.Rows, termSize.Cols)
+	if err != nil {
+		return nil, err
+	}
+	return &ShellProc{Cmd: StreamSessionWrap{StreamSession: session, Kind: "telnet"}, ConnName: conn.GetName(), CloseOnce: &sync.Once{}, DoneCh: make(chan any)}, nil
+}
+
+// SendEnv and SetEnv from the ssh config files and connections.json, and X11 forwarding
+// (ForwardX11) which is requested on each shell session
+func setupSshSession(session *ssh.Session, conn *conncontroller.SSHConn) {
+	remote.RequestX11Forwarding(conn.GetClient(), session, conn.GetName(), conn.Opts.SSHHost, conn.Opts.SSHUser)
+	for envKey, envVal := range remote.GetSshSessionEnv(conn.GetName(), conn.Opts.SSHHost, conn.Opts.SSHUser) {
+		// the server only accepts the variables its AcceptEnv allows, others are ignored
+		if err := session.Setenv(envKey, envVal); err != nil {
+			log.Printf("env %s not accepted by %s: %v", envKey, conn.GetName(), err)
+		}
+	}
+}
+
 func isZshShell(shellPath string) bool {
 	// get the base path, and then check contains
 	shellBase := filepath.Base(shellPath)
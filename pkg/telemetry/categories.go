@@ -0,0 +1,80 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package telemetry
+
+import (
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+)
+
+// telemetry is split into categories that can be individually opted in/out of.
+// a category that is not explicitly set follows "telemetry:enabled".
+const (
+	Category_Crashes     = "crashes"     // panics, startup/shutdown counts
+	Category_Usage       = "usage"       // active time, feature usage (views, wsh commands, connections, ai)
+	Category_Performance = "performance" // environment and scale (displays, number of tabs/blocks/windows/workspaces)
+)
+
+var AllCategories = []string{Category_Crashes, Category_Usage, Category_Performance}
+
+func categorySetting(settings wconfig.SettingsType, category string) *bool {
+	switch category {
+	case Category_Crashes:
+		return settings.TelemetryCrashes
+	case Category_Usage:
+		return settings.TelemetryUsage
+	case Category_Performance:
+		return settings.TelemetryPerformance
+	}
+	return nil
+}
+
+func IsCategoryEnabled(category string) bool {
+	settings := wconfig.GetWatcher().GetFullConfig().Settings
+	if val := categorySetting(settings, category); val != nil {
+		return *val
+	}
+	return settings.TelemetryEnabled
+}
+
+func GetEnabledCategories() map[string]bool {
+	rtn := make(map[string]bool)
+	for _, category := range AllCategories {
+		rtn[category] = IsCategoryEnabled(category)
+	}
+	return rtn
+}
+
+// FilterTelemetryData returns a copy of tdata with only the fields belonging to the enabled categories
+func FilterTelemetryData(tdata TelemetryData, enabled map[string]bool) TelemetryData {
+	var rtn TelemetryData
+	if enabled[Category_Crashes] {
+		rtn.NumStartup = tdata.NumStartup
+		rtn.NumShutdown = tdata.NumShutdown
+		rtn.NumPanics = tdata.NumPanics
+	}
+	if enabled[Category_Usage] {
+		rtn.ActiveMinutes = tdata.ActiveMinutes
+		rtn.FgMinutes = tdata.FgMinutes
+		rtn.OpenMinutes = tdata.OpenMinutes
+		rtn.NewTab = tdata.NewTab
+		rtn.NumMagnify = tdata.NumMagnify
+		rtn.NumAIReqs = tdata.NumAIReqs
+		rtn.SetTabTheme = tdata.SetTabTheme
+		rtn.NumSSHConn = tdata.NumSSHConn
+		rtn.NumWSLConn = tdata.NumWSLConn
+		rtn.Renderers = tdata.Renderers
+		rtn.WshCmds = tdata.WshCmds
+		rtn.Conn = tdata.Conn
+	}
+	if enabled[Category_Performance] {
+		rtn.NumTabs = tdata.NumTabs
+		rtn.NumBlocks = tdata.NumBlocks
+		rtn.NumWindows = tdata.NumWindows
+		rtn.NumWS = tdata.NumWS
+		rtn.NumWSNamed = tdata.NumWSNamed
+		rtn.Displays = tdata.Displays
+		rtn.Blocks = tdata.Blocks
+	}
+	return rtn
+}
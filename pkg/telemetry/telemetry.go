@@ -65,9 +65,14 @@ func (tdata *TelemetryData) Scan(val interface{}) error {
 	return dbutil.QuickScanJson(tdata, val)
 }
 
+// IsTelemetryEnabled returns true if any telemetry category is enabled
 func IsTelemetryEnabled() bool {
-	settings := wconfig.GetWatcher().GetFullConfig()
-	return settings.Settings.TelemetryEnabled
+	for _, category := range AllCategories {
+		if IsCategoryEnabled(category) {
+			return true
+		}
+	}
+	return false
 }
 
 func IsAutoUpdateEnabled() bool {
@@ -0,0 +1,332 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package telnet
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/util/shellutil"
+)
+
+// a minimal telnet client (RFC 854).  it offers the window size (NAWS, RFC 1073) and the terminal
+// type (TTYPE, RFC 1091), accepts the server's echo and suppress-go-ahead, and refuses every other
+// option.
+
+const (
+	cmd_SE   = 240
+	cmd_SB   = 250
+	cmd_WILL = 251
+	cmd_WONT = 252
+	cmd_DO   = 253
+	cmd_DONT = 254
+	cmd_IAC  = 255
+)
+
+const (
+	opt_Echo  = 1
+	opt_SGA   = 3
+	opt_TType = 24
+	opt_NAWS  = 31
+)
+
+const (
+	ttype_Is   = 0
+	ttype_Send = 1
+)
+
+// written to the terminal before the session's output
+const InsecureNotice = "\x1b[33m[telnet is not encrypted: everything, including passwords, is sent in the clear]\x1b[0m\r\n"
+
+type Session struct {
+	conn      net.Conn
+	writeLock *sync.Mutex
+	optLock   *sync.Mutex
+	outReader *io.PipeReader
+	outWriter *io.PipeWriter
+	doneCh    chan struct{}
+	waitErr   error // set before doneCh is closed
+	closed    *atomic.Bool
+
+	// guarded by optLock
+	localOpts  map[byte]bool // options we do (the server sent DO)
+	offered    map[byte]bool // options we offered (sent WILL) without an answer yet
+	remoteOpts map[byte]bool // options the server does (we sent DO)
+	rows       int
+	cols       int
+}
+
+// starts a session on conn (offering the window size and terminal type)
+func StartSession(conn net.Conn, rows int, cols int) (*Session, error) {
+	outReader, outWriter := io.Pipe()
+	session := &Session{
+		conn:       conn,
+		writeLock:  &sync.Mutex{},
+		optLock:    &sync.Mutex{},
+		outReader:  outReader,
+		outWriter:  outWriter,
+		doneCh:     make(chan struct{}),
+		closed:     &atomic.Bool{},
+		localOpts:  make(map[byte]bool),
+		offered:    map[byte]bool{opt_NAWS: true, opt_TType: true},
+		remoteOpts: make(map[byte]bool),
+		rows:       rows,
+		cols:       cols,
+	}
+	err := session.writeRaw([]byte{cmd_IAC, cmd_WILL, opt_NAWS, cmd_IAC, cmd_WILL, opt_TType})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go func() {
+		defer panichandler.PanicHandler("telnet:Session:readLoop")
+		session.readLoop()
+	}()
+	return session, nil
+}
+
+func (s *Session) writeRaw(b []byte) error {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	_, err := s.conn.Write(b)
+	return err
+}
+
+// the subnegotiation with its data escaped
+func makeSubneg(opt byte, data []byte) []byte {
+	rtn := []byte{cmd_IAC, cmd_SB, opt}
+	for _, b := range data {
+		rtn = append(rtn, b)
+		if b == cmd_IAC {
+			rtn = append(rtn, cmd_IAC)
+		}
+	}
+	return append(rtn, cmd_IAC, cmd_SE)
+}
+
+func makeNawsSubneg(rows int, cols int) []byte {
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint16(size[0:2], uint16(min(max(cols, 0), 0xffff)))
+	binary.BigEndian.PutUint16(size[2:4], uint16(min(max(rows, 0), 0xffff)))
+	return makeSubneg(opt_NAWS, size)
+}
+
+// the reply to a DO/DONT/WILL/WONT (nil if none is needed).  the state is tracked so that
+// negotiations don't loop.
+func (s *Session) negotiate(verb byte, opt byte) []byte {
+	s.optLock.Lock()
+	defer s.optLock.Unlock()
+	switch verb {
+	case cmd_DO:
+		if opt != opt_NAWS && opt != opt_TType && opt != opt_SGA {
+			return []byte{cmd_IAC, cmd_WONT, opt}
+		}
+		var rtn []byte
+		if !s.localOpts[opt] && !s.offered[opt] {
+			rtn = []byte{cmd_IAC, cmd_WILL, opt}
+		}
+		s.localOpts[opt] = true
+		delete(s.offered, opt)
+		if opt == opt_NAWS {
+			rtn = append(rtn, makeNawsSubneg(s.rows, s.cols)...)
+		}
+		return rtn
+	case cmd_DONT:
+		// a refused offer needs no answer
+		delete(s.offered, opt)
+		if s.localOpts[opt] {
+			delete(s.localOpts, opt)
+			return []byte{cmd_IAC, cmd_WONT, opt}
+		}
+	case cmd_WILL:
+		if opt != opt_Echo && opt != opt_SGA {
+			return []byte{cmd_IAC, cmd_DONT, opt}
+		}
+		if !s.remoteOpts[opt] {
+			s.remoteOpts[opt] = true
+			return []byte{cmd_IAC, cmd_DO, opt}
+		}
+	case cmd_WONT:
+		if s.remoteOpts[opt] {
+			delete(s.remoteOpts, opt)
+			return []byte{cmd_IAC, cmd_DONT, opt}
+		}
+	}
+	return nil
+}
+
+// the reply to a subnegotiation (nil if none is needed)
+func (s *Session) subnegotiate(data []byte) []byte {
+	if len(data) == 2 && data[0] == opt_TType && data[1] == ttype_Send {
+		return makeSubneg(opt_TType, append([]byte{ttype_Is}, shellutil.DefaultTermType...))
+	}
+	return nil
+}
+
+const (
+	state_Data = iota
+	state_CR
+	state_IAC
+	state_Opt
+	state_SB
+	state_SBIAC
+)
+
+func (s *Session) readLoop() {
+	s.outWriter.Write([]byte(InsecureNotice))
+	reader := bufio.NewReader(s.conn)
+	state := state_Data
+	var verb byte
+	var subneg []byte
+	var out []byte
+	var readErr error
+	for readErr == nil {
+		b, err := reader.ReadByte()
+		if err != nil {
+			readErr = err
+			break
+		}
+		var reply []byte
+		switch state {
+		case state_CR:
+			state = state_Data
+			if b == 0 {
+				// CR NUL is a plain CR
+				break
+			}
+			fallthrough
+		case state_Data:
+			if b == cmd_IAC {
+				state = state_IAC
+			} else {
+				out = append(out, b)
+				if b == '\r' {
+					state = state_CR
+				}
+			}
+		case state_IAC:
+			state = state_Data
+			switch b {
+			case cmd_IAC:
+				out = append(out, cmd_IAC)
+			case cmd_DO, cmd_DONT, cmd_WILL, cmd_WONT:
+				verb = b
+				state = state_Opt
+			case cmd_SB:
+				subneg = subneg[:0]
+				state = state_SB
+			}
+		case state_Opt:
+			state = state_Data
+			reply = s.negotiate(verb, b)
+		case state_SB:
+			if b == cmd_IAC {
+				state = state_SBIAC
+			} else {
+				subneg = append(subneg, b)
+			}
+		case state_SBIAC:
+			if b == cmd_IAC {
+				subneg = append(subneg, cmd_IAC)
+				state = state_SB
+			} else {
+				// IAC SE (anything else ends it too)
+				state = state_Data
+				reply = s.subnegotiate(subneg)
+			}
+		}
+		if reply != nil {
+			if err := s.writeRaw(reply); err != nil {
+				readErr = err
+			}
+		}
+		// flush the output when nothing more is buffered
+		if len(out) > 0 && (reader.Buffered() == 0 || len(out) >= 32*1024) {
+			// errors mean the reader was closed, the output is not wanted anymore
+			s.outWriter.Write(out)
+			out = out[:0]
+		}
+	}
+	if len(out) > 0 {
+		s.outWriter.Write(out)
+	}
+	var waitErr error
+	if !errors.Is(readErr, io.EOF) && !s.closed.Load() {
+		waitErr = readErr
+	}
+	s.waitErr = waitErr
+	s.outWriter.Close()
+	close(s.doneCh)
+}
+
+// the output of the session
+func (s *Session) Read(b []byte) (int, error) {
+	return s.outReader.Read(b)
+}
+
+// writes the terminal's input.  IAC is escaped, and a CR (which is what the enter key sends) is
+// sent as a telnet newline (CR LF).
+func (s *Session) Write(b []byte) (int, error) {
+	data := make([]byte, 0, len(b)+8)
+	for idx, c := range b {
+		data = append(data, c)
+		if c == cmd_IAC {
+			data = append(data, cmd_IAC)
+		} else if c == '\r' && (idx+1 >= len(b) || b[idx+1] != '\n') {
+			data = append(data, '\n')
+		}
+	}
+	if err := s.writeRaw(data); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// sends the new window size (if the server asked for it)
+func (s *Session) Resize(rows int, cols int) error {
+	s.optLock.Lock()
+	s.rows = rows
+	s.cols = cols
+	nawsEnabled := s.localOpts[opt_NAWS]
+	s.optLock.Unlock()
+	if !nawsEnabled {
+		return nil
+	}
+	return s.writeRaw(makeNawsSubneg(rows, cols))
+}
+
+func (s *Session) Close() error {
+	if s.closed.Swap(true) {
+		return nil
+	}
+	err := s.conn.Close()
+	s.outReader.Close()
+	return err
+}
+
+// waits for the server to close the connection
+func (s *Session) Wait() error {
+	<-s.doneCh
+	return s.waitErr
+}
+
+// telnet has no exit status: 0 when the server closed the connection, -1 otherwise (or before
+// Wait() has returned)
+func (s *Session) ExitCode() int {
+	select {
+	case <-s.doneCh:
+		if s.waitErr != nil {
+			return -1
+		}
+		return 0
+	default:
+		return -1
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package telnet
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// a session with the server side of its connection, and its output (sent once the session ends)
+func startTestSession(t *testing.T, rows int, cols int) (*Session, net.Conn, chan []byte) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+	clientConn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	serverConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	serverConn.SetDeadline(time.Now().Add(5 * time.Second))
+	t.Cleanup(func() { serverConn.Close() })
+	session, err := StartSession(clientConn, rows, cols)
+	if err != nil {
+		t.Fatalf("StartSession: %v", err)
+	}
+	t.Cleanup(func() { session.Close() })
+	outputCh := make(chan []byte, 1)
+	go func() {
+		output, _ := io.ReadAll(session)
+		outputCh <- output
+	}()
+	return session, serverConn, outputCh
+}
+
+func expectBytes(t *testing.T, conn net.Conn, what string, expected []byte) {
+	t.Helper()
+	buf := make([]byte, len(expected))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("%s: %v", what, err)
+	}
+	if !bytes.Equal(buf, expected) {
+		t.Fatalf("%s: got %v, expected %v", what, buf, expected)
+	}
+}
+
+func TestSessionNegotiation(t *testing.T) {
+	session, server, _ := startTestSession(t, 24, 80)
+	expectBytes(t, server, "offers", []byte{cmd_IAC, cmd_WILL, opt_NAWS, cmd_IAC, cmd_WILL, opt_TType})
+
+	// an accepted offer is not confirmed again, the window size follows
+	server.Write([]byte{cmd_IAC, cmd_DO, opt_NAWS})
+	expectBytes(t, server, "naws", []byte{cmd_IAC, cmd_SB, opt_NAWS, 0, 80, 0, 24, cmd_IAC, cmd_SE})
+	server.Write([]byte{cmd_IAC, cmd_DO, 39})
+	expectBytes(t, server, "refused option", []byte{cmd_IAC, cmd_WONT, 39})
+	server.Write([]byte{cmd_IAC, cmd_WILL, opt_Echo})
+	expectBytes(t, server, "echo", []byte{cmd_IAC, cmd_DO, opt_Echo})
+	server.Write([]byte{cmd_IAC, cmd_DO, opt_TType, cmd_IAC, cmd_SB, opt_TType, ttype_Send, cmd_IAC, cmd_SE})
+	expectBytes(t, server, "ttype", append(append([]byte{cmd_IAC, cmd_SB, opt_TType, ttype_Is}, "xterm-256color"...), cmd_IAC, cmd_SE))
+
+	if err := session.Resize(30, 300); err != nil {
+		t.Fatalf("Resize: %v", err)
+	}
+	expectBytes(t, server, "resize", []byte{cmd_IAC, cmd_SB, opt_NAWS, 1, 44, 0, 30, cmd_IAC, cmd_SE})
+	if _, err := session.Write([]byte("a\xff\r")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	expectBytes(t, server, "input", []byte("a\xff\xff\r\n"))
+}
+
+func TestSessionOutput(t *testing.T) {
+	session, server, outputCh := startTestSession(t, 24, 80)
+	expectBytes(t, server, "offers", []byte{cmd_IAC, cmd_WILL, opt_NAWS, cmd_IAC, cmd_WILL, opt_TType})
+	server.Write([]byte("login:\r\x00\xff\xff\xff\xfb\x03ok\r\n"))
+	expectBytes(t, server, "sga", []byte{cmd_IAC, cmd_DO, opt_SGA})
+	server.Close()
+	output := <-outputCh
+	if expected := InsecureNotice + "login:\r\xffok\r\n"; string(output) != expected {
+		t.Errorf("output %q, expected %q", output, expected)
+	}
+	if err := session.Wait(); err != nil || session.ExitCode() != 0 {
+		t.Errorf("Wait: %v, exit code %d", err, session.ExitCode())
+	}
+}
+
+func TestParseTelnetAddr(t *testing.T) {
+	tests := map[string]string{
+		"router":         "router:23",
+		"router:2323":    "router:2323",
+		"10.0.0.1":       "10.0.0.1:23",
+		"[fe80::1]":      "[fe80::1]:23",
+		"[fe80::1]:2323": "[fe80::1]:2323",
+		"":               "",
+		"router:0":       "",
+		"user@router":    "",
+	}
+	for name, expected := range tests {
+		addr, err := ParseTelnetAddr(name)
+		if expected == "" {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %q", name, addr)
+			}
+			continue
+		}
+		if err != nil || addr != expected {
+			t.Errorf("%q: got %q (%v), expected %q", name, addr, err, expected)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// telnet connections (telnet://host[:port]), for devices that only speak telnet.  nothing is
+// encrypted, so these connections are labeled as insecure.  connecting checks that the host
+// accepts connections, and each shell is a new telnet session.  there is no wsh, and no commands
+// (the host's login prompt is the shell).
+package telnet
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/telemetry"
+	"github.com/wavetermdev/waveterm/pkg/wps"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const ConnPrefix = "telnet://"
+const DefaultPort = 23
+const DialTimeout = 10 * time.Second
+
+const (
+	Status_Init         = "init"
+	Status_Connecting   = "connecting"
+	Status_Connected    = "connected"
+	Status_Disconnected = "disconnected"
+	Status_Error        = "error"
+)
+
+var globalLock = &sync.Mutex{}
+var clientControllerMap = make(map[string]*TelnetConn)
+var activeConnCounter = &atomic.Int32{}
+
+type TelnetConn struct {
+	Lock            *sync.Mutex
+	Status          string
+	Name            string // host[:port], as given
+	Addr            string // host:port
+	Error           string
+	LastConnectTime int64
+	ActiveConnNum   int
+}
+
+func IsTelnetConnName(connName string) bool {
+	return strings.HasPrefix(connName, ConnPrefix)
+}
+
+// parses "host[:port]" (without the telnet:// prefix) into host:port
+func ParseTelnetAddr(name string) (string, error) {
+	host, portStr, err := net.SplitHostPort(name)
+	if err != nil {
+		// no port (a bare ipv6 address has to be in brackets)
+		host = strings.TrimSuffix(strings.TrimPrefix(name, "["), "]")
+		portStr = strconv.Itoa(DefaultPort)
+	}
+	port, portErr := strconv.Atoi(portStr)
+	if host == "" || strings.ContainsAny(host, "/@ ") || portErr != nil || port <= 0 || port > 65535 {
+		return "", fmt.Errorf("invalid telnet connection %q (expected host[:port])", name)
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
+
+func GetAllConnStatus() []wshrpc.ConnStatus {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+
+	var connStatuses []wshrpc.ConnStatus
+	for _, conn := range clientControllerMap {
+		connStatuses = append(connStatuses, conn.DeriveConnStatus())
+	}
+	return connStatuses
+}
+
+func (conn *TelnetConn) DeriveConnStatus() wshrpc.ConnStatus {
+	conn.Lock.Lock()
+	defer conn.Lock.Unlock()
+	return wshrpc.ConnStatus{
+		Status:        conn.Status,
+		Connected:     conn.Status == Status_Connected,
+		WshEnabled:    false,
+		Connection:    conn.GetName(),
+		HasConnected:  (conn.LastConnectTime > 0),
+		ActiveConnNum: conn.ActiveConnNum,
+		Error:         conn.Error,
+		Insecure:      true,
+	}
+}
+
+func (conn *TelnetConn) FireConnChangeEvent() {
+	status := conn.DeriveConnStatus()
+	event := wps.WaveEvent{
+		Event: wps.Event_ConnChange,
+		Scopes: []string{
+			fmt.Sprintf("connection:%s", conn.GetName()),
+		},
+		Data: status,
+	}
+	log.Printf("sending event: %+#v", event)
+	wps.Broker.Publish(event)
+}
+
+func (conn *TelnetConn) GetName() string {
+	// no lock required because the name is immutable
+	return ConnPrefix + conn.Name
+}
+
+func (conn *TelnetConn) GetStatus() string {
+	conn.Lock.Lock()
+	defer conn.Lock.Unlock()
+	return conn.Status
+}
+
+func (conn *TelnetConn) WithLock(fn func()) {
+	conn.Lock.Lock()
+	defer conn.Lock.Unlock()
+	fn()
+}
+
+// running sessions are not closed (they are separate connections), but new ones need a reconnect
+func (conn *TelnetConn) Close() error {
+	defer conn.FireConnChangeEvent()
+	conn.WithLock(func() {
+		if conn.Status == Status_Connected || conn.Status == Status_Connecting {
+			conn.Status = Status_Disconnected
+		}
+	})
+	return nil
+}
+
+func (conn *TelnetConn) Connect(ctx context.Context) error {
+	var connectAllowed bool
+	conn.WithLock(func() {
+		if conn.Status == Status_Connecting || conn.Status == Status_Connected {
+			connectAllowed = false
+		} else {
+			conn.Status = Status_Connecting
+			conn.Error = ""
+			connectAllowed = true
+		}
+	})
+	log.Printf("Connect %s\n", conn.GetName())
+	if !connectAllowed {
+		return fmt.Errorf("cannot connect to %q when status is %q", conn.GetName(), conn.GetStatus())
+	}
+	conn.FireConnChangeEvent()
+	// checks that the host accepts connections (the session starts with the shell)
+	netConn, err := conn.dial(ctx)
+	if err == nil {
+		netConn.Close()
+	}
+	conn.WithLock(func() {
+		if err != nil {
+			conn.Status = Status_Error
+			conn.Error = err.Error()
+			telemetry.GoUpdateActivityWrap(wshrpc.ActivityUpdate{
+				Conn: map[string]int{"telnet:connecterror": 1},
+			}, "telnet-connconnect")
+		} else {
+			conn.Status = Status_Connected
+			conn.LastConnectTime = time.Now().UnixMilli()
+			if conn.ActiveConnNum == 0 {
+				conn.ActiveConnNum = int(activeConnCounter.Add(1))
+			}
+			telemetry.GoUpdateActivityWrap(wshrpc.ActivityUpdate{
+				Conn: map[string]int{"telnet:connect": 1},
+			}, "telnet-connconnect")
+		}
+	})
+	conn.FireConnChangeEvent()
+	return err
+}
+
+func (conn *TelnetConn) dial(ctx context.Context) (net.Conn, error) {
+	ctx, cancelFn := context.WithTimeout(ctx, DialTimeout)
+	defer cancelFn()
+	d := net.Dialer{}
+	return d.DialContext(ctx, "tcp", conn.Addr)
+}
+
+func (conn *TelnetConn) WaitForConnect(ctx context.Context) error {
+	for {
+		status := conn.DeriveConnStatus()
+		switch status.Status {
+		case Status_Connected:
+			return nil
+		case Status_Connecting:
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("context timeout")
+			case <-time.After(100 * time.Millisecond):
+			}
+		case Status_Error:
+			return fmt.Errorf("error: %v", status.Error)
+		default:
+			return fmt.Errorf("disconnected")
+		}
+	}
+}
+
+// opens a new telnet session with a terminal of the given size
+func (conn *TelnetConn) StartSession(ctx context.Context, rows int, cols int) (*Session, error) {
+	if conn.GetStatus() != Status_Connected {
+		return nil, fmt.Errorf("not connected")
+	}
+	netConn, err := conn.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return StartSession(netConn, rows, cols)
+}
+
+func getConnInternal(name string, addr string) *TelnetConn {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+	rtn := clientControllerMap[name]
+	if rtn == nil {
+		rtn = &TelnetConn{Lock: &sync.Mutex{}, Status: Status_Init, Name: name, Addr: addr}
+		clientControllerMap[name] = rtn
+	}
+	return rtn
+}
+
+// gets the connection for a telnet:// connection name
+func GetTelnetConn(ctx context.Context, connName string, shouldConnect bool) (*TelnetConn, error) {
+	name := strings.TrimPrefix(connName, ConnPrefix)
+	addr, err := ParseTelnetAddr(name)
+	if err != nil {
+		return nil, err
+	}
+	conn := getConnInternal(name, addr)
+	if shouldConnect && conn.GetStatus() != Status_Connected {
+		conn.Connect(ctx)
+	}
+	return conn, nil
+}
+
+// Convenience function for ensuring a connection is established
+func EnsureConnection(ctx context.Context, connName string) error {
+	conn, err := GetTelnetConn(ctx, connName, false)
+	if err != nil {
+		return err
+	}
+	connStatus := conn.DeriveConnStatus()
+	switch connStatus.Status {
+	case Status_Connected:
+		return nil
+	case Status_Connecting:
+		return conn.WaitForConnect(ctx)
+	case Status_Init, Status_Disconnected:
+		return conn.Connect(ctx)
+	case Status_Error:
+		return fmt.Errorf("connection error: %s", connStatus.Error)
+	default:
+		return fmt.Errorf("unknown connection status %q", connStatus.Status)
+	}
+}
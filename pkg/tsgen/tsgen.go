@@ -42,6 +42,7 @@ var ExtraTypes = []any{
 	wshutil.RpcMessage{},
 	wshrpc.WshServerCommandMeta{},
 	userinput.UserInputRequest{},
+	userinput.UserNotification{},
 	vdom.VDomCreateContext{},
 	vdom.VDomElem{},
 	vdom.VDomFunc{},
@@ -0,0 +1,170 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// local-only usage statistics (commands per connection, time per workspace, most
+// used blocks).  stats are kept per day in the db_usagestats table and are never
+// uploaded (they are separate from telemetry).
+package usagestats
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/util/daystr"
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wstore"
+)
+
+const (
+	Stat_ActiveMinutes    = "activeminutes"    // key is ""
+	Stat_WorkspaceMinutes = "workspaceminutes" // key is the workspace id (minutes in the foreground)
+	Stat_ConnCommands     = "conncommands"     // key is the connection, counts commands entered in terminals
+	Stat_ConnSessions     = "connsessions"     // key is the connection, counts shells/commands started
+	Stat_BlocksCreated    = "blockscreated"    // key is the block view
+
+	// ai stats, key is "provider|profile" (see waveai.AiUsageKey)
+	Stat_AiRequests         = "airequests"
+	Stat_AiPromptTokens     = "aiprompttokens"
+	Stat_AiCompletionTokens = "aicompletiontokens"
+)
+
+const LocalConnKey = "local"
+const DefaultDays = 365
+const MaxEntries = 10
+
+func ConnKey(connName string) string {
+	if connName == "" {
+		return LocalConnKey
+	}
+	return connName
+}
+
+func Add(ctx context.Context, statType string, key string, value int64) error {
+	return wstore.WithTx(ctx, func(tx *wstore.TxWrap) error {
+		query := `INSERT INTO db_usagestats (day, stattype, statkey, value) VALUES (?, ?, ?, ?)
+		          ON CONFLICT (day, stattype, statkey) DO UPDATE SET value = value + excluded.value`
+		tx.Exec(query, daystr.GetCurDayStr(), statType, key, value)
+		return nil
+	})
+}
+
+// GoAdd wraps Add, runs it in a goroutine, and logs errors
+func GoAdd(statType string, key string, value int64) {
+	go func() {
+		defer panichandler.PanicHandler("usagestats.GoAdd")
+		ctx, cancelFn := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancelFn()
+		err := Add(ctx, statType, key, value)
+		if err != nil {
+			log.Printf("error updating usage stats (%s): %v\n", statType, err)
+		}
+	}()
+}
+
+func Clear(ctx context.Context) error {
+	return wstore.WithTx(ctx, func(tx *wstore.TxWrap) error {
+		tx.Exec(`DELETE FROM db_usagestats`)
+		return nil
+	})
+}
+
+type statRow struct {
+	Day      string
+	StatType string
+	StatKey  string
+	Value    int64
+}
+
+func sortedEntries(totals map[string]int64) []wshrpc.UsageStatEntry {
+	var rtn []wshrpc.UsageStatEntry
+	for key, value := range totals {
+		rtn = append(rtn, wshrpc.UsageStatEntry{Key: key, Name: key, Value: value})
+	}
+	sort.Slice(rtn, func(i, j int) bool {
+		if rtn[i].Value != rtn[j].Value {
+			return rtn[i].Value > rtn[j].Value
+		}
+		return rtn[i].Key < rtn[j].Key
+	})
+	if len(rtn) > MaxEntries {
+		rtn = rtn[:MaxEntries]
+	}
+	return rtn
+}
+
+// GetTotals returns the totals per key of one stat type since sinceDay (inclusive)
+func GetTotals(ctx context.Context, statType string, sinceDay string) (map[string]int64, error) {
+	rows, err := wstore.WithTxRtn(ctx, func(tx *wstore.TxWrap) ([]statRow, error) {
+		var rows []statRow
+		tx.Select(&rows, `SELECT day, stattype, statkey, value FROM db_usagestats WHERE stattype = ? AND day >= ?`, statType, sinceDay)
+		return rows, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading usage stats: %w", err)
+	}
+	rtn := make(map[string]int64)
+	for _, row := range rows {
+		rtn[row.StatKey] += row.Value
+	}
+	return rtn, nil
+}
+
+// GetSummary returns the totals for the last "days" days (including today)
+func GetSummary(ctx context.Context, days int) (*wshrpc.UsageStatsSummary, error) {
+	if days <= 0 {
+		days = DefaultDays
+	}
+	sinceDay := daystr.GetRelDayStr(-(days - 1))
+	rows, err := wstore.WithTxRtn(ctx, func(tx *wstore.TxWrap) ([]statRow, error) {
+		var rows []statRow
+		tx.Select(&rows, `SELECT day, stattype, statkey, value FROM db_usagestats WHERE day >= ?`, sinceDay)
+		return rows, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading usage stats: %w", err)
+	}
+	totals := make(map[string]map[string]int64)
+	dayMinutes := make(map[string]int64)
+	for _, row := range rows {
+		if totals[row.StatType] == nil {
+			totals[row.StatType] = make(map[string]int64)
+		}
+		totals[row.StatType][row.StatKey] += row.Value
+		if row.StatType == Stat_ActiveMinutes {
+			dayMinutes[row.Day] += row.Value
+		}
+	}
+	rtn := &wshrpc.UsageStatsSummary{
+		SinceDay:      sinceDay,
+		Days:          days,
+		DaysActive:    len(dayMinutes),
+		ActiveMinutes: totals[Stat_ActiveMinutes][""],
+		Connections:   sortedEntries(totals[Stat_ConnCommands]),
+		ConnSessions:  sortedEntries(totals[Stat_ConnSessions]),
+		Workspaces:    sortedEntries(totals[Stat_WorkspaceMinutes]),
+		Blocks:        sortedEntries(totals[Stat_BlocksCreated]),
+	}
+	for day, minutes := range dayMinutes {
+		if minutes > rtn.BusiestDayMinutes || (minutes == rtn.BusiestDayMinutes && day < rtn.BusiestDay) {
+			rtn.BusiestDay = day
+			rtn.BusiestDayMinutes = minutes
+		}
+	}
+	for idx := range rtn.Workspaces {
+		entry := &rtn.Workspaces[idx]
+		ws, _ := wstore.DBGet[*waveobj.Workspace](ctx, entry.Key)
+		if ws == nil {
+			entry.Name = "(deleted workspace)"
+		} else if ws.Name != "" {
+			entry.Name = ws.Name
+		} else {
+			entry.Name = "(unnamed workspace)"
+		}
+	}
+	return rtn, nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package userinput
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/wps"
+)
+
+const (
+	Severity_Info    = "info"
+	Severity_Warning = "warning"
+	Severity_Error   = "error"
+)
+
+const DefaultNotificationTimeout = 5 * time.Second
+
+// action callbacks for notifications that never expire are dropped after this
+// long so they can't accumulate forever
+const MaxNotificationActionLifetime = time.Hour
+
+// a non-blocking toast.  unlike a UserInputRequest nothing waits on it, the
+// only thing reported back is a click on the (optional) action button.
+type UserNotification struct {
+	NotificationId string `json:"notificationid"`
+	Title          string `json:"title"`
+	Message        string `json:"message,omitempty"`
+	Severity       string `json:"severity,omitempty"`
+	TimeoutMs      int    `json:"timeoutms,omitempty"` // 0 means the notification stays until dismissed
+	ActionLabel    string `json:"actionlabel,omitempty"`
+	WindowId       string `json:"windowid,omitempty"`
+	TabId          string `json:"tabid,omitempty"`
+	BlockId        string `json:"blockid,omitempty"`
+}
+
+// SendNotification shows a toast and returns immediately.  if onAction is set
+// (along with ActionLabel), it is run when the user clicks the action button.
+func SendNotification(notification *UserNotification, onAction func()) string {
+	if notification.NotificationId == "" {
+		notification.NotificationId = uuid.New().String()
+	}
+	if notification.Severity == "" {
+		notification.Severity = Severity_Info
+	}
+	if onAction != nil && notification.ActionLabel != "" {
+		MainUserInputHandler.registerAction(notification, onAction)
+	}
+	route := &InputRoute{WindowId: notification.WindowId, TabId: notification.TabId, BlockId: notification.BlockId}
+	notification.WindowId = route.resolveWindowId()
+	wps.Broker.Publish(wps.WaveEvent{
+		Event:  wps.Event_UserNotification,
+		Scopes: makeWindowScopes(notification.WindowId),
+		Data:   notification,
+	})
+	return notification.NotificationId
+}
+
+// convenience wrapper for a plain informational toast with the default timeout
+func SendInfoNotification(title string, message string) {
+	SendNotification(&UserNotification{
+		Title:     title,
+		Message:   message,
+		Severity:  Severity_Info,
+		TimeoutMs: int(DefaultNotificationTimeout.Milliseconds()),
+	}, nil)
+}
+
+func (ui *UserInputHandler) registerAction(notification *UserNotification, onAction func()) {
+	ui.Lock.Lock()
+	defer ui.Lock.Unlock()
+	notificationId := notification.NotificationId
+	ui.Actions[notificationId] = onAction
+	lifetime := MaxNotificationActionLifetime
+	if notification.TimeoutMs > 0 {
+		// leave some slack, the frontend keeps hovered notifications open
+		lifetime = time.Duration(notification.TimeoutMs)*time.Millisecond + time.Minute
+	}
+	time.AfterFunc(lifetime, func() {
+		ui.Lock.Lock()
+		defer ui.Lock.Unlock()
+		delete(ui.Actions, notificationId)
+	})
+}
+
+// runs (at most once) the action callback registered for the notification
+func (ui *UserInputHandler) RunNotificationAction(notificationId string) {
+	ui.Lock.Lock()
+	onAction := ui.Actions[notificationId]
+	delete(ui.Actions, notificationId)
+	ui.Lock.Unlock()
+	if onAction == nil {
+		return
+	}
+	go func() {
+		defer panichandler.PanicHandler("userinput:RunNotificationAction")
+		onAction()
+	}()
+}
@@ -0,0 +1,48 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package userinput
+
+import (
+	"fmt"
+	"strings"
+)
+
+// options for the "otp" response type.  when NumDigits is set the frontend
+// shows one box per digit (a pasted code is split across the boxes).  when
+// Period is set, it also counts down to the next rotation of a time-based code.
+// NumDigits of 0 accepts free-form codes (e.g. Duo's "passcode or option").
+type OtpOpts struct {
+	NumDigits int `json:"numdigits,omitempty"`
+	Period    int `json:"period,omitempty"` // seconds per code (30 for most authenticator apps)
+}
+
+// strips the separators people commonly paste with a code ("123 456", "123-456")
+func NormalizeOtp(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' || r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, text)
+}
+
+func validateOtpResponse(request *UserInputRequest, response *UserInputResponse) error {
+	response.Text = NormalizeOtp(response.Text)
+	if response.Text == "" {
+		return fmt.Errorf("no code entered")
+	}
+	opts := request.OtpOpts
+	if opts == nil || opts.NumDigits <= 0 {
+		return nil
+	}
+	if len(response.Text) != opts.NumDigits {
+		return fmt.Errorf("code must be %d digits", opts.NumDigits)
+	}
+	for _, ch := range response.Text {
+		if ch < '0' || ch > '9' {
+			return fmt.Errorf("code must only contain digits")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package userinput
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+)
+
+const (
+	PromptType_Passphrase     = "passphrase"
+	PromptType_Password       = "password"
+	PromptType_KbdInteractive = "kbdinteractive"
+	PromptType_HostKey        = "hostkey"
+	PromptType_SecurityKey    = "securitykey" // waiting for a security key touch
+)
+
+const DefaultPromptTimeout = 60 * time.Second
+const ExtendPromptTimeout = 30 * time.Second
+
+// returns the configured timeout for the given prompt type.
+// a per-type setting overrides userinput:timeoutms, and a value of 0 means no timeout
+func GetPromptTimeout(promptType string) time.Duration {
+	watcher := wconfig.GetWatcher()
+	if watcher == nil {
+		return DefaultPromptTimeout
+	}
+	settings := watcher.GetFullConfig().Settings
+	var timeoutMs *int64
+	switch promptType {
+	case PromptType_Passphrase:
+		timeoutMs = settings.UserInputPassphraseTimeoutMs
+	case PromptType_Password:
+		timeoutMs = settings.UserInputPasswordTimeoutMs
+	case PromptType_KbdInteractive:
+		timeoutMs = settings.UserInputKbdInteractiveTimeoutMs
+	case PromptType_HostKey:
+		timeoutMs = settings.UserInputHostKeyTimeoutMs
+	case PromptType_SecurityKey:
+		timeoutMs = settings.UserInputSecurityKeyTimeoutMs
+	}
+	if timeoutMs == nil {
+		timeoutMs = settings.UserInputTimeoutMs
+	}
+	if timeoutMs == nil {
+		return DefaultPromptTimeout
+	}
+	if *timeoutMs <= 0 {
+		return 0
+	}
+	return time.Duration(*timeoutMs) * time.Millisecond
+}
+
+func isExtendPromptEnabled() bool {
+	watcher := wconfig.GetWatcher()
+	if watcher == nil {
+		return true
+	}
+	extendPrompt := watcher.GetFullConfig().Settings.UserInputExtendPrompt
+	return extendPrompt == nil || *extendPrompt
+}
+
+func askStillThere(parentCtx context.Context, request *UserInputRequest) bool {
+	queryText := fmt.Sprintf("The prompt **%s** is still waiting for a response.\n\n"+
+		"Would you like more time to answer it?", request.Title)
+	extendRequest := &UserInputRequest{
+		ResponseType: ResponseType_Confirm,
+		QueryText:    queryText,
+		Markdown:     true,
+		Title:        "Still There?",
+		OkLabel:      "Extend",
+		CancelLabel:  "Cancel",
+	}
+	ctx, cancelFn := context.WithTimeout(parentCtx, ExtendPromptTimeout)
+	defer cancelFn()
+	resp, err := GetUserInput(ctx, extendRequest)
+	if err != nil {
+		return false
+	}
+	return resp.Confirm
+}
+
+// GetTimedUserInput sends a request using the timeout configured for promptType
+// (measured from when the prompt is shown, not while it is queued).
+// if the prompt times out (and userinput:extendprompt is not disabled), the user
+// gets a short "still there?" prompt, and confirming it re-sends the original
+// request with a fresh timeout.  parentCtx cancellation is always respected.
+func GetTimedUserInput(parentCtx context.Context, promptType string, request *UserInputRequest) (*UserInputResponse, error) {
+	for {
+		resp, err := getUserInputQueued(parentCtx, promptType, request, GetPromptTimeout(promptType))
+		if !errors.Is(err, ErrUserInputTimeout) || parentCtx.Err() != nil {
+			return resp, err
+		}
+		if !isExtendPromptEnabled() || !askStillThere(parentCtx, request) {
+			return nil, err
+		}
+	}
+}
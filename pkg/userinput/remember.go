@@ -0,0 +1,124 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package userinput
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+	"github.com/wavetermdev/waveterm/pkg/wlog"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const RememberCheckboxMsg = "Remember my answer"
+
+// key in connections.json (see wshrpc.ConnKeywords.ConnRememberedAnswers)
+const connKey_RememberedAnswers = "conn:rememberedanswers"
+
+// answers are only remembered for confirms and public text.  secrets, passwords,
+// and one-time codes are never written to connections.json
+func isRememberable(request *UserInputRequest) bool {
+	if request.RememberKey == "" || request.RememberConn == "" {
+		return false
+	}
+	switch request.ResponseType {
+	case ResponseType_Confirm:
+		return true
+	case ResponseType_Text:
+		return request.PublicText
+	}
+	return false
+}
+
+func getRememberedAnswers(connName string) map[string]string {
+	watcher := wconfig.GetWatcher()
+	if watcher == nil {
+		return nil
+	}
+	return watcher.GetFullConfig().Connections[connName].ConnRememberedAnswers
+}
+
+// returns a response built from a previously remembered answer (nil if there isn't one)
+func getRememberedResponse(request *UserInputRequest) *UserInputResponse {
+	if !isRememberable(request) {
+		return nil
+	}
+	answer, ok := getRememberedAnswers(request.RememberConn)[request.RememberKey]
+	if !ok {
+		return nil
+	}
+	response := &UserInputResponse{Type: "userinputresp", RequestId: request.RequestId}
+	if request.ResponseType == ResponseType_Confirm {
+		confirm, err := strconv.ParseBool(answer)
+		if err != nil {
+			inputLog.Warn("invalid remembered answer", wlog.ConnAttr(request.RememberConn), "key", request.RememberKey, "answer", answer)
+			return nil
+		}
+		response.Confirm = confirm
+	} else {
+		response.Text = answer
+	}
+	return response
+}
+
+func rememberResponse(request *UserInputRequest, response *UserInputResponse) {
+	if !isRememberable(request) || !response.CheckboxStat || response.ErrorMsg != "" {
+		return
+	}
+	answer := response.Text
+	if request.ResponseType == ResponseType_Confirm {
+		answer = strconv.FormatBool(response.Confirm)
+	}
+	answers := make(map[string]string)
+	for key, val := range getRememberedAnswers(request.RememberConn) {
+		answers[key] = val
+	}
+	answers[request.RememberKey] = answer
+	err := wconfig.SetConnectionsConfigValue(request.RememberConn, map[string]any{connKey_RememberedAnswers: answers})
+	if err != nil {
+		inputLog.Error("error remembering answer", wlog.ConnAttr(request.RememberConn), "key", request.RememberKey, "err", err)
+	}
+}
+
+// ListRememberedAnswers returns the remembered answers for connName (or for every connection if connName is empty)
+func ListRememberedAnswers(connName string) []wshrpc.RememberedAnswer {
+	var rtn []wshrpc.RememberedAnswer
+	for name, keywords := range wconfig.GetWatcher().GetFullConfig().Connections {
+		if connName != "" && name != connName {
+			continue
+		}
+		for key, answer := range keywords.ConnRememberedAnswers {
+			rtn = append(rtn, wshrpc.RememberedAnswer{Connection: name, Key: key, Answer: answer})
+		}
+	}
+	sort.Slice(rtn, func(i, j int) bool {
+		if rtn[i].Connection != rtn[j].Connection {
+			return rtn[i].Connection < rtn[j].Connection
+		}
+		return rtn[i].Key < rtn[j].Key
+	})
+	return rtn
+}
+
+// ClearRememberedAnswers forgets a single remembered answer, or all of them for the connection if key is empty
+func ClearRememberedAnswers(connName string, key string) error {
+	if connName == "" {
+		return fmt.Errorf("no connection specified")
+	}
+	if key == "" {
+		return wconfig.SetConnectionsConfigValue(connName, map[string]any{connKey_RememberedAnswers: nil})
+	}
+	answers := make(map[string]string)
+	for k, val := range getRememberedAnswers(connName) {
+		if k != key {
+			answers[k] = val
+		}
+	}
+	if len(answers) == 0 {
+		return wconfig.SetConnectionsConfigValue(connName, map[string]any{connKey_RememberedAnswers: nil})
+	}
+	return wconfig.SetConnectionsConfigValue(connName, map[string]any{connKey_RememberedAnswers: answers})
+}
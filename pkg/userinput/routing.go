@@ -0,0 +1,140 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package userinput
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wlog"
+	"github.com/wavetermdev/waveterm/pkg/wstore"
+)
+
+const routeResolveTimeout = 2 * time.Second
+
+// describes what triggered a prompt, so it can be shown in the right window.
+// the most specific field wins: WindowId, then BlockId, then TabId.
+type InputRoute struct {
+	WindowId string `json:"windowid,omitempty"`
+	TabId    string `json:"tabid,omitempty"`
+	BlockId  string `json:"blockid,omitempty"`
+	ConnName string `json:"connname,omitempty"`
+	NoPrompt bool   `json:"-"` // prompts fail with a NoPromptError instead of being shown
+}
+
+type inputRouteContextKey struct{}
+
+// WithRoute attaches routing info to ctx.  fields already set on the parent's
+// route are kept, so outer callers (e.g. the block that started a connection)
+// take precedence over inner ones (e.g. the connection itself)
+func WithRoute(ctx context.Context, route *InputRoute) context.Context {
+	if route == nil {
+		return ctx
+	}
+	merged := *route
+	if parent := RouteFromContext(ctx); parent != nil {
+		merged.mergeFrom(parent)
+	}
+	return context.WithValue(ctx, inputRouteContextKey{}, &merged)
+}
+
+func RouteFromContext(ctx context.Context) *InputRoute {
+	if ctx == nil {
+		return nil
+	}
+	route, _ := ctx.Value(inputRouteContextKey{}).(*InputRoute)
+	return route
+}
+
+// fills in any fields that are set on other (other's fields take precedence)
+func (r *InputRoute) mergeFrom(other *InputRoute) {
+	if other.WindowId != "" {
+		r.WindowId = other.WindowId
+	}
+	if other.TabId != "" {
+		r.TabId = other.TabId
+	}
+	if other.BlockId != "" {
+		r.BlockId = other.BlockId
+	}
+	if other.ConnName != "" {
+		r.ConnName = other.ConnName
+	}
+	r.NoPrompt = r.NoPrompt || other.NoPrompt
+}
+
+// WithNoPrompt marks ctx (and the routes derived from it) so that prompts fail right away with a
+// NoPromptError, for headless connections where everything has to be supplied up front
+func WithNoPrompt(ctx context.Context) context.Context {
+	return WithRoute(ctx, &InputRoute{NoPrompt: true})
+}
+
+// returned instead of showing a prompt on a ctx marked with WithNoPrompt
+type NoPromptError struct {
+	PromptType string // a PromptType_* ("" for prompts without a configured timeout)
+	Title      string
+}
+
+func (e *NoPromptError) Error() string {
+	return fmt.Sprintf("input required: %q cannot be prompted for in headless mode", e.Title)
+}
+
+// resolves the window a route should be shown in ("" if it can't be determined,
+// in which case the prompt goes to every window)
+func (r *InputRoute) resolveWindowId() string {
+	if r.WindowId != "" {
+		return r.WindowId
+	}
+	if r.TabId == "" && r.BlockId == "" {
+		return ""
+	}
+	ctx, cancelFn := context.WithTimeout(context.Background(), routeResolveTimeout)
+	defer cancelFn()
+	tabId := r.TabId
+	if r.BlockId != "" {
+		blockTabId, err := wstore.DBFindTabForBlockId(ctx, r.BlockId)
+		if err != nil {
+			inputLog.Warn("cannot find tab for block", wlog.BlockAttr(r.BlockId), "err", err)
+		} else if blockTabId != "" {
+			tabId = blockTabId
+		}
+	}
+	if tabId == "" {
+		return ""
+	}
+	workspaceId, err := wstore.DBFindWorkspaceForTabId(ctx, tabId)
+	if err != nil || workspaceId == "" {
+		return ""
+	}
+	windowId, err := wstore.DBFindWindowForWorkspaceId(ctx, workspaceId)
+	if err != nil {
+		return ""
+	}
+	return windowId
+}
+
+// applies the ctx route to the request and resolves its window
+func routeRequest(ctx context.Context, request *UserInputRequest) {
+	route := &InputRoute{WindowId: request.WindowId, TabId: request.TabId, BlockId: request.BlockId, ConnName: request.ConnName}
+	if ctxRoute := RouteFromContext(ctx); ctxRoute != nil {
+		// explicit fields on the request win over the ctx route
+		merged := *ctxRoute
+		merged.mergeFrom(route)
+		route = &merged
+	}
+	request.TabId = route.TabId
+	request.BlockId = route.BlockId
+	request.ConnName = route.ConnName
+	request.WindowId = route.resolveWindowId()
+}
+
+// scopes for publishing to a single window (nil publishes to every window)
+func makeWindowScopes(windowId string) []string {
+	if windowId == "" {
+		return nil
+	}
+	return []string{waveobj.MakeORef(waveobj.OType_Window, windowId).String()}
+}
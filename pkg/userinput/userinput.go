@@ -5,90 +5,331 @@ package userinput
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/wlog"
 	"github.com/wavetermdev/waveterm/pkg/wps"
 )
 
-var MainUserInputHandler = UserInputHandler{Channels: make(map[string](chan *UserInputResponse), 1)}
+var MainUserInputHandler = UserInputHandler{
+	Channels: make(map[string](chan *UserInputResponse), 1),
+	Queues:   make(map[string]*inputQueue),
+	Actions:  make(map[string]func()),
+}
+
+var inputLog = wlog.Logger("userinput")
+
+var ErrUserInputTimeout = errors.New("timed out waiting for user input")
+
+const (
+	ResponseType_Text    = "text"
+	ResponseType_Confirm = "confirm"
+	ResponseType_Secret  = "secret"
+	ResponseType_Otp     = "otp"
+)
 
 type UserInputRequest struct {
-	RequestId    string `json:"requestid"`
-	QueryText    string `json:"querytext"`
-	ResponseType string `json:"responsetype"`
-	Title        string `json:"title"`
-	Markdown     bool   `json:"markdown"`
-	TimeoutMs    int    `json:"timeoutms"`
-	CheckBoxMsg  string `json:"checkboxmsg"`
-	PublicText   bool   `json:"publictext"`
-	OkLabel      string `json:"oklabel,omitempty"`
-	CancelLabel  string `json:"cancellabel,omitempty"`
+	RequestId    string      `json:"requestid"`
+	QueryText    string      `json:"querytext"`
+	ResponseType string      `json:"responsetype"`
+	Title        string      `json:"title"`
+	Markdown     bool        `json:"markdown"`
+	TimeoutMs    int         `json:"timeoutms"`
+	CheckBoxMsg  string      `json:"checkboxmsg"`
+	PublicText   bool        `json:"publictext"`
+	OkLabel      string      `json:"oklabel,omitempty"`
+	CancelLabel  string      `json:"cancellabel,omitempty"`
+	SecretOpts   *SecretOpts `json:"secretopts,omitempty"`
+	OtpOpts      *OtpOpts    `json:"otpopts,omitempty"`
+	WindowId     string      `json:"windowid,omitempty"`     // prompts are queued per window ("" is the default window)
+	RememberKey  string      `json:"rememberkey,omitempty"`  // if set (with RememberConn), the user may choose to remember their answer
+	RememberConn string      `json:"rememberconn,omitempty"` // connection the remembered answer is stored under in connections.json
+	TabId        string      `json:"tabid,omitempty"`        // used to find the window if WindowId is not set
+	BlockId      string      `json:"blockid,omitempty"`      // used to find the window if WindowId is not set
+	ConnName     string      `json:"connname,omitempty"`     // connection that triggered the prompt (informational)
+}
+
+// options for the "secret" response type.  the frontend masks the input,
+// and (if requested) asks for the secret twice and offers a reveal toggle.
+// the backend re-validates the response, so these are enforced even if the
+// frontend is out of date.
+type SecretOpts struct {
+	ConfirmEntry bool `json:"confirmentry,omitempty"`
+	AllowReveal  bool `json:"allowreveal,omitempty"`
+	MinLength    int  `json:"minlength,omitempty"`
 }
 
 type UserInputResponse struct {
 	Type         string `json:"type"`
 	RequestId    string `json:"requestid"`
 	Text         string `json:"text,omitempty"`
+	ConfirmText  string `json:"confirmtext,omitempty"` // second entry for secrets with ConfirmEntry set
 	Confirm      bool   `json:"confirm,omitempty"`
 	ErrorMsg     string `json:"errormsg,omitempty"`
 	CheckboxStat bool   `json:"checkboxstat,omitempty"`
 }
 
+// a single prompt in a window's queue.  identical prompts (same window, type,
+// title, and text) are coalesced into one entry and share its response.
+type inputEntry struct {
+	Key        string
+	Request    *UserInputRequest
+	Timeout    time.Duration // measured from when the prompt is shown, 0 means no timeout
+	RespCh     chan *UserInputResponse
+	DoneCh     chan struct{}
+	Response   *UserInputResponse
+	Err        error
+	NumWaiters int
+	Shown      bool
+	Finished   bool
+}
+
+type inputQueue struct {
+	Entries []*inputEntry
+}
+
 type UserInputHandler struct {
 	Lock     sync.Mutex
 	Channels map[string](chan *UserInputResponse)
+	Queues   map[string]*inputQueue
+	Actions  map[string]func() // notification action callbacks (by notification id)
+}
+
+func (r *UserInputRequest) coalesceKey() string {
+	return fmt.Sprintf("%s|%s|%s|%s", r.WindowId, r.ResponseType, r.Title, r.QueryText)
 }
 
-func (ui *UserInputHandler) registerChannel() (string, chan *UserInputResponse) {
+// returns the entry for this request (either a new one or an existing identical one)
+func (ui *UserInputHandler) enqueue(request *UserInputRequest, timeout time.Duration) *inputEntry {
 	ui.Lock.Lock()
 	defer ui.Lock.Unlock()
 
-	id := uuid.New().String()
-	uich := make(chan *UserInputResponse, 1)
-
-	ui.Channels[id] = uich
-	return id, uich
+	queue := ui.Queues[request.WindowId]
+	if queue == nil {
+		queue = &inputQueue{}
+		ui.Queues[request.WindowId] = queue
+	}
+	key := request.coalesceKey()
+	for _, entry := range queue.Entries {
+		if entry.Key == key && !entry.Finished {
+			entry.NumWaiters++
+			request.RequestId = entry.Request.RequestId
+			return entry
+		}
+	}
+	request.RequestId = uuid.New().String()
+	entry := &inputEntry{
+		Key:        key,
+		Request:    request,
+		Timeout:    timeout,
+		RespCh:     make(chan *UserInputResponse, 1),
+		DoneCh:     make(chan struct{}),
+		NumWaiters: 1,
+	}
+	ui.Channels[request.RequestId] = entry.RespCh
+	queue.Entries = append(queue.Entries, entry)
+	ui.showHead_nolock(request.WindowId)
+	return entry
 }
 
-func (ui *UserInputHandler) unregisterChannel(id string) {
+// marks the entry as finished, removes it from its queue, and shows the next prompt
+func (ui *UserInputHandler) finishEntry(entry *inputEntry, response *UserInputResponse, err error) {
 	ui.Lock.Lock()
 	defer ui.Lock.Unlock()
 
-	delete(ui.Channels, id)
+	if entry.Finished {
+		return
+	}
+	entry.Finished = true
+	entry.Response = response
+	entry.Err = err
+	close(entry.DoneCh)
+	delete(ui.Channels, entry.Request.RequestId)
+	if response == nil && entry.Shown {
+		// nobody answered, close the prompt if the frontend still shows it
+		ui.dismissInFrontend(entry.Request)
+	}
+	windowId := entry.Request.WindowId
+	queue := ui.Queues[windowId]
+	if queue == nil {
+		return
+	}
+	for idx, qEntry := range queue.Entries {
+		if qEntry == entry {
+			queue.Entries = append(queue.Entries[:idx], queue.Entries[idx+1:]...)
+			break
+		}
+	}
+	if len(queue.Entries) == 0 {
+		delete(ui.Queues, windowId)
+		return
+	}
+	ui.showHead_nolock(windowId)
+}
+
+// called when a waiter's context is done.  the entry is only canceled once
+// every coalesced waiter has gone away.
+func (ui *UserInputHandler) releaseWaiter(entry *inputEntry, err error) {
+	ui.Lock.Lock()
+	entry.NumWaiters--
+	lastWaiter := entry.NumWaiters <= 0
+	ui.Lock.Unlock()
+	if lastWaiter {
+		ui.finishEntry(entry, nil, err)
+	}
+}
+
+func (ui *UserInputHandler) showHead_nolock(windowId string) {
+	queue := ui.Queues[windowId]
+	if queue == nil || len(queue.Entries) == 0 {
+		return
+	}
+	entry := queue.Entries[0]
+	if entry.Shown {
+		return
+	}
+	entry.Shown = true
+	if entry.Timeout > 0 {
+		entry.Request.TimeoutMs = int(entry.Timeout.Milliseconds()) - 500
+	} else {
+		// no timeout, the frontend will not show a countdown
+		entry.Request.TimeoutMs = 0
+	}
+	go ui.runEntry(entry)
+}
+
+func (ui *UserInputHandler) runEntry(entry *inputEntry) {
+	defer panichandler.PanicHandler("userinput:runEntry")
+	var timeoutCh <-chan time.Time
+	if entry.Timeout > 0 {
+		timer := time.NewTimer(entry.Timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+	ui.sendRequestToFrontend(entry.Request)
+	select {
+	case resp := <-entry.RespCh:
+		inputLog.Debug("received user input response", "requestid", resp.RequestId)
+		ui.finishEntry(entry, resp, nil)
+	case <-timeoutCh:
+		ui.finishEntry(entry, nil, ErrUserInputTimeout)
+	case <-entry.DoneCh:
+		// canceled by all waiters
+	}
 }
 
 func (ui *UserInputHandler) sendRequestToFrontend(request *UserInputRequest) {
 	wps.Broker.Publish(wps.WaveEvent{
-		Event: wps.Event_UserInput,
-		Data:  request,
+		Event:  wps.Event_UserInput,
+		Scopes: makeWindowScopes(request.WindowId),
+		Data:   request,
 	})
 }
 
-func GetUserInput(ctx context.Context, request *UserInputRequest) (*UserInputResponse, error) {
-	id, uiCh := MainUserInputHandler.registerChannel()
-	defer MainUserInputHandler.unregisterChannel(id)
-	request.RequestId = id
-	deadline, _ := ctx.Deadline()
-	request.TimeoutMs = int(time.Until(deadline).Milliseconds()) - 500
-	MainUserInputHandler.sendRequestToFrontend(request)
-
-	var response *UserInputResponse
-	var err error
+func (ui *UserInputHandler) dismissInFrontend(request *UserInputRequest) {
+	wps.Broker.Publish(wps.WaveEvent{
+		Event:  wps.Event_UserInputDismiss,
+		Scopes: makeWindowScopes(request.WindowId),
+		Data:   request,
+	})
+}
+
+// delivers a response from the frontend to the waiting request (if any)
+func (ui *UserInputHandler) SendResponse(response *UserInputResponse) {
+	ui.Lock.Lock()
+	respCh := ui.Channels[response.RequestId]
+	ui.Lock.Unlock()
+	if respCh == nil {
+		return
+	}
 	select {
-	case resp := <-uiCh:
-		log.Printf("checking received: %v", resp.RequestId)
-		response = resp
-	case <-ctx.Done():
-		return nil, fmt.Errorf("timed out waiting for user input")
+	case respCh <- response:
+	default:
 	}
+}
 
+func getUserInputQueued(ctx context.Context, promptType string, request *UserInputRequest, timeout time.Duration) (*UserInputResponse, error) {
+	if remembered := getRememberedResponse(request); remembered != nil {
+		return remembered, nil
+	}
+	if route := RouteFromContext(ctx); route != nil && route.NoPrompt {
+		return nil, &NoPromptError{PromptType: promptType, Title: request.Title}
+	}
+	routeRequest(ctx, request)
+	if isRememberable(request) && request.CheckBoxMsg == "" {
+		request.CheckBoxMsg = RememberCheckboxMsg
+	}
+	entry := MainUserInputHandler.enqueue(request, timeout)
+	select {
+	case <-entry.DoneCh:
+	case <-ctx.Done():
+		var cancelErr error
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			cancelErr = ErrUserInputTimeout
+		} else {
+			cancelErr = fmt.Errorf("user input canceled: %w", ctx.Err())
+		}
+		MainUserInputHandler.releaseWaiter(entry, cancelErr)
+		return nil, cancelErr
+	}
+	if entry.Err != nil {
+		return nil, entry.Err
+	}
+	response := entry.Response
 	if response.ErrorMsg != "" {
-		err = fmt.Errorf(response.ErrorMsg)
+		return response, errors.New(response.ErrorMsg)
+	}
+	rememberResponse(request, response)
+	switch request.ResponseType {
+	case ResponseType_Secret:
+		return response, validateSecretResponse(request, response)
+	case ResponseType_Otp:
+		return response, validateOtpResponse(request, response)
+	}
+	return response, nil
+}
+
+// GetUserInput queues the request for its window and waits for a response.
+// the prompt's displayed timeout comes from the ctx deadline, and canceling
+// ctx withdraws the request (or this caller's interest in a coalesced request)
+func GetUserInput(ctx context.Context, request *UserInputRequest) (*UserInputResponse, error) {
+	var timeout time.Duration
+	deadline, hasDeadline := ctx.Deadline()
+	if hasDeadline {
+		timeout = time.Until(deadline)
+	}
+	return getUserInputQueued(ctx, "", request, timeout)
+}
+
+func validateSecretResponse(request *UserInputRequest, response *UserInputResponse) error {
+	opts := request.SecretOpts
+	if opts == nil {
+		return nil
 	}
+	if opts.MinLength > 0 && len(response.Text) < opts.MinLength {
+		return fmt.Errorf("secret must be at least %d characters", opts.MinLength)
+	}
+	if opts.ConfirmEntry && response.Text != response.ConfirmText {
+		return fmt.Errorf("secret entries do not match")
+	}
+	return nil
+}
 
-	return response, err
+// GetUserSecret prompts for a masked secret (passphrases, passwords, etc.) with
+// the timeout configured for promptType (see GetTimedUserInput).  the request's
+// ResponseType is forced to "secret" and the returned text has already been
+// validated against request.SecretOpts
+func GetUserSecret(ctx context.Context, promptType string, request *UserInputRequest) (*UserInputResponse, error) {
+	request.ResponseType = ResponseType_Secret
+	request.PublicText = false
+	response, err := GetTimedUserInput(ctx, promptType, request)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
 }
@@ -0,0 +1,127 @@
+package userinput
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func waitForQueueLen(t *testing.T, windowId string, expected int) *inputQueue {
+	for i := 0; i < 100; i++ {
+		MainUserInputHandler.Lock.Lock()
+		queue := MainUserInputHandler.Queues[windowId]
+		numEntries := 0
+		if queue != nil {
+			numEntries = len(queue.Entries)
+		}
+		MainUserInputHandler.Lock.Unlock()
+		if numEntries == expected {
+			return queue
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("queue %q never reached length %d", windowId, expected)
+	return nil
+}
+
+func headRequestId(windowId string) string {
+	MainUserInputHandler.Lock.Lock()
+	defer MainUserInputHandler.Lock.Unlock()
+	return MainUserInputHandler.Queues[windowId].Entries[0].Request.RequestId
+}
+
+func TestQueueOrderAndCoalesce(t *testing.T) {
+	windowId := "test-order"
+	results := make(chan string, 3)
+	ask := func(title string) {
+		resp, err := GetUserInput(context.Background(), &UserInputRequest{ResponseType: ResponseType_Text, Title: title, WindowId: windowId})
+		if err != nil {
+			results <- "error"
+			return
+		}
+		results <- title + ":" + resp.Text
+	}
+	go ask("first")
+	waitForQueueLen(t, windowId, 1)
+	go ask("second")
+	waitForQueueLen(t, windowId, 2)
+	go ask("first") // identical to the first prompt, should coalesce
+	time.Sleep(50 * time.Millisecond)
+	waitForQueueLen(t, windowId, 2)
+
+	MainUserInputHandler.SendResponse(&UserInputResponse{RequestId: headRequestId(windowId), Text: "a"})
+	for i := 0; i < 2; i++ {
+		if result := <-results; result != "first:a" {
+			t.Errorf("expected first:a, got %q", result)
+		}
+	}
+	waitForQueueLen(t, windowId, 1)
+	MainUserInputHandler.SendResponse(&UserInputResponse{RequestId: headRequestId(windowId), Text: "b"})
+	if result := <-results; result != "second:b" {
+		t.Errorf("expected second:b, got %q", result)
+	}
+	waitForQueueLen(t, windowId, 0)
+}
+
+func TestQueueCancel(t *testing.T) {
+	windowId := "test-cancel"
+	ctx, cancelFn := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := GetUserInput(ctx, &UserInputRequest{ResponseType: ResponseType_Confirm, Title: "cancel me", WindowId: windowId})
+		errCh <- err
+	}()
+	waitForQueueLen(t, windowId, 1)
+	cancelFn()
+	if err := <-errCh; err == nil {
+		t.Errorf("expected an error after cancel")
+	}
+	waitForQueueLen(t, windowId, 0)
+}
+
+func TestNoPrompt(t *testing.T) {
+	windowId := "test-noprompt"
+	// the flag survives a route being added later (like the connection's own route)
+	ctx := WithRoute(WithNoPrompt(context.Background()), &InputRoute{ConnName: "user@host"})
+	_, err := GetTimedUserInput(ctx, PromptType_Password, &UserInputRequest{ResponseType: ResponseType_Confirm, Title: "Password Authentication", WindowId: windowId})
+	var noPromptErr *NoPromptError
+	if !errors.As(err, &noPromptErr) || noPromptErr.PromptType != PromptType_Password {
+		t.Fatalf("expected a NoPromptError for the password prompt, got %v", err)
+	}
+	waitForQueueLen(t, windowId, 0)
+}
+
+func TestSecretValidation(t *testing.T) {
+	request := &UserInputRequest{ResponseType: ResponseType_Secret, SecretOpts: &SecretOpts{ConfirmEntry: true, MinLength: 4}}
+	if err := validateSecretResponse(request, &UserInputResponse{Text: "abc", ConfirmText: "abc"}); err == nil {
+		t.Errorf("expected min length error")
+	}
+	if err := validateSecretResponse(request, &UserInputResponse{Text: "abcd", ConfirmText: "abce"}); err == nil {
+		t.Errorf("expected mismatch error")
+	}
+	if err := validateSecretResponse(request, &UserInputResponse{Text: "abcd", ConfirmText: "abcd"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestOtpValidation(t *testing.T) {
+	request := &UserInputRequest{ResponseType: ResponseType_Otp, OtpOpts: &OtpOpts{NumDigits: 6}}
+	response := &UserInputResponse{Text: " 123-456 "}
+	if err := validateOtpResponse(request, response); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if response.Text != "123456" {
+		t.Errorf("expected normalized code 123456, got %q", response.Text)
+	}
+	if err := validateOtpResponse(request, &UserInputResponse{Text: "12345"}); err == nil {
+		t.Errorf("expected length error")
+	}
+	if err := validateOtpResponse(request, &UserInputResponse{Text: "12345a"}); err == nil {
+		t.Errorf("expected digit error")
+	}
+	freeform := &UserInputRequest{ResponseType: ResponseType_Otp, OtpOpts: &OtpOpts{}}
+	if err := validateOtpResponse(freeform, &UserInputResponse{Text: "push"}); err != nil {
+		t.Errorf("unexpected error for free-form code: %v", err)
+	}
+}
@@ -0,0 +1,273 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// line based diffs (myers' algorithm), grouped into hunks with a few lines of context.  the common
+// prefix and suffix are trimmed before diffing, so large files with small changes are cheap.  when
+// the differing region needs more than MaxEditCost edits the whole region is reported as replaced
+// (and the result is marked Approximate), which bounds time and memory for unrelated files.
+package linediff
+
+import (
+	"bytes"
+	"strings"
+)
+
+const DefaultContext = 3
+const MaxEditCost = 1000
+const MaxHunkLines = 20000 // lines returned in all hunks, past this the result is Truncated
+
+const (
+	Op_Equal  = "equal"
+	Op_Delete = "delete"
+	Op_Insert = "insert"
+)
+
+type DiffOpts struct {
+	Context          int  `json:"context,omitempty"` // lines of context around changes (0 uses DefaultContext, -1 for none)
+	IgnoreWhitespace bool `json:"ignorewhitespace,omitempty"`
+}
+
+type DiffLine struct {
+	Op      string `json:"op"`
+	Text    string `json:"text"`
+	OldLine int    `json:"oldline,omitempty"` // 1-based, not set for inserted lines
+	NewLine int    `json:"newline,omitempty"` // 1-based, not set for deleted lines
+}
+
+type DiffHunk struct {
+	OldStart int        `json:"oldstart"` // 1-based (as in a unified diff)
+	OldLines int        `json:"oldlines"`
+	NewStart int        `json:"newstart"`
+	NewLines int        `json:"newlines"`
+	Lines    []DiffLine `json:"lines"`
+}
+
+type DiffResult struct {
+	Hunks       []DiffHunk `json:"hunks"`
+	Added       int        `json:"added"`
+	Removed     int        `json:"removed"`
+	Approximate bool       `json:"approximate,omitempty"`
+	Truncated   bool       `json:"truncated,omitempty"`
+}
+
+// a run of changed lines, old[OldStart:OldEnd] was replaced by new[NewStart:NewEnd]
+type changeBlock struct {
+	OldStart int
+	OldEnd   int
+	NewStart int
+	NewEnd   int
+}
+
+// splits file contents into lines (without line endings).  a final newline doesn't start a new line.
+func SplitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	data = bytes.TrimSuffix(data, []byte("\n"))
+	lines := strings.Split(string(data), "\n")
+	for idx, line := range lines {
+		lines[idx] = strings.TrimSuffix(line, "\r")
+	}
+	return lines
+}
+
+// maps lines to ints so they are cheap to compare
+func internLines(oldLines []string, newLines []string, ignoreWhitespace bool) ([]int, []int) {
+	ids := make(map[string]int)
+	intern := func(lines []string) []int {
+		rtn := make([]int, len(lines))
+		for idx, line := range lines {
+			if ignoreWhitespace {
+				line = strings.Join(strings.Fields(line), " ")
+			}
+			id, ok := ids[line]
+			if !ok {
+				id = len(ids)
+				ids[line] = id
+			}
+			rtn[idx] = id
+		}
+		return rtn
+	}
+	return intern(oldLines), intern(newLines)
+}
+
+// myers' O(ND) diff of a and b, returning the changed blocks (indices offset by base).  returns
+// false if the edit distance is more than maxCost.
+func myersDiff(a []int, b []int, base int, maxCost int) ([]changeBlock, bool) {
+	n, m := len(a), len(b)
+	limit := min(n+m, maxCost)
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	// trace[d] holds v[-d..d] after step d, for backtracking
+	var trace [][]int
+	found := false
+	for d := 0; d <= limit && !found; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+	}
+	if !found {
+		return nil, false
+	}
+	var blocks []changeBlock
+	addEdit := func(oldIdx int, newIdx int, isDelete bool) {
+		// edits are found back to front, extend the current block or start a new one
+		var block changeBlock
+		if isDelete {
+			block = changeBlock{OldStart: oldIdx, OldEnd: oldIdx + 1, NewStart: newIdx, NewEnd: newIdx}
+		} else {
+			block = changeBlock{OldStart: oldIdx, OldEnd: oldIdx, NewStart: newIdx, NewEnd: newIdx + 1}
+		}
+		if len(blocks) > 0 {
+			last := &blocks[len(blocks)-1]
+			if last.OldStart == block.OldEnd && last.NewStart == block.NewEnd {
+				last.OldStart = block.OldStart
+				last.NewStart = block.NewStart
+				return
+			}
+		}
+		blocks = append(blocks, block)
+	}
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && prev[k-1+d-1] < prev[k+1+d-1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := prev[prevK+d-1]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+		}
+		if x == prevX {
+			addEdit(x, y-1, false)
+		} else {
+			addEdit(x-1, y, true)
+		}
+		x, y = prevX, prevY
+	}
+	// blocks were found back to front
+	for i, j := 0, len(blocks)-1; i < j; i, j = i+1, j-1 {
+		blocks[i], blocks[j] = blocks[j], blocks[i]
+	}
+	for idx := range blocks {
+		blocks[idx].OldStart += base
+		blocks[idx].OldEnd += base
+		blocks[idx].NewStart += base
+		blocks[idx].NewEnd += base
+	}
+	return blocks, true
+}
+
+// the changed blocks between oldLines and newLines.  returns false if the diff was approximated.
+func diffBlocks(oldLines []string, newLines []string, ignoreWhitespace bool) ([]changeBlock, bool) {
+	a, b := internLines(oldLines, newLines, ignoreWhitespace)
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	a, b = a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(a) == 0 && len(b) == 0 {
+		return nil, true
+	}
+	// the prefix and suffix are equal in both, so old and new indices share the same base
+	blocks, ok := myersDiff(a, b, prefix, MaxEditCost)
+	if ok {
+		return blocks, true
+	}
+	return []changeBlock{{OldStart: prefix, OldEnd: prefix + len(a), NewStart: prefix, NewEnd: prefix + len(b)}}, false
+}
+
+// diffs oldLines against newLines (see SplitLines)
+func Diff(oldLines []string, newLines []string, opts DiffOpts) *DiffResult {
+	context := opts.Context
+	if context == 0 {
+		context = DefaultContext
+	}
+	context = max(context, 0)
+	blocks, exact := diffBlocks(oldLines, newLines, opts.IgnoreWhitespace)
+	rtn := &DiffResult{Hunks: []DiffHunk{}, Approximate: !exact}
+	numLines := 0
+	for startIdx := 0; startIdx < len(blocks); {
+		// blocks separated by at most 2*context equal lines share a hunk
+		endIdx := startIdx + 1
+		for endIdx < len(blocks) && blocks[endIdx].OldStart-blocks[endIdx-1].OldEnd <= 2*context {
+			endIdx++
+		}
+		hunkBlocks := blocks[startIdx:endIdx]
+		startIdx = endIdx
+		first, last := hunkBlocks[0], hunkBlocks[len(hunkBlocks)-1]
+		oldStart := max(first.OldStart-context, 0)
+		newStart := first.NewStart - (first.OldStart - oldStart)
+		oldEnd := min(last.OldEnd+context, len(oldLines))
+		newEnd := last.NewEnd + (oldEnd - last.OldEnd)
+		hunk := DiffHunk{
+			OldStart: oldStart + 1,
+			OldLines: oldEnd - oldStart,
+			NewStart: newStart + 1,
+			NewLines: newEnd - newStart,
+		}
+		if oldStart == oldEnd {
+			// unified diff convention, an empty range starts at the line before it
+			hunk.OldStart = oldStart
+		}
+		if newStart == newEnd {
+			hunk.NewStart = newStart
+		}
+		hunkLines := oldEnd - oldStart
+		for _, block := range hunkBlocks {
+			rtn.Removed += block.OldEnd - block.OldStart
+			rtn.Added += block.NewEnd - block.NewStart
+			hunkLines += block.NewEnd - block.NewStart
+		}
+		if rtn.Truncated || numLines+hunkLines > MaxHunkLines {
+			rtn.Truncated = true
+			continue
+		}
+		numLines += hunkLines
+		oldIdx, newIdx := oldStart, newStart
+		addEqual := func(toOldIdx int) {
+			for ; oldIdx < toOldIdx; oldIdx, newIdx = oldIdx+1, newIdx+1 {
+				hunk.Lines = append(hunk.Lines, DiffLine{Op: Op_Equal, Text: newLines[newIdx], OldLine: oldIdx + 1, NewLine: newIdx + 1})
+			}
+		}
+		for _, block := range hunkBlocks {
+			addEqual(block.OldStart)
+			for ; oldIdx < block.OldEnd; oldIdx++ {
+				hunk.Lines = append(hunk.Lines, DiffLine{Op: Op_Delete, Text: oldLines[oldIdx], OldLine: oldIdx + 1})
+			}
+			for ; newIdx < block.NewEnd; newIdx++ {
+				hunk.Lines = append(hunk.Lines, DiffLine{Op: Op_Insert, Text: newLines[newIdx], NewLine: newIdx + 1})
+			}
+		}
+		addEqual(oldEnd)
+		rtn.Hunks = append(rtn.Hunks, hunk)
+	}
+	return rtn
+}
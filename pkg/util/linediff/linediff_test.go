@@ -0,0 +1,129 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package linediff
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// applies the hunks to oldLines (hunks must have been computed with enough context to be exact)
+func applyHunks(t *testing.T, oldLines []string, result *DiffResult) []string {
+	var rtn []string
+	oldIdx := 0
+	for _, hunk := range result.Hunks {
+		for _, line := range hunk.Lines {
+			if line.OldLine != 0 {
+				for oldIdx < line.OldLine-1 {
+					rtn = append(rtn, oldLines[oldIdx])
+					oldIdx++
+				}
+			}
+			switch line.Op {
+			case Op_Equal:
+				if oldLines[oldIdx] != line.Text {
+					t.Fatalf("equal line %d mismatch: %q vs %q", line.OldLine, oldLines[oldIdx], line.Text)
+				}
+				rtn = append(rtn, line.Text)
+				oldIdx++
+			case Op_Delete:
+				oldIdx++
+			case Op_Insert:
+				rtn = append(rtn, line.Text)
+			}
+		}
+	}
+	return append(rtn, oldLines[oldIdx:]...)
+}
+
+func TestDiffHunks(t *testing.T) {
+	oldText := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\n"
+	newText := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\nn\n"
+	result := Diff(SplitLines([]byte(oldText)), SplitLines([]byte(newText)), DiffOpts{})
+	if len(result.Hunks) != 2 || result.Added != 2 || result.Removed != 1 || result.Approximate {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	hunk := result.Hunks[0]
+	if hunk.OldStart != 1 || hunk.OldLines != 5 || hunk.NewStart != 1 || hunk.NewLines != 5 {
+		t.Errorf("unexpected first hunk %+v", hunk)
+	}
+	if hunk.Lines[1].Op != Op_Delete || hunk.Lines[1].Text != "b" || hunk.Lines[2].Op != Op_Insert || hunk.Lines[2].NewLine != 2 {
+		t.Errorf("unexpected first hunk lines %+v", hunk.Lines)
+	}
+	hunk = result.Hunks[1]
+	if hunk.OldStart != 11 || hunk.OldLines != 3 || hunk.NewStart != 11 || hunk.NewLines != 4 {
+		t.Errorf("unexpected second hunk %+v", hunk)
+	}
+	identical := Diff(SplitLines([]byte(oldText)), SplitLines([]byte(oldText)), DiffOpts{})
+	if len(identical.Hunks) != 0 || identical.Added != 0 || identical.Removed != 0 {
+		t.Errorf("expected no hunks for identical input, got %+v", identical)
+	}
+}
+
+func TestDiffEmpty(t *testing.T) {
+	result := Diff(nil, []string{"x", "y"}, DiffOpts{})
+	if len(result.Hunks) != 1 || result.Hunks[0].OldStart != 0 || result.Hunks[0].OldLines != 0 || result.Hunks[0].NewStart != 1 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if lines := SplitLines([]byte("one\r\ntwo")); len(lines) != 2 || lines[0] != "one" {
+		t.Errorf("unexpected split %q", lines)
+	}
+}
+
+func TestDiffIgnoreWhitespace(t *testing.T) {
+	result := Diff([]string{"if x {", "  y()", "}"}, []string{"if x {", "\ty()  ", "}"}, DiffOpts{IgnoreWhitespace: true})
+	if len(result.Hunks) != 0 {
+		t.Errorf("expected no changes ignoring whitespace, got %+v", result)
+	}
+}
+
+func TestDiffRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for iter := 0; iter < 200; iter++ {
+		var oldLines, newLines []string
+		numLines := rng.Intn(60)
+		for i := 0; i < numLines; i++ {
+			oldLines = append(oldLines, fmt.Sprintf("line %d", rng.Intn(10)))
+		}
+		for _, line := range oldLines {
+			switch rng.Intn(5) {
+			case 0:
+				continue
+			case 1:
+				newLines = append(newLines, "new "+line)
+			}
+			newLines = append(newLines, line)
+		}
+		// full context, so applying the hunks rebuilds the new lines
+		result := Diff(oldLines, newLines, DiffOpts{Context: 1000})
+		applied := applyHunks(t, oldLines, result)
+		if strings.Join(applied, "\n") != strings.Join(newLines, "\n") {
+			t.Fatalf("iter %d: applying hunks gave %q, expected %q", iter, applied, newLines)
+		}
+		result = Diff(oldLines, newLines, DiffOpts{Context: 1})
+		applied = applyHunks(t, oldLines, result)
+		if strings.Join(applied, "\n") != strings.Join(newLines, "\n") {
+			t.Fatalf("iter %d (context 1): applying hunks gave %q, expected %q", iter, applied, newLines)
+		}
+	}
+}
+
+func TestDiffApproximate(t *testing.T) {
+	var oldLines, newLines []string
+	for i := 0; i < MaxEditCost; i++ {
+		oldLines = append(oldLines, fmt.Sprintf("old %d", i))
+		newLines = append(newLines, fmt.Sprintf("new %d", i))
+	}
+	oldLines = append([]string{"same"}, oldLines...)
+	newLines = append([]string{"same"}, newLines...)
+	result := Diff(oldLines, newLines, DiffOpts{})
+	if !result.Approximate || len(result.Hunks) != 1 || result.Removed != MaxEditCost || result.Added != MaxEditCost {
+		t.Fatalf("expected an approximate single hunk, got approximate=%v hunks=%d", result.Approximate, len(result.Hunks))
+	}
+	if result.Hunks[0].OldStart != 1 || result.Hunks[0].Lines[0].Text != "same" {
+		t.Errorf("unexpected hunk start %+v", result.Hunks[0].Lines[0])
+	}
+}
@@ -51,6 +51,24 @@ export PATH={{.WSHBINDIR}}:$PATH
 if [[ -n ${_comps+x} ]]; then
   source <(wsh completion zsh)
 fi
+
+# shell integration (cwd, command boundaries, exit codes)
+_WAVE_SI_OS=$(uname -s 2>/dev/null)
+_wave_si_precmd() {
+  local _wave_si_status=$?
+  if [[ -n $_wave_si_incmd ]]; then
+    printf '\033]133;D;%s\007' "$_wave_si_status"
+    unset _wave_si_incmd
+  fi
+  printf '\033]7;file://%s%s\007\033]133;A;shell=zsh;os=%s\007' "$HOST" "$PWD" "$_WAVE_SI_OS"
+}
+_wave_si_preexec() {
+  _wave_si_incmd=1
+  printf '\033]133;C;cmdline=%s\007' "${1//[[:cntrl:]]/ }"
+}
+autoload -Uz add-zsh-hook
+add-zsh-hook precmd _wave_si_precmd
+add-zsh-hook preexec _wave_si_preexec
 `
 
 	ZshStartup_Zlogin = `
@@ -82,6 +100,21 @@ if type _init_completion &>/dev/null; then
   source <(wsh completion bash)
 fi
 
+# shell integration (cwd, command boundaries, exit codes).  the command start
+# marker uses PS0 (bash 4.4+), the command line is read back from history.
+_WAVE_SI_OS=$(uname -s 2>/dev/null)
+_wave_si_precmd() {
+  local _wave_si_status=$?
+  local _wave_si_cmdline
+  _wave_si_cmdline=$(HISTTIMEFORMAT= builtin history 1)
+  [[ $_wave_si_cmdline =~ ^\ *[0-9]+\*?\ +(.*)$ ]] && _wave_si_cmdline=${BASH_REMATCH[1]}
+  printf '\033]133;D;%s;cmdline=%s\007' "$_wave_si_status" "${_wave_si_cmdline//[[:cntrl:]]/ }"
+  printf '\033]7;file://%s%s\007\033]133;A;shell=bash;os=%s\007' "$HOSTNAME" "$PWD" "$_WAVE_SI_OS"
+  return $_wave_si_status
+}
+PS0="${PS0}\e]133;C\a"
+PROMPT_COMMAND="_wave_si_precmd${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+
 `
 	PwshStartup_wavepwsh = `
 # no need to source regular profiles since we cannot
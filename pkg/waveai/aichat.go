@@ -0,0 +1,427 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package waveai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wavetermdev/waveterm/pkg/filestore"
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+	"github.com/wavetermdev/waveterm/pkg/wstore"
+)
+
+// chat transcripts are stored in the filestore of their waveai block.  the active chat is
+// "aidata" (a json array of prompt messages), clearing the chat saves it as "aichat:<id>".
+// the title is kept in the file meta (defaults to the first user message).
+
+const AiDataFileName = "aidata"
+const AiChatFilePrefix = "aichat:"
+const AiChatCurrentId = "current"
+
+const AiChatMetaKey_Title = "title"
+
+const MaxChatTitleLen = 60
+const chatMatchContext = 40
+
+func aiChatFileName(chatId string) string {
+	if chatId == AiChatCurrentId {
+		return AiDataFileName
+	}
+	return AiChatFilePrefix + chatId
+}
+
+func aiChatIdFromFileName(name string) string {
+	if name == AiDataFileName {
+		return AiChatCurrentId
+	}
+	return strings.TrimPrefix(name, AiChatFilePrefix)
+}
+
+func isAiChatFile(name string) bool {
+	return name == AiDataFileName || strings.HasPrefix(name, AiChatFilePrefix)
+}
+
+func readChatFile(ctx context.Context, blockId string, name string) ([]wshrpc.OpenAIPromptMessageType, error) {
+	_, data, err := filestore.WFS.ReadFile(ctx, blockId, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading ai chat: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var rtn []wshrpc.OpenAIPromptMessageType
+	err = json.Unmarshal(data, &rtn)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing ai chat: %w", err)
+	}
+	return rtn, nil
+}
+
+func writeChatFile(ctx context.Context, blockId string, name string, history []wshrpc.OpenAIPromptMessageType, meta filestore.FileMeta) error {
+	historyBytes, err := json.Marshal(history)
+	if err != nil {
+		return fmt.Errorf("unable to serialize ai history: %v", err)
+	}
+	// ignore MakeFile error (already exists is ok)
+	filestore.WFS.MakeFile(ctx, blockId, name, meta, filestore.FileOptsType{})
+	err = filestore.WFS.WriteFile(ctx, blockId, name, historyBytes)
+	if err != nil {
+		return fmt.Errorf("cannot save ai chat: %w", err)
+	}
+	return nil
+}
+
+// default title is the first line of the first user message
+func makeChatTitle(history []wshrpc.OpenAIPromptMessageType) string {
+	for _, msg := range history {
+		if msg.Role != "user" {
+			continue
+		}
+		title := strings.TrimSpace(msg.Content)
+		title, _, _ = strings.Cut(title, "\n")
+		if len(title) > MaxChatTitleLen {
+			title = strings.TrimSpace(title[:MaxChatTitleLen]) + "..."
+		}
+		if title != "" {
+			return title
+		}
+	}
+	return "Untitled Chat"
+}
+
+func getChatTitle(file *filestore.WaveFile, history []wshrpc.OpenAIPromptMessageType) string {
+	if title, ok := file.Meta[AiChatMetaKey_Title].(string); ok && title != "" {
+		return title
+	}
+	return makeChatTitle(history)
+}
+
+func hasChatMessages(history []wshrpc.OpenAIPromptMessageType) bool {
+	for _, msg := range history {
+		if msg.Role == "user" || msg.Role == "assistant" {
+			return true
+		}
+	}
+	return false
+}
+
+// SaveChat replaces the block's active chat.  when it is cleared (an empty history) the
+// previous chat is kept as a saved chat so it can be searched, exported, and resumed later.
+func SaveChat(ctx context.Context, blockId string, history []wshrpc.OpenAIPromptMessageType) error {
+	now := time.Now().UnixMilli()
+	for idx := range history {
+		if history[idx].Ts == 0 {
+			history[idx].Ts = now
+		}
+	}
+	if len(history) == 0 {
+		err := archiveCurrentChat(ctx, blockId)
+		if err != nil {
+			return err
+		}
+		// the title belongs to the chat that was just archived
+		setChatTitle(ctx, blockId, AiDataFileName, "")
+	}
+	return writeChatFile(ctx, blockId, AiDataFileName, history, nil)
+}
+
+func archiveCurrentChat(ctx context.Context, blockId string) error {
+	history, err := readChatFile(ctx, blockId, AiDataFileName)
+	if err != nil {
+		return err
+	}
+	if !hasChatMessages(history) {
+		return nil
+	}
+	file, err := filestore.WFS.Stat(ctx, blockId, AiDataFileName)
+	if err != nil {
+		return fmt.Errorf("error getting ai chat info: %w", err)
+	}
+	meta := filestore.FileMeta{AiChatMetaKey_Title: getChatTitle(file, history)}
+	return writeChatFile(ctx, blockId, aiChatFileName(uuid.NewString()), history, meta)
+}
+
+func getAiBlockIds(ctx context.Context, blockId string) ([]string, error) {
+	if blockId != "" {
+		block, err := wstore.DBMustGet[*waveobj.Block](ctx, blockId)
+		if err != nil {
+			return nil, fmt.Errorf("error getting block: %w", err)
+		}
+		if viewName := block.Meta.GetString(waveobj.MetaKey_View, ""); viewName != "waveai" {
+			return nil, fmt.Errorf("block %s is not an ai block (view is %q)", blockId, viewName)
+		}
+		return []string{blockId}, nil
+	}
+	blocks, err := wstore.DBGetAllObjsByType[*waveobj.Block](ctx, waveobj.OType_Block)
+	if err != nil {
+		return nil, fmt.Errorf("error getting blocks: %w", err)
+	}
+	var rtn []string
+	for _, block := range blocks {
+		if block.Meta.GetString(waveobj.MetaKey_View, "") == "waveai" {
+			rtn = append(rtn, block.OID)
+		}
+	}
+	return rtn, nil
+}
+
+// returns a snippet around the first case-insensitive match of search (in the title or a message)
+func findChatMatch(title string, history []wshrpc.OpenAIPromptMessageType, search string) (string, bool) {
+	search = strings.ToLower(search)
+	if strings.Contains(strings.ToLower(title), search) {
+		return title, true
+	}
+	for _, msg := range history {
+		if msg.Role == "error" {
+			continue
+		}
+		idx := strings.Index(strings.ToLower(msg.Content), search)
+		if idx == -1 {
+			continue
+		}
+		idx = min(idx, len(msg.Content)) // lowercasing can change the length of some runes
+		startIdx := max(idx-chatMatchContext, 0)
+		endIdx := min(idx+len(search)+chatMatchContext, len(msg.Content))
+		snippet := strings.ToValidUTF8(msg.Content[startIdx:endIdx], "")
+		snippet = strings.Join(strings.Fields(snippet), " ")
+		if startIdx > 0 {
+			snippet = "..." + snippet
+		}
+		if endIdx < len(msg.Content) {
+			snippet = snippet + "..."
+		}
+		return snippet, true
+	}
+	return "", false
+}
+
+// ListChats returns the active and saved chats of an ai block (or of every ai block), newest first.
+// with a search string only chats with a matching title or message are returned.
+func ListChats(ctx context.Context, data wshrpc.CommandAiChatListData) ([]wshrpc.AiChatInfo, error) {
+	blockIds, err := getAiBlockIds(ctx, data.BlockId)
+	if err != nil {
+		return nil, err
+	}
+	search := strings.TrimSpace(data.Search)
+	rtn := make([]wshrpc.AiChatInfo, 0)
+	for _, blockId := range blockIds {
+		files, err := filestore.WFS.ListFiles(ctx, blockId)
+		if err != nil {
+			return nil, fmt.Errorf("error listing ai chats: %w", err)
+		}
+		for _, file := range files {
+			if !isAiChatFile(file.Name) {
+				continue
+			}
+			history, err := readChatFile(ctx, blockId, file.Name)
+			if err != nil {
+				log.Printf("error reading ai chat %s/%s: %v\n", blockId, file.Name, err)
+				continue
+			}
+			if !hasChatMessages(history) {
+				continue
+			}
+			info := wshrpc.AiChatInfo{
+				BlockId:     blockId,
+				ChatId:      aiChatIdFromFileName(file.Name),
+				Title:       getChatTitle(file, history),
+				Current:     file.Name == AiDataFileName,
+				CreatedTs:   file.CreatedTs,
+				UpdatedTs:   file.ModTs,
+				NumMessages: len(history),
+			}
+			if history[0].Ts != 0 {
+				info.CreatedTs = history[0].Ts
+			}
+			if search != "" {
+				match, found := findChatMatch(info.Title, history, search)
+				if !found {
+					continue
+				}
+				info.Match = match
+			}
+			rtn = append(rtn, info)
+		}
+	}
+	sort.SliceStable(rtn, func(i, j int) bool {
+		return rtn[i].UpdatedTs > rtn[j].UpdatedTs
+	})
+	return rtn, nil
+}
+
+// finds a chat by id (or unique id prefix).  blockid is required for the "current" chat.
+func findChat(ctx context.Context, data wshrpc.CommandAiChatData) (string, *filestore.WaveFile, error) {
+	if data.ChatId == "" {
+		return "", nil, fmt.Errorf("no chat id specified")
+	}
+	if data.ChatId == AiChatCurrentId && data.BlockId == "" {
+		return "", nil, fmt.Errorf("a block is required for the current chat")
+	}
+	blockIds, err := getAiBlockIds(ctx, data.BlockId)
+	if err != nil {
+		return "", nil, err
+	}
+	var foundBlockId string
+	var foundFile *filestore.WaveFile
+	for _, blockId := range blockIds {
+		files, err := filestore.WFS.ListFiles(ctx, blockId)
+		if err != nil {
+			return "", nil, fmt.Errorf("error listing ai chats: %w", err)
+		}
+		for _, file := range files {
+			if !isAiChatFile(file.Name) || !strings.HasPrefix(aiChatIdFromFileName(file.Name), data.ChatId) {
+				continue
+			}
+			if foundFile != nil {
+				return "", nil, fmt.Errorf("chat id %q is ambiguous", data.ChatId)
+			}
+			foundBlockId, foundFile = blockId, file
+		}
+	}
+	if foundFile == nil {
+		return "", nil, fmt.Errorf("chat %q not found", data.ChatId)
+	}
+	return foundBlockId, foundFile, nil
+}
+
+func formatChatTs(ts int64) string {
+	return time.UnixMilli(ts).Format("2006-01-02 15:04")
+}
+
+// ExportChatMarkdown renders a chat as a markdown document
+func ExportChatMarkdown(ctx context.Context, data wshrpc.CommandAiChatData) (string, error) {
+	blockId, file, err := findChat(ctx, data)
+	if err != nil {
+		return "", err
+	}
+	history, err := readChatFile(ctx, blockId, file.Name)
+	if err != nil {
+		return "", err
+	}
+	var buf strings.Builder
+	buf.WriteString(fmt.Sprintf("# %s\n\n", getChatTitle(file, history)))
+	if len(history) > 0 && history[0].Ts != 0 {
+		buf.WriteString(fmt.Sprintf("_Wave AI chat, started %s_\n\n", formatChatTs(history[0].Ts)))
+	}
+	for _, msg := range history {
+		var header string
+		switch msg.Role {
+		case "user":
+			header = "User"
+		case "assistant":
+			header = "Assistant"
+		case "system":
+			header = "System"
+		case "tool":
+			header = "Tool Result"
+		case "error":
+			header = "Error"
+		default:
+			header = msg.Role
+		}
+		if msg.Ts != 0 {
+			header = fmt.Sprintf("%s (%s)", header, formatChatTs(msg.Ts))
+		}
+		buf.WriteString(fmt.Sprintf("## %s\n\n", header))
+		if msg.Role == "tool" || msg.Role == "error" {
+			buf.WriteString("```\n" + strings.TrimRight(msg.Content, "\n") + "\n```\n\n")
+		} else if msg.Content != "" {
+			buf.WriteString(strings.TrimRight(msg.Content, "\n") + "\n\n")
+		}
+		for _, toolCall := range msg.ToolCalls {
+			buf.WriteString(fmt.Sprintf("> called tool `%s` %s\n\n", toolCall.Name, toolCall.Input))
+		}
+	}
+	return buf.String(), nil
+}
+
+// ResumeChat makes a saved chat the block's active chat again (the current chat is saved first).
+func ResumeChat(ctx context.Context, data wshrpc.CommandAiChatData) error {
+	blockId, file, err := findChat(ctx, data)
+	if err != nil {
+		return err
+	}
+	if file.Name == AiDataFileName {
+		return nil
+	}
+	history, err := readChatFile(ctx, blockId, file.Name)
+	if err != nil {
+		return err
+	}
+	err = archiveCurrentChat(ctx, blockId)
+	if err != nil {
+		return err
+	}
+	err = writeChatFile(ctx, blockId, AiDataFileName, history, nil)
+	if err != nil {
+		return err
+	}
+	err = setChatTitle(ctx, blockId, AiDataFileName, getChatTitle(file, history))
+	if err != nil {
+		return err
+	}
+	err = filestore.WFS.DeleteFile(ctx, blockId, file.Name)
+	if err != nil {
+		return fmt.Errorf("error removing saved chat: %w", err)
+	}
+	reloadChat(blockId)
+	return nil
+}
+
+// RenameChat sets the title of a chat (an empty title goes back to the default one)
+func RenameChat(ctx context.Context, data wshrpc.CommandAiChatData) error {
+	blockId, file, err := findChat(ctx, data)
+	if err != nil {
+		return err
+	}
+	return setChatTitle(ctx, blockId, file.Name, strings.TrimSpace(data.Title))
+}
+
+// older chat files have a nil meta (which can't be merged into), so the meta is always replaced
+func setChatTitle(ctx context.Context, blockId string, name string, title string) error {
+	file, err := filestore.WFS.Stat(ctx, blockId, name)
+	if err != nil {
+		return fmt.Errorf("error getting ai chat info: %w", err)
+	}
+	meta := make(filestore.FileMeta)
+	for k, v := range file.Meta {
+		meta[k] = v
+	}
+	if title == "" {
+		delete(meta, AiChatMetaKey_Title)
+	} else {
+		meta[AiChatMetaKey_Title] = title
+	}
+	err = filestore.WFS.WriteMeta(ctx, blockId, name, meta, false)
+	if err != nil {
+		return fmt.Errorf("error setting chat title: %w", err)
+	}
+	return nil
+}
+
+// tells the block's frontend to re-read its chat (no-op if the block is not open)
+func reloadChat(blockId string) {
+	err := wshclient.AiReloadChatCommand(wshclient.GetBareRpcClient(), &wshrpc.RpcOpts{
+		Route:      wshutil.MakeFeBlockRouteId(blockId),
+		NoResponse: true,
+	})
+	if err != nil {
+		log.Printf("error reloading ai chat for block %s: %v\n", blockId, err)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package waveai
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// http clients for the ai backends.  profiles can add headers (for api gateways and
+// proxies) and set tls options (extra ca certs, client certs, or skipping verification).
+// transports are cached per tls config so connections are reused between requests.
+
+var aiTransportLock = &sync.Mutex{}
+var aiTransports = make(map[string]*http.Transport)
+
+type aiHeaderTransport struct {
+	base    http.RoundTripper
+	headers map[string]string
+}
+
+func (t *aiHeaderTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for key, val := range t.headers {
+		req.Header.Set(key, val)
+	}
+	return t.base.RoundTrip(req)
+}
+
+func hasAiTlsOpts(opts *wshrpc.OpenAIOptsType) bool {
+	return opts.TlsSkipVerify || opts.TlsCaCert != "" || opts.TlsClientCert != "" || opts.TlsClientKey != ""
+}
+
+func makeAiTlsConfig(opts *wshrpc.OpenAIOptsType) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: opts.TlsSkipVerify}
+	if opts.TlsCaCert != "" {
+		certPool, err := x509.SystemCertPool()
+		if err != nil {
+			certPool = x509.NewCertPool()
+		}
+		pemBytes, err := os.ReadFile(wavebase.ExpandHomeDirSafe(opts.TlsCaCert))
+		if err != nil {
+			return nil, fmt.Errorf("error reading ai:tlscacert: %w", err)
+		}
+		if !certPool.AppendCertsFromPEM(pemBytes) {
+			return nil, fmt.Errorf("no certificates found in ai:tlscacert %q", opts.TlsCaCert)
+		}
+		tlsConfig.RootCAs = certPool
+	}
+	if opts.TlsClientCert != "" || opts.TlsClientKey != "" {
+		if opts.TlsClientCert == "" || opts.TlsClientKey == "" {
+			return nil, fmt.Errorf("ai:tlsclientcert and ai:tlsclientkey must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(wavebase.ExpandHomeDirSafe(opts.TlsClientCert), wavebase.ExpandHomeDirSafe(opts.TlsClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("error loading ai client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+func getAiTransport(opts *wshrpc.OpenAIOptsType) (http.RoundTripper, error) {
+	if !hasAiTlsOpts(opts) {
+		return http.DefaultTransport, nil
+	}
+	cacheKey := fmt.Sprintf("%v|%s|%s|%s", opts.TlsSkipVerify, opts.TlsCaCert, opts.TlsClientCert, opts.TlsClientKey)
+	aiTransportLock.Lock()
+	defer aiTransportLock.Unlock()
+	if transport := aiTransports[cacheKey]; transport != nil {
+		return transport, nil
+	}
+	tlsConfig, err := makeAiTlsConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	aiTransports[cacheKey] = transport
+	return transport, nil
+}
+
+// MakeAiHttpClient returns the http client for an ai request (with the profile's headers and tls options)
+func MakeAiHttpClient(opts *wshrpc.OpenAIOptsType) (*http.Client, error) {
+	if opts == nil {
+		return &http.Client{}, nil
+	}
+	transport, err := getAiTransport(opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.Headers) > 0 {
+		transport = &aiHeaderTransport{base: transport, headers: opts.Headers}
+	}
+	return &http.Client{Transport: transport}, nil
+}
@@ -0,0 +1,452 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package waveai
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/blockcontroller"
+	"github.com/wavetermdev/waveterm/pkg/diagbundle"
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/userinput"
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+	"github.com/wavetermdev/waveterm/pkg/wstore"
+)
+
+// local tools the model can call (when ai:tools is set).  all tools are read-only, and
+// each call needs the user's confirmation unless it matches an entry in ai:toolsautoapprove:
+// a tool name allows every call of the tool, and "<tool> <connection> <dir>" only allows a file
+// tool's calls for paths under dir on that connection (what the "Always allow" checkbox saves).
+
+const MaxToolRounds = 8
+const MaxToolOutput = 16 * 1024
+const MaxToolDirEntries = 500
+const ToolConfirmTimeout = 2 * time.Minute
+const ToolRunTimeout = 15 * time.Second
+
+type AiTool struct {
+	Def wshrpc.AiToolDef
+	Run func(ctx context.Context, input json.RawMessage) (string, error)
+}
+
+var aiToolRegistry = map[string]*AiTool{}
+
+func registerAiTool(tool *AiTool) {
+	aiToolRegistry[tool.Def.Name] = tool
+}
+
+func init() {
+	registerAiTool(&AiTool{
+		Def: wshrpc.AiToolDef{
+			Name:        "read_file",
+			Description: "Read a text file (up to 16KB) on the local machine or on one of the user's connections.",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"path":       map[string]any{"type": "string", "description": "absolute path (or ~/...) of the file"},
+					"connection": map[string]any{"type": "string", "description": "connection name (e.g. user@host), omit for the local machine"},
+				},
+				"required": []string{"path"},
+			},
+		},
+		Run: runReadFileTool,
+	})
+	registerAiTool(&AiTool{
+		Def: wshrpc.AiToolDef{
+			Name:        "list_directory",
+			Description: "List the entries of a directory on the local machine or on one of the user's connections.",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"path":       map[string]any{"type": "string", "description": "absolute path (or ~/...) of the directory"},
+					"connection": map[string]any{"type": "string", "description": "connection name (e.g. user@host), omit for the local machine"},
+				},
+				"required": []string{"path"},
+			},
+		},
+		Run: runListDirTool,
+	})
+	registerAiTool(&AiTool{
+		Def: wshrpc.AiToolDef{
+			Name:        "get_command_history",
+			Description: "Get the recent commands (with exit codes) run in the user's terminals.",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"limit": map[string]any{"type": "integer", "description": "max number of commands per terminal (default 20)"},
+				},
+			},
+		},
+		Run: runCommandHistoryTool,
+	})
+}
+
+func GetAiToolDefs() []wshrpc.AiToolDef {
+	var rtn []wshrpc.AiToolDef
+	for _, tool := range aiToolRegistry {
+		rtn = append(rtn, tool.Def)
+	}
+	slices.SortFunc(rtn, func(a, b wshrpc.AiToolDef) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return rtn
+}
+
+// tool calls are handled here (not in the backends), so only backends that can send tools get them
+func supportsTools(opts *wshrpc.OpenAIOptsType) bool {
+	if opts == nil || !opts.Tools {
+		return false
+	}
+	if opts.APIType == ApiType_Anthropic || IsLocalApiType(opts.APIType) {
+		return true
+	}
+	if opts.APIType == ApiType_Perplexity || IsCloudAIRequest(opts) {
+		return false
+	}
+	return !strings.HasPrefix(opts.Model, "o1-")
+}
+
+type fileToolInput struct {
+	Path       string `json:"path"`
+	Connection string `json:"connection,omitempty"`
+}
+
+func (input fileToolInput) connRoute() string {
+	connName := input.Connection
+	if connName == "" {
+		connName = wshrpc.LocalConnName
+	}
+	return wshutil.MakeConnectionRouteId(connName)
+}
+
+func streamFileForTool(ctx context.Context, input json.RawMessage, byteRange string) (*fileToolInput, []*wshrpc.FileInfo, []byte, error) {
+	var fileInput fileToolInput
+	if err := json.Unmarshal(input, &fileInput); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid input: %w", err)
+	}
+	if fileInput.Path == "" {
+		return nil, nil, nil, errors.New("path is required")
+	}
+	streamData := wshrpc.CommandRemoteStreamFileData{Path: fileInput.Path, ByteRange: byteRange}
+	rtnCh := wshclient.RemoteStreamFileCommand(wshclient.GetBareRpcClient(), streamData, &wshrpc.RpcOpts{Route: fileInput.connRoute(), Timeout: int(ToolRunTimeout.Milliseconds())})
+	var infos []*wshrpc.FileInfo
+	var fileBuf bytes.Buffer
+	for respUnion := range rtnCh {
+		if respUnion.Error != nil {
+			return nil, nil, nil, respUnion.Error
+		}
+		infos = append(infos, respUnion.Response.FileInfo...)
+		if respUnion.Response.Data64 != "" {
+			decoder := base64.NewDecoder(base64.StdEncoding, strings.NewReader(respUnion.Response.Data64))
+			if _, err := io.Copy(&fileBuf, decoder); err != nil {
+				return nil, nil, nil, fmt.Errorf("error decoding file data: %w", err)
+			}
+		}
+	}
+	if len(infos) == 0 {
+		return nil, nil, nil, errors.New("no file info returned")
+	}
+	if infos[0].NotFound {
+		return nil, nil, nil, fmt.Errorf("%s not found", fileInput.Path)
+	}
+	return &fileInput, infos, fileBuf.Bytes(), nil
+}
+
+func runReadFileTool(ctx context.Context, input json.RawMessage) (string, error) {
+	_, infos, data, err := streamFileForTool(ctx, input, fmt.Sprintf("0-%d", MaxToolOutput-1))
+	if err != nil {
+		return "", err
+	}
+	if infos[0].IsDir {
+		return "", fmt.Errorf("%s is a directory (use list_directory)", infos[0].Path)
+	}
+	if bytes.IndexByte(data, 0) != -1 {
+		return "", fmt.Errorf("%s is a binary file", infos[0].Path)
+	}
+	if infos[0].Size > int64(len(data)) {
+		return fmt.Sprintf("%s\n[truncated, showing the first %d of %d bytes]", data, len(data), infos[0].Size), nil
+	}
+	return string(data), nil
+}
+
+func runListDirTool(ctx context.Context, input json.RawMessage) (string, error) {
+	_, infos, _, err := streamFileForTool(ctx, input, fmt.Sprintf("0-%d", MaxToolDirEntries-1))
+	if err != nil {
+		return "", err
+	}
+	if !infos[0].IsDir {
+		return "", fmt.Errorf("%s is not a directory", infos[0].Path)
+	}
+	var buf strings.Builder
+	for _, info := range infos[1:] {
+		name := info.Name
+		if info.IsDir {
+			name += "/"
+		}
+		buf.WriteString(fmt.Sprintf("%s %10d %s %s\n", info.ModeStr, info.Size, time.UnixMilli(info.ModTime).Format("2006-01-02 15:04"), name))
+	}
+	if len(infos) == 1 {
+		return "(empty directory)", nil
+	}
+	return buf.String(), nil
+}
+
+func runCommandHistoryTool(ctx context.Context, input json.RawMessage) (string, error) {
+	var historyInput struct {
+		Limit int `json:"limit"`
+	}
+	if len(input) > 0 {
+		if err := json.Unmarshal(input, &historyInput); err != nil {
+			return "", fmt.Errorf("invalid input: %w", err)
+		}
+	}
+	if historyInput.Limit <= 0 {
+		historyInput.Limit = 20
+	}
+	blocks, err := wstore.DBGetAllObjsByType[*waveobj.Block](ctx, waveobj.OType_Block)
+	if err != nil {
+		return "", fmt.Errorf("error getting blocks: %w", err)
+	}
+	var buf strings.Builder
+	for _, block := range blocks {
+		siInfo := blockcontroller.GetShellIntegrationInfo(block.OID)
+		if siInfo == nil || len(siInfo.History) == 0 {
+			continue
+		}
+		connName := block.Meta.GetString(waveobj.MetaKey_Connection, "")
+		if connName == "" {
+			connName = wshrpc.LocalConnName
+		}
+		buf.WriteString(fmt.Sprintf("terminal on %s (cwd %s):\n", connName, siInfo.Cwd))
+		history := siInfo.History
+		if len(history) > historyInput.Limit {
+			history = history[len(history)-historyInput.Limit:]
+		}
+		for _, entry := range history {
+			exitStr := ""
+			if entry.HasExitCode {
+				exitStr = fmt.Sprintf(" [exit %d]", entry.ExitCode)
+			}
+			buf.WriteString(fmt.Sprintf("  %s%s\n", entry.Command, exitStr))
+		}
+	}
+	if buf.Len() == 0 {
+		return "(no command history, shell integration is only supported for bash and zsh)", nil
+	}
+	return buf.String(), nil
+}
+
+var windowsDrivePathRe = regexp.MustCompile(`^[A-Za-z]:/`)
+
+// the connection and cleaned path of a file tool call ("" if it isn't a file tool, or the path
+// isn't absolute).  ".." is resolved so a path can't leave an approved directory.
+func getFileToolScope(toolCall wshrpc.AiToolCall) (string, string) {
+	if toolCall.Name != "read_file" && toolCall.Name != "list_directory" {
+		return "", ""
+	}
+	var input fileToolInput
+	if err := json.Unmarshal([]byte(toolCall.Input), &input); err != nil {
+		return "", ""
+	}
+	cleanPath := path.Clean(strings.ReplaceAll(input.Path, "\\", "/"))
+	if !strings.HasPrefix(cleanPath, "/") && !strings.HasPrefix(cleanPath, "~/") && !windowsDrivePathRe.MatchString(cleanPath) {
+		return "", ""
+	}
+	connName := input.Connection
+	if connName == "" {
+		connName = wshrpc.LocalConnName
+	}
+	return connName, cleanPath
+}
+
+func toolApproveEntryMatches(entry string, toolName string, connName string, cleanPath string) bool {
+	parts := strings.SplitN(entry, " ", 3)
+	if parts[0] != toolName {
+		return false
+	}
+	if len(parts) == 1 {
+		return true
+	}
+	if len(parts) != 3 || cleanPath == "" || parts[1] != connName {
+		return false
+	}
+	dir := path.Clean(parts[2])
+	return cleanPath == dir || strings.HasPrefix(cleanPath, strings.TrimSuffix(dir, "/")+"/")
+}
+
+func isToolAutoApproved(toolCall wshrpc.AiToolCall) bool {
+	connName, cleanPath := getFileToolScope(toolCall)
+	for _, entry := range wconfig.GetWatcher().GetFullConfig().Settings.AiToolsAutoApprove {
+		if toolApproveEntryMatches(entry, toolCall.Name, connName, cleanPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// the ai:toolsautoapprove entry (and checkbox message) for always allowing calls like this one.
+// file tools are only allowed in the directory of the call, on its connection.
+func getToolApproveEntry(toolCall wshrpc.AiToolCall) (string, string) {
+	if toolCall.Name != "read_file" && toolCall.Name != "list_directory" {
+		return toolCall.Name, fmt.Sprintf("Always allow %s", toolCall.Name)
+	}
+	connName, cleanPath := getFileToolScope(toolCall)
+	if cleanPath == "" {
+		return "", ""
+	}
+	dir := cleanPath
+	if toolCall.Name == "read_file" {
+		dir = path.Dir(cleanPath)
+	}
+	return fmt.Sprintf("%s %s %s", toolCall.Name, connName, dir), fmt.Sprintf("Always allow %s in %s on %s", toolCall.Name, dir, connName)
+}
+
+var backtickRunRe = regexp.MustCompile("`+")
+
+// a code block for text the user has to read as-is.  the fence is longer than any run of
+// backticks in text, so the text can't end the block and add its own markdown.
+func makeMarkdownCodeBlock(text string) string {
+	fenceLen := 3
+	for _, run := range backtickRunRe.FindAllString(text, -1) {
+		fenceLen = max(fenceLen, len(run)+1)
+	}
+	fence := strings.Repeat("`", fenceLen)
+	return fmt.Sprintf("%s\n%s\n%s", fence, text, fence)
+}
+
+// asks the user to allow a tool call (they can choose to always allow calls like it)
+func confirmToolCall(ctx context.Context, toolCall wshrpc.AiToolCall) error {
+	if isToolAutoApproved(toolCall) {
+		return nil
+	}
+	ctx, cancelFn := context.WithTimeout(ctx, ToolConfirmTimeout)
+	defer cancelFn()
+	approveEntry, checkboxMsg := getToolApproveEntry(toolCall)
+	request := &userinput.UserInputRequest{
+		ResponseType: userinput.ResponseType_Confirm,
+		Title:        "Allow AI Tool?",
+		QueryText:    fmt.Sprintf("The AI wants to run the **%s** tool with:\n\n%s", toolCall.Name, makeMarkdownCodeBlock(toolCall.Input)),
+		Markdown:     true,
+		CheckBoxMsg:  checkboxMsg,
+		OkLabel:      "Allow",
+		CancelLabel:  "Deny",
+	}
+	resp, err := userinput.GetUserInput(ctx, request)
+	if err != nil {
+		return err
+	}
+	if !resp.Confirm {
+		return errors.New("the user denied this tool call")
+	}
+	if resp.CheckboxStat && approveEntry != "" {
+		autoApprove := append(slices.Clone(wconfig.GetWatcher().GetFullConfig().Settings.AiToolsAutoApprove), approveEntry)
+		err := wconfig.SetBaseConfigValue(waveobj.MetaMapType{"ai:toolsautoapprove": autoApprove})
+		if err != nil {
+			log.Printf("error saving ai:toolsautoapprove: %v\n", err)
+		}
+	}
+	return nil
+}
+
+// runs a tool call, errors are returned to the model as the tool result
+func runToolCall(ctx context.Context, toolCall wshrpc.AiToolCall) string {
+	tool := aiToolRegistry[toolCall.Name]
+	if tool == nil {
+		return fmt.Sprintf("error: unknown tool %q", toolCall.Name)
+	}
+	if err := confirmToolCall(ctx, toolCall); err != nil {
+		return fmt.Sprintf("error: %v", err)
+	}
+	input := json.RawMessage(toolCall.Input)
+	if strings.TrimSpace(toolCall.Input) == "" {
+		input = json.RawMessage("{}")
+	}
+	ctx, cancelFn := context.WithTimeout(ctx, ToolRunTimeout)
+	defer cancelFn()
+	output, err := tool.Run(ctx, input)
+	if err != nil {
+		return fmt.Sprintf("error: %v", err)
+	}
+	output, _ = tailText(output, MaxToolOutput)
+	output, _ = diagbundle.SanitizeText(output)
+	return output
+}
+
+func makeAITextPacket(text string) wshrpc.RespOrErrorUnion[wshrpc.OpenAIPacketType] {
+	pk := MakeOpenAIPacket()
+	pk.Text = text
+	return wshrpc.RespOrErrorUnion[wshrpc.OpenAIPacketType]{Response: *pk}
+}
+
+// runs the completion, and when the model calls tools, runs them (after confirmation) and
+// sends the results back to the model.  text is streamed through, tool calls are shown inline.
+func runWithTools(ctx context.Context, backend AIBackend, request wshrpc.OpenAiStreamRequest) chan wshrpc.RespOrErrorUnion[wshrpc.OpenAIPacketType] {
+	rtn := make(chan wshrpc.RespOrErrorUnion[wshrpc.OpenAIPacketType])
+	go func() {
+		defer func() {
+			panicErr := panichandler.PanicHandler("waveai.runWithTools")
+			if panicErr != nil {
+				rtn <- makeAIError(panicErr)
+			}
+			close(rtn)
+		}()
+		request.Tools = GetAiToolDefs()
+		for round := 0; round < MaxToolRounds; round++ {
+			var toolCalls []wshrpc.AiToolCall
+			var textBuf strings.Builder
+			backendCh := backend.StreamCompletion(ctx, request)
+			for resp := range backendCh {
+				if resp.Error != nil {
+					rtn <- resp
+					go func() {
+						for range backendCh {
+						}
+					}()
+					return
+				}
+				if len(resp.Response.ToolCalls) > 0 {
+					toolCalls = append(toolCalls, resp.Response.ToolCalls...)
+					continue
+				}
+				textBuf.WriteString(resp.Response.Text)
+				rtn <- resp
+			}
+			if len(toolCalls) == 0 {
+				return
+			}
+			request.Prompt = append(request.Prompt, wshrpc.OpenAIPromptMessageType{
+				Role:      "assistant",
+				Content:   textBuf.String(),
+				ToolCalls: toolCalls,
+			})
+			for _, toolCall := range toolCalls {
+				rtn <- makeAITextPacket(fmt.Sprintf("\n\n> running tool `%s` `%s`\n\n", toolCall.Name, toolCall.Input))
+				request.Prompt = append(request.Prompt, wshrpc.OpenAIPromptMessageType{
+					Role:       "tool",
+					Name:       toolCall.Name,
+					ToolCallId: toolCall.Id,
+					Content:    runToolCall(ctx, toolCall),
+				})
+			}
+		}
+		rtn <- makeAIError(fmt.Errorf("stopped after %d rounds of tool calls", MaxToolRounds))
+	}()
+	return rtn
+}
@@ -0,0 +1,299 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package waveai
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/usagestats"
+	"github.com/wavetermdev/waveterm/pkg/util/daystr"
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// token usage is recorded per day in the local usage stats (per provider and profile), and
+// checked against the ai:dailytokenlimit and ai:monthlytokenlimit settings (and the same
+// keys in a preset, which limit just that preset) before each request.
+
+const (
+	TokenLimitAction_Warn  = "warn"
+	TokenLimitAction_Block = "block"
+)
+
+const AiProvider_WaveCloud = "wavecloud"
+
+func aiProviderName(opts *wshrpc.OpenAIOptsType) string {
+	if IsCloudAIRequest(opts) {
+		return AiProvider_WaveCloud
+	}
+	if opts.APIType == "" {
+		return "openai"
+	}
+	return opts.APIType
+}
+
+// AiUsageKey is the usage stats key for a request, "provider|profile".  the profile is the
+// preset, or the model when the request doesn't come from a preset.
+func AiUsageKey(opts *wshrpc.OpenAIOptsType) string {
+	profile := "default"
+	if opts != nil && opts.Preset != "" {
+		profile = opts.Preset
+	} else if opts != nil && opts.Model != "" {
+		profile = opts.Model
+	}
+	return aiProviderName(opts) + "|" + profile
+}
+
+func splitAiUsageKey(key string) (string, string) {
+	provider, profile, _ := strings.Cut(key, "|")
+	return provider, profile
+}
+
+// wraps a backend to record the token usage of each completion (including each tool round)
+type usageTrackingBackend struct {
+	backend AIBackend
+	key     string
+}
+
+func (b usageTrackingBackend) StreamCompletion(ctx context.Context, request wshrpc.OpenAiStreamRequest) chan wshrpc.RespOrErrorUnion[wshrpc.OpenAIPacketType] {
+	backendCh := b.backend.StreamCompletion(ctx, request)
+	rtn := make(chan wshrpc.RespOrErrorUnion[wshrpc.OpenAIPacketType])
+	go func() {
+		defer func() {
+			panichandler.PanicHandler("waveai.usageTrackingBackend")
+			close(rtn)
+		}()
+		// some providers send cumulative usage more than once (anthropic sends the prompt
+		// tokens at the start and the completion tokens at the end), so keep the max of each
+		var promptTokens, completionTokens int
+		for resp := range backendCh {
+			if resp.Error == nil && resp.Response.Usage != nil {
+				promptTokens = max(promptTokens, resp.Response.Usage.PromptTokens)
+				completionTokens = max(completionTokens, resp.Response.Usage.CompletionTokens)
+			}
+			select {
+			case rtn <- resp:
+			case <-ctx.Done():
+			}
+		}
+		usagestats.GoAdd(usagestats.Stat_AiRequests, b.key, 1)
+		if promptTokens > 0 {
+			usagestats.GoAdd(usagestats.Stat_AiPromptTokens, b.key, int64(promptTokens))
+		}
+		if completionTokens > 0 {
+			usagestats.GoAdd(usagestats.Stat_AiCompletionTokens, b.key, int64(completionTokens))
+		}
+	}()
+	return rtn
+}
+
+func getTokenLimitAction(settings wconfig.SettingsType) string {
+	if settings.AiTokenLimitAction == TokenLimitAction_Block {
+		return TokenLimitAction_Block
+	}
+	return TokenLimitAction_Warn
+}
+
+// returns the total tokens (prompt + completion) per usage key since sinceDay
+func getTokenTotals(ctx context.Context, sinceDay string) (map[string]int64, error) {
+	promptTotals, err := usagestats.GetTotals(ctx, usagestats.Stat_AiPromptTokens, sinceDay)
+	if err != nil {
+		return nil, err
+	}
+	completionTotals, err := usagestats.GetTotals(ctx, usagestats.Stat_AiCompletionTokens, sinceDay)
+	if err != nil {
+		return nil, err
+	}
+	for key, val := range completionTotals {
+		promptTotals[key] += val
+	}
+	return promptTotals, nil
+}
+
+func sumTokens(totals map[string]int64, profile string) int64 {
+	var rtn int64
+	for key, val := range totals {
+		if _, keyProfile := splitAiUsageKey(key); profile == "" || keyProfile == profile {
+			rtn += val
+		}
+	}
+	return rtn
+}
+
+func monthStartDay() string {
+	dayStr, err := daystr.GetCustomDayStr("bom")
+	if err != nil {
+		return daystr.GetCurDayStr()
+	}
+	return dayStr
+}
+
+type tokenLimitCheck struct {
+	name    string
+	limit   int64
+	totals  map[string]int64
+	profile string // empty for the global limits
+}
+
+// checkTokenLimits returns an error describing the first exceeded limit (nil if no limit is exceeded)
+func checkTokenLimits(ctx context.Context, opts *wshrpc.OpenAIOptsType) error {
+	fullConfig := wconfig.GetWatcher().GetFullConfig()
+	settings := fullConfig.Settings
+	var presetDaily, presetMonthly int64
+	if opts != nil && opts.Preset != "" {
+		preset := fullConfig.Presets[opts.Preset]
+		presetDaily = int64(preset.GetFloat("ai:dailytokenlimit", 0))
+		presetMonthly = int64(preset.GetFloat("ai:monthlytokenlimit", 0))
+	}
+	if settings.AiDailyTokenLimit <= 0 && settings.AiMonthlyTokenLimit <= 0 && presetDaily <= 0 && presetMonthly <= 0 {
+		return nil
+	}
+	// the limits are not enforced if the usage can't be read
+	dayTotals, err := getTokenTotals(ctx, daystr.GetCurDayStr())
+	if err != nil {
+		log.Printf("error checking ai token limits: %v\n", err)
+		return nil
+	}
+	monthTotals, err := getTokenTotals(ctx, monthStartDay())
+	if err != nil {
+		log.Printf("error checking ai token limits: %v\n", err)
+		return nil
+	}
+	checks := []tokenLimitCheck{
+		{"daily", int64(settings.AiDailyTokenLimit), dayTotals, ""},
+		{"monthly", int64(settings.AiMonthlyTokenLimit), monthTotals, ""},
+	}
+	if opts != nil && opts.Preset != "" {
+		checks = append(checks,
+			tokenLimitCheck{"daily", presetDaily, dayTotals, opts.Preset},
+			tokenLimitCheck{"monthly", presetMonthly, monthTotals, opts.Preset},
+		)
+	}
+	for _, check := range checks {
+		if check.limit <= 0 {
+			continue
+		}
+		used := sumTokens(check.totals, check.profile)
+		if used < check.limit {
+			continue
+		}
+		if check.profile != "" {
+			return fmt.Errorf("%s ai token limit for %s exceeded (%d of %d tokens used)", check.name, check.profile, used, check.limit)
+		}
+		return fmt.Errorf("%s ai token limit exceeded (%d of %d tokens used)", check.name, used, check.limit)
+	}
+	return nil
+}
+
+// applies the token limits to a request.  with the "block" action the request fails, otherwise a
+// warning is sent before the response.
+func runWithTokenLimits(ctx context.Context, request wshrpc.OpenAiStreamRequest, runFn func() chan wshrpc.RespOrErrorUnion[wshrpc.OpenAIPacketType]) chan wshrpc.RespOrErrorUnion[wshrpc.OpenAIPacketType] {
+	limitErr := checkTokenLimits(ctx, request.Opts)
+	if limitErr == nil {
+		return runFn()
+	}
+	settings := wconfig.GetWatcher().GetFullConfig().Settings
+	if getTokenLimitAction(settings) == TokenLimitAction_Block {
+		rtn := make(chan wshrpc.RespOrErrorUnion[wshrpc.OpenAIPacketType], 1)
+		rtn <- makeAIError(fmt.Errorf("%w (see ai:tokenlimitaction, or wsh aiusage)", limitErr))
+		close(rtn)
+		return rtn
+	}
+	log.Printf("ai token limit warning: %v\n", limitErr)
+	rtn := make(chan wshrpc.RespOrErrorUnion[wshrpc.OpenAIPacketType])
+	go func() {
+		defer func() {
+			panichandler.PanicHandler("waveai.runWithTokenLimits")
+			close(rtn)
+		}()
+		pk := MakeOpenAIPacket()
+		pk.Text = fmt.Sprintf("_warning: %v_\n\n", limitErr)
+		rtn <- wshrpc.RespOrErrorUnion[wshrpc.OpenAIPacketType]{Response: *pk}
+		for resp := range runFn() {
+			rtn <- resp
+		}
+	}()
+	return rtn
+}
+
+func makeAiUsageEntries(ctx context.Context, sinceDay string) ([]wshrpc.AiUsageEntry, int64, error) {
+	entries := make(map[string]*wshrpc.AiUsageEntry)
+	getEntry := func(key string) *wshrpc.AiUsageEntry {
+		if entries[key] == nil {
+			provider, profile := splitAiUsageKey(key)
+			entries[key] = &wshrpc.AiUsageEntry{Provider: provider, Profile: profile}
+		}
+		return entries[key]
+	}
+	statTypes := []string{usagestats.Stat_AiRequests, usagestats.Stat_AiPromptTokens, usagestats.Stat_AiCompletionTokens}
+	for _, statType := range statTypes {
+		totals, err := usagestats.GetTotals(ctx, statType, sinceDay)
+		if err != nil {
+			return nil, 0, err
+		}
+		for key, val := range totals {
+			entry := getEntry(key)
+			switch statType {
+			case usagestats.Stat_AiRequests:
+				entry.Requests += val
+			case usagestats.Stat_AiPromptTokens:
+				entry.PromptTokens += val
+			case usagestats.Stat_AiCompletionTokens:
+				entry.CompletionTokens += val
+			}
+		}
+	}
+	rtn := make([]wshrpc.AiUsageEntry, 0, len(entries))
+	var totalTokens int64
+	for _, entry := range entries {
+		totalTokens += entry.PromptTokens + entry.CompletionTokens
+		rtn = append(rtn, *entry)
+	}
+	sort.Slice(rtn, func(i, j int) bool {
+		iTokens, jTokens := rtn[i].PromptTokens+rtn[i].CompletionTokens, rtn[j].PromptTokens+rtn[j].CompletionTokens
+		if iTokens != jTokens {
+			return iTokens > jTokens
+		}
+		return rtn[i].Provider+rtn[i].Profile < rtn[j].Provider+rtn[j].Profile
+	})
+	return rtn, totalTokens, nil
+}
+
+// GetAiUsage returns today's and this month's token usage, with the configured limits
+func GetAiUsage(ctx context.Context) (*wshrpc.AiUsageSummary, error) {
+	fullConfig := wconfig.GetWatcher().GetFullConfig()
+	settings := fullConfig.Settings
+	rtn := &wshrpc.AiUsageSummary{
+		Day:          daystr.GetCurDayStr(),
+		MonthStart:   monthStartDay(),
+		DailyLimit:   int64(settings.AiDailyTokenLimit),
+		MonthlyLimit: int64(settings.AiMonthlyTokenLimit),
+		LimitAction:  getTokenLimitAction(settings),
+	}
+	var err error
+	rtn.Today, rtn.DayTokens, err = makeAiUsageEntries(ctx, rtn.Day)
+	if err != nil {
+		return nil, err
+	}
+	rtn.Month, rtn.MonthTokens, err = makeAiUsageEntries(ctx, rtn.MonthStart)
+	if err != nil {
+		return nil, err
+	}
+	for _, entries := range [][]wshrpc.AiUsageEntry{rtn.Today, rtn.Month} {
+		for idx := range entries {
+			preset, ok := fullConfig.Presets[entries[idx].Profile]
+			if !ok {
+				continue
+			}
+			entries[idx].DailyLimit = int64(preset.GetFloat("ai:dailytokenlimit", 0))
+			entries[idx].MonthlyLimit = int64(preset.GetFloat("ai:monthlytokenlimit", 0))
+		}
+	}
+	return rtn, nil
+}
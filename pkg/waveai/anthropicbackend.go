@@ -24,7 +24,13 @@ var _ AIBackend = AnthropicBackend{}
 // Claude API request types
 type anthropicMessage struct {
 	Role    string `json:"role"`
-	Content string `json:"content"`
+	Content any    `json:"content"` // string or []anthropicContentBlock
+}
+
+type anthropicTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"input_schema"`
 }
 
 type anthropicRequest struct {
@@ -33,13 +39,19 @@ type anthropicRequest struct {
 	System      string             `json:"system,omitempty"`
 	MaxTokens   int                `json:"max_tokens,omitempty"`
 	Stream      bool               `json:"stream"`
-	Temperature float32            `json:"temperature,omitempty"`
+	Temperature *float64           `json:"temperature,omitempty"`
+	Tools       []anthropicTool    `json:"tools,omitempty"`
 }
 
 // Claude API response types for SSE events
 type anthropicContentBlock struct {
-	Type string `json:"type"` // "text" or other content types
-	Text string `json:"text,omitempty"`
+	Type      string          `json:"type"` // "text", "tool_use", or "tool_result"
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`          // tool_use
+	Name      string          `json:"name,omitempty"`        // tool_use
+	Input     json.RawMessage `json:"input,omitempty"`       // tool_use
+	ToolUseID string          `json:"tool_use_id,omitempty"` // tool_result
+	Content   string          `json:"content,omitempty"`     // tool_result
 }
 
 type anthropicUsage struct {
@@ -64,11 +76,14 @@ type anthropicStreamEventError struct {
 }
 
 type anthropicStreamEventDelta struct {
-	Text string `json:"text"`
+	Type        string `json:"type"` // "text_delta" or "input_json_delta"
+	Text        string `json:"text"`
+	PartialJson string `json:"partial_json,omitempty"`
 }
 
 type anthropicStreamEvent struct {
 	Type         string                     `json:"type"`
+	Index        int                        `json:"index"`
 	Message      *anthropicResponseMessage  `json:"message,omitempty"`
 	ContentBlock *anthropicContentBlock     `json:"content_block,omitempty"`
 	Delta        *anthropicStreamEventDelta `json:"delta,omitempty"`
@@ -144,6 +159,35 @@ func (AnthropicBackend) StreamCompletion(ctx context.Context, request wshrpc.Ope
 				continue
 			}
 
+			if msg.Role == "tool" {
+				resultBlock := anthropicContentBlock{Type: "tool_result", ToolUseID: msg.ToolCallId, Content: msg.Content}
+				// all the results for one assistant turn go in a single user message
+				if len(messages) > 0 {
+					if blocks, ok := messages[len(messages)-1].Content.([]anthropicContentBlock); ok && messages[len(messages)-1].Role == "user" {
+						messages[len(messages)-1].Content = append(blocks, resultBlock)
+						continue
+					}
+				}
+				messages = append(messages, anthropicMessage{Role: "user", Content: []anthropicContentBlock{resultBlock}})
+				continue
+			}
+
+			if msg.Role == "assistant" && len(msg.ToolCalls) > 0 {
+				var blocks []anthropicContentBlock
+				if msg.Content != "" {
+					blocks = append(blocks, anthropicContentBlock{Type: "text", Text: msg.Content})
+				}
+				for _, toolCall := range msg.ToolCalls {
+					input := json.RawMessage(toolCall.Input)
+					if !json.Valid(input) {
+						input = json.RawMessage("{}")
+					}
+					blocks = append(blocks, anthropicContentBlock{Type: "tool_use", ID: toolCall.Id, Name: toolCall.Name, Input: input})
+				}
+				messages = append(messages, anthropicMessage{Role: "assistant", Content: blocks})
+				continue
+			}
+
 			role := "user"
 			if msg.Role == "assistant" {
 				role = "assistant"
@@ -155,12 +199,19 @@ func (AnthropicBackend) StreamCompletion(ctx context.Context, request wshrpc.Ope
 			})
 		}
 
+		var tools []anthropicTool
+		for _, tool := range request.Tools {
+			tools = append(tools, anthropicTool{Name: tool.Name, Description: tool.Description, InputSchema: tool.Parameters})
+		}
+
 		anthropicReq := anthropicRequest{
-			Model:     model,
-			Messages:  messages,
-			System:    systemPrompt,
-			Stream:    true,
-			MaxTokens: request.Opts.MaxTokens,
+			Model:       model,
+			Messages:    messages,
+			System:      systemPrompt,
+			Stream:      true,
+			MaxTokens:   request.Opts.MaxTokens,
+			Temperature: request.Opts.Temperature,
+			Tools:       tools,
 		}
 
 		reqBody, err := json.Marshal(anthropicReq)
@@ -180,7 +231,11 @@ func (AnthropicBackend) StreamCompletion(ctx context.Context, request wshrpc.Ope
 		req.Header.Set("x-api-key", request.Opts.APIToken)
 		req.Header.Set("anthropic-version", "2023-06-01")
 
-		client := &http.Client{}
+		client, err := MakeAiHttpClient(request.Opts)
+		if err != nil {
+			rtn <- makeAIError(err)
+			return
+		}
 		resp, err := client.Do(req)
 		if err != nil {
 			rtn <- makeAIError(fmt.Errorf("failed to send anthropic request: %v", err))
@@ -195,6 +250,9 @@ func (AnthropicBackend) StreamCompletion(ctx context.Context, request wshrpc.Ope
 		}
 
 		reader := bufio.NewReader(resp.Body)
+		// tool_use blocks, by content block index (the input json is streamed in pieces)
+		toolCallsByIndex := make(map[int]*wshrpc.AiToolCall)
+		var toolCallOrder []int
 		for {
 			// Check for context cancellation
 			select {
@@ -233,18 +291,32 @@ func (AnthropicBackend) StreamCompletion(ctx context.Context, request wshrpc.Ope
 				if event.Message != nil {
 					pk := MakeOpenAIPacket()
 					pk.Model = event.Message.Model
+					if event.Message.Usage != nil {
+						pk.Usage = &wshrpc.OpenAIUsageType{
+							PromptTokens:     event.Message.Usage.InputTokens,
+							CompletionTokens: event.Message.Usage.OutputTokens,
+							TotalTokens:      event.Message.Usage.InputTokens + event.Message.Usage.OutputTokens,
+						}
+					}
 					rtn <- wshrpc.RespOrErrorUnion[wshrpc.OpenAIPacketType]{Response: *pk}
 				}
 
 			case "content_block_start":
-				if event.ContentBlock != nil && event.ContentBlock.Text != "" {
+				if event.ContentBlock != nil && event.ContentBlock.Type == "tool_use" {
+					toolCallsByIndex[event.Index] = &wshrpc.AiToolCall{Id: event.ContentBlock.ID, Name: event.ContentBlock.Name}
+					toolCallOrder = append(toolCallOrder, event.Index)
+				} else if event.ContentBlock != nil && event.ContentBlock.Text != "" {
 					pk := MakeOpenAIPacket()
 					pk.Text = event.ContentBlock.Text
 					rtn <- wshrpc.RespOrErrorUnion[wshrpc.OpenAIPacketType]{Response: *pk}
 				}
 
 			case "content_block_delta":
-				if event.Delta != nil && event.Delta.Text != "" {
+				if event.Delta != nil && event.Delta.Type == "input_json_delta" {
+					if toolCall := toolCallsByIndex[event.Index]; toolCall != nil {
+						toolCall.Input += event.Delta.PartialJson
+					}
+				} else if event.Delta != nil && event.Delta.Text != "" {
 					pk := MakeOpenAIPacket()
 					pk.Text = event.Delta.Text
 					rtn <- wshrpc.RespOrErrorUnion[wshrpc.OpenAIPacketType]{Response: *pk}
@@ -268,6 +340,13 @@ func (AnthropicBackend) StreamCompletion(ctx context.Context, request wshrpc.Ope
 				}
 
 			case "message_stop":
+				if len(toolCallOrder) > 0 {
+					pk := MakeOpenAIPacket()
+					for _, idx := range toolCallOrder {
+						pk.ToolCalls = append(pk.ToolCalls, *toolCallsByIndex[idx])
+					}
+					rtn <- wshrpc.RespOrErrorUnion[wshrpc.OpenAIPacketType]{Response: *pk}
+				}
 				if event.Message != nil {
 					pk := MakeOpenAIPacket()
 					pk.FinishReason = event.Message.StopReason
@@ -74,6 +74,7 @@ func (WaveAICloudBackend) StreamCompletion(ctx context.Context, request wshrpc.O
 			if promptMsg.Role == "error" {
 				continue
 			}
+			promptMsg.Ts = 0
 			sendablePromptMsgs = append(sendablePromptMsgs, promptMsg)
 		}
 		reqPk := MakeOpenAICloudReqPacket()
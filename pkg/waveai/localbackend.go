@@ -0,0 +1,134 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package waveai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// local, OpenAI-compatible servers.  these never fall back to the wave cloud proxy,
+// and don't require an api token.
+const ApiType_Local = "local"
+const ApiType_Ollama = "ollama"
+const ApiType_LlamaCpp = "llamacpp"
+const ApiType_LMStudio = "lmstudio"
+
+const ListModelsTimeout = 5 * time.Second
+
+var localDefaultBaseURLs = map[string]string{
+	ApiType_Local:    "http://localhost:11434/v1",
+	ApiType_Ollama:   "http://localhost:11434/v1",
+	ApiType_LlamaCpp: "http://localhost:8080/v1",
+	ApiType_LMStudio: "http://localhost:1234/v1",
+}
+
+type LocalBackend struct{}
+
+var _ AIBackend = LocalBackend{}
+
+func IsLocalApiType(apiType string) bool {
+	_, ok := localDefaultBaseURLs[strings.ToLower(apiType)]
+	return ok
+}
+
+func getLocalBaseURL(opts *wshrpc.OpenAIOptsType) string {
+	if opts.BaseURL != "" {
+		return strings.TrimSuffix(opts.BaseURL, "/")
+	}
+	return localDefaultBaseURLs[strings.ToLower(opts.APIType)]
+}
+
+type modelListResponse struct {
+	Data []struct {
+		Id string `json:"id"`
+	} `json:"data"`
+}
+
+// ListModels returns the models available from an OpenAI-compatible server (GET <baseurl>/models)
+func ListModels(ctx context.Context, opts *wshrpc.OpenAIOptsType) ([]string, error) {
+	if opts == nil {
+		return nil, errors.New("no ai opts found")
+	}
+	baseURL := opts.BaseURL
+	if IsLocalApiType(opts.APIType) {
+		baseURL = getLocalBaseURL(opts)
+	}
+	if baseURL == "" {
+		return nil, errors.New("no base url to list models from")
+	}
+	ctx, cancelFn := context.WithTimeout(ctx, ListModelsTimeout)
+	defer cancelFn()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(baseURL, "/")+"/models", nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	if opts.APIToken != "" {
+		req.Header.Set("Authorization", "Bearer "+opts.APIToken)
+	}
+	client, err := MakeAiHttpClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error contacting %s (is the server running?): %w", baseURL, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading model list: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error listing models from %s: %s", baseURL, resp.Status)
+	}
+	var modelList modelListResponse
+	err = json.Unmarshal(body, &modelList)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding model list: %w", err)
+	}
+	var rtn []string
+	for _, model := range modelList.Data {
+		rtn = append(rtn, model.Id)
+	}
+	sort.Strings(rtn)
+	return rtn, nil
+}
+
+func (LocalBackend) StreamCompletion(ctx context.Context, request wshrpc.OpenAiStreamRequest) chan wshrpc.RespOrErrorUnion[wshrpc.OpenAIPacketType] {
+	if request.Opts == nil {
+		rtn := make(chan wshrpc.RespOrErrorUnion[wshrpc.OpenAIPacketType], 1)
+		rtn <- makeAIError(errors.New("no ai opts found"))
+		close(rtn)
+		return rtn
+	}
+	opts := *request.Opts
+	opts.BaseURL = getLocalBaseURL(&opts)
+	opts.APIType = ""
+	if opts.Model == "" {
+		// use the first model the server has
+		models, err := ListModels(ctx, &opts)
+		if err == nil && len(models) == 0 {
+			err = fmt.Errorf("no models available at %s", opts.BaseURL)
+		}
+		if err != nil {
+			rtn := make(chan wshrpc.RespOrErrorUnion[wshrpc.OpenAIPacketType], 1)
+			rtn <- makeAIError(err)
+			close(rtn)
+			return rtn
+		}
+		opts.Model = models[0]
+	}
+	request.Opts = &opts
+	return OpenAIBackend{}.StreamCompletion(ctx, request)
+}
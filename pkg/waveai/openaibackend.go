@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"regexp"
 	"strings"
 
@@ -25,6 +26,16 @@ func defaultAzureMapperFn(model string) string {
 	return regexp.MustCompile(`[.:]`).ReplaceAllString(model, "")
 }
 
+// azure routes requests by deployment name, ai:azuredeployment overrides the name derived from the model
+func makeAzureMapperFn(opts *wshrpc.OpenAIOptsType) func(string) string {
+	if opts.AzureDeployment == "" {
+		return defaultAzureMapperFn
+	}
+	return func(string) string {
+		return opts.AzureDeployment
+	}
+}
+
 func setApiType(opts *wshrpc.OpenAIOptsType, clientConfig *openaiapi.ClientConfig) error {
 	ourApiType := strings.ToLower(opts.APIType)
 	if ourApiType == "" || ourApiType == strings.ToLower(string(openaiapi.APITypeOpenAI)) {
@@ -33,17 +44,17 @@ func setApiType(opts *wshrpc.OpenAIOptsType, clientConfig *openaiapi.ClientConfi
 	} else if ourApiType == strings.ToLower(string(openaiapi.APITypeAzure)) {
 		clientConfig.APIType = openaiapi.APITypeAzure
 		clientConfig.APIVersion = DefaultAzureAPIVersion
-		clientConfig.AzureModelMapperFunc = defaultAzureMapperFn
+		clientConfig.AzureModelMapperFunc = makeAzureMapperFn(opts)
 		return nil
 	} else if ourApiType == strings.ToLower(string(openaiapi.APITypeAzureAD)) {
 		clientConfig.APIType = openaiapi.APITypeAzureAD
 		clientConfig.APIVersion = DefaultAzureAPIVersion
-		clientConfig.AzureModelMapperFunc = defaultAzureMapperFn
+		clientConfig.AzureModelMapperFunc = makeAzureMapperFn(opts)
 		return nil
 	} else if ourApiType == strings.ToLower(string(openaiapi.APITypeCloudflareAzure)) {
 		clientConfig.APIType = openaiapi.APITypeCloudflareAzure
 		clientConfig.APIVersion = DefaultAzureAPIVersion
-		clientConfig.AzureModelMapperFunc = defaultAzureMapperFn
+		clientConfig.AzureModelMapperFunc = makeAzureMapperFn(opts)
 		return nil
 	} else {
 		return fmt.Errorf("invalid api type %q", opts.APIType)
@@ -53,12 +64,62 @@ func setApiType(opts *wshrpc.OpenAIOptsType, clientConfig *openaiapi.ClientConfi
 func convertPrompt(prompt []wshrpc.OpenAIPromptMessageType) []openaiapi.ChatCompletionMessage {
 	var rtn []openaiapi.ChatCompletionMessage
 	for _, p := range prompt {
-		msg := openaiapi.ChatCompletionMessage{Role: p.Role, Content: p.Content, Name: p.Name}
+		msg := openaiapi.ChatCompletionMessage{Role: p.Role, Content: p.Content, Name: p.Name, ToolCallID: p.ToolCallId}
+		for _, toolCall := range p.ToolCalls {
+			msg.ToolCalls = append(msg.ToolCalls, openaiapi.ToolCall{
+				ID:       toolCall.Id,
+				Type:     openaiapi.ToolTypeFunction,
+				Function: openaiapi.FunctionCall{Name: toolCall.Name, Arguments: toolCall.Input},
+			})
+		}
 		rtn = append(rtn, msg)
 	}
 	return rtn
 }
 
+func convertTools(tools []wshrpc.AiToolDef) []openaiapi.Tool {
+	var rtn []openaiapi.Tool
+	for _, tool := range tools {
+		rtn = append(rtn, openaiapi.Tool{
+			Type: openaiapi.ToolTypeFunction,
+			Function: &openaiapi.FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	return rtn
+}
+
+// tool calls are streamed in pieces (by index), the arguments are json fragments
+func accumulateToolCalls(toolCalls []wshrpc.AiToolCall, deltas []openaiapi.ToolCall) []wshrpc.AiToolCall {
+	for _, delta := range deltas {
+		idx := len(toolCalls)
+		if delta.Index != nil {
+			idx = *delta.Index
+		}
+		for len(toolCalls) <= idx {
+			toolCalls = append(toolCalls, wshrpc.AiToolCall{})
+		}
+		if delta.ID != "" {
+			toolCalls[idx].Id = delta.ID
+		}
+		if delta.Function.Name != "" {
+			toolCalls[idx].Name = delta.Function.Name
+		}
+		toolCalls[idx].Input += delta.Function.Arguments
+	}
+	return toolCalls
+}
+
+func isAzureApiType(apiType string) bool {
+	apiType = strings.ToLower(apiType)
+	return apiType == strings.ToLower(string(openaiapi.APITypeAzure)) ||
+		apiType == strings.ToLower(string(openaiapi.APITypeAzureAD)) ||
+		apiType == strings.ToLower(string(openaiapi.APITypeCloudflareAzure))
+}
+
 func convertUsage(resp openaiapi.ChatCompletionResponse) *wshrpc.OpenAIUsageType {
 	if resp.Usage.TotalTokens == 0 {
 		return nil
@@ -108,6 +169,12 @@ func (OpenAIBackend) StreamCompletion(ctx context.Context, request wshrpc.OpenAi
 		if request.Opts.APIVersion != "" {
 			clientConfig.APIVersion = request.Opts.APIVersion
 		}
+		httpClient, err := MakeAiHttpClient(request.Opts)
+		if err != nil {
+			rtn <- makeAIError(err)
+			return
+		}
+		clientConfig.HTTPClient = httpClient
 
 		client := openaiapi.NewClientWithConfig(clientConfig)
 		req := openaiapi.ChatCompletionRequest{
@@ -141,15 +208,32 @@ func (OpenAIBackend) StreamCompletion(ctx context.Context, request wshrpc.OpenAi
 				pk.FinishReason = string(choice.FinishReason)
 				rtn <- wshrpc.RespOrErrorUnion[wshrpc.OpenAIPacketType]{Response: *pk}
 			}
+			if usage := convertUsage(resp); usage != nil {
+				pk := MakeOpenAIPacket()
+				pk.Usage = usage
+				rtn <- wshrpc.RespOrErrorUnion[wshrpc.OpenAIPacketType]{Response: *pk}
+			}
 			return
 		}
 
 		// Original streaming implementation for non-o1 models
 		req.Stream = true
 		req.MaxTokens = request.Opts.MaxTokens
+		if request.Opts.Temperature != nil {
+			req.Temperature = float32(*request.Opts.Temperature)
+			if req.Temperature == 0 {
+				// go-openai omits a zero temperature
+				req.Temperature = math.SmallestNonzeroFloat32
+			}
+		}
 		if request.Opts.MaxChoices > 1 {
 			req.N = request.Opts.MaxChoices
 		}
+		req.Tools = convertTools(request.Tools)
+		if !isAzureApiType(request.Opts.APIType) {
+			// older azure api versions reject stream_options
+			req.StreamOptions = &openaiapi.StreamOptions{IncludeUsage: true}
+		}
 
 		apiResp, err := client.CreateChatCompletionStream(ctx, req)
 		if err != nil {
@@ -157,6 +241,7 @@ func (OpenAIBackend) StreamCompletion(ctx context.Context, request wshrpc.OpenAi
 			return
 		}
 		sentHeader := false
+		var toolCalls []wshrpc.AiToolCall
 		for {
 			streamResp, err := apiResp.Recv()
 			if err == io.EOF {
@@ -173,7 +258,22 @@ func (OpenAIBackend) StreamCompletion(ctx context.Context, request wshrpc.OpenAi
 				rtn <- wshrpc.RespOrErrorUnion[wshrpc.OpenAIPacketType]{Response: *pk}
 				sentHeader = true
 			}
+			if streamResp.Usage != nil {
+				pk := MakeOpenAIPacket()
+				pk.Usage = &wshrpc.OpenAIUsageType{
+					PromptTokens:     streamResp.Usage.PromptTokens,
+					CompletionTokens: streamResp.Usage.CompletionTokens,
+					TotalTokens:      streamResp.Usage.TotalTokens,
+				}
+				rtn <- wshrpc.RespOrErrorUnion[wshrpc.OpenAIPacketType]{Response: *pk}
+			}
 			for _, choice := range streamResp.Choices {
+				if len(choice.Delta.ToolCalls) > 0 {
+					toolCalls = accumulateToolCalls(toolCalls, choice.Delta.ToolCalls)
+					if choice.Delta.Content == "" && choice.FinishReason == "" {
+						continue
+					}
+				}
 				pk := MakeOpenAIPacket()
 				pk.Index = choice.Index
 				pk.Text = choice.Delta.Content
@@ -181,6 +281,11 @@ func (OpenAIBackend) StreamCompletion(ctx context.Context, request wshrpc.OpenAi
 				rtn <- wshrpc.RespOrErrorUnion[wshrpc.OpenAIPacketType]{Response: *pk}
 			}
 		}
+		if len(toolCalls) > 0 {
+			pk := MakeOpenAIPacket()
+			pk.ToolCalls = toolCalls
+			rtn <- wshrpc.RespOrErrorUnion[wshrpc.OpenAIPacketType]{Response: *pk}
+		}
 	}()
 	return rtn
 }
@@ -28,9 +28,10 @@ type perplexityMessage struct {
 }
 
 type perplexityRequest struct {
-	Model    string              `json:"model"`
-	Messages []perplexityMessage `json:"messages"`
-	Stream   bool                `json:"stream"`
+	Model       string              `json:"model"`
+	Messages    []perplexityMessage `json:"messages"`
+	Stream      bool                `json:"stream"`
+	Temperature *float64            `json:"temperature,omitempty"`
 }
 
 // Perplexity API response types
@@ -88,9 +89,10 @@ func (PerplexityBackend) StreamCompletion(ctx context.Context, request wshrpc.Op
 		}
 
 		perplexityReq := perplexityRequest{
-			Model:    model,
-			Messages: messages,
-			Stream:   true,
+			Model:       model,
+			Messages:    messages,
+			Stream:      true,
+			Temperature: request.Opts.Temperature,
 		}
 
 		reqBody, err := json.Marshal(perplexityReq)
@@ -108,7 +110,11 @@ func (PerplexityBackend) StreamCompletion(ctx context.Context, request wshrpc.Op
 		req.Header.Set("Content-Type", "application/json")
 		req.Header.Set("Authorization", "Bearer "+request.Opts.APIToken)
 
-		client := &http.Client{}
+		client, err := MakeAiHttpClient(request.Opts)
+		if err != nil {
+			rtn <- makeAIError(err)
+			return
+		}
 		resp, err := client.Do(req)
 		if err != nil {
 			rtn <- makeAIError(fmt.Errorf("failed to send perplexity request: %v", err))
@@ -0,0 +1,146 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package waveai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wstore"
+)
+
+const DefaultSuggestTimeout = 60 * time.Second
+const MaxSuggestedCmdLen = 4096
+
+const DefaultSuggestPrompt = "My last command did not work. Suggest a fixed command."
+
+const suggestCmdSystemPrompt = `You suggest exactly one shell command for the user's terminal.
+Use the terminal context (os, shell, cwd, last command and its output) to pick the right command.
+Respond with only a JSON object, no markdown: {"command": "<the command>", "explanation": "<one short sentence>"}
+The command must be a single line that runs in the user's shell.  If you cannot suggest a command, set "command" to "".`
+
+var codeBlockRe = regexp.MustCompile("(?s)```[a-zA-Z]*\\n(.*?)```")
+
+// RunAICommandSync runs an ai request and returns the complete response text
+func RunAICommandSync(ctx context.Context, request wshrpc.OpenAiStreamRequest) (string, error) {
+	var buf strings.Builder
+	for resp := range RunAICommand(ctx, request) {
+		if resp.Error != nil {
+			return "", resp.Error
+		}
+		if resp.Response.Error != "" {
+			return "", errors.New(resp.Response.Error)
+		}
+		buf.WriteString(resp.Response.Text)
+	}
+	return buf.String(), nil
+}
+
+// CleanSuggestedCmd makes a command safe to insert into a terminal without running it.
+// line continuations are joined, other newlines become "; ", and control characters are removed.
+func CleanSuggestedCmd(cmd string) string {
+	cmd = strings.TrimSpace(strings.ReplaceAll(cmd, "\r\n", "\n"))
+	cmd = strings.ReplaceAll(cmd, "\\\n", " ")
+	var lines []string
+	for _, line := range strings.Split(cmd, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	cmd = strings.Join(lines, "; ")
+	return strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return ' '
+		}
+		if r < 0x20 || r == 0x7f || (r >= 0x80 && r < 0xa0) {
+			return -1
+		}
+		return r
+	}, cmd)
+}
+
+// models don't always follow the json instructions, so fall back to a code block or the bare text
+func parseCmdSuggestion(text string) (*wshrpc.AiCmdSuggestion, error) {
+	text = strings.TrimSpace(text)
+	startIdx := strings.Index(text, "{")
+	endIdx := strings.LastIndex(text, "}")
+	if startIdx != -1 && endIdx > startIdx {
+		var rtn wshrpc.AiCmdSuggestion
+		if err := json.Unmarshal([]byte(text[startIdx:endIdx+1]), &rtn); err == nil {
+			rtn.Command = CleanSuggestedCmd(rtn.Command)
+			rtn.Explanation = strings.TrimSpace(rtn.Explanation)
+			return &rtn, nil
+		}
+	}
+	if match := codeBlockRe.FindStringSubmatch(text); match != nil {
+		return &wshrpc.AiCmdSuggestion{Command: CleanSuggestedCmd(match[1])}, nil
+	}
+	if text != "" && !strings.Contains(text, "\n") {
+		return &wshrpc.AiCmdSuggestion{Command: CleanSuggestedCmd(strings.Trim(text, "`"))}, nil
+	}
+	return nil, fmt.Errorf("could not find a command in the ai response")
+}
+
+// SuggestCmd asks the ai (using the given preset, or the default one) for a shell command for
+// a terminal block.  the command is returned, not run (see AiAcceptCmdCommand to insert it).
+func SuggestCmd(ctx context.Context, data wshrpc.CommandAiSuggestCmdData) (*wshrpc.AiCmdSuggestion, error) {
+	opts, err := ResolveOpts(data.Preset)
+	if err != nil {
+		return nil, err
+	}
+	opts.Tools = false
+	termContext, err := GetTermContext(ctx, wshrpc.CommandAiTermContextData{BlockId: data.BlockId})
+	if err != nil {
+		return nil, err
+	}
+	prompt := strings.TrimSpace(data.Prompt)
+	if prompt == "" {
+		prompt = DefaultSuggestPrompt
+	}
+	client, err := wstore.DBGetSingleton[*waveobj.Client](ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting client: %w", err)
+	}
+	timeout := DefaultSuggestTimeout
+	if opts.TimeoutMs > 0 {
+		timeout = time.Duration(opts.TimeoutMs) * time.Millisecond
+	}
+	ctx, cancelFn := context.WithTimeout(ctx, timeout)
+	defer cancelFn()
+	request := wshrpc.OpenAiStreamRequest{
+		ClientId: client.OID,
+		Opts:     opts,
+		Prompt: []wshrpc.OpenAIPromptMessageType{
+			{Role: "system", Content: suggestCmdSystemPrompt},
+			{Role: "user", Content: termContext + "\n" + prompt},
+		},
+	}
+	respText, err := RunAICommandSync(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("error getting suggestion: %w", err)
+	}
+	rtn, err := parseCmdSuggestion(respText)
+	if err != nil {
+		return nil, err
+	}
+	if rtn.Command == "" {
+		if rtn.Explanation != "" {
+			return nil, fmt.Errorf("no command suggested: %s", rtn.Explanation)
+		}
+		return nil, fmt.Errorf("no command suggested")
+	}
+	if len(rtn.Command) > MaxSuggestedCmdLen {
+		return nil, fmt.Errorf("suggested command is too long (%d bytes)", len(rtn.Command))
+	}
+	rtn.BlockId = data.BlockId
+	return rtn, nil
+}
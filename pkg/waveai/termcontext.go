@@ -0,0 +1,158 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package waveai
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/wavetermdev/waveterm/pkg/blockcontroller"
+	"github.com/wavetermdev/waveterm/pkg/diagbundle"
+	"github.com/wavetermdev/waveterm/pkg/util/shellutil"
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wstore"
+)
+
+const (
+	TermContext_LastCmd = "lastcmd"
+	TermContext_Cwd     = "cwd"
+	TermContext_System  = "system"
+)
+
+var AllTermContextParts = []string{TermContext_System, TermContext_Cwd, TermContext_LastCmd}
+
+const MaxTermContextOutput = 4 * 1024
+const MaxTermContextCmdLen = 1024
+
+// CSI, OSC (terminated by BEL or ST), and two character escape sequences
+var ansiEscapeRe = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// StripTermOutput converts raw terminal output to plain text (removes escape sequences,
+// resolves carriage returns from progress bars, and drops other control characters)
+func StripTermOutput(output []byte) string {
+	text := ansiEscapeRe.ReplaceAllString(string(output), "")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	lines := strings.Split(text, "\n")
+	for idx, line := range lines {
+		if crIdx := strings.LastIndexByte(line, '\r'); crIdx != -1 {
+			line = line[crIdx+1:]
+		}
+		lines[idx] = strings.Map(func(r rune) rune {
+			if r < 0x20 && r != '\t' {
+				return -1
+			}
+			return r
+		}, line)
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+// returns the last maxLen bytes of text (on a utf-8 boundary)
+func tailText(text string, maxLen int) (string, bool) {
+	if len(text) <= maxLen {
+		return text, false
+	}
+	startIdx := len(text) - maxLen
+	for startIdx < len(text) && !utf8.RuneStart(text[startIdx]) {
+		startIdx++
+	}
+	return text[startIdx:], true
+}
+
+func hasTermContextPart(parts []string, part string) bool {
+	if len(parts) == 0 {
+		return true
+	}
+	for _, p := range parts {
+		if p == part {
+			return true
+		}
+	}
+	return false
+}
+
+// GetTermContext gathers context about a terminal block (os/shell of its connection, cwd,
+// and the last command with its output) to attach to an ai prompt.  the output is size
+// limited and secrets are redacted.
+func GetTermContext(ctx context.Context, data wshrpc.CommandAiTermContextData) (string, error) {
+	for _, part := range data.Parts {
+		if !hasTermContextPart(AllTermContextParts, part) {
+			return "", fmt.Errorf("invalid context part %q (valid parts are %s)", part, strings.Join(AllTermContextParts, ", "))
+		}
+	}
+	block, err := wstore.DBMustGet[*waveobj.Block](ctx, data.BlockId)
+	if err != nil {
+		return "", fmt.Errorf("error getting block: %w", err)
+	}
+	controller := block.Meta.GetString(waveobj.MetaKey_Controller, "")
+	if controller != blockcontroller.BlockController_Shell && controller != blockcontroller.BlockController_Cmd {
+		return "", fmt.Errorf("block %s is not a terminal", data.BlockId)
+	}
+	connName := block.Meta.GetString(waveobj.MetaKey_Connection, "")
+	isLocal := connName == "" || connName == "local"
+	siInfo := blockcontroller.GetShellIntegrationInfo(data.BlockId)
+	if siInfo == nil {
+		siInfo = &blockcontroller.ShellIntegrationInfo{}
+	}
+	var buf strings.Builder
+	buf.WriteString("@@@start terminal context\n")
+	if hasTermContextPart(data.Parts, TermContext_System) {
+		osName, shellName := siInfo.OS, siInfo.Shell
+		if isLocal {
+			connName = "local"
+			if osName == "" {
+				osName = runtime.GOOS
+			}
+			if shellName == "" {
+				shellName = filepath.Base(shellutil.DetectLocalShellPath())
+			}
+		}
+		buf.WriteString(fmt.Sprintf("connection: %s\n", connName))
+		if osName != "" {
+			buf.WriteString(fmt.Sprintf("os: %s\n", osName))
+		}
+		if shellName != "" {
+			buf.WriteString(fmt.Sprintf("shell: %s\n", shellName))
+		}
+	}
+	if hasTermContextPart(data.Parts, TermContext_Cwd) {
+		cwd := siInfo.Cwd
+		if cwd == "" {
+			cwd = block.Meta.GetString(waveobj.MetaKey_CmdCwd, "")
+		}
+		if cwd != "" {
+			buf.WriteString(fmt.Sprintf("cwd: %s\n", cwd))
+		}
+	}
+	if hasTermContextPart(data.Parts, TermContext_LastCmd) {
+		lastCmd := siInfo.LastCommand
+		if lastCmd == nil {
+			buf.WriteString("last command: (not available, shell integration is only supported for bash and zsh)\n")
+		} else {
+			cmdStr, _ := tailText(lastCmd.Command, MaxTermContextCmdLen)
+			if lastCmd.HasExitCode {
+				buf.WriteString(fmt.Sprintf("last command (exit code %d): %s\n", lastCmd.ExitCode, cmdStr))
+			} else {
+				buf.WriteString(fmt.Sprintf("last command: %s\n", cmdStr))
+			}
+			output, truncated := tailText(StripTermOutput(lastCmd.Output), MaxTermContextOutput)
+			if truncated || lastCmd.Truncated {
+				buf.WriteString("output (truncated, last lines only):\n")
+			} else {
+				buf.WriteString("output:\n")
+			}
+			buf.WriteString(output)
+			buf.WriteString("\n")
+		}
+	}
+	buf.WriteString("@@@end terminal context\n")
+	rtn, _ := diagbundle.SanitizeText(buf.String())
+	return rtn, nil
+}
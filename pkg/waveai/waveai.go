@@ -5,10 +5,15 @@ package waveai
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/wavetermdev/waveterm/pkg/telemetry"
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
 )
 
@@ -60,37 +65,202 @@ func IsCloudAIRequest(opts *wshrpc.OpenAIOptsType) bool {
 	return opts.BaseURL == "" && opts.APIToken == ""
 }
 
+// ResolveOpts returns the ai opts for a preset (overlaid on the ai settings, like the ai block does).
+// if presetName is empty, the "ai:preset" setting is used.
+func ResolveOpts(presetName string) (*wshrpc.OpenAIOptsType, error) {
+	fullConfig := wconfig.ReadFullConfig()
+	settings := fullConfig.Settings
+	aiMeta := waveobj.MetaMapType{
+		"ai:apitype":         settings.AiApiType,
+		"ai:baseurl":         settings.AiBaseURL,
+		"ai:apitoken":        settings.AiApiToken,
+		"ai:model":           settings.AiModel,
+		"ai:orgid":           settings.AiOrgID,
+		"ai:apiversion":      settings.AIApiVersion,
+		"ai:maxtokens":       settings.AiMaxTokens,
+		"ai:timeoutms":       settings.AiTimeoutMs,
+		"ai:systemprompt":    settings.AiSystemPrompt,
+		"ai:tools":           settings.AiTools,
+		"ai:azuredeployment": settings.AiAzureDeployment,
+		"ai:tlsskipverify":   settings.AiTlsSkipVerify,
+		"ai:tlscacert":       settings.AiTlsCaCert,
+		"ai:tlsclientcert":   settings.AiTlsClientCert,
+		"ai:tlsclientkey":    settings.AiTlsClientKey,
+	}
+	if len(settings.AiHeaders) > 0 {
+		aiMeta["ai:headers"] = settings.AiHeaders
+	}
+	if settings.AiTemperature != nil {
+		aiMeta["ai:temperature"] = *settings.AiTemperature
+	}
+	if presetName == "" {
+		presetName = settings.AiPreset
+	}
+	if presetName != "" {
+		preset, ok := fullConfig.Presets[presetName]
+		if !ok || !strings.HasPrefix(presetName, "ai@") {
+			return nil, fmt.Errorf("ai preset %q not found", presetName)
+		}
+		var presetKeys []string
+		for key := range preset {
+			if strings.HasPrefix(key, "ai:") && key != "ai:*" {
+				presetKeys = append(presetKeys, key)
+			}
+		}
+		// a preset that only has "ai:*" (like ai@global) means "use the settings"
+		if len(presetKeys) > 0 {
+			if preset.GetBool("ai:*", false) {
+				aiMeta = waveobj.MetaMapType{}
+			}
+			for _, key := range presetKeys {
+				aiMeta[key] = preset[key]
+			}
+		}
+	}
+	return &wshrpc.OpenAIOptsType{
+		APIType:         aiMeta.GetString("ai:apitype", ""),
+		BaseURL:         aiMeta.GetString("ai:baseurl", ""),
+		APIToken:        aiMeta.GetString("ai:apitoken", ""),
+		Model:           aiMeta.GetString("ai:model", ""),
+		OrgID:           aiMeta.GetString("ai:orgid", ""),
+		APIVersion:      aiMeta.GetString("ai:apiversion", ""),
+		MaxTokens:       int(aiMeta.GetFloat("ai:maxtokens", 0)),
+		TimeoutMs:       int(aiMeta.GetFloat("ai:timeoutms", 0)),
+		Temperature:     getTemperature(aiMeta),
+		SystemPrompt:    aiMeta.GetString("ai:systemprompt", ""),
+		Tools:           aiMeta.GetBool("ai:tools", false),
+		Preset:          presetName,
+		Headers:         getHeaders(aiMeta),
+		AzureDeployment: aiMeta.GetString("ai:azuredeployment", ""),
+		TlsSkipVerify:   aiMeta.GetBool("ai:tlsskipverify", false),
+		TlsCaCert:       aiMeta.GetString("ai:tlscacert", ""),
+		TlsClientCert:   aiMeta.GetString("ai:tlsclientcert", ""),
+		TlsClientKey:    aiMeta.GetString("ai:tlsclientkey", ""),
+	}, nil
+}
+
+// headers come from settings (map[string]string) or from a preset (decoded json, map[string]any)
+func getHeaders(aiMeta waveobj.MetaMapType) map[string]string {
+	switch headers := aiMeta["ai:headers"].(type) {
+	case map[string]string:
+		return headers
+	case map[string]any:
+		rtn := make(map[string]string)
+		for key, val := range headers {
+			if strVal, ok := val.(string); ok {
+				rtn[key] = strVal
+			}
+		}
+		return rtn
+	}
+	return nil
+}
+
+func getTemperature(aiMeta waveobj.MetaMapType) *float64 {
+	if temp, ok := aiMeta["ai:temperature"].(float64); ok {
+		return &temp
+	}
+	return nil
+}
+
+// ListPresets returns the ai presets (profiles), sorted by display order
+func ListPresets() []wshrpc.AiPresetInfo {
+	fullConfig := wconfig.ReadFullConfig()
+	var rtn []wshrpc.AiPresetInfo
+	for key, preset := range fullConfig.Presets {
+		if !strings.HasPrefix(key, "ai@") {
+			continue
+		}
+		rtn = append(rtn, wshrpc.AiPresetInfo{
+			Key:          key,
+			Name:         preset.GetString("display:name", ""),
+			Order:        preset.GetFloat("display:order", 0),
+			APIType:      preset.GetString("ai:apitype", ""),
+			BaseURL:      preset.GetString("ai:baseurl", ""),
+			Model:        preset.GetString("ai:model", ""),
+			Temperature:  getTemperature(preset),
+			SystemPrompt: preset.GetString("ai:systemprompt", "") != "",
+			IsDefault:    key == fullConfig.Settings.AiPreset,
+		})
+	}
+	sort.Slice(rtn, func(i, j int) bool {
+		if rtn[i].Order != rtn[j].Order {
+			return rtn[i].Order < rtn[j].Order
+		}
+		return rtn[i].Key < rtn[j].Key
+	})
+	return rtn
+}
+
+// GetPresetMeta returns the block meta that switches an ai block to the given preset
+func GetPresetMeta(presetName string) (waveobj.MetaMapType, error) {
+	preset, ok := wconfig.ReadFullConfig().Presets[presetName]
+	if !ok || !strings.HasPrefix(presetName, "ai@") {
+		return nil, fmt.Errorf("ai preset %q not found", presetName)
+	}
+	meta := waveobj.MetaMapType{}
+	for key, val := range preset {
+		meta[key] = val
+	}
+	meta["ai:preset"] = presetName
+	return meta, nil
+}
+
+// the configured system prompt is added unless the prompt already has one
+func addSystemPrompt(request *wshrpc.OpenAiStreamRequest) {
+	if request.Opts == nil || request.Opts.SystemPrompt == "" {
+		return
+	}
+	for _, msg := range request.Prompt {
+		if msg.Role == "system" {
+			return
+		}
+	}
+	systemMsg := wshrpc.OpenAIPromptMessageType{Role: "system", Content: request.Opts.SystemPrompt}
+	request.Prompt = append([]wshrpc.OpenAIPromptMessageType{systemMsg}, request.Prompt...)
+}
+
 func makeAIError(err error) wshrpc.RespOrErrorUnion[wshrpc.OpenAIPacketType] {
 	return wshrpc.RespOrErrorUnion[wshrpc.OpenAIPacketType]{Error: err}
 }
 
 func RunAICommand(ctx context.Context, request wshrpc.OpenAiStreamRequest) chan wshrpc.RespOrErrorUnion[wshrpc.OpenAIPacketType] {
 	telemetry.GoUpdateActivityWrap(wshrpc.ActivityUpdate{NumAIReqs: 1}, "RunAICommand")
-	if request.Opts.APIType == ApiType_Anthropic {
-		endpoint := request.Opts.BaseURL
+	addSystemPrompt(&request)
+	backend := usageTrackingBackend{backend: getBackend(request.Opts), key: AiUsageKey(request.Opts)}
+	return runWithTokenLimits(ctx, request, func() chan wshrpc.RespOrErrorUnion[wshrpc.OpenAIPacketType] {
+		if supportsTools(request.Opts) {
+			return runWithTools(ctx, backend, request)
+		}
+		return backend.StreamCompletion(ctx, request)
+	})
+}
+
+func getBackend(opts *wshrpc.OpenAIOptsType) AIBackend {
+	if opts.APIType == ApiType_Anthropic {
+		endpoint := opts.BaseURL
 		if endpoint == "" {
 			endpoint = "default"
 		}
-		log.Printf("sending ai chat message to anthropic endpoint %q using model %s\n", endpoint, request.Opts.Model)
-		anthropicBackend := AnthropicBackend{}
-		return anthropicBackend.StreamCompletion(ctx, request)
+		log.Printf("sending ai chat message to anthropic endpoint %q using model %s\n", endpoint, opts.Model)
+		return AnthropicBackend{}
 	}
-	if request.Opts.APIType == ApiType_Perplexity {
-		endpoint := request.Opts.BaseURL
+	if opts.APIType == ApiType_Perplexity {
+		endpoint := opts.BaseURL
 		if endpoint == "" {
 			endpoint = "default"
 		}
-		log.Printf("sending ai chat message to perplexity endpoint %q using model %s\n", endpoint, request.Opts.Model)
-		perplexityBackend := PerplexityBackend{}
-		return perplexityBackend.StreamCompletion(ctx, request)
+		log.Printf("sending ai chat message to perplexity endpoint %q using model %s\n", endpoint, opts.Model)
+		return PerplexityBackend{}
+	}
+	if opts != nil && IsLocalApiType(opts.APIType) {
+		log.Printf("sending ai chat message to local endpoint %q using model %q\n", getLocalBaseURL(opts), opts.Model)
+		return LocalBackend{}
 	}
-	if IsCloudAIRequest(request.Opts) {
+	if IsCloudAIRequest(opts) {
 		log.Print("sending ai chat message to default waveterm cloud endpoint\n")
-		cloudBackend := WaveAICloudBackend{}
-		return cloudBackend.StreamCompletion(ctx, request)
-	} else {
-		log.Printf("sending ai chat message to user-configured endpoint %s using model %s\n", request.Opts.BaseURL, request.Opts.Model)
-		openAIBackend := OpenAIBackend{}
-		return openAIBackend.StreamCompletion(ctx, request)
+		return WaveAICloudBackend{}
 	}
+	log.Printf("sending ai chat message to user-configured endpoint %s using model %s\n", opts.BaseURL, opts.Model)
+	return OpenAIBackend{}
 }
@@ -40,6 +40,8 @@ const WaveLockFile = "wave.lock"
 const DomainSocketBaseName = "wave.sock"
 const RemoteDomainSocketBaseName = "wave-remote.sock"
 const WaveDBDir = "db"
+const WaveAppLogFileName = "waveapp.log"
+const WaveSrvLogFileName = "wavesrv.log"
 const JwtSecret = "waveterm" // TODO generate and store this
 const ConfigDir = "config"
 
@@ -0,0 +1,197 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// pprof and runtime diagnostics for wavesrv.  served by the local web server under
+// PathPrefix, but only when "debug:pprof" is set, and only to requests that carry
+// the per-process debug token (random, shown by "wsh debug pprof").
+package wavedebug
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/pprof"
+	"net/url"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const PathPrefix = "/wave/debug/"
+const TokenParam = "token"
+
+var startTs = time.Now()
+
+var lock = &sync.Mutex{}
+var token string
+var serverAddr string
+
+func getToken() string {
+	lock.Lock()
+	defer lock.Unlock()
+	if token == "" {
+		barr := make([]byte, 16)
+		rand.Read(barr)
+		token = hex.EncodeToString(barr)
+	}
+	return token
+}
+
+// SetServerAddr records the address of the web server (used to build the urls returned by GetInfo)
+func SetServerAddr(addr string) {
+	lock.Lock()
+	defer lock.Unlock()
+	serverAddr = addr
+}
+
+func IsEnabled() bool {
+	return wconfig.GetWatcher().GetFullConfig().Settings.DebugPprof
+}
+
+func GetInfo() *wshrpc.DebugPprofInfo {
+	rtn := &wshrpc.DebugPprofInfo{Enabled: IsEnabled()}
+	if !rtn.Enabled {
+		return rtn
+	}
+	lock.Lock()
+	addr := serverAddr
+	lock.Unlock()
+	rtn.Token = getToken()
+	if addr != "" {
+		rtn.Url = "http://" + addr + PathPrefix
+	}
+	return rtn
+}
+
+// the token can be passed as a query param (so "go tool pprof <url>" works) or as a bearer token
+func validateToken(r *http.Request) bool {
+	reqToken := r.URL.Query().Get(TokenParam)
+	if reqToken == "" {
+		reqToken = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	if reqToken == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(reqToken), []byte(getToken())) == 1
+}
+
+type RuntimeStats struct {
+	Ts              int64   `json:"ts"`
+	UptimeSec       int64   `json:"uptimesec"`
+	GoVersion       string  `json:"goversion"`
+	NumCPU          int     `json:"numcpu"`
+	NumGoroutine    int     `json:"numgoroutine"`
+	HeapAlloc       uint64  `json:"heapalloc"`
+	HeapInuse       uint64  `json:"heapinuse"`
+	HeapIdle        uint64  `json:"heapidle"`
+	HeapReleased    uint64  `json:"heapreleased"`
+	HeapObjects     uint64  `json:"heapobjects"`
+	StackInuse      uint64  `json:"stackinuse"`
+	Sys             uint64  `json:"sys"`
+	TotalAlloc      uint64  `json:"totalalloc"`
+	NumGC           uint32  `json:"numgc"`
+	LastGCTs        int64   `json:"lastgcts"`
+	PauseTotalMs    float64 `json:"pausetotalms"`
+	GCCPUFraction   float64 `json:"gccpufraction"`
+	NextGCHeapBytes uint64  `json:"nextgcheapbytes"`
+}
+
+func GetRuntimeStats() RuntimeStats {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	return RuntimeStats{
+		Ts:              time.Now().UnixMilli(),
+		UptimeSec:       int64(time.Since(startTs).Seconds()),
+		GoVersion:       runtime.Version(),
+		NumCPU:          runtime.NumCPU(),
+		NumGoroutine:    runtime.NumGoroutine(),
+		HeapAlloc:       memStats.HeapAlloc,
+		HeapInuse:       memStats.HeapInuse,
+		HeapIdle:        memStats.HeapIdle,
+		HeapReleased:    memStats.HeapReleased,
+		HeapObjects:     memStats.HeapObjects,
+		StackInuse:      memStats.StackInuse,
+		Sys:             memStats.Sys,
+		TotalAlloc:      memStats.TotalAlloc,
+		NumGC:           memStats.NumGC,
+		LastGCTs:        int64(memStats.LastGC / uint64(time.Millisecond)),
+		PauseTotalMs:    float64(memStats.PauseTotalNs) / float64(time.Millisecond),
+		GCCPUFraction:   memStats.GCCPUFraction,
+		NextGCHeapBytes: memStats.NextGC,
+	}
+}
+
+func handleRuntime(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("gc") == "1" {
+		runtime.GC()
+	}
+	barr, err := json.MarshalIndent(GetRuntimeStats(), "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(barr)
+}
+
+// Handler serves the pprof endpoints and runtime stats (returns 404 when disabled, 401 without a valid token)
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(PathPrefix+"pprof/", handleIndex)
+	mux.HandleFunc(PathPrefix+"pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc(PathPrefix+"pprof/profile", pprof.Profile)
+	mux.HandleFunc(PathPrefix+"pprof/symbol", pprof.Symbol)
+	mux.HandleFunc(PathPrefix+"pprof/trace", pprof.Trace)
+	mux.HandleFunc(PathPrefix+"runtime", handleRuntime)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !IsEnabled() {
+			http.NotFound(w, r)
+			return
+		}
+		if !validateToken(r) {
+			http.Error(w, "invalid or missing debug token", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-cache")
+		// pprof.Index only serves named profiles under /debug/pprof/, so they are dispatched here
+		if name, ok := strings.CutPrefix(r.URL.Path, PathPrefix+"pprof/"); ok && name != "" && !isBuiltinHandler(name) {
+			pprof.Handler(name).ServeHTTP(w, r)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// a simple index (pprof.Index's links would drop the token)
+func handleIndex(w http.ResponseWriter, r *http.Request) {
+	tokenParam := url.QueryEscape(r.URL.Query().Get(TokenParam))
+	var buf strings.Builder
+	buf.WriteString("<html><head><title>wavesrv debug</title></head><body>\n")
+	buf.WriteString("<h3>wavesrv profiles</h3>\n<ul>\n")
+	for _, profile := range runtimepprof.Profiles() {
+		name := html.EscapeString(profile.Name())
+		fmt.Fprintf(&buf, "<li><a href=\"%s?debug=1&token=%s\">%s</a> (%d)</li>\n", name, tokenParam, name, profile.Count())
+	}
+	fmt.Fprintf(&buf, "<li><a href=\"profile?seconds=15&token=%s\">profile</a> (15s cpu profile)</li>\n", tokenParam)
+	fmt.Fprintf(&buf, "<li><a href=\"../runtime?token=%s\">runtime</a> (goroutine, heap, and gc stats)</li>\n", tokenParam)
+	buf.WriteString("</ul></body></html>\n")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(buf.String()))
+}
+
+func isBuiltinHandler(name string) bool {
+	switch name {
+	case "cmdline", "profile", "symbol", "trace":
+		return true
+	}
+	return false
+}
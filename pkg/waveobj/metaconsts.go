@@ -64,6 +64,17 @@ const (
 	MetaKey_AIApiVersion                     = "ai:apiversion"
 	MetaKey_AiMaxTokens                      = "ai:maxtokens"
 	MetaKey_AiTimeoutMs                      = "ai:timeoutms"
+	MetaKey_AiTemperature                    = "ai:temperature"
+	MetaKey_AiSystemPrompt                   = "ai:systemprompt"
+	MetaKey_AiTools                          = "ai:tools"
+	MetaKey_AiDailyTokenLimit                = "ai:dailytokenlimit"
+	MetaKey_AiMonthlyTokenLimit              = "ai:monthlytokenlimit"
+	MetaKey_AiHeaders                        = "ai:headers"
+	MetaKey_AiAzureDeployment                = "ai:azuredeployment"
+	MetaKey_AiTlsSkipVerify                  = "ai:tlsskipverify"
+	MetaKey_AiTlsCaCert                      = "ai:tlscacert"
+	MetaKey_AiTlsClientCert                  = "ai:tlsclientcert"
+	MetaKey_AiTlsClientKey                   = "ai:tlsclientkey"
 
 	MetaKey_EditorClear                      = "editor:*"
 	MetaKey_EditorMinimapEnabled             = "editor:minimapenabled"
@@ -105,6 +116,8 @@ const (
 	MetaKey_VDomRoute                        = "vdom:route"
 	MetaKey_VDomPersist                      = "vdom:persist"
 
+	MetaKey_PluginView                       = "plugin:view"
+
 	MetaKey_Count                            = "count"
 )
 
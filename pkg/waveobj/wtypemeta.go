@@ -53,17 +53,28 @@ type MetaTSType struct {
 	CmdShell            bool              `json:"cmd:shell,omitempty"` // shell expansion for cmd+args (defaults to true)
 
 	// AI options match settings
-	AiClear      bool    `json:"ai:*,omitempty"`
-	AiPresetKey  string  `json:"ai:preset,omitempty"`
-	AiApiType    string  `json:"ai:apitype,omitempty"`
-	AiBaseURL    string  `json:"ai:baseurl,omitempty"`
-	AiApiToken   string  `json:"ai:apitoken,omitempty"`
-	AiName       string  `json:"ai:name,omitempty"`
-	AiModel      string  `json:"ai:model,omitempty"`
-	AiOrgID      string  `json:"ai:orgid,omitempty"`
-	AIApiVersion string  `json:"ai:apiversion,omitempty"`
-	AiMaxTokens  float64 `json:"ai:maxtokens,omitempty"`
-	AiTimeoutMs  float64 `json:"ai:timeoutms,omitempty"`
+	AiClear             bool              `json:"ai:*,omitempty"`
+	AiPresetKey         string            `json:"ai:preset,omitempty"`
+	AiApiType           string            `json:"ai:apitype,omitempty"`
+	AiBaseURL           string            `json:"ai:baseurl,omitempty"`
+	AiApiToken          string            `json:"ai:apitoken,omitempty"`
+	AiName              string            `json:"ai:name,omitempty"`
+	AiModel             string            `json:"ai:model,omitempty"`
+	AiOrgID             string            `json:"ai:orgid,omitempty"`
+	AIApiVersion        string            `json:"ai:apiversion,omitempty"`
+	AiMaxTokens         float64           `json:"ai:maxtokens,omitempty"`
+	AiTimeoutMs         float64           `json:"ai:timeoutms,omitempty"`
+	AiTemperature       *float64          `json:"ai:temperature,omitempty"`
+	AiSystemPrompt      string            `json:"ai:systemprompt,omitempty"`
+	AiTools             bool              `json:"ai:tools,omitempty"`
+	AiDailyTokenLimit   float64           `json:"ai:dailytokenlimit,omitempty"` // only used in presets (limits the preset's usage)
+	AiMonthlyTokenLimit float64           `json:"ai:monthlytokenlimit,omitempty"`
+	AiHeaders           map[string]string `json:"ai:headers,omitempty"`
+	AiAzureDeployment   string            `json:"ai:azuredeployment,omitempty"`
+	AiTlsSkipVerify     bool              `json:"ai:tlsskipverify,omitempty"`
+	AiTlsCaCert         string            `json:"ai:tlscacert,omitempty"`
+	AiTlsClientCert     string            `json:"ai:tlsclientcert,omitempty"`
+	AiTlsClientKey      string            `json:"ai:tlsclientkey,omitempty"`
 
 	EditorClear               bool `json:"editor:*,omitempty"`
 	EditorMinimapEnabled      bool `json:"editor:minimapenabled,omitempty"`
@@ -106,6 +117,8 @@ type MetaTSType struct {
 	VDomRoute         string `json:"vdom:route,omitempty"`
 	VDomPersist       bool   `json:"vdom:persist,omitempty"`
 
+	PluginView string `json:"plugin:view,omitempty"` // view name, for vdom blocks routed to a plugin
+
 	Count int `json:"count,omitempty"` // temp for cpu plot. will remove later
 }
 
@@ -0,0 +1,271 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// backend stats aggregator for the diagnostics view.  while at least one block
+// is subscribed, a sample (rpc rates, connection health, filestore size,
+// controller counts, memory usage) is taken every SampleInterval and appended to
+// each subscribed block's "wavestats" ijson file:
+//
+//	{"intervalms": 2000, "maxsamples": 300, "samples": [{"ts": ..., "values": {"rpc:rate": 1.5, ...}}, ...]}
+package wavestats
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/fs"
+	"log"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/blockcontroller"
+	"github.com/wavetermdev/waveterm/pkg/filestore"
+	"github.com/wavetermdev/waveterm/pkg/ijson"
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/remote/conncontroller"
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wps"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+const BlockFile_Stats = "wavestats"
+
+const (
+	SampleInterval = 2 * time.Second
+	MaxSamples     = 300 // 10 minutes of history
+	MaxTopCommands = 5   // per-command rpc rates are only reported for the busiest commands
+	bytesPerMB     = 1024 * 1024
+)
+
+// value keys (per-command rpc rates are "rpc:rate:<command>")
+const (
+	Stat_RpcRate            = "rpc:rate"
+	Stat_RpcTotal           = "rpc:total"
+	Stat_ConnTotal          = "conn:total"
+	Stat_ConnConnected      = "conn:connected"
+	Stat_ConnConnecting     = "conn:connecting"
+	Stat_ConnError          = "conn:error"
+	Stat_FileStoreFiles     = "filestore:files"
+	Stat_FileStoreMB        = "filestore:mb"
+	Stat_ControllersTotal   = "controllers:total"
+	Stat_ControllersRunning = "controllers:running"
+	Stat_MemHeapMB          = "mem:heapmb"
+	Stat_MemSysMB           = "mem:sysmb"
+	Stat_MemGoroutines      = "mem:goroutines"
+	Stat_MemNumGC           = "mem:numgc"
+)
+
+type subscriber struct {
+	BlockId    string
+	NumAppends int
+}
+
+var globalLock = &sync.Mutex{}
+var subscribers = make(map[string]*subscriber)
+var loopRunning bool
+var history []wshrpc.TimeSeriesData
+var lastRpcTotal int64
+var lastRpcByCommand map[string]int64
+var lastSampleTime time.Time
+
+// Subscribe starts streaming stats samples into the block's "wavestats" file.
+// the file is (re)initialized with the current history.
+func Subscribe(ctx context.Context, blockId string) error {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+	err := filestore.WFS.MakeFile(ctx, blockId, BlockFile_Stats, nil, filestore.FileOptsType{IJson: true})
+	if err != nil && err != fs.ErrExist {
+		return fmt.Errorf("error creating stats file: %w", err)
+	}
+	sub := &subscriber{BlockId: blockId}
+	err = writeFullFile_nolock(ctx, sub)
+	if err != nil {
+		return err
+	}
+	subscribers[blockId] = sub
+	if !loopRunning {
+		loopRunning = true
+		go runSampleLoop()
+	}
+	return nil
+}
+
+func Unsubscribe(blockId string) {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+	delete(subscribers, blockId)
+}
+
+// GetLatest returns the most recent sample (taking one if there is no history yet)
+func GetLatest() wshrpc.TimeSeriesData {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+	if len(history) > 0 {
+		return history[len(history)-1]
+	}
+	return takeSample_nolock()
+}
+
+func runSampleLoop() {
+	defer panichandler.PanicHandler("wavestats:runSampleLoop")
+	ticker := time.NewTicker(SampleInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !sampleAndPublish() {
+			return
+		}
+	}
+}
+
+// returns false (and stops the loop) once there are no subscribers
+func sampleAndPublish() bool {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+	if len(subscribers) == 0 {
+		loopRunning = false
+		history = nil
+		return false
+	}
+	sample := takeSample_nolock()
+	history = append(history, sample)
+	if len(history) > MaxSamples {
+		history = history[len(history)-MaxSamples:]
+	}
+	ctx, cancelFn := context.WithTimeout(context.Background(), SampleInterval)
+	defer cancelFn()
+	for blockId, sub := range subscribers {
+		var err error
+		sub.NumAppends++
+		if sub.NumAppends >= MaxSamples {
+			// rewrite with just the window (the appended commands would otherwise grow without bound)
+			err = writeFullFile_nolock(ctx, sub)
+		} else {
+			err = appendCommand(ctx, blockId, ijson.MakeAppendCommand(ijson.Path{"samples"}, sample))
+		}
+		if err != nil {
+			// block (or its file) was deleted
+			log.Printf("wavestats: removing subscriber %s: %v\n", blockId, err)
+			delete(subscribers, blockId)
+		}
+	}
+	return true
+}
+
+func writeFullFile_nolock(ctx context.Context, sub *subscriber) error {
+	samples := make([]any, 0, len(history))
+	for _, sample := range history {
+		samples = append(samples, sample)
+	}
+	root := map[string]any{
+		"intervalms": SampleInterval.Milliseconds(),
+		"maxsamples": MaxSamples,
+		"samples":    samples,
+	}
+	sub.NumAppends = 0
+	return appendCommand(ctx, sub.BlockId, ijson.MakeSetCommand(nil, root))
+}
+
+func appendCommand(ctx context.Context, blockId string, command ijson.Command) error {
+	err := filestore.WFS.AppendIJson(ctx, blockId, BlockFile_Stats, command)
+	if err != nil {
+		return err
+	}
+	wps.Broker.Publish(wps.WaveEvent{
+		Event:  wps.Event_BlockFile,
+		Scopes: []string{waveobj.MakeORef(waveobj.OType_Block, blockId).String()},
+		Data: &wps.WSFileEventData{
+			ZoneId:   blockId,
+			FileName: BlockFile_Stats,
+			FileOp:   wps.FileOp_Append,
+			Data64:   base64.StdEncoding.EncodeToString([]byte("{}")),
+		},
+	})
+	return nil
+}
+
+func takeSample_nolock() wshrpc.TimeSeriesData {
+	now := time.Now()
+	values := make(map[string]float64)
+	addRpcStats_nolock(values, now)
+	addConnStats(values)
+	addFileStoreStats(values)
+	numControllers, numRunning := blockcontroller.GetControllerCounts()
+	values[Stat_ControllersTotal] = float64(numControllers)
+	values[Stat_ControllersRunning] = float64(numRunning)
+	addMemStats(values)
+	lastSampleTime = now
+	return wshrpc.TimeSeriesData{Ts: now.UnixMilli(), Values: values}
+}
+
+func addRpcStats_nolock(values map[string]float64, now time.Time) {
+	total, byCommand := wshutil.GetRpcCounts()
+	values[Stat_RpcTotal] = float64(total)
+	if !lastSampleTime.IsZero() {
+		secs := now.Sub(lastSampleTime).Seconds()
+		if secs > 0 {
+			values[Stat_RpcRate] = float64(total-lastRpcTotal) / secs
+			type cmdDelta struct {
+				Command string
+				Delta   int64
+			}
+			var deltas []cmdDelta
+			for command, count := range byCommand {
+				if delta := count - lastRpcByCommand[command]; delta > 0 {
+					deltas = append(deltas, cmdDelta{Command: command, Delta: delta})
+				}
+			}
+			sort.Slice(deltas, func(i, j int) bool {
+				return deltas[i].Delta > deltas[j].Delta
+			})
+			for idx, delta := range deltas {
+				if idx >= MaxTopCommands {
+					break
+				}
+				values[Stat_RpcRate+":"+delta.Command] = float64(delta.Delta) / secs
+			}
+		}
+	}
+	lastRpcTotal = total
+	lastRpcByCommand = byCommand
+}
+
+func addConnStats(values map[string]float64) {
+	statuses := conncontroller.GetAllConnStatus()
+	values[Stat_ConnTotal] = float64(len(statuses))
+	values[Stat_ConnConnected] = 0
+	values[Stat_ConnConnecting] = 0
+	values[Stat_ConnError] = 0
+	for _, status := range statuses {
+		switch status.Status {
+		case conncontroller.Status_Connected:
+			values[Stat_ConnConnected]++
+		case conncontroller.Status_Connecting:
+			values[Stat_ConnConnecting]++
+		case conncontroller.Status_Error:
+			values[Stat_ConnError]++
+		}
+	}
+}
+
+func addFileStoreStats(values map[string]float64) {
+	ctx, cancelFn := context.WithTimeout(context.Background(), time.Second)
+	defer cancelFn()
+	stats, err := filestore.WFS.GetStats(ctx)
+	if err != nil {
+		return
+	}
+	values[Stat_FileStoreFiles] = float64(stats.NumFiles)
+	values[Stat_FileStoreMB] = float64(stats.TotalSize) / bytesPerMB
+}
+
+func addMemStats(values map[string]float64) {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	values[Stat_MemHeapMB] = float64(memStats.HeapAlloc) / bytesPerMB
+	values[Stat_MemSysMB] = float64(memStats.Sys) / bytesPerMB
+	values[Stat_MemGoroutines] = float64(runtime.NumGoroutine())
+	values[Stat_MemNumGC] = float64(memStats.NumGC)
+}
@@ -148,29 +148,48 @@ func doRequest(req *http.Request, outputObj interface{}) (*http.Response, error)
 	return resp, nil
 }
 
-func SendTelemetry(ctx context.Context, clientId string) error {
+// MakeTelemetryInput builds the payload that would be sent by SendTelemetry (only fields from the
+// enabled categories are included).  returns nil if there is nothing to send.
+func MakeTelemetryInput(ctx context.Context, clientId string) (*TelemetryInputType, []*telemetry.ActivityType, error) {
 	if !telemetry.IsTelemetryEnabled() {
-		log.Printf("telemetry disabled, not sending\n")
-		return nil
+		return nil, nil, nil
 	}
 	activity, err := telemetry.GetNonUploadedActivity(ctx)
 	if err != nil {
-		return fmt.Errorf("cannot get activity: %v", err)
+		return nil, nil, fmt.Errorf("cannot get activity: %v", err)
 	}
 	if len(activity) == 0 {
-		return nil
+		return nil, nil, nil
 	}
-	log.Printf("[wcloud] sending telemetry data\n")
-	dayStr := daystr.GetCurDayStr()
-	input := TelemetryInputType{
+	enabled := telemetry.GetEnabledCategories()
+	filtered := make([]*telemetry.ActivityType, 0, len(activity))
+	for _, act := range activity {
+		actCopy := *act
+		actCopy.TData = telemetry.FilterTelemetryData(act.TData, enabled)
+		filtered = append(filtered, &actCopy)
+	}
+	input := &TelemetryInputType{
 		ClientId:          clientId,
 		UserId:            clientId,
 		AppType:           "w2",
 		AutoUpdateEnabled: telemetry.IsAutoUpdateEnabled(),
 		AutoUpdateChannel: telemetry.AutoUpdateChannel(),
-		CurDay:            dayStr,
-		Activity:          activity,
+		CurDay:            daystr.GetCurDayStr(),
+		Activity:          filtered,
+	}
+	return input, activity, nil
+}
+
+func SendTelemetry(ctx context.Context, clientId string) error {
+	input, activity, err := MakeTelemetryInput(ctx, clientId)
+	if err != nil {
+		return err
 	}
+	if input == nil {
+		log.Printf("telemetry disabled or no activity, not sending\n")
+		return nil
+	}
+	log.Printf("[wcloud] sending telemetry data\n")
 	req, err := makeAnonPostReq(ctx, TelemetryUrl, input)
 	if err != nil {
 		return err
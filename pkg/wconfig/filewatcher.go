@@ -23,6 +23,7 @@ type Watcher struct {
 	watcher     *fsnotify.Watcher
 	mutex       sync.Mutex
 	fullConfig  FullConfigType
+	handlers    []func(FullConfigType)
 }
 
 type WatcherUpdate struct {
@@ -103,7 +104,27 @@ func (w *Watcher) Close() {
 	}
 }
 
+// RegisterUpdateHandler registers a backend handler that is called with the
+// full config at startup and whenever the config changes.  handlers are called
+// in order while the watcher is locked, so they must not call back into the watcher.
+func (w *Watcher) RegisterUpdateHandler(handler func(FullConfigType)) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.handlers = append(w.handlers, handler)
+	if w.initialized {
+		w.runHandler(handler, w.fullConfig)
+	}
+}
+
+func (w *Watcher) runHandler(handler func(FullConfigType), fullConfig FullConfigType) {
+	defer panichandler.PanicHandler("filewatcher:runHandler")
+	handler(fullConfig)
+}
+
 func (w *Watcher) broadcast(message WatcherUpdate) {
+	for _, handler := range w.handlers {
+		w.runHandler(handler, message.FullConfig)
+	}
 	// send to frontend
 	wps.Broker.Publish(wps.WaveEvent{
 		Event: wps.Event_Config,
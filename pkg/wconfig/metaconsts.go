@@ -20,6 +20,19 @@ const (
 	ConfigKey_AIApiVersion                   = "ai:apiversion"
 	ConfigKey_AiMaxTokens                    = "ai:maxtokens"
 	ConfigKey_AiTimeoutMs                    = "ai:timeoutms"
+	ConfigKey_AiTemperature                  = "ai:temperature"
+	ConfigKey_AiSystemPrompt                 = "ai:systemprompt"
+	ConfigKey_AiTools                        = "ai:tools"
+	ConfigKey_AiToolsAutoApprove             = "ai:toolsautoapprove"
+	ConfigKey_AiDailyTokenLimit              = "ai:dailytokenlimit"
+	ConfigKey_AiMonthlyTokenLimit            = "ai:monthlytokenlimit"
+	ConfigKey_AiTokenLimitAction             = "ai:tokenlimitaction"
+	ConfigKey_AiHeaders                      = "ai:headers"
+	ConfigKey_AiAzureDeployment              = "ai:azuredeployment"
+	ConfigKey_AiTlsSkipVerify                = "ai:tlsskipverify"
+	ConfigKey_AiTlsCaCert                    = "ai:tlscacert"
+	ConfigKey_AiTlsClientCert                = "ai:tlsclientcert"
+	ConfigKey_AiTlsClientKey                 = "ai:tlsclientkey"
 	ConfigKey_AiFontSize                     = "ai:fontsize"
 	ConfigKey_AiFixedFontSize                = "ai:fixedfontsize"
 
@@ -32,6 +45,7 @@ const (
 	ConfigKey_TermLocalShellOpts             = "term:localshellopts"
 	ConfigKey_TermScrollback                 = "term:scrollback"
 	ConfigKey_TermCopyOnSelect               = "term:copyonselect"
+	ConfigKey_TermOsc52                      = "term:osc52"
 
 	ConfigKey_EditorMinimapEnabled           = "editor:minimapenabled"
 	ConfigKey_EditorStickyScrollEnabled      = "editor:stickyscrollenabled"
@@ -51,12 +65,18 @@ const (
 	ConfigKey_AutoUpdateIntervalMs           = "autoupdate:intervalms"
 	ConfigKey_AutoUpdateInstallOnQuit        = "autoupdate:installonquit"
 	ConfigKey_AutoUpdateChannel              = "autoupdate:channel"
+	ConfigKey_AutoUpdateDelta                = "autoupdate:delta"
+	ConfigKey_AutoUpdateDeferIdle            = "autoupdate:deferuntilidle"
 
 	ConfigKey_MarkdownFontSize               = "markdown:fontsize"
 	ConfigKey_MarkdownFixedFontSize          = "markdown:fixedfontsize"
 
 	ConfigKey_PreviewShowHiddenFiles         = "preview:showhiddenfiles"
 
+	ConfigKey_ClipboardClear                 = "clipboard:*"
+	ConfigKey_ClipboardRemote                = "clipboard:remote"
+	ConfigKey_ClipboardMaxSize               = "clipboard:maxsize"
+
 	ConfigKey_TabPreset                      = "tab:preset"
 
 	ConfigKey_WidgetClear                    = "widget:*"
@@ -78,11 +98,49 @@ const (
 	ConfigKey_WindowMagnifiedBlockBlurPrimaryPx = "window:magnifiedblockblurprimarypx"
 	ConfigKey_WindowMagnifiedBlockBlurSecondaryPx = "window:magnifiedblockblursecondarypx"
 
+	ConfigKey_DebugClear                     = "debug:*"
+	ConfigKey_DebugPprof                     = "debug:pprof"
+
 	ConfigKey_TelemetryClear                 = "telemetry:*"
 	ConfigKey_TelemetryEnabled               = "telemetry:enabled"
+	ConfigKey_TelemetryCrashes               = "telemetry:crashes"
+	ConfigKey_TelemetryUsage                 = "telemetry:usage"
+	ConfigKey_TelemetryPerformance           = "telemetry:performance"
+
+	ConfigKey_LogClear                       = "log:*"
+	ConfigKey_LogLevel                       = "log:level"
+	ConfigKey_LogFormat                      = "log:format"
+	ConfigKey_LogPackageLevels               = "log:packagelevels"
+	ConfigKey_LogMaxSizeMB                   = "log:maxsizemb"
+	ConfigKey_LogMaxAgeDays                  = "log:maxagedays"
+	ConfigKey_LogMaxTotalMB                  = "log:maxtotalmb"
+	ConfigKey_LogCompress                    = "log:compress"
+
+	ConfigKey_TracingClear                   = "tracing:*"
+	ConfigKey_TracingEnabled                 = "tracing:enabled"
+	ConfigKey_TracingEndpoint                = "tracing:endpoint"
+
+	ConfigKey_UserInputClear                 = "userinput:*"
+	ConfigKey_UserInputTimeoutMs             = "userinput:timeoutms"
+	ConfigKey_UserInputPassphraseTimeoutMs   = "userinput:passphrasetimeoutms"
+	ConfigKey_UserInputPasswordTimeoutMs     = "userinput:passwordtimeoutms"
+	ConfigKey_UserInputKbdInteractiveTimeoutMs = "userinput:kbdinteractivetimeoutms"
+	ConfigKey_UserInputHostKeyTimeoutMs      = "userinput:hostkeytimeoutms"
+	ConfigKey_UserInputSecurityKeyTimeoutMs  = "userinput:securitykeytimeoutms"
+	ConfigKey_UserInputExtendPrompt          = "userinput:extendprompt"
 
 	ConfigKey_ConnClear                      = "conn:*"
 	ConfigKey_ConnAskBeforeWshInstall        = "conn:askbeforewshinstall"
 	ConfigKey_ConnWshEnabled                 = "conn:wshenabled"
+	ConfigKey_ConnTailscaleSocket            = "conn:tailscalesocket"
+	ConfigKey_ConnDockerHost                 = "conn:dockerhost"
+	ConfigKey_ConnPodmanHost                 = "conn:podmanhost"
+	ConfigKey_ConnContainerdHost             = "conn:containerdhost"
+	ConfigKey_ConnIncusHost                  = "conn:incushost"
+	ConfigKey_ConnLxdHost                    = "conn:lxdhost"
+	ConfigKey_ConnPassphraseCacheSecs        = "conn:passphrasecachesecs"
+	ConfigKey_ConnInternalAgent              = "conn:internalagent"
+	ConfigKey_ConnMaxConcurrent              = "conn:maxconcurrent"
+	ConfigKey_ConnMaxConcurrentPerHost       = "conn:maxconcurrentperhost"
 )
 
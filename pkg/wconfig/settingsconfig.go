@@ -36,19 +36,32 @@ type SettingsType struct {
 	AppClear        bool   `json:"app:*,omitempty"`
 	AppGlobalHotkey string `json:"app:globalhotkey,omitempty"`
 
-	AiClear         bool    `json:"ai:*,omitempty"`
-	AiPreset        string  `json:"ai:preset,omitempty"`
-	AiApiType       string  `json:"ai:apitype,omitempty"`
-	AiBaseURL       string  `json:"ai:baseurl,omitempty"`
-	AiApiToken      string  `json:"ai:apitoken,omitempty"`
-	AiName          string  `json:"ai:name,omitempty"`
-	AiModel         string  `json:"ai:model,omitempty"`
-	AiOrgID         string  `json:"ai:orgid,omitempty"`
-	AIApiVersion    string  `json:"ai:apiversion,omitempty"`
-	AiMaxTokens     float64 `json:"ai:maxtokens,omitempty"`
-	AiTimeoutMs     float64 `json:"ai:timeoutms,omitempty"`
-	AiFontSize      float64 `json:"ai:fontsize,omitempty"`
-	AiFixedFontSize float64 `json:"ai:fixedfontsize,omitempty"`
+	AiClear             bool              `json:"ai:*,omitempty"`
+	AiPreset            string            `json:"ai:preset,omitempty"`
+	AiApiType           string            `json:"ai:apitype,omitempty"`
+	AiBaseURL           string            `json:"ai:baseurl,omitempty"`
+	AiApiToken          string            `json:"ai:apitoken,omitempty"`
+	AiName              string            `json:"ai:name,omitempty"`
+	AiModel             string            `json:"ai:model,omitempty"`
+	AiOrgID             string            `json:"ai:orgid,omitempty"`
+	AIApiVersion        string            `json:"ai:apiversion,omitempty"`
+	AiMaxTokens         float64           `json:"ai:maxtokens,omitempty"`
+	AiTimeoutMs         float64           `json:"ai:timeoutms,omitempty"`
+	AiTemperature       *float64          `json:"ai:temperature,omitempty"`
+	AiSystemPrompt      string            `json:"ai:systemprompt,omitempty"`
+	AiTools             bool              `json:"ai:tools,omitempty"`
+	AiToolsAutoApprove  []string          `json:"ai:toolsautoapprove,omitempty"`
+	AiDailyTokenLimit   float64           `json:"ai:dailytokenlimit,omitempty"`
+	AiMonthlyTokenLimit float64           `json:"ai:monthlytokenlimit,omitempty"`
+	AiTokenLimitAction  string            `json:"ai:tokenlimitaction,omitempty"`
+	AiHeaders           map[string]string `json:"ai:headers,omitempty"`
+	AiAzureDeployment   string            `json:"ai:azuredeployment,omitempty"`
+	AiTlsSkipVerify     bool              `json:"ai:tlsskipverify,omitempty"`
+	AiTlsCaCert         string            `json:"ai:tlscacert,omitempty"`
+	AiTlsClientCert     string            `json:"ai:tlsclientcert,omitempty"`
+	AiTlsClientKey      string            `json:"ai:tlsclientkey,omitempty"`
+	AiFontSize          float64           `json:"ai:fontsize,omitempty"`
+	AiFixedFontSize     float64           `json:"ai:fixedfontsize,omitempty"`
 
 	TermClear          bool     `json:"term:*,omitempty"`
 	TermFontSize       float64  `json:"term:fontsize,omitempty"`
@@ -59,6 +72,7 @@ type SettingsType struct {
 	TermLocalShellOpts []string `json:"term:localshellopts,omitempty"`
 	TermScrollback     *int64   `json:"term:scrollback,omitempty"`
 	TermCopyOnSelect   *bool    `json:"term:copyonselect,omitempty"`
+	TermOsc52          string   `json:"term:osc52,omitempty"` // "focus" (default), "always", or "never"
 
 	EditorMinimapEnabled      bool    `json:"editor:minimapenabled,omitempty"`
 	EditorStickyScrollEnabled bool    `json:"editor:stickyscrollenabled,omitempty"`
@@ -77,13 +91,19 @@ type SettingsType struct {
 	AutoUpdateEnabled       bool    `json:"autoupdate:enabled,omitempty"`
 	AutoUpdateIntervalMs    float64 `json:"autoupdate:intervalms,omitempty"`
 	AutoUpdateInstallOnQuit bool    `json:"autoupdate:installonquit,omitempty"`
-	AutoUpdateChannel       string  `json:"autoupdate:channel,omitempty"`
+	AutoUpdateChannel       string  `json:"autoupdate:channel,omitempty"` // "stable", "beta", or "nightly"
+	AutoUpdateDelta         bool    `json:"autoupdate:delta,omitempty"`
+	AutoUpdateDeferIdle     bool    `json:"autoupdate:deferuntilidle,omitempty"`
 
 	MarkdownFontSize      float64 `json:"markdown:fontsize,omitempty"`
 	MarkdownFixedFontSize float64 `json:"markdown:fixedfontsize,omitempty"`
 
 	PreviewShowHiddenFiles *bool `json:"preview:showhiddenfiles,omitempty"`
 
+	ClipboardClear   bool   `json:"clipboard:*,omitempty"`
+	ClipboardRemote  string `json:"clipboard:remote,omitempty"`  // "ask" (default), "allow", or "deny"
+	ClipboardMaxSize int64  `json:"clipboard:maxsize,omitempty"` // bytes
+
 	TabPreset string `json:"tab:preset,omitempty"`
 
 	WidgetClear    bool  `json:"widget:*,omitempty"`
@@ -105,12 +125,50 @@ type SettingsType struct {
 	WindowMagnifiedBlockBlurPrimaryPx   *int64   `json:"window:magnifiedblockblurprimarypx,omitempty"`
 	WindowMagnifiedBlockBlurSecondaryPx *int64   `json:"window:magnifiedblockblursecondarypx,omitempty"`
 
-	TelemetryClear   bool `json:"telemetry:*,omitempty"`
-	TelemetryEnabled bool `json:"telemetry:enabled,omitempty"`
-
-	ConnClear               bool `json:"conn:*,omitempty"`
-	ConnAskBeforeWshInstall bool `json:"conn:askbeforewshinstall,omitempty"`
-	ConnWshEnabled          bool `json:"conn:wshenabled,omitempty"`
+	DebugClear bool `json:"debug:*,omitempty"`
+	DebugPprof bool `json:"debug:pprof,omitempty"`
+
+	TelemetryClear       bool  `json:"telemetry:*,omitempty"`
+	TelemetryEnabled     bool  `json:"telemetry:enabled,omitempty"`
+	TelemetryCrashes     *bool `json:"telemetry:crashes,omitempty"`
+	TelemetryUsage       *bool `json:"telemetry:usage,omitempty"`
+	TelemetryPerformance *bool `json:"telemetry:performance,omitempty"`
+
+	LogClear         bool   `json:"log:*,omitempty"`
+	LogLevel         string `json:"log:level,omitempty"`
+	LogFormat        string `json:"log:format,omitempty"`
+	LogPackageLevels string `json:"log:packagelevels,omitempty"`
+	LogMaxSizeMB     *int64 `json:"log:maxsizemb,omitempty"`
+	LogMaxAgeDays    *int64 `json:"log:maxagedays,omitempty"`
+	LogMaxTotalMB    *int64 `json:"log:maxtotalmb,omitempty"`
+	LogCompress      *bool  `json:"log:compress,omitempty"`
+
+	TracingClear    bool   `json:"tracing:*,omitempty"`
+	TracingEnabled  bool   `json:"tracing:enabled,omitempty"`
+	TracingEndpoint string `json:"tracing:endpoint,omitempty"`
+
+	UserInputClear                   bool   `json:"userinput:*,omitempty"`
+	UserInputTimeoutMs               *int64 `json:"userinput:timeoutms,omitempty"`
+	UserInputPassphraseTimeoutMs     *int64 `json:"userinput:passphrasetimeoutms,omitempty"`
+	UserInputPasswordTimeoutMs       *int64 `json:"userinput:passwordtimeoutms,omitempty"`
+	UserInputKbdInteractiveTimeoutMs *int64 `json:"userinput:kbdinteractivetimeoutms,omitempty"`
+	UserInputHostKeyTimeoutMs        *int64 `json:"userinput:hostkeytimeoutms,omitempty"`
+	UserInputSecurityKeyTimeoutMs    *int64 `json:"userinput:securitykeytimeoutms,omitempty"`
+	UserInputExtendPrompt            *bool  `json:"userinput:extendprompt,omitempty"`
+
+	ConnClear                bool   `json:"conn:*,omitempty"`
+	ConnAskBeforeWshInstall  bool   `json:"conn:askbeforewshinstall,omitempty"`
+	ConnWshEnabled           bool   `json:"conn:wshenabled,omitempty"`
+	ConnTailscaleSocket      string `json:"conn:tailscalesocket,omitempty"`
+	ConnDockerHost           string `json:"conn:dockerhost,omitempty"`
+	ConnPodmanHost           string `json:"conn:podmanhost,omitempty"`
+	ConnContainerdHost       string `json:"conn:containerdhost,omitempty"`
+	ConnIncusHost            string `json:"conn:incushost,omitempty"`
+	ConnLxdHost              string `json:"conn:lxdhost,omitempty"`
+	ConnPassphraseCacheSecs  *int64 `json:"conn:passphrasecachesecs,omitempty"`
+	ConnInternalAgent        *bool  `json:"conn:internalagent,omitempty"`
+	ConnMaxConcurrent        *int64 `json:"conn:maxconcurrent,omitempty"`
+	ConnMaxConcurrentPerHost *int64 `json:"conn:maxconcurrentperhost,omitempty"`
 }
 
 type ConfigError struct {
@@ -126,6 +184,7 @@ type FullConfigType struct {
 	Presets        map[string]waveobj.MetaMapType `json:"presets"`
 	TermThemes     map[string]TermThemeType       `json:"termthemes"`
 	Connections    map[string]wshrpc.ConnKeywords `json:"connections"`
+	Hooks          map[string]HookConfigType      `json:"hooks"`
 	ConfigErrors   []ConfigError                  `json:"configerrors" configfile:"-"`
 }
 
@@ -520,7 +579,11 @@ func SetConnectionsConfigValue(connName string, toMerge waveobj.MetaMapType) err
 		connData = make(waveobj.MetaMapType)
 	}
 	for configKey, val := range toMerge {
-		connData[configKey] = val
+		if val == nil {
+			delete(connData, configKey)
+		} else {
+			connData[configKey] = val
+		}
 	}
 	m[connName] = connData
 	return WriteWaveHomeConfigFile(ConnectionsFile, m)
@@ -535,6 +598,21 @@ type WidgetConfigType struct {
 	BlockDef     waveobj.BlockDef `json:"blockdef"`
 }
 
+// an automation hook (hooks.json), runs a command when an event happens
+type HookConfigType struct {
+	Event      string            `json:"event"`                // see hooks.HookEvent_* (e.g. "cmd:failed", "interval")
+	Command    string            `json:"command"`              // run with the shell (sh -c, or cmd /c on windows), wsh is in the PATH
+	Connection string            `json:"connection,omitempty"` // only for events on this connection ("local" for local terminals)
+	Match      string            `json:"match,omitempty"`      // regexp, matched against the command (cmd events) or path (file events)
+	Paths      []string          `json:"paths,omitempty"`      // local files and directories to watch (file:change)
+	Interval   string            `json:"interval,omitempty"`   // for interval hooks, a duration like "15m"
+	Cwd        string            `json:"cwd,omitempty"`
+	Env        map[string]string `json:"env,omitempty"`     // values are templates over the event payload
+	Stdin      string            `json:"stdin,omitempty"`   // template over the event payload (default is the payload as json)
+	Timeout    float64           `json:"timeout,omitempty"` // seconds (default 60)
+	Disabled   bool              `json:"disabled,omitempty"`
+}
+
 type MimeTypeConfigType struct {
 	Icon  string `json:"icon"`
 	Color string `json:"color"`
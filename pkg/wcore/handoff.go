@@ -0,0 +1,249 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wcore
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wps"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wstore"
+)
+
+// a handoff moves a workspace to another Wave instance.  it carries the tabs, the layout, and the
+// block metadata (connection, cwd, file, url, ...), so terminals come back on the same connection in
+// the same directory.  the shells themselves (and the scrollback) are not moved, a new shell is
+// started on the other side.
+
+// ExportWorkspace serializes a workspace for ImportWorkspace
+func ExportWorkspace(ctx context.Context, workspaceId string) (*wshrpc.WorkspaceHandoffData, error) {
+	ws, err := GetWorkspace(ctx, workspaceId)
+	if err != nil {
+		return nil, fmt.Errorf("workspace %s not found: %w", workspaceId, err)
+	}
+	hostname, _ := os.Hostname()
+	rtn := &wshrpc.WorkspaceHandoffData{
+		Version:  wshrpc.WorkspaceHandoffVersion,
+		Ts:       time.Now().UnixMilli(),
+		Hostname: hostname,
+		Name:     ws.Name,
+		Icon:     ws.Icon,
+		Color:    ws.Color,
+	}
+	for _, tabId := range append(ws.PinnedTabIds, ws.TabIds...) {
+		tabData, err := exportTab(ctx, tabId)
+		if err != nil {
+			return nil, err
+		}
+		tabData.Pinned = len(rtn.Tabs) < len(ws.PinnedTabIds)
+		if tabId == ws.ActiveTabId {
+			rtn.ActiveTab = len(rtn.Tabs)
+		}
+		rtn.Tabs = append(rtn.Tabs, *tabData)
+	}
+	return rtn, nil
+}
+
+func exportTab(ctx context.Context, tabId string) (*wshrpc.HandoffTabData, error) {
+	tab, err := wstore.DBMustGet[*waveobj.Tab](ctx, tabId)
+	if err != nil {
+		return nil, fmt.Errorf("error getting tab %s: %w", tabId, err)
+	}
+	layoutState, err := wstore.DBMustGet[*waveobj.LayoutState](ctx, tab.LayoutState)
+	if err != nil {
+		return nil, fmt.Errorf("error getting layout for tab %s: %w", tabId, err)
+	}
+	rtn := &wshrpc.HandoffTabData{
+		Name:            tab.Name,
+		Meta:            tab.Meta,
+		RootNode:        layoutState.RootNode,
+		FocusedNodeId:   layoutState.FocusedNodeId,
+		MagnifiedNodeId: layoutState.MagnifiedNodeId,
+		Blocks:          []wshrpc.HandoffBlockData{},
+	}
+	// only blocks in the layout are moved (ephemeral blocks are left behind)
+	var layoutBlockIds map[string]bool
+	if layoutState.RootNode != nil {
+		layoutBlockIds = make(map[string]bool)
+		collectLayoutBlockIds(layoutState.RootNode, layoutBlockIds)
+	}
+	for _, blockId := range tab.BlockIds {
+		if layoutBlockIds != nil && !layoutBlockIds[blockId] {
+			continue
+		}
+		block, err := wstore.DBGet[*waveobj.Block](ctx, blockId)
+		if err != nil {
+			return nil, fmt.Errorf("error getting block %s: %w", blockId, err)
+		}
+		if block == nil {
+			continue
+		}
+		rtn.Blocks = append(rtn.Blocks, wshrpc.HandoffBlockData{BlockId: blockId, Meta: block.Meta})
+	}
+	return rtn, nil
+}
+
+func collectLayoutBlockIds(node any, blockIds map[string]bool) {
+	nodeMap, ok := node.(map[string]any)
+	if !ok {
+		return
+	}
+	if data, ok := nodeMap["data"].(map[string]any); ok {
+		if blockId, ok := data["blockId"].(string); ok {
+			blockIds[blockId] = true
+		}
+	}
+	children, _ := nodeMap["children"].([]any)
+	for _, child := range children {
+		collectLayoutBlockIds(child, blockIds)
+	}
+}
+
+// copies a layout tree with new node ids and the new block ids.  leaves for blocks that weren't
+// created are dropped (and so are the containers they leave empty).
+func remapLayoutNode(node any, blockIdMap map[string]string, nodeIdMap map[string]string) any {
+	nodeMap, ok := node.(map[string]any)
+	if !ok {
+		return nil
+	}
+	rtn := make(map[string]any)
+	for key, val := range nodeMap {
+		rtn[key] = val
+	}
+	newNodeId := uuid.NewString()
+	if oldNodeId, ok := nodeMap["id"].(string); ok {
+		nodeIdMap[oldNodeId] = newNodeId
+	}
+	rtn["id"] = newNodeId
+	if data, ok := nodeMap["data"].(map[string]any); ok {
+		oldBlockId, _ := data["blockId"].(string)
+		newBlockId := blockIdMap[oldBlockId]
+		if newBlockId == "" {
+			return nil
+		}
+		rtn["data"] = map[string]any{"blockId": newBlockId}
+		return rtn
+	}
+	children, _ := nodeMap["children"].([]any)
+	newChildren := make([]any, 0, len(children))
+	for _, child := range children {
+		if newChild := remapLayoutNode(child, blockIdMap, nodeIdMap); newChild != nil {
+			newChildren = append(newChildren, newChild)
+		}
+	}
+	if len(newChildren) == 0 {
+		return nil
+	}
+	rtn["children"] = newChildren
+	return rtn
+}
+
+// ImportWorkspace creates a new workspace from an exported one, returns the new workspace id
+func ImportWorkspace(ctx context.Context, data *wshrpc.WorkspaceHandoffData) (string, error) {
+	if data == nil {
+		return "", fmt.Errorf("no workspace to import")
+	}
+	if data.Version > wshrpc.WorkspaceHandoffVersion {
+		return "", fmt.Errorf("workspace was exported by a newer version of Wave (handoff version %d)", data.Version)
+	}
+	if len(data.Tabs) == 0 {
+		return "", fmt.Errorf("workspace has no tabs")
+	}
+	ws := &waveobj.Workspace{
+		OID:          uuid.NewString(),
+		TabIds:       []string{},
+		PinnedTabIds: []string{},
+	}
+	err := wstore.DBInsert(ctx, ws)
+	if err != nil {
+		return "", fmt.Errorf("error inserting workspace: %w", err)
+	}
+	var activeTabId string
+	for idx, tabData := range data.Tabs {
+		tabId, err := importTab(ctx, ws.OID, &tabData)
+		if err != nil {
+			DeleteWorkspace(ctx, ws.OID, true)
+			return "", err
+		}
+		if idx == data.ActiveTab || activeTabId == "" {
+			activeTabId = tabId
+		}
+	}
+	err = SetActiveTab(ctx, ws.OID, activeTabId)
+	if err != nil {
+		return "", fmt.Errorf("error setting active tab: %w", err)
+	}
+	name := data.Name
+	if name != "" && data.Hostname != "" {
+		name = fmt.Sprintf("%s (%s)", name, data.Hostname)
+	}
+	_, err = UpdateWorkspace(ctx, ws.OID, name, data.Icon, data.Color, true)
+	if err != nil {
+		return "", err
+	}
+	wps.Broker.Publish(wps.WaveEvent{
+		Event: wps.Event_WorkspaceUpdate})
+	log.Printf("imported workspace %s from %q (%d tabs)\n", ws.OID, data.Hostname, len(data.Tabs))
+	return ws.OID, nil
+}
+
+func importTab(ctx context.Context, workspaceId string, tabData *wshrpc.HandoffTabData) (string, error) {
+	tab, err := createTabObj(ctx, workspaceId, tabData.Name, tabData.Pinned)
+	if err != nil {
+		return "", fmt.Errorf("error creating tab: %w", err)
+	}
+	if len(tabData.Meta) > 0 {
+		wstore.UpdateObjectMeta(ctx, *waveobj.ORefFromWaveObj(tab), tabData.Meta, true)
+	}
+	blockIdMap := make(map[string]string)
+	var newBlockIds []string
+	for _, blockData := range tabData.Blocks {
+		meta := blockData.Meta
+		if meta.GetString(waveobj.MetaKey_Controller, "") == "cmd" {
+			// don't re-run commands on the new machine until the user asks for it
+			meta = waveobj.MergeMeta(meta, waveobj.MetaMapType{waveobj.MetaKey_CmdRunOnStart: false}, false)
+		}
+		block, err := CreateBlock(ctx, tab.OID, &waveobj.BlockDef{Meta: meta}, &waveobj.RuntimeOpts{})
+		if err != nil {
+			log.Printf("handoff: skipping block %s: %v\n", blockData.BlockId, err)
+			continue
+		}
+		blockIdMap[blockData.BlockId] = block.OID
+		newBlockIds = append(newBlockIds, block.OID)
+	}
+	layoutState, err := wstore.DBMustGet[*waveobj.LayoutState](ctx, tab.LayoutState)
+	if err != nil {
+		return "", fmt.Errorf("error getting layout for tab: %w", err)
+	}
+	nodeIdMap := make(map[string]string)
+	var rootNode any
+	if tabData.RootNode != nil {
+		rootNode = remapLayoutNode(tabData.RootNode, blockIdMap, nodeIdMap)
+	}
+	if rootNode != nil {
+		layoutState.RootNode = rootNode
+		layoutState.FocusedNodeId = nodeIdMap[tabData.FocusedNodeId]
+		layoutState.MagnifiedNodeId = nodeIdMap[tabData.MagnifiedNodeId]
+	} else {
+		// no saved layout (the tab was never displayed), let the frontend lay the blocks out
+		var actions []waveobj.LayoutActionData
+		for _, blockId := range newBlockIds {
+			actions = append(actions, waveobj.LayoutActionData{ActionType: LayoutActionDataType_Insert, BlockId: blockId})
+		}
+		if len(actions) > 0 {
+			layoutState.PendingBackendActions = &actions
+		}
+	}
+	err = wstore.DBUpdate(ctx, layoutState)
+	if err != nil {
+		return "", fmt.Errorf("error updating layout for tab: %w", err)
+	}
+	return tab.OID, nil
+}
@@ -0,0 +1,47 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wcore
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRemapLayoutNode(t *testing.T) {
+	var rootNode any
+	err := json.Unmarshal([]byte(`{
+		"id": "root", "flexDirection": "row", "size": 10,
+		"children": [
+			{"id": "n1", "flexDirection": "row", "size": 10, "data": {"blockId": "b1"}},
+			{"id": "n2", "flexDirection": "column", "size": 10, "children": [
+				{"id": "n3", "flexDirection": "row", "size": 10, "data": {"blockId": "b2"}}
+			]}
+		]
+	}`), &rootNode)
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	blockIds := make(map[string]bool)
+	collectLayoutBlockIds(rootNode, blockIds)
+	if len(blockIds) != 2 || !blockIds["b1"] || !blockIds["b2"] {
+		t.Errorf("unexpected block ids %v", blockIds)
+	}
+	// b2 wasn't created, so n3 and its (now empty) parent n2 are dropped
+	nodeIdMap := make(map[string]string)
+	newRoot := remapLayoutNode(rootNode, map[string]string{"b1": "new1"}, nodeIdMap).(map[string]any)
+	if newRoot["id"] == "root" || nodeIdMap["root"] != newRoot["id"] {
+		t.Errorf("expected a new root node id, got %v", newRoot["id"])
+	}
+	children := newRoot["children"].([]any)
+	if len(children) != 1 {
+		t.Fatalf("expected 1 child, got %d", len(children))
+	}
+	child := children[0].(map[string]any)
+	if child["data"].(map[string]any)["blockId"] != "new1" || child["size"] != float64(10) {
+		t.Errorf("unexpected child %v", child)
+	}
+	if remapLayoutNode(rootNode, map[string]string{}, nodeIdMap) != nil {
+		t.Errorf("expected an empty layout to be dropped")
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/wavetermdev/waveterm/pkg/eventbus"
 	"github.com/wavetermdev/waveterm/pkg/util/utilfn"
 	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wps"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
 	"github.com/wavetermdev/waveterm/pkg/wshutil"
@@ -63,9 +64,22 @@ func SwitchWorkspace(ctx context.Context, windowId string, workspaceId string) (
 	}
 
 	log.Printf("switching window %s to workspace %s\n", windowId, workspaceId)
+	sendWorkspaceOpenEvent(windowId, ws)
 	return ws, nil
 }
 
+func sendWorkspaceOpenEvent(windowId string, ws *waveobj.Workspace) {
+	wps.Broker.Publish(wps.WaveEvent{
+		Event:  wps.Event_WorkspaceOpen,
+		Scopes: []string{waveobj.MakeORef(waveobj.OType_Workspace, ws.OID).String()},
+		Data: wps.WorkspaceOpenEventData{
+			WindowId:      windowId,
+			WorkspaceId:   ws.OID,
+			WorkspaceName: ws.Name,
+		},
+	})
+}
+
 func GetWindow(ctx context.Context, windowId string) (*waveobj.Window, error) {
 	window, err := wstore.DBMustGet[*waveobj.Window](ctx, windowId)
 	if err != nil {
@@ -121,6 +135,7 @@ func CreateWindow(ctx context.Context, winSize *waveobj.WinSize, workspaceId str
 	if err != nil {
 		return nil, fmt.Errorf("error updating client: %w", err)
 	}
+	sendWorkspaceOpenEvent(windowId, ws)
 	return GetWindow(ctx, windowId)
 }
 
@@ -0,0 +1,238 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package web
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshserver"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+// remote files are streamed in fixed size chunks fetched with byte range requests, so media players
+// (which seek with http range requests) only fetch the parts they play.  responses to open-ended
+// ranges are capped, the player requests the rest as it needs it.  recently fetched chunks are
+// cached (keyed by the file's size and modtime, so a changed file is fetched again).
+
+const RemoteStreamChunkSize = 1024 * 1024
+const RemoteStreamMaxRangeSize = 4 * RemoteStreamChunkSize
+const RemoteStreamCacheMaxBytes = 64 * 1024 * 1024
+const RemoteStreamChunkTimeout = 15 * time.Second
+
+type remoteChunkKey struct {
+	Conn    string
+	Path    string
+	Size    int64
+	ModTime int64
+	Index   int64
+}
+
+type remoteChunk struct {
+	Key  remoteChunkKey
+	Data []byte
+}
+
+type remoteChunkCache struct {
+	Lock     *sync.Mutex
+	Chunks   map[remoteChunkKey]*list.Element
+	LruList  *list.List
+	NumBytes int
+}
+
+var remoteStreamCache = &remoteChunkCache{
+	Lock:    &sync.Mutex{},
+	Chunks:  make(map[remoteChunkKey]*list.Element),
+	LruList: list.New(),
+}
+
+func (c *remoteChunkCache) get(key remoteChunkKey) []byte {
+	c.Lock.Lock()
+	defer c.Lock.Unlock()
+	elem := c.Chunks[key]
+	if elem == nil {
+		return nil
+	}
+	c.LruList.MoveToFront(elem)
+	return elem.Value.(*remoteChunk).Data
+}
+
+func (c *remoteChunkCache) put(key remoteChunkKey, data []byte) {
+	c.Lock.Lock()
+	defer c.Lock.Unlock()
+	if c.Chunks[key] != nil {
+		return
+	}
+	c.Chunks[key] = c.LruList.PushFront(&remoteChunk{Key: key, Data: data})
+	c.NumBytes += len(data)
+	for c.NumBytes > RemoteStreamCacheMaxBytes && c.LruList.Len() > 1 {
+		oldest := c.LruList.Back()
+		chunk := oldest.Value.(*remoteChunk)
+		c.LruList.Remove(oldest)
+		delete(c.Chunks, chunk.Key)
+		c.NumBytes -= len(chunk.Data)
+	}
+}
+
+func fetchRemoteChunk(conn string, fileInfo *wshrpc.FileInfo, index int64) ([]byte, error) {
+	key := remoteChunkKey{Conn: conn, Path: fileInfo.Path, Size: fileInfo.Size, ModTime: fileInfo.ModTime, Index: index}
+	if data := remoteStreamCache.get(key); data != nil {
+		return data, nil
+	}
+	start := index * RemoteStreamChunkSize
+	end := min(start+RemoteStreamChunkSize, fileInfo.Size)
+	client := wshserver.GetMainRpcClient()
+	streamFileData := wshrpc.CommandRemoteStreamFileData{Path: fileInfo.Path, ByteRange: fmt.Sprintf("%d-%d", start, end)}
+	route := wshutil.MakeConnectionRouteId(conn)
+	rtnCh := wshclient.RemoteStreamFileCommand(client, streamFileData, &wshrpc.RpcOpts{Route: route, Timeout: int(RemoteStreamChunkTimeout.Milliseconds())})
+	var buf bytes.Buffer
+	var rtnErr error
+	for respUnion := range rtnCh {
+		if respUnion.Error != nil {
+			rtnErr = respUnion.Error
+			continue
+		}
+		if respUnion.Response.Data64 == "" || rtnErr != nil {
+			continue
+		}
+		decoder := base64.NewDecoder(base64.StdEncoding, strings.NewReader(respUnion.Response.Data64))
+		if _, err := io.Copy(&buf, decoder); err != nil {
+			rtnErr = fmt.Errorf("decoding file data: %w", err)
+		}
+	}
+	if rtnErr != nil {
+		return nil, rtnErr
+	}
+	if int64(buf.Len()) != end-start {
+		return nil, fmt.Errorf("short read streaming %q (got %d bytes, expected %d)", fileInfo.Path, buf.Len(), end-start)
+	}
+	remoteStreamCache.put(key, buf.Bytes())
+	return buf.Bytes(), nil
+}
+
+// parses a single "bytes=" range (multiple ranges are not supported).  returns the inclusive start
+// and end.  ok is false if there is no range header (or it can't be used, so the whole file is sent).
+func parseHttpRange(rangeHeader string, size int64) (int64, int64, bool, error) {
+	if rangeHeader == "" || !strings.HasPrefix(rangeHeader, "bytes=") || strings.Contains(rangeHeader, ",") {
+		return 0, 0, false, nil
+	}
+	startStr, endStr, found := strings.Cut(strings.TrimPrefix(rangeHeader, "bytes="), "-")
+	if !found {
+		return 0, 0, false, nil
+	}
+	startStr, endStr = strings.TrimSpace(startStr), strings.TrimSpace(endStr)
+	if startStr == "" {
+		// suffix range, the last N bytes
+		suffixLen, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || suffixLen <= 0 {
+			return 0, 0, false, fmt.Errorf("invalid range %q", rangeHeader)
+		}
+		return max(size-suffixLen, 0), size - 1, true, nil
+	}
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false, fmt.Errorf("invalid range %q", rangeHeader)
+	}
+	end := size - 1
+	if endStr != "" {
+		end, err = strconv.ParseInt(endStr, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false, fmt.Errorf("invalid range %q", rangeHeader)
+		}
+		end = min(end, size-1)
+	}
+	return start, end, true, nil
+}
+
+// writes bytes [start, end] of the file (fetching the chunks that cover it)
+func writeRemoteRange(w io.Writer, conn string, fileInfo *wshrpc.FileInfo, start int64, end int64) error {
+	for chunkIdx := start / RemoteStreamChunkSize; chunkIdx*RemoteStreamChunkSize <= end; chunkIdx++ {
+		data, err := fetchRemoteChunk(conn, fileInfo, chunkIdx)
+		if err != nil {
+			return err
+		}
+		chunkStart := chunkIdx * RemoteStreamChunkSize
+		dataStart := max(start-chunkStart, 0)
+		dataEnd := min(end-chunkStart+1, int64(len(data)))
+		if _, err := w.Write(data[dataStart:dataEnd]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func handleRemoteStreamFile(w http.ResponseWriter, r *http.Request, conn string, path string, no404 bool, maxSize int64) error {
+	client := wshserver.GetMainRpcClient()
+	route := wshutil.MakeConnectionRouteId(conn)
+	fileInfo, err := wshclient.RemoteFileInfoCommand(client, path, &wshrpc.RpcOpts{Route: route})
+	if err != nil {
+		return err
+	}
+	if fileInfo.NotFound {
+		if no404 {
+			serveTransparentGIF(w)
+			return nil
+		}
+		return fmt.Errorf("file not found: %q", path)
+	}
+	if fileInfo.IsDir {
+		return fmt.Errorf("cannot stream directory: %q", path)
+	}
+	if maxSize > 0 && fileInfo.Size > maxSize {
+		http.Error(w, fmt.Sprintf("file too large (%d bytes, max %d)", fileInfo.Size, maxSize), http.StatusRequestEntityTooLarge)
+		return nil
+	}
+	etag := fmt.Sprintf(`"%x-%x"`, fileInfo.Size, fileInfo.ModTime)
+	w.Header().Set(ContentTypeHeaderKey, fileInfo.MimeType)
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("ETag", etag)
+	w.Header().Set(LastModifiedHeaderKey, time.UnixMilli(fileInfo.ModTime).UTC().Format(http.TimeFormat))
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	start, end, isRange, err := parseHttpRange(r.Header.Get("Range"), fileInfo.Size)
+	if ifRange := r.Header.Get("If-Range"); isRange && ifRange != "" && ifRange != etag {
+		// the file changed since the client's earlier response, send the whole file
+		isRange = false
+	}
+	if err != nil {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", fileInfo.Size))
+		http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+		return nil
+	}
+	if !isRange {
+		w.Header().Set(ContentLengthHeaderKey, fmt.Sprintf("%d", fileInfo.Size))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodHead || fileInfo.Size == 0 {
+			return nil
+		}
+		start, end = 0, fileInfo.Size-1
+	} else {
+		end = min(end, start+RemoteStreamMaxRangeSize-1)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, fileInfo.Size))
+		w.Header().Set(ContentLengthHeaderKey, fmt.Sprintf("%d", end-start+1))
+		w.WriteHeader(http.StatusPartialContent)
+		if r.Method == http.MethodHead {
+			return nil
+		}
+	}
+	err = writeRemoteRange(w, conn, fileInfo, start, end)
+	if err != nil {
+		// the headers have already been sent, so just log the error
+		log.Printf("error streaming file %q: %v\n", path, err)
+	}
+	return nil
+}
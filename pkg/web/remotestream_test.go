@@ -0,0 +1,38 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package web
+
+import "testing"
+
+func TestParseHttpRange(t *testing.T) {
+	tests := []struct {
+		header  string
+		start   int64
+		end     int64
+		isRange bool
+		isErr   bool
+	}{
+		{"", 0, 0, false, false},
+		{"bytes=0-", 0, 999, true, false},
+		{"bytes=100-199", 100, 199, true, false},
+		{"bytes=900-5000", 900, 999, true, false},
+		{"bytes=-100", 900, 999, true, false},
+		{"bytes=-5000", 0, 999, true, false},
+		{"bytes=0-10,20-30", 0, 0, false, false},
+		{"items=0-10", 0, 0, false, false},
+		{"bytes=1000-", 0, 0, false, true},
+		{"bytes=50-10", 0, 0, false, true},
+		{"bytes=abc-", 0, 0, false, true},
+	}
+	for _, test := range tests {
+		start, end, isRange, err := parseHttpRange(test.header, 1000)
+		if (err != nil) != test.isErr {
+			t.Errorf("%q: unexpected error result %v", test.header, err)
+			continue
+		}
+		if isRange != test.isRange || start != test.start || end != test.end {
+			t.Errorf("%q: got %d-%d (range=%v), expected %d-%d (range=%v)", test.header, start, end, isRange, test.start, test.end, test.isRange)
+		}
+	}
+}
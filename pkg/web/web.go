@@ -4,7 +4,6 @@
 package web
 
 import (
-	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -16,6 +15,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -27,10 +27,8 @@ import (
 	"github.com/wavetermdev/waveterm/pkg/panichandler"
 	"github.com/wavetermdev/waveterm/pkg/service"
 	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wavedebug"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
-	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
-	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshserver"
-	"github.com/wavetermdev/waveterm/pkg/wshutil"
 )
 
 type WebFnType = func(http.ResponseWriter, *http.Request)
@@ -216,7 +214,15 @@ func serveTransparentGIF(w http.ResponseWriter) {
 	w.Write(gifBytes)
 }
 
-func handleLocalStreamFile(w http.ResponseWriter, r *http.Request, path string, no404 bool) {
+func handleLocalStreamFile(w http.ResponseWriter, r *http.Request, path string, no404 bool, maxSize int64) {
+	if maxSize > 0 {
+		if expandedPath, err := wavebase.ExpandHomeDir(path); err == nil {
+			if finfo, err := os.Stat(expandedPath); err == nil && finfo.Size() > maxSize {
+				http.Error(w, fmt.Sprintf("file too large (%d bytes, max %d)", finfo.Size(), maxSize), http.StatusRequestEntityTooLarge)
+				return
+			}
+		}
+	}
 	if no404 {
 		log.Printf("streaming file w/no404: %q\n", path)
 		// use the custom response writer
@@ -243,65 +249,6 @@ func handleLocalStreamFile(w http.ResponseWriter, r *http.Request, path string,
 	}
 }
 
-func handleRemoteStreamFile(w http.ResponseWriter, _ *http.Request, conn string, path string, no404 bool) error {
-	client := wshserver.GetMainRpcClient()
-	streamFileData := wshrpc.CommandRemoteStreamFileData{Path: path}
-	route := wshutil.MakeConnectionRouteId(conn)
-	rtnCh := wshclient.RemoteStreamFileCommand(client, streamFileData, &wshrpc.RpcOpts{Route: route})
-	firstPk := true
-	var fileInfo *wshrpc.FileInfo
-	loopDone := false
-	defer func() {
-		if loopDone {
-			return
-		}
-		// if loop didn't finish naturally clear it out
-		go func() {
-			for range rtnCh {
-			}
-		}()
-	}()
-	for respUnion := range rtnCh {
-		if respUnion.Error != nil {
-			return respUnion.Error
-		}
-		if firstPk {
-			firstPk = false
-			if len(respUnion.Response.FileInfo) != 1 {
-				return fmt.Errorf("stream file protocol error, first pk fileinfo len=%d", len(respUnion.Response.FileInfo))
-			}
-			fileInfo = respUnion.Response.FileInfo[0]
-			if fileInfo.NotFound {
-				if no404 {
-					serveTransparentGIF(w)
-					return nil
-				} else {
-					return fmt.Errorf("file not found: %q", path)
-				}
-			}
-			if fileInfo.IsDir {
-				return fmt.Errorf("cannot stream directory: %q", path)
-			}
-			w.Header().Set(ContentTypeHeaderKey, fileInfo.MimeType)
-			w.Header().Set(ContentLengthHeaderKey, fmt.Sprintf("%d", fileInfo.Size))
-			continue
-		}
-		if respUnion.Response.Data64 == "" {
-			continue
-		}
-		decoder := base64.NewDecoder(base64.StdEncoding, bytes.NewReader([]byte(respUnion.Response.Data64)))
-		_, err := io.Copy(w, decoder)
-		if err != nil {
-			log.Printf("error streaming file %q: %v\n", path, err)
-			// not sure what to do here, the headers have already been sent.
-			// just return
-			return nil
-		}
-	}
-	loopDone = true
-	return nil
-}
-
 func handleStreamFile(w http.ResponseWriter, r *http.Request) {
 	conn := r.URL.Query().Get("connection")
 	if conn == "" {
@@ -313,10 +260,20 @@ func handleStreamFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	no404 := r.URL.Query().Get("no404")
+	// optional, larger files are refused (used for assets embedded in previews)
+	var maxSize int64
+	if maxSizeStr := r.URL.Query().Get("maxsize"); maxSizeStr != "" {
+		var err error
+		maxSize, err = strconv.ParseInt(maxSizeStr, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid maxsize %q", maxSizeStr), http.StatusBadRequest)
+			return
+		}
+	}
 	if conn == wshrpc.LocalConnName {
-		handleLocalStreamFile(w, r, path, no404 != "")
+		handleLocalStreamFile(w, r, path, no404 != "", maxSize)
 	} else {
-		err := handleRemoteStreamFile(w, r, conn, path, no404 != "")
+		err := handleRemoteStreamFile(w, r, conn, path, no404 != "", maxSize)
 		if err != nil {
 			log.Printf("error streaming remote file %q %q: %v\n", conn, path, err)
 			http.Error(w, fmt.Sprintf("error streaming file: %v", err), http.StatusInternalServerError)
@@ -418,13 +375,24 @@ func RunWebServer(listener net.Listener) {
 	gr.HandleFunc("/wave/service", WebFnWrap(WebFnOpts{JsonErrors: true}, handleService))
 	gr.HandleFunc("/vdom/{uuid}/{path:.*}", WebFnWrap(WebFnOpts{AllowCaching: true}, handleVDom))
 	gr.PathPrefix(docsitePrefix).Handler(http.StripPrefix(docsitePrefix, docsite.GetDocsiteHandler()))
-	handler := http.TimeoutHandler(gr, HttpTimeoutDuration, "Timeout")
+	wavedebug.SetServerAddr(listener.Addr().String())
+	timeoutHandler := http.TimeoutHandler(gr, HttpTimeoutDuration, "Timeout")
+	debugHandler := wavedebug.Handler()
+	// the debug endpoints (still token-gated) skip the timeout handler and the write timeout,
+	// since cpu profiles and traces run for as many seconds as they are asked for
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, wavedebug.PathPrefix) {
+			debugHandler.ServeHTTP(w, r)
+			return
+		}
+		http.NewResponseController(w).SetWriteDeadline(time.Now().Add(HttpWriteTimeout))
+		timeoutHandler.ServeHTTP(w, r)
+	})
 	if wavebase.IsDevMode() {
 		handler = handlers.CORS(handlers.AllowedOrigins([]string{"*"}))(handler)
 	}
 	server := &http.Server{
 		ReadTimeout:    HttpReadTimeout,
-		WriteTimeout:   HttpWriteTimeout,
 		MaxHeaderBytes: HttpMaxHeaderBytes,
 		Handler:        handler,
 	}
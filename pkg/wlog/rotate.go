@@ -0,0 +1,342 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wlog
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMaxSizeMB  = 10
+	DefaultMaxAgeDays = 7
+	DefaultMaxTotalMB = 100
+	RotateInterval    = 24 * time.Hour // the active file is rotated at least this often
+	rotatedTimeFormat = "20060102-150405"
+	compressedLogExt  = ".gz"
+	rotatedLogExtNoGz = ".log"
+)
+
+type RotateOpts struct {
+	MaxSizeBytes  int64         // rotate the active file once it reaches this size
+	MaxAge        time.Duration // rotated segments older than this are removed (0 keeps them)
+	MaxTotalBytes int64         // oldest segments are removed until the total is under this (0 means no cap)
+	Compress      bool          // gzip rotated segments
+}
+
+func DefaultRotateOpts() RotateOpts {
+	return RotateOpts{
+		MaxSizeBytes:  DefaultMaxSizeMB * 1024 * 1024,
+		MaxAge:        DefaultMaxAgeDays * 24 * time.Hour,
+		MaxTotalBytes: DefaultMaxTotalMB * 1024 * 1024,
+		Compress:      true,
+	}
+}
+
+// an io.Writer for a log file that rotates by size and age.  rotated segments
+// are named <base>-<timestamp>.log (or .log.gz when compressed) next to the
+// active file.
+type RotatingFile struct {
+	lock     sync.Mutex
+	path     string
+	file     *os.File
+	size     int64
+	openTime time.Time
+	opts     RotateOpts
+	bgWg     sync.WaitGroup
+}
+
+func OpenRotatingFile(path string, opts RotateOpts) (*RotatingFile, error) {
+	rf := &RotatingFile{path: path, opts: opts}
+	err := rf.open_nolock()
+	if err != nil {
+		return nil, err
+	}
+	rf.bgWg.Add(1)
+	go rf.cleanup(rf.getOpts())
+	return rf, nil
+}
+
+func (rf *RotatingFile) open_nolock() error {
+	err := os.MkdirAll(filepath.Dir(rf.path), 0755)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	finfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	rf.file = file
+	rf.size = finfo.Size()
+	rf.openTime = finfo.ModTime()
+	if rf.size == 0 {
+		rf.openTime = time.Now()
+	}
+	return nil
+}
+
+func (rf *RotatingFile) getOpts() RotateOpts {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+	return rf.opts
+}
+
+// SetOpts updates the rotation options and applies the new retention limits
+func (rf *RotatingFile) SetOpts(opts RotateOpts) {
+	rf.lock.Lock()
+	changed := rf.opts != opts
+	rf.opts = opts
+	rf.lock.Unlock()
+	if changed {
+		rf.bgWg.Add(1)
+		go rf.cleanup(opts)
+	}
+}
+
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+	if rf.file == nil {
+		return 0, fs.ErrClosed
+	}
+	needsRotate := rf.size > 0 && rf.opts.MaxSizeBytes > 0 && rf.size+int64(len(p)) > rf.opts.MaxSizeBytes
+	if rf.size > 0 && time.Since(rf.openTime) > RotateInterval {
+		needsRotate = true
+	}
+	if needsRotate {
+		err := rf.rotate_nolock()
+		if err != nil {
+			// keep writing to the current file rather than losing logs
+			fmt.Fprintf(os.Stderr, "error rotating log file %s: %v\n", rf.path, err)
+		}
+	}
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// Rotate forces a rotation of the active file (no-op if it is empty)
+func (rf *RotatingFile) Rotate() error {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+	if rf.file == nil || rf.size == 0 {
+		return nil
+	}
+	return rf.rotate_nolock()
+}
+
+func (rf *RotatingFile) rotate_nolock() error {
+	err := rf.file.Close()
+	if err != nil {
+		return err
+	}
+	rf.file = nil
+	rotatedPath := rf.makeRotatedPath(time.Now())
+	renameErr := os.Rename(rf.path, rotatedPath)
+	openErr := rf.open_nolock()
+	if openErr != nil {
+		return openErr
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+	rf.bgWg.Add(1)
+	go func(opts RotateOpts) {
+		if opts.Compress {
+			err := compressFile(rotatedPath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error compressing log file %s: %v\n", rotatedPath, err)
+			}
+		}
+		rf.cleanup(opts)
+	}(rf.opts)
+	return nil
+}
+
+func (rf *RotatingFile) makeRotatedPath(ts time.Time) string {
+	base := strings.TrimSuffix(rf.path, filepath.Ext(rf.path))
+	rotatedPath := fmt.Sprintf("%s-%s%s", base, ts.Format(rotatedTimeFormat), rotatedLogExtNoGz)
+	// more than one rotation per second (tiny max sizes), add a counter
+	for idx := 1; fileExists(rotatedPath) || fileExists(rotatedPath+compressedLogExt); idx++ {
+		rotatedPath = fmt.Sprintf("%s-%s.%d%s", base, ts.Format(rotatedTimeFormat), idx, rotatedLogExtNoGz)
+	}
+	return rotatedPath
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(path+compressedLogExt, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	gzWriter := gzip.NewWriter(dst)
+	_, err = io.Copy(gzWriter, src)
+	if err == nil {
+		err = gzWriter.Close()
+	}
+	closeErr := dst.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + compressedLogExt)
+		return err
+	}
+	src.Close()
+	return os.Remove(path)
+}
+
+type logSegment struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// rotated segments, newest first
+func (rf *RotatingFile) listSegments() []logSegment {
+	base := filepath.Base(strings.TrimSuffix(rf.path, filepath.Ext(rf.path)))
+	entries, err := os.ReadDir(filepath.Dir(rf.path))
+	if err != nil {
+		return nil
+	}
+	var rtn []logSegment
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, base+"-") {
+			continue
+		}
+		if !strings.HasSuffix(name, rotatedLogExtNoGz) && !strings.HasSuffix(name, rotatedLogExtNoGz+compressedLogExt) {
+			continue
+		}
+		finfo, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		rtn = append(rtn, logSegment{Path: filepath.Join(filepath.Dir(rf.path), name), Size: finfo.Size(), ModTime: finfo.ModTime()})
+	}
+	sort.Slice(rtn, func(i, j int) bool {
+		return rtn[i].ModTime.After(rtn[j].ModTime)
+	})
+	return rtn
+}
+
+// removes segments past MaxAge, then the oldest segments until the total size
+// (including the active file) fits in MaxTotalBytes
+func (rf *RotatingFile) cleanup(opts RotateOpts) {
+	defer rf.bgWg.Done()
+	rf.lock.Lock()
+	total := rf.size
+	rf.lock.Unlock()
+	for _, segment := range rf.listSegments() {
+		tooOld := opts.MaxAge > 0 && time.Since(segment.ModTime) > opts.MaxAge
+		tooBig := opts.MaxTotalBytes > 0 && total+segment.Size > opts.MaxTotalBytes
+		if tooOld || tooBig {
+			os.Remove(segment.Path)
+			continue
+		}
+		total += segment.Size
+	}
+}
+
+// Paths returns the active log file followed by the rotated segments (newest first)
+func (rf *RotatingFile) Paths() []string {
+	rtn := []string{rf.path}
+	for _, segment := range rf.listSegments() {
+		rtn = append(rtn, segment.Path)
+	}
+	return rtn
+}
+
+func (rf *RotatingFile) Close() error {
+	rf.lock.Lock()
+	var err error
+	if rf.file != nil {
+		err = rf.file.Close()
+		rf.file = nil
+	}
+	rf.lock.Unlock()
+	rf.bgWg.Wait()
+	return err
+}
+
+// CollectLogs writes a zip file to destPath containing the rotating log files
+// (if file output is enabled) plus any extra files (missing extra files are skipped)
+func CollectLogs(destPath string, extraFiles []string) error {
+	var paths []string
+	if rf := GetLogFile(); rf != nil {
+		paths = append(paths, rf.Paths()...)
+	}
+	paths = append(paths, extraFiles...)
+	err := os.MkdirAll(filepath.Dir(destPath), 0755)
+	if err != nil {
+		return err
+	}
+	outFile, err := os.OpenFile(destPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+	zipWriter := zip.NewWriter(outFile)
+	for _, path := range paths {
+		err = addFileToZip(zipWriter, path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("adding %s: %w", path, err)
+		}
+	}
+	err = zipWriter.Close()
+	if err != nil {
+		return err
+	}
+	return outFile.Close()
+}
+
+func addFileToZip(zipWriter *zip.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	finfo, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(finfo)
+	if err != nil {
+		return err
+	}
+	header.Method = zip.Deflate
+	if strings.HasSuffix(path, compressedLogExt) {
+		header.Method = zip.Store
+	}
+	writer, err := zipWriter.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, file)
+	return err
+}
@@ -0,0 +1,276 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// structured, leveled logging for the backend (built on log/slog).
+// each package gets its own logger (wlog.Logger("conncontroller")) whose level
+// can be changed at runtime.  output from the standard "log" package is routed
+// through the same handler (at info level) once Init has been called.
+package wlog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	Format_Text = "text"
+	Format_Json = "json"
+)
+
+// consistent attribute keys, so logs can be filtered across packages
+const (
+	Key_Pkg     = "pkg"
+	Key_Conn    = "conn"
+	Key_BlockId = "blockid"
+	Key_TabId   = "tabid"
+	Key_Route   = "route"
+)
+
+const StdLogPkg = "std"
+
+var globalLock = &sync.Mutex{}
+var defaultLevel = &slog.LevelVar{}
+var pkgLevels = make(map[string]*slog.LevelVar)
+var pkgOverrides = make(map[string]bool) // levels set at runtime win over the config
+var curHandler atomic.Pointer[slog.Handler]
+var curOutput io.Writer = os.Stderr
+var curFormat = Format_Text
+var logFile *RotatingFile
+
+func init() {
+	setHandler(makeHandler(curOutput, curFormat))
+}
+
+func makeHandler(w io.Writer, format string) slog.Handler {
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug} // level filtering happens in pkgHandler
+	if format == Format_Json {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+func setHandler(h slog.Handler) {
+	curHandler.Store(&h)
+}
+
+func getPkgLevel_nolock(pkg string) *slog.LevelVar {
+	levelVar := pkgLevels[pkg]
+	if levelVar == nil {
+		levelVar = &slog.LevelVar{}
+		levelVar.Set(defaultLevel.Level())
+		pkgLevels[pkg] = levelVar
+	}
+	return levelVar
+}
+
+// Init sets the output for all loggers and routes the standard "log" package through wlog
+func Init(w io.Writer, format string) {
+	globalLock.Lock()
+	curOutput = w
+	curFormat = normalizeFormat(format)
+	setHandler(makeHandler(curOutput, curFormat))
+	globalLock.Unlock()
+	stdLogger := Logger(StdLogPkg)
+	slog.SetDefault(stdLogger)
+	// slog.SetDefault redirects log.Print* (the handler adds its own timestamp)
+	log.SetFlags(0)
+	log.SetPrefix("")
+}
+
+// EnableFileOutput additionally writes logs to a rotating file at path
+func EnableFileOutput(path string, opts RotateOpts) (*RotatingFile, error) {
+	rf, err := OpenRotatingFile(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	globalLock.Lock()
+	defer globalLock.Unlock()
+	if logFile != nil {
+		logFile.Close()
+	}
+	logFile = rf
+	// the file goes first, MultiWriter stops at the first failing writer (e.g. a closed stderr)
+	curOutput = io.MultiWriter(rf, curOutput)
+	setHandler(makeHandler(curOutput, curFormat))
+	return rf, nil
+}
+
+// returns the rotating log file (nil if file output is not enabled)
+func GetLogFile() *RotatingFile {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+	return logFile
+}
+
+func normalizeFormat(format string) string {
+	if strings.ToLower(format) == Format_Json {
+		return Format_Json
+	}
+	return Format_Text
+}
+
+// SetFormat switches between "text" and "json" output
+func SetFormat(format string) {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+	format = normalizeFormat(format)
+	if format == curFormat {
+		return
+	}
+	curFormat = format
+	setHandler(makeHandler(curOutput, curFormat))
+}
+
+func ParseLevel(levelStr string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(strings.TrimSpace(levelStr)))
+	if err != nil {
+		return slog.LevelInfo, fmt.Errorf("invalid log level %q (use debug, info, warn, or error)", levelStr)
+	}
+	return level, nil
+}
+
+// SetLevel sets the level for a single package ("" sets the default level for all packages
+// without their own level).  levels set here are not overwritten by config updates.
+func SetLevel(pkg string, level slog.Level) {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+	if pkg == "" {
+		setDefaultLevel_nolock(level)
+		return
+	}
+	getPkgLevel_nolock(pkg).Set(level)
+	pkgOverrides[pkg] = true
+}
+
+// ClearLevel removes a runtime override, the package goes back to the configured level
+func ClearLevel(pkg string) {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+	delete(pkgOverrides, pkg)
+	getPkgLevel_nolock(pkg).Set(defaultLevel.Level())
+}
+
+func setDefaultLevel_nolock(level slog.Level) {
+	defaultLevel.Set(level)
+	for pkg, levelVar := range pkgLevels {
+		if !pkgOverrides[pkg] {
+			levelVar.Set(level)
+		}
+	}
+}
+
+// ConfigureLevels applies the configured default level and per-package levels.
+// packageLevels has the form "conncontroller=debug,wshutil=warn".
+func ConfigureLevels(defaultLevelStr string, packageLevels string) error {
+	level := slog.LevelInfo
+	var rtnErr error
+	if defaultLevelStr != "" {
+		parsedLevel, err := ParseLevel(defaultLevelStr)
+		if err != nil {
+			rtnErr = err
+		} else {
+			level = parsedLevel
+		}
+	}
+	configured := make(map[string]slog.Level)
+	for _, part := range strings.Split(packageLevels, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		pkg, levelStr, found := strings.Cut(part, "=")
+		if !found {
+			rtnErr = fmt.Errorf("invalid package log level %q (expected pkg=level)", part)
+			continue
+		}
+		pkgLevel, err := ParseLevel(levelStr)
+		if err != nil {
+			rtnErr = err
+			continue
+		}
+		configured[strings.TrimSpace(pkg)] = pkgLevel
+	}
+	globalLock.Lock()
+	defer globalLock.Unlock()
+	setDefaultLevel_nolock(level)
+	for pkg, pkgLevel := range configured {
+		if !pkgOverrides[pkg] {
+			getPkgLevel_nolock(pkg).Set(pkgLevel)
+		}
+	}
+	return rtnErr
+}
+
+// GetLevels returns the current level of every package that has logged (or been configured)
+func GetLevels() map[string]string {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+	rtn := make(map[string]string)
+	rtn[""] = defaultLevel.Level().String()
+	for pkg, levelVar := range pkgLevels {
+		rtn[pkg] = levelVar.Level().String()
+	}
+	return rtn
+}
+
+// Logger returns the logger for pkg.  it is cheap, but packages normally keep one in a package var.
+func Logger(pkg string) *slog.Logger {
+	globalLock.Lock()
+	levelVar := getPkgLevel_nolock(pkg)
+	globalLock.Unlock()
+	return slog.New(&pkgHandler{level: levelVar}).With(Key_Pkg, pkg)
+}
+
+func ConnAttr(connName string) slog.Attr {
+	return slog.String(Key_Conn, connName)
+}
+
+func BlockAttr(blockId string) slog.Attr {
+	return slog.String(Key_BlockId, blockId)
+}
+
+func RouteAttr(routeId string) slog.Attr {
+	return slog.String(Key_Route, routeId)
+}
+
+// filters by the package level, then delegates to the current global handler
+// (which can be swapped when the format changes)
+type pkgHandler struct {
+	level *slog.LevelVar
+	ops   []func(slog.Handler) slog.Handler // WithAttrs/WithGroup calls, replayed on the current handler
+}
+
+func (h *pkgHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *pkgHandler) Handle(ctx context.Context, record slog.Record) error {
+	inner := *curHandler.Load()
+	for _, op := range h.ops {
+		inner = op(inner)
+	}
+	return inner.Handle(ctx, record)
+}
+
+func (h *pkgHandler) withOp(op func(slog.Handler) slog.Handler) *pkgHandler {
+	ops := make([]func(slog.Handler) slog.Handler, 0, len(h.ops)+1)
+	ops = append(ops, h.ops...)
+	ops = append(ops, op)
+	return &pkgHandler{level: h.level, ops: ops}
+}
+
+func (h *pkgHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.withOp(func(inner slog.Handler) slog.Handler { return inner.WithAttrs(attrs) })
+}
+
+func (h *pkgHandler) WithGroup(name string) slog.Handler {
+	return h.withOp(func(inner slog.Handler) slog.Handler { return inner.WithGroup(name) })
+}
@@ -0,0 +1,90 @@
+package wlog
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPackageLevels(t *testing.T) {
+	var buf bytes.Buffer
+	setHandler(makeHandler(&buf, Format_Text))
+	defer setHandler(makeHandler(curOutput, curFormat))
+
+	err := ConfigureLevels("warn", "testpkg=debug")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ConfigureLevels("", "")
+	testLog := Logger("testpkg")
+	otherLog := Logger("otherpkg")
+	testLog.Debug("debug-visible", ConnAttr("user@host"))
+	otherLog.Info("info-hidden")
+	otherLog.Warn("warn-visible")
+	out := buf.String()
+	if !strings.Contains(out, "debug-visible") || !strings.Contains(out, "conn=user@host") || !strings.Contains(out, "pkg=testpkg") {
+		t.Errorf("expected testpkg debug line with attrs, got %q", out)
+	}
+	if strings.Contains(out, "info-hidden") {
+		t.Errorf("otherpkg info should be filtered at warn level, got %q", out)
+	}
+	if !strings.Contains(out, "warn-visible") {
+		t.Errorf("expected otherpkg warn line, got %q", out)
+	}
+
+	SetLevel("otherpkg", slog.LevelDebug)
+	ConfigureLevels("error", "")
+	if !otherLog.Enabled(context.Background(), slog.LevelDebug) {
+		t.Errorf("runtime override should survive config updates")
+	}
+	ClearLevel("otherpkg")
+	if otherLog.Enabled(context.Background(), slog.LevelWarn) {
+		t.Errorf("cleared override should go back to the configured level")
+	}
+}
+
+func TestConfigureLevelsErrors(t *testing.T) {
+	defer ConfigureLevels("", "")
+	if err := ConfigureLevels("verbose", ""); err == nil {
+		t.Errorf("expected error for invalid level")
+	}
+	if err := ConfigureLevels("", "nolevel"); err == nil {
+		t.Errorf("expected error for missing =level")
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	rf, err := OpenRotatingFile(filepath.Join(dir, "test.log"), RotateOpts{MaxSizeBytes: 100, MaxTotalBytes: 350, Compress: false})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	line := []byte(strings.Repeat("x", 59) + "\n")
+	for i := 0; i < 20; i++ {
+		if _, err := rf.Write(line); err != nil {
+			t.Fatalf("write error: %v", err)
+		}
+	}
+	rf.Close()
+	var total int64
+	for _, path := range rf.Paths() {
+		finfo, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("missing log segment %s: %v", path, err)
+		}
+		if finfo.Size() > 100 {
+			t.Errorf("segment %s is larger than the max size: %d", path, finfo.Size())
+		}
+		total += finfo.Size()
+	}
+	if total > 350 {
+		t.Errorf("total log size %d is over the cap", total)
+	}
+	if len(rf.Paths()) < 2 {
+		t.Errorf("expected rotated segments, got %v", rf.Paths())
+	}
+}
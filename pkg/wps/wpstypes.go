@@ -11,8 +11,17 @@ const (
 	Event_BlockFile        = "blockfile"
 	Event_Config           = "config"
 	Event_UserInput        = "userinput"
+	Event_UserInputDismiss = "userinput:dismiss" // a shown prompt was withdrawn (data is the UserInputRequest)
+	Event_UserNotification = "usernotification"
 	Event_RouteGone        = "route:gone"
 	Event_WorkspaceUpdate  = "workspace:update"
+	Event_FileChange       = "filechange"
+	Event_CmdDone          = "cmd:done"
+	Event_WorkspaceOpen    = "workspace:open"
+	Event_UpdaterStatus    = "updater:status"
+	Event_ConnForwards     = "conn:forwards"
+	Event_ConnFileCopy     = "conn:filecopy"
+	Event_ConnLifecycle    = "conn:lifecycle"
 )
 
 type WaveEvent struct {
@@ -47,3 +56,21 @@ type WSFileEventData struct {
 	FileOp   string `json:"fileop"`
 	Data64   string `json:"data64"`
 }
+
+// a command finished in a terminal block (from shell integration), scoped to the block oref
+type CmdDoneEventData struct {
+	BlockId     string `json:"blockid"`
+	Connection  string `json:"connection,omitempty"`
+	Command     string `json:"command"`
+	ExitCode    int    `json:"exitcode"`
+	HasExitCode bool   `json:"hasexitcode,omitempty"`
+	Cwd         string `json:"cwd,omitempty"`
+	Ts          int64  `json:"ts"`
+}
+
+// a workspace was opened in a window, scoped to the workspace oref
+type WorkspaceOpenEventData struct {
+	WindowId      string `json:"windowid"`
+	WorkspaceId   string `json:"workspaceid"`
+	WorkspaceName string `json:"workspacename,omitempty"`
+}
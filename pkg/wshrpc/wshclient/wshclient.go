@@ -19,12 +19,90 @@ func ActivityCommand(w *wshutil.WshRpc, data wshrpc.ActivityUpdate, opts *wshrpc
 	return err
 }
 
+// command "aiacceptcmd", wshserver.AiAcceptCmdCommand
+func AiAcceptCmdCommand(w *wshutil.WshRpc, data wshrpc.CommandAiAcceptCmdData, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "aiacceptcmd", data, opts)
+	return err
+}
+
+// command "aichatexport", wshserver.AiChatExportCommand
+func AiChatExportCommand(w *wshutil.WshRpc, data wshrpc.CommandAiChatData, opts *wshrpc.RpcOpts) (string, error) {
+	resp, err := sendRpcRequestCallHelper[string](w, "aichatexport", data, opts)
+	return resp, err
+}
+
+// command "aichatlist", wshserver.AiChatListCommand
+func AiChatListCommand(w *wshutil.WshRpc, data wshrpc.CommandAiChatListData, opts *wshrpc.RpcOpts) ([]wshrpc.AiChatInfo, error) {
+	resp, err := sendRpcRequestCallHelper[[]wshrpc.AiChatInfo](w, "aichatlist", data, opts)
+	return resp, err
+}
+
+// command "aichatrename", wshserver.AiChatRenameCommand
+func AiChatRenameCommand(w *wshutil.WshRpc, data wshrpc.CommandAiChatData, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "aichatrename", data, opts)
+	return err
+}
+
+// command "aichatresume", wshserver.AiChatResumeCommand
+func AiChatResumeCommand(w *wshutil.WshRpc, data wshrpc.CommandAiChatData, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "aichatresume", data, opts)
+	return err
+}
+
+// command "ailistmodels", wshserver.AiListModelsCommand
+func AiListModelsCommand(w *wshutil.WshRpc, data wshrpc.CommandAiListModelsData, opts *wshrpc.RpcOpts) ([]string, error) {
+	resp, err := sendRpcRequestCallHelper[[]string](w, "ailistmodels", data, opts)
+	return resp, err
+}
+
+// command "ailistpresets", wshserver.AiListPresetsCommand
+func AiListPresetsCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) ([]wshrpc.AiPresetInfo, error) {
+	resp, err := sendRpcRequestCallHelper[[]wshrpc.AiPresetInfo](w, "ailistpresets", nil, opts)
+	return resp, err
+}
+
+// command "aireloadchat", wshserver.AiReloadChatCommand
+func AiReloadChatCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "aireloadchat", nil, opts)
+	return err
+}
+
 // command "aisendmessage", wshserver.AiSendMessageCommand
 func AiSendMessageCommand(w *wshutil.WshRpc, data wshrpc.AiMessageData, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "aisendmessage", data, opts)
 	return err
 }
 
+// command "aisetpreset", wshserver.AiSetPresetCommand
+func AiSetPresetCommand(w *wshutil.WshRpc, data wshrpc.CommandAiSetPresetData, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "aisetpreset", data, opts)
+	return err
+}
+
+// command "aisuggestcmd", wshserver.AiSuggestCmdCommand
+func AiSuggestCmdCommand(w *wshutil.WshRpc, data wshrpc.CommandAiSuggestCmdData, opts *wshrpc.RpcOpts) (*wshrpc.AiCmdSuggestion, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.AiCmdSuggestion](w, "aisuggestcmd", data, opts)
+	return resp, err
+}
+
+// command "aitermcontext", wshserver.AiTermContextCommand
+func AiTermContextCommand(w *wshutil.WshRpc, data wshrpc.CommandAiTermContextData, opts *wshrpc.RpcOpts) (string, error) {
+	resp, err := sendRpcRequestCallHelper[string](w, "aitermcontext", data, opts)
+	return resp, err
+}
+
+// command "aiusage", wshserver.AiUsageCommand
+func AiUsageCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (*wshrpc.AiUsageSummary, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.AiUsageSummary](w, "aiusage", nil, opts)
+	return resp, err
+}
+
+// command "auditevents", wshserver.AuditEventsCommand
+func AuditEventsCommand(w *wshutil.WshRpc, data wshrpc.CommandAuditEventsData, opts *wshrpc.RpcOpts) ([]wshrpc.AuditEvent, error) {
+	resp, err := sendRpcRequestCallHelper[[]wshrpc.AuditEvent](w, "auditevents", data, opts)
+	return resp, err
+}
+
 // command "authenticate", wshserver.AuthenticateCommand
 func AuthenticateCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) (wshrpc.CommandAuthenticateRtnData, error) {
 	resp, err := sendRpcRequestCallHelper[wshrpc.CommandAuthenticateRtnData](w, "authenticate", data, opts)
@@ -37,12 +115,58 @@ func BlockInfoCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) (*ws
 	return resp, err
 }
 
+// command "clearrememberedanswers", wshserver.ClearRememberedAnswersCommand
+func ClearRememberedAnswersCommand(w *wshutil.WshRpc, data wshrpc.CommandClearRememberedAnswersData, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "clearrememberedanswers", data, opts)
+	return err
+}
+
+// command "clipboardread", wshserver.ClipboardReadCommand
+func ClipboardReadCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (string, error) {
+	resp, err := sendRpcRequestCallHelper[string](w, "clipboardread", nil, opts)
+	return resp, err
+}
+
+// command "clipboardwrite", wshserver.ClipboardWriteCommand
+func ClipboardWriteCommand(w *wshutil.WshRpc, data wshrpc.CommandClipboardData, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "clipboardwrite", data, opts)
+	return err
+}
+
+// command "collectlogs", wshserver.CollectLogsCommand
+func CollectLogsCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (string, error) {
+	resp, err := sendRpcRequestCallHelper[string](w, "collectlogs", nil, opts)
+	return resp, err
+}
+
+// command "connaddforward", wshserver.ConnAddForwardCommand
+func ConnAddForwardCommand(w *wshutil.WshRpc, data wshrpc.CommandConnForwardData, opts *wshrpc.RpcOpts) (*wshrpc.PortForwardInfo, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.PortForwardInfo](w, "connaddforward", data, opts)
+	return resp, err
+}
+
+// command "connbroadcast", wshserver.ConnBroadcastCommand
+func ConnBroadcastCommand(w *wshutil.WshRpc, data wshrpc.CommandConnBroadcastData, opts *wshrpc.RpcOpts) chan wshrpc.RespOrErrorUnion[wshrpc.ConnBroadcastEvent] {
+	return sendRpcRequestResponseStreamHelper[wshrpc.ConnBroadcastEvent](w, "connbroadcast", data, opts)
+}
+
 // command "connconnect", wshserver.ConnConnectCommand
 func ConnConnectCommand(w *wshutil.WshRpc, data wshrpc.ConnRequest, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "connconnect", data, opts)
 	return err
 }
 
+// command "conncopyfile", wshserver.ConnCopyFileCommand
+func ConnCopyFileCommand(w *wshutil.WshRpc, data wshrpc.CommandConnCopyFileData, opts *wshrpc.RpcOpts) chan wshrpc.RespOrErrorUnion[wshrpc.ConnCopyFileProgress] {
+	return sendRpcRequestResponseStreamHelper[wshrpc.ConnCopyFileProgress](w, "conncopyfile", data, opts)
+}
+
+// command "conndebuglog", wshserver.ConnDebugLogCommand
+func ConnDebugLogCommand(w *wshutil.WshRpc, data wshrpc.CommandConnDebugLogData, opts *wshrpc.RpcOpts) (string, error) {
+	resp, err := sendRpcRequestCallHelper[string](w, "conndebuglog", data, opts)
+	return resp, err
+}
+
 // command "conndisconnect", wshserver.ConnDisconnectCommand
 func ConnDisconnectCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "conndisconnect", data, opts)
@@ -55,24 +179,94 @@ func ConnEnsureCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) err
 	return err
 }
 
+// command "connexec", wshserver.ConnExecCommand
+func ConnExecCommand(w *wshutil.WshRpc, data wshrpc.CommandConnExecData, opts *wshrpc.RpcOpts) chan wshrpc.RespOrErrorUnion[wshrpc.ConnExecEvent] {
+	return sendRpcRequestResponseStreamHelper[wshrpc.ConnExecEvent](w, "connexec", data, opts)
+}
+
+// command "connimport", wshserver.ConnImportCommand
+func ConnImportCommand(w *wshutil.WshRpc, data wshrpc.CommandConnImportData, opts *wshrpc.RpcOpts) (*wshrpc.ConnImportResult, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.ConnImportResult](w, "connimport", data, opts)
+	return resp, err
+}
+
 // command "connlist", wshserver.ConnListCommand
 func ConnListCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) ([]string, error) {
 	resp, err := sendRpcRequestCallHelper[[]string](w, "connlist", nil, opts)
 	return resp, err
 }
 
+// command "connlistforwards", wshserver.ConnListForwardsCommand
+func ConnListForwardsCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) ([]wshrpc.PortForwardInfo, error) {
+	resp, err := sendRpcRequestCallHelper[[]wshrpc.PortForwardInfo](w, "connlistforwards", data, opts)
+	return resp, err
+}
+
+// command "connlistinfo", wshserver.ConnListInfoCommand
+func ConnListInfoCommand(w *wshutil.WshRpc, data wshrpc.ConnListFilter, opts *wshrpc.RpcOpts) ([]wshrpc.ConnListEntry, error) {
+	resp, err := sendRpcRequestCallHelper[[]wshrpc.ConnListEntry](w, "connlistinfo", data, opts)
+	return resp, err
+}
+
+// command "connlistmounts", wshserver.ConnListMountsCommand
+func ConnListMountsCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) ([]wshrpc.MountInfo, error) {
+	resp, err := sendRpcRequestCallHelper[[]wshrpc.MountInfo](w, "connlistmounts", nil, opts)
+	return resp, err
+}
+
+// command "connmount", wshserver.ConnMountCommand
+func ConnMountCommand(w *wshutil.WshRpc, data wshrpc.CommandConnMountData, opts *wshrpc.RpcOpts) (*wshrpc.MountInfo, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.MountInfo](w, "connmount", data, opts)
+	return resp, err
+}
+
 // command "connreinstallwsh", wshserver.ConnReinstallWshCommand
 func ConnReinstallWshCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "connreinstallwsh", data, opts)
 	return err
 }
 
+// command "connremoveforward", wshserver.ConnRemoveForwardCommand
+func ConnRemoveForwardCommand(w *wshutil.WshRpc, data wshrpc.CommandConnForwardData, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "connremoveforward", data, opts)
+	return err
+}
+
+// command "connsocksproxy", wshserver.ConnSocksProxyCommand
+func ConnSocksProxyCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) (string, error) {
+	resp, err := sendRpcRequestCallHelper[string](w, "connsocksproxy", data, opts)
+	return resp, err
+}
+
+// command "connstats", wshserver.ConnStatsCommand
+func ConnStatsCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) (*wshrpc.ConnStatsInfo, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.ConnStatsInfo](w, "connstats", data, opts)
+	return resp, err
+}
+
 // command "connstatus", wshserver.ConnStatusCommand
 func ConnStatusCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) ([]wshrpc.ConnStatus, error) {
 	resp, err := sendRpcRequestCallHelper[[]wshrpc.ConnStatus](w, "connstatus", nil, opts)
 	return resp, err
 }
 
+// command "connsync", wshserver.ConnSyncCommand
+func ConnSyncCommand(w *wshutil.WshRpc, data wshrpc.CommandConnSyncData, opts *wshrpc.RpcOpts) chan wshrpc.RespOrErrorUnion[wshrpc.ConnSyncProgress] {
+	return sendRpcRequestResponseStreamHelper[wshrpc.ConnSyncProgress](w, "connsync", data, opts)
+}
+
+// command "connunmount", wshserver.ConnUnmountCommand
+func ConnUnmountCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "connunmount", data, opts)
+	return err
+}
+
+// command "containerlist", wshserver.ContainerListCommand
+func ContainerListCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) ([]wshrpc.ContainerInfo, error) {
+	resp, err := sendRpcRequestCallHelper[[]wshrpc.ContainerInfo](w, "containerlist", nil, opts)
+	return resp, err
+}
+
 // command "controllerinput", wshserver.ControllerInputCommand
 func ControllerInputCommand(w *wshutil.WshRpc, data wshrpc.CommandBlockInputData, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "controllerinput", data, opts)
@@ -103,6 +297,12 @@ func CreateSubBlockCommand(w *wshutil.WshRpc, data wshrpc.CommandCreateSubBlockD
 	return resp, err
 }
 
+// command "debugpprofinfo", wshserver.DebugPprofInfoCommand
+func DebugPprofInfoCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (*wshrpc.DebugPprofInfo, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.DebugPprofInfo](w, "debugpprofinfo", nil, opts)
+	return resp, err
+}
+
 // command "deleteblock", wshserver.DeleteBlockCommand
 func DeleteBlockCommand(w *wshutil.WshRpc, data wshrpc.CommandDeleteBlockData, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "deleteblock", data, opts)
@@ -115,6 +315,12 @@ func DeleteSubBlockCommand(w *wshutil.WshRpc, data wshrpc.CommandDeleteBlockData
 	return err
 }
 
+// command "discoverhosts", wshserver.DiscoverHostsCommand
+func DiscoverHostsCommand(w *wshutil.WshRpc, data wshrpc.CommandDiscoverHostsData, opts *wshrpc.RpcOpts) ([]wshrpc.DiscoveredHost, error) {
+	resp, err := sendRpcRequestCallHelper[[]wshrpc.DiscoveredHost](w, "discoverhosts", data, opts)
+	return resp, err
+}
+
 // command "dismisswshfail", wshserver.DismissWshFailCommand
 func DismissWshFailCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "dismisswshfail", data, opts)
@@ -217,6 +423,24 @@ func FocusWindowCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) er
 	return err
 }
 
+// command "getbusyblocks", wshserver.GetBusyBlocksCommand
+func GetBusyBlocksCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) ([]string, error) {
+	resp, err := sendRpcRequestCallHelper[[]string](w, "getbusyblocks", nil, opts)
+	return resp, err
+}
+
+// command "getdiagbundleitem", wshserver.GetDiagBundleItemCommand
+func GetDiagBundleItemCommand(w *wshutil.WshRpc, data wshrpc.CommandDiagBundleItemData, opts *wshrpc.RpcOpts) (string, error) {
+	resp, err := sendRpcRequestCallHelper[string](w, "getdiagbundleitem", data, opts)
+	return resp, err
+}
+
+// command "getloglevels", wshserver.GetLogLevelsCommand
+func GetLogLevelsCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (map[string]string, error) {
+	resp, err := sendRpcRequestCallHelper[map[string]string](w, "getloglevels", nil, opts)
+	return resp, err
+}
+
 // command "getmeta", wshserver.GetMetaCommand
 func GetMetaCommand(w *wshutil.WshRpc, data wshrpc.CommandGetMetaData, opts *wshrpc.RpcOpts) (waveobj.MetaMapType, error) {
 	resp, err := sendRpcRequestCallHelper[waveobj.MetaMapType](w, "getmeta", data, opts)
@@ -235,6 +459,54 @@ func GetVarCommand(w *wshutil.WshRpc, data wshrpc.CommandVarData, opts *wshrpc.R
 	return resp, err
 }
 
+// command "getwavestats", wshserver.GetWaveStatsCommand
+func GetWaveStatsCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (*wshrpc.TimeSeriesData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.TimeSeriesData](w, "getwavestats", nil, opts)
+	return resp, err
+}
+
+// command "keychaindelete", wshserver.KeychainDeleteCommand
+func KeychainDeleteCommand(w *wshutil.WshRpc, data wshrpc.CommandKeychainDeleteData, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "keychaindelete", data, opts)
+	return err
+}
+
+// command "keychainlist", wshserver.KeychainListCommand
+func KeychainListCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) ([]wshrpc.StoredSecret, error) {
+	resp, err := sendRpcRequestCallHelper[[]wshrpc.StoredSecret](w, "keychainlist", nil, opts)
+	return resp, err
+}
+
+// command "keychainsettotp", wshserver.KeychainSetTotpCommand
+func KeychainSetTotpCommand(w *wshutil.WshRpc, data wshrpc.CommandKeychainSetTotpData, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "keychainsettotp", data, opts)
+	return err
+}
+
+// command "knownhostsdelete", wshserver.KnownHostsDeleteCommand
+func KnownHostsDeleteCommand(w *wshutil.WshRpc, data wshrpc.CommandKnownHostsData, opts *wshrpc.RpcOpts) (int, error) {
+	resp, err := sendRpcRequestCallHelper[int](w, "knownhostsdelete", data, opts)
+	return resp, err
+}
+
+// command "knownhostslist", wshserver.KnownHostsListCommand
+func KnownHostsListCommand(w *wshutil.WshRpc, data wshrpc.CommandKnownHostsData, opts *wshrpc.RpcOpts) ([]wshrpc.KnownHostEntry, error) {
+	resp, err := sendRpcRequestCallHelper[[]wshrpc.KnownHostEntry](w, "knownhostslist", data, opts)
+	return resp, err
+}
+
+// command "knownhostsverify", wshserver.KnownHostsVerifyCommand
+func KnownHostsVerifyCommand(w *wshutil.WshRpc, data wshrpc.CommandKnownHostsData, opts *wshrpc.RpcOpts) (*wshrpc.KnownHostsVerifyResult, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.KnownHostsVerifyResult](w, "knownhostsverify", data, opts)
+	return resp, err
+}
+
+// command "listrememberedanswers", wshserver.ListRememberedAnswersCommand
+func ListRememberedAnswersCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) ([]wshrpc.RememberedAnswer, error) {
+	resp, err := sendRpcRequestCallHelper[[]wshrpc.RememberedAnswer](w, "listrememberedanswers", data, opts)
+	return resp, err
+}
+
 // command "message", wshserver.MessageCommand
 func MessageCommand(w *wshutil.WshRpc, data wshrpc.CommandMessageData, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "message", data, opts)
@@ -247,12 +519,65 @@ func NotifyCommand(w *wshutil.WshRpc, data wshrpc.WaveNotificationOptions, opts
 	return err
 }
 
+// command "passphrasecacheflush", wshserver.PassphraseCacheFlushCommand
+func PassphraseCacheFlushCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (int, error) {
+	resp, err := sendRpcRequestCallHelper[int](w, "passphrasecacheflush", nil, opts)
+	return resp, err
+}
+
 // command "path", wshserver.PathCommand
 func PathCommand(w *wshutil.WshRpc, data wshrpc.PathCommandData, opts *wshrpc.RpcOpts) (string, error) {
 	resp, err := sendRpcRequestCallHelper[string](w, "path", data, opts)
 	return resp, err
 }
 
+// command "plugincontrol", wshserver.PluginControlCommand
+func PluginControlCommand(w *wshutil.WshRpc, data wshrpc.CommandPluginControlData, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "plugincontrol", data, opts)
+	return err
+}
+
+// command "pluginlist", wshserver.PluginListCommand
+func PluginListCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) ([]wshrpc.PluginInfo, error) {
+	resp, err := sendRpcRequestCallHelper[[]wshrpc.PluginInfo](w, "pluginlist", nil, opts)
+	return resp, err
+}
+
+// command "preparediagbundle", wshserver.PrepareDiagBundleCommand
+func PrepareDiagBundleCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (*wshrpc.DiagBundleInfo, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.DiagBundleInfo](w, "preparediagbundle", nil, opts)
+	return resp, err
+}
+
+// command "recordingexport", wshserver.RecordingExportCommand
+func RecordingExportCommand(w *wshutil.WshRpc, data wshrpc.CommandRecordingExportData, opts *wshrpc.RpcOpts) (string, error) {
+	resp, err := sendRpcRequestCallHelper[string](w, "recordingexport", data, opts)
+	return resp, err
+}
+
+// command "recordinglist", wshserver.RecordingListCommand
+func RecordingListCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) ([]wshrpc.RecordingInfo, error) {
+	resp, err := sendRpcRequestCallHelper[[]wshrpc.RecordingInfo](w, "recordinglist", data, opts)
+	return resp, err
+}
+
+// command "recordingstart", wshserver.RecordingStartCommand
+func RecordingStartCommand(w *wshutil.WshRpc, data wshrpc.CommandRecordingStartData, opts *wshrpc.RpcOpts) (*wshrpc.RecordingInfo, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.RecordingInfo](w, "recordingstart", data, opts)
+	return resp, err
+}
+
+// command "recordingstop", wshserver.RecordingStopCommand
+func RecordingStopCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) (*wshrpc.RecordingInfo, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.RecordingInfo](w, "recordingstop", data, opts)
+	return resp, err
+}
+
+// command "remotearchiveextract", wshserver.RemoteArchiveExtractCommand
+func RemoteArchiveExtractCommand(w *wshutil.WshRpc, data wshrpc.CommandRemoteArchiveExtractData, opts *wshrpc.RpcOpts) chan wshrpc.RespOrErrorUnion[wshrpc.ArchiveExtractProgress] {
+	return sendRpcRequestResponseStreamHelper[wshrpc.ArchiveExtractProgress](w, "remotearchiveextract", data, opts)
+}
+
 // command "remotefiledelete", wshserver.RemoteFileDeleteCommand
 func RemoteFileDeleteCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "remotefiledelete", data, opts)
@@ -283,12 +608,36 @@ func RemoteFileTouchCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts
 	return err
 }
 
+// command "remotegetinfo", wshserver.RemoteGetInfoCommand
+func RemoteGetInfoCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (wshrpc.RemoteInfo, error) {
+	resp, err := sendRpcRequestCallHelper[wshrpc.RemoteInfo](w, "remotegetinfo", nil, opts)
+	return resp, err
+}
+
+// command "remotelistentries", wshserver.RemoteListEntriesCommand
+func RemoteListEntriesCommand(w *wshutil.WshRpc, data wshrpc.CommandRemoteListEntriesData, opts *wshrpc.RpcOpts) (*wshrpc.RemoteListEntriesRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.RemoteListEntriesRtnData](w, "remotelistentries", data, opts)
+	return resp, err
+}
+
 // command "remotemkdir", wshserver.RemoteMkdirCommand
 func RemoteMkdirCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "remotemkdir", data, opts)
 	return err
 }
 
+// command "remotereadlines", wshserver.RemoteReadLinesCommand
+func RemoteReadLinesCommand(w *wshutil.WshRpc, data wshrpc.CommandRemoteReadLinesData, opts *wshrpc.RpcOpts) (*wshrpc.RemoteReadLinesRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.RemoteReadLinesRtnData](w, "remotereadlines", data, opts)
+	return resp, err
+}
+
+// command "remotesearchfile", wshserver.RemoteSearchFileCommand
+func RemoteSearchFileCommand(w *wshutil.WshRpc, data wshrpc.CommandRemoteSearchFileData, opts *wshrpc.RpcOpts) (*wshrpc.RemoteSearchFileRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.RemoteSearchFileRtnData](w, "remotesearchfile", data, opts)
+	return resp, err
+}
+
 // command "remotestreamcpudata", wshserver.RemoteStreamCpuDataCommand
 func RemoteStreamCpuDataCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) chan wshrpc.RespOrErrorUnion[wshrpc.TimeSeriesData] {
 	return sendRpcRequestResponseStreamHelper[wshrpc.TimeSeriesData](w, "remotestreamcpudata", nil, opts)
@@ -299,6 +648,12 @@ func RemoteStreamFileCommand(w *wshutil.WshRpc, data wshrpc.CommandRemoteStreamF
 	return sendRpcRequestResponseStreamHelper[wshrpc.CommandRemoteStreamFileRtnData](w, "remotestreamfile", data, opts)
 }
 
+// command "remotewatchfiles", wshserver.RemoteWatchFilesCommand
+func RemoteWatchFilesCommand(w *wshutil.WshRpc, data wshrpc.CommandRemoteWatchFilesData, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "remotewatchfiles", data, opts)
+	return err
+}
+
 // command "remotewritefile", wshserver.RemoteWriteFileCommand
 func RemoteWriteFileCommand(w *wshutil.WshRpc, data wshrpc.CommandRemoteWriteFileData, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "remotewritefile", data, opts)
@@ -335,6 +690,12 @@ func SetConnectionsConfigCommand(w *wshutil.WshRpc, data wshrpc.ConnConfigReques
 	return err
 }
 
+// command "setloglevel", wshserver.SetLogLevelCommand
+func SetLogLevelCommand(w *wshutil.WshRpc, data wshrpc.CommandSetLogLevelData, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "setloglevel", data, opts)
+	return err
+}
+
 // command "setmeta", wshserver.SetMetaCommand
 func SetMetaCommand(w *wshutil.WshRpc, data wshrpc.CommandSetMetaData, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "setmeta", data, opts)
@@ -368,12 +729,66 @@ func StreamWaveAiCommand(w *wshutil.WshRpc, data wshrpc.OpenAiStreamRequest, opt
 	return sendRpcRequestResponseStreamHelper[wshrpc.OpenAIPacketType](w, "streamwaveai", data, opts)
 }
 
+// command "sysclipboardread", wshserver.SysClipboardReadCommand
+func SysClipboardReadCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (string, error) {
+	resp, err := sendRpcRequestCallHelper[string](w, "sysclipboardread", nil, opts)
+	return resp, err
+}
+
+// command "sysclipboardwrite", wshserver.SysClipboardWriteCommand
+func SysClipboardWriteCommand(w *wshutil.WshRpc, data wshrpc.CommandClipboardData, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "sysclipboardwrite", data, opts)
+	return err
+}
+
+// command "tailscalepeers", wshserver.TailscalePeersCommand
+func TailscalePeersCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) ([]wshrpc.TailscalePeer, error) {
+	resp, err := sendRpcRequestCallHelper[[]wshrpc.TailscalePeer](w, "tailscalepeers", nil, opts)
+	return resp, err
+}
+
+// command "telemetrypreview", wshserver.TelemetryPreviewCommand
+func TelemetryPreviewCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (*wshrpc.TelemetryPreviewData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.TelemetryPreviewData](w, "telemetrypreview", nil, opts)
+	return resp, err
+}
+
 // command "test", wshserver.TestCommand
 func TestCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "test", data, opts)
 	return err
 }
 
+// command "updatercheck", wshserver.UpdaterCheckCommand
+func UpdaterCheckCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "updatercheck", nil, opts)
+	return err
+}
+
+// command "updaterinstall", wshserver.UpdaterInstallCommand
+func UpdaterInstallCommand(w *wshutil.WshRpc, data wshrpc.CommandUpdaterInstallData, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "updaterinstall", data, opts)
+	return err
+}
+
+// command "updaterstatus", wshserver.UpdaterStatusCommand
+func UpdaterStatusCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (*wshrpc.UpdaterStatusData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.UpdaterStatusData](w, "updaterstatus", nil, opts)
+	return resp, err
+}
+
+// command "usagestats", wshserver.UsageStatsCommand
+func UsageStatsCommand(w *wshutil.WshRpc, data wshrpc.CommandUsageStatsData, opts *wshrpc.RpcOpts) (*wshrpc.UsageStatsSummary, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.UsageStatsSummary](w, "usagestats", data, opts)
+	return resp, err
+}
+
+// command "vagrantlist", wshserver.VagrantListCommand
+func VagrantListCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) ([]wshrpc.VagrantMachine, error) {
+	resp, err := sendRpcRequestCallHelper[[]wshrpc.VagrantMachine](w, "vagrantlist", nil, opts)
+	return resp, err
+}
+
 // command "vdomasyncinitiation", wshserver.VDomAsyncInitiationCommand
 func VDomAsyncInitiationCommand(w *wshutil.WshRpc, data vdom.VDomAsyncInitiationRequest, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "vdomasyncinitiation", data, opts)
@@ -408,24 +823,60 @@ func WaveInfoCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (*wshrpc.WaveInfoD
 	return resp, err
 }
 
+// command "wavestatssubscribe", wshserver.WaveStatsSubscribeCommand
+func WaveStatsSubscribeCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "wavestatssubscribe", data, opts)
+	return err
+}
+
+// command "wavestatsunsubscribe", wshserver.WaveStatsUnsubscribeCommand
+func WaveStatsUnsubscribeCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "wavestatsunsubscribe", data, opts)
+	return err
+}
+
 // command "webselector", wshserver.WebSelectorCommand
 func WebSelectorCommand(w *wshutil.WshRpc, data wshrpc.CommandWebSelectorData, opts *wshrpc.RpcOpts) ([]string, error) {
 	resp, err := sendRpcRequestCallHelper[[]string](w, "webselector", data, opts)
 	return resp, err
 }
 
+// command "workspacehandoffexport", wshserver.WorkspaceHandoffExportCommand
+func WorkspaceHandoffExportCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) (*wshrpc.WorkspaceHandoffData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.WorkspaceHandoffData](w, "workspacehandoffexport", data, opts)
+	return resp, err
+}
+
+// command "workspacehandoffimport", wshserver.WorkspaceHandoffImportCommand
+func WorkspaceHandoffImportCommand(w *wshutil.WshRpc, data wshrpc.CommandWorkspaceHandoffImportData, opts *wshrpc.RpcOpts) (string, error) {
+	resp, err := sendRpcRequestCallHelper[string](w, "workspacehandoffimport", data, opts)
+	return resp, err
+}
+
 // command "workspacelist", wshserver.WorkspaceListCommand
 func WorkspaceListCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) ([]wshrpc.WorkspaceInfoData, error) {
 	resp, err := sendRpcRequestCallHelper[[]wshrpc.WorkspaceInfoData](w, "workspacelist", nil, opts)
 	return resp, err
 }
 
+// command "writediagbundle", wshserver.WriteDiagBundleCommand
+func WriteDiagBundleCommand(w *wshutil.WshRpc, data wshrpc.CommandWriteDiagBundleData, opts *wshrpc.RpcOpts) (string, error) {
+	resp, err := sendRpcRequestCallHelper[string](w, "writediagbundle", data, opts)
+	return resp, err
+}
+
 // command "wshactivity", wshserver.WshActivityCommand
 func WshActivityCommand(w *wshutil.WshRpc, data map[string]int, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "wshactivity", data, opts)
 	return err
 }
 
+// command "wshhelperstatus", wshserver.WshHelperStatusCommand
+func WshHelperStatusCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) ([]wshrpc.WshHelperStatus, error) {
+	resp, err := sendRpcRequestCallHelper[[]wshrpc.WshHelperStatus](w, "wshhelperstatus", nil, opts)
+	return resp, err
+}
+
 // command "wsldefaultdistro", wshserver.WslDefaultDistroCommand
 func WslDefaultDistroCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (string, error) {
 	resp, err := sendRpcRequestCallHelper[string](w, "wsldefaultdistro", nil, opts)
@@ -0,0 +1,611 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// archives (zip, tar, tar.gz) can be browsed without extracting them.  a path inside an archive
+// is the archive's path followed by the entry's path ("~/src.tar.gz/src/main.go"), so stat,
+// listing, and reading work through the normal file commands.  entries are read-only.
+
+const (
+	ArchiveFormat_Zip   = "zip"
+	ArchiveFormat_Tar   = "tar"
+	ArchiveFormat_TarGz = "tar.gz"
+)
+
+const MaxArchiveEntries = 100000
+const ArchiveIndexCacheSize = 8
+const ExtractProgressInterval = 200 * time.Millisecond
+
+// ArchiveFormat returns the archive format for a file name ("" if it is not a supported archive)
+func ArchiveFormat(name string) string {
+	lowerName := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lowerName, ".zip"):
+		return ArchiveFormat_Zip
+	case strings.HasSuffix(lowerName, ".tar"):
+		return ArchiveFormat_Tar
+	case strings.HasSuffix(lowerName, ".tar.gz"), strings.HasSuffix(lowerName, ".tgz"):
+		return ArchiveFormat_TarGz
+	}
+	return ""
+}
+
+type archiveEntry struct {
+	Name string // cleaned path inside the archive ("/" separated, no leading slash)
+	Info fs.FileInfo
+}
+
+type archiveIndex struct {
+	Format   string
+	Size     int64
+	ModTime  time.Time
+	LastUsed time.Time
+	Entries  map[string]*archiveEntry
+	Children map[string][]string // directory ("" for the root) => names of its entries
+}
+
+var archiveIndexLock = &sync.Mutex{}
+var archiveIndexCache = make(map[string]*archiveIndex)
+
+// directories that only exist implicitly (as the parent of an entry)
+type archiveDirInfo struct {
+	name    string
+	modTime time.Time
+}
+
+func (d archiveDirInfo) Name() string       { return d.name }
+func (d archiveDirInfo) Size() int64        { return 0 }
+func (d archiveDirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0755 }
+func (d archiveDirInfo) ModTime() time.Time { return d.modTime }
+func (d archiveDirInfo) IsDir() bool        { return true }
+func (d archiveDirInfo) Sys() any           { return nil }
+
+// cleans an entry name, returns "" for entries that would escape the archive (absolute or ".." paths)
+func cleanArchiveName(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") {
+		return ""
+	}
+	name = path.Clean(name)
+	if name == "." || name == ".." || strings.HasPrefix(name, "../") {
+		return ""
+	}
+	return name
+}
+
+// finds the archive that contains path, or returns false if path isn't inside (or is not) an archive.
+// innerPath is "" for the archive itself.
+func splitArchivePath(fullPath string) (string, string, bool) {
+	curPath := filepath.Clean(fullPath)
+	var innerParts []string
+	for {
+		finfo, err := os.Stat(curPath)
+		if err == nil {
+			if !finfo.Mode().IsRegular() || ArchiveFormat(curPath) == "" {
+				return "", "", false
+			}
+			innerPath := cleanArchiveName(strings.Join(innerParts, "/"))
+			if len(innerParts) > 0 && innerPath == "" {
+				return "", "", false
+			}
+			return curPath, innerPath, true
+		}
+		parent := filepath.Dir(curPath)
+		if parent == curPath {
+			return "", "", false
+		}
+		innerParts = append([]string{filepath.Base(curPath)}, innerParts...)
+		curPath = parent
+	}
+}
+
+type archiveReader struct {
+	tarReader *tar.Reader
+	zipReader *zip.ReadCloser
+	closers   []io.Closer
+	counter   *countingReader
+}
+
+func (r *archiveReader) Close() {
+	for idx := len(r.closers) - 1; idx >= 0; idx-- {
+		r.closers[idx].Close()
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func openArchive(archivePath string, format string) (*archiveReader, error) {
+	if format == ArchiveFormat_Zip {
+		zipReader, err := zip.OpenReader(archivePath)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open zip file %q: %w", archivePath, err)
+		}
+		return &archiveReader{zipReader: zipReader, closers: []io.Closer{zipReader}}, nil
+	}
+	fd, err := os.Open(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open archive %q: %w", archivePath, err)
+	}
+	rtn := &archiveReader{closers: []io.Closer{fd}, counter: &countingReader{r: fd}}
+	var reader io.Reader = rtn.counter
+	if format == ArchiveFormat_TarGz {
+		gzReader, err := gzip.NewReader(reader)
+		if err != nil {
+			rtn.Close()
+			return nil, fmt.Errorf("cannot open archive %q: %w", archivePath, err)
+		}
+		rtn.closers = append(rtn.closers, gzReader)
+		reader = gzReader
+	}
+	rtn.tarReader = tar.NewReader(reader)
+	return rtn, nil
+}
+
+// calls entryFn for each entry (with the cleaned name), entries with unsafe names are skipped.
+// for tar archives the reader is positioned at the entry's data, for zip archives zipFile is set.
+func (r *archiveReader) walk(ctx context.Context, entryFn func(name string, tarHeader *tar.Header, zipFile *zip.File) error) error {
+	if r.zipReader != nil {
+		for _, zipFile := range r.zipReader.File {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			name := cleanArchiveName(zipFile.Name)
+			if name == "" {
+				continue
+			}
+			if err := entryFn(name, nil, zipFile); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		header, err := r.tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading archive: %w", err)
+		}
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		name := cleanArchiveName(header.Name)
+		if name == "" {
+			continue
+		}
+		if err := entryFn(name, header, nil); err != nil {
+			return err
+		}
+	}
+}
+
+func buildArchiveIndex(ctx context.Context, archivePath string, format string) (*archiveIndex, error) {
+	reader, err := openArchive(archivePath, format)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	index := &archiveIndex{
+		Format:   format,
+		Entries:  make(map[string]*archiveEntry),
+		Children: make(map[string][]string),
+	}
+	var addEntry func(name string, info fs.FileInfo)
+	addEntry = func(name string, info fs.FileInfo) {
+		if existing := index.Entries[name]; existing != nil {
+			// later entries replace earlier ones (tar appends), but keep real info over implicit dirs
+			if _, isImplicit := info.(archiveDirInfo); isImplicit {
+				return
+			}
+			existing.Info = info
+			return
+		}
+		index.Entries[name] = &archiveEntry{Name: name, Info: info}
+		parent := path.Dir(name)
+		if parent == "." {
+			parent = ""
+		}
+		index.Children[parent] = append(index.Children[parent], name)
+		if parent != "" {
+			addEntry(parent, archiveDirInfo{name: path.Base(parent), modTime: info.ModTime()})
+		}
+	}
+	err = reader.walk(ctx, func(name string, tarHeader *tar.Header, zipFile *zip.File) error {
+		if len(index.Entries) >= MaxArchiveEntries {
+			return fmt.Errorf("archive %q has too many entries to browse (max %d)", archivePath, MaxArchiveEntries)
+		}
+		if zipFile != nil {
+			addEntry(name, zipFile.FileInfo())
+		} else {
+			addEntry(name, tarHeader.FileInfo())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// returns the (cached) index of an archive, it is rebuilt when the archive changes
+func getArchiveIndex(ctx context.Context, archivePath string) (*archiveIndex, error) {
+	finfo, err := os.Stat(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot stat archive %q: %w", archivePath, err)
+	}
+	archiveIndexLock.Lock()
+	index := archiveIndexCache[archivePath]
+	if index != nil && index.Size == finfo.Size() && index.ModTime.Equal(finfo.ModTime()) {
+		index.LastUsed = time.Now()
+		archiveIndexLock.Unlock()
+		return index, nil
+	}
+	archiveIndexLock.Unlock()
+	index, err = buildArchiveIndex(ctx, archivePath, ArchiveFormat(archivePath))
+	if err != nil {
+		return nil, err
+	}
+	index.Size = finfo.Size()
+	index.ModTime = finfo.ModTime()
+	index.LastUsed = time.Now()
+	archiveIndexLock.Lock()
+	defer archiveIndexLock.Unlock()
+	if len(archiveIndexCache) >= ArchiveIndexCacheSize {
+		var oldestPath string
+		for cachePath, cached := range archiveIndexCache {
+			if oldestPath == "" || cached.LastUsed.Before(archiveIndexCache[oldestPath].LastUsed) {
+				oldestPath = cachePath
+			}
+		}
+		delete(archiveIndexCache, oldestPath)
+	}
+	archiveIndexCache[archivePath] = index
+	return index, nil
+}
+
+func archiveEntryToFileInfo(archivePath string, entry *archiveEntry) *wshrpc.FileInfo {
+	fullPath := filepath.Join(archivePath, filepath.FromSlash(entry.Name))
+	rtn := statToFileInfo(fullPath, entry.Info, false)
+	rtn.Name = path.Base(entry.Name)
+	rtn.ReadOnly = true
+	if entry.Info.Mode()&fs.ModeSymlink != 0 {
+		rtn.IsSymlink = true
+		if header, ok := entry.Info.Sys().(*tar.Header); ok {
+			rtn.LinkTarget = header.Linkname
+		}
+	}
+	return rtn
+}
+
+// returns the info for a path inside an archive (nil if the path isn't inside an archive)
+func archivePathInfo(ctx context.Context, fullPath string) *wshrpc.FileInfo {
+	archivePath, innerPath, ok := splitArchivePath(fullPath)
+	if !ok || innerPath == "" {
+		return nil
+	}
+	index, err := getArchiveIndex(ctx, archivePath)
+	if err != nil {
+		return nil
+	}
+	entry := index.Entries[innerPath]
+	if entry == nil {
+		return &wshrpc.FileInfo{
+			Path:     wavebase.ReplaceHomeDir(fullPath),
+			Dir:      computeDirPart(fullPath, false),
+			NotFound: true,
+			ReadOnly: true,
+		}
+	}
+	return archiveEntryToFileInfo(archivePath, entry)
+}
+
+func (impl *ServerImpl) listArchiveEntries(ctx context.Context, archivePath string, innerPath string, opts wshrpc.FileListOpts) (*wshrpc.RemoteListEntriesRtnData, error) {
+	index, err := getArchiveIndex(ctx, archivePath)
+	if err != nil {
+		return nil, err
+	}
+	var dirInfo, parentInfo *wshrpc.FileInfo
+	if innerPath == "" {
+		dirInfo, err = impl.fileInfoInternal(archivePath, false)
+		if err != nil {
+			return nil, err
+		}
+		parentInfo, _ = impl.fileInfoInternal(filepath.Dir(archivePath), false)
+	} else {
+		entry := index.Entries[innerPath]
+		if entry == nil || !entry.Info.IsDir() {
+			return nil, fmt.Errorf("%q is not a directory", filepath.Join(archivePath, innerPath))
+		}
+		dirInfo = archiveEntryToFileInfo(archivePath, entry)
+		if parent := path.Dir(innerPath); parent == "." {
+			parentInfo, _ = impl.fileInfoInternal(archivePath, false)
+		} else {
+			parentInfo = archiveEntryToFileInfo(archivePath, index.Entries[parent])
+		}
+	}
+	var fileInfos []*wshrpc.FileInfo
+	for _, name := range index.Children[innerPath] {
+		if !opts.All && strings.HasPrefix(path.Base(name), ".") {
+			continue
+		}
+		fileInfos = append(fileInfos, archiveEntryToFileInfo(archivePath, index.Entries[name]))
+	}
+	return makeListEntriesRtn(dirInfo, parentInfo, fileInfos, opts), nil
+}
+
+// streams an archive entry (a file's contents, or a directory's entries) like remoteStreamFileInternal
+func (impl *ServerImpl) remoteStreamArchiveEntry(ctx context.Context, archivePath string, innerPath string, finfo *wshrpc.FileInfo, dataCallback func(fileInfo []*wshrpc.FileInfo, data []byte)) error {
+	if finfo.IsDir {
+		rtn, err := impl.listArchiveEntries(ctx, archivePath, innerPath, wshrpc.FileListOpts{All: true, Limit: MaxDirSize})
+		if err != nil {
+			return err
+		}
+		if rtn.Parent != nil {
+			dataCallback([]*wshrpc.FileInfo{rtn.Parent}, nil)
+		}
+		if len(rtn.Entries) > 0 {
+			dataCallback(rtn.Entries, nil)
+		}
+		return nil
+	}
+	reader, err := openArchive(archivePath, ArchiveFormat(archivePath))
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	errFound := fmt.Errorf("found")
+	err = reader.walk(ctx, func(name string, tarHeader *tar.Header, zipFile *zip.File) error {
+		if name != innerPath {
+			return nil
+		}
+		var entryReader io.Reader
+		if zipFile != nil {
+			zipEntryReader, err := zipFile.Open()
+			if err != nil {
+				return fmt.Errorf("cannot open %q: %w", name, err)
+			}
+			defer zipEntryReader.Close()
+			entryReader = zipEntryReader
+		} else {
+			entryReader = reader.tarReader
+		}
+		buf := make([]byte, FileChunkSize)
+		for {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			n, err := io.ReadFull(entryReader, buf)
+			if n > 0 {
+				dataCallback(nil, buf[:n])
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return errFound
+			}
+			if err != nil {
+				return fmt.Errorf("reading %q: %w", name, err)
+			}
+		}
+	})
+	if err == errFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%q not found in archive %q", innerPath, archivePath)
+}
+
+// DefaultExtractDir is the directory an archive is extracted to when no destination is given
+// (next to the archive, named after it without the extension)
+func DefaultExtractDir(archivePath string) string {
+	baseName := filepath.Base(archivePath)
+	lowerName := strings.ToLower(baseName)
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar", ".zip"} {
+		if strings.HasSuffix(lowerName, ext) {
+			baseName = baseName[:len(baseName)-len(ext)]
+			break
+		}
+	}
+	return filepath.Join(filepath.Dir(archivePath), baseName)
+}
+
+// symlinks (and hard links) are only created when their target stays inside destDir
+func isInsideDir(destDir string, targetPath string) bool {
+	relPath, err := filepath.Rel(destDir, targetPath)
+	return err == nil && relPath != ".." && !strings.HasPrefix(relPath, ".."+string(filepath.Separator))
+}
+
+func extractFile(targetPath string, reader io.Reader, mode fs.FileMode, overwrite bool) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+		return 0, err
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if overwrite {
+		// don't write through an existing symlink
+		if finfo, err := os.Lstat(targetPath); err == nil && finfo.Mode()&fs.ModeSymlink != 0 {
+			os.Remove(targetPath)
+		}
+	} else {
+		flags |= os.O_EXCL
+	}
+	perm := mode.Perm()
+	if perm == 0 {
+		perm = 0644
+	}
+	fd, err := os.OpenFile(targetPath, flags, perm)
+	if err != nil {
+		return 0, err
+	}
+	defer fd.Close()
+	return io.Copy(fd, reader)
+}
+
+func extractSymlink(destDir string, targetPath string, linkName string, overwrite bool) error {
+	if filepath.IsAbs(linkName) || !isInsideDir(destDir, filepath.Join(filepath.Dir(targetPath), linkName)) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+		return err
+	}
+	if overwrite {
+		os.Remove(targetPath)
+	}
+	return os.Symlink(linkName, targetPath)
+}
+
+// ExtractArchive extracts an archive into destDir (DefaultExtractDir if empty), calling progressFn
+// periodically and once more when done.  existing files are only replaced if overwrite is set.
+func ExtractArchive(ctx context.Context, archivePath string, destDir string, overwrite bool, progressFn func(wshrpc.ArchiveExtractProgress)) error {
+	format := ArchiveFormat(archivePath)
+	if format == "" {
+		return fmt.Errorf("%q is not a supported archive (zip, tar, tar.gz)", archivePath)
+	}
+	archiveInfo, err := os.Stat(archivePath)
+	if err != nil {
+		return fmt.Errorf("cannot stat archive %q: %w", archivePath, err)
+	}
+	if destDir == "" {
+		destDir = DefaultExtractDir(archivePath)
+	}
+	destDir = filepath.Clean(destDir)
+	if finfo, err := os.Stat(destDir); err == nil && !finfo.IsDir() {
+		return fmt.Errorf("cannot extract to %q, file exists at path", destDir)
+	}
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return fmt.Errorf("cannot create directory %q: %w", destDir, err)
+	}
+	reader, err := openArchive(archivePath, format)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	progress := wshrpc.ArchiveExtractProgress{DestPath: destDir, TotalBytes: archiveInfo.Size()}
+	lastProgressTs := time.Now()
+	err = reader.walk(ctx, func(name string, tarHeader *tar.Header, zipFile *zip.File) error {
+		targetPath := filepath.Join(destDir, filepath.FromSlash(name))
+		var err error
+		var written int64
+		if zipFile != nil {
+			progress.ReadBytes += int64(zipFile.CompressedSize64)
+			mode := zipFile.Mode()
+			switch {
+			case mode.IsDir():
+				err = os.MkdirAll(targetPath, 0755)
+			case mode&fs.ModeSymlink != 0:
+				var linkBytes []byte
+				linkBytes, err = readZipFile(zipFile)
+				if err == nil {
+					err = extractSymlink(destDir, targetPath, string(linkBytes), overwrite)
+				}
+			case mode.IsRegular():
+				var zipEntryReader io.ReadCloser
+				zipEntryReader, err = zipFile.Open()
+				if err == nil {
+					written, err = extractFile(targetPath, zipEntryReader, mode, overwrite)
+					zipEntryReader.Close()
+				}
+			}
+		} else {
+			switch tarHeader.Typeflag {
+			case tar.TypeDir:
+				err = os.MkdirAll(targetPath, 0755)
+			case tar.TypeReg, tar.TypeRegA:
+				written, err = extractFile(targetPath, reader.tarReader, tarHeader.FileInfo().Mode(), overwrite)
+			case tar.TypeSymlink:
+				err = extractSymlink(destDir, targetPath, tarHeader.Linkname, overwrite)
+			case tar.TypeLink:
+				if linkName := cleanArchiveName(tarHeader.Linkname); linkName != "" {
+					if overwrite {
+						os.Remove(targetPath)
+					}
+					err = os.Link(filepath.Join(destDir, filepath.FromSlash(linkName)), targetPath)
+				}
+			}
+			progress.ReadBytes = reader.counter.n
+		}
+		if err != nil {
+			return fmt.Errorf("extracting %q: %w", name, err)
+		}
+		progress.Files++
+		progress.Bytes += written
+		if progressFn != nil && time.Since(lastProgressTs) >= ExtractProgressInterval {
+			lastProgressTs = time.Now()
+			progressFn(progress)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	progress.ReadBytes = progress.TotalBytes
+	progress.Done = true
+	if progressFn != nil {
+		progressFn(progress)
+	}
+	return nil
+}
+
+func readZipFile(zipFile *zip.File) ([]byte, error) {
+	zipEntryReader, err := zipFile.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer zipEntryReader.Close()
+	return io.ReadAll(io.LimitReader(zipEntryReader, 4096))
+}
+
+func (impl *ServerImpl) RemoteArchiveExtractCommand(ctx context.Context, data wshrpc.CommandRemoteArchiveExtractData) chan wshrpc.RespOrErrorUnion[wshrpc.ArchiveExtractProgress] {
+	rtn := make(chan wshrpc.RespOrErrorUnion[wshrpc.ArchiveExtractProgress])
+	go func() {
+		defer func() {
+			panichandler.PanicHandler("RemoteArchiveExtractCommand")
+			close(rtn)
+		}()
+		var destDir string
+		if data.DestPath != "" {
+			destDir = filepath.Clean(wavebase.ExpandHomeDirSafe(data.DestPath))
+		}
+		err := ExtractArchive(ctx, filepath.Clean(wavebase.ExpandHomeDirSafe(data.Path)), destDir, data.Overwrite, func(progress wshrpc.ArchiveExtractProgress) {
+			progress.DestPath = wavebase.ReplaceHomeDir(progress.DestPath)
+			rtn <- wshrpc.RespOrErrorUnion[wshrpc.ArchiveExtractProgress]{Response: progress}
+		})
+		if err != nil {
+			rtn <- wshrpc.RespOrErrorUnion[wshrpc.ArchiveExtractProgress]{Error: err}
+		}
+	}()
+	return rtn
+}
@@ -0,0 +1,142 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+var testArchiveFiles = map[string]string{
+	"readme.txt":       "hello",
+	"src/main.go":      "package main\n",
+	"src/util/util.go": "package util\n",
+	"../escape.txt":    "should be skipped",
+}
+
+func writeTestZip(t *testing.T, zipPath string) {
+	fd, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	zipWriter := zip.NewWriter(fd)
+	for name, contents := range testArchiveFiles {
+		writer, err := zipWriter.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writer.Write([]byte(contents))
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestTarGz(t *testing.T, tarPath string) {
+	fd, err := os.Create(tarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	gzWriter := gzip.NewWriter(fd)
+	tarWriter := tar.NewWriter(gzWriter)
+	tarWriter.WriteHeader(&tar.Header{Name: "src/", Typeflag: tar.TypeDir, Mode: 0755})
+	for name, contents := range testArchiveFiles {
+		tarWriter.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(contents))})
+		tarWriter.Write([]byte(contents))
+	}
+	tarWriter.WriteHeader(&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"})
+	tarWriter.Close()
+	gzWriter.Close()
+}
+
+func testBrowseArchive(t *testing.T, archivePath string) {
+	impl := &ServerImpl{}
+	ctx := context.Background()
+	rtn, err := impl.RemoteListEntriesCommand(ctx, wshrpc.CommandRemoteListEntriesData{Path: archivePath})
+	if err != nil {
+		t.Fatalf("error listing %s: %v", archivePath, err)
+	}
+	if len(rtn.Entries) < 2 || rtn.Entries[0].Name != "src" || !rtn.Entries[0].IsDir || rtn.Entries[len(rtn.Entries)-1].Name != "readme.txt" {
+		t.Fatalf("unexpected entries in %s: %+v", archivePath, rtn.Entries)
+	}
+	if rtn.Parent == nil || rtn.Parent.Path != filepath.Dir(archivePath) {
+		t.Errorf("parent should be the archive's directory, got %+v", rtn.Parent)
+	}
+	rtn, err = impl.RemoteListEntriesCommand(ctx, wshrpc.CommandRemoteListEntriesData{Path: filepath.Join(archivePath, "src")})
+	if err != nil {
+		t.Fatalf("error listing %s/src: %v", archivePath, err)
+	}
+	if len(rtn.Entries) != 2 || rtn.Entries[0].Name != "util" || rtn.Entries[1].Name != "main.go" {
+		t.Fatalf("unexpected entries in %s/src: %+v", archivePath, rtn.Entries)
+	}
+	finfo, err := impl.RemoteFileInfoCommand(ctx, filepath.Join(archivePath, "src/util/util.go"))
+	if err != nil || finfo.NotFound || !finfo.ReadOnly || finfo.Size != int64(len("package util\n")) {
+		t.Fatalf("bad file info %+v (err %v)", finfo, err)
+	}
+	finfo, err = impl.RemoteFileInfoCommand(ctx, filepath.Join(archivePath, "missing.txt"))
+	if err != nil || !finfo.NotFound {
+		t.Fatalf("expected not found, got %+v (err %v)", finfo, err)
+	}
+	var contents []byte
+	err = impl.remoteStreamFileInternal(ctx, wshrpc.CommandRemoteStreamFileData{Path: filepath.Join(archivePath, "src/main.go")}, func(fileInfo []*wshrpc.FileInfo, data []byte) {
+		contents = append(contents, data...)
+	})
+	if err != nil || string(contents) != "package main\n" {
+		t.Fatalf("bad contents %q (err %v)", contents, err)
+	}
+}
+
+func TestArchiveBrowse(t *testing.T) {
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "test.zip")
+	writeTestZip(t, zipPath)
+	testBrowseArchive(t, zipPath)
+	tarPath := filepath.Join(dir, "test.tar.gz")
+	writeTestTarGz(t, tarPath)
+	testBrowseArchive(t, tarPath)
+}
+
+func TestArchiveExtract(t *testing.T) {
+	dir := t.TempDir()
+	tarPath := filepath.Join(dir, "test.tgz")
+	writeTestTarGz(t, tarPath)
+	var lastProgress wshrpc.ArchiveExtractProgress
+	err := ExtractArchive(context.Background(), tarPath, "", false, func(progress wshrpc.ArchiveExtractProgress) {
+		lastProgress = progress
+	})
+	if err != nil {
+		t.Fatalf("error extracting: %v", err)
+	}
+	destDir := filepath.Join(dir, "test")
+	if !lastProgress.Done || lastProgress.DestPath != destDir || lastProgress.ReadBytes != lastProgress.TotalBytes {
+		t.Errorf("bad final progress %+v", lastProgress)
+	}
+	contents, err := os.ReadFile(filepath.Join(destDir, "src/util/util.go"))
+	if err != nil || string(contents) != "package util\n" {
+		t.Errorf("bad extracted file %q (err %v)", contents, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape.txt")); err == nil {
+		t.Errorf("entry outside of the destination was extracted")
+	}
+	if _, err := os.Lstat(filepath.Join(destDir, "link")); err == nil {
+		t.Errorf("symlink to a path outside of the destination was created")
+	}
+	err = ExtractArchive(context.Background(), tarPath, "", false, nil)
+	if err == nil {
+		t.Errorf("expected an error extracting over existing files")
+	}
+	err = ExtractArchive(context.Background(), tarPath, "", true, nil)
+	if err != nil {
+		t.Errorf("error extracting with overwrite: %v", err)
+	}
+}
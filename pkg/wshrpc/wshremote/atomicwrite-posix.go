@@ -0,0 +1,25 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !windows
+
+package wshremote
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+func fileLinkCount(finfo fs.FileInfo) uint64 {
+	if stat, ok := finfo.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Nlink)
+	}
+	return 1
+}
+
+func copyFileOwner(path string, finfo fs.FileInfo) {
+	if stat, ok := finfo.Sys().(*syscall.Stat_t); ok {
+		os.Lchown(path, int(stat.Uid), int(stat.Gid))
+	}
+}
@@ -0,0 +1,16 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build windows
+
+package wshremote
+
+import (
+	"io/fs"
+)
+
+func fileLinkCount(finfo fs.FileInfo) uint64 {
+	return 1
+}
+
+func copyFileOwner(path string, finfo fs.FileInfo) {}
@@ -0,0 +1,113 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+)
+
+// files are saved by writing a temp file next to the original and renaming it over the original,
+// so a failed or interrupted save never leaves a truncated file.  saves can pass the checksum of
+// the contents they were editing, the save fails (without writing) if the file changed since.
+
+// ErrorPrefix_FileModified starts the error returned when a save is rejected because the file changed
+const ErrorPrefix_FileModified = "EC-MODIFIED:"
+
+func ChecksumBytes(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func checksumFile(path string) (string, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, fd); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// returns an error if the file no longer has the expected checksum.  a file that was removed is not
+// a conflict (saving recreates it).
+func checkFileChecksum(path string, checksum string) error {
+	curChecksum, err := checksumFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read %q to check for changes: %w", path, err)
+	}
+	if curChecksum != checksum {
+		return fmt.Errorf("%s file %q was changed since it was opened", ErrorPrefix_FileModified, wavebase.ReplaceHomeDir(path))
+	}
+	return nil
+}
+
+// atomicWriteFile writes through symlinks (the link is kept), and keeps the mode and (where possible)
+// the owner of an existing file.  it writes in place when a temp file can't be created next to the
+// file (no write permission on the directory) or when the file has other hard links.
+func atomicWriteFile(path string, data []byte, createMode fs.FileMode) error {
+	targetPath := path
+	if resolvedPath, err := filepath.EvalSymlinks(path); err == nil {
+		targetPath = resolvedPath
+	}
+	mode := createMode
+	finfo, err := os.Stat(targetPath)
+	exists := err == nil
+	if exists {
+		if finfo.IsDir() {
+			return fmt.Errorf("cannot write file %q, it is a directory", path)
+		}
+		mode = finfo.Mode() & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky)
+		if fileLinkCount(finfo) > 1 {
+			return os.WriteFile(targetPath, data, mode)
+		}
+	}
+	tmpFd, err := os.CreateTemp(filepath.Dir(targetPath), "."+filepath.Base(targetPath)+".wsh-tmp-*")
+	if err != nil {
+		return os.WriteFile(targetPath, data, mode)
+	}
+	tmpName := tmpFd.Name()
+	renamed := false
+	defer func() {
+		if !renamed {
+			tmpFd.Close()
+			os.Remove(tmpName)
+		}
+	}()
+	if _, err := tmpFd.Write(data); err != nil {
+		return err
+	}
+	if err := tmpFd.Sync(); err != nil {
+		return err
+	}
+	if err := tmpFd.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, mode); err != nil {
+		return err
+	}
+	if exists {
+		// only root (or the owner, for the group) can change ownership, so this is best effort
+		copyFileOwner(tmpName, finfo)
+	}
+	if err := os.Rename(tmpName, targetPath); err != nil {
+		return err
+	}
+	renamed = true
+	return nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+func TestRemoteWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "script.sh")
+	linkPath := filepath.Join(dir, "link.sh")
+	os.WriteFile(filePath, []byte("v1"), 0750)
+	os.Symlink(filePath, linkPath)
+	impl := &ServerImpl{}
+	ctx := context.Background()
+	writeFn := func(path string, contents string, checksum string) error {
+		return impl.RemoteWriteFileCommand(ctx, wshrpc.CommandRemoteWriteFileData{
+			Path:     path,
+			Data64:   base64.StdEncoding.EncodeToString([]byte(contents)),
+			Checksum: checksum,
+		})
+	}
+
+	if err := writeFn(linkPath, "v2", ChecksumBytes([]byte("v1"))); err != nil {
+		t.Fatalf("error saving: %v", err)
+	}
+	if finfo, err := os.Lstat(linkPath); err != nil || finfo.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("symlink was replaced")
+	}
+	finfo, err := os.Stat(filePath)
+	if err != nil || finfo.Mode().Perm() != 0750 {
+		t.Errorf("mode was not kept: %v", finfo.Mode())
+	}
+	if contents, _ := os.ReadFile(filePath); string(contents) != "v2" {
+		t.Errorf("bad contents %q", contents)
+	}
+
+	// the file no longer matches the checksum it was opened with
+	err = writeFn(filePath, "v3", ChecksumBytes([]byte("v1")))
+	if err == nil || !strings.HasPrefix(err.Error(), ErrorPrefix_FileModified) {
+		t.Fatalf("expected a modified error, got %v", err)
+	}
+	if contents, _ := os.ReadFile(filePath); string(contents) != "v2" {
+		t.Errorf("file was written after a conflict: %q", contents)
+	}
+	if err := writeFn(filePath, "v3", ""); err != nil {
+		t.Fatalf("error saving without a checksum: %v", err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("temp files were left behind: %v", entries)
+	}
+}
@@ -0,0 +1,334 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wps"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+// files open in preview blocks are watched so the previews refresh when the file changes (e.g. a
+// build regenerates it).  the parent directory of each path is watched with fsnotify, since editors
+// and build tools often replace a file by renaming over it (which a watch on the file would lose).
+// paths that can't be watched this way (out of inotify watches, a directory that doesn't exist yet)
+// are polled.  events are batched, and a file is only reported when its size or modtime changed.
+
+const FileWatchExpireTime = 2 * time.Minute
+const FileWatchBatchTime = 200 * time.Millisecond
+const FileWatchPollInterval = 2 * time.Second
+const MaxFileWatchPaths = 256
+
+type fileWatchState struct {
+	Exists  bool
+	IsDir   bool
+	Size    int64
+	ModTime time.Time
+}
+
+type fileWatch struct {
+	WatchId string
+	Paths   map[string]fileWatchState
+	Client  *wshutil.WshRpc
+	Expires time.Time
+}
+
+type fileWatcher struct {
+	Lock       *sync.Mutex
+	Started    bool
+	Notify     *fsnotify.Watcher // nil if fsnotify is unavailable (then every path is polled)
+	NotifyDirs map[string]bool
+	Watches    map[string]*fileWatch
+	Dirty      map[string]bool
+	BatchTimer *time.Timer
+	PublishFn  func(client *wshutil.WshRpc, data wshrpc.FileChangeEventData)
+}
+
+var globalFileWatcher = makeFileWatcher(publishFileChange)
+
+func makeFileWatcher(publishFn func(*wshutil.WshRpc, wshrpc.FileChangeEventData)) *fileWatcher {
+	return &fileWatcher{
+		Lock:       &sync.Mutex{},
+		NotifyDirs: make(map[string]bool),
+		Watches:    make(map[string]*fileWatch),
+		Dirty:      make(map[string]bool),
+		PublishFn:  publishFn,
+	}
+}
+
+func publishFileChange(client *wshutil.WshRpc, data wshrpc.FileChangeEventData) {
+	if client == nil {
+		return
+	}
+	event := wps.WaveEvent{
+		Event:  wps.Event_FileChange,
+		Scopes: []string{data.WatchId},
+		Data:   data,
+	}
+	wshclient.EventPublishCommand(client, event, &wshrpc.RpcOpts{NoResponse: true})
+}
+
+func statWatchPath(path string) fileWatchState {
+	finfo, err := os.Stat(path)
+	if err != nil {
+		return fileWatchState{}
+	}
+	return fileWatchState{Exists: true, IsDir: finfo.IsDir(), Size: finfo.Size(), ModTime: finfo.ModTime()}
+}
+
+func (s fileWatchState) changed(other fileWatchState) bool {
+	return s.Exists != other.Exists || s.IsDir != other.IsDir || s.Size != other.Size || !s.ModTime.Equal(other.ModTime)
+}
+
+func makeFileChangeEvent(watchId string, path string, state fileWatchState) wshrpc.FileChangeEventData {
+	rtn := wshrpc.FileChangeEventData{WatchId: watchId, Path: path, Op: wshrpc.FileChangeOp_Delete}
+	if state.Exists {
+		rtn.Op = wshrpc.FileChangeOp_Change
+		rtn.Size = state.Size
+		rtn.ModTime = state.ModTime.UnixMilli()
+	}
+	return rtn
+}
+
+// call with Lock held
+func (w *fileWatcher) ensureStarted() {
+	if w.Started {
+		return
+	}
+	w.Started = true
+	notify, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("cannot create file watcher, polling instead: %v\n", err)
+	} else {
+		w.Notify = notify
+		go w.runNotifyLoop(notify)
+	}
+	go w.runPollLoop()
+}
+
+func (w *fileWatcher) runNotifyLoop(notify *fsnotify.Watcher) {
+	defer panichandler.PanicHandler("fileWatcher.runNotifyLoop")
+	for {
+		select {
+		case event, ok := <-notify.Events:
+			if !ok {
+				return
+			}
+			w.handleNotifyEvent(event)
+		case err, ok := <-notify.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("file watcher error: %v\n", err)
+		}
+	}
+}
+
+func (w *fileWatcher) runPollLoop() {
+	defer panichandler.PanicHandler("fileWatcher.runPollLoop")
+	for {
+		time.Sleep(FileWatchPollInterval)
+		w.pollOnce(time.Now())
+	}
+}
+
+func (w *fileWatcher) numPaths() int {
+	var rtn int
+	for _, watch := range w.Watches {
+		rtn += len(watch.Paths)
+	}
+	return rtn
+}
+
+// replaces the paths watched for watchId (no paths removes the watch)
+func (w *fileWatcher) setWatch(watchId string, paths []string, client *wshutil.WshRpc) error {
+	if watchId == "" {
+		return fmt.Errorf("no watch id")
+	}
+	cleanPaths := make([]string, 0, len(paths))
+	for _, pathStr := range paths {
+		path, err := wavebase.ExpandHomeDir(pathStr)
+		if err != nil {
+			return err
+		}
+		cleanPaths = append(cleanPaths, filepath.Clean(path))
+	}
+	w.Lock.Lock()
+	defer w.Lock.Unlock()
+	oldWatch := w.Watches[watchId]
+	if len(cleanPaths) == 0 {
+		delete(w.Watches, watchId)
+		w.syncNotifyDirs()
+		return nil
+	}
+	numOldPaths := 0
+	if oldWatch != nil {
+		numOldPaths = len(oldWatch.Paths)
+	}
+	if w.numPaths()-numOldPaths+len(cleanPaths) > MaxFileWatchPaths {
+		return fmt.Errorf("too many watched files (max %d)", MaxFileWatchPaths)
+	}
+	w.ensureStarted()
+	watch := &fileWatch{
+		WatchId: watchId,
+		Paths:   make(map[string]fileWatchState),
+		Client:  client,
+		Expires: time.Now().Add(FileWatchExpireTime),
+	}
+	for _, path := range cleanPaths {
+		if oldWatch != nil {
+			if state, ok := oldWatch.Paths[path]; ok {
+				// a renewed watch keeps its state, so changes between renewals aren't lost
+				watch.Paths[path] = state
+				continue
+			}
+		}
+		watch.Paths[path] = statWatchPath(path)
+	}
+	w.Watches[watchId] = watch
+	w.syncNotifyDirs()
+	return nil
+}
+
+// adds and removes fsnotify watches to match the watched paths.  call with Lock held.
+func (w *fileWatcher) syncNotifyDirs() {
+	if w.Notify == nil {
+		return
+	}
+	wantDirs := make(map[string]bool)
+	for _, watch := range w.Watches {
+		for path, state := range watch.Paths {
+			wantDirs[filepath.Dir(path)] = true
+			if state.IsDir {
+				wantDirs[path] = true
+			}
+		}
+	}
+	for dir := range w.NotifyDirs {
+		if !wantDirs[dir] {
+			w.Notify.Remove(dir)
+			delete(w.NotifyDirs, dir)
+		}
+	}
+	for dir := range wantDirs {
+		if w.NotifyDirs[dir] {
+			continue
+		}
+		if err := w.Notify.Add(dir); err == nil {
+			w.NotifyDirs[dir] = true
+		}
+	}
+}
+
+// paths not covered by an fsnotify watch are polled.  call with Lock held.
+func (w *fileWatcher) isPolled(path string, state fileWatchState) bool {
+	if !w.NotifyDirs[filepath.Dir(path)] {
+		return true
+	}
+	return state.IsDir && !w.NotifyDirs[path]
+}
+
+func (w *fileWatcher) handleNotifyEvent(event fsnotify.Event) {
+	name := filepath.Clean(event.Name)
+	w.Lock.Lock()
+	defer w.Lock.Unlock()
+	var isDirty bool
+	for _, watch := range w.Watches {
+		for path, state := range watch.Paths {
+			if path == name || (state.IsDir && filepath.Dir(name) == path) {
+				w.Dirty[path] = true
+				isDirty = true
+			}
+		}
+	}
+	if isDirty && w.BatchTimer == nil {
+		// not reset by later events, so a file that is written continuously is still reported
+		w.BatchTimer = time.AfterFunc(FileWatchBatchTime, w.flushDirty)
+	}
+}
+
+// checks the given paths, updating the watch state and returning the events to publish.  dirty
+// directories are always reported (an entry in them changed).  call with Lock held.
+func (w *fileWatcher) checkPaths(paths map[string]bool, dirtyDirs bool) ([]*fileWatch, []wshrpc.FileChangeEventData) {
+	var rtnWatches []*fileWatch
+	var rtnEvents []wshrpc.FileChangeEventData
+	newStates := make(map[string]fileWatchState)
+	for _, watch := range w.Watches {
+		for path, oldState := range watch.Paths {
+			if !paths[path] {
+				continue
+			}
+			newState, ok := newStates[path]
+			if !ok {
+				newState = statWatchPath(path)
+				newStates[path] = newState
+			}
+			if !newState.changed(oldState) && !(dirtyDirs && newState.IsDir) {
+				continue
+			}
+			watch.Paths[path] = newState
+			rtnWatches = append(rtnWatches, watch)
+			rtnEvents = append(rtnEvents, makeFileChangeEvent(watch.WatchId, path, newState))
+		}
+	}
+	return rtnWatches, rtnEvents
+}
+
+func (w *fileWatcher) publish(watches []*fileWatch, events []wshrpc.FileChangeEventData) {
+	for idx, event := range events {
+		w.PublishFn(watches[idx].Client, event)
+	}
+}
+
+func (w *fileWatcher) flushDirty() {
+	defer panichandler.PanicHandler("fileWatcher.flushDirty")
+	w.Lock.Lock()
+	dirty := w.Dirty
+	w.Dirty = make(map[string]bool)
+	w.BatchTimer = nil
+	watches, events := w.checkPaths(dirty, true)
+	// a path that became a directory (or stopped being one) changes the dirs to watch
+	w.syncNotifyDirs()
+	w.Lock.Unlock()
+	w.publish(watches, events)
+}
+
+// expires watches that weren't renewed and polls the paths fsnotify doesn't cover
+func (w *fileWatcher) pollOnce(now time.Time) {
+	w.Lock.Lock()
+	for watchId, watch := range w.Watches {
+		if now.After(watch.Expires) {
+			delete(w.Watches, watchId)
+		}
+	}
+	// retries dirs that couldn't be watched before (they may exist now)
+	w.syncNotifyDirs()
+	pollPaths := make(map[string]bool)
+	for _, watch := range w.Watches {
+		for path, state := range watch.Paths {
+			if w.isPolled(path, state) {
+				pollPaths[path] = true
+			}
+		}
+	}
+	watches, events := w.checkPaths(pollPaths, false)
+	w.Lock.Unlock()
+	w.publish(watches, events)
+}
+
+func (impl *ServerImpl) RemoteWatchFilesCommand(ctx context.Context, data wshrpc.CommandRemoteWatchFilesData) error {
+	return globalFileWatcher.setWatch(data.WatchId, data.Paths, wshutil.GetWshRpcFromContext(ctx))
+}
@@ -0,0 +1,118 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+func makeTestFileWatcher() (*fileWatcher, chan wshrpc.FileChangeEventData) {
+	eventCh := make(chan wshrpc.FileChangeEventData, 10)
+	watcher := makeFileWatcher(func(_ *wshutil.WshRpc, data wshrpc.FileChangeEventData) {
+		eventCh <- data
+	})
+	return watcher, eventCh
+}
+
+func waitFileChange(t *testing.T, eventCh chan wshrpc.FileChangeEventData) wshrpc.FileChangeEventData {
+	t.Helper()
+	select {
+	case event := <-eventCh:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for file change event")
+		return wshrpc.FileChangeEventData{}
+	}
+}
+
+func TestFileWatchNotify(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.txt")
+	os.WriteFile(path, []byte("one"), 0644)
+	watcher, eventCh := makeTestFileWatcher()
+	if err := watcher.setWatch("block1", []string{path}, nil); err != nil {
+		t.Fatalf("setWatch: %v", err)
+	}
+	if watcher.Notify == nil {
+		t.Skip("fsnotify not available")
+	}
+	// replaced by a rename, as build tools often do
+	tmpPath := filepath.Join(dir, "out.txt.tmp")
+	os.WriteFile(tmpPath, []byte("two, longer"), 0644)
+	os.Rename(tmpPath, path)
+	event := waitFileChange(t, eventCh)
+	if event.WatchId != "block1" || event.Path != path || event.Op != wshrpc.FileChangeOp_Change || event.Size != 11 {
+		t.Errorf("unexpected event %+v", event)
+	}
+	os.Remove(path)
+	event = waitFileChange(t, eventCh)
+	if event.Op != wshrpc.FileChangeOp_Delete {
+		t.Errorf("expected delete event, got %+v", event)
+	}
+	// unrelated files in the same directory aren't reported
+	os.WriteFile(filepath.Join(dir, "other.txt"), []byte("other"), 0644)
+	select {
+	case event := <-eventCh:
+		t.Errorf("unexpected event %+v", event)
+	case <-time.After(4 * FileWatchBatchTime):
+	}
+}
+
+func TestFileWatchPoll(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.txt")
+	watcher, eventCh := makeTestFileWatcher()
+	// no fsnotify, every path is polled
+	watcher.Started = true
+	if err := watcher.setWatch("block1", []string{path}, nil); err != nil {
+		t.Fatalf("setWatch: %v", err)
+	}
+	watcher.pollOnce(time.Now())
+	if len(eventCh) != 0 {
+		t.Fatalf("unexpected event for an unchanged file")
+	}
+	os.WriteFile(path, []byte("created"), 0644)
+	watcher.pollOnce(time.Now())
+	event := waitFileChange(t, eventCh)
+	if event.Op != wshrpc.FileChangeOp_Change || event.Size != 7 {
+		t.Errorf("unexpected event %+v", event)
+	}
+	// renewing the watch keeps its state
+	watcher.setWatch("block1", []string{path}, nil)
+	watcher.pollOnce(time.Now())
+	if len(eventCh) != 0 {
+		t.Fatalf("unexpected event after renewing the watch")
+	}
+	watcher.pollOnce(time.Now().Add(FileWatchExpireTime + time.Second))
+	if len(watcher.Watches) != 0 {
+		t.Errorf("watch did not expire")
+	}
+}
+
+func TestFileWatchLimit(t *testing.T) {
+	watcher, _ := makeTestFileWatcher()
+	watcher.Started = true
+	dir := t.TempDir()
+	paths := make([]string, MaxFileWatchPaths+1)
+	for idx := range paths {
+		paths[idx] = filepath.Join(dir, fmt.Sprintf("file%d", idx))
+	}
+	if err := watcher.setWatch("block1", paths, nil); err == nil {
+		t.Errorf("expected an error watching %d paths", len(paths))
+	}
+	if err := watcher.setWatch("block1", paths[:2], nil); err != nil {
+		t.Errorf("setWatch: %v", err)
+	}
+	watcher.setWatch("block1", nil, nil)
+	if len(watcher.Watches) != 0 {
+		t.Errorf("watch not removed")
+	}
+}
@@ -0,0 +1,350 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// large files are previewed a page of lines at a time.  a sparse line index (the offset of every
+// LineIndexInterval'th line) is built as the file is read and finished in the background, so any
+// page can be read with one seek and a short scan.  indexes are cached per file.  a file that grew
+// (a log file) keeps its index, any other change rebuilds it.
+
+const LineIndexInterval = 1000
+const LineIndexStep = 200 * LineIndexInterval // lines indexed per step of the background indexer
+const LineIndexCacheSize = 16
+const LineScanBufSize = 256 * 1024
+const MaxLineLength = 16 * 1024 // longer lines are truncated
+const MaxReadLines = 5000
+const DefaultSearchResults = 100
+const MaxSearchResults = 1000
+const MaxSearchMatchText = 400
+const SearchTimeBudget = 3 * time.Second
+
+type lineIndex struct {
+	Lock          *sync.Mutex
+	Path          string
+	Size          int64
+	ModTime       time.Time
+	LastUsed      time.Time
+	Offsets       []int64 // Offsets[n] is the offset of line n*LineIndexInterval
+	ScannedOffset int64   // the offset of line ScannedLines (always the start of a line)
+	ScannedLines  int
+	Done          bool
+	TotalLines    int
+	Indexing      bool
+}
+
+var lineIndexLock = &sync.Mutex{}
+var lineIndexCache = make(map[string]*lineIndex)
+
+func getLineIndex(path string, finfo os.FileInfo) *lineIndex {
+	lineIndexLock.Lock()
+	defer lineIndexLock.Unlock()
+	if index := lineIndexCache[path]; index != nil {
+		index.Lock.Lock()
+		defer index.Lock.Unlock()
+		if index.Size == finfo.Size() && index.ModTime.Equal(finfo.ModTime()) {
+			index.LastUsed = time.Now()
+			return index
+		}
+		if finfo.Size() > index.Size {
+			// appended to, the scan continues from the start of the last (possibly partial) line
+			index.Size = finfo.Size()
+			index.ModTime = finfo.ModTime()
+			index.Done = false
+			index.LastUsed = time.Now()
+			return index
+		}
+	}
+	if len(lineIndexCache) >= LineIndexCacheSize {
+		var oldestPath string
+		for cachePath, cached := range lineIndexCache {
+			if oldestPath == "" || cached.LastUsed.Before(lineIndexCache[oldestPath].LastUsed) {
+				oldestPath = cachePath
+			}
+		}
+		delete(lineIndexCache, oldestPath)
+	}
+	index := &lineIndex{
+		Lock:     &sync.Mutex{},
+		Path:     path,
+		Size:     finfo.Size(),
+		ModTime:  finfo.ModTime(),
+		LastUsed: time.Now(),
+		Offsets:  []int64{0},
+	}
+	lineIndexCache[path] = index
+	return index
+}
+
+// scans forward until the index covers targetLine or the end of the file.  call with Lock held.
+func (index *lineIndex) extendTo(ctx context.Context, fd *os.File, targetLine int) error {
+	buf := make([]byte, LineScanBufSize)
+	readPos := index.ScannedOffset
+	for !index.Done && index.ScannedLines <= targetLine {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		n, err := fd.ReadAt(buf, readPos)
+		chunk := buf[:n]
+		for {
+			nlIdx := bytes.IndexByte(chunk, '\n')
+			if nlIdx < 0 {
+				break
+			}
+			index.ScannedOffset = readPos + int64(n-len(chunk)+nlIdx+1)
+			index.ScannedLines++
+			if index.ScannedLines%LineIndexInterval == 0 {
+				index.Offsets = append(index.Offsets, index.ScannedOffset)
+			}
+			chunk = chunk[nlIdx+1:]
+		}
+		readPos += int64(n)
+		if errors.Is(err, io.EOF) || readPos >= index.Size {
+			index.Done = true
+			index.TotalLines = index.ScannedLines
+			if index.ScannedOffset < readPos {
+				// the last line has no newline
+				index.TotalLines++
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading %q: %w", index.Path, err)
+		}
+	}
+	return nil
+}
+
+// finishes the index in the background (in steps, so page reads aren't blocked).  call with Lock held.
+func (index *lineIndex) startIndexing() {
+	if index.Done || index.Indexing {
+		return
+	}
+	index.Indexing = true
+	go func() {
+		defer panichandler.PanicHandler("lineIndex.startIndexing")
+		fd, err := os.Open(index.Path)
+		if err == nil {
+			defer fd.Close()
+		}
+		for {
+			index.Lock.Lock()
+			if err == nil {
+				err = index.extendTo(context.Background(), fd, index.ScannedLines+LineIndexStep)
+			}
+			if err != nil || index.Done {
+				index.Indexing = false
+				index.Lock.Unlock()
+				return
+			}
+			index.Lock.Unlock()
+		}
+	}()
+}
+
+// the offset of the closest indexed line at or before line (the index must cover line).  call with Lock held.
+func (index *lineIndex) seekLine(line int) (int64, int) {
+	offsetIdx := min(line/LineIndexInterval, len(index.Offsets)-1)
+	return index.Offsets[offsetIdx], offsetIdx * LineIndexInterval
+}
+
+func (index *lineIndex) estimateTotalLines() int {
+	if index.Done {
+		return index.TotalLines
+	}
+	if index.ScannedOffset == 0 || index.ScannedLines == 0 {
+		return 0
+	}
+	return int(float64(index.ScannedLines) * float64(index.Size) / float64(index.ScannedOffset))
+}
+
+// reads one line (without the line ending), truncated to MaxLineLength.  returns io.EOF after the last line.
+func readLine(reader *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		part, err := reader.ReadSlice('\n')
+		if room := MaxLineLength - len(line); len(part) > room {
+			part = part[:room]
+		}
+		line = append(line, part...)
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if errors.Is(err, io.EOF) && len(line) > 0 {
+			err = nil
+		}
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		return string(line), err
+	}
+}
+
+// opens a file and positions a reader at startLine (extending the index as needed)
+func openAtLine(ctx context.Context, pathStr string, startLine int) (*os.File, *bufio.Reader, *lineIndex, error) {
+	path, err := wavebase.ExpandHomeDir(pathStr)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	path = filepath.Clean(path)
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("cannot open file %q: %w", pathStr, err)
+	}
+	finfo, err := fd.Stat()
+	if err != nil || finfo.IsDir() {
+		fd.Close()
+		return nil, nil, nil, fmt.Errorf("%q is not a file", pathStr)
+	}
+	index := getLineIndex(path, finfo)
+	index.Lock.Lock()
+	defer index.Lock.Unlock()
+	if err := index.extendTo(ctx, fd, startLine); err != nil {
+		fd.Close()
+		return nil, nil, nil, err
+	}
+	index.startIndexing()
+	offset, offsetLine := index.seekLine(startLine)
+	reader := bufio.NewReaderSize(io.NewSectionReader(fd, offset, 1<<62), LineScanBufSize)
+	for line := offsetLine; line < startLine; line++ {
+		if _, err := readLine(reader); err != nil {
+			break
+		}
+	}
+	return fd, reader, index, nil
+}
+
+func (impl *ServerImpl) RemoteReadLinesCommand(ctx context.Context, data wshrpc.CommandRemoteReadLinesData) (*wshrpc.RemoteReadLinesRtnData, error) {
+	if data.StartLine < 0 {
+		return nil, fmt.Errorf("invalid start line %d", data.StartLine)
+	}
+	numLines := min(data.NumLines, MaxReadLines)
+	if numLines <= 0 {
+		numLines = MaxReadLines
+	}
+	fd, reader, index, err := openAtLine(ctx, data.Path, data.StartLine)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	rtn := &wshrpc.RemoteReadLinesRtnData{StartLine: data.StartLine, Lines: []string{}}
+	for len(rtn.Lines) < numLines {
+		line, err := readLine(reader)
+		if errors.Is(err, io.EOF) {
+			rtn.EOF = true
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading %q: %w", data.Path, err)
+		}
+		rtn.Lines = append(rtn.Lines, line)
+	}
+	index.Lock.Lock()
+	defer index.Lock.Unlock()
+	rtn.FileSize = index.Size
+	rtn.TotalLines = -1
+	if index.Done {
+		rtn.TotalLines = index.TotalLines
+	}
+	rtn.EstTotalLines = max(index.estimateTotalLines(), data.StartLine+len(rtn.Lines))
+	return rtn, nil
+}
+
+func makeSearchRegexp(data wshrpc.CommandRemoteSearchFileData) (*regexp.Regexp, error) {
+	pattern := data.Query
+	if !data.Regexp {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if !data.CaseSensitive {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid search pattern: %w", err)
+	}
+	return re, nil
+}
+
+// returns the part of a long line around a match (cut at valid utf-8 boundaries)
+func searchMatchText(line string, matchStart int) (string, int) {
+	if len(line) <= MaxSearchMatchText {
+		return line, matchStart
+	}
+	start := max(matchStart-MaxSearchMatchText/4, 0)
+	for start > 0 && !utf8.RuneStart(line[start]) {
+		start--
+	}
+	end := min(start+MaxSearchMatchText, len(line))
+	for end < len(line) && !utf8.RuneStart(line[end]) {
+		end--
+	}
+	return line[start:end], matchStart - start
+}
+
+// searches a file from StartLine, returning up to MaxResults matches.  long searches stop after a
+// time budget and return NextLine so the search can be continued (NextLine is -1 at the end).
+func (impl *ServerImpl) RemoteSearchFileCommand(ctx context.Context, data wshrpc.CommandRemoteSearchFileData) (*wshrpc.RemoteSearchFileRtnData, error) {
+	if data.Query == "" {
+		return nil, fmt.Errorf("no search query")
+	}
+	re, err := makeSearchRegexp(data)
+	if err != nil {
+		return nil, err
+	}
+	maxResults := min(data.MaxResults, MaxSearchResults)
+	if maxResults <= 0 {
+		maxResults = DefaultSearchResults
+	}
+	startLine := max(data.StartLine, 0)
+	fd, reader, _, err := openAtLine(ctx, data.Path, startLine)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	rtn := &wshrpc.RemoteSearchFileRtnData{Matches: []wshrpc.FileSearchMatch{}, NextLine: -1}
+	startTs := time.Now()
+	for lineNum := startLine; ; lineNum++ {
+		if len(rtn.Matches) >= maxResults || time.Since(startTs) > SearchTimeBudget || ctx.Err() != nil {
+			rtn.NextLine = lineNum
+			break
+		}
+		line, err := readLine(reader)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading %q: %w", data.Path, err)
+		}
+		loc := re.FindStringIndex(line)
+		if loc == nil {
+			continue
+		}
+		text, col := searchMatchText(line, loc[0])
+		rtn.Matches = append(rtn.Matches, wshrpc.FileSearchMatch{
+			Line: lineNum,
+			Col:  utf8.RuneCountInString(text[:col]),
+			Len:  utf8.RuneCountInString(line[loc[0]:loc[1]]),
+			Text: strings.ToValidUTF8(text, "�"),
+		})
+	}
+	return rtn, nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+func TestRemoteReadLines(t *testing.T) {
+	var lines []string
+	for i := 0; i < 2500; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	lines[1700] = "ERROR something failed"
+	filePath := filepath.Join(t.TempDir(), "test.log")
+	os.WriteFile(filePath, []byte(strings.Join(lines, "\n")), 0644) // no trailing newline
+	impl := &ServerImpl{}
+	ctx := context.Background()
+
+	rtn, err := impl.RemoteReadLinesCommand(ctx, wshrpc.CommandRemoteReadLinesData{Path: filePath, StartLine: 998, NumLines: 4})
+	if err != nil {
+		t.Fatalf("error reading lines: %v", err)
+	}
+	if strings.Join(rtn.Lines, ",") != "line 998,line 999,line 1000,line 1001" {
+		t.Errorf("bad lines: %v", rtn.Lines)
+	}
+	rtn, err = impl.RemoteReadLinesCommand(ctx, wshrpc.CommandRemoteReadLinesData{Path: filePath, StartLine: 2498, NumLines: 10})
+	if err != nil {
+		t.Fatalf("error reading lines: %v", err)
+	}
+	if strings.Join(rtn.Lines, ",") != "line 2498,line 2499" || !rtn.EOF || rtn.TotalLines != 2500 {
+		t.Errorf("bad last page: %v eof=%v total=%d", rtn.Lines, rtn.EOF, rtn.TotalLines)
+	}
+
+	// appending keeps the index (the partial last line is rescanned)
+	fd, _ := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0644)
+	fd.WriteString(" more\nline 2500\n")
+	fd.Close()
+	rtn, err = impl.RemoteReadLinesCommand(ctx, wshrpc.CommandRemoteReadLinesData{Path: filePath, StartLine: 2499, NumLines: 10})
+	if err != nil {
+		t.Fatalf("error reading lines: %v", err)
+	}
+	if strings.Join(rtn.Lines, ",") != "line 2499 more,line 2500" || rtn.TotalLines != 2501 {
+		t.Errorf("bad page after append: %v total=%d", rtn.Lines, rtn.TotalLines)
+	}
+
+	search, err := impl.RemoteSearchFileCommand(ctx, wshrpc.CommandRemoteSearchFileData{Path: filePath, Query: "error"})
+	if err != nil {
+		t.Fatalf("error searching: %v", err)
+	}
+	if len(search.Matches) != 1 || search.Matches[0].Line != 1700 || search.NextLine != -1 {
+		t.Errorf("bad search result: %+v", search)
+	}
+	search, err = impl.RemoteSearchFileCommand(ctx, wshrpc.CommandRemoteSearchFileData{Path: filePath, Query: `line 1\d{3}$`, Regexp: true, StartLine: 1500, MaxResults: 10})
+	if err != nil {
+		t.Fatalf("error searching: %v", err)
+	}
+	if len(search.Matches) != 10 || search.Matches[0].Line != 1500 || search.NextLine != 1510 {
+		t.Errorf("bad regexp search result: %+v", search)
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const DefaultDirListLimit = 1000
+const MaxDirListLimit = 10000
+
+// symlinks are resolved so links to directories can be browsed.  the entry keeps the link's
+// name and path, the other fields describe the target (or the link itself if it is broken).
+func dirEntryToFileInfo(dirPath string, entry fs.DirEntry) *wshrpc.FileInfo {
+	fullPath := filepath.Join(dirPath, entry.Name())
+	linkInfo, err := entry.Info()
+	if err != nil {
+		return nil
+	}
+	if linkInfo.Mode()&fs.ModeSymlink == 0 {
+		return statToFileInfo(fullPath, linkInfo, false)
+	}
+	var rtn *wshrpc.FileInfo
+	targetInfo, err := os.Stat(fullPath)
+	if err != nil {
+		rtn = statToFileInfo(fullPath, linkInfo, false)
+		rtn.BrokenLink = true
+	} else {
+		rtn = statToFileInfo(fullPath, targetInfo, false)
+	}
+	rtn.IsSymlink = true
+	rtn.LinkTarget, _ = os.Readlink(fullPath)
+	return rtn
+}
+
+// directories first, then by the sort field (ties are broken by name)
+func SortFileInfos(fileInfos []*wshrpc.FileInfo, opts wshrpc.FileListOpts) {
+	sort.SliceStable(fileInfos, func(i, j int) bool {
+		a, b := fileInfos[i], fileInfos[j]
+		if a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+		var cmp int
+		switch opts.SortBy {
+		case wshrpc.FileListSort_Size:
+			cmp = compareInt64(a.Size, b.Size)
+		case wshrpc.FileListSort_ModTime:
+			cmp = compareInt64(a.ModTime, b.ModTime)
+		}
+		if cmp == 0 {
+			cmp = strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+		}
+		if cmp == 0 {
+			cmp = strings.Compare(a.Name, b.Name)
+		}
+		if opts.SortDesc {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+}
+
+func compareInt64(a int64, b int64) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+func (impl *ServerImpl) RemoteListEntriesCommand(ctx context.Context, data wshrpc.CommandRemoteListEntriesData) (*wshrpc.RemoteListEntriesRtnData, error) {
+	var opts wshrpc.FileListOpts
+	if data.Opts != nil {
+		opts = *data.Opts
+	}
+	if opts.Offset < 0 {
+		return nil, fmt.Errorf("invalid offset %d", opts.Offset)
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultDirListLimit
+	}
+	opts.Limit = min(opts.Limit, MaxDirListLimit)
+	path, err := wavebase.ExpandHomeDir(data.Path)
+	if err != nil {
+		return nil, err
+	}
+	path = filepath.Clean(path)
+	if archivePath, innerPath, ok := splitArchivePath(path); ok {
+		return impl.listArchiveEntries(ctx, archivePath, innerPath, opts)
+	}
+	dirInfo, err := impl.fileInfoInternal(path, true)
+	if err != nil {
+		return nil, err
+	}
+	if dirInfo.NotFound {
+		return nil, fmt.Errorf("directory %q not found", data.Path)
+	}
+	if !dirInfo.IsDir {
+		return nil, fmt.Errorf("%q is not a directory", data.Path)
+	}
+	dirEntries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open dir %q: %w", data.Path, err)
+	}
+	fileInfos := make([]*wshrpc.FileInfo, 0, len(dirEntries))
+	for _, entry := range dirEntries {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if !opts.All && strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if finfo := dirEntryToFileInfo(path, entry); finfo != nil {
+			fileInfos = append(fileInfos, finfo)
+		}
+	}
+	var parentInfo *wshrpc.FileInfo
+	if parent := filepath.Dir(path); parent != path {
+		parentInfo, _ = impl.fileInfoInternal(parent, false)
+	}
+	return makeListEntriesRtn(dirInfo, parentInfo, fileInfos, opts), nil
+}
+
+// sorts and pages the (already filtered) entries of a directory
+func makeListEntriesRtn(dirInfo *wshrpc.FileInfo, parentInfo *wshrpc.FileInfo, fileInfos []*wshrpc.FileInfo, opts wshrpc.FileListOpts) *wshrpc.RemoteListEntriesRtnData {
+	SortFileInfos(fileInfos, opts)
+	rtn := &wshrpc.RemoteListEntriesRtnData{
+		Dir:     dirInfo,
+		Entries: []*wshrpc.FileInfo{},
+		Total:   len(fileInfos),
+	}
+	if opts.Offset < len(fileInfos) {
+		endIdx := min(opts.Offset+opts.Limit, len(fileInfos))
+		rtn.Entries = fileInfos[opts.Offset:endIdx]
+		rtn.HasMore = endIdx < len(fileInfos)
+	}
+	if parentInfo != nil {
+		parentInfo.Name = ".."
+		parentInfo.Size = -1
+		rtn.Parent = parentInfo
+	}
+	return rtn
+}
@@ -0,0 +1,73 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+func TestRemoteListEntries(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "zdir"), 0755)
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0644)
+	os.WriteFile(filepath.Join(dir, "b.txt"), []byte("hi"), 0644)
+	os.WriteFile(filepath.Join(dir, ".hidden"), []byte("x"), 0644)
+	os.Symlink(filepath.Join(dir, "zdir"), filepath.Join(dir, "dirlink"))
+	os.Symlink(filepath.Join(dir, "missing"), filepath.Join(dir, "broken"))
+	impl := &ServerImpl{}
+	ctx := context.Background()
+
+	rtn, err := impl.RemoteListEntriesCommand(ctx, wshrpc.CommandRemoteListEntriesData{Path: dir})
+	if err != nil {
+		t.Fatalf("error listing: %v", err)
+	}
+	var names []string
+	for _, entry := range rtn.Entries {
+		names = append(names, entry.Name)
+	}
+	// directories (including the link to one) first, hidden files skipped
+	expected := []string{"dirlink", "zdir", "a.txt", "b.txt", "broken"}
+	if len(names) != len(expected) || rtn.Total != len(expected) {
+		t.Fatalf("got entries %v, expected %v", names, expected)
+	}
+	for idx := range expected {
+		if names[idx] != expected[idx] {
+			t.Fatalf("got entries %v, expected %v", names, expected)
+		}
+	}
+	if !rtn.Entries[0].IsSymlink || !rtn.Entries[0].IsDir {
+		t.Errorf("dirlink should be a symlink to a directory: %+v", rtn.Entries[0])
+	}
+	if !rtn.Entries[4].BrokenLink {
+		t.Errorf("broken should be a broken link: %+v", rtn.Entries[4])
+	}
+	if rtn.Parent == nil || rtn.Parent.Name != ".." {
+		t.Errorf("expected a parent entry, got %+v", rtn.Parent)
+	}
+
+	rtn, err = impl.RemoteListEntriesCommand(ctx, wshrpc.CommandRemoteListEntriesData{
+		Path: dir,
+		Opts: &wshrpc.FileListOpts{All: true, SortBy: wshrpc.FileListSort_Size, SortDesc: true, Offset: 2, Limit: 2},
+	})
+	if err != nil {
+		t.Fatalf("error listing: %v", err)
+	}
+	if rtn.Total != 6 || !rtn.HasMore || len(rtn.Entries) != 2 {
+		t.Fatalf("bad page: total=%d hasmore=%v entries=%d", rtn.Total, rtn.HasMore, len(rtn.Entries))
+	}
+	// the broken link's size is the length of its target path
+	if rtn.Entries[0].Name != "broken" || rtn.Entries[1].Name != "a.txt" {
+		t.Errorf("expected broken, a.txt (largest files first), got %s, %s", rtn.Entries[0].Name, rtn.Entries[1].Name)
+	}
+
+	_, err = impl.RemoteListEntriesCommand(ctx, wshrpc.CommandRemoteListEntriesData{Path: filepath.Join(dir, "a.txt")})
+	if err == nil {
+		t.Errorf("expected an error listing a file")
+	}
+}
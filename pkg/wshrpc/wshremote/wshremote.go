@@ -13,6 +13,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 
 	"github.com/wavetermdev/waveterm/pkg/util/utilfn"
@@ -44,6 +45,16 @@ func (impl *ServerImpl) MessageCommand(ctx context.Context, data wshrpc.CommandM
 	return nil
 }
 
+// answers the version handshake of the backend (a helper that is not its version gets replaced)
+func (impl *ServerImpl) RemoteGetInfoCommand(ctx context.Context) (wshrpc.RemoteInfo, error) {
+	return wshrpc.RemoteInfo{
+		WshVersion: wavebase.WaveVersion,
+		ClientOs:   runtime.GOOS,
+		ClientArch: runtime.GOARCH,
+		Pid:        os.Getpid(),
+	}, nil
+}
+
 func respErr(err error) wshrpc.RespOrErrorUnion[wshrpc.CommandRemoteStreamFileRtnData] {
 	return wshrpc.RespOrErrorUnion[wshrpc.CommandRemoteStreamFileRtnData]{Error: err}
 }
@@ -175,9 +186,14 @@ func (impl *ServerImpl) remoteStreamFileInternal(ctx context.Context, data wshrp
 	if finfo.NotFound {
 		return nil
 	}
-	if finfo.Size > MaxFileSize {
+	if finfo.Size > MaxFileSize && byteRange.All {
 		return fmt.Errorf("file %q is too large to read, use /wave/stream-file", path)
 	}
+	if _, statErr := os.Stat(path); statErr != nil {
+		if archivePath, innerPath, ok := splitArchivePath(path); ok && innerPath != "" {
+			return impl.remoteStreamArchiveEntry(ctx, archivePath, innerPath, finfo, dataCallback)
+		}
+	}
 	if finfo.IsDir {
 		return impl.remoteStreamFileDir(ctx, path, byteRange, dataCallback)
 	} else {
@@ -264,6 +280,11 @@ func computeDirPart(path string, isDir bool) string {
 func (*ServerImpl) fileInfoInternal(path string, extended bool) (*wshrpc.FileInfo, error) {
 	cleanedPath := filepath.Clean(wavebase.ExpandHomeDirSafe(path))
 	finfo, err := os.Stat(cleanedPath)
+	if err != nil {
+		if archiveInfo := archivePathInfo(context.Background(), cleanedPath); archiveInfo != nil {
+			return archiveInfo, nil
+		}
+	}
 	if os.IsNotExist(err) {
 		return &wshrpc.FileInfo{
 			Path:     wavebase.ReplaceHomeDir(path),
@@ -365,7 +386,12 @@ func (*ServerImpl) RemoteWriteFileCommand(ctx context.Context, data wshrpc.Comma
 	if err != nil {
 		return fmt.Errorf("cannot decode base64 data: %w", err)
 	}
-	err = os.WriteFile(path, dataBytes[:n], createMode)
+	if data.Checksum != "" {
+		if err := checkFileChecksum(path, data.Checksum); err != nil {
+			return err
+		}
+	}
+	err = atomicWriteFile(path, dataBytes[:n], createMode)
 	if err != nil {
 		return fmt.Errorf("cannot write file %q: %w", path, err)
 	}
@@ -73,6 +73,12 @@ const (
 	Command_GetVar               = "getvar"
 	Command_SetVar               = "setvar"
 	Command_RemoteMkdir          = "remotemkdir"
+	Command_RemoteListEntries    = "remotelistentries"
+	Command_RemoteArchiveExtract = "remotearchiveextract"
+	Command_RemoteReadLines      = "remotereadlines"
+	Command_RemoteSearchFile     = "remotesearchfile"
+	Command_RemoteWatchFiles     = "remotewatchfiles"
+	Command_RemoteGetInfo        = "remotegetinfo"
 
 	Command_ConnStatus       = "connstatus"
 	Command_WslStatus        = "wslstatus"
@@ -82,22 +88,101 @@ const (
 	Command_ConnDisconnect   = "conndisconnect"
 	Command_ConnList         = "connlist"
 	Command_WslList          = "wsllist"
+	Command_TailscalePeers   = "tailscalepeers"
+	Command_DiscoverHosts    = "discoverhosts"
+	Command_ContainerList    = "containerlist"
+	Command_VagrantList      = "vagrantlist"
 	Command_WslDefaultDistro = "wsldefaultdistro"
 	Command_DismissWshFail   = "dismisswshfail"
+	Command_WshHelperStatus  = "wshhelperstatus"
 
-	Command_WorkspaceList = "workspacelist"
+	Command_ListRememberedAnswers  = "listrememberedanswers"
+	Command_ClearRememberedAnswers = "clearrememberedanswers"
+	Command_KeychainList           = "keychainlist"
+	Command_KeychainDelete         = "keychaindelete"
+	Command_KeychainSetTotp        = "keychainsettotp"
+	Command_PassphraseCacheFlush   = "passphrasecacheflush"
+
+	Command_WorkspaceList          = "workspacelist"
+	Command_WorkspaceHandoffExport = "workspacehandoffexport"
+	Command_WorkspaceHandoffImport = "workspacehandoffimport"
 
 	Command_WebSelector      = "webselector"
 	Command_Notify           = "notify"
 	Command_FocusWindow      = "focuswindow"
 	Command_GetUpdateChannel = "getupdatechannel"
+	Command_UpdaterStatus    = "updaterstatus"
+	Command_UpdaterCheck     = "updatercheck"
+	Command_UpdaterInstall   = "updaterinstall"
+	Command_GetBusyBlocks    = "getbusyblocks"
+
+	Command_ClipboardRead     = "clipboardread"
+	Command_ClipboardWrite    = "clipboardwrite"
+	Command_SysClipboardRead  = "sysclipboardread"
+	Command_SysClipboardWrite = "sysclipboardwrite"
+
+	Command_SetLogLevel  = "setloglevel"
+	Command_GetLogLevels = "getloglevels"
+	Command_CollectLogs  = "collectlogs"
+
+	Command_PrepareDiagBundle = "preparediagbundle"
+	Command_GetDiagBundleItem = "getdiagbundleitem"
+	Command_WriteDiagBundle   = "writediagbundle"
+
+	Command_WaveStatsSubscribe   = "wavestatssubscribe"
+	Command_WaveStatsUnsubscribe = "wavestatsunsubscribe"
+	Command_GetWaveStats         = "getwavestats"
+
+	Command_ConnDebugLog      = "conndebuglog"
+	Command_ConnListForwards  = "connlistforwards"
+	Command_ConnAddForward    = "connaddforward"
+	Command_ConnRemoveForward = "connremoveforward"
+	Command_ConnSocksProxy    = "connsocksproxy"
+	Command_ConnStats         = "connstats"
+	Command_ConnBroadcast     = "connbroadcast"
+	Command_ConnExec          = "connexec"
+	Command_ConnMount         = "connmount"
+	Command_ConnUnmount       = "connunmount"
+	Command_ConnListMounts    = "connlistmounts"
+	Command_ConnCopyFile      = "conncopyfile"
+	Command_ConnSync          = "connsync"
+	Command_ConnImport        = "connimport"
+	Command_ConnListInfo      = "connlistinfo"
+	Command_KnownHostsList    = "knownhostslist"
+	Command_KnownHostsVerify  = "knownhostsverify"
+	Command_KnownHostsDelete  = "knownhostsdelete"
+
+	Command_TelemetryPreview = "telemetrypreview"
+	Command_DebugPprofInfo   = "debugpprofinfo"
+	Command_AuditEvents      = "auditevents"
+	Command_UsageStats       = "usagestats"
+
+	Command_RecordingStart  = "recordingstart"
+	Command_RecordingStop   = "recordingstop"
+	Command_RecordingList   = "recordinglist"
+	Command_RecordingExport = "recordingexport"
 
 	Command_VDomCreateContext   = "vdomcreatecontext"
 	Command_VDomAsyncInitiation = "vdomasyncinitiation"
 	Command_VDomRender          = "vdomrender"
 	Command_VDomUrlRequest      = "vdomurlrequest"
 
+	Command_AiListModels  = "ailistmodels"
+	Command_AiListPresets = "ailistpresets"
+	Command_AiSetPreset   = "aisetpreset"
+	Command_AiTermContext = "aitermcontext"
+	Command_AiSuggestCmd  = "aisuggestcmd"
+	Command_AiAcceptCmd   = "aiacceptcmd"
+	Command_AiChatList    = "aichatlist"
+	Command_AiChatExport  = "aichatexport"
+	Command_AiChatResume  = "aichatresume"
+	Command_AiChatRename  = "aichatrename"
+	Command_AiUsage       = "aiusage"
 	Command_AiSendMessage = "aisendmessage"
+	Command_AiReloadChat  = "aireloadchat"
+
+	Command_PluginList    = "pluginlist"
+	Command_PluginControl = "plugincontrol"
 )
 
 type RespOrErrorUnion[T any] struct {
@@ -150,6 +235,52 @@ type WshRpcInterface interface {
 	GetVarCommand(ctx context.Context, data CommandVarData) (*CommandVarResponseData, error)
 	SetVarCommand(ctx context.Context, data CommandVarData) error
 	PathCommand(ctx context.Context, data PathCommandData) (string, error)
+	SetLogLevelCommand(ctx context.Context, data CommandSetLogLevelData) error
+	GetLogLevelsCommand(ctx context.Context) (map[string]string, error)
+	CollectLogsCommand(ctx context.Context) (string, error)
+	PrepareDiagBundleCommand(ctx context.Context) (*DiagBundleInfo, error)
+	GetDiagBundleItemCommand(ctx context.Context, data CommandDiagBundleItemData) (string, error)
+	WriteDiagBundleCommand(ctx context.Context, data CommandWriteDiagBundleData) (string, error)
+	WaveStatsSubscribeCommand(ctx context.Context, blockId string) error
+	WaveStatsUnsubscribeCommand(ctx context.Context, blockId string) error
+	GetWaveStatsCommand(ctx context.Context) (*TimeSeriesData, error)
+	ConnDebugLogCommand(ctx context.Context, data CommandConnDebugLogData) (string, error)
+	ConnListForwardsCommand(ctx context.Context, connName string) ([]PortForwardInfo, error)
+	ConnAddForwardCommand(ctx context.Context, data CommandConnForwardData) (*PortForwardInfo, error)
+	ConnRemoveForwardCommand(ctx context.Context, data CommandConnForwardData) error
+	ConnSocksProxyCommand(ctx context.Context, connName string) (string, error)
+	ConnStatsCommand(ctx context.Context, connName string) (*ConnStatsInfo, error)
+	ConnBroadcastCommand(ctx context.Context, data CommandConnBroadcastData) chan RespOrErrorUnion[ConnBroadcastEvent]
+	ConnExecCommand(ctx context.Context, data CommandConnExecData) chan RespOrErrorUnion[ConnExecEvent]
+	ConnSyncCommand(ctx context.Context, data CommandConnSyncData) chan RespOrErrorUnion[ConnSyncProgress]
+	ConnMountCommand(ctx context.Context, data CommandConnMountData) (*MountInfo, error)
+	ConnUnmountCommand(ctx context.Context, name string) error
+	ConnListMountsCommand(ctx context.Context) ([]MountInfo, error)
+	ConnCopyFileCommand(ctx context.Context, data CommandConnCopyFileData) chan RespOrErrorUnion[ConnCopyFileProgress]
+	ConnImportCommand(ctx context.Context, data CommandConnImportData) (*ConnImportResult, error)
+	ConnListInfoCommand(ctx context.Context, data ConnListFilter) ([]ConnListEntry, error)
+	KnownHostsListCommand(ctx context.Context, data CommandKnownHostsData) ([]KnownHostEntry, error)
+	KnownHostsVerifyCommand(ctx context.Context, data CommandKnownHostsData) (*KnownHostsVerifyResult, error)
+	KnownHostsDeleteCommand(ctx context.Context, data CommandKnownHostsData) (int, error)
+	TelemetryPreviewCommand(ctx context.Context) (*TelemetryPreviewData, error)
+	DebugPprofInfoCommand(ctx context.Context) (*DebugPprofInfo, error)
+	AuditEventsCommand(ctx context.Context, data CommandAuditEventsData) ([]AuditEvent, error)
+	AiListModelsCommand(ctx context.Context, data CommandAiListModelsData) ([]string, error)
+	AiListPresetsCommand(ctx context.Context) ([]AiPresetInfo, error)
+	AiSetPresetCommand(ctx context.Context, data CommandAiSetPresetData) error
+	AiTermContextCommand(ctx context.Context, data CommandAiTermContextData) (string, error)
+	AiSuggestCmdCommand(ctx context.Context, data CommandAiSuggestCmdData) (*AiCmdSuggestion, error)
+	AiAcceptCmdCommand(ctx context.Context, data CommandAiAcceptCmdData) error
+	AiChatListCommand(ctx context.Context, data CommandAiChatListData) ([]AiChatInfo, error)
+	AiChatExportCommand(ctx context.Context, data CommandAiChatData) (string, error)
+	AiChatResumeCommand(ctx context.Context, data CommandAiChatData) error
+	AiChatRenameCommand(ctx context.Context, data CommandAiChatData) error
+	AiUsageCommand(ctx context.Context) (*AiUsageSummary, error)
+	UsageStatsCommand(ctx context.Context, data CommandUsageStatsData) (*UsageStatsSummary, error)
+	RecordingStartCommand(ctx context.Context, data CommandRecordingStartData) (*RecordingInfo, error)
+	RecordingStopCommand(ctx context.Context, blockId string) (*RecordingInfo, error)
+	RecordingListCommand(ctx context.Context, blockId string) ([]RecordingInfo, error)
+	RecordingExportCommand(ctx context.Context, data CommandRecordingExportData) (string, error)
 
 	// connection functions
 	ConnStatusCommand(ctx context.Context) ([]ConnStatus, error)
@@ -160,8 +291,19 @@ type WshRpcInterface interface {
 	ConnDisconnectCommand(ctx context.Context, connName string) error
 	ConnListCommand(ctx context.Context) ([]string, error)
 	WslListCommand(ctx context.Context) ([]string, error)
+	TailscalePeersCommand(ctx context.Context) ([]TailscalePeer, error)
+	DiscoverHostsCommand(ctx context.Context, data CommandDiscoverHostsData) ([]DiscoveredHost, error)
+	ContainerListCommand(ctx context.Context) ([]ContainerInfo, error)
+	VagrantListCommand(ctx context.Context) ([]VagrantMachine, error)
 	WslDefaultDistroCommand(ctx context.Context) (string, error)
 	DismissWshFailCommand(ctx context.Context, connName string) error
+	WshHelperStatusCommand(ctx context.Context) ([]WshHelperStatus, error)
+	ListRememberedAnswersCommand(ctx context.Context, connName string) ([]RememberedAnswer, error)
+	ClearRememberedAnswersCommand(ctx context.Context, data CommandClearRememberedAnswersData) error
+	KeychainListCommand(ctx context.Context) ([]StoredSecret, error)
+	KeychainDeleteCommand(ctx context.Context, data CommandKeychainDeleteData) error
+	KeychainSetTotpCommand(ctx context.Context, data CommandKeychainSetTotpData) error
+	PassphraseCacheFlushCommand(ctx context.Context) (int, error)
 
 	// eventrecv is special, it's handled internally by WshRpc with EventListener
 	EventRecvCommand(ctx context.Context, data wps.WaveEvent) error
@@ -175,22 +317,47 @@ type WshRpcInterface interface {
 	RemoteWriteFileCommand(ctx context.Context, data CommandRemoteWriteFileData) error
 	RemoteFileJoinCommand(ctx context.Context, paths []string) (*FileInfo, error)
 	RemoteMkdirCommand(ctx context.Context, path string) error
+	RemoteListEntriesCommand(ctx context.Context, data CommandRemoteListEntriesData) (*RemoteListEntriesRtnData, error)
+	RemoteArchiveExtractCommand(ctx context.Context, data CommandRemoteArchiveExtractData) chan RespOrErrorUnion[ArchiveExtractProgress]
+	RemoteReadLinesCommand(ctx context.Context, data CommandRemoteReadLinesData) (*RemoteReadLinesRtnData, error)
+	RemoteSearchFileCommand(ctx context.Context, data CommandRemoteSearchFileData) (*RemoteSearchFileRtnData, error)
+	RemoteWatchFilesCommand(ctx context.Context, data CommandRemoteWatchFilesData) error
 	RemoteStreamCpuDataCommand(ctx context.Context) chan RespOrErrorUnion[TimeSeriesData]
+	RemoteGetInfoCommand(ctx context.Context) (RemoteInfo, error)
 
 	// emain
 	WebSelectorCommand(ctx context.Context, data CommandWebSelectorData) ([]string, error)
 	NotifyCommand(ctx context.Context, notificationOptions WaveNotificationOptions) error
 	FocusWindowCommand(ctx context.Context, windowId string) error
+	SysClipboardReadCommand(ctx context.Context) (string, error)
+	SysClipboardWriteCommand(ctx context.Context, data CommandClipboardData) error
+
+	// clipboard (for wsh, checks the clipboard policy and asks remote callers)
+	ClipboardReadCommand(ctx context.Context) (string, error)
+	ClipboardWriteCommand(ctx context.Context, data CommandClipboardData) error
 
 	WorkspaceListCommand(ctx context.Context) ([]WorkspaceInfoData, error)
+	WorkspaceHandoffExportCommand(ctx context.Context, workspaceId string) (*WorkspaceHandoffData, error)
+	WorkspaceHandoffImportCommand(ctx context.Context, data CommandWorkspaceHandoffImportData) (string, error)
 	GetUpdateChannelCommand(ctx context.Context) (string, error)
 
+	// updater (handled by electron, except getbusyblocks)
+	UpdaterStatusCommand(ctx context.Context) (*UpdaterStatusData, error)
+	UpdaterCheckCommand(ctx context.Context) error
+	UpdaterInstallCommand(ctx context.Context, data CommandUpdaterInstallData) error
+	GetBusyBlocksCommand(ctx context.Context) ([]string, error)
+
 	// terminal
 	VDomCreateContextCommand(ctx context.Context, data vdom.VDomCreateContext) (*waveobj.ORef, error)
 	VDomAsyncInitiationCommand(ctx context.Context, data vdom.VDomAsyncInitiationRequest) error
 
 	// ai
 	AiSendMessageCommand(ctx context.Context, data AiMessageData) error
+	AiReloadChatCommand(ctx context.Context) error
+
+	// plugins
+	PluginListCommand(ctx context.Context) ([]PluginInfo, error)
+	PluginControlCommand(ctx context.Context, data CommandPluginControlData) error
 
 	// proc
 	VDomRenderCommand(ctx context.Context, data vdom.VDomFrontendUpdate) chan RespOrErrorUnion[*vdom.VDomBackendUpdate]
@@ -381,24 +548,150 @@ type OpenAiStreamRequest struct {
 	ClientId string                    `json:"clientid,omitempty"`
 	Opts     *OpenAIOptsType           `json:"opts"`
 	Prompt   []OpenAIPromptMessageType `json:"prompt"`
+	Tools    []AiToolDef               `json:"tools,omitempty"` // filled in by the backend (when ai:tools is set)
 }
 
 type OpenAIPromptMessageType struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-	Name    string `json:"name,omitempty"`
+	Role       string       `json:"role"`
+	Content    string       `json:"content"`
+	Name       string       `json:"name,omitempty"`
+	ToolCalls  []AiToolCall `json:"toolcalls,omitempty"`  // assistant messages that call tools
+	ToolCallId string       `json:"toolcallid,omitempty"` // "tool" messages (the result of a tool call)
+	Ts         int64        `json:"ts,omitempty"`         // when the message was added to the chat (not sent to the model)
+}
+
+type AiToolDef struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Parameters  map[string]any `json:"parameters"` // json schema for the input
+}
+
+type AiToolCall struct {
+	Id    string `json:"id"`
+	Name  string `json:"name"`
+	Input string `json:"input"` // json encoded arguments
+}
+
+// lists the models of an openai-compatible server, from a preset (or the ai settings), or explicit opts
+type CommandAiListModelsData struct {
+	Preset string          `json:"preset,omitempty"`
+	Opts   *OpenAIOptsType `json:"opts,omitempty"`
+}
+
+type AiPresetInfo struct {
+	Key          string   `json:"key"`
+	Name         string   `json:"name,omitempty"`
+	Order        float64  `json:"order,omitempty"`
+	APIType      string   `json:"apitype,omitempty"`
+	BaseURL      string   `json:"baseurl,omitempty"`
+	Model        string   `json:"model,omitempty"`
+	Temperature  *float64 `json:"temperature,omitempty"`
+	SystemPrompt bool     `json:"systemprompt,omitempty"` // true if the preset has a system prompt
+	IsDefault    bool     `json:"isdefault,omitempty"`
+}
+
+// switches an ai block to a preset (blockid is required)
+type CommandAiSetPresetData struct {
+	BlockId string `json:"blockid"`
+	Preset  string `json:"preset"`
+}
+
+// terminal context (from shell integration) to attach to an ai prompt.
+// parts are "lastcmd", "cwd", and "system" (all parts if empty)
+type CommandAiTermContextData struct {
+	BlockId string   `json:"blockid"`
+	Parts   []string `json:"parts,omitempty"`
+}
+
+// asks the ai for a shell command for a terminal block (the block's terminal context is
+// attached).  an empty prompt asks for a fix for the last command.
+type CommandAiSuggestCmdData struct {
+	BlockId string `json:"blockid"`
+	Prompt  string `json:"prompt,omitempty"`
+	Preset  string `json:"preset,omitempty"`
+}
+
+type AiCmdSuggestion struct {
+	BlockId     string `json:"blockid"`
+	Command     string `json:"command"`
+	Explanation string `json:"explanation,omitempty"`
+}
+
+// inserts a command into a terminal block's input (it is never executed).
+// atnextprompt waits for the running command (e.g. wsh itself) to finish first.
+type CommandAiAcceptCmdData struct {
+	BlockId      string `json:"blockid"`
+	Command      string `json:"command"`
+	AtNextPrompt bool   `json:"atnextprompt,omitempty"`
+}
+
+// blockid is optional for list (searches every ai block).  chatid is "current" for the
+// block's active chat, otherwise the id (or a unique prefix) of a saved chat.
+type CommandAiChatListData struct {
+	BlockId string `json:"blockid,omitempty"`
+	Search  string `json:"search,omitempty"`
+}
+
+type CommandAiChatData struct {
+	BlockId string `json:"blockid,omitempty"`
+	ChatId  string `json:"chatid"`
+	Title   string `json:"title,omitempty"`
+}
+
+type AiChatInfo struct {
+	BlockId     string `json:"blockid"`
+	ChatId      string `json:"chatid"`
+	Title       string `json:"title"`
+	Current     bool   `json:"current,omitempty"`
+	CreatedTs   int64  `json:"createdts"`
+	UpdatedTs   int64  `json:"updatedts"`
+	NumMessages int    `json:"nummessages"`
+	Match       string `json:"match,omitempty"` // snippet of the first search match
+}
+
+// token usage for one provider/profile (profile is the preset, or the model if no preset was used)
+type AiUsageEntry struct {
+	Provider         string `json:"provider"`
+	Profile          string `json:"profile"`
+	Requests         int64  `json:"requests"`
+	PromptTokens     int64  `json:"prompttokens"`
+	CompletionTokens int64  `json:"completiontokens"`
+	DailyLimit       int64  `json:"dailylimit,omitempty"` // limits set in the profile's preset
+	MonthlyLimit     int64  `json:"monthlylimit,omitempty"`
+}
+
+type AiUsageSummary struct {
+	Day          string         `json:"day"`
+	MonthStart   string         `json:"monthstart"`
+	DayTokens    int64          `json:"daytokens"`
+	MonthTokens  int64          `json:"monthtokens"`
+	DailyLimit   int64          `json:"dailylimit,omitempty"`
+	MonthlyLimit int64          `json:"monthlylimit,omitempty"`
+	LimitAction  string         `json:"limitaction"`
+	Today        []AiUsageEntry `json:"today"`
+	Month        []AiUsageEntry `json:"month"`
 }
 
 type OpenAIOptsType struct {
-	Model      string `json:"model"`
-	APIType    string `json:"apitype,omitempty"`
-	APIToken   string `json:"apitoken"`
-	OrgID      string `json:"orgid,omitempty"`
-	APIVersion string `json:"apiversion,omitempty"`
-	BaseURL    string `json:"baseurl,omitempty"`
-	MaxTokens  int    `json:"maxtokens,omitempty"`
-	MaxChoices int    `json:"maxchoices,omitempty"`
-	TimeoutMs  int    `json:"timeoutms,omitempty"`
+	Model           string            `json:"model"`
+	APIType         string            `json:"apitype,omitempty"`
+	APIToken        string            `json:"apitoken"`
+	OrgID           string            `json:"orgid,omitempty"`
+	APIVersion      string            `json:"apiversion,omitempty"`
+	BaseURL         string            `json:"baseurl,omitempty"`
+	MaxTokens       int               `json:"maxtokens,omitempty"`
+	MaxChoices      int               `json:"maxchoices,omitempty"`
+	TimeoutMs       int               `json:"timeoutms,omitempty"`
+	Temperature     *float64          `json:"temperature,omitempty"`
+	SystemPrompt    string            `json:"systemprompt,omitempty"`
+	Tools           bool              `json:"tools,omitempty"`
+	Preset          string            `json:"preset,omitempty"`          // used to track token usage per profile
+	Headers         map[string]string `json:"headers,omitempty"`         // extra http headers (e.g. for api gateways)
+	AzureDeployment string            `json:"azuredeployment,omitempty"` // azure deployment name (defaults to the model name)
+	TlsSkipVerify   bool              `json:"tlsskipverify,omitempty"`
+	TlsCaCert       string            `json:"tlscacert,omitempty"`     // path to a pem file with extra ca certs
+	TlsClientCert   string            `json:"tlsclientcert,omitempty"` // path to a pem client certificate (mTLS)
+	TlsClientKey    string            `json:"tlsclientkey,omitempty"`
 }
 
 type OpenAIPacketType struct {
@@ -410,6 +703,7 @@ type OpenAIPacketType struct {
 	Index        int              `json:"index,omitempty"`
 	Text         string           `json:"text,omitempty"`
 	Error        string           `json:"error,omitempty"`
+	ToolCalls    []AiToolCall     `json:"toolcalls,omitempty"` // sent once the tool calls are complete
 }
 
 type OpenAIUsageType struct {
@@ -429,19 +723,121 @@ type CpuDataType struct {
 }
 
 type FileInfo struct {
-	Path     string      `json:"path"` // cleaned path (may have "~")
-	Dir      string      `json:"dir"`  // returns the directory part of the path (if this is a a directory, it will be equal to Path).  "~" will be expanded, and separators will be normalized to "/"
-	Name     string      `json:"name"`
-	NotFound bool        `json:"notfound,omitempty"`
-	Size     int64       `json:"size"`
-	Mode     os.FileMode `json:"mode"`
-	ModeStr  string      `json:"modestr"`
-	ModTime  int64       `json:"modtime"`
-	IsDir    bool        `json:"isdir,omitempty"`
-	MimeType string      `json:"mimetype,omitempty"`
-	ReadOnly bool        `json:"readonly,omitempty"` // this is not set for fileinfo's returned from directory listings
+	Path       string      `json:"path"` // cleaned path (may have "~")
+	Dir        string      `json:"dir"`  // returns the directory part of the path (if this is a a directory, it will be equal to Path).  "~" will be expanded, and separators will be normalized to "/"
+	Name       string      `json:"name"`
+	NotFound   bool        `json:"notfound,omitempty"`
+	Size       int64       `json:"size"`
+	Mode       os.FileMode `json:"mode"`
+	ModeStr    string      `json:"modestr"`
+	ModTime    int64       `json:"modtime"`
+	IsDir      bool        `json:"isdir,omitempty"`
+	MimeType   string      `json:"mimetype,omitempty"`
+	ReadOnly   bool        `json:"readonly,omitempty"`  // this is not set for fileinfo's returned from directory listings
+	IsSymlink  bool        `json:"issymlink,omitempty"` // set in directory listings, the other fields describe the link target
+	LinkTarget string      `json:"linktarget,omitempty"`
+	BrokenLink bool        `json:"brokenlink,omitempty"`
+}
+
+const (
+	FileListSort_Name    = "name"
+	FileListSort_Size    = "size"
+	FileListSort_ModTime = "modtime"
+)
+
+type FileListOpts struct {
+	All      bool   `json:"all,omitempty"`    // include hidden (dot) files
+	SortBy   string `json:"sortby,omitempty"` // name (default), size, or modtime.  directories are always listed first
+	SortDesc bool   `json:"sortdesc,omitempty"`
+	Offset   int    `json:"offset,omitempty"`
+	Limit    int    `json:"limit,omitempty"`
+}
+
+type CommandRemoteListEntriesData struct {
+	Path string        `json:"path"`
+	Opts *FileListOpts `json:"opts,omitempty"`
+}
+
+type RemoteListEntriesRtnData struct {
+	Dir     *FileInfo   `json:"dir"`
+	Parent  *FileInfo   `json:"parent,omitempty"` // not set for the root directory
+	Entries []*FileInfo `json:"entries"`
+	Total   int         `json:"total"` // total number of entries (after filtering hidden files)
+	HasMore bool        `json:"hasmore,omitempty"`
+}
+
+type CommandRemoteArchiveExtractData struct {
+	Path      string `json:"path"`
+	DestPath  string `json:"destpath,omitempty"` // defaults to a directory next to the archive, named after it
+	Overwrite bool   `json:"overwrite,omitempty"`
+}
+
+type ArchiveExtractProgress struct {
+	DestPath   string `json:"destpath"`
+	Files      int    `json:"files"`
+	Bytes      int64  `json:"bytes"`      // bytes written
+	ReadBytes  int64  `json:"readbytes"`  // bytes of the archive processed so far
+	TotalBytes int64  `json:"totalbytes"` // size of the archive
+	Done       bool   `json:"done,omitempty"`
+}
+
+type CommandRemoteReadLinesData struct {
+	Path      string `json:"path"`
+	StartLine int    `json:"startline"` // 0-based
+	NumLines  int    `json:"numlines"`
+}
+
+type RemoteReadLinesRtnData struct {
+	StartLine     int      `json:"startline"`
+	Lines         []string `json:"lines"`
+	EOF           bool     `json:"eof,omitempty"`
+	FileSize      int64    `json:"filesize"`
+	TotalLines    int      `json:"totallines"`    // -1 until the file has been indexed
+	EstTotalLines int      `json:"esttotallines"` // estimated from the part of the file indexed so far
+}
+
+type CommandRemoteSearchFileData struct {
+	Path          string `json:"path"`
+	Query         string `json:"query"`
+	Regexp        bool   `json:"regexp,omitempty"`
+	CaseSensitive bool   `json:"casesensitive,omitempty"`
+	StartLine     int    `json:"startline,omitempty"`
+	MaxResults    int    `json:"maxresults,omitempty"`
+}
+
+type FileSearchMatch struct {
+	Line int    `json:"line"` // 0-based
+	Col  int    `json:"col"`  // position of the match in text (in characters)
+	Len  int    `json:"len"`
+	Text string `json:"text"` // the line (or the part of a long line around the match)
+}
+
+type RemoteSearchFileRtnData struct {
+	Matches  []FileSearchMatch `json:"matches"`
+	NextLine int               `json:"nextline"` // where to continue the search, -1 when the whole file was searched
+}
+
+// sets the paths watched for WatchId (replacing any earlier set, no paths stops the watch).  watches
+// expire unless they are renewed (by sending the command again) within a couple of minutes.
+type CommandRemoteWatchFilesData struct {
+	WatchId string   `json:"watchid"`
+	Paths   []string `json:"paths"`
+}
+
+// sent as a "filechange" event (scoped to the WatchId)
+type FileChangeEventData struct {
+	WatchId string `json:"watchid"`
+	Path    string `json:"path"`
+	Op      string `json:"op"` // FileChangeOp_*
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"modtime"`
 }
 
+const (
+	FileChangeOp_Change = "change"
+	FileChangeOp_Delete = "delete"
+)
+
 type CommandRemoteStreamFileData struct {
 	Path      string `json:"path"`
 	ByteRange string `json:"byterange,omitempty"`
@@ -456,14 +852,46 @@ type CommandRemoteWriteFileData struct {
 	Path       string      `json:"path"`
 	Data64     string      `json:"data64"`
 	CreateMode os.FileMode `json:"createmode,omitempty"`
+	Checksum   string      `json:"checksum,omitempty"` // sha256 of the contents being replaced, the write fails if the file has changed
 }
 
 type ConnKeywords struct {
-	ConnWshEnabled          *bool `json:"conn:wshenabled,omitempty"`
-	ConnAskBeforeWshInstall *bool `json:"conn:askbeforewshinstall,omitempty"`
-
-	DisplayHidden *bool   `json:"display:hidden,omitempty"`
-	DisplayOrder  float32 `json:"display:order,omitempty"`
+	ConnWshEnabled          *bool             `json:"conn:wshenabled,omitempty"`
+	ConnAskBeforeWshInstall *bool             `json:"conn:askbeforewshinstall,omitempty"`
+	ConnRememberedAnswers   map[string]string `json:"conn:rememberedanswers,omitempty"`
+	ConnDebugLog            *bool             `json:"conn:debuglog,omitempty"`
+	ConnMosh                bool              `json:"conn:mosh,omitempty"`
+	ConnMoshServer          string            `json:"conn:moshserver,omitempty"`
+	ConnMoshClient          string            `json:"conn:moshclient,omitempty"`
+	ConnTailscale           *bool             `json:"conn:tailscale,omitempty"`
+	ConnTotpPrompt          string            `json:"conn:totpprompt,omitempty"`
+
+	Ec2InstanceId string `json:"ec2:instanceid,omitempty"`
+	Ec2Region     string `json:"ec2:region,omitempty"`
+	Ec2Profile    string `json:"ec2:profile,omitempty"`
+
+	GcpIap       bool   `json:"gcp:iap,omitempty"`
+	GcpProject   string `json:"gcp:project,omitempty"`
+	GcpZone      string `json:"gcp:zone,omitempty"`
+	GcpInstance  string `json:"gcp:instance,omitempty"`
+	GcpInterface string `json:"gcp:interface,omitempty"`
+
+	AzureBastion       string `json:"azure:bastion,omitempty"`
+	AzureResourceGroup string `json:"azure:resourcegroup,omitempty"`
+	AzureSubscription  string `json:"azure:subscription,omitempty"`
+	AzureVmId          string `json:"azure:vmid,omitempty"`
+
+	DockerHost string `json:"docker:host,omitempty"`
+
+	WslUser string `json:"wsl:user,omitempty"`
+	WslCwd  string `json:"wsl:cwd,omitempty"`
+
+	DisplayHidden   *bool    `json:"display:hidden,omitempty"`
+	DisplayOrder    float32  `json:"display:order,omitempty"`
+	DisplayGroup    string   `json:"display:group,omitempty"`
+	DisplayTags     []string `json:"display:tags,omitempty"`
+	DisplayColor    string   `json:"display:color,omitempty"` // a css color for the connection's icon
+	DisplayFavorite bool     `json:"display:favorite,omitempty"`
 
 	TermClear      bool    `json:"term:*,omitempty"`
 	TermFontSize   float64 `json:"term:fontsize,omitempty"`
@@ -474,21 +902,423 @@ type ConnKeywords struct {
 	SshHostName                     string   `json:"ssh:hostname,omitempty"`
 	SshPort                         string   `json:"ssh:port,omitempty"`
 	SshIdentityFile                 []string `json:"ssh:identityfile,omitempty"`
+	SshCertificateFile              []string `json:"ssh:certificatefile,omitempty"`
 	SshBatchMode                    bool     `json:"ssh:batchmode,omitempty"`
+	SshControlPersist               string   `json:"ssh:controlpersist,omitempty"`
+	SshConnectTimeout               *int     `json:"ssh:connecttimeout,omitempty"`
+	SshConnectionAttempts           *int     `json:"ssh:connectionattempts,omitempty"`
+	SshAddressFamily                string   `json:"ssh:addressfamily,omitempty"`
 	SshPubkeyAuthentication         bool     `json:"ssh:pubkeyauthentication,omitempty"`
 	SshPasswordAuthentication       bool     `json:"ssh:passwordauthentication,omitempty"`
 	SshKbdInteractiveAuthentication bool     `json:"ssh:kbdinteractiveauthentication,omitempty"`
 	SshPreferredAuthentications     []string `json:"ssh:preferredauthentications,omitempty"`
 	SshAddKeysToAgent               bool     `json:"ssh:addkeystoagent,omitempty"`
+	SshIdentitiesOnly               bool     `json:"ssh:identitiesonly,omitempty"`
 	SshIdentityAgent                string   `json:"ssh:identityagent,omitempty"`
+	SshSecurityKeyProvider          string   `json:"ssh:securitykeyprovider,omitempty"`
 	SshProxyJump                    []string `json:"ssh:proxyjump,omitempty"`
 	SshUserKnownHostsFile           []string `json:"ssh:userknownhostsfile,omitempty"`
 	SshGlobalKnownHostsFile         []string `json:"ssh:globalknownhostsfile,omitempty"`
+	SshHashKnownHosts               bool     `json:"ssh:hashknownhosts,omitempty"`
+	SshStrictHostKeyChecking        string   `json:"ssh:stricthostkeychecking,omitempty"`
+	SshRevokedHostKeys              string   `json:"ssh:revokedhostkeys,omitempty"`
+	SshUpdateHostKeys               string   `json:"ssh:updatehostkeys,omitempty"`
+	SshCiphers                      string   `json:"ssh:ciphers,omitempty"`
+	SshMACs                         string   `json:"ssh:macs,omitempty"`
+	SshKexAlgorithms                string   `json:"ssh:kexalgorithms,omitempty"`
+	SshHostKeyAlgorithms            string   `json:"ssh:hostkeyalgorithms,omitempty"`
+	SshLocalForward                 []string `json:"ssh:localforward,omitempty"`
+	SshRemoteForward                []string `json:"ssh:remoteforward,omitempty"`
+	SshDynamicForward               []string `json:"ssh:dynamicforward,omitempty"`
+	SshStreamLocalBindUnlink        *bool    `json:"ssh:streamlocalbindunlink,omitempty"`
+	SshExitOnForwardFailure         *bool    `json:"ssh:exitonforwardfailure,omitempty"`
+	SshForwardGpgAgent              bool     `json:"ssh:forwardgpgagent,omitempty"`
+	SshSendEnv                      []string `json:"ssh:sendenv,omitempty"`
+	SshSetEnv                       []string `json:"ssh:setenv,omitempty"`
+	SshForwardX11                   *bool    `json:"ssh:forwardx11,omitempty"`
+	SshForwardX11Trusted            *bool    `json:"ssh:forwardx11trusted,omitempty"`
+	SshPermitLocalCommand           *bool    `json:"ssh:permitlocalcommand,omitempty"`
+	SshLocalCommand                 string   `json:"ssh:localcommand,omitempty"`
+}
+
+const (
+	ForwardType_Local   = "local"
+	ForwardType_Remote  = "remote"
+	ForwardType_Dynamic = "dynamic" // a socks5 proxy
+)
+
+const (
+	ForwardSource_SshConfig = "ssh_config"
+	ForwardSource_Config    = "config"
+	ForwardSource_User      = "user" // added with wsh conn forward (or the api)
+)
+
+// a remote forward spec for forwarding the local gpg-agent (see ssh:forwardgpgagent)
+const ForwardSpec_GpgAgent = "gpg-agent"
+
+type PortForwardInfo struct {
+	Connection  string `json:"connection"`
+	Type        string `json:"type"`
+	Spec        string `json:"spec"`
+	ListenAddr  string `json:"listenaddr,omitempty"`
+	TargetAddr  string `json:"targetaddr,omitempty"`
+	Source      string `json:"source,omitempty"`
+	ActiveConns int    `json:"activeconns"`
+	TotalConns  int64  `json:"totalconns"`
+	Error       string `json:"error,omitempty"` // set when the forward could not be started
+}
+
+// traffic and health of a connected ssh connection.  the rates (bytes/sec) and round trip times
+// are measured with keepalives, which are sent every 15 seconds.
+type ConnStatsInfo struct {
+	Connection        string  `json:"connection"`
+	ConnectedTs       int64   `json:"connectedts"`
+	BytesSent         int64   `json:"bytessent"`
+	BytesRecv         int64   `json:"bytesrecv"`
+	SendRate          float64 `json:"sendrate"`
+	RecvRate          float64 `json:"recvrate"`
+	RttMs             float64 `json:"rttms"`
+	AvgRttMs          float64 `json:"avgrttms"`
+	LastKeepAliveTs   int64   `json:"lastkeepalivets,omitempty"`
+	KeepAliveFailures int     `json:"keepalivefailures"`
+	ActiveChannels    int64   `json:"activechannels"`
+	TotalChannels     int64   `json:"totalchannels"`
+	// the algorithms from the first key exchange ("send" is to the server)
+	KexAlgorithm         string   `json:"kexalgorithm,omitempty"`
+	HostKeyAlgorithm     string   `json:"hostkeyalgorithm,omitempty"`
+	CipherSend           string   `json:"ciphersend,omitempty"`
+	CipherRecv           string   `json:"cipherrecv,omitempty"`
+	MACSend              string   `json:"macsend,omitempty"`
+	MACRecv              string   `json:"macrecv,omitempty"`
+	PostQuantumKex       bool     `json:"postquantumkex,omitempty"`
+	ServerPostQuantumKex []string `json:"serverpostquantumkex,omitempty"` // offered by the server
+}
+
+// Save also adds (or removes) the forward in connections.json
+type CommandConnForwardData struct {
+	Connection string `json:"connection"`
+	Type       string `json:"type"`
+	Spec       string `json:"spec"`
+	Save       bool   `json:"save,omitempty"`
+}
+
+const (
+	CopyDirection_Upload   = "upload"
+	CopyDirection_Download = "download"
+)
+
+// LocalPath is on the machine running Wave
+type CommandConnCopyFileData struct {
+	Connection string `json:"connection"`
+	Direction  string `json:"direction"`
+	LocalPath  string `json:"localpath"`
+	RemotePath string `json:"remotepath"`
+	Resume     bool   `json:"resume,omitempty"`    // continue from a partial copy
+	Overwrite  bool   `json:"overwrite,omitempty"` // replace an existing destination file
+}
+
+type ConnCopyFileProgress struct {
+	Connection  string `json:"connection"`
+	Direction   string `json:"direction"`
+	LocalPath   string `json:"localpath"`
+	RemotePath  string `json:"remotepath"`
+	Bytes       int64  `json:"bytes"`
+	TotalBytes  int64  `json:"totalbytes"`
+	ResumedFrom int64  `json:"resumedfrom,omitempty"`
+	Checksum    string `json:"checksum,omitempty"` // sha256, set when done
+	Verified    bool   `json:"verified,omitempty"` // false if the remote has no sha256sum/shasum
+	Done        bool   `json:"done,omitempty"`
+}
+
+const (
+	SyncDirection_Push = "push" // local to remote
+	SyncDirection_Pull = "pull" // remote to local
+)
+
+// syncs the directory LocalPath with RemotePath.  files are compared by size and modtime (or by
+// sha256 with Checksum), and only changed files are copied.  Delete removes destination files
+// that aren't in the source.  Exclude has glob patterns, matched against names and relative paths.
+// with Watch, the directories are synced again whenever the source changes (until cancelled).
+type CommandConnSyncData struct {
+	Connection string   `json:"connection"`
+	Direction  string   `json:"direction"`
+	LocalPath  string   `json:"localpath"`
+	RemotePath string   `json:"remotepath"`
+	Checksum   bool     `json:"checksum,omitempty"`
+	Delete     bool     `json:"delete,omitempty"`
+	Exclude    []string `json:"exclude,omitempty"`
+	DryRun     bool     `json:"dryrun,omitempty"`
+	Watch      bool     `json:"watch,omitempty"`
+}
+
+const (
+	SyncAction_Copy   = "copy"
+	SyncAction_Mkdir  = "mkdir"
+	SyncAction_Delete = "delete"
+)
+
+type ConnSyncChange struct {
+	Action string `json:"action"`
+	Path   string `json:"path"` // relative to the synced directories
+	Size   int64  `json:"size,omitempty"`
+}
+
+// a round starts with the planned Changes, then reports progress, and ends with Done.  in
+// watch mode there is a round for each change to the source.
+type ConnSyncProgress struct {
+	Connection string           `json:"connection"`
+	Direction  string           `json:"direction"`
+	Round      int              `json:"round"`
+	Changes    []ConnSyncChange `json:"changes,omitempty"`
+	Path       string           `json:"path,omitempty"` // the file being copied
+	FilesTotal int              `json:"filestotal"`
+	FilesDone  int              `json:"filesdone"`
+	BytesTotal int64            `json:"bytestotal"`
+	BytesDone  int64            `json:"bytesdone"`
+	Error      string           `json:"error,omitempty"` // a round in watch mode failed (the next change retries it)
+	Done       bool             `json:"done,omitempty"`
+}
+
+const (
+	ConnImportSource_Putty     = "putty"
+	ConnImportSource_Kitty     = "kitty"
+	ConnImportSource_Termius   = "termius"
+	ConnImportSource_SecureCrt = "securecrt"
+	ConnImportSource_SshConfig = "sshconfig"
+)
+
+// filters the connection list.  Query matches part of the name, group, or a tag (ignoring case),
+// and a connection needs every one of Tags.  hidden connections are only listed with ShowHidden.
+type ConnListFilter struct {
+	Query      string   `json:"query,omitempty"`
+	Group      string   `json:"group,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Favorites  bool     `json:"favorites,omitempty"`
+	ShowHidden bool     `json:"showhidden,omitempty"`
+}
+
+// a connection with its display settings from connections.json (Status is "" if it isn't open)
+type ConnListEntry struct {
+	Connection string   `json:"connection"`
+	Group      string   `json:"group,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Color      string   `json:"color,omitempty"`
+	Favorite   bool     `json:"favorite,omitempty"`
+	Hidden     bool     `json:"hidden,omitempty"`
+	Order      float32  `json:"order,omitempty"`
+	Status     string   `json:"status,omitempty"`
+}
+
+// imports saved sessions (from Path, or the source's default location) as connections
+type CommandConnImportData struct {
+	Source    string `json:"source"`
+	Path      string `json:"path,omitempty"` // an export or session file (or a folder of putty sessions)
+	DryRun    bool   `json:"dryrun,omitempty"`
+	Overwrite bool   `json:"overwrite,omitempty"` // replace settings that conflict with saved connections
+}
+
+const (
+	ConnImportStatus_Added     = "added"
+	ConnImportStatus_Updated   = "updated"
+	ConnImportStatus_Unchanged = "unchanged"
+	ConnImportStatus_Conflict  = "conflict"
+	ConnImportStatus_Skipped   = "skipped"
+)
+
+type ConnImportEntry struct {
+	Session    string              `json:"session"`
+	Connection string              `json:"connection,omitempty"`
+	Status     string              `json:"status"`
+	Message    string              `json:"message,omitempty"`
+	Warnings   []string            `json:"warnings,omitempty"` // settings that could not be imported
+	Keywords   waveobj.MetaMapType `json:"keywords,omitempty"`
+}
+
+type ConnImportResult struct {
+	Entries []ConnImportEntry `json:"entries"`
+}
+
+// a peer of the tailnet (from the local tailscaled)
+type TailscalePeer struct {
+	HostName     string   `json:"hostname"`
+	DNSName      string   `json:"dnsname"` // the MagicDNS name
+	OS           string   `json:"os,omitempty"`
+	TailscaleIPs []string `json:"tailscaleips,omitempty"`
+	Online       bool     `json:"online,omitempty"`
+	TailscaleSsh bool     `json:"tailscalessh,omitempty"` // the peer runs tailscale ssh
+}
+
+// looks for ssh servers on the local network.  Subnets are CIDRs (or "local") to scan on Port
+// (22 by default), and TimeoutMs is how long to wait for mDNS answers.
+type CommandDiscoverHostsData struct {
+	NoMdns    bool     `json:"nomdns,omitempty"`
+	Subnets   []string `json:"subnets,omitempty"`
+	Port      int      `json:"port,omitempty"`
+	TimeoutMs int      `json:"timeoutms,omitempty"`
+}
+
+const (
+	DiscoverySource_Mdns = "mdns"
+	DiscoverySource_Scan = "scan"
+)
+
+// an ssh server found by DiscoverHostsCommand.  it is accepted by saving Keywords for Connection
+// in connections.json (with SetConnectionsConfigCommand).
+type DiscoveredHost struct {
+	Connection    string              `json:"connection"`
+	Host          string              `json:"host"` // the mDNS host name, or the scanned address
+	Port          int                 `json:"port"`
+	Addrs         []string            `json:"addrs,omitempty"`
+	Name          string              `json:"name,omitempty"` // the mDNS instance name, or the reverse dns name
+	Source        string              `json:"source"`
+	ServerVersion string              `json:"serverversion,omitempty"` // only for scanned hosts
+	Known         bool                `json:"known,omitempty"`         // already in the connection list
+	Keywords      waveobj.MetaMapType `json:"keywords,omitempty"`
+}
+
+// a machine of vagrant's machine index.  Connection is set for the running machines that have an
+// ssh config (their alias in Wave's generated ssh config file).
+type VagrantMachine struct {
+	Id         string `json:"id"`
+	Name       string `json:"name"`
+	Provider   string `json:"provider"`
+	State      string `json:"state"`
+	Directory  string `json:"directory"`
+	Connection string `json:"connection,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// a running container of a local runtime (docker, podman or containerd)
+type ContainerInfo struct {
+	Connection string `json:"connection"` // e.g. "podman://web"
+	Runtime    string `json:"runtime"`
+	Id         string `json:"id"`
+	Name       string `json:"name"`
+	Image      string `json:"image"`
+	Status     string `json:"status,omitempty"` // e.g. "Up 2 hours"
+}
+
+// runs Command on each connection concurrently (connecting them as needed).  TimeoutMs limits
+// the whole broadcast, and MaxParallel limits how many connections run at once.
+type CommandConnBroadcastData struct {
+	Connections []string `json:"connections"`
+	Command     string   `json:"command"`
+	TimeoutMs   int      `json:"timeoutms,omitempty"`
+	MaxParallel int      `json:"maxparallel,omitempty"`
+}
+
+const (
+	BroadcastEvent_Stdout = "stdout"
+	BroadcastEvent_Stderr = "stderr"
+	BroadcastEvent_Exit   = "exit"  // the command finished, with ExitCode (-1 if killed by a signal)
+	BroadcastEvent_Error  = "error" // the command couldn't be run (or was cancelled)
+)
+
+type ConnBroadcastEvent struct {
+	Connection string `json:"connection"`
+	Type       string `json:"type"`
+	Data64     string `json:"data64,omitempty"`
+	ExitCode   int    `json:"exitcode"`
+	Error      string `json:"error,omitempty"`
+}
+
+// runs Command (with the remote user's shell) in a new session on a connected connection.
+// Env might not be accepted by the server (see AcceptEnv in sshd_config).
+type CommandConnExecData struct {
+	Connection string            `json:"connection"`
+	Command    string            `json:"command"`
+	Stdin64    string            `json:"stdin64,omitempty"`
+	Cwd        string            `json:"cwd,omitempty"`
+	Env        map[string]string `json:"env,omitempty"`
+	TimeoutMs  int               `json:"timeoutms,omitempty"` // the command is killed after this
+}
+
+const (
+	ExecEvent_Stdout = "stdout"
+	ExecEvent_Stderr = "stderr"
+	ExecEvent_Exit   = "exit" // the last event
+)
+
+type ConnExecEvent struct {
+	Type       string `json:"type"`
+	Data64     string `json:"data64,omitempty"`
+	ExitCode   int    `json:"exitcode"`             // -1 if the command was killed by a signal
+	ExitSignal string `json:"exitsignal,omitempty"` // e.g. "KILL"
+}
+
+// files in a mounted directory are addressed as mount://<name>/<path>
+const MountPathPrefix = "mount://"
+
+const (
+	MountStatus_Mounted      = "mounted"
+	MountStatus_Disconnected = "disconnected" // re-mounted when the connection reconnects
+	MountStatus_Error        = "error"        // the directory couldn't be re-mounted
+)
+
+// Name defaults to the base name of RemotePath (which defaults to the home directory)
+type CommandConnMountData struct {
+	Connection string `json:"connection"`
+	RemotePath string `json:"remotepath,omitempty"`
+	Name       string `json:"name,omitempty"`
+}
+
+type MountInfo struct {
+	Name       string `json:"name"`
+	Connection string `json:"connection"`
+	RemotePath string `json:"remotepath"` // as given
+	MountPath  string `json:"mountpath"`  // the resolved absolute path
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	MountedTs  int64  `json:"mountedts"`
+}
+
+const (
+	KnownHostStatus_Known   = "known"   // known_hosts has the host's key
+	KnownHostStatus_Unknown = "unknown" // known_hosts has no key for the host
+	KnownHostStatus_Changed = "changed" // known_hosts has other keys for the host
+	KnownHostStatus_Revoked = "revoked" // the host's key is marked @revoked
+)
+
+type KnownHostEntry struct {
+	File        string `json:"file"`
+	Line        int    `json:"line"`
+	Marker      string `json:"marker,omitempty"` // "@cert-authority" or "@revoked"
+	Hosts       string `json:"hosts"`            // the host patterns as written (hashed hosts can't be shown)
+	Hashed      bool   `json:"hashed,omitempty"`
+	KeyType     string `json:"keytype,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"` // SHA256:...
+	Error       string `json:"error,omitempty"`       // set if the line can't be parsed
+}
+
+// the known_hosts files come from the connection's ssh config (or the defaults if there is no
+// connection), and Host defaults to the connection's hostname and port
+type CommandKnownHostsData struct {
+	Connection  string `json:"connection,omitempty"`
+	Host        string `json:"host,omitempty"`        // "host" or "host:port"
+	Fingerprint string `json:"fingerprint,omitempty"` // for delete, only remove this key (all of the host's keys if empty)
+}
+
+type KnownHostsVerifyResult struct {
+	Host        string           `json:"host"`
+	KeyType     string           `json:"keytype"`
+	Fingerprint string           `json:"fingerprint"` // the key the host sent
+	Status      string           `json:"status"`
+	Entries     []KnownHostEntry `json:"entries,omitempty"` // the known_hosts entries for the host
 }
 
 type ConnRequest struct {
-	Host     string       `json:"host"`
-	Keywords ConnKeywords `json:"keywords,omitempty"`
+	Host     string            `json:"host"`
+	Keywords ConnKeywords      `json:"keywords,omitempty"`
+	Headless *ConnHeadlessOpts `json:"headless,omitempty"`
+}
+
+// connects without prompting (for scripts and tests), the credentials and host key policy are
+// given up front.  anything that would need a prompt fails the connection with
+// ConnErrorCode_InputRequired.  the credentials are used for every proxy jump hop.
+type ConnHeadlessOpts struct {
+	Password              string `json:"password,omitempty"`
+	Passphrase            string `json:"passphrase,omitempty"`            // for encrypted identity files
+	StrictHostKeyChecking string `json:"stricthostkeychecking,omitempty"` // overrides StrictHostKeyChecking ("yes", "accept-new", or "no")
 }
 
 const (
@@ -524,6 +1354,79 @@ type ConnConfigRequest struct {
 	MetaMapType waveobj.MetaMapType `json:"metamaptype"`
 }
 
+// sets the log level for a package at runtime (Package "" sets the default level).
+// Clear removes a runtime override so the package goes back to its configured level.
+type CommandSetLogLevelData struct {
+	Package string `json:"package,omitempty"`
+	Level   string `json:"level,omitempty"`
+	Clear   bool   `json:"clear,omitempty"`
+}
+
+// an answer the user asked us to remember for a connection prompt
+type RememberedAnswer struct {
+	Connection string `json:"connection"`
+	Key        string `json:"key"`
+	Answer     string `json:"answer"`
+}
+
+// clears one remembered answer (or all of them for the connection if Key is empty)
+type CommandClearRememberedAnswersData struct {
+	Connection string `json:"connection"`
+	Key        string `json:"key,omitempty"`
+}
+
+// an ssh password or key passphrase stored in the os keychain (the secret itself is never returned)
+type StoredSecret struct {
+	Key        string `json:"key"`                  // <kind>:<target>
+	Kind       string `json:"kind"`                 // "password", "passphrase", or "totp"
+	Target     string `json:"target"`               // user@host:port for passwords, the identity file for passphrases, the connection for totp secrets
+	Connection string `json:"connection,omitempty"` // the connection a password or totp secret was entered for
+	CreatedTs  int64  `json:"createdts"`
+}
+
+// deletes one stored secret (or all of them if All is set)
+type CommandKeychainDeleteData struct {
+	Key string `json:"key,omitempty"`
+	All bool   `json:"all,omitempty"`
+}
+
+// saves the totp secret (base32 or an otpauth:// uri) for a connection
+type CommandKeychainSetTotpData struct {
+	Connection string `json:"connection"`
+	Secret     string `json:"secret"`
+}
+
+// a prepared (not yet written) diagnostic bundle, so the user can review it first
+type DiagBundleInfo struct {
+	BundleId  string           `json:"bundleid"`
+	Items     []DiagBundleItem `json:"items"`
+	ExpiresTs int64            `json:"expirests"`
+}
+
+type DiagBundleItem struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Size        int64  `json:"size"`
+	Redactions  int    `json:"redactions,omitempty"`
+}
+
+type CommandDiagBundleItemData struct {
+	BundleId string `json:"bundleid"`
+	Name     string `json:"name"`
+}
+
+// Path is optional (defaults to a file in the temp dir)
+type CommandWriteDiagBundleData struct {
+	BundleId string `json:"bundleid"`
+	Path     string `json:"path,omitempty"`
+}
+
+// returns the connection's debug log (or clears it)
+type CommandConnDebugLogData struct {
+	Connection string `json:"connection"`
+	Clear      bool   `json:"clear,omitempty"`
+}
+
 type ConnStatus struct {
 	Status        string `json:"status"`
 	WshEnabled    bool   `json:"wshenabled"`
@@ -532,7 +1435,78 @@ type ConnStatus struct {
 	HasConnected  bool   `json:"hasconnected"` // true if it has *ever* connected successfully
 	ActiveConnNum int    `json:"activeconnnum"`
 	Error         string `json:"error,omitempty"`
+	ErrorCode     string `json:"errorcode,omitempty"` // a ConnErrorCode_* for errors the ui handles specially
 	WshError      string `json:"wsherror,omitempty"`
+	Insecure      bool   `json:"insecure,omitempty"` // the connection is not encrypted (telnet)
+}
+
+// the wsh helper of a connection (the version is the one its connserver reported in the version
+// handshake, "" before that or when wsh is not running)
+type WshHelperStatus struct {
+	Connection      string `json:"connection"`
+	WshEnabled      bool   `json:"wshenabled"`
+	Version         string `json:"version,omitempty"`
+	ExpectedVersion string `json:"expectedversion"`
+	UpToDate        bool   `json:"uptodate"`
+	UpdateTime      int64  `json:"updatetime,omitempty"` // when the helper was last replaced after a version mismatch
+	WshError        string `json:"wsherror,omitempty"`
+}
+
+// reported by a connserver (used for the version handshake)
+type RemoteInfo struct {
+	WshVersion string `json:"wshversion"`
+	ClientOs   string `json:"clientos"`
+	ClientArch string `json:"clientarch"`
+	Pid        int    `json:"pid"`
+}
+
+const (
+	ConnErrorCode_HostKeyRevoked    = "hostkey-revoked"     // retrying won't help until known_hosts changes
+	ConnErrorCode_HostKeyKRLRevoked = "hostkey-krl-revoked" // listed in the RevokedHostKeys file
+	ConnErrorCode_InputRequired     = "input-required"      // a headless connection needed a prompt
+	ConnErrorCode_ForwardFailed     = "forward-failed"      // a forward failed with ExitOnForwardFailure
+)
+
+const (
+	ConnEvent_Queued          = "queued" // waiting for conn:maxconcurrent or conn:maxconcurrentperhost
+	ConnEvent_Connecting      = "connecting"
+	ConnEvent_AuthStarted     = "auth-started" // the host key was accepted
+	ConnEvent_Banner          = "banner"       // the server's pre-auth banner
+	ConnEvent_AuthMethodTried = "auth-method-tried"
+	ConnEvent_Connected       = "connected"
+	ConnEvent_Disconnected    = "disconnected"
+	ConnEvent_Reconnecting    = "reconnecting"
+	ConnEvent_Error           = "error"
+)
+
+// published as "conn:lifecycle" while connecting (and when a connection drops).  Host is the
+// hop the event is for, which is a ProxyJump host (with JumpNum > 0) before the target.
+type ConnLifecycleEvent struct {
+	Connection string              `json:"connection"`
+	Type       string              `json:"type"`
+	Ts         int64               `json:"ts"`
+	Host       string              `json:"host,omitempty"`
+	JumpNum    int32               `json:"jumpnum,omitempty"`
+	AuthMethod string              `json:"authmethod,omitempty"`
+	Detail     string              `json:"detail,omitempty"` // the key offered for publickey, "shared" for a shared connection, the queue for queued, the text for banner
+	Error      string              `json:"error,omitempty"`
+	ErrorCode  string              `json:"errorcode,omitempty"`
+	DebugInfo  *ConnEventDebugInfo `json:"debuginfo,omitempty"`
+}
+
+// where a connection error happened
+type ConnEventDebugInfo struct {
+	Host    string `json:"host,omitempty"`
+	JumpNum int32  `json:"jumpnum"`
+	ViaAddr string `json:"viaaddr,omitempty"` // the jump host it was connecting through
+}
+
+// a connection status change (kept per connection for diagnostics)
+type ConnTimelineEvent struct {
+	Ts       int64  `json:"ts"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	WshError string `json:"wsherror,omitempty"`
 }
 
 type WebSelectorOpts struct {
@@ -588,6 +1562,65 @@ type WorkspaceInfoData struct {
 	WorkspaceData *waveobj.Workspace `json:"workspacedata"`
 }
 
+const WorkspaceHandoffVersion = 1
+
+// a workspace serialized so it can be recreated on another Wave instance
+type WorkspaceHandoffData struct {
+	Version   int              `json:"version"`
+	Ts        int64            `json:"ts"`
+	Hostname  string           `json:"hostname,omitempty"`
+	Name      string           `json:"name,omitempty"`
+	Icon      string           `json:"icon,omitempty"`
+	Color     string           `json:"color,omitempty"`
+	ActiveTab int              `json:"activetab"` // index into Tabs
+	Tabs      []HandoffTabData `json:"tabs"`
+}
+
+type HandoffTabData struct {
+	Name            string              `json:"name"`
+	Pinned          bool                `json:"pinned,omitempty"`
+	Meta            waveobj.MetaMapType `json:"meta,omitempty"`
+	Blocks          []HandoffBlockData  `json:"blocks"`
+	RootNode        any                 `json:"rootnode,omitempty"`
+	FocusedNodeId   string              `json:"focusednodeid,omitempty"`
+	MagnifiedNodeId string              `json:"magnifiednodeid,omitempty"`
+}
+
+type HandoffBlockData struct {
+	BlockId string              `json:"blockid"` // the id on the exporting instance (the layout refers to it)
+	Meta    waveobj.MetaMapType `json:"meta"`
+}
+
+type CommandWorkspaceHandoffImportData struct {
+	Handoff *WorkspaceHandoffData `json:"handoff"`
+	Open    bool                  `json:"open,omitempty"` // open the workspace in a new window
+}
+
+const (
+	UpdateChannel_Stable  = "stable"
+	UpdateChannel_Beta    = "beta"
+	UpdateChannel_Nightly = "nightly"
+)
+
+// sent with the "updater:status" event
+type UpdaterStatusData struct {
+	Status         string  `json:"status"` // up-to-date, checking, downloading, ready, installing, error
+	Channel        string  `json:"channel"`
+	CurrentVersion string  `json:"currentversion"`
+	Version        string  `json:"version,omitempty"` // the available (or downloaded) version
+	ReleaseNotes   string  `json:"releasenotes,omitempty"`
+	Progress       float64 `json:"progress,omitempty"`      // download percent
+	DownloadBytes  int64   `json:"downloadbytes,omitempty"` // bytes downloaded (less than the full size for delta updates)
+	Error          string  `json:"error,omitempty"`
+	LastCheckTs    int64   `json:"lastcheckts,omitempty"`
+	InstallPending bool    `json:"installpending,omitempty"` // waiting for blocks to go idle
+	BusyBlocks     int     `json:"busyblocks,omitempty"`
+}
+
+type CommandUpdaterInstallData struct {
+	Force bool `json:"force,omitempty"` // install now, even if blocks are running commands
+}
+
 type AiMessageData struct {
 	Message string `json:"message,omitempty"`
 }
@@ -620,6 +1653,88 @@ type ActivityDisplayType struct {
 	Internal bool    `json:"internal,omitempty"`
 }
 
+// input is only recorded with RecordInput (it can contain passwords)
+type CommandRecordingStartData struct {
+	BlockId     string `json:"blockid"`
+	Title       string `json:"title,omitempty"`
+	RecordInput bool   `json:"recordinput,omitempty"`
+}
+
+// a terminal session recording (an asciicast v2 block file)
+type RecordingInfo struct {
+	BlockId     string `json:"blockid"`
+	FileName    string `json:"filename"`
+	Title       string `json:"title,omitempty"`
+	Connection  string `json:"connection,omitempty"`
+	StartTs     int64  `json:"startts"`
+	EndTs       int64  `json:"endts,omitempty"`
+	Size        int64  `json:"size"`
+	RecordInput bool   `json:"recordinput,omitempty"`
+	Active      bool   `json:"active,omitempty"`
+}
+
+// writes a recording (the latest one if FileName is empty) to Path on the machine running Wave
+type CommandRecordingExportData struct {
+	BlockId  string `json:"blockid"`
+	FileName string `json:"filename,omitempty"`
+	Path     string `json:"path,omitempty"`
+}
+
+type CommandUsageStatsData struct {
+	Days  int  `json:"days,omitempty"`
+	Clear bool `json:"clear,omitempty"`
+}
+
+type UsageStatEntry struct {
+	Key   string `json:"key"`
+	Name  string `json:"name"`
+	Value int64  `json:"value"`
+}
+
+// local-only usage stats (never uploaded)
+type UsageStatsSummary struct {
+	SinceDay          string           `json:"sinceday"`
+	Days              int              `json:"days"`
+	DaysActive        int              `json:"daysactive"`
+	ActiveMinutes     int64            `json:"activeminutes"`
+	BusiestDay        string           `json:"busiestday,omitempty"`
+	BusiestDayMinutes int64            `json:"busiestdayminutes,omitempty"`
+	Connections       []UsageStatEntry `json:"connections,omitempty"`  // commands entered per connection
+	ConnSessions      []UsageStatEntry `json:"connsessions,omitempty"` // shells/commands started per connection
+	Workspaces        []UsageStatEntry `json:"workspaces,omitempty"`   // foreground minutes per workspace
+	Blocks            []UsageStatEntry `json:"blocks,omitempty"`       // blocks created per view
+}
+
+type AuditEvent struct {
+	Id         int64  `json:"id"`
+	Ts         int64  `json:"ts"`
+	EventType  string `json:"eventtype"`
+	Connection string `json:"connection,omitempty"`
+	Source     string `json:"source,omitempty"`
+	Details    string `json:"details,omitempty"`
+}
+
+type CommandAuditEventsData struct {
+	SinceTs    int64  `json:"sincets,omitempty"`
+	Connection string `json:"connection,omitempty"`
+	EventType  string `json:"eventtype,omitempty"`
+	Limit      int    `json:"limit,omitempty"`
+}
+
+// where to reach the (token protected) pprof/runtime endpoints, only set when "debug:pprof" is enabled
+type DebugPprofInfo struct {
+	Enabled bool   `json:"enabled"`
+	Url     string `json:"url,omitempty"`
+	Token   string `json:"token,omitempty"`
+}
+
+// the telemetry payload that would be sent next (nothing is sent)
+type TelemetryPreviewData struct {
+	Categories map[string]bool `json:"categories"`
+	Url        string          `json:"url"`
+	Payload    any             `json:"payload,omitempty"`
+}
+
 type ActivityUpdate struct {
 	FgMinutes     int                   `json:"fgminutes,omitempty"`
 	ActiveMinutes int                   `json:"activeminutes,omitempty"`
@@ -638,6 +1753,7 @@ type ActivityUpdate struct {
 	Startup       int                   `json:"startup,omitempty"`
 	Shutdown      int                   `json:"shutdown,omitempty"`
 	SetTabTheme   int                   `json:"settabtheme,omitempty"`
+	WorkspaceId   string                `json:"workspaceid,omitempty"` // workspace in the foreground, only used for local usage stats
 	BuildTime     string                `json:"buildtime,omitempty"`
 	Displays      []ActivityDisplayType `json:"displays,omitempty"`
 	Renderers     map[string]int        `json:"renderers,omitempty"`
@@ -645,3 +1761,56 @@ type ActivityUpdate struct {
 	WshCmds       map[string]int        `json:"wshcmds,omitempty"`
 	Conn          map[string]int        `json:"conn,omitempty"`
 }
+
+const (
+	PluginAction_Start   = "start"
+	PluginAction_Stop    = "stop"
+	PluginAction_Restart = "restart"
+	PluginAction_Reload  = "reload" // re-reads the manifests in the plugins directory
+)
+
+const (
+	PluginStatus_Stopped = "stopped"
+	PluginStatus_Running = "running"
+	PluginStatus_Failed  = "failed" // crashed too many times, must be started again by hand
+)
+
+// a view a plugin renders (as a vdom block routed to the plugin)
+type PluginView struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayname,omitempty"`
+	Icon        string `json:"icon,omitempty"`
+}
+
+// plugin.json, in <config dir>/plugins/<name>/
+type PluginManifest struct {
+	Name        string            `json:"name"`
+	Version     string            `json:"version,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Command     string            `json:"command"` // relative to the plugin directory, or found in PATH
+	Args        []string          `json:"args,omitempty"`
+	Env         map[string]string `json:"env,omitempty"`
+	Views       []PluginView      `json:"views,omitempty"`
+	Commands    []string          `json:"commands,omitempty"`    // rpc commands the plugin handles
+	Permissions []string          `json:"permissions,omitempty"` // scopes of the rpc commands the plugin may call
+	AutoStart   bool              `json:"autostart,omitempty"`
+}
+
+type PluginInfo struct {
+	Manifest  PluginManifest `json:"manifest"`
+	Dir       string         `json:"dir"`
+	Route     string         `json:"route"`
+	Status    string         `json:"status"`
+	Pid       int            `json:"pid,omitempty"`
+	Restarts  int            `json:"restarts,omitempty"`
+	LastError string         `json:"lasterror,omitempty"`
+}
+
+type CommandPluginControlData struct {
+	Name   string `json:"name,omitempty"` // not needed for reload
+	Action string `json:"action"`
+}
+
+type CommandClipboardData struct {
+	Text string `json:"text"`
+}
@@ -0,0 +1,126 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshserver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/userinput"
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+// `wsh clipboard` reads and writes the local system clipboard (through electron).  callers on
+// remote connections are checked against the "clipboard:remote" policy, and asked for permission
+// by default.  the caller's connection comes from the route the request came in on, so a remote
+// can't claim to be local.
+
+const DefaultClipboardMaxSize = 1024 * 1024
+const ClipboardConfirmTimeout = 60 * time.Second
+
+const (
+	ClipboardPolicy_Ask   = "ask"
+	ClipboardPolicy_Allow = "allow"
+	ClipboardPolicy_Deny  = "deny"
+)
+
+func getClipboardMaxSize() int {
+	maxSize := wconfig.GetWatcher().GetFullConfig().Settings.ClipboardMaxSize
+	if maxSize <= 0 {
+		return DefaultClipboardMaxSize
+	}
+	return int(maxSize)
+}
+
+// the remote connection a request came from ("" for local callers)
+func getCallerConnName(ctx context.Context) (string, error) {
+	handler := wshutil.GetRpcResponseHandlerFromContext(ctx)
+	if handler == nil {
+		return "", fmt.Errorf("no rpc handler")
+	}
+	origin := wshutil.DefaultRouter.GetRequestOrigin(handler.GetReqId())
+	if origin == "" {
+		return "", fmt.Errorf("cannot determine where the request came from")
+	}
+	connName, isConn := strings.CutPrefix(origin, "conn:")
+	if !isConn || connName == wshrpc.LocalConnName {
+		return "", nil
+	}
+	return connName, nil
+}
+
+func checkClipboardAccess(ctx context.Context, isWrite bool) error {
+	connName, err := getCallerConnName(ctx)
+	if err != nil {
+		return err
+	}
+	if connName == "" {
+		return nil
+	}
+	policy := wconfig.GetWatcher().GetFullConfig().Settings.ClipboardRemote
+	switch policy {
+	case ClipboardPolicy_Allow:
+		return nil
+	case ClipboardPolicy_Deny:
+		return fmt.Errorf("clipboard access from remote connections is disabled (clipboard:remote)")
+	}
+	action, rememberKey := "read your clipboard", "clipboard:read"
+	if isWrite {
+		action, rememberKey = "replace the contents of your clipboard", "clipboard:write"
+	}
+	ctx, cancelFn := context.WithTimeout(withCallerInputRoute(ctx), ClipboardConfirmTimeout)
+	defer cancelFn()
+	request := &userinput.UserInputRequest{
+		ResponseType: userinput.ResponseType_Confirm,
+		Title:        "Clipboard Access",
+		QueryText:    fmt.Sprintf("A program on **%s** wants to %s.", connName, action),
+		Markdown:     true,
+		OkLabel:      "Allow",
+		CancelLabel:  "Deny",
+		RememberKey:  rememberKey,
+		RememberConn: connName,
+		ConnName:     connName,
+	}
+	resp, err := userinput.GetUserInput(ctx, request)
+	if err != nil {
+		return err
+	}
+	if !resp.Confirm {
+		return fmt.Errorf("clipboard access was denied")
+	}
+	return nil
+}
+
+func (ws *WshServer) ClipboardReadCommand(ctx context.Context) (string, error) {
+	if err := checkClipboardAccess(ctx, false); err != nil {
+		return "", err
+	}
+	text, err := wshclient.SysClipboardReadCommand(wshclient.GetBareRpcClient(), &wshrpc.RpcOpts{Route: wshutil.ElectronRoute})
+	if err != nil {
+		return "", fmt.Errorf("error reading clipboard: %w", err)
+	}
+	if maxSize := getClipboardMaxSize(); len(text) > maxSize {
+		return "", fmt.Errorf("clipboard contents are too large (%d bytes, max %d)", len(text), maxSize)
+	}
+	return text, nil
+}
+
+func (ws *WshServer) ClipboardWriteCommand(ctx context.Context, data wshrpc.CommandClipboardData) error {
+	if maxSize := getClipboardMaxSize(); len(data.Text) > maxSize {
+		return fmt.Errorf("text is too large for the clipboard (%d bytes, max %d)", len(data.Text), maxSize)
+	}
+	if err := checkClipboardAccess(ctx, true); err != nil {
+		return err
+	}
+	err := wshclient.SysClipboardWriteCommand(wshclient.GetBareRpcClient(), data, &wshrpc.RpcOpts{Route: wshutil.ElectronRoute})
+	if err != nil {
+		return fmt.Errorf("error writing clipboard: %w", err)
+	}
+	return nil
+}
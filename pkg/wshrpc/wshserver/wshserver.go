@@ -6,33 +6,50 @@ package wshserver
 // this file contains the implementation of the wsh server methods
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/fs"
 	"log"
+	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
 
 	"github.com/skratchdot/open-golang/open"
+	"github.com/wavetermdev/waveterm/pkg/audit"
 	"github.com/wavetermdev/waveterm/pkg/blockcontroller"
+	"github.com/wavetermdev/waveterm/pkg/diagbundle"
+	"github.com/wavetermdev/waveterm/pkg/docker"
 	"github.com/wavetermdev/waveterm/pkg/filestore"
+	"github.com/wavetermdev/waveterm/pkg/k8s"
+	"github.com/wavetermdev/waveterm/pkg/keychain"
 	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/plugin"
 	"github.com/wavetermdev/waveterm/pkg/remote"
 	"github.com/wavetermdev/waveterm/pkg/remote/conncontroller"
+	"github.com/wavetermdev/waveterm/pkg/remote/conndebug"
 	"github.com/wavetermdev/waveterm/pkg/telemetry"
+	"github.com/wavetermdev/waveterm/pkg/telnet"
+	"github.com/wavetermdev/waveterm/pkg/usagestats"
+	"github.com/wavetermdev/waveterm/pkg/userinput"
 	"github.com/wavetermdev/waveterm/pkg/util/envutil"
 	"github.com/wavetermdev/waveterm/pkg/util/utilfn"
 	"github.com/wavetermdev/waveterm/pkg/waveai"
 	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wavedebug"
 	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wavestats"
+	"github.com/wavetermdev/waveterm/pkg/wcloud"
 	"github.com/wavetermdev/waveterm/pkg/wconfig"
 	"github.com/wavetermdev/waveterm/pkg/wcore"
+	"github.com/wavetermdev/waveterm/pkg/wlog"
 	"github.com/wavetermdev/waveterm/pkg/wps"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
 	"github.com/wavetermdev/waveterm/pkg/wshutil"
 	"github.com/wavetermdev/waveterm/pkg/wsl"
 	"github.com/wavetermdev/waveterm/pkg/wstore"
@@ -181,6 +198,9 @@ func (ws *WshServer) CreateBlockCommand(ctx context.Context, data wshrpc.Command
 	if err != nil {
 		return nil, fmt.Errorf("error creating block: %w", err)
 	}
+	if cmdStr := blockData.Meta.GetString(waveobj.MetaKey_Cmd, ""); cmdStr != "" {
+		auditRemoteAction(ctx, audit.Event_RemoteCommand, blockData.OID, cmdStr)
+	}
 	err = wcore.QueueLayoutActionForTab(ctx, tabId, waveobj.LayoutActionData{
 		ActionType: wcore.LayoutActionDataType_Insert,
 		BlockId:    blockData.OID,
@@ -236,6 +256,37 @@ func (ws *WshServer) ControllerResyncCommand(ctx context.Context, data wshrpc.Co
 	return blockcontroller.ResyncController(ctx, data.TabId, data.BlockId, data.RtOpts, data.ForceRestart)
 }
 
+// records actions taken on remote hosts by automation (wsh, scripts) in the audit trail.
+// input from the ui (tab and frontend block routes) is not recorded.
+func auditRemoteAction(ctx context.Context, eventType string, blockId string, details string) {
+	source := wshutil.GetRpcSourceFromContext(ctx)
+	if strings.HasPrefix(source, "tab:") || strings.HasPrefix(source, "feblock:") || source == wshutil.ElectronRoute {
+		return
+	}
+	block, err := wstore.DBGet[*waveobj.Block](ctx, blockId)
+	if err != nil || block == nil {
+		return
+	}
+	connName := block.Meta.GetString(waveobj.MetaKey_Connection, "")
+	if connName == "" || connName == "local" {
+		return
+	}
+	audit.Record(eventType, connName, source, details)
+}
+
+// an enter keypress sent to a terminal counts as a command for the local usage stats
+func countConnCommand(ctx context.Context, blockId string) {
+	block, err := wstore.DBGet[*waveobj.Block](ctx, blockId)
+	if err != nil || block == nil {
+		return
+	}
+	if block.Meta.GetString(waveobj.MetaKey_Controller, "") != blockcontroller.BlockController_Shell {
+		return
+	}
+	connName := block.Meta.GetString(waveobj.MetaKey_Connection, "")
+	usagestats.GoAdd(usagestats.Stat_ConnCommands, usagestats.ConnKey(connName), 1)
+}
+
 func (ws *WshServer) ControllerInputCommand(ctx context.Context, data wshrpc.CommandBlockInputData) error {
 	bc := blockcontroller.GetBlockController(data.BlockId)
 	if bc == nil {
@@ -252,6 +303,10 @@ func (ws *WshServer) ControllerInputCommand(ctx context.Context, data wshrpc.Com
 			return fmt.Errorf("error decoding input data: %w", err)
 		}
 		inputUnion.InputData = inputBuf[:nw]
+		auditRemoteAction(ctx, audit.Event_RemoteInput, data.BlockId, string(inputUnion.InputData))
+		if bytes.IndexByte(inputUnion.InputData, '\r') >= 0 {
+			countConnCommand(ctx, data.BlockId)
+		}
 	}
 	return bc.SendInput(inputUnion)
 }
@@ -584,6 +639,9 @@ func (ws *WshServer) SetConnectionsConfigCommand(ctx context.Context, data wshrp
 
 func (ws *WshServer) ConnStatusCommand(ctx context.Context) ([]wshrpc.ConnStatus, error) {
 	rtn := conncontroller.GetAllConnStatus()
+	rtn = append(rtn, k8s.GetAllConnStatus()...)
+	rtn = append(rtn, docker.GetAllConnStatus()...)
+	rtn = append(rtn, telnet.GetAllConnStatus()...)
 	return rtn, nil
 }
 
@@ -592,11 +650,49 @@ func (ws *WshServer) WslStatusCommand(ctx context.Context) ([]wshrpc.ConnStatus,
 	return rtn, nil
 }
 
+// the wsh helper versions of the ssh and wsl connections
+func (ws *WshServer) WshHelperStatusCommand(ctx context.Context) ([]wshrpc.WshHelperStatus, error) {
+	rtn := conncontroller.GetAllWshHelperStatus()
+	rtn = append(rtn, wsl.GetAllWshHelperStatus()...)
+	return rtn, nil
+}
+
+// attaches the caller's tab/block to ctx so connection prompts open in the caller's window
+func withCallerInputRoute(ctx context.Context) context.Context {
+	route := &userinput.InputRoute{}
+	if handler := wshutil.GetRpcResponseHandlerFromContext(ctx); handler != nil {
+		rpcContext := handler.GetRpcContext()
+		route.TabId = rpcContext.TabId
+		route.BlockId = rpcContext.BlockId
+		source := handler.GetSource()
+		if strings.HasPrefix(source, "tab:") && route.TabId == "" {
+			route.TabId = strings.TrimPrefix(source, "tab:")
+		}
+		if strings.HasPrefix(source, "feblock:") && route.BlockId == "" {
+			route.BlockId = strings.TrimPrefix(source, "feblock:")
+		}
+	}
+	if route.TabId == "" && route.BlockId == "" {
+		return ctx
+	}
+	return userinput.WithRoute(ctx, route)
+}
+
 func (ws *WshServer) ConnEnsureCommand(ctx context.Context, connName string) error {
+	ctx = withCallerInputRoute(ctx)
 	if strings.HasPrefix(connName, "wsl://") {
 		distroName := strings.TrimPrefix(connName, "wsl://")
 		return wsl.EnsureConnection(ctx, distroName)
 	}
+	if k8s.IsK8sConnName(connName) {
+		return k8s.EnsureConnection(ctx, connName)
+	}
+	if docker.IsContainerConnName(connName) {
+		return docker.EnsureConnection(ctx, connName)
+	}
+	if telnet.IsTelnetConnName(connName) {
+		return telnet.EnsureConnection(ctx, connName)
+	}
 	return conncontroller.EnsureConnection(ctx, connName)
 }
 
@@ -609,6 +705,27 @@ func (ws *WshServer) ConnDisconnectCommand(ctx context.Context, connName string)
 		}
 		return conn.Close()
 	}
+	if k8s.IsK8sConnName(connName) {
+		conn, err := k8s.GetK8sConn(ctx, connName, false)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+	if docker.IsContainerConnName(connName) {
+		conn, err := docker.GetContainerConn(ctx, connName, false)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+	if telnet.IsTelnetConnName(connName) {
+		conn, err := telnet.GetTelnetConn(ctx, connName, false)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
 	connOpts, err := remote.ParseOpts(connName)
 	if err != nil {
 		return fmt.Errorf("error parsing connection name: %w", err)
@@ -621,6 +738,14 @@ func (ws *WshServer) ConnDisconnectCommand(ctx context.Context, connName string)
 }
 
 func (ws *WshServer) ConnConnectCommand(ctx context.Context, connRequest wshrpc.ConnRequest) error {
+	ctx = withCallerInputRoute(ctx)
+	if connRequest.Headless != nil {
+		var err error
+		ctx, err = remote.WithHeadless(ctx, connRequest.Headless)
+		if err != nil {
+			return err
+		}
+	}
 	connName := connRequest.Host
 	if strings.HasPrefix(connName, "wsl://") {
 		distroName := strings.TrimPrefix(connName, "wsl://")
@@ -630,6 +755,27 @@ func (ws *WshServer) ConnConnectCommand(ctx context.Context, connRequest wshrpc.
 		}
 		return conn.Connect(ctx)
 	}
+	if k8s.IsK8sConnName(connName) {
+		conn, err := k8s.GetK8sConn(ctx, connName, false)
+		if err != nil {
+			return err
+		}
+		return conn.Connect(ctx)
+	}
+	if docker.IsContainerConnName(connName) {
+		conn, err := docker.GetContainerConn(ctx, connName, false)
+		if err != nil {
+			return err
+		}
+		return conn.Connect(ctx)
+	}
+	if telnet.IsTelnetConnName(connName) {
+		conn, err := telnet.GetTelnetConn(ctx, connName, false)
+		if err != nil {
+			return err
+		}
+		return conn.Connect(ctx)
+	}
 	connOpts, err := remote.ParseOpts(connName)
 	if err != nil {
 		return fmt.Errorf("error parsing connection name: %w", err)
@@ -642,6 +788,7 @@ func (ws *WshServer) ConnConnectCommand(ctx context.Context, connRequest wshrpc.
 }
 
 func (ws *WshServer) ConnReinstallWshCommand(ctx context.Context, connName string) error {
+	ctx = withCallerInputRoute(ctx)
 	if strings.HasPrefix(connName, "wsl://") {
 		distroName := strings.TrimPrefix(connName, "wsl://")
 		conn := wsl.GetWslConn(ctx, distroName, false)
@@ -650,6 +797,15 @@ func (ws *WshServer) ConnReinstallWshCommand(ctx context.Context, connName strin
 		}
 		return conn.CheckAndInstallWsh(ctx, connName, &wsl.WshInstallOpts{Force: true, NoUserPrompt: true})
 	}
+	if k8s.IsK8sConnName(connName) {
+		return fmt.Errorf("wsh is not installed on kubernetes connections")
+	}
+	if docker.IsContainerConnName(connName) {
+		return fmt.Errorf("wsh is not installed on container connections")
+	}
+	if telnet.IsTelnetConnName(connName) {
+		return fmt.Errorf("wsh is not installed on telnet connections")
+	}
 	connOpts, err := remote.ParseOpts(connName)
 	if err != nil {
 		return fmt.Errorf("error parsing connection name: %w", err)
@@ -681,6 +837,33 @@ func (ws *WshServer) WslListCommand(ctx context.Context) ([]string, error) {
 	return distroNames, nil
 }
 
+func (ws *WshServer) TailscalePeersCommand(ctx context.Context) ([]wshrpc.TailscalePeer, error) {
+	return remote.ListTailscalePeers(ctx)
+}
+
+func (ws *WshServer) DiscoverHostsCommand(ctx context.Context, data wshrpc.CommandDiscoverHostsData) ([]wshrpc.DiscoveredHost, error) {
+	hosts, err := remote.DiscoverHosts(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	connList, err := conncontroller.GetConnectionsList()
+	if err != nil {
+		log.Printf("unable to get the connection list for discovered hosts: %v\n", err)
+	}
+	for idx := range hosts {
+		hosts[idx].Known = utilfn.ContainsStr(connList, hosts[idx].Connection)
+	}
+	return hosts, nil
+}
+
+func (ws *WshServer) ContainerListCommand(ctx context.Context) ([]wshrpc.ContainerInfo, error) {
+	return docker.ListContainers(ctx)
+}
+
+func (ws *WshServer) VagrantListCommand(ctx context.Context) ([]wshrpc.VagrantMachine, error) {
+	return remote.ListVagrantMachines(ctx)
+}
+
 func (ws *WshServer) WslDefaultDistroCommand(ctx context.Context) (string, error) {
 	distro, ok, err := wsl.DefaultDistro(ctx)
 	if err != nil {
@@ -696,6 +879,9 @@ func (ws *WshServer) WslDefaultDistroCommand(ctx context.Context) (string, error
  * Dismisses the WshFail Command in runtime memory on the backend
  */
 func (ws *WshServer) DismissWshFailCommand(ctx context.Context, connName string) error {
+	if k8s.IsK8sConnName(connName) || docker.IsContainerConnName(connName) || telnet.IsTelnetConnName(connName) {
+		return nil
+	}
 	opts, err := remote.ParseOpts(connName)
 	if err != nil {
 		return err
@@ -711,6 +897,622 @@ func (ws *WshServer) DismissWshFailCommand(ctx context.Context, connName string)
 	return nil
 }
 
+func (ws *WshServer) SetLogLevelCommand(ctx context.Context, data wshrpc.CommandSetLogLevelData) error {
+	if data.Clear {
+		if data.Package == "" {
+			return fmt.Errorf("cannot clear the default log level")
+		}
+		wlog.ClearLevel(data.Package)
+		return nil
+	}
+	level, err := wlog.ParseLevel(data.Level)
+	if err != nil {
+		return err
+	}
+	wlog.SetLevel(data.Package, level)
+	return nil
+}
+
+func (ws *WshServer) GetLogLevelsCommand(ctx context.Context) (map[string]string, error) {
+	return wlog.GetLevels(), nil
+}
+
+func (ws *WshServer) CollectLogsCommand(ctx context.Context) (string, error) {
+	fileName := fmt.Sprintf("wavelogs-%s.zip", time.Now().Format("20060102-150405"))
+	destPath := filepath.Join(os.TempDir(), fileName)
+	appLogPath := filepath.Join(wavebase.GetWaveDataDir(), wavebase.WaveAppLogFileName)
+	err := wlog.CollectLogs(destPath, []string{appLogPath})
+	if err != nil {
+		return "", fmt.Errorf("collecting logs: %w", err)
+	}
+	return destPath, nil
+}
+
+func (ws *WshServer) PrepareDiagBundleCommand(ctx context.Context) (*wshrpc.DiagBundleInfo, error) {
+	return diagbundle.Prepare(ctx)
+}
+
+func (ws *WshServer) GetDiagBundleItemCommand(ctx context.Context, data wshrpc.CommandDiagBundleItemData) (string, error) {
+	return diagbundle.GetItem(data.BundleId, data.Name)
+}
+
+func (ws *WshServer) WriteDiagBundleCommand(ctx context.Context, data wshrpc.CommandWriteDiagBundleData) (string, error) {
+	path, err := diagbundle.Write(data.BundleId, data.Path)
+	if err != nil {
+		return "", fmt.Errorf("writing diagnostic bundle: %w", err)
+	}
+	return path, nil
+}
+
+func (ws *WshServer) WaveStatsSubscribeCommand(ctx context.Context, blockId string) error {
+	return wavestats.Subscribe(ctx, blockId)
+}
+
+func (ws *WshServer) WaveStatsUnsubscribeCommand(ctx context.Context, blockId string) error {
+	wavestats.Unsubscribe(blockId)
+	return nil
+}
+
+func (ws *WshServer) GetWaveStatsCommand(ctx context.Context) (*wshrpc.TimeSeriesData, error) {
+	stats := wavestats.GetLatest()
+	return &stats, nil
+}
+
+func (ws *WshServer) RecordingStartCommand(ctx context.Context, data wshrpc.CommandRecordingStartData) (*wshrpc.RecordingInfo, error) {
+	return blockcontroller.StartRecording(ctx, data)
+}
+
+func (ws *WshServer) RecordingStopCommand(ctx context.Context, blockId string) (*wshrpc.RecordingInfo, error) {
+	return blockcontroller.StopRecording(blockId)
+}
+
+func (ws *WshServer) RecordingListCommand(ctx context.Context, blockId string) ([]wshrpc.RecordingInfo, error) {
+	return blockcontroller.ListRecordings(ctx, blockId)
+}
+
+func (ws *WshServer) RecordingExportCommand(ctx context.Context, data wshrpc.CommandRecordingExportData) (string, error) {
+	return blockcontroller.ExportRecording(ctx, data)
+}
+
+func (ws *WshServer) UsageStatsCommand(ctx context.Context, data wshrpc.CommandUsageStatsData) (*wshrpc.UsageStatsSummary, error) {
+	if data.Clear {
+		return nil, usagestats.Clear(ctx)
+	}
+	return usagestats.GetSummary(ctx, data.Days)
+}
+
+func (ws *WshServer) AiListModelsCommand(ctx context.Context, data wshrpc.CommandAiListModelsData) ([]string, error) {
+	opts := data.Opts
+	if opts == nil {
+		var err error
+		opts, err = waveai.ResolveOpts(data.Preset)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return waveai.ListModels(ctx, opts)
+}
+
+func (ws *WshServer) AiListPresetsCommand(ctx context.Context) ([]wshrpc.AiPresetInfo, error) {
+	return waveai.ListPresets(), nil
+}
+
+func (ws *WshServer) AiSetPresetCommand(ctx context.Context, data wshrpc.CommandAiSetPresetData) error {
+	meta, err := waveai.GetPresetMeta(data.Preset)
+	if err != nil {
+		return err
+	}
+	oref := waveobj.MakeORef(waveobj.OType_Block, data.BlockId)
+	block, err := wstore.DBMustGet[*waveobj.Block](ctx, data.BlockId)
+	if err != nil {
+		return fmt.Errorf("error getting block: %w", err)
+	}
+	if block.Meta.GetString(waveobj.MetaKey_View, "") != "waveai" {
+		return fmt.Errorf("block %s is not an ai block", data.BlockId)
+	}
+	// "ai:*" in the preset clears the block's other ai settings (same as picking the preset in the ai block)
+	err = wstore.UpdateObjectMeta(ctx, oref, meta, true)
+	if err != nil {
+		return fmt.Errorf("error updating block meta: %w", err)
+	}
+	sendWaveObjUpdate(oref)
+	return nil
+}
+
+func (ws *WshServer) AiTermContextCommand(ctx context.Context, data wshrpc.CommandAiTermContextData) (string, error) {
+	return waveai.GetTermContext(ctx, data)
+}
+
+func (ws *WshServer) AiSuggestCmdCommand(ctx context.Context, data wshrpc.CommandAiSuggestCmdData) (*wshrpc.AiCmdSuggestion, error) {
+	return waveai.SuggestCmd(ctx, data)
+}
+
+func (ws *WshServer) AiChatListCommand(ctx context.Context, data wshrpc.CommandAiChatListData) ([]wshrpc.AiChatInfo, error) {
+	return waveai.ListChats(ctx, data)
+}
+
+func (ws *WshServer) AiChatExportCommand(ctx context.Context, data wshrpc.CommandAiChatData) (string, error) {
+	return waveai.ExportChatMarkdown(ctx, data)
+}
+
+func (ws *WshServer) AiChatResumeCommand(ctx context.Context, data wshrpc.CommandAiChatData) error {
+	return waveai.ResumeChat(ctx, data)
+}
+
+func (ws *WshServer) AiChatRenameCommand(ctx context.Context, data wshrpc.CommandAiChatData) error {
+	return waveai.RenameChat(ctx, data)
+}
+
+func (ws *WshServer) AiUsageCommand(ctx context.Context) (*wshrpc.AiUsageSummary, error) {
+	return waveai.GetAiUsage(ctx)
+}
+
+// inserts the command at the terminal's prompt.  newlines are removed so it is never run,
+// the user has to press enter.
+func (ws *WshServer) AiAcceptCmdCommand(ctx context.Context, data wshrpc.CommandAiAcceptCmdData) error {
+	block, err := wstore.DBMustGet[*waveobj.Block](ctx, data.BlockId)
+	if err != nil {
+		return fmt.Errorf("error getting block: %w", err)
+	}
+	if block.Meta.GetString(waveobj.MetaKey_Controller, "") != blockcontroller.BlockController_Shell {
+		return fmt.Errorf("block %s is not a shell terminal", data.BlockId)
+	}
+	bc := blockcontroller.GetBlockController(data.BlockId)
+	if bc == nil {
+		return fmt.Errorf("block controller not found for block %q", data.BlockId)
+	}
+	cmdStr := waveai.CleanSuggestedCmd(data.Command)
+	if cmdStr == "" {
+		return fmt.Errorf("no command to insert")
+	}
+	auditRemoteAction(ctx, audit.Event_RemoteInput, data.BlockId, cmdStr)
+	inputUnion := &blockcontroller.BlockInputUnion{InputData: []byte(cmdStr)}
+	if !data.AtNextPrompt {
+		return bc.SendInput(inputUnion)
+	}
+	go func() {
+		defer panichandler.PanicHandler("AiAcceptCmdCommand:atnextprompt")
+		waitForNextPrompt(data.BlockId)
+		err := bc.SendInput(inputUnion)
+		if err != nil {
+			log.Printf("error inserting ai command into block %s: %v\n", data.BlockId, err)
+		}
+	}()
+	return nil
+}
+
+const NextPromptTimeout = 10 * time.Second
+const NextPromptPollInterval = 50 * time.Millisecond
+
+// waits until the shell shows its next prompt (or a short delay without shell integration)
+func waitForNextPrompt(blockId string) {
+	siInfo := blockcontroller.GetShellIntegrationInfo(blockId)
+	if siInfo == nil || !siInfo.InCommand {
+		time.Sleep(500 * time.Millisecond)
+		return
+	}
+	startPrompts := siInfo.NumPrompts
+	deadline := time.Now().Add(NextPromptTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(NextPromptPollInterval)
+		siInfo = blockcontroller.GetShellIntegrationInfo(blockId)
+		if siInfo == nil || siInfo.NumPrompts > startPrompts {
+			break
+		}
+	}
+	// the prompt marker is written just before the shell starts reading input
+	time.Sleep(100 * time.Millisecond)
+}
+
+func (ws *WshServer) AuditEventsCommand(ctx context.Context, data wshrpc.CommandAuditEventsData) ([]wshrpc.AuditEvent, error) {
+	return audit.GetEvents(ctx, data)
+}
+
+func (ws *WshServer) DebugPprofInfoCommand(ctx context.Context) (*wshrpc.DebugPprofInfo, error) {
+	return wavedebug.GetInfo(), nil
+}
+
+func (ws *WshServer) TelemetryPreviewCommand(ctx context.Context) (*wshrpc.TelemetryPreviewData, error) {
+	client, err := wstore.DBGetSingleton[*waveobj.Client](ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting client: %w", err)
+	}
+	input, _, err := wcloud.MakeTelemetryInput(ctx, client.OID)
+	if err != nil {
+		return nil, err
+	}
+	rtn := &wshrpc.TelemetryPreviewData{
+		Categories: telemetry.GetEnabledCategories(),
+		Url:        wcloud.GetEndpoint() + wcloud.TelemetryUrl,
+	}
+	if input != nil {
+		rtn.Payload = input
+	}
+	return rtn, nil
+}
+
+func (ws *WshServer) ConnDebugLogCommand(ctx context.Context, data wshrpc.CommandConnDebugLogData) (string, error) {
+	if data.Clear {
+		return "", conndebug.ClearLog(ctx, data.Connection)
+	}
+	return conndebug.ReadLog(ctx, data.Connection)
+}
+
+// "" lists the forwards for all connections
+func (ws *WshServer) ConnListForwardsCommand(ctx context.Context, connName string) ([]wshrpc.PortForwardInfo, error) {
+	if connName == "" {
+		return conncontroller.GetAllForwards(), nil
+	}
+	conn, err := getSshConnForForward(ctx, connName)
+	if err != nil {
+		return nil, err
+	}
+	rtn := conn.GetForwards()
+	if rtn == nil {
+		rtn = []wshrpc.PortForwardInfo{}
+	}
+	return rtn, nil
+}
+
+func (ws *WshServer) ConnAddForwardCommand(ctx context.Context, data wshrpc.CommandConnForwardData) (*wshrpc.PortForwardInfo, error) {
+	conn, err := getSshConnForForward(ctx, data.Connection)
+	if err != nil {
+		return nil, err
+	}
+	info, err := conn.AddForward(data.Type, data.Spec)
+	if err != nil {
+		return nil, err
+	}
+	if data.Save {
+		err = saveForwardConfig(data, true)
+		if err != nil {
+			return info, fmt.Errorf("forward started, but could not be saved: %w", err)
+		}
+	}
+	return info, nil
+}
+
+func (ws *WshServer) ConnRemoveForwardCommand(ctx context.Context, data wshrpc.CommandConnForwardData) error {
+	conn, err := getSshConnForForward(ctx, data.Connection)
+	if err != nil {
+		return err
+	}
+	removeErr := conn.RemoveForward(data.Type, data.Spec)
+	if data.Save {
+		// the forward might be configured but not running (the connection is down)
+		return saveForwardConfig(data, false)
+	}
+	return removeErr
+}
+
+// returns a socks5:// url for a proxy that connects through the connection
+func (ws *WshServer) ConnSocksProxyCommand(ctx context.Context, connName string) (string, error) {
+	conn, err := getSshConnForForward(ctx, connName)
+	if err != nil {
+		return "", err
+	}
+	addr, err := conn.GetSocksProxy()
+	if err != nil {
+		return "", err
+	}
+	return "socks5://" + addr, nil
+}
+
+func (ws *WshServer) ConnStatsCommand(ctx context.Context, connName string) (*wshrpc.ConnStatsInfo, error) {
+	if connName == "" || connName == "local" || strings.HasPrefix(connName, "wsl://") || k8s.IsK8sConnName(connName) || docker.IsContainerConnName(connName) || telnet.IsTelnetConnName(connName) {
+		return nil, fmt.Errorf("stats are only available for ssh connections")
+	}
+	conn, err := getSshConn(ctx, connName)
+	if err != nil {
+		return nil, err
+	}
+	return conn.GetStats()
+}
+
+func getSshConnForForward(ctx context.Context, connName string) (*conncontroller.SSHConn, error) {
+	if connName == "" || connName == "local" || strings.HasPrefix(connName, "wsl://") || k8s.IsK8sConnName(connName) || docker.IsContainerConnName(connName) || telnet.IsTelnetConnName(connName) {
+		return nil, fmt.Errorf("port forwarding is only supported on ssh connections")
+	}
+	return getSshConn(ctx, connName)
+}
+
+func getSshConn(ctx context.Context, connName string) (*conncontroller.SSHConn, error) {
+	connOpts, err := remote.ParseOpts(connName)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing connection name: %w", err)
+	}
+	conn := conncontroller.GetConn(ctx, connOpts, false, &wshrpc.ConnKeywords{})
+	if conn == nil {
+		return nil, fmt.Errorf("connection not found: %s", connName)
+	}
+	return conn, nil
+}
+
+func saveForwardConfig(data wshrpc.CommandConnForwardData, add bool) error {
+	var configKey string
+	var specs []string
+	connSettings := wconfig.ReadFullConfig().Connections[data.Connection]
+	switch data.Type {
+	case wshrpc.ForwardType_Local:
+		configKey = "ssh:localforward"
+		specs = connSettings.SshLocalForward
+	case wshrpc.ForwardType_Remote:
+		configKey = "ssh:remoteforward"
+		specs = connSettings.SshRemoteForward
+	case wshrpc.ForwardType_Dynamic:
+		configKey = "ssh:dynamicforward"
+		specs = connSettings.SshDynamicForward
+	default:
+		return fmt.Errorf("unknown forward type %q", data.Type)
+	}
+	newSpecs := []string{}
+	for _, spec := range specs {
+		if spec != data.Spec {
+			newSpecs = append(newSpecs, spec)
+		}
+	}
+	if add {
+		newSpecs = append(newSpecs, data.Spec)
+	} else if len(newSpecs) == len(specs) {
+		return fmt.Errorf("%s forward %q is not in the config for %s", data.Type, data.Spec, data.Connection)
+	}
+	var val any = newSpecs
+	if len(newSpecs) == 0 {
+		val = nil
+	}
+	return wconfig.SetConnectionsConfigValue(data.Connection, waveobj.MetaMapType{configKey: val})
+}
+
+func (ws *WshServer) ConnImportCommand(ctx context.Context, data wshrpc.CommandConnImportData) (*wshrpc.ConnImportResult, error) {
+	return remote.ImportConnections(data)
+}
+
+func (ws *WshServer) ConnListInfoCommand(ctx context.Context, data wshrpc.ConnListFilter) ([]wshrpc.ConnListEntry, error) {
+	return conncontroller.ListConnectionInfo(data)
+}
+
+// copies a file between this machine and an ssh connection (over the connection's ssh client,
+// so wsh doesn't need to be installed), streaming progress back to the caller
+func (ws *WshServer) ConnCopyFileCommand(ctx context.Context, data wshrpc.CommandConnCopyFileData) chan wshrpc.RespOrErrorUnion[wshrpc.ConnCopyFileProgress] {
+	rtn := make(chan wshrpc.RespOrErrorUnion[wshrpc.ConnCopyFileProgress])
+	go func() {
+		defer func() {
+			panichandler.PanicHandler("ConnCopyFileCommand")
+			close(rtn)
+		}()
+		err := connCopyFile(ctx, data, func(progress wshrpc.ConnCopyFileProgress) {
+			rtn <- wshrpc.RespOrErrorUnion[wshrpc.ConnCopyFileProgress]{Response: progress}
+			wps.Broker.Publish(wps.WaveEvent{
+				Event:  wps.Event_ConnFileCopy,
+				Scopes: []string{fmt.Sprintf("connection:%s", data.Connection)},
+				Data:   progress,
+			})
+		})
+		if err != nil {
+			rtn <- wshrpc.RespOrErrorUnion[wshrpc.ConnCopyFileProgress]{Error: err}
+		}
+	}()
+	return rtn
+}
+
+// runs a command on several ssh connections at once, streaming each one's output back
+func (ws *WshServer) ConnBroadcastCommand(ctx context.Context, data wshrpc.CommandConnBroadcastData) chan wshrpc.RespOrErrorUnion[wshrpc.ConnBroadcastEvent] {
+	rtn := make(chan wshrpc.RespOrErrorUnion[wshrpc.ConnBroadcastEvent])
+	go func() {
+		defer func() {
+			panichandler.PanicHandler("ConnBroadcastCommand")
+			close(rtn)
+		}()
+		log.Printf("conn broadcast: %d connections, %q\n", len(data.Connections), data.Command)
+		err := conncontroller.Broadcast(ctx, data, func(event wshrpc.ConnBroadcastEvent) {
+			rtn <- wshrpc.RespOrErrorUnion[wshrpc.ConnBroadcastEvent]{Response: event}
+		})
+		if err != nil {
+			rtn <- wshrpc.RespOrErrorUnion[wshrpc.ConnBroadcastEvent]{Error: err}
+		}
+	}()
+	return rtn
+}
+
+func (ws *WshServer) ConnMountCommand(ctx context.Context, data wshrpc.CommandConnMountData) (*wshrpc.MountInfo, error) {
+	return conncontroller.Mount(ctx, data)
+}
+
+func (ws *WshServer) ConnUnmountCommand(ctx context.Context, name string) error {
+	return conncontroller.Unmount(name)
+}
+
+func (ws *WshServer) ConnListMountsCommand(ctx context.Context) ([]wshrpc.MountInfo, error) {
+	return conncontroller.GetMounts(), nil
+}
+
+// runs a one-off command on a connected ssh connection, streaming its output back
+func (ws *WshServer) ConnExecCommand(ctx context.Context, data wshrpc.CommandConnExecData) chan wshrpc.RespOrErrorUnion[wshrpc.ConnExecEvent] {
+	rtn := make(chan wshrpc.RespOrErrorUnion[wshrpc.ConnExecEvent])
+	go func() {
+		defer func() {
+			panichandler.PanicHandler("ConnExecCommand")
+			close(rtn)
+		}()
+		err := connExec(ctx, data, func(event wshrpc.ConnExecEvent) {
+			rtn <- wshrpc.RespOrErrorUnion[wshrpc.ConnExecEvent]{Response: event}
+		})
+		if err != nil {
+			rtn <- wshrpc.RespOrErrorUnion[wshrpc.ConnExecEvent]{Error: err}
+		}
+	}()
+	return rtn
+}
+
+func connExec(ctx context.Context, data wshrpc.CommandConnExecData, eventFn func(wshrpc.ConnExecEvent)) error {
+	if data.Connection == "" || data.Connection == "local" || strings.HasPrefix(data.Connection, "wsl://") || k8s.IsK8sConnName(data.Connection) || docker.IsContainerConnName(data.Connection) || telnet.IsTelnetConnName(data.Connection) {
+		return fmt.Errorf("exec is only supported on ssh connections")
+	}
+	conn, err := getSshConn(ctx, data.Connection)
+	if err != nil {
+		return err
+	}
+	return conn.Exec(ctx, data, eventFn)
+}
+
+func connCopyFile(ctx context.Context, data wshrpc.CommandConnCopyFileData, progressFn func(wshrpc.ConnCopyFileProgress)) error {
+	if data.Connection == "" || data.Connection == "local" || strings.HasPrefix(data.Connection, "wsl://") || k8s.IsK8sConnName(data.Connection) || docker.IsContainerConnName(data.Connection) || telnet.IsTelnetConnName(data.Connection) {
+		return fmt.Errorf("file copies are only supported on ssh connections")
+	}
+	conn, err := getSshConn(ctx, data.Connection)
+	if err != nil {
+		return err
+	}
+	client := conn.GetClient()
+	if client == nil || conn.GetStatus() != conncontroller.Status_Connected {
+		return fmt.Errorf("connection %q is not connected", data.Connection)
+	}
+	// keeps the (shared) client open until the copy is done, even if the connection is closed
+	if !remote.RetainClient(client) {
+		return fmt.Errorf("connection %q is closing", data.Connection)
+	}
+	defer remote.ReleaseClient(client)
+	data.LocalPath, err = wavebase.ExpandHomeDir(data.LocalPath)
+	if err != nil {
+		return err
+	}
+	log.Printf("conn copy file: %s %s %s %s\n", data.Connection, data.Direction, data.LocalPath, data.RemotePath)
+	return remote.CopyFile(ctx, client, data, progressFn)
+}
+
+// syncs a local and a remote directory, streaming the progress back
+func (ws *WshServer) ConnSyncCommand(ctx context.Context, data wshrpc.CommandConnSyncData) chan wshrpc.RespOrErrorUnion[wshrpc.ConnSyncProgress] {
+	rtn := make(chan wshrpc.RespOrErrorUnion[wshrpc.ConnSyncProgress])
+	go func() {
+		defer func() {
+			panichandler.PanicHandler("ConnSyncCommand")
+			close(rtn)
+		}()
+		err := connSync(ctx, data, func(progress wshrpc.ConnSyncProgress) {
+			rtn <- wshrpc.RespOrErrorUnion[wshrpc.ConnSyncProgress]{Response: progress}
+		})
+		if err != nil {
+			rtn <- wshrpc.RespOrErrorUnion[wshrpc.ConnSyncProgress]{Error: err}
+		}
+	}()
+	return rtn
+}
+
+func connSync(ctx context.Context, data wshrpc.CommandConnSyncData, progressFn func(wshrpc.ConnSyncProgress)) error {
+	if data.Connection == "" || data.Connection == "local" || strings.HasPrefix(data.Connection, "wsl://") || k8s.IsK8sConnName(data.Connection) || docker.IsContainerConnName(data.Connection) || telnet.IsTelnetConnName(data.Connection) {
+		return fmt.Errorf("sync is only supported on ssh connections")
+	}
+	conn, err := getSshConn(ctx, data.Connection)
+	if err != nil {
+		return err
+	}
+	client := conn.GetClient()
+	if client == nil || conn.GetStatus() != conncontroller.Status_Connected {
+		return fmt.Errorf("connection %q is not connected", data.Connection)
+	}
+	if !remote.RetainClient(client) {
+		return fmt.Errorf("connection %q is closing", data.Connection)
+	}
+	defer remote.ReleaseClient(client)
+	data.LocalPath, err = wavebase.ExpandHomeDir(data.LocalPath)
+	if err != nil {
+		return err
+	}
+	log.Printf("conn sync: %s %s %s %s (watch:%v)\n", data.Connection, data.Direction, data.LocalPath, data.RemotePath, data.Watch)
+	return remote.SyncDir(ctx, client, data, progressFn)
+}
+
+func getKnownHostsConnName(connName string) (string, error) {
+	if connName == "local" || strings.HasPrefix(connName, "wsl://") || k8s.IsK8sConnName(connName) || docker.IsContainerConnName(connName) || telnet.IsTelnetConnName(connName) {
+		return "", fmt.Errorf("known_hosts is only used by ssh connections")
+	}
+	return connName, nil
+}
+
+func (ws *WshServer) KnownHostsListCommand(ctx context.Context, data wshrpc.CommandKnownHostsData) ([]wshrpc.KnownHostEntry, error) {
+	connName, err := getKnownHostsConnName(data.Connection)
+	if err != nil {
+		return nil, err
+	}
+	files, host, err := remote.GetKnownHostsTarget(connName, data.Host)
+	if err != nil {
+		return nil, err
+	}
+	return remote.ListKnownHosts(files, host)
+}
+
+// fetches the host's current key and compares it with known_hosts (a connection is required)
+func (ws *WshServer) KnownHostsVerifyCommand(ctx context.Context, data wshrpc.CommandKnownHostsData) (*wshrpc.KnownHostsVerifyResult, error) {
+	connName, err := getKnownHostsConnName(data.Connection)
+	if err != nil {
+		return nil, err
+	}
+	if connName == "" {
+		return nil, fmt.Errorf("a connection is required to verify its host key")
+	}
+	return remote.VerifyKnownHost(ctx, connName)
+}
+
+// removes the host's keys from known_hosts, returns the number of entries removed
+func (ws *WshServer) KnownHostsDeleteCommand(ctx context.Context, data wshrpc.CommandKnownHostsData) (int, error) {
+	connName, err := getKnownHostsConnName(data.Connection)
+	if err != nil {
+		return 0, err
+	}
+	files, host, err := remote.GetKnownHostsTarget(connName, data.Host)
+	if err != nil {
+		return 0, err
+	}
+	numRemoved, err := remote.DeleteKnownHosts(files, host, data.Fingerprint)
+	if numRemoved > 0 {
+		details := host
+		if data.Fingerprint != "" {
+			details += " " + data.Fingerprint
+		}
+		audit.Record(audit.Event_HostKeyRemoved, connName, "", fmt.Sprintf("%s (%d entries)", details, numRemoved))
+	}
+	return numRemoved, err
+}
+
+func (ws *WshServer) ListRememberedAnswersCommand(ctx context.Context, connName string) ([]wshrpc.RememberedAnswer, error) {
+	return userinput.ListRememberedAnswers(connName), nil
+}
+
+func (ws *WshServer) ClearRememberedAnswersCommand(ctx context.Context, data wshrpc.CommandClearRememberedAnswersData) error {
+	return userinput.ClearRememberedAnswers(data.Connection, data.Key)
+}
+
+// forgets the key passphrases cached in memory, returns how many there were
+func (ws *WshServer) PassphraseCacheFlushCommand(ctx context.Context) (int, error) {
+	return remote.FlushPassphraseCache(), nil
+}
+
+func (ws *WshServer) KeychainListCommand(ctx context.Context) ([]wshrpc.StoredSecret, error) {
+	return keychain.List(), nil
+}
+
+func (ws *WshServer) KeychainDeleteCommand(ctx context.Context, data wshrpc.CommandKeychainDeleteData) error {
+	if data.All {
+		return keychain.DeleteAll()
+	}
+	if data.Key == "" {
+		return fmt.Errorf("no key given")
+	}
+	return keychain.Delete(data.Key)
+}
+
+func (ws *WshServer) KeychainSetTotpCommand(ctx context.Context, data wshrpc.CommandKeychainSetTotpData) error {
+	opts, err := remote.ParseOpts(data.Connection)
+	if err != nil {
+		return err
+	}
+	if err := remote.ValidateTotpSecret(data.Secret); err != nil {
+		return err
+	}
+	connName := opts.String()
+	return keychain.Set(keychain.TotpKey(connName), connName, strings.TrimSpace(data.Secret))
+}
+
 func (ws *WshServer) BlockInfoCommand(ctx context.Context, blockId string) (*wshrpc.BlockInfoData, error) {
 	blockData, err := wstore.DBMustGet[*waveobj.Block](ctx, blockId)
 	if err != nil {
@@ -770,6 +1572,32 @@ func (ws *WshServer) WorkspaceListCommand(ctx context.Context) ([]wshrpc.Workspa
 	return rtn, nil
 }
 
+func (ws *WshServer) WorkspaceHandoffExportCommand(ctx context.Context, workspaceId string) (*wshrpc.WorkspaceHandoffData, error) {
+	if workspaceId == "" {
+		return nil, fmt.Errorf("no workspace specified")
+	}
+	return wcore.ExportWorkspace(ctx, workspaceId)
+}
+
+func (ws *WshServer) WorkspaceHandoffImportCommand(ctx context.Context, data wshrpc.CommandWorkspaceHandoffImportData) (string, error) {
+	workspaceId, err := wcore.ImportWorkspace(ctx, data.Handoff)
+	if err != nil {
+		return "", fmt.Errorf("error importing workspace: %w", err)
+	}
+	if !data.Open {
+		return workspaceId, nil
+	}
+	window, err := wcore.CreateWindow(ctx, nil, workspaceId)
+	if err != nil {
+		return workspaceId, fmt.Errorf("error creating window: %w", err)
+	}
+	err = wshclient.FocusWindowCommand(wshclient.GetBareRpcClient(), window.OID, &wshrpc.RpcOpts{Route: wshutil.ElectronRoute})
+	if err != nil {
+		return workspaceId, fmt.Errorf("error opening window: %w", err)
+	}
+	return workspaceId, nil
+}
+
 var wshActivityRe = regexp.MustCompile(`^[a-z:#]+$`)
 
 func (ws *WshServer) WshActivityCommand(ctx context.Context, data map[string]int) error {
@@ -796,6 +1624,12 @@ func (ws *WshServer) WshActivityCommand(ctx context.Context, data map[string]int
 
 func (ws *WshServer) ActivityCommand(ctx context.Context, activity wshrpc.ActivityUpdate) error {
 	telemetry.GoUpdateActivityWrap(activity, "wshrpc-activity")
+	if activity.ActiveMinutes > 0 {
+		usagestats.GoAdd(usagestats.Stat_ActiveMinutes, "", int64(activity.ActiveMinutes))
+	}
+	if activity.FgMinutes > 0 && activity.WorkspaceId != "" {
+		usagestats.GoAdd(usagestats.Stat_WorkspaceMinutes, activity.WorkspaceId, int64(activity.FgMinutes))
+	}
 	return nil
 }
 
@@ -844,7 +1678,7 @@ func (ws *WshServer) PathCommand(ctx context.Context, data wshrpc.PathCommandDat
 	case "data":
 		path = wavebase.GetWaveDataDir()
 	case "log":
-		path = filepath.Join(wavebase.GetWaveDataDir(), "waveapp.log")
+		path = filepath.Join(wavebase.GetWaveDataDir(), wavebase.WaveAppLogFileName)
 	}
 
 	if openInternal && openExternal {
@@ -868,3 +1702,27 @@ func (ws *WshServer) PathCommand(ctx context.Context, data wshrpc.PathCommandDat
 	}
 	return path, nil
 }
+
+func (ws *WshServer) PluginListCommand(ctx context.Context) ([]wshrpc.PluginInfo, error) {
+	return plugin.List(), nil
+}
+
+func (ws *WshServer) PluginControlCommand(ctx context.Context, data wshrpc.CommandPluginControlData) error {
+	switch data.Action {
+	case wshrpc.PluginAction_Start:
+		return plugin.Start(data.Name)
+	case wshrpc.PluginAction_Stop:
+		return plugin.Stop(data.Name)
+	case wshrpc.PluginAction_Restart:
+		return plugin.Restart(data.Name)
+	case wshrpc.PluginAction_Reload:
+		plugin.Reload()
+		return nil
+	default:
+		return fmt.Errorf("invalid plugin action %q", data.Action)
+	}
+}
+
+func (ws *WshServer) GetBusyBlocksCommand(ctx context.Context) ([]string, error) {
+	return blockcontroller.GetBusyBlockIds(), nil
+}
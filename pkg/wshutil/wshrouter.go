@@ -32,6 +32,7 @@ type routeInfo struct {
 	RpcId         string
 	SourceRouteId string
 	DestRouteId   string
+	FromRouteId   string // the local route the request came in on
 }
 
 type msgAndRoute struct {
@@ -61,6 +62,10 @@ func MakeProcRouteId(procId string) string {
 	return "proc:" + procId
 }
 
+func MakePluginRouteId(pluginName string) string {
+	return "plugin:" + pluginName
+}
+
 func MakeTabRouteId(tabId string) string {
 	return "tab:" + tabId
 }
@@ -132,13 +137,13 @@ func (router *WshRouter) handleNoRoute(msg RpcMessage) {
 	router.sendRoutedMessage(respBytes, msg.Source)
 }
 
-func (router *WshRouter) registerRouteInfo(rpcId string, sourceRouteId string, destRouteId string) {
+func (router *WshRouter) registerRouteInfo(rpcId string, sourceRouteId string, destRouteId string, fromRouteId string) {
 	if rpcId == "" {
 		return
 	}
 	router.Lock.Lock()
 	defer router.Lock.Unlock()
-	router.RpcMap[rpcId] = &routeInfo{RpcId: rpcId, SourceRouteId: sourceRouteId, DestRouteId: destRouteId}
+	router.RpcMap[rpcId] = &routeInfo{RpcId: rpcId, SourceRouteId: sourceRouteId, DestRouteId: destRouteId, FromRouteId: fromRouteId}
 }
 
 func (router *WshRouter) unregisterRouteInfo(rpcId string) {
@@ -153,6 +158,19 @@ func (router *WshRouter) getRouteInfo(rpcId string) *routeInfo {
 	return router.RpcMap[rpcId]
 }
 
+// the local route a request came in on (a remote request comes in on its connection's route).
+// unlike the request's source, this can't be set by the sender.  returns "" for unknown requests.
+func (router *WshRouter) GetRequestOrigin(rpcId string) string {
+	if rpcId == "" {
+		return ""
+	}
+	info := router.getRouteInfo(rpcId)
+	if info == nil {
+		return ""
+	}
+	return info.FromRouteId
+}
+
 func (router *WshRouter) handleAnnounceMessage(msg RpcMessage, input msgAndRoute) {
 	// if we have an upstream, send it there
 	// if we don't (we are the terminal router), then add it to our announced route map
@@ -224,13 +242,13 @@ func (router *WshRouter) runServer() {
 			continue
 		}
 		if msg.Command != "" {
-			// new comand, setup new rpc
+			// new comand, setup new rpc (registered first, so the handler can look up the request's origin)
+			router.registerRouteInfo(msg.ReqId, msg.Source, routeId, input.fromRouteId)
 			ok := router.sendRoutedMessage(msgBytes, routeId)
 			if !ok {
+				router.unregisterRouteInfo(msg.ReqId)
 				router.handleNoRoute(msg)
-				continue
 			}
-			router.registerRouteInfo(msg.ReqId, msg.Source, routeId)
 			continue
 		}
 		// look at reqid or resid to route correctly
@@ -19,6 +19,7 @@ import (
 	"github.com/wavetermdev/waveterm/pkg/util/utilfn"
 	"github.com/wavetermdev/waveterm/pkg/wps"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wtrace"
 )
 
 const DefaultTimeoutMs = 5000
@@ -264,6 +265,7 @@ func (w *WshRpc) cancelRequest(reqId string) {
 }
 
 func (w *WshRpc) handleRequest(req *RpcMessage) {
+	recordRpcRequest(req.Command)
 	// events first
 	if req.Command == wshrpc.Command_EventRecv {
 		if req.Data == nil {
@@ -287,6 +289,7 @@ func (w *WshRpc) handleRequest(req *RpcMessage) {
 	}
 	ctx, cancelFn := context.WithTimeout(context.Background(), time.Duration(timeoutMs)*time.Millisecond)
 	ctx = withWshRpcContext(ctx, w)
+	ctx, span := wtrace.StartKind(ctx, wtrace.SpanKind_Server, "rpc."+req.Command, "rpc.command", req.Command, "rpc.source", req.Source)
 	respHandler = &RpcResponseHandler{
 		w:               w,
 		ctx:             ctx,
@@ -313,10 +316,12 @@ func (w *WshRpc) handleRequest(req *RpcMessage) {
 				defer panichandler.PanicHandler("handleRequest:finalize")
 				<-ctx.Done()
 				respHandler.Finalize()
+				span.End()
 			}()
 		} else {
 			cancelFn()
 			respHandler.Finalize()
+			span.End()
 		}
 	}()
 	handlerFn := serverImplAdapter(w.ServerImpl)
@@ -539,6 +544,10 @@ func (handler *RpcResponseHandler) GetRpcContext() wshrpc.RpcContext {
 	return handler.rpcCtx
 }
 
+func (handler *RpcResponseHandler) GetReqId() string {
+	return handler.reqId
+}
+
 func (handler *RpcResponseHandler) GetSource() string {
 	return handler.source
 }
@@ -590,6 +599,7 @@ func (handler *RpcResponseHandler) SendResponseError(err error) {
 		return
 	}
 	defer handler.close()
+	wtrace.FromContext(handler.ctx).RecordError(err)
 	msg := &RpcMessage{
 		ResId:     handler.reqId,
 		Error:     err.Error(),
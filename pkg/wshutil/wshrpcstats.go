@@ -0,0 +1,31 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"sync"
+)
+
+// counts of rpc requests handled by this process (for the stats view)
+var rpcStatsLock = &sync.Mutex{}
+var rpcStatsTotal int64
+var rpcStatsByCommand = make(map[string]int64)
+
+func recordRpcRequest(command string) {
+	rpcStatsLock.Lock()
+	defer rpcStatsLock.Unlock()
+	rpcStatsTotal++
+	rpcStatsByCommand[command]++
+}
+
+// GetRpcCounts returns the cumulative number of handled rpc requests (total and by command)
+func GetRpcCounts() (int64, map[string]int64) {
+	rpcStatsLock.Lock()
+	defer rpcStatsLock.Unlock()
+	byCommand := make(map[string]int64, len(rpcStatsByCommand))
+	for command, count := range rpcStatsByCommand {
+		byCommand[command] = count
+	}
+	return rpcStatsTotal, byCommand
+}
@@ -21,7 +21,9 @@ func DefaultDistro(ctx context.Context) (d Distro, ok bool, err error) {
 	return d, false, fmt.Errorf("DefaultDistro not implemented on this system")
 }
 
-type Distro struct{}
+type Distro struct {
+	User string
+}
 
 func (d *Distro) Name() string {
 	return ""
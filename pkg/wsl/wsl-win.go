@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
 	"sync"
 
 	"github.com/ubuntu/gowsl"
@@ -20,10 +21,14 @@ var DefaultDistro = gowsl.DefaultDistro
 
 type Distro struct {
 	gowsl.Distro
+	User string // the user that commands run as (the distro's default user if empty)
 }
 
+// a command in a distro.  gowsl can only launch commands as the distro's default user, so commands
+// for another user run through wsl.exe instead (ec is set instead of c).
 type WslCmd struct {
 	c       *gowsl.Cmd
+	ec      *exec.Cmd
 	wg      *sync.WaitGroup
 	once    *sync.Once
 	lock    *sync.Mutex
@@ -34,37 +39,67 @@ func (d *Distro) WslCommand(ctx context.Context, cmd string) *WslCmd {
 	if ctx == nil {
 		panic("nil Context")
 	}
-	innerCmd := d.Command(ctx, cmd)
 	var wg sync.WaitGroup
 	var lock *sync.Mutex
-	return &WslCmd{innerCmd, &wg, new(sync.Once), lock, nil}
+	if d.User != "" {
+		// like gowsl, the command runs in the user's default shell
+		userCmd := exec.CommandContext(ctx, "wsl.exe", "-d", d.Name(), "-u", d.User, "--", cmd)
+		return &WslCmd{nil, userCmd, &wg, new(sync.Once), lock, nil}
+	}
+	innerCmd := d.Command(ctx, cmd)
+	return &WslCmd{innerCmd, nil, &wg, new(sync.Once), lock, nil}
 }
 
 func (c *WslCmd) CombinedOutput() (out []byte, err error) {
+	if c.ec != nil {
+		return c.ec.CombinedOutput()
+	}
 	return c.c.CombinedOutput()
 }
 func (c *WslCmd) Output() (out []byte, err error) {
+	if c.ec != nil {
+		return c.ec.Output()
+	}
 	return c.c.Output()
 }
 func (c *WslCmd) Run() error {
+	if c.ec != nil {
+		return c.ec.Run()
+	}
 	return c.c.Run()
 }
 func (c *WslCmd) Start() (err error) {
+	if c.ec != nil {
+		return c.ec.Start()
+	}
 	return c.c.Start()
 }
 func (c *WslCmd) StderrPipe() (r io.ReadCloser, err error) {
+	if c.ec != nil {
+		return c.ec.StderrPipe()
+	}
 	return c.c.StderrPipe()
 }
 func (c *WslCmd) StdinPipe() (w io.WriteCloser, err error) {
+	if c.ec != nil {
+		return c.ec.StdinPipe()
+	}
 	return c.c.StdinPipe()
 }
 func (c *WslCmd) StdoutPipe() (r io.ReadCloser, err error) {
+	if c.ec != nil {
+		return c.ec.StdoutPipe()
+	}
 	return c.c.StdoutPipe()
 }
 func (c *WslCmd) Wait() (err error) {
 	c.wg.Add(1)
 	c.once.Do(func() {
-		c.waitErr = c.c.Wait()
+		if c.ec != nil {
+			c.waitErr = c.ec.Wait()
+		} else {
+			c.waitErr = c.c.Wait()
+		}
 	})
 	c.wg.Done()
 	c.wg.Wait()
@@ -75,29 +110,47 @@ func (c *WslCmd) Wait() (err error) {
 	return c.waitErr
 }
 func (c *WslCmd) ExitCode() int {
-	state := c.c.ProcessState
+	state := c.GetProcessState()
 	if state == nil {
 		return -1
 	}
 	return state.ExitCode()
 }
 func (c *WslCmd) GetProcess() *os.Process {
+	if c.ec != nil {
+		return c.ec.Process
+	}
 	return c.c.Process
 }
 
 func (c *WslCmd) GetProcessState() *os.ProcessState {
+	if c.ec != nil {
+		return c.ec.ProcessState
+	}
 	return c.c.ProcessState
 }
 
 func (c *WslCmd) SetStdin(stdin io.Reader) {
+	if c.ec != nil {
+		c.ec.Stdin = stdin
+		return
+	}
 	c.c.Stdin = stdin
 }
 
 func (c *WslCmd) SetStdout(stdout io.Writer) {
+	if c.ec != nil {
+		c.ec.Stdout = stdout
+		return
+	}
 	c.c.Stdout = stdout
 }
 
 func (c *WslCmd) SetStderr(stderr io.Writer) {
+	if c.ec != nil {
+		c.ec.Stderr = stderr
+		return
+	}
 	c.c.Stdout = stderr
 }
 
@@ -110,7 +163,7 @@ func GetDistroCmd(ctx context.Context, wslDistroName string, cmd string) (*WslCm
 		if distro.Name() != wslDistroName {
 			continue
 		}
-		wrappedDistro := Distro{distro}
+		wrappedDistro := Distro{Distro: distro}
 		return wrappedDistro.WslCommand(ctx, cmd), nil
 	}
 	return nil, fmt.Errorf("wsl distro %s not found", wslDistroName)
@@ -125,7 +178,7 @@ func GetDistro(ctx context.Context, wslDistroName WslName) (*Distro, error) {
 		if distro.Name() != wslDistroName.Distro {
 			continue
 		}
-		wrappedDistro := Distro{distro}
+		wrappedDistro := Distro{Distro: distro}
 		return &wrappedDistro, nil
 	}
 	return nil, fmt.Errorf("wsl distro %s not found", wslDistroName)
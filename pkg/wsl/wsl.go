@@ -22,6 +22,7 @@ import (
 	"github.com/wavetermdev/waveterm/pkg/wconfig"
 	"github.com/wavetermdev/waveterm/pkg/wps"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
 	"github.com/wavetermdev/waveterm/pkg/wshutil"
 )
 
@@ -34,6 +35,9 @@ const (
 )
 
 const DefaultConnectionTimeout = 60 * time.Second
+const WshHandshakeTimeout = 5 * time.Second
+
+const wshInstallPath = "~/.waveterm/bin/wsh"
 
 var globalLock = &sync.Mutex{}
 var clientControllerMap = make(map[string]*WslConn)
@@ -48,9 +52,12 @@ type WslConn struct {
 	DomainSockListener net.Listener
 	ConnController     *WslCmd
 	Error              string
+	WshVersion         string // reported by the connserver in the version handshake
+	WshUpdateTime      int64  // when the helper was last replaced after a version mismatch
 	HasWaiter          *atomic.Bool
 	LastConnectTime    int64
 	ActiveConnNum      int
+	StartDir           string // from wsl:cwd, where shells start (when the block has no cmd:cwd)
 	Context            context.Context
 	cancelFn           func()
 }
@@ -70,6 +77,17 @@ func GetAllConnStatus() []wshrpc.ConnStatus {
 	return connStatuses
 }
 
+func GetAllWshHelperStatus() []wshrpc.WshHelperStatus {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+
+	var rtn []wshrpc.WshHelperStatus
+	for _, conn := range clientControllerMap {
+		rtn = append(rtn, conn.DeriveWshHelperStatus())
+	}
+	return rtn
+}
+
 func GetNumWSLHasConnected() int {
 	globalLock.Lock()
 	defer globalLock.Unlock()
@@ -97,6 +115,19 @@ func (conn *WslConn) DeriveConnStatus() wshrpc.ConnStatus {
 	}
 }
 
+func (conn *WslConn) DeriveWshHelperStatus() wshrpc.WshHelperStatus {
+	conn.Lock.Lock()
+	defer conn.Lock.Unlock()
+	return wshrpc.WshHelperStatus{
+		Connection:      conn.GetName(),
+		WshEnabled:      true,
+		Version:         conn.WshVersion,
+		ExpectedVersion: wavebase.WaveVersion,
+		UpToDate:        conn.WshVersion == wavebase.WaveVersion,
+		UpdateTime:      conn.WshUpdateTime,
+	}
+}
+
 func (conn *WslConn) FireConnChangeEvent() {
 	status := conn.DeriveConnStatus()
 	event := wps.WaveEvent{
@@ -140,6 +171,7 @@ func (conn *WslConn) close_nolock() {
 		conn.cancelFn() // this suspends the conn controller
 		conn.ConnController = nil
 	}
+	conn.WshVersion = ""
 	if conn.Client != nil {
 		// conn.Client.Close() is not relevant here
 		// we do not want to completely close the wsl in case
@@ -188,6 +220,10 @@ func (conn *WslConn) OpenDomainSocketListener() error {
 }
 
 func (conn *WslConn) StartConnServer() error {
+	return conn.startConnServer(GetWshPath(conn.Context, conn.GetClient()))
+}
+
+func (conn *WslConn) startConnServer(wshPath string) error {
 	var allowed bool
 	conn.WithLock(func() {
 		if conn.Status != Status_Connecting {
@@ -200,7 +236,6 @@ func (conn *WslConn) StartConnServer() error {
 		return fmt.Errorf("cannot start conn server for %q when status is %q", conn.GetName(), conn.GetStatus())
 	}
 	client := conn.GetClient()
-	wshPath := GetWshPath(conn.Context, client)
 	rpcCtx := wshrpc.RpcContext{
 		ClientType: wshrpc.ClientType_ConnServer,
 		Conn:       conn.GetName(),
@@ -237,9 +272,11 @@ func (conn *WslConn) StartConnServer() error {
 	// service the I/O
 	go func() {
 		defer panichandler.PanicHandler("wsl:StartConnServer:wait")
-		// wait for termination, clear the controller
+		// wait for termination, clear the controller (unless it was already replaced)
 		defer conn.WithLock(func() {
-			conn.ConnController = nil
+			if conn.ConnController == cmd {
+				conn.ConnController = nil
+			}
 		})
 		waitErr := cmd.Wait()
 		log.Printf("conn controller (%q) terminated: %v", conn.GetName(), waitErr)
@@ -259,6 +296,78 @@ func (conn *WslConn) StartConnServer() error {
 	return nil
 }
 
+// the version of the wsh running the connserver (helpers from before the handshake don't know
+// remotegetinfo, which is an error here)
+func (conn *WslConn) getWshHelperVersion() (string, error) {
+	opts := &wshrpc.RpcOpts{
+		Route:   wshutil.MakeConnectionRouteId(conn.GetName()),
+		Timeout: int(WshHandshakeTimeout.Milliseconds()),
+	}
+	info, err := wshclient.RemoteGetInfoCommand(wshclient.GetBareRpcClient(), opts)
+	if err != nil {
+		return "", err
+	}
+	return info.WshVersion, nil
+}
+
+// stops the connserver and waits for its route to go away (otherwise the cleanup of the old
+// route would remove the route of the next connserver)
+func (conn *WslConn) stopConnServer() error {
+	var cmd *WslCmd
+	conn.WithLock(func() {
+		cmd = conn.ConnController
+		conn.ConnController = nil
+	})
+	if cmd != nil && cmd.GetProcess() != nil {
+		cmd.GetProcess().Kill()
+	}
+	routeId := wshutil.MakeConnectionRouteId(conn.GetName())
+	startTime := time.Now()
+	for wshutil.DefaultRouter.GetRpc(routeId) != nil {
+		if time.Since(startTime) > WshHandshakeTimeout {
+			return fmt.Errorf("timeout waiting for the connserver to stop")
+		}
+		time.Sleep(30 * time.Millisecond)
+	}
+	return nil
+}
+
+// the version handshake with the connserver that was just started (see the one in
+// conncontroller): a helper that doesn't match is replaced and the connserver restarted
+func (conn *WslConn) negotiateWshVersion(ctx context.Context) error {
+	helperVersion, err := conn.getWshHelperVersion()
+	if err == nil && helperVersion == wavebase.WaveVersion {
+		conn.WithLock(func() {
+			conn.WshVersion = helperVersion
+		})
+		return nil
+	}
+	log.Printf("wsh helper on %s does not match (version %q, expected %q, err: %v), replacing it\n", conn.GetName(), helperVersion, wavebase.WaveVersion, err)
+	if err := conn.stopConnServer(); err != nil {
+		return err
+	}
+	err = conn.CheckAndInstallWsh(ctx, conn.GetName(), &WshInstallOpts{Force: true, NoUserPrompt: true})
+	if err != nil {
+		return err
+	}
+	if err := conn.startConnServer(wshInstallPath); err != nil {
+		return err
+	}
+	helperVersion, err = conn.getWshHelperVersion()
+	if err == nil && helperVersion != wavebase.WaveVersion {
+		err = fmt.Errorf("wsh is %s after reinstalling (expected %s)", helperVersion, wavebase.WaveVersion)
+	}
+	if err != nil {
+		conn.stopConnServer()
+		return fmt.Errorf("wsh version handshake failed: %w", err)
+	}
+	conn.WithLock(func() {
+		conn.WshVersion = helperVersion
+		conn.WshUpdateTime = time.Now().UnixMilli()
+	})
+	return nil
+}
+
 type WshInstallOpts struct {
 	Force        bool
 	NoUserPrompt bool
@@ -326,7 +435,7 @@ func (conn *WslConn) CheckAndInstallWsh(ctx context.Context, clientDisplayName s
 	}
 	// attempt to install extension
 	wshLocalPath := shellutil.GetWshBinaryPath(wavebase.WaveVersion, clientOs, clientArch)
-	err = CpHostToRemote(ctx, client, wshLocalPath, "~/.waveterm/bin/wsh")
+	err = CpHostToRemote(ctx, client, wshLocalPath, wshInstallPath)
 	if err != nil {
 		return err
 	}
@@ -334,6 +443,16 @@ func (conn *WslConn) CheckAndInstallWsh(ctx context.Context, clientDisplayName s
 	return nil
 }
 
+// where shells start (~ unless wsl:cwd is set)
+func (conn *WslConn) GetStartDir() string {
+	conn.Lock.Lock()
+	defer conn.Lock.Unlock()
+	if conn.StartDir == "" {
+		return "~"
+	}
+	return conn.StartDir
+}
+
 func (conn *WslConn) GetClient() *Distro {
 	conn.Lock.Lock()
 	defer conn.Lock.Unlock()
@@ -424,14 +543,18 @@ func (conn *WslConn) connectInternal(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	// the keywords of the connection (in connections.json) are read when connecting
+	config := wconfig.ReadFullConfig()
+	connKeywords := config.Connections[conn.GetName()]
+	client.User = connKeywords.WslUser
 	conn.WithLock(func() {
 		conn.Client = client
+		conn.StartDir = connKeywords.WslCwd
 	})
 	err = conn.OpenDomainSocketListener()
 	if err != nil {
 		return err
 	}
-	config := wconfig.ReadFullConfig()
 	installErr := conn.CheckAndInstallWsh(ctx, conn.GetName(), &WshInstallOpts{NoUserPrompt: !config.Settings.ConnAskBeforeWshInstall})
 	if installErr != nil {
 		return fmt.Errorf("conncontroller %s wsh install error: %v", conn.GetName(), installErr)
@@ -440,6 +563,9 @@ func (conn *WslConn) connectInternal(ctx context.Context) error {
 	if csErr != nil {
 		return fmt.Errorf("conncontroller %s start wsh connserver error: %v", conn.GetName(), csErr)
 	}
+	if err := conn.negotiateWshVersion(ctx); err != nil {
+		return fmt.Errorf("conncontroller %s wsh version error: %v", conn.GetName(), err)
+	}
 	conn.HasWaiter.Store(true)
 	go conn.waitForDisconnect()
 	return nil
@@ -61,6 +61,19 @@ func DBGetWSCounts(ctx context.Context) (int, int, error) {
 	return named, total, nil
 }
 
+// row counts for every wave object table (keyed by otype)
+func DBGetTableCounts(ctx context.Context) (map[string]int, error) {
+	return WithTxRtn(ctx, func(tx *TxWrap) (map[string]int, error) {
+		rtn := make(map[string]int)
+		for _, rtype := range waveobj.AllWaveObjTypes() {
+			otype := reflect.Zero(rtype).Interface().(waveobj.WaveObj).GetOType()
+			query := fmt.Sprintf("SELECT count(*) FROM %s", tableNameFromOType(otype))
+			rtn[otype] = tx.GetInt(query)
+		}
+		return rtn, nil
+	})
+}
+
 var viewRe = regexp.MustCompile(`^[a-z0-9]{1,20}$`)
 
 func DBGetBlockViewCounts(ctx context.Context) (map[string]int, error) {
@@ -0,0 +1,285 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wtrace
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+)
+
+const DefaultEndpoint = "http://localhost:4318/v1/traces"
+const ServiceName = "wavesrv"
+const ScopeName = "github.com/wavetermdev/waveterm"
+
+const (
+	spanQueueSize   = 2048
+	maxBatchSize    = 256
+	flushInterval   = 5 * time.Second
+	exportTimeout   = 10 * time.Second
+	maxErrorLogRate = time.Minute
+)
+
+type exporter struct {
+	lock         sync.Mutex
+	endpoint     string
+	spanCh       chan *Span
+	flushCh      chan chan struct{}
+	doneCh       chan struct{}
+	lastErrorLog time.Time
+}
+
+var exporterLock = &sync.Mutex{}
+var curExporter *exporter
+
+// Configure turns tracing on or off and sets the OTLP/HTTP traces endpoint
+func Configure(enable bool, endpoint string) {
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	exporterLock.Lock()
+	defer exporterLock.Unlock()
+	if !enable {
+		enabled.Store(false)
+		if curExporter != nil {
+			curExporter.stop()
+			curExporter = nil
+		}
+		return
+	}
+	if curExporter != nil {
+		curExporter.lock.Lock()
+		curExporter.endpoint = endpoint
+		curExporter.lock.Unlock()
+		return
+	}
+	curExporter = &exporter{
+		endpoint: endpoint,
+		spanCh:   make(chan *Span, spanQueueSize),
+		flushCh:  make(chan chan struct{}),
+		doneCh:   make(chan struct{}),
+	}
+	go curExporter.run()
+	enabled.Store(true)
+}
+
+// Shutdown flushes any queued spans and stops the exporter
+func Shutdown() {
+	Configure(false, "")
+}
+
+func queueSpan(span *Span) {
+	exporterLock.Lock()
+	exp := curExporter
+	exporterLock.Unlock()
+	if exp == nil {
+		return
+	}
+	select {
+	case exp.spanCh <- span:
+	default:
+		// queue is full (collector is down or slow), drop the span
+	}
+}
+
+func (e *exporter) stop() {
+	done := make(chan struct{})
+	e.flushCh <- done
+	<-done
+	close(e.doneCh)
+}
+
+func (e *exporter) run() {
+	defer panichandler.PanicHandler("wtrace:exporter")
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	var batch []*Span
+	for {
+		select {
+		case span := <-e.spanCh:
+			batch = append(batch, span)
+			if len(batch) >= maxBatchSize {
+				e.export(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				e.export(batch)
+				batch = nil
+			}
+		case done := <-e.flushCh:
+			// drain whatever is queued, then flush
+			for drained := false; !drained; {
+				select {
+				case span := <-e.spanCh:
+					batch = append(batch, span)
+				default:
+					drained = true
+				}
+			}
+			if len(batch) > 0 {
+				e.export(batch)
+				batch = nil
+			}
+			close(done)
+		case <-e.doneCh:
+			return
+		}
+	}
+}
+
+func (e *exporter) export(batch []*Span) {
+	e.lock.Lock()
+	endpoint := e.endpoint
+	e.lock.Unlock()
+	body, err := json.Marshal(makeExportRequest(batch))
+	if err != nil {
+		e.logError(fmt.Errorf("marshaling spans: %w", err))
+		return
+	}
+	ctx, cancelFn := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancelFn()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		e.logError(err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		e.logError(err)
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		e.logError(fmt.Errorf("collector returned status %s", resp.Status))
+	}
+}
+
+// export errors are rate limited, a missing collector would otherwise log every few seconds
+func (e *exporter) logError(err error) {
+	if time.Since(e.lastErrorLog) < maxErrorLogRate {
+		return
+	}
+	e.lastErrorLog = time.Now()
+	log.Printf("error exporting trace spans: %v\n", err)
+}
+
+// OTLP JSON encoding (see opentelemetry-proto's ExportTraceServiceRequest).
+// ids are hex strings and 64-bit ints are encoded as strings.
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceId           string         `json:"traceId"`
+	SpanId            string         `json:"spanId"`
+	ParentSpanId      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            *otlpStatus    `json:"status,omitempty"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpExportRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func makeAnyValue(val any) otlpAnyValue {
+	switch v := val.(type) {
+	case string:
+		return otlpAnyValue{StringValue: &v}
+	case bool:
+		return otlpAnyValue{BoolValue: &v}
+	case int:
+		str := strconv.FormatInt(int64(v), 10)
+		return otlpAnyValue{IntValue: &str}
+	case int32:
+		str := strconv.FormatInt(int64(v), 10)
+		return otlpAnyValue{IntValue: &str}
+	case int64:
+		str := strconv.FormatInt(v, 10)
+		return otlpAnyValue{IntValue: &str}
+	case float64:
+		return otlpAnyValue{DoubleValue: &v}
+	default:
+		str := fmt.Sprint(v)
+		return otlpAnyValue{StringValue: &str}
+	}
+}
+
+func makeOtlpSpan(span *Span) otlpSpan {
+	span.lock.Lock()
+	defer span.lock.Unlock()
+	rtn := otlpSpan{
+		TraceId:           hex.EncodeToString(span.TraceId[:]),
+		SpanId:            hex.EncodeToString(span.SpanId[:]),
+		Name:              span.Name,
+		Kind:              span.Kind,
+		StartTimeUnixNano: strconv.FormatInt(span.StartTime.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.EndTime.UnixNano(), 10),
+	}
+	if span.ParentSpanId != [8]byte{} {
+		rtn.ParentSpanId = hex.EncodeToString(span.ParentSpanId[:])
+	}
+	for key, val := range span.Attrs {
+		rtn.Attributes = append(rtn.Attributes, otlpKeyValue{Key: key, Value: makeAnyValue(val)})
+	}
+	if span.StatusCode != StatusCode_Unset {
+		rtn.Status = &otlpStatus{Code: span.StatusCode, Message: span.StatusMessage}
+	}
+	return rtn
+}
+
+func makeExportRequest(batch []*Span) *otlpExportRequest {
+	var scopeSpans otlpScopeSpans
+	scopeSpans.Scope.Name = ScopeName
+	for _, span := range batch {
+		scopeSpans.Spans = append(scopeSpans.Spans, makeOtlpSpan(span))
+	}
+	var resourceSpans otlpResourceSpans
+	resourceSpans.Resource.Attributes = []otlpKeyValue{{Key: "service.name", Value: makeAnyValue(ServiceName)}}
+	resourceSpans.ScopeSpans = []otlpScopeSpans{scopeSpans}
+	return &otlpExportRequest{ResourceSpans: []otlpResourceSpans{resourceSpans}}
+}
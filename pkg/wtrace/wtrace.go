@@ -0,0 +1,154 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// lightweight tracing with OpenTelemetry-compatible export.  spans are only
+// recorded when tracing is enabled (tracing:enabled), otherwise Start returns
+// a nil *Span and every Span method is a no-op.  finished spans are batched and
+// sent to an OTLP/HTTP endpoint using the OTLP JSON encoding.
+package wtrace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	SpanKind_Internal = 1
+	SpanKind_Server   = 2
+	SpanKind_Client   = 3
+)
+
+const (
+	StatusCode_Unset = 0
+	StatusCode_Ok    = 1
+	StatusCode_Error = 2
+)
+
+var enabled = &atomic.Bool{}
+
+type Span struct {
+	lock          sync.Mutex
+	TraceId       [16]byte
+	SpanId        [8]byte
+	ParentSpanId  [8]byte
+	Name          string
+	Kind          int
+	StartTime     time.Time
+	EndTime       time.Time
+	Attrs         map[string]any
+	StatusCode    int
+	StatusMessage string
+	ended         bool
+}
+
+type spanContextKey struct{}
+
+func IsEnabled() bool {
+	return enabled.Load()
+}
+
+// Start begins a span as a child of the span in ctx (if any).  kvs are
+// attribute key/value pairs, like slog ("host", host, "jump", 2).
+// returns a nil span (and the original ctx) when tracing is disabled.
+func Start(ctx context.Context, name string, kvs ...any) (context.Context, *Span) {
+	if !enabled.Load() {
+		return ctx, nil
+	}
+	span := &Span{
+		Name:      name,
+		Kind:      SpanKind_Internal,
+		StartTime: time.Now(),
+		Attrs:     make(map[string]any),
+	}
+	if parent := FromContext(ctx); parent != nil {
+		span.TraceId = parent.TraceId
+		span.ParentSpanId = parent.SpanId
+	} else {
+		rand.Read(span.TraceId[:])
+	}
+	rand.Read(span.SpanId[:])
+	span.setKVs_nolock(kvs)
+	return context.WithValue(ctx, spanContextKey{}, span), span
+}
+
+// StartKind is Start with an explicit span kind (e.g. SpanKind_Server for rpc dispatch)
+func StartKind(ctx context.Context, kind int, name string, kvs ...any) (context.Context, *Span) {
+	ctx, span := Start(ctx, name, kvs...)
+	if span != nil {
+		span.Kind = kind
+	}
+	return ctx, span
+}
+
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+func (s *Span) setKVs_nolock(kvs []any) {
+	for idx := 0; idx+1 < len(kvs); idx += 2 {
+		key, ok := kvs[idx].(string)
+		if !ok {
+			key = fmt.Sprint(kvs[idx])
+		}
+		s.Attrs[key] = kvs[idx+1]
+	}
+}
+
+func (s *Span) SetAttrs(kvs ...any) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.setKVs_nolock(kvs)
+}
+
+// RecordError marks the span as failed (nil errors are ignored)
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.StatusCode = StatusCode_Error
+	s.StatusMessage = err.Error()
+}
+
+// End finishes the span and queues it for export (only the first call counts)
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	if s.ended {
+		s.lock.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	s.lock.Unlock()
+	queueSpan(s)
+}
+
+func (s *Span) TraceIdHex() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.TraceId[:])
+}
+
+// EndErr records err (if non-nil), ends the span, and returns err (for "return span.EndErr(fn())")
+func (s *Span) EndErr(err error) error {
+	s.RecordError(err)
+	s.End()
+	return err
+}
@@ -0,0 +1,85 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wtrace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestDisabled(t *testing.T) {
+	ctx, span := Start(context.Background(), "test.disabled")
+	if span != nil {
+		t.Errorf("expected nil span when tracing is disabled")
+	}
+	if FromContext(ctx) != nil {
+		t.Errorf("expected no span in context when tracing is disabled")
+	}
+	// nil spans must be safe to use
+	span.SetAttrs("key", "val")
+	if span.EndErr(errors.New("test")) == nil {
+		t.Errorf("EndErr should return the error")
+	}
+}
+
+func TestExport(t *testing.T) {
+	var lock sync.Mutex
+	var received []otlpExportRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req otlpExportRequest
+		err := json.Unmarshal(body, &req)
+		if err != nil {
+			t.Errorf("bad export body: %v", err)
+		}
+		lock.Lock()
+		received = append(received, req)
+		lock.Unlock()
+	}))
+	defer server.Close()
+
+	Configure(true, server.URL)
+	ctx, parent := Start(context.Background(), "test.parent", "host", "example.com")
+	_, child := Start(ctx, "test.child", "jump", int32(2))
+	child.RecordError(errors.New("auth failed"))
+	child.End()
+	parent.End()
+	parent.End() // second End is ignored
+	Shutdown()
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(received) != 1 {
+		t.Fatalf("expected 1 export request, got %d", len(received))
+	}
+	spans := received[0].ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	childSpan, parentSpan := spans[0], spans[1]
+	if childSpan.TraceId != parentSpan.TraceId || len(childSpan.TraceId) != 32 {
+		t.Errorf("child should share the parent's trace id: %q vs %q", childSpan.TraceId, parentSpan.TraceId)
+	}
+	if childSpan.ParentSpanId != parentSpan.SpanId {
+		t.Errorf("child parentSpanId %q, expected %q", childSpan.ParentSpanId, parentSpan.SpanId)
+	}
+	if parentSpan.ParentSpanId != "" {
+		t.Errorf("root span should not have a parent")
+	}
+	if childSpan.Status == nil || childSpan.Status.Code != StatusCode_Error || childSpan.Status.Message != "auth failed" {
+		t.Errorf("child span should have an error status, got %#v", childSpan.Status)
+	}
+	if len(childSpan.Attributes) != 1 || childSpan.Attributes[0].Value.IntValue == nil || *childSpan.Attributes[0].Value.IntValue != "2" {
+		t.Errorf("bad child attributes: %#v", childSpan.Attributes)
+	}
+	if IsEnabled() {
+		t.Errorf("tracing should be disabled after Shutdown")
+	}
+}